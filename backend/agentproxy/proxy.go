@@ -94,8 +94,24 @@ func (p *Proxy) director(r *http.Request) {
 	r.URL.Host = p.upstream.Host
 	r.Host = p.upstream.Host
 
-	// Strip whatever the agent presented and substitute real credentials.
+	// Strip whatever the agent presented and substitute real credentials,
+	// in the form the upstream route expects.
 	r.Header.Del("x-api-key")
 	r.Header.Del("Authorization")
-	r.Header.Set("x-api-key", p.apiKey)
+	if anthropicRoute(r.URL.Path) {
+		r.Header.Set("x-api-key", p.apiKey)
+	} else {
+		r.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+}
+
+// anthropicRoute reports whether path is an Anthropic API route
+// (/v1/messages and its sub-routes such as count_tokens, or the legacy
+// /v1/complete), which takes the key as x-api-key. Every other route is
+// OpenAI-style (chat/completions, responses, embeddings, models) and takes
+// a Bearer token. The route decides, not the header the agent used: an
+// Anthropic client that authenticates to the proxy with a Bearer token
+// still has to reach Anthropic with x-api-key.
+func anthropicRoute(path string) bool {
+	return strings.Contains(path, "/v1/messages") || strings.HasSuffix(path, "/v1/complete")
 }
@@ -75,7 +75,7 @@ func TestProxy_RejectsUnknownToken(t *testing.T) {
 	upstream := httptest.NewServer(rec.handler())
 	defer upstream.Close()
 
-	p, err := New(upstream.URL, "real-key", nil)
+	p, err := New(upstream.URL, "real-key")
 	if err != nil {
 		t.Fatalf("New: %v", err)
 	}
@@ -99,7 +99,7 @@ func TestProxy_RevokeToken(t *testing.T) {
 	upstream := httptest.NewServer(rec.handler())
 	defer upstream.Close()
 
-	p, _ := New(upstream.URL, "real-key", nil)
+	p, _ := New(upstream.URL, "real-key")
 	tok := p.IssueToken()
 	p.RevokeToken(tok)
 
@@ -118,7 +118,7 @@ func TestProxy_AcceptsBearerToken(t *testing.T) {
 	upstream := httptest.NewServer(rec.handler())
 	defer upstream.Close()
 
-	p, _ := New(upstream.URL, "real-key", nil)
+	p, _ := New(upstream.URL, "real-key")
 	tok := p.IssueToken()
 
 	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`))
@@ -131,8 +131,51 @@ func TestProxy_AcceptsBearerToken(t *testing.T) {
 	}
 }
 
+func TestProxy_UpstreamAuthFollowsRoute(t *testing.T) {
+	cases := []struct {
+		name       string
+		path       string
+		agentAuth  string // header the agent authenticates with
+		wantAPIKey string
+		wantAuth   string
+	}{
+		{"anthropic with x-api-key", "/v1/messages", "x-api-key", "real-key", ""},
+		{"anthropic with bearer", "/v1/messages", "Authorization", "real-key", ""},
+		{"anthropic count tokens", "/v1/messages/count_tokens", "Authorization", "real-key", ""},
+		{"openai chat with bearer", "/v1/chat/completions", "Authorization", "", "Bearer real-key"},
+		{"openai chat with x-api-key", "/v1/chat/completions", "x-api-key", "", "Bearer real-key"},
+		{"openai responses", "/v1/responses", "Authorization", "", "Bearer real-key"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := &upstreamRecorder{}
+			upstream := httptest.NewServer(rec.handler())
+			defer upstream.Close()
+
+			p, _ := New(upstream.URL, "real-key")
+			tok := p.IssueToken()
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(`{}`))
+			if tc.agentAuth == "x-api-key" {
+				req.Header.Set("x-api-key", tok)
+			} else {
+				req.Header.Set("Authorization", "Bearer "+tok)
+			}
+			resp := httptest.NewRecorder()
+			p.ServeHTTP(resp, req)
+
+			if resp.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", resp.Code)
+			}
+			if rec.gotAPIKey != tc.wantAPIKey || rec.gotAuth != tc.wantAuth {
+				t.Errorf("upstream x-api-key=%q Authorization=%q; want %q and %q",
+					rec.gotAPIKey, rec.gotAuth, tc.wantAPIKey, tc.wantAuth)
+			}
+		})
+	}
+}
+
 func TestServer_BaseURLLoopback(t *testing.T) {
-	p, _ := New("http://example.invalid", "k", nil)
+	p, _ := New("http://example.invalid", "k")
 	srv, err := Start(p)
 	if err != nil {
 		t.Fatalf("Start: %v", err)
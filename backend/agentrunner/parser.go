@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -22,13 +23,35 @@ type AgentDef struct {
 	Schedule string `yaml:"schedule,omitempty"`
 	Path     string `yaml:"path,omitempty"`
 	Enabled  *bool  `yaml:"enabled,omitempty"`
-	Prompt   string `yaml:"-"` // markdown body below frontmatter
-	File     string `yaml:"-"` // source filename
+
+	// Permissions is "bypass" (the default: every tool call is allowed) or
+	// "gated": the agent asks before acting, and each request waits in the
+	// approvals inbox until the owner answers or ApprovalTimeout passes, at
+	// which point OnTimeout ("deny", the default, or "approve") applies.
+	Permissions     string `yaml:"permissions,omitempty"`
+	ApprovalTimeout string `yaml:"approvalTimeout,omitempty"` // Go duration, e.g. "4h"; default 24h
+	OnTimeout       string `yaml:"onTimeout,omitempty"`
+
+	Prompt string `yaml:"-"` // markdown body below frontmatter
+	File   string `yaml:"-"` // source filename
 }
 
 // DefaultAgent is the agent type used when an AgentDef omits `agent:`.
 const DefaultAgent = "claude_code"
 
+// Values of AgentDef.Permissions and AgentDef.OnTimeout.
+const (
+	PermissionsBypass = "bypass"
+	PermissionsGated  = "gated"
+
+	OnTimeoutDeny    = "deny"
+	OnTimeoutApprove = "approve"
+)
+
+// DefaultApprovalTimeout is how long a gated agent's request waits for an
+// answer when the definition doesn't say.
+const DefaultApprovalTimeout = 24 * time.Hour
+
 var separator = []byte("---")
 
 // ParseAgentDef parses a markdown file with YAML frontmatter delimited by
@@ -56,6 +79,12 @@ func ParseAgentDef(data []byte, name, filename string) (*AgentDef, error) {
 	if def.Agent == "" {
 		def.Agent = DefaultAgent
 	}
+	if def.Permissions == "" {
+		def.Permissions = PermissionsBypass
+	}
+	if def.OnTimeout == "" {
+		def.OnTimeout = OnTimeoutDeny
+	}
 
 	def.Prompt = strings.TrimSpace(string(body))
 	// Folder-derived name wins; overwrite whatever the YAML had.
@@ -72,10 +101,30 @@ func ParseAgentDef(data []byte, name, filename string) (*AgentDef, error) {
 	if isFileTrigger(def.Trigger) && def.Path == "" {
 		return nil, fmt.Errorf("parsing %s: file trigger %q requires a \"path\" glob pattern", filename, def.Trigger)
 	}
+	if def.Permissions != PermissionsBypass && def.Permissions != PermissionsGated {
+		return nil, fmt.Errorf("parsing %s: permissions must be %q or %q", filename, PermissionsBypass, PermissionsGated)
+	}
+	if def.OnTimeout != OnTimeoutDeny && def.OnTimeout != OnTimeoutApprove {
+		return nil, fmt.Errorf("parsing %s: onTimeout must be %q or %q", filename, OnTimeoutDeny, OnTimeoutApprove)
+	}
+	if def.ApprovalTimeout != "" {
+		if d, err := time.ParseDuration(def.ApprovalTimeout); err != nil || d <= 0 {
+			return nil, fmt.Errorf("parsing %s: approvalTimeout %q is not a positive duration", filename, def.ApprovalTimeout)
+		}
+	}
 
 	return &def, nil
 }
 
+// ApprovalWait returns how long a gated run's permission request waits for
+// an answer.
+func (d *AgentDef) ApprovalWait() time.Duration {
+	if t, err := time.ParseDuration(d.ApprovalTimeout); err == nil && t > 0 {
+		return t
+	}
+	return DefaultApprovalTimeout
+}
+
 func isFileTrigger(trigger string) bool {
 	switch trigger {
 	case "file.created", "file.changed", "file.moved", "file.deleted":
@@ -2,6 +2,7 @@ package agentrunner
 
 import (
 	"testing"
+	"time"
 )
 
 func TestParseCompleteFileCreatedAgent(t *testing.T) {
@@ -278,3 +279,52 @@ Generate a daily summary.
 		t.Errorf("Path = %q, want empty for cron trigger", def.Path)
 	}
 }
+
+func TestParseGatedAgent(t *testing.T) {
+	input := `---
+trigger: cron
+schedule: "0 3 * * *"
+permissions: gated
+approvalTimeout: 4h
+onTimeout: approve
+---
+
+Clean up old build artifacts.
+`
+	def, err := ParseAgentDef([]byte(input), "cleanup", "cleanup.md")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if def.Permissions != PermissionsGated {
+		t.Errorf("Permissions = %q, want %q", def.Permissions, PermissionsGated)
+	}
+	if def.ApprovalWait() != 4*time.Hour {
+		t.Errorf("ApprovalWait = %s, want 4h", def.ApprovalWait())
+	}
+	if def.OnTimeout != OnTimeoutApprove {
+		t.Errorf("OnTimeout = %q, want %q", def.OnTimeout, OnTimeoutApprove)
+	}
+
+	// Defaults: bypass, deny after 24h.
+	def, err = ParseAgentDef([]byte("---\ntrigger: cron\nschedule: \"@daily\"\n---\nhi\n"), "d", "d.md")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if def.Permissions != PermissionsBypass || def.OnTimeout != OnTimeoutDeny || def.ApprovalWait() != DefaultApprovalTimeout {
+		t.Errorf("defaults = %q, %q, %s", def.Permissions, def.OnTimeout, def.ApprovalWait())
+	}
+}
+
+func TestErrorOnInvalidApprovalSettings(t *testing.T) {
+	for _, field := range []string{
+		"permissions: ask",
+		"onTimeout: retry",
+		"approvalTimeout: soon",
+		"approvalTimeout: -1h",
+	} {
+		input := "---\ntrigger: cron\nschedule: \"@daily\"\n" + field + "\n---\nhi\n"
+		if _, err := ParseAgentDef([]byte(input), "bad", "bad.md"); err == nil {
+			t.Errorf("%s: expected error", field)
+		}
+	}
+}
@@ -30,6 +30,17 @@ type SessionParams struct {
 	DefaultModel   string // optional — empty means "let AgentManager pick the per-agent default"
 	TriggerKind    string // event type that fired this run, e.g. "cron.tick", "file.created"
 	TriggerData    string // JSON-encoded trigger payload data (path, schedule, etc.)
+
+	// Approval is set for gated runs: permission requests are queued for the
+	// owner instead of auto-approved. Nil = bypassPermissions.
+	Approval *ApprovalPolicy
+}
+
+// ApprovalPolicy is how a gated run's permission requests are answered when
+// nobody does.
+type ApprovalPolicy struct {
+	Timeout   time.Duration // how long a request waits
+	OnTimeout string        // OnTimeoutDeny or OnTimeoutApprove
 }
 
 // Config holds the configuration for the agent runner.
@@ -618,17 +629,28 @@ func (r *Runner) execute(ctx context.Context, def *AgentDef, payload hooks.Paylo
 	// Create session through the shared api path. The shared function
 	// handles DB persistence, frame broadcasting, synth user message,
 	// and sending the prompt in a background goroutine.
+	// Bypass runs answer every permission request themselves. Gated runs
+	// boot in the agent's default mode, which asks; the requests go to the
+	// approvals inbox and the turn waits for the owner's answer.
+	permissionMode := "bypassPermissions"
+	var approval *ApprovalPolicy
+	if def.Permissions == PermissionsGated {
+		permissionMode = ""
+		approval = &ApprovalPolicy{Timeout: def.ApprovalWait(), OnTimeout: def.OnTimeout}
+	}
+
 	session, promptDone, err := r.cfg.CreateSession(ctx, SessionParams{
 		AgentType:      def.Agent,
 		WorkingDir:     r.cfg.WorkingDir,
 		Title:          def.Name,
 		Message:        prompt,
-		PermissionMode: "bypassPermissions",
+		PermissionMode: permissionMode,
 		Source:         "auto",
 		AgentName:      def.Name,
 		DefaultModel:   def.Model,
 		TriggerKind:    string(payload.EventType),
 		TriggerData:    triggerData,
+		Approval:       approval,
 	})
 	if err != nil {
 		log.Error().Err(err).Str("agent", def.Name).Msg("failed to create agent session")
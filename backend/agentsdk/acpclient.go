@@ -1,13 +1,16 @@
 package agentsdk
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	acp "github.com/coder/acp-go-sdk"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
@@ -26,6 +29,10 @@ type acpClient struct {
 	autoApprove bool
 	workingDir  string
 
+	// Terminal commands run under the agent's limits, inside its sandbox.
+	limits  ResourceLimits
+	sandbox *sandbox
+
 	// Permanent frame handler — set once via SetOnFrame(), never cleared.
 	// Every frame from the ACP SDK is delivered here. Never nil after setup.
 	mu      sync.RWMutex
@@ -43,6 +50,10 @@ type acpClient struct {
 	// Permission handling — maps request ID to response channel.
 	permMu       sync.Mutex
 	permChannels map[string]chan permResponse
+
+	// turn is the running turn's time limit, paused while a permission
+	// request waits for an answer. nil without a TurnTimeout.
+	turn atomic.Pointer[turnClock]
 }
 
 type permResponse struct {
@@ -111,6 +122,11 @@ func (c *acpClient) RequestPermission(ctx context.Context, params acp.RequestPer
 	if c.autoApprove {
 		return autoApprovePermission(params)
 	}
+	// The user's think time is not the agent's work time.
+	if clock := c.turn.Load(); clock != nil {
+		clock.pause()
+		defer clock.resume()
+	}
 
 	// Generate a request ID from the tool call ID
 	requestID := string(params.ToolCall.ToolCallId)
@@ -268,6 +284,11 @@ var (
 func (c *acpClient) CreateTerminal(ctx context.Context, params acp.CreateTerminalRequest) (acp.CreateTerminalResponse, error) {
 	log.Info().Str("command", params.Command).Strs("args", params.Args).Msg("ACP CreateTerminal")
 
+	if c.limits.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.limits.CommandTimeout)
+		defer cancel()
+	}
 	cmd := exec.CommandContext(ctx, params.Command, params.Args...)
 	if params.Cwd != nil {
 		cmd.Dir = *params.Cwd
@@ -277,14 +298,39 @@ func (c *acpClient) CreateTerminal(ctx context.Context, params acp.CreateTermina
 	for _, env := range params.Env {
 		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
 	}
+	if c.limits.CommandTimeout > 0 {
+		// On timeout kill the command's whole process group, and don't
+		// wait on pipes a backgrounded grandchild still holds.
+		confineCmd(cmd)
+		cmd.Cancel = func() error { return killGroup(cmd.Process.Pid) }
+		cmd.WaitDelay = time.Second
+	}
+	if c.limits.IsolateNetwork {
+		if err := isolateNetwork(cmd); err != nil {
+			return acp.CreateTerminalResponse{}, fmt.Errorf("network isolation for terminal commands: %w", err)
+		}
+	}
 
-	output, err := cmd.CombinedOutput()
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	sandboxed := c.sandbox.prepare(cmd)
+	if err := cmd.Start(); err != nil {
+		sandboxed(0)
+		return acp.CreateTerminalResponse{}, fmt.Errorf("start %s: %w", params.Command, err)
+	}
+	sandboxed(cmd.Process.Pid)
+	err := cmd.Wait()
 	exitCode := 0
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			exitCode = exitErr.ExitCode()
 		}
 	}
+	output := buf.Bytes()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		output = fmt.Appendf(output, "\n[killed: command exceeded its %s time limit]\n", c.limits.CommandTimeout)
+	}
 
 	termID := fmt.Sprintf("term-%d", terminalCounter.Add(1))
 	state := &terminalState{
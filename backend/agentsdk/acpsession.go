@@ -20,6 +20,7 @@ type acpSession struct {
 	client    *acpClient
 	sessionID string
 	agentType AgentType
+	sandbox   *sandbox // nil when the process runs without ResourceLimits
 
 	mu     sync.Mutex
 	closed bool
@@ -43,11 +44,14 @@ type warmConn struct {
 	client        *acpClient
 	done          <-chan struct{} // closed when agent process exits
 	supportsClose bool            // agent advertised session/close capability
+	rss           int64           // resident memory when it joined a pool, bytes
+	sandbox       *sandbox        // nil when spawned without ResourceLimits
 }
 
 // spawnWarmConn launches an agent binary and completes the Initialize handshake.
 // The returned warmConn is session-independent and ready for NewSession.
-func spawnWarmConn(ctx context.Context, agentCfg AgentConfig, env map[string]string) (*warmConn, error) {
+// The process and everything it starts are confined by limits.
+func spawnWarmConn(ctx context.Context, agentCfg AgentConfig, env map[string]string, limits ResourceLimits) (*warmConn, error) {
 	cmd := exec.CommandContext(ctx, agentCfg.Command, agentCfg.Args...)
 
 	cmd.Env = baseCommandEnv(agentCfg.CleanEnv)
@@ -56,6 +60,7 @@ func spawnWarmConn(ctx context.Context, agentCfg AgentConfig, env map[string]str
 	}
 
 	cmd.Stderr = &logWriter{prefix: "agent"}
+	sb := newSandbox(limits, cmd)
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -77,6 +82,7 @@ func spawnWarmConn(ctx context.Context, agentCfg AgentConfig, env map[string]str
 	}
 
 	if err := cmd.Start(); err != nil {
+		sb.startFailed()
 		return nil, &AgentError{
 			Type:    ErrAgentCrash,
 			Agent:   agentCfg.Type,
@@ -91,9 +97,10 @@ func spawnWarmConn(ctx context.Context, agentCfg AgentConfig, env map[string]str
 		Int("pid", cmd.Process.Pid).
 		Msg("agent process started")
 
-	acpCli := &acpClient{}
+	acpCli := &acpClient{limits: limits, sandbox: sb}
 
 	conn := acp.NewClientSideConnection(acpCli, stdin, stdout)
+	sb.started(cmd.Process.Pid, conn.Done())
 
 	initResp, err := conn.Initialize(ctx, acp.InitializeRequest{
 		ProtocolVersion: acp.ProtocolVersionNumber,
@@ -132,7 +139,7 @@ func spawnWarmConn(ctx context.Context, agentCfg AgentConfig, env map[string]str
 		Bool("supportsClose", supportsClose).
 		Msg("ACP initialized")
 
-	return &warmConn{cmd: cmd, conn: conn, client: acpCli, done: conn.Done(), supportsClose: supportsClose}, nil
+	return &warmConn{cmd: cmd, conn: conn, client: acpCli, done: conn.Done(), supportsClose: supportsClose, sandbox: sb}, nil
 }
 
 // newSessionFromWarm creates an acpSession from a pre-warmed connection.
@@ -195,6 +202,7 @@ func newSessionFromWarm(ctx context.Context, warm *warmConn, agentCfg AgentConfi
 		client:        warm.client,
 		sessionID:     string(sessResp.SessionId),
 		agentType:     agentCfg.Type,
+		sandbox:       warm.sandbox,
 		mcpServers:    mcpServers,
 		supportsClose: warm.supportsClose,
 	}
@@ -234,8 +242,8 @@ func newSessionFromWarm(ctx context.Context, warm *warmConn, agentCfg AgentConfi
 
 // spawnACPSession launches an agent binary, creates the ACP connection,
 // performs the initialization handshake, and creates a new session.
-func spawnACPSession(ctx context.Context, agentCfg AgentConfig, config SessionConfig, env map[string]string) (*acpSession, error) {
-	warm, err := spawnWarmConn(ctx, agentCfg, env)
+func spawnACPSession(ctx context.Context, agentCfg AgentConfig, config SessionConfig, env map[string]string, limits ResourceLimits) (*acpSession, error) {
+	warm, err := spawnWarmConn(ctx, agentCfg, env, limits)
 	if err != nil {
 		return nil, err
 	}
@@ -280,14 +288,44 @@ func (s *acpSession) Send(ctx context.Context, prompt string) (<-chan []byte, er
 		}
 	}
 
+	// The turn time limit kills the process rather than cancelling the
+	// prompt: a runaway tool call doesn't stop on an ACP cancel. The clock
+	// pauses while a permission request waits for the user.
+	cancelTurn := func() {}
+	if s.sandbox != nil && s.sandbox.limits.TurnTimeout > 0 {
+		clock := startTurnClock(s.sandbox.limits.TurnTimeout, func() {
+			log.Warn().Str("session_id", s.sessionID).Dur("limit", s.sandbox.limits.TurnTimeout).Msg("agent turn over time limit — killing agent")
+			s.sandbox.kill(LimitTimeout)
+		})
+		s.client.turn.Store(clock)
+		cancelTurn = func() {
+			s.client.turn.CompareAndSwap(clock, nil)
+			clock.stop()
+		}
+	}
+
 	go func() {
 		defer close(events)
+		defer cancelTurn()
 
 		resp, err := s.conn.Prompt(ctx, acp.PromptRequest{
 			SessionId: acp.SessionId(s.sessionID),
 			Prompt:    []acp.ContentBlock{acp.TextBlock(prompt)},
 		})
 		if err != nil {
+			// A sandbox kill ends the turn with the limit that was hit,
+			// however the dying process surfaced in conn.Prompt.
+			if reason := s.limitKillReason(); reason != "" {
+				if data, err := json.Marshal(map[string]any{
+					"type":    "error",
+					"message": s.sandbox.limits.limitKillMessage(reason),
+					"code":    CodeLimitExceeded,
+					"data":    map[string]any{"limit": reason},
+				}); err == nil {
+					events <- data
+				}
+				return
+			}
 			// Check if this is a context cancellation
 			if ctx.Err() != nil {
 				if data, err := json.Marshal(map[string]any{
@@ -385,6 +423,11 @@ func (s *acpSession) RespondToPermission(ctx context.Context, toolCallID string,
 	return s.client.respondToPermission(toolCallID, true, optionID)
 }
 
+// DenyPermission refuses one pending permission request.
+func (s *acpSession) DenyPermission(ctx context.Context, toolCallID string) error {
+	return s.client.respondToPermission(toolCallID, false, "")
+}
+
 // CancelAllPermissions cancels all pending permission requests.
 func (s *acpSession) CancelAllPermissions() {
 	s.client.cancelAllPermissions()
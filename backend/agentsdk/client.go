@@ -23,69 +23,137 @@ const createSessionMaxAttempts = 3
 // It wraps ACP connections with MyLifeDB-specific concerns.
 type Client struct {
 	agents   map[AgentType]AgentConfig
+	order    []AgentType // registration order, for AvailableAgents
 	defaults SessionConfig
 
 	mu     sync.Mutex
 	active map[string]Session // sessionID → Session
 
-	pool *ProcessPool // pre-warmed ACP connections
+	pools      *poolSet // pre-warmed ACP connections, per agent and model env
+	poolLimits PoolLimits
+
+	limits ResourceLimits // confine every agent process; zero = unconfined
+
+	completer Completer // agent-free LLM calls; nil until SetCompleter
 }
 
 // NewClient creates a Client with registered agents and default config.
 func NewClient(defaults SessionConfig, agents ...AgentConfig) *Client {
 	m := make(map[AgentType]AgentConfig, len(agents))
+	order := make([]AgentType, 0, len(agents))
 	for _, a := range agents {
+		if _, dup := m[a.Type]; !dup {
+			order = append(order, a.Type)
+		}
 		m[a.Type] = a
 	}
 	return &Client{
 		agents:   m,
+		order:    order,
 		defaults: defaults,
 		active:   make(map[string]Session),
 	}
 }
 
+// SetPoolLimits configures the warm pools. Call before StartPool; pools
+// already started keep the limits they were created with.
+func (c *Client) SetPoolLimits(limits PoolLimits) {
+	c.poolLimits = limits
+}
+
+// SetResourceLimits confines agent processes spawned from now on, and the
+// terminal commands they run. Call before StartPool so warm processes are
+// confined too.
+func (c *Client) SetResourceLimits(limits ResourceLimits) {
+	c.limits = limits
+}
+
 // StartPool begins pre-warming ACP connections for the given agent type.
 // Call this once during server startup. poolSize=0 uses the default (3).
+//
+// This is the agent's base pool, for sessions on its default model. Sessions
+// that boot with a per-session env (another gateway model) are served by a
+// per-model pool created on first use, so only the first such session pays
+// a cold spawn. Every pool sizes itself from recent session starts and
+// shrinks when idle, within the limits from SetPoolLimits.
 func (c *Client) StartPool(ctx context.Context, agent AgentType, poolSize int) {
-	agentCfg, err := c.getAgent(agent)
-	if err != nil {
+	if _, err := c.getAgent(agent); err != nil {
 		log.Warn().Err(err).Str("agent", string(agent)).Msg("cannot start pool: agent not registered")
 		return
 	}
 
-	env := c.MergeEnv(agentCfg, c.defaults)
-
-	c.pool = newProcessPool(PoolConfig{
-		Size:      poolSize,
-		AgentType: agent,
-		Spawn: func(ctx context.Context) (*warmConn, error) {
-			return spawnWarmConn(ctx, agentCfg, env)
-		},
+	if c.pools == nil {
+		c.pools = newPoolSet(ctx, c.poolLimits, c.poolSpawner)
+		go c.pools.run()
+	}
+	if poolSize <= 0 {
+		poolSize = defaultPoolSize
+	}
+	p := c.pools.startBase(agent, PoolConfig{
+		Size: poolSize,
+		Min:  1,
+		Max:  2 * poolSize,
 	})
-	c.pool.Start(ctx)
 
 	log.Info().
 		Str("agent", string(agent)).
-		Int("size", c.pool.cfg.Size).
+		Int("size", p.cfg.Size).
+		Int("max", p.cfg.Max).
 		Msg("ACP process pool started")
 }
 
-// ShutdownPool stops the pool and kills all warm connections.
+// poolSpawner returns the factory a pool uses to boot agent with the given
+// per-session env on top of the agent's own.
+func (c *Client) poolSpawner(agent AgentType, env map[string]string) func(ctx context.Context) (*warmConn, error) {
+	return func(ctx context.Context) (*warmConn, error) {
+		agentCfg, err := c.getAgent(agent)
+		if err != nil {
+			return nil, err
+		}
+		return spawnWarmConn(ctx, agentCfg, c.MergeEnv(agentCfg, SessionConfig{Env: env}), c.limits)
+	}
+}
+
+// PoolStats returns a snapshot of every warm pool; nil when pooling is off.
+func (c *Client) PoolStats() []PoolStats {
+	if c.pools == nil {
+		return nil
+	}
+	return c.pools.stats()
+}
+
+// PoolLimits returns the limits the pools run under.
+func (c *Client) PoolLimits() PoolLimits {
+	if c.pools != nil {
+		return c.pools.limits
+	}
+	return c.poolLimits
+}
+
+// ShutdownPool stops the pools and kills all warm connections.
 func (c *Client) ShutdownPool() {
-	if c.pool != nil {
-		c.pool.Shutdown()
+	if c.pools != nil {
+		c.pools.shutdown()
 	}
 }
 
-// AvailableAgents returns metadata about all registered agents.
+// AvailableAgents returns metadata about all registered agents, in
+// registration order.
 func (c *Client) AvailableAgents() []AgentInfo {
-	infos := make([]AgentInfo, 0, len(c.agents))
-	for _, a := range c.agents {
-		infos = append(infos, AgentInfo{Type: a.Type, Name: a.Name})
+	infos := make([]AgentInfo, 0, len(c.order))
+	for _, t := range c.order {
+		a := c.agents[t]
+		infos = append(infos, AgentInfo{Type: a.Type, Name: a.Name, Capabilities: a.Capabilities})
 	}
 	return infos
 }
 
+// Agent returns the registered config for the given agent type.
+func (c *Client) Agent(agent AgentType) (AgentConfig, bool) {
+	a, ok := c.agents[agent]
+	return a, ok
+}
+
 // CreateSession starts an interactive, multi-turn agent session via ACP.
 // Spawns the agent binary, establishes ACP connection, creates session.
 func (c *Client) CreateSession(ctx context.Context, config SessionConfig) (Session, error) {
@@ -104,11 +172,10 @@ func (c *Client) CreateSession(ctx context.Context, config SessionConfig) (Sessi
 		config.McpServers = c.defaults.McpServers
 	}
 
-	// Use the pre-warmed pool only when there is no per-session env override.
-	// Pool processes are spawned once with a fixed env (from AgentConfig.Env),
-	// so a session that needs different env vars (e.g. ANTHROPIC_MODEL tied to
-	// a specific user-selected gateway model) must spawn fresh.
-	canUsePool := c.pool != nil && config.Agent == c.pool.cfg.AgentType && len(config.Env) == 0
+	// Pool processes are spawned with a fixed env, so a session is served by
+	// the pool for its exact per-session env (e.g. ANTHROPIC_MODEL tied to a
+	// user-selected gateway model) — the agent's base pool when it has none.
+	canUsePool := c.pools != nil && c.pools.enabled(config.Agent)
 
 	// Retry transparently on agent_crash. The pool's dead-conn check is racy
 	// (a warm conn can die between Acquire and NewSession); a buggy agent build
@@ -158,13 +225,13 @@ func (c *Client) createSessionWithRetry(
 		var err error
 		if usePool {
 			var warm *warmConn
-			warm, err = c.pool.Acquire(ctx)
+			warm, err = c.pools.pool(config.Agent, config.Env).Acquire(ctx)
 			if err == nil {
 				session, err = newSessionFromWarm(ctx, warm, agentCfg, config)
 			}
 		} else {
 			env := c.MergeEnv(agentCfg, config)
-			session, err = spawnACPSession(ctx, agentCfg, config, env)
+			session, err = spawnACPSession(ctx, agentCfg, config, env, c.limits)
 		}
 
 		if err == nil {
@@ -209,18 +276,21 @@ func (c *Client) ResumeSession(ctx context.Context, sessionID string, config Ses
 // CreateSessionWithLoad creates an ACP session and immediately tries to load
 // a historical session by ID. This spawns the agent process, establishes the
 // ACP connection, then calls session/load to replay history events.
-// If LoadSession fails (e.g., session not found on disk), the session is still
-// usable — just without history. The returned events slice may be nil if
-// history loading failed.
-func (c *Client) CreateSessionWithLoad(ctx context.Context, cfg SessionConfig, historicalSessionID string) (Session, error) {
+// The replayed frames go to onLoad, which stays installed as the session's
+// frame handler until the caller sets its own; pass a no-op when the
+// history is already on hand. If LoadSession fails (e.g., session not found
+// on disk), the session is still usable — just without history.
+func (c *Client) CreateSessionWithLoad(ctx context.Context, cfg SessionConfig, historicalSessionID string, onLoad func([]byte)) (Session, error) {
 	// Create the ACP session normally (spawns agent process)
 	sess, err := c.CreateSession(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	// Load the historical session. Frames are delivered via the onFrame handler
-	// (must be set by the caller before this call).
+	// Load the historical session. Frames are delivered via the onFrame handler.
+	if onLoad != nil {
+		sess.SetOnFrame(onLoad)
+	}
 	if err := sess.LoadSession(ctx, historicalSessionID, cfg.WorkingDir); err != nil {
 		// LoadSession failed — session is still usable, just no history
 		log.Warn().Err(err).
@@ -231,7 +301,9 @@ func (c *Client) CreateSessionWithLoad(ctx context.Context, cfg SessionConfig, h
 	return sess, nil
 }
 
-// RunTask runs a one-off agent task to completion.
+// RunTask runs a one-off agent task to completion and returns what the
+// agent said and did: the final message, tool calls, plan and usage, plus
+// a validated JSON answer when config.OutputSchema is set.
 func (c *Client) RunTask(ctx context.Context, config TaskConfig) (TaskResult, error) {
 	if config.Timeout > 0 {
 		var cancel context.CancelFunc
@@ -245,33 +317,60 @@ func (c *Client) RunTask(ctx context.Context, config TaskConfig) (TaskResult, er
 	}
 	defer session.Close()
 
-	frames, err := session.Send(ctx, config.Prompt)
-	if err != nil {
-		return TaskResult{}, err
+	return runTask(ctx, session, config)
+}
+
+// SetCompleter installs the completer used by Complete and its variants.
+// The server points it at the agent proxy when an LLM is configured.
+func (c *Client) SetCompleter(completer Completer) {
+	c.mu.Lock()
+	c.completer = completer
+	c.mu.Unlock()
+}
+
+func (c *Client) getCompleter() (Completer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.completer == nil {
+		return nil, &AgentError{Type: ErrNoCredentials, Message: "no LLM configured for completions"}
 	}
+	return c.completer, nil
+}
 
-	// Drain frames — for RunTask we just need to detect errors
-	for frame := range frames {
-		var msg struct {
-			Type    string `json:"type"`
-			Message string `json:"message"`
-			Code    string `json:"code"`
-		}
-		if json.Unmarshal(frame, &msg) == nil && msg.Type == "error" {
-			return TaskResult{}, fmt.Errorf("%s: %s", msg.Code, msg.Message)
-		}
+// Complete sends a single prompt to the LLM directly (no agent, no
+// session) and returns the answer with its real token usage.
+func (c *Client) Complete(ctx context.Context, req CompletionRequest) (CompletionResult, error) {
+	completer, err := c.getCompleter()
+	if err != nil {
+		return CompletionResult{}, err
 	}
+	return completer.Complete(ctx, req)
+}
 
-	return TaskResult{
-		SessionID: session.ID(),
-	}, nil
+// CompleteStream is Complete with the answer delivered to onDelta as it
+// arrives.
+func (c *Client) CompleteStream(ctx context.Context, req CompletionRequest, onDelta func(delta string)) (CompletionResult, error) {
+	completer, err := c.getCompleter()
+	if err != nil {
+		return CompletionResult{}, err
+	}
+	return completer.Stream(ctx, req, onDelta)
 }
 
-// Complete sends a simple prompt to the LLM proxy directly (no agent).
-// Provider selects which proxy route to use: "anthropic" or "openai".
-func (c *Client) Complete(ctx context.Context, provider string, prompt string, model string) (string, Usage, error) {
-	// TODO: Implement direct HTTP call to LLM proxy
-	return "", Usage{}, fmt.Errorf("Complete() not yet implemented")
+// CompleteJSON makes a structured completion: req.JSONSchema is required
+// and the answer is unmarshaled into out.
+func (c *Client) CompleteJSON(ctx context.Context, req CompletionRequest, out any) (Usage, error) {
+	if len(req.JSONSchema) == 0 {
+		return Usage{}, errors.New("completion: JSONSchema is required for structured output")
+	}
+	result, err := c.Complete(ctx, req)
+	if err != nil {
+		return result.Usage, err
+	}
+	if err := json.Unmarshal([]byte(result.Text), out); err != nil {
+		return result.Usage, fmt.Errorf("completion: decode structured output: %w", err)
+	}
+	return result.Usage, nil
 }
 
 // Shutdown terminates all active sessions gracefully.
@@ -0,0 +1,407 @@
+package agentsdk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Provider selects the wire format of a completion call.
+type Provider string
+
+const (
+	ProviderAnthropic Provider = "anthropic" // POST /v1/messages
+	ProviderOpenAI    Provider = "openai"    // POST /v1/chat/completions
+)
+
+// defaultCompletionMaxTokens caps a completion whose request leaves
+// MaxTokens unset. Completions are for short answers (titles, tags,
+// summaries); anything longer belongs in an agent task.
+const defaultCompletionMaxTokens = 1024
+
+// structuredOutputTool names the tool Anthropic-style calls are forced to
+// use in JSON mode; its input is the structured answer.
+const structuredOutputTool = "structured_output"
+
+// CompletionRequest is a single-turn, agent-free LLM call.
+type CompletionRequest struct {
+	Provider    Provider
+	Model       string // empty = the completer's default for Provider
+	System      string
+	Prompt      string
+	MaxTokens   int      // 0 = defaultCompletionMaxTokens
+	Temperature *float64 // nil = provider default
+
+	// JSONSchema switches to structured output: the model answers with a
+	// single JSON value matching the schema, returned as the result Text.
+	JSONSchema json.RawMessage
+}
+
+// CompletionResult is the answer to a CompletionRequest.
+type CompletionResult struct {
+	Text       string
+	Model      string // as reported by the endpoint
+	StopReason string
+	Usage      Usage
+}
+
+// Completer makes completion calls. HTTPCompleter talks to an LLM endpoint
+// (the agent proxy in production); FakeCompleter answers offline in tests.
+type Completer interface {
+	Complete(ctx context.Context, req CompletionRequest) (CompletionResult, error)
+	// Stream is Complete with the answer text delivered to onDelta as it
+	// arrives; the result carries the full text.
+	Stream(ctx context.Context, req CompletionRequest, onDelta func(delta string)) (CompletionResult, error)
+}
+
+// HTTPCompleter calls Anthropic- and OpenAI-style endpoints under BaseURL,
+// authenticating with Token. Pointed at the agent proxy, Token is a proxy
+// token and the upstream key never leaves the proxy.
+type HTTPCompleter struct {
+	BaseURL string
+	Token   string
+	// Models holds the default model per provider.
+	Models     map[Provider]string
+	HTTPClient *http.Client // nil = http.DefaultClient
+}
+
+// NewHTTPCompleter creates a completer for the endpoint at baseURL.
+func NewHTTPCompleter(baseURL, token string, models map[Provider]string) *HTTPCompleter {
+	return &HTTPCompleter{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token, Models: models}
+}
+
+// Complete implements Completer.
+func (h *HTTPCompleter) Complete(ctx context.Context, req CompletionRequest) (CompletionResult, error) {
+	return h.do(ctx, req, nil)
+}
+
+// Stream implements Completer.
+func (h *HTTPCompleter) Stream(ctx context.Context, req CompletionRequest, onDelta func(delta string)) (CompletionResult, error) {
+	if onDelta == nil {
+		onDelta = func(string) {}
+	}
+	return h.do(ctx, req, onDelta)
+}
+
+func (h *HTTPCompleter) do(ctx context.Context, req CompletionRequest, onDelta func(string)) (CompletionResult, error) {
+	if req.Model == "" {
+		req.Model = h.Models[req.Provider]
+	}
+	if req.Model == "" {
+		return CompletionResult{}, fmt.Errorf("completion: no model for provider %q", req.Provider)
+	}
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = defaultCompletionMaxTokens
+	}
+	stream := onDelta != nil
+
+	var path string
+	var body any
+	switch req.Provider {
+	case ProviderAnthropic:
+		path, body = "/v1/messages", anthropicBody(req, stream)
+	case ProviderOpenAI:
+		path, body = "/v1/chat/completions", openAIBody(req, stream)
+	default:
+		return CompletionResult{}, fmt.Errorf("completion: unknown provider %q", req.Provider)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return CompletionResult{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.BaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return CompletionResult{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if req.Provider == ProviderAnthropic {
+		httpReq.Header.Set("x-api-key", h.Token)
+		httpReq.Header.Set("anthropic-version", "2023-06-01")
+	} else {
+		httpReq.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+
+	client := h.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return CompletionResult{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return CompletionResult{}, completionHTTPError(resp)
+	}
+
+	switch {
+	case req.Provider == ProviderAnthropic && stream:
+		return readAnthropicStream(resp.Body, onDelta)
+	case req.Provider == ProviderAnthropic:
+		return readAnthropicResponse(resp.Body)
+	case stream:
+		return readOpenAIStream(resp.Body, onDelta)
+	default:
+		return readOpenAIResponse(resp.Body)
+	}
+}
+
+// completionHTTPError turns a non-200 response into an error, as an
+// AgentError for the statuses the agent paths report the same way.
+func completionHTTPError(resp *http.Response) error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	msg := strings.TrimSpace(string(raw))
+	var envelope struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(raw, &envelope) == nil && envelope.Error.Message != "" {
+		msg = envelope.Error.Message
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return &AgentError{Type: ErrQuotaExceeded, Message: msg}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &AgentError{Type: ErrNoCredentials, Message: msg}
+	}
+	return fmt.Errorf("completion: %s: %s", resp.Status, msg)
+}
+
+func anthropicBody(req CompletionRequest, stream bool) map[string]any {
+	body := map[string]any{
+		"model":      req.Model,
+		"max_tokens": req.MaxTokens,
+		"messages":   []map[string]any{{"role": "user", "content": req.Prompt}},
+	}
+	if req.System != "" {
+		body["system"] = req.System
+	}
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	if stream {
+		body["stream"] = true
+	}
+	if len(req.JSONSchema) > 0 {
+		// Messages has no JSON response format; a forced tool call is the
+		// structured-output idiom, with the tool input as the answer.
+		body["tools"] = []map[string]any{{
+			"name":         structuredOutputTool,
+			"description":  "Return the answer in this structure.",
+			"input_schema": req.JSONSchema,
+		}}
+		body["tool_choice"] = map[string]any{"type": "tool", "name": structuredOutputTool}
+	}
+	return body
+}
+
+func openAIBody(req CompletionRequest, stream bool) map[string]any {
+	messages := []map[string]any{}
+	if req.System != "" {
+		messages = append(messages, map[string]any{"role": "system", "content": req.System})
+	}
+	messages = append(messages, map[string]any{"role": "user", "content": req.Prompt})
+	body := map[string]any{
+		"model":      req.Model,
+		"max_tokens": req.MaxTokens,
+		"messages":   messages,
+	}
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	if stream {
+		body["stream"] = true
+		body["stream_options"] = map[string]any{"include_usage": true}
+	}
+	if len(req.JSONSchema) > 0 {
+		body["response_format"] = map[string]any{
+			"type":        "json_schema",
+			"json_schema": map[string]any{"name": structuredOutputTool, "schema": req.JSONSchema},
+		}
+	}
+	return body
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func readAnthropicResponse(r io.Reader) (CompletionResult, error) {
+	var resp struct {
+		Model      string `json:"model"`
+		StopReason string `json:"stop_reason"`
+		Content    []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text"`
+			Input json.RawMessage `json:"input"`
+		} `json:"content"`
+		Usage anthropicUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(r).Decode(&resp); err != nil {
+		return CompletionResult{}, fmt.Errorf("completion: decode response: %w", err)
+	}
+	result := CompletionResult{
+		Model:      resp.Model,
+		StopReason: resp.StopReason,
+		Usage:      Usage{InputTokens: resp.Usage.InputTokens, OutputTokens: resp.Usage.OutputTokens},
+	}
+	var text strings.Builder
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			result.Text = string(block.Input)
+			return result, nil
+		}
+	}
+	result.Text = text.String()
+	return result, nil
+}
+
+func readAnthropicStream(r io.Reader, onDelta func(string)) (CompletionResult, error) {
+	var result CompletionResult
+	var text strings.Builder
+	err := readSSE(r, func(data []byte) (bool, error) {
+		var ev struct {
+			Type    string `json:"type"`
+			Message struct {
+				Model string         `json:"model"`
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+				StopReason  string `json:"stop_reason"`
+			} `json:"delta"`
+			Usage anthropicUsage `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return false, fmt.Errorf("completion: decode event: %w", err)
+		}
+		switch ev.Type {
+		case "message_start":
+			result.Model = ev.Message.Model
+			result.Usage.InputTokens = ev.Message.Usage.InputTokens
+		case "content_block_delta":
+			delta := ev.Delta.Text
+			if ev.Delta.Type == "input_json_delta" {
+				delta = ev.Delta.PartialJSON
+			}
+			if delta != "" {
+				text.WriteString(delta)
+				onDelta(delta)
+			}
+		case "message_delta":
+			result.StopReason = ev.Delta.StopReason
+			result.Usage.OutputTokens = ev.Usage.OutputTokens
+		case "message_stop":
+			return true, nil
+		case "error":
+			return false, fmt.Errorf("completion: %s", ev.Error.Message)
+		}
+		return false, nil
+	})
+	result.Text = text.String()
+	return result, err
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func readOpenAIResponse(r io.Reader) (CompletionResult, error) {
+	var resp struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage openAIUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(r).Decode(&resp); err != nil {
+		return CompletionResult{}, fmt.Errorf("completion: decode response: %w", err)
+	}
+	result := CompletionResult{
+		Model: resp.Model,
+		Usage: Usage{InputTokens: resp.Usage.PromptTokens, OutputTokens: resp.Usage.CompletionTokens},
+	}
+	if len(resp.Choices) > 0 {
+		result.Text = resp.Choices[0].Message.Content
+		result.StopReason = resp.Choices[0].FinishReason
+	}
+	return result, nil
+}
+
+func readOpenAIStream(r io.Reader, onDelta func(string)) (CompletionResult, error) {
+	var result CompletionResult
+	var text strings.Builder
+	err := readSSE(r, func(data []byte) (bool, error) {
+		if string(data) == "[DONE]" {
+			return true, nil
+		}
+		var chunk struct {
+			Model   string `json:"model"`
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *openAIUsage `json:"usage"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return false, fmt.Errorf("completion: decode chunk: %w", err)
+		}
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		for _, c := range chunk.Choices {
+			if c.Delta.Content != "" {
+				text.WriteString(c.Delta.Content)
+				onDelta(c.Delta.Content)
+			}
+			if c.FinishReason != nil {
+				result.StopReason = *c.FinishReason
+			}
+		}
+		if chunk.Usage != nil {
+			result.Usage = Usage{InputTokens: chunk.Usage.PromptTokens, OutputTokens: chunk.Usage.CompletionTokens}
+		}
+		return false, nil
+	})
+	result.Text = text.String()
+	return result, err
+}
+
+// readSSE feeds the data of each server-sent event to handle until it
+// reports done or the stream ends.
+func readSSE(r io.Reader, handle func(data []byte) (done bool, err error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 4<<20)
+	for scanner.Scan() {
+		data, ok := bytes.CutPrefix(scanner.Bytes(), []byte("data:"))
+		if !ok {
+			continue
+		}
+		done, err := handle(bytes.TrimSpace(data))
+		if err != nil || done {
+			return err
+		}
+	}
+	return scanner.Err()
+}
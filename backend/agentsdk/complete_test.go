@@ -0,0 +1,248 @@
+package agentsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/agentproxy"
+)
+
+// fakeLLM is an upstream that answers both wire formats and records the
+// last request it saw.
+type fakeLLM struct {
+	lastPath string
+	lastAuth string
+	lastKey  string
+	lastBody map[string]any
+}
+
+func (f *fakeLLM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lastPath = r.URL.Path
+	f.lastAuth = r.Header.Get("Authorization")
+	f.lastKey = r.Header.Get("x-api-key")
+	raw, _ := io.ReadAll(r.Body)
+	f.lastBody = nil
+	_ = json.Unmarshal(raw, &f.lastBody)
+	stream, _ := f.lastBody["stream"].(bool)
+
+	switch {
+	case r.URL.Path == "/v1/messages" && stream:
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range []string{
+			`{"type":"message_start","message":{"model":"claude-small","usage":{"input_tokens":12}}}`,
+			`{"type":"content_block_delta","delta":{"type":"text_delta","text":"Hello"}}`,
+			`{"type":"content_block_delta","delta":{"type":"text_delta","text":" there"}}`,
+			`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":3}}`,
+			`{"type":"message_stop"}`,
+		} {
+			fmt.Fprintf(w, "event: x\ndata: %s\n\n", ev)
+		}
+	case r.URL.Path == "/v1/messages" && f.lastBody["tool_choice"] != nil:
+		fmt.Fprint(w, `{"model":"claude-small","stop_reason":"tool_use","content":[{"type":"tool_use","name":"structured_output","input":{"title":"Trip"}}],"usage":{"input_tokens":20,"output_tokens":5}}`)
+	case r.URL.Path == "/v1/messages":
+		fmt.Fprint(w, `{"model":"claude-small","stop_reason":"end_turn","content":[{"type":"text","text":"Hi"}],"usage":{"input_tokens":10,"output_tokens":2}}`)
+	case r.URL.Path == "/v1/chat/completions" && stream:
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range []string{
+			`{"model":"gpt-mini","choices":[{"delta":{"content":"Hel"}}]}`,
+			`{"model":"gpt-mini","choices":[{"delta":{"content":"lo"},"finish_reason":"stop"}]}`,
+			`{"model":"gpt-mini","choices":[],"usage":{"prompt_tokens":7,"completion_tokens":2}}`,
+			`[DONE]`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", ev)
+		}
+	case r.URL.Path == "/v1/chat/completions":
+		fmt.Fprint(w, `{"model":"gpt-mini","choices":[{"message":{"content":"Hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":8,"completion_tokens":1}}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestCompleter(t *testing.T, upstream http.Handler) *HTTPCompleter {
+	t.Helper()
+	srv := httptest.NewServer(upstream)
+	t.Cleanup(srv.Close)
+	return NewHTTPCompleter(srv.URL, "tok", map[Provider]string{
+		ProviderAnthropic: "claude-small",
+		ProviderOpenAI:    "gpt-mini",
+	})
+}
+
+func TestHTTPCompleter_Anthropic(t *testing.T) {
+	llm := &fakeLLM{}
+	c := newTestCompleter(t, llm)
+
+	got, err := c.Complete(context.Background(), CompletionRequest{Provider: ProviderAnthropic, System: "be brief", Prompt: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CompletionResult{Text: "Hi", Model: "claude-small", StopReason: "end_turn", Usage: Usage{InputTokens: 10, OutputTokens: 2}}
+	if got != want {
+		t.Errorf("Complete = %+v, want %+v", got, want)
+	}
+	if llm.lastKey != "tok" || llm.lastAuth != "" {
+		t.Errorf("auth headers = x-api-key %q, Authorization %q", llm.lastKey, llm.lastAuth)
+	}
+	if llm.lastBody["model"] != "claude-small" || llm.lastBody["system"] != "be brief" || llm.lastBody["max_tokens"] != float64(defaultCompletionMaxTokens) {
+		t.Errorf("request body = %v", llm.lastBody)
+	}
+
+	var deltas []string
+	got, err = c.Stream(context.Background(), CompletionRequest{Provider: ProviderAnthropic, Prompt: "hi"}, func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "Hello there" || strings.Join(deltas, "|") != "Hello| there" || got.Usage != (Usage{InputTokens: 12, OutputTokens: 3}) || got.StopReason != "end_turn" {
+		t.Errorf("Stream = %+v, deltas %q", got, deltas)
+	}
+}
+
+func TestHTTPCompleter_OpenAI(t *testing.T) {
+	llm := &fakeLLM{}
+	c := newTestCompleter(t, llm)
+
+	got, err := c.Complete(context.Background(), CompletionRequest{Provider: ProviderOpenAI, Model: "gpt-big", Prompt: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "Hi" || got.Usage != (Usage{InputTokens: 8, OutputTokens: 1}) || got.StopReason != "stop" {
+		t.Errorf("Complete = %+v", got)
+	}
+	if llm.lastAuth != "Bearer tok" || llm.lastBody["model"] != "gpt-big" {
+		t.Errorf("Authorization %q, body %v", llm.lastAuth, llm.lastBody)
+	}
+
+	var deltas []string
+	got, err = c.Stream(context.Background(), CompletionRequest{Provider: ProviderOpenAI, Prompt: "hi"}, func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "Hello" || len(deltas) != 2 || got.Usage != (Usage{InputTokens: 7, OutputTokens: 2}) {
+		t.Errorf("Stream = %+v, deltas %q", got, deltas)
+	}
+	if opts, _ := llm.lastBody["stream_options"].(map[string]any); opts["include_usage"] != true {
+		t.Errorf("stream_options = %v, want include_usage", llm.lastBody["stream_options"])
+	}
+}
+
+func TestClient_CompleteJSON(t *testing.T) {
+	llm := &fakeLLM{}
+	client := NewClient(SessionConfig{})
+	client.SetCompleter(newTestCompleter(t, llm))
+
+	var out struct {
+		Title string `json:"title"`
+	}
+	schema := json.RawMessage(`{"type":"object","properties":{"title":{"type":"string"}}}`)
+	usage, err := client.CompleteJSON(context.Background(), CompletionRequest{Provider: ProviderAnthropic, Prompt: "title?", JSONSchema: schema}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Title != "Trip" || usage != (Usage{InputTokens: 20, OutputTokens: 5}) {
+		t.Errorf("CompleteJSON = %+v, usage %+v", out, usage)
+	}
+	if choice, _ := llm.lastBody["tool_choice"].(map[string]any); choice["name"] != structuredOutputTool {
+		t.Errorf("tool_choice = %v", llm.lastBody["tool_choice"])
+	}
+
+	if _, err := client.CompleteJSON(context.Background(), CompletionRequest{Provider: ProviderAnthropic, Prompt: "x"}, &out); err == nil {
+		t.Error("CompleteJSON without a schema should fail")
+	}
+}
+
+func TestHTTPCompleter_MapsErrors(t *testing.T) {
+	status := http.StatusTooManyRequests
+	c := newTestCompleter(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"error":{"message":"slow down"}}`)
+	}))
+	req := CompletionRequest{Provider: ProviderOpenAI, Prompt: "hi"}
+
+	for code, want := range map[int]ErrorType{http.StatusTooManyRequests: ErrQuotaExceeded, http.StatusUnauthorized: ErrNoCredentials} {
+		status = code
+		_, err := c.Complete(context.Background(), req)
+		var ae *AgentError
+		if !errors.As(err, &ae) || ae.Type != want || ae.Message != "slow down" {
+			t.Errorf("status %d: err = %v, want %s", code, err, want)
+		}
+	}
+	status = http.StatusInternalServerError
+	if _, err := c.Complete(context.Background(), req); err == nil || !strings.Contains(err.Error(), "slow down") {
+		t.Errorf("status 500: err = %v", err)
+	}
+	if _, err := c.Complete(context.Background(), CompletionRequest{Provider: "bogus", Prompt: "hi"}); err == nil {
+		t.Error("unknown provider should fail")
+	}
+}
+
+func TestClient_CompleteWithoutCompleter(t *testing.T) {
+	_, err := NewClient(SessionConfig{}).Complete(context.Background(), CompletionRequest{Provider: ProviderAnthropic, Prompt: "hi"})
+	var ae *AgentError
+	if !errors.As(err, &ae) || ae.Type != ErrNoCredentials {
+		t.Errorf("err = %v, want ErrNoCredentials", err)
+	}
+}
+
+// TestHTTPCompleter_ThroughAgentProxy checks the production path: the
+// completer holds only a proxy token and the upstream sees the real key,
+// in the header style each provider expects.
+func TestHTTPCompleter_ThroughAgentProxy(t *testing.T) {
+	llm := &fakeLLM{}
+	upstream := httptest.NewServer(llm)
+	defer upstream.Close()
+
+	proxy, err := agentproxy.New(upstream.URL, "real-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := agentproxy.Start(proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	c := NewHTTPCompleter(srv.BaseURL(), proxy.IssueToken(), map[Provider]string{ProviderAnthropic: "claude-small", ProviderOpenAI: "gpt-mini"})
+	if _, err := c.Complete(context.Background(), CompletionRequest{Provider: ProviderAnthropic, Prompt: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if llm.lastKey != "real-key" || llm.lastAuth != "" {
+		t.Errorf("anthropic upstream saw x-api-key %q, Authorization %q", llm.lastKey, llm.lastAuth)
+	}
+	if _, err := c.Complete(context.Background(), CompletionRequest{Provider: ProviderOpenAI, Prompt: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if llm.lastAuth != "Bearer real-key" || llm.lastKey != "" {
+		t.Errorf("openai upstream saw x-api-key %q, Authorization %q", llm.lastKey, llm.lastAuth)
+	}
+
+	bad := NewHTTPCompleter(srv.BaseURL(), "not-a-token", c.Models)
+	var ae *AgentError
+	if _, err := bad.Complete(context.Background(), CompletionRequest{Provider: ProviderOpenAI, Prompt: "hi"}); !errors.As(err, &ae) || ae.Type != ErrNoCredentials {
+		t.Errorf("unknown token: err = %v, want ErrNoCredentials", err)
+	}
+}
+
+func TestFakeCompleter(t *testing.T) {
+	f := &FakeCompleter{}
+	client := NewClient(SessionConfig{})
+	client.SetCompleter(f)
+
+	var deltas []string
+	got, err := client.CompleteStream(context.Background(), CompletionRequest{Prompt: "one two three"}, func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "one two three" || strings.Join(deltas, "") != got.Text || len(deltas) != 3 {
+		t.Errorf("Stream = %+v, deltas %q", got, deltas)
+	}
+	if reqs := f.Requests(); len(reqs) != 1 || reqs[0].Prompt != "one two three" {
+		t.Errorf("Requests = %+v", reqs)
+	}
+}
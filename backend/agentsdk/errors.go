@@ -17,6 +17,8 @@ const (
 	ErrAgentCrash ErrorType = "agent_crash" // CLI process died unexpectedly
 	ErrTimeout         ErrorType = "timeout"           // task exceeded time limit
 	ErrNotFound        ErrorType = "not_found"         // agent or session not found
+	ErrMaxTurns        ErrorType = "max_turns"         // task used up TaskConfig.MaxTurns
+	ErrInvalidOutput   ErrorType = "invalid_output"    // final answer does not match OutputSchema
 )
 
 // AgentError wraps errors with agent context.
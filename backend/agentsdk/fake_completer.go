@@ -0,0 +1,60 @@
+package agentsdk
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// FakeCompleter is an offline Completer for tests. Respond computes each
+// answer (nil echoes the prompt); every request is recorded in Requests.
+type FakeCompleter struct {
+	Respond func(req CompletionRequest) (CompletionResult, error)
+
+	mu       sync.Mutex
+	requests []CompletionRequest
+}
+
+// Requests returns the requests seen so far.
+func (f *FakeCompleter) Requests() []CompletionRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]CompletionRequest(nil), f.requests...)
+}
+
+// Complete implements Completer.
+func (f *FakeCompleter) Complete(ctx context.Context, req CompletionRequest) (CompletionResult, error) {
+	if err := ctx.Err(); err != nil {
+		return CompletionResult{}, err
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+	if f.Respond == nil {
+		return CompletionResult{
+			Text:       req.Prompt,
+			Model:      req.Model,
+			StopReason: "end_turn",
+			Usage:      Usage{InputTokens: len(strings.Fields(req.System + " " + req.Prompt)), OutputTokens: len(strings.Fields(req.Prompt))},
+		}, nil
+	}
+	return f.Respond(req)
+}
+
+// Stream implements Completer, delivering the answer word by word.
+func (f *FakeCompleter) Stream(ctx context.Context, req CompletionRequest, onDelta func(delta string)) (CompletionResult, error) {
+	result, err := f.Complete(ctx, req)
+	if err != nil || onDelta == nil {
+		return result, err
+	}
+	rest := result.Text
+	for rest != "" {
+		i := strings.IndexByte(rest[1:], ' ') + 1
+		if i == 0 {
+			i = len(rest)
+		}
+		onDelta(rest[:i])
+		rest = rest[i:]
+	}
+	return result, nil
+}
@@ -4,44 +4,83 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 )
 
 // FrameStore persists raw ACP frames to per-session JSONL files on disk.
-// Each session has a dedicated writer goroutine that drains a bounded channel
-// and appends frames to <appDataDir>/agent_frames/<sessionID>.jsonl.
+// Each session has a dedicated writer goroutine that drains a queue and
+// appends frames to <appDataDir>/agent_frames/<sessionID>.jsonl.
 //
 // Design:
-//   - Append is non-blocking: sends to a buffered channel (capacity 256).
-//     On overflow, the frame is dropped with a warning log to avoid blocking
-//     the hot path.
-//   - Load reads the JSONL file; individual corrupt lines are skipped with a
-//     warning but don't abort the load.
-//   - Delete removes the JSONL file when a session is deleted.
-//   - Close drains all writer channels and closes all open files.
+//   - Append never drops a frame. It queues the frame for the writer and
+//     only blocks (backpressure) when more than maxPendingFrameBytes are
+//     waiting, which takes a burst of tool output far beyond what the
+//     writer can keep up with.
+//   - The writer writes whatever has queued up in one go and fsyncs at most
+//     every frameSyncInterval, so a burst costs one fsync, not hundreds.
+//   - A crash can leave a partially written last line. Opening the file for
+//     append repairs it first, so the next frame starts on a fresh line.
+//   - Archive compacts a finished session's turns and, when compression is
+//     on, moves the frames into <sessionID>.jsonl.zst. Load reads the
+//     archive, then any frames appended since.
+//   - Load skips individual corrupt lines with a warning.
+//   - Delete removes the session's files.
+//   - Close drains all writers and closes all open files.
 type FrameStore struct {
-	baseDir string
+	baseDir  string
+	compress bool
 
-	mu      sync.Mutex
-	writers map[string]*sessionWriter // sessionID → writer
+	mu        sync.Mutex
+	cond      *sync.Cond                // signalled when an Archive finishes
+	writers   map[string]*sessionWriter // sessionID → writer
+	archiving map[string]bool           // sessions Archive is rewriting
 }
 
+const (
+	// maxPendingFrameBytes bounds the frames queued for one session's
+	// writer before Append waits for it.
+	maxPendingFrameBytes = 8 << 20
+	// frameSyncInterval is the longest a written frame waits for fsync.
+	frameSyncInterval = 200 * time.Millisecond
+)
+
 type sessionWriter struct {
-	ch     chan []byte
-	done   chan struct{}
+	mu      sync.Mutex
+	drained *sync.Cond // signalled when the writer takes the queue
+	queue   [][]byte
+	pending int // bytes in queue
+	closed  bool
+	wake    chan struct{} // 1-buffered
+	done    chan struct{}
 }
 
 // NewFrameStore creates a FrameStore that saves JSONL files under
-// <appDataDir>/agent_frames/.
+// <appDataDir>/agent_frames/. It finishes any Archive a crash interrupted.
 func NewFrameStore(appDataDir string) *FrameStore {
-	return &FrameStore{
-		baseDir: filepath.Join(appDataDir, "agent_frames"),
-		writers: make(map[string]*sessionWriter),
+	s := &FrameStore{
+		baseDir:   filepath.Join(appDataDir, "agent_frames"),
+		writers:   make(map[string]*sessionWriter),
+		archiving: make(map[string]bool),
 	}
+	s.cond = sync.NewCond(&s.mu)
+	s.recoverArchives()
+	return s
+}
+
+// SetCompression turns zstd compression of archived sessions on or off.
+// Sessions archived earlier stay as they are until archived again.
+func (s *FrameStore) SetCompression(on bool) {
+	s.mu.Lock()
+	s.compress = on
+	s.mu.Unlock()
 }
 
 // ephemeralMarker is the substring probe for isEphemeralFrame's fast path.
@@ -74,38 +113,104 @@ func isEphemeralFrame(frame []byte) bool {
 	return envelope.SessionUpdate == "config_option_update"
 }
 
-// Append enqueues a frame for the given session. Non-blocking: if the
-// channel is full the frame is silently dropped (with a warning log).
+// Append queues a frame for the given session. It returns once the frame
+// is queued; it waits only while the session's writer is far behind.
 // Ephemeral frames are discarded before a writer is even created.
 func (s *FrameStore) Append(sessionID string, frame []byte) {
 	if isEphemeralFrame(frame) {
 		return
 	}
-	w := s.getOrCreateWriter(sessionID)
-	select {
-	case w.ch <- frame:
-	default:
-		log.Info().Str("sessionId", sessionID).Msg("frame_store: channel full, dropping frame")
+	for {
+		w := s.getOrCreateWriter(sessionID)
+		w.mu.Lock()
+		for w.pending >= maxPendingFrameBytes && !w.closed {
+			w.drained.Wait()
+		}
+		if w.closed {
+			// Delete, Archive or Close took this writer away while we
+			// waited; Close leaves no writer to retry with.
+			w.mu.Unlock()
+			if s.isClosing(sessionID) {
+				return
+			}
+			continue
+		}
+		w.queue = append(w.queue, frame)
+		w.pending += len(frame) + 1
+		w.mu.Unlock()
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+		return
 	}
 }
 
-// Load reads all frames for the given session from disk.
-// Returns nil, nil if the file does not exist.
+// isClosing reports whether an Append whose writer went away should give
+// up: the session was deleted or the store closed, so no writer exists and
+// none is being archived.
+func (s *FrameStore) isClosing(sessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, hasWriter := s.writers[sessionID]
+	return !hasWriter && !s.archiving[sessionID]
+}
+
+// Load reads all frames for the given session from disk: the archive (if
+// any), then the live JSONL file. Returns nil, nil if neither exists.
 // Individual lines that fail JSON parse are skipped with a warning.
 func (s *FrameStore) Load(sessionID string) ([][]byte, error) {
-	path := s.filePath(sessionID)
-	f, err := os.Open(path)
-	if os.IsNotExist(err) {
-		return nil, nil
-	}
+	frames, ephemeral, err := s.readFrames(sessionID)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	if frames == nil {
+		return nil, nil
+	}
+	log.Info().Str("sessionId", sessionID).Int("frameCount", len(frames)).Int("ephemeralSkipped", ephemeral).Msg("frame_store: loaded frames from disk")
+	return frames, nil
+}
 
-	var frames [][]byte
-	ephemeral := 0
-	scanner := bufio.NewScanner(f)
+// readFrames reads the archive and live file of a session; a session with
+// neither yields nil frames.
+func (s *FrameStore) readFrames(sessionID string) (frames [][]byte, ephemeral int, err error) {
+	found := false
+	for _, path := range []string{s.archivePath(sessionID), s.filePath(sessionID)} {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		found = true
+		var r io.Reader = f
+		if strings.HasSuffix(path, ".zst") {
+			dec, err := zstd.NewReader(f)
+			if err != nil {
+				f.Close()
+				return nil, 0, err
+			}
+			r = dec
+			frames, ephemeral, err = scanFrames(r, sessionID, frames, ephemeral)
+			dec.Close()
+		} else {
+			frames, ephemeral, err = scanFrames(r, sessionID, frames, ephemeral)
+		}
+		f.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if found && frames == nil {
+		frames = [][]byte{}
+	}
+	return frames, ephemeral, nil
+}
+
+// scanFrames appends the valid, non-ephemeral JSONL frames in r to frames.
+func scanFrames(r io.Reader, sessionID string, frames [][]byte, ephemeral int) ([][]byte, int, error) {
+	scanner := bufio.NewScanner(r)
 	// Allow up to 10 MB per line to handle large frames
 	buf := make([]byte, 0, 64*1024)
 	scanner.Buffer(buf, 10*1024*1024)
@@ -135,19 +240,203 @@ func (s *FrameStore) Load(sessionID string) ([][]byte, error) {
 		copy(cp, line)
 		frames = append(frames, cp)
 	}
-	if err := scanner.Err(); err != nil {
+	return frames, ephemeral, scanner.Err()
+}
+
+// Archive compacts a finished session's frames (CompactCompletedTurnFrames)
+// and rewrites them in place — into <sessionID>.jsonl.zst when compression
+// is on. Appends made meanwhile wait and land in a fresh live file. A
+// session with nothing written since its last Archive is left alone.
+func (s *FrameStore) Archive(sessionID string) error {
+	s.mu.Lock()
+	for s.archiving[sessionID] {
+		s.cond.Wait()
+	}
+	s.archiving[sessionID] = true
+	w := s.writers[sessionID]
+	delete(s.writers, sessionID)
+	compress := s.compress
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.archiving, sessionID)
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}()
+
+	if w != nil {
+		w.close()
+	}
+	if _, err := os.Stat(s.filePath(sessionID)); os.IsNotExist(err) {
+		return nil // nothing written since the last Archive
+	}
+
+	var frames [][]byte
+	var err error
+	if _, statErr := os.Stat(s.archivePath(sessionID)); compress || statErr != nil {
+		frames, _, err = s.readFrames(sessionID)
+	} else {
+		// Compression was turned off after this session was archived: the
+		// archive stays, and only the live file is compacted.
+		frames, err = s.readLiveFrames(sessionID)
+	}
+	if err != nil || len(frames) == 0 {
+		return err
+	}
+	before := len(frames)
+	frames = CompactCompletedTurnFrames(frames)
+
+	if compress {
+		err = s.writeArchive(sessionID, frames)
+	} else {
+		err = writeFileAtomic(s.filePath(sessionID), func(out io.Writer) error { return writeFrameLines(out, frames) })
+	}
+	if err != nil {
+		return err
+	}
+	log.Info().Str("sessionId", sessionID).Int("frames", before).Int("compacted", len(frames)).Bool("compressed", compress).Msg("frame_store: archived session frames")
+	return nil
+}
+
+// readLiveFrames reads only the live JSONL file of a session.
+func (s *FrameStore) readLiveFrames(sessionID string) ([][]byte, error) {
+	f, err := os.Open(s.filePath(sessionID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
+	frames, _, err := scanFrames(f, sessionID, nil, 0)
+	return frames, err
+}
 
-	log.Info().Str("sessionId", sessionID).Int("frameCount", len(frames)).Int("ephemeralSkipped", ephemeral).Msg("frame_store: loaded frames from disk")
-	return frames, nil
+// writeArchive replaces a session's archive and live file with one archive
+// holding frames. The steps are ordered so recoverArchives can finish or
+// undo them after a crash at any point:
+//
+//  1. write <id>.jsonl.zst.tmp
+//  2. rename <id>.jsonl → <id>.jsonl.archived (its frames are in the tmp)
+//  3. rename the tmp over <id>.jsonl.zst — the commit point
+//  4. remove <id>.jsonl.archived
+func (s *FrameStore) writeArchive(sessionID string, frames [][]byte) error {
+	tmp := s.archivePath(sessionID) + ".tmp"
+	if err := writeFileSynced(tmp, func(out io.Writer) error {
+		enc, err := zstd.NewWriter(out)
+		if err != nil {
+			return err
+		}
+		if err := writeFrameLines(enc, frames); err != nil {
+			enc.Close()
+			return err
+		}
+		return enc.Close()
+	}); err != nil {
+		return err
+	}
+	live, archived := s.filePath(sessionID), s.filePath(sessionID)+".archived"
+	if err := os.Rename(live, archived); err != nil && !os.IsNotExist(err) {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, s.archivePath(sessionID)); err != nil {
+		_ = os.Rename(archived, live)
+		return err
+	}
+	if err := os.Remove(archived); err != nil && !os.IsNotExist(err) {
+		log.Info().Err(err).Str("sessionId", sessionID).Msg("frame_store: failed to remove archived frame file")
+	}
+	return nil
 }
 
-// Delete removes the JSONL file for the given session.
+// recoverArchives finishes or rolls back an Archive interrupted by a crash
+// (see writeArchive). Runs before any writer exists.
+func (s *FrameStore) recoverArchives() {
+	entries, err := os.ReadDir(s.baseDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case strings.HasSuffix(name, ".jsonl.archived"):
+			sessionID := strings.TrimSuffix(name, ".jsonl.archived")
+			archived := filepath.Join(s.baseDir, name)
+			tmp := s.archivePath(sessionID) + ".tmp"
+			if _, err := os.Stat(tmp); err == nil {
+				// Crashed before the commit: the live file is authoritative.
+				_ = os.Remove(tmp)
+				_ = os.Rename(archived, s.filePath(sessionID))
+				log.Info().Str("sessionId", sessionID).Msg("frame_store: rolled back interrupted archive")
+			} else {
+				// Committed: the archive already holds these frames.
+				_ = os.Remove(archived)
+			}
+		case strings.HasSuffix(name, ".zst.tmp"):
+			if _, err := os.Stat(filepath.Join(s.baseDir, strings.TrimSuffix(name, ".zst.tmp")+".archived")); os.IsNotExist(err) {
+				_ = os.Remove(filepath.Join(s.baseDir, name))
+			}
+		case strings.HasSuffix(name, ".jsonl.tmp"):
+			_ = os.Remove(filepath.Join(s.baseDir, name))
+		}
+	}
+}
+
+// writeFrameLines writes frames one per line.
+func writeFrameLines(out io.Writer, frames [][]byte) error {
+	bw := bufio.NewWriterSize(out, 256<<10)
+	for _, frame := range frames {
+		if _, err := bw.Write(frame); err != nil {
+			return err
+		}
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// writeFileSynced creates path, fills it through write and fsyncs it.
+func writeFileSynced(path string, write func(io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// writeFileAtomic replaces path with what write produces.
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	tmp := path + ".tmp"
+	if err := writeFileSynced(tmp, write); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Delete removes the frame files for the given session.
 // A non-existent file is not an error.
 func (s *FrameStore) Delete(sessionID string) {
 	// Stop the writer (if any) before deleting the file.
 	s.mu.Lock()
+	for s.archiving[sessionID] {
+		s.cond.Wait()
+	}
 	w, ok := s.writers[sessionID]
 	if ok {
 		delete(s.writers, sessionID)
@@ -155,13 +444,13 @@ func (s *FrameStore) Delete(sessionID string) {
 	s.mu.Unlock()
 
 	if ok {
-		close(w.ch)
-		<-w.done
+		w.close()
 	}
 
-	path := s.filePath(sessionID)
-	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-		log.Info().Err(err).Str("sessionId", sessionID).Msg("frame_store: failed to delete frame file")
+	for _, path := range []string{s.filePath(sessionID), s.archivePath(sessionID)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Info().Err(err).Str("sessionId", sessionID).Msg("frame_store: failed to delete frame file")
+		}
 	}
 }
 
@@ -177,68 +466,204 @@ func (s *FrameStore) Close() {
 	s.mu.Unlock()
 
 	for _, w := range writers {
-		close(w.ch)
+		w.mu.Lock()
+		w.closed = true
+		w.drained.Broadcast()
+		w.mu.Unlock()
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
 	}
 	for _, w := range writers {
 		<-w.done
 	}
 }
 
-// filePath returns the path to the JSONL file for a session.
+// filePath returns the path to the live JSONL file for a session.
 func (s *FrameStore) filePath(sessionID string) string {
 	return filepath.Join(s.baseDir, sessionID+".jsonl")
 }
 
-// getOrCreateWriter returns (creating if necessary) the writer for a session.
+// archivePath returns the path to the compressed archive of a session.
+func (s *FrameStore) archivePath(sessionID string) string {
+	return filepath.Join(s.baseDir, sessionID+".jsonl.zst")
+}
+
+// getOrCreateWriter returns (creating if necessary) the writer for a
+// session, waiting while the session is being archived.
 func (s *FrameStore) getOrCreateWriter(sessionID string) *sessionWriter {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	for s.archiving[sessionID] {
+		s.cond.Wait()
+	}
 	if w, ok := s.writers[sessionID]; ok {
 		return w
 	}
 
 	w := &sessionWriter{
-		ch:   make(chan []byte, 256),
+		wake: make(chan struct{}, 1),
 		done: make(chan struct{}),
 	}
+	w.drained = sync.NewCond(&w.mu)
 	s.writers[sessionID] = w
 
 	go s.runWriter(sessionID, w)
 	return w
 }
 
+// close stops the writer after it has written everything queued.
+func (w *sessionWriter) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.drained.Broadcast()
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	<-w.done
+}
+
+// take empties the queue, reporting whether the writer was closed.
+func (w *sessionWriter) take() ([][]byte, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	batch := w.queue
+	w.queue = nil
+	w.pending = 0
+	w.drained.Broadcast()
+	return batch, w.closed
+}
+
 // runWriter is the per-session background writer goroutine.
 func (s *FrameStore) runWriter(sessionID string, w *sessionWriter) {
 	defer close(w.done)
 
-	// Ensure directory exists.
-	if err := os.MkdirAll(s.baseDir, 0755); err != nil {
-		log.Info().Err(err).Str("sessionId", sessionID).Msg("frame_store: failed to create agent_frames dir")
-		// Drain channel so Append callers don't block on full channel after this.
-		for range w.ch {
-		}
-		return
-	}
-
-	path := s.filePath(sessionID)
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	f, err := s.openForAppend(sessionID)
 	if err != nil {
 		log.Info().Err(err).Str("sessionId", sessionID).Msg("frame_store: failed to open JSONL file")
-		for range w.ch {
+		// Keep draining so Append callers don't wait on a full queue.
+		for {
+			if _, closed := w.take(); closed {
+				return
+			}
+			<-w.wake
 		}
-		return
 	}
 	defer f.Close()
 
-	for frame := range w.ch {
-		// Write frame + newline. Each frame must be valid JSON (it always is,
-		// coming from the ACP SDK). We write without buffering so a crash
-		// doesn't lose frames that were already sent to the channel.
-		if _, err := f.Write(append(frame, '\n')); err != nil {
-			log.Info().Err(err).Str("sessionId", sessionID).Msg("frame_store: write error")
+	var buf bytes.Buffer
+	var lastSync time.Time
+	dirty := false
+	syncTimer := time.NewTimer(time.Hour)
+	syncTimer.Stop()
+	defer syncTimer.Stop()
+	syncNow := func() {
+		if err := f.Sync(); err != nil {
+			log.Info().Err(err).Str("sessionId", sessionID).Msg("frame_store: fsync error")
 		}
+		lastSync = time.Now()
+		dirty = false
+	}
+
+	for {
+		select {
+		case <-w.wake:
+		case <-syncTimer.C:
+			if dirty {
+				syncNow()
+			}
+			continue
+		}
+
+		batch, closed := w.take()
+		if len(batch) > 0 {
+			// One write per batch: each frame plus its newline, so a crash
+			// mid-write leaves at most one partial line for openForAppend.
+			buf.Reset()
+			for _, frame := range batch {
+				buf.Write(frame)
+				buf.WriteByte('\n')
+			}
+			if _, err := f.Write(buf.Bytes()); err != nil {
+				log.Info().Err(err).Str("sessionId", sessionID).Int("frames", len(batch)).Msg("frame_store: write error")
+			}
+			if !dirty {
+				dirty = true
+				if wait := frameSyncInterval - time.Since(lastSync); wait > 0 {
+					syncTimer.Reset(wait)
+				} else {
+					syncNow()
+				}
+			}
+		}
+		if closed {
+			if dirty {
+				syncNow()
+			}
+			return
+		}
+	}
+}
+
+// openForAppend opens a session's live file for appending, first cutting
+// off a partial last line left by a crash mid-write. A last line that is
+// complete JSON and only lacks its newline gets the newline instead.
+func (s *FrameStore) openForAppend(sessionID string) (*os.File, error) {
+	if err := os.MkdirAll(s.baseDir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(s.filePath(sessionID), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := repairTail(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// repairTail makes f end on a line boundary.
+func repairTail(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	size := info.Size()
+	// Walk back to the last newline.
+	const chunk = 64 << 10
+	end := size
+	lineStart := int64(0)
+	buf := make([]byte, chunk)
+	for end > 0 {
+		start := max(end-chunk, 0)
+		n, err := f.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			lineStart = start + int64(i) + 1
+			break
+		}
+		end = start
+	}
+	if lineStart == size {
+		return nil
+	}
+	tail := make([]byte, size-lineStart)
+	if _, err := f.ReadAt(tail, lineStart); err != nil && err != io.EOF {
+		return err
+	}
+	if json.Valid(tail) {
+		_, err := f.Write([]byte{'\n'})
+		return err
 	}
+	log.Info().Str("file", f.Name()).Int64("bytes", size-lineStart).Msg("frame_store: truncating partial line left by a crash")
+	return f.Truncate(lineStart)
 }
 
 // DanglingPermissions returns the toolCallIds of permission.request frames in
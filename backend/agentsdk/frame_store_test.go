@@ -1,6 +1,7 @@
 package agentsdk
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -157,3 +158,183 @@ func TestFrameStore_LoadStripsLegacyCodexExecOutput(t *testing.T) {
 		t.Fatalf("legacy Codex frame lost preserved metadata: %s", frame)
 	}
 }
+
+// TestFrameStore_AppendIsLossless covers the burst that used to overflow the
+// writer channel: every frame must reach disk, in order, including frames
+// big enough to trip the pending-bytes backpressure.
+func TestFrameStore_AppendIsLossless(t *testing.T) {
+	dir := t.TempDir()
+	fs := NewFrameStore(dir)
+
+	const n = 5000
+	for i := 0; i < n; i++ {
+		fs.Append("s1", []byte(chunkFrame(fmt.Sprintf("line %d", i))))
+	}
+	big := `{"sessionUpdate":"tool_call_update","toolCallId":"t","content":"` + strings.Repeat("x", 1<<20) + `"}`
+	for i := 0; i < 12; i++ {
+		fs.Append("s1", []byte(big))
+	}
+	fs.Close()
+
+	frames, err := fs.Load("s1")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(frames) != n+12 {
+		t.Fatalf("got %d frames, want %d", len(frames), n+12)
+	}
+	for i := 0; i < n; i++ {
+		if !strings.Contains(string(frames[i]), fmt.Sprintf(`"line %d"`, i)) {
+			t.Fatalf("frame %d out of order: %s", i, frames[i])
+		}
+	}
+}
+
+// TestFrameStore_RepairsPartialLastLine simulates a crash mid-write: the
+// partial line must be cut off before new frames are appended, or the next
+// frame would be glued onto it and lost as well.
+func TestFrameStore_RepairsPartialLastLine(t *testing.T) {
+	dir := t.TempDir()
+	writeJSONL(t, dir, "s1", chunkFrame("before"))
+	path := filepath.Join(dir, "agent_frames", "s1.jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"sessionUpdate":"agent_message_chunk","content":{"ty`)
+	f.Close()
+
+	fs := NewFrameStore(dir)
+	fs.Append("s1", []byte(chunkFrame("after")))
+	fs.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := chunkFrame("before") + "\n" + chunkFrame("after") + "\n"
+	if string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+}
+
+// TestFrameStore_KeepsCompleteLastLineWithoutNewline: a last frame that made
+// it to disk whole but without its newline is kept.
+func TestFrameStore_KeepsCompleteLastLineWithoutNewline(t *testing.T) {
+	dir := t.TempDir()
+	framesDir := filepath.Join(dir, "agent_frames")
+	os.MkdirAll(framesDir, 0o755)
+	os.WriteFile(filepath.Join(framesDir, "s1.jsonl"), []byte(chunkFrame("a")), 0o644)
+
+	fs := NewFrameStore(dir)
+	fs.Append("s1", []byte(chunkFrame("b")))
+	fs.Close()
+
+	frames, err := fs.Load("s1")
+	if err != nil || len(frames) != 2 {
+		t.Fatalf("frames = %d, err = %v; want 2", len(frames), err)
+	}
+}
+
+func archiveTestFrames() []string {
+	return []string{
+		`{"type":"turn.start"}`,
+		chunkFrame("Hel"),
+		chunkFrame("lo"),
+		`{"type":"turn.complete","stopReason":"end_turn"}`,
+	}
+}
+
+func TestFrameStore_ArchiveCompactsAndCompresses(t *testing.T) {
+	dir := t.TempDir()
+	fs := NewFrameStore(dir)
+	fs.SetCompression(true)
+	for _, f := range archiveTestFrames() {
+		fs.Append("s1", []byte(f))
+	}
+	if err := fs.Archive("s1"); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+
+	framesDir := filepath.Join(dir, "agent_frames")
+	if _, err := os.Stat(filepath.Join(framesDir, "s1.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("live file still present after archive: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(framesDir, "s1.jsonl.zst")); err != nil {
+		t.Fatalf("archive missing: %v", err)
+	}
+
+	// The session keeps going after being archived.
+	fs.Append("s1", []byte(chunkFrame("later")))
+	fs.Close()
+
+	frames, err := fs.Load("s1")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(frames) != 4 {
+		t.Fatalf("got %d frames, want turn.start, merged chunk, turn.complete, later", len(frames))
+	}
+	if !strings.Contains(string(frames[1]), `"Hello"`) || !strings.Contains(string(frames[3]), `"later"`) {
+		t.Errorf("frames = %q", frames)
+	}
+
+	// Archiving again folds the new frame into the archive.
+	fs = NewFrameStore(dir)
+	fs.SetCompression(true)
+	if err := fs.Archive("s1"); err != nil {
+		t.Fatalf("second archive: %v", err)
+	}
+	again, _ := fs.Load("s1")
+	if len(again) != 4 {
+		t.Errorf("after re-archive got %d frames, want 4", len(again))
+	}
+	fs.Delete("s1")
+	if entries, _ := os.ReadDir(framesDir); len(entries) != 0 {
+		t.Errorf("files left after delete: %v", entries)
+	}
+}
+
+func TestFrameStore_ArchiveWithoutCompressionCompactsInPlace(t *testing.T) {
+	dir := t.TempDir()
+	fs := NewFrameStore(dir)
+	for _, f := range archiveTestFrames() {
+		fs.Append("s1", []byte(f))
+	}
+	if err := fs.Archive("s1"); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "agent_frames", "s1.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(data), "\n"); got != 3 {
+		t.Errorf("compacted file has %d lines, want 3:\n%s", got, data)
+	}
+}
+
+// TestFrameStore_RecoversInterruptedArchive: a crash after the live file was
+// set aside but before the archive was committed must give the live file back.
+func TestFrameStore_RecoversInterruptedArchive(t *testing.T) {
+	dir := t.TempDir()
+	framesDir := filepath.Join(dir, "agent_frames")
+	os.MkdirAll(framesDir, 0o755)
+	os.WriteFile(filepath.Join(framesDir, "s1.jsonl.archived"), []byte(chunkFrame("kept")+"\n"), 0o644)
+	os.WriteFile(filepath.Join(framesDir, "s1.jsonl.zst.tmp"), []byte("partial"), 0o644)
+	// Committed archive whose set-aside file was never removed.
+	os.WriteFile(filepath.Join(framesDir, "s2.jsonl.archived"), []byte(chunkFrame("dup")+"\n"), 0o644)
+
+	fs := NewFrameStore(dir)
+	frames, err := fs.Load("s1")
+	if err != nil || len(frames) != 1 || !strings.Contains(string(frames[0]), "kept") {
+		t.Errorf("s1 frames = %q, err = %v", frames, err)
+	}
+	entries, _ := os.ReadDir(framesDir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, ",") != "s1.jsonl" {
+		t.Errorf("files after recovery = %v, want only s1.jsonl", names)
+	}
+}
@@ -0,0 +1,368 @@
+package agentsdk
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// ResourceLimits confines each agent process and everything it starts — the
+// agent's own tools (claude-agent-acp runs Bash itself) as well as terminal
+// commands it asks us to run. Zero fields mean no limit.
+//
+// On Linux with a delegated cgroup v2 hierarchy every agent process gets its
+// own cgroup with cpu.max, memory.max and pids.max, and is started inside it
+// (CLONE_INTO_CGROUP) where the kernel allows; memory.oom.group makes an OOM
+// take the whole process tree down together. Without cgroups a watcher
+// polls the process tree from /proc and kills it when it goes over memory or
+// process count (CPU can't be capped that way). Plain rlimits don't fit:
+// RLIMIT_AS breaks Node's address-space reservations and RLIMIT_NPROC counts
+// every process of the user, the server's included.
+type ResourceLimits struct {
+	CPUs        float64 // CPU time as a number of cores
+	MemoryBytes int64
+	Pids        int
+
+	// TurnTimeout is the wall clock for one prompt turn; it kills the agent.
+	// Time spent waiting for the user to answer a permission request does
+	// not count, so a gated run can sit in the approvals inbox.
+	TurnTimeout time.Duration
+
+	// CommandTimeout and IsolateNetwork only cover terminal commands the
+	// agent asks the client to run (ACP CreateTerminal). claude-agent-acp
+	// runs its Bash tool itself, inside the agent process, so those
+	// commands get neither: they are bounded by the cgroup limits and
+	// TurnTimeout alone, and keep the agent's network access, which it
+	// needs to reach the LLM gateway.
+	CommandTimeout time.Duration // wall clock for one terminal command
+	// IsolateNetwork runs terminal commands in a fresh network namespace
+	// (loopback only).
+	IsolateNetwork bool
+}
+
+// confines reports whether processes need a sandbox at all.
+func (l ResourceLimits) confines() bool {
+	return l.CPUs > 0 || l.MemoryBytes > 0 || l.Pids > 0 || l.TurnTimeout > 0
+}
+
+// Reasons a sandbox kills its process, carried in the limit error frame.
+const (
+	LimitMemory  = "memory"
+	LimitPids    = "pids"
+	LimitTimeout = "timeout"
+)
+
+// CodeLimitExceeded is the code of the error frame a turn ends with when
+// its agent process was killed for exceeding its ResourceLimits. The frame's
+// data.limit holds the reason.
+const CodeLimitExceeded = "LIMIT_EXCEEDED"
+
+// limitKillReason reports why the session's agent process was killed by its
+// sandbox, or "" when it wasn't. If the process has just exited it waits
+// briefly for the sandbox's final accounting.
+func (s *acpSession) limitKillReason() string {
+	if s.sandbox == nil {
+		return ""
+	}
+	return s.sandbox.outcome(s.conn.Done())
+}
+
+// sandboxPollInterval is how often a sandbox checks its process tree.
+const sandboxPollInterval = time.Second
+
+// sandbox confines one agent process tree.
+type sandbox struct {
+	limits ResourceLimits
+	cg     *cgroup // nil: polling fallback (or nothing to enforce but time)
+	pid    int
+
+	mu     sync.Mutex
+	reason string
+
+	// closeCgroupFD releases the cgroup directory the process is started
+	// in; nil when it is moved in after starting instead.
+	closeCgroupFD func()
+
+	released chan struct{}
+	once     sync.Once
+}
+
+// newSandbox prepares confinement for a process about to be started with
+// cmd. Returns nil when limits confine nothing.
+func newSandbox(limits ResourceLimits, cmd *exec.Cmd) *sandbox {
+	if !limits.confines() {
+		return nil
+	}
+	s := &sandbox{
+		limits:   limits,
+		released: make(chan struct{}),
+	}
+	if limits.CPUs > 0 || limits.MemoryBytes > 0 || limits.Pids > 0 {
+		cg, err := newCgroup(limits)
+		if err != nil {
+			warnCgroupUnavailable(err)
+		} else {
+			s.cg = cg
+			// Born inside, the process can't fork anything that escapes
+			// the limits before it is moved.
+			if closeFD, err := cg.startIn(cmd); err == nil {
+				s.closeCgroupFD = closeFD
+			}
+		}
+	}
+	confineCmd(cmd)
+	return s
+}
+
+var cgroupWarnOnce sync.Once
+
+func warnCgroupUnavailable(err error) {
+	cgroupWarnOnce.Do(func() {
+		log.Warn().Err(err).Msg("sandbox: cgroup v2 unavailable; enforcing memory and process limits by polling, CPU uncapped")
+	})
+}
+
+// started begins watching the process; call right after cmd.Start.
+func (s *sandbox) started(pid int, exited <-chan struct{}) {
+	if s == nil {
+		return
+	}
+	s.pid = pid
+	if s.closeCgroupFD != nil {
+		s.closeCgroupFD()
+	} else if err := s.cg.add(pid); err != nil {
+		log.Warn().Err(err).Int("pid", pid).Msg("sandbox: cannot move agent into its cgroup; falling back to polling")
+		s.cg.remove()
+		s.cg = nil
+	}
+	go s.watch(exited)
+}
+
+// prepare arranges for a process the client starts for the agent — a
+// terminal command — to start inside the agent's cgroup, so it counts
+// against the same limits and dies with the agent. Returns the function to
+// call once cmd has started (or failed to). Without a cgroup only the
+// command timeout applies to it.
+func (s *sandbox) prepare(cmd *exec.Cmd) (started func(pid int)) {
+	if s == nil || s.cg == nil {
+		return func(int) {}
+	}
+	if closeFD, err := s.cg.startIn(cmd); err == nil {
+		return func(int) { closeFD() }
+	}
+	return func(pid int) {
+		if pid == 0 {
+			return
+		}
+		if err := s.cg.add(pid); err != nil {
+			log.Warn().Err(err).Int("pid", pid).Msg("sandbox: cannot move terminal command into the agent's cgroup")
+		}
+	}
+}
+
+// startFailed cleans up after cmd.Start failed.
+func (s *sandbox) startFailed() {
+	if s == nil {
+		return
+	}
+	if s.closeCgroupFD != nil {
+		s.closeCgroupFD()
+	}
+	s.cg.remove()
+	s.once.Do(func() { close(s.released) })
+}
+
+// watch enforces the limits until the process exits, then releases the
+// sandbox.
+func (s *sandbox) watch(exited <-chan struct{}) {
+	ticker := time.NewTicker(sandboxPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exited:
+			s.release()
+			return
+		case <-ticker.C:
+			s.check()
+		}
+	}
+}
+
+// check looks for a limit breach and kills the tree on one.
+func (s *sandbox) check() {
+	if s.cg != nil {
+		if s.cg.oomKilled() {
+			s.kill(LimitMemory)
+		}
+		return
+	}
+	if s.limits.MemoryBytes <= 0 && s.limits.Pids <= 0 {
+		return
+	}
+	rss, procs, err := treeUsage(s.pid)
+	if err != nil {
+		return
+	}
+	switch {
+	case s.limits.MemoryBytes > 0 && rss > s.limits.MemoryBytes:
+		log.Warn().Int("pid", s.pid).Int64("rss", rss).Int64("limit", s.limits.MemoryBytes).Msg("sandbox: agent over memory limit")
+		s.kill(LimitMemory)
+	case s.limits.Pids > 0 && procs > s.limits.Pids:
+		log.Warn().Int("pid", s.pid).Int("procs", procs).Int("limit", s.limits.Pids).Msg("sandbox: agent over process limit")
+		s.kill(LimitPids)
+	}
+}
+
+// kill records reason (first one wins) and kills the whole process tree.
+func (s *sandbox) kill(reason string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.reason == "" {
+		s.reason = reason
+	}
+	s.mu.Unlock()
+	if s.cg != nil && s.cg.kill() == nil {
+		return
+	}
+	killTree(s.pid)
+}
+
+// release does the final accounting and tears the sandbox down. Whatever is
+// still running in the tree dies with the agent.
+func (s *sandbox) release() {
+	s.once.Do(func() {
+		if s.cg != nil {
+			if s.cg.oomKilled() {
+				s.mu.Lock()
+				if s.reason == "" {
+					s.reason = LimitMemory
+				}
+				s.mu.Unlock()
+			}
+			_ = s.cg.kill()
+			s.cg.remove()
+		}
+		close(s.released)
+	})
+}
+
+// outcome returns the kill reason. When the process has exited it first
+// waits (briefly) for release, which catches an OOM the poller hadn't seen.
+func (s *sandbox) outcome(exited <-chan struct{}) string {
+	select {
+	case <-exited:
+		select {
+		case <-s.released:
+		case <-time.After(2 * time.Second):
+		}
+	default:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reason
+}
+
+// turnClock is the TurnTimeout of one prompt turn. It only runs while the
+// agent is working: it stops while a permission request waits for the user
+// and resumes with what was left once the request is answered.
+type turnClock struct {
+	mu        sync.Mutex
+	remaining time.Duration
+	since     time.Time   // when the clock last started
+	timer     *time.Timer // nil while stopped
+	waiting   int         // permission requests pending
+	done      bool
+	expire    func()
+}
+
+// startTurnClock starts a clock that calls expire once limit has run out.
+func startTurnClock(limit time.Duration, expire func()) *turnClock {
+	c := &turnClock{remaining: limit, expire: expire}
+	c.run()
+	return c
+}
+
+// run starts the timer for the remaining time. Caller holds c.mu, or c is
+// not shared yet.
+func (c *turnClock) run() {
+	c.since = time.Now()
+	c.timer = time.AfterFunc(c.remaining, c.fire)
+}
+
+// fire calls expire, at most once and never after stop.
+func (c *turnClock) fire() {
+	c.mu.Lock()
+	if c.done {
+		c.mu.Unlock()
+		return
+	}
+	c.done = true
+	c.mu.Unlock()
+	c.expire()
+}
+
+// pause stops the clock for a pending permission request.
+func (c *turnClock) pause() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waiting++
+	if c.waiting == 1 && c.timer != nil {
+		if c.timer.Stop() {
+			c.remaining -= time.Since(c.since)
+		}
+		c.timer = nil
+	}
+}
+
+// resume restarts the clock once no permission request is pending.
+func (c *turnClock) resume() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waiting--
+	if c.waiting == 0 && !c.done && c.timer == nil {
+		c.run()
+	}
+}
+
+// stop ends the clock when the turn is over.
+func (c *turnClock) stop() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done = true
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+}
+
+// describe renders a kill reason for users.
+func (l ResourceLimits) describe(reason string) string {
+	switch reason {
+	case LimitMemory:
+		return fmt.Sprintf("memory limit (%d MiB)", l.MemoryBytes>>20)
+	case LimitPids:
+		return fmt.Sprintf("process limit (%d)", l.Pids)
+	case LimitTimeout:
+		return fmt.Sprintf("turn time limit (%s)", l.TurnTimeout)
+	}
+	return reason
+}
+
+// limitKillMessage is the user-facing explanation for a limit kill.
+func (l ResourceLimits) limitKillMessage(reason string) string {
+	return "The agent was stopped for exceeding its " + l.describe(reason) + "."
+}
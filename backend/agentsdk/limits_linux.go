@@ -0,0 +1,431 @@
+//go:build linux
+
+package agentsdk
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroup is one agent process tree's cgroup v2 directory.
+type cgroup struct {
+	dir string
+}
+
+var (
+	agentCgroupsOnce   sync.Once
+	agentCgroupsParent string // <our cgroup>/mld-agents, "" when unavailable
+	agentCgroupsErr    error
+	agentCgroupCounter atomic.Int64
+)
+
+// cgroupSetting is one interface file written when a cgroup is created.
+type cgroupSetting struct {
+	file, value string
+	optional    bool
+}
+
+// newCgroup creates a cgroup for one agent process with limits applied.
+func newCgroup(limits ResourceLimits) (*cgroup, error) {
+	agentCgroupsOnce.Do(func() {
+		agentCgroupsParent, agentCgroupsErr = setupAgentCgroups()
+	})
+	if agentCgroupsErr != nil {
+		return nil, agentCgroupsErr
+	}
+
+	dir := filepath.Join(agentCgroupsParent, fmt.Sprintf("agent-%d-%d", os.Getpid(), agentCgroupCounter.Add(1)))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	cg := &cgroup{dir: dir}
+	var settings []cgroupSetting
+	if limits.MemoryBytes > 0 {
+		settings = append(settings,
+			cgroupSetting{"memory.max", strconv.FormatInt(limits.MemoryBytes, 10), false},
+			cgroupSetting{"memory.swap.max", "0", true}, // absent without swap accounting
+			cgroupSetting{"memory.oom.group", "1", true},
+		)
+	}
+	if limits.Pids > 0 {
+		settings = append(settings, cgroupSetting{"pids.max", strconv.Itoa(limits.Pids), false})
+	}
+	if limits.CPUs > 0 {
+		const period = 100000
+		quota := max(int64(limits.CPUs*period), 1000)
+		settings = append(settings, cgroupSetting{"cpu.max", fmt.Sprintf("%d %d", quota, period), false})
+	}
+	for _, s := range settings {
+		if err := os.WriteFile(filepath.Join(dir, s.file), []byte(s.value), 0644); err != nil && !s.optional {
+			cg.remove()
+			return nil, fmt.Errorf("set %s: %w", s.file, err)
+		}
+	}
+	return cg, nil
+}
+
+// setupAgentCgroups creates the parent cgroup for agent processes under the
+// server's own cgroup and enables the controllers in it. cgroup v2 forbids
+// enabling controllers for children of a cgroup that has processes in it, so
+// when the server sits directly in its (delegated) cgroup — the usual case in
+// a container or a systemd service — it first moves itself into a leaf
+// sibling, mld-server.
+func setupAgentCgroups() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", errors.New("cgroup v2 is not mounted at " + cgroupRoot)
+	}
+	own, err := ownCgroup()
+	if err != nil {
+		return "", err
+	}
+	base := filepath.Join(cgroupRoot, own)
+	controllers, err := wantedControllers(base)
+	if err != nil {
+		return "", err
+	}
+
+	if err := enableControllers(base, controllers); err != nil {
+		if !errors.Is(err, syscall.EBUSY) {
+			return "", err
+		}
+		leaf := filepath.Join(base, "mld-server")
+		if err := os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+			return "", err
+		}
+		if err := moveProcs(base, leaf); err != nil {
+			return "", fmt.Errorf("move server into %s: %w", leaf, err)
+		}
+		if err := enableControllers(base, controllers); err != nil {
+			return "", err
+		}
+	}
+
+	parent := filepath.Join(base, "mld-agents")
+	if err := os.Mkdir(parent, 0755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	if err := enableControllers(parent, controllers); err != nil {
+		return "", err
+	}
+	return parent, nil
+}
+
+// ownCgroup returns this process's cgroup v2 path from /proc/self/cgroup.
+func ownCgroup() (string, error) {
+	body, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", errors.New("no cgroup v2 entry in /proc/self/cgroup")
+}
+
+// wantedControllers returns the subtree_control line enabling whichever of
+// cpu, memory and pids are available in dir. A limit whose controller is
+// missing fails when its cgroup is created, and that agent falls back to
+// polling.
+func wantedControllers(dir string) (string, error) {
+	body, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return "", err
+	}
+	var enable []string
+	for _, c := range strings.Fields(string(body)) {
+		if c == "cpu" || c == "memory" || c == "pids" {
+			enable = append(enable, "+"+c)
+		}
+	}
+	if len(enable) == 0 {
+		return "", errors.New("no cpu, memory or pids controller delegated to " + dir)
+	}
+	return strings.Join(enable, " "), nil
+}
+
+func enableControllers(dir, controllers string) error {
+	return os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte(controllers), 0644)
+}
+
+// moveProcs moves every process in cgroup from into cgroup to.
+func moveProcs(from, to string) error {
+	body, err := os.ReadFile(filepath.Join(from, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	for _, pid := range strings.Fields(string(body)) {
+		err := os.WriteFile(filepath.Join(to, "cgroup.procs"), []byte(pid), 0644)
+		if err != nil && !errors.Is(err, syscall.ESRCH) {
+			return err
+		}
+	}
+	return nil
+}
+
+// add moves a process (and its threads) into the cgroup. Children it forks
+// afterwards are born inside.
+func (cg *cgroup) add(pid int) error {
+	if cg == nil {
+		return nil
+	}
+	return os.WriteFile(filepath.Join(cg.dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+}
+
+// startIn makes cmd start inside the cgroup (clone3 with CLONE_INTO_CGROUP)
+// and returns the function closing the cgroup directory once cmd has
+// started. Fails on kernels older than 5.7, where the process has to be
+// moved in after starting instead.
+func (cg *cgroup) startIn(cmd *exec.Cmd) (func(), error) {
+	if !cloneIntoCgroupSupported() {
+		return nil, errors.ErrUnsupported
+	}
+	dir, err := os.Open(cg.dir)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	return func() { _ = dir.Close() }, nil
+}
+
+var (
+	cloneIntoCgroupOnce sync.Once
+	cloneIntoCgroupOK   bool
+)
+
+// cloneIntoCgroupSupported reports whether the kernel has CLONE_INTO_CGROUP
+// (Linux 5.7). exec does not fall back when clone3 refuses it, so this is
+// checked up front.
+func cloneIntoCgroupSupported() bool {
+	cloneIntoCgroupOnce.Do(func() {
+		var u syscall.Utsname
+		if syscall.Uname(&u) != nil {
+			return
+		}
+		var release []byte
+		for _, c := range u.Release {
+			if c == 0 {
+				break
+			}
+			release = append(release, byte(c))
+		}
+		major, minor, ok := kernelVersion(string(release))
+		cloneIntoCgroupOK = ok && (major > 5 || major == 5 && minor >= 7)
+	})
+	return cloneIntoCgroupOK
+}
+
+// kernelVersion parses the major and minor version out of a kernel release
+// string such as "6.8.0-45-generic".
+func kernelVersion(release string) (major, minor int, ok bool) {
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err1 := strconv.Atoi(parts[0])
+	digits := strings.IndexFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' })
+	if digits < 0 {
+		digits = len(parts[1])
+	}
+	minor, err2 := strconv.Atoi(parts[1][:digits])
+	return major, minor, err1 == nil && err2 == nil
+}
+
+// oomKilled reports whether the kernel OOM-killed anything in the cgroup.
+func (cg *cgroup) oomKilled() bool {
+	if cg == nil {
+		return false
+	}
+	f, err := os.Open(filepath.Join(cg.dir, "memory.events"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "oom_kill "); ok {
+			n, _ := strconv.Atoi(v)
+			return n > 0
+		}
+	}
+	return false
+}
+
+// kill SIGKILLs every process in the cgroup.
+func (cg *cgroup) kill() error {
+	if cg == nil {
+		return errors.ErrUnsupported
+	}
+	if err := os.WriteFile(filepath.Join(cg.dir, "cgroup.kill"), []byte("1"), 0644); err == nil {
+		return nil
+	}
+	// cgroup.kill needs Linux 5.14; fall back to signalling each member.
+	body, err := os.ReadFile(filepath.Join(cg.dir, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	for _, s := range strings.Fields(string(body)) {
+		if pid, err := strconv.Atoi(s); err == nil {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+	return nil
+}
+
+// remove deletes the cgroup once its processes are gone, retrying briefly
+// while the kernel reaps them.
+func (cg *cgroup) remove() {
+	if cg == nil {
+		return
+	}
+	for i := 0; i < 20; i++ {
+		err := os.Remove(cg.dir)
+		if err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// confineCmd puts the process in its own process group so the whole tree can
+// be signalled at once.
+func confineCmd(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// isolateNetwork starts the command in a new network namespace. Unprivileged
+// servers need a user namespace for that, mapping only their own ids.
+func isolateNetwork(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	if uid := os.Getuid(); uid != 0 {
+		gid := os.Getgid()
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+		cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+	}
+	return nil
+}
+
+// killGroup SIGKILLs the process group led by pid.
+func killGroup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
+
+// procEntry is one process as seen in /proc.
+type procEntry struct {
+	ppid int
+	rss  int64
+}
+
+// processTree returns pid and all its descendants with their resident
+// memory, from a snapshot of /proc.
+func processTree(pid int) (map[int]procEntry, error) {
+	dirs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[int]procEntry, len(dirs))
+	children := make(map[int][]int)
+	for _, d := range dirs {
+		p, err := strconv.Atoi(d.Name())
+		if err != nil {
+			continue
+		}
+		e, ok := readProc(p)
+		if !ok {
+			continue
+		}
+		all[p] = e
+		children[e.ppid] = append(children[e.ppid], p)
+	}
+	root, ok := all[pid]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	tree := map[int]procEntry{pid: root}
+	queue := []int{pid}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, c := range children[p] {
+			if _, seen := tree[c]; !seen {
+				tree[c] = all[c]
+				queue = append(queue, c)
+			}
+		}
+	}
+	return tree, nil
+}
+
+// readProc reads a process's parent and resident memory.
+func readProc(pid int) (procEntry, bool) {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return procEntry{}, false
+	}
+	// The command name is parenthesised and may contain spaces; fields
+	// after it are well-formed: state ppid pgrp ...
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return procEntry{}, false
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 2 {
+		return procEntry{}, false
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	e := procEntry{ppid: ppid}
+	if statm, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/statm"); err == nil {
+		if f := strings.Fields(string(statm)); len(f) >= 2 {
+			pages, _ := strconv.ParseInt(f[1], 10, 64)
+			e.rss = pages * int64(os.Getpagesize())
+		}
+	}
+	return e, true
+}
+
+// treeUsage sums resident memory and counts processes in pid's tree.
+func treeUsage(pid int) (rss int64, procs int, err error) {
+	tree, err := processTree(pid)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, e := range tree {
+		rss += e.rss
+	}
+	return rss, len(tree), nil
+}
+
+// killTree SIGKILLs pid's process group and every descendant — including
+// those that started a group or session of their own.
+func killTree(pid int) {
+	tree, _ := processTree(pid)
+	_ = killGroup(pid)
+	for p := range tree {
+		_ = syscall.Kill(p, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,106 @@
+//go:build linux
+
+package agentsdk
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	acp "github.com/coder/acp-go-sdk"
+)
+
+// startPolled starts cmd under a polling sandbox (no cgroup, so the test
+// never touches the host's cgroup tree) and returns it with an exit channel.
+func startPolled(t *testing.T, limits ResourceLimits, cmd *exec.Cmd) (*sandbox, <-chan struct{}) {
+	t.Helper()
+	sb := &sandbox{limits: limits, released: make(chan struct{})}
+	confineCmd(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	sb.started(cmd.Process.Pid, exited)
+	return sb, exited
+}
+
+func TestSandbox_PollingKillsTreeOverPids(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 30 & sleep 30 & sleep 30 & wait")
+	sb, exited := startPolled(t, ResourceLimits{Pids: 2}, cmd)
+
+	select {
+	case <-exited:
+	case <-time.After(10 * time.Second):
+		killTree(cmd.Process.Pid)
+		t.Fatal("process tree over its pids limit was not killed")
+	}
+	if got := sb.outcome(exited); got != LimitPids {
+		t.Errorf("reason = %q, want %q", got, LimitPids)
+	}
+}
+
+func TestSandbox_NoReasonWithinLimits(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 0.2")
+	sb, exited := startPolled(t, ResourceLimits{Pids: 10, MemoryBytes: 1 << 30}, cmd)
+	<-exited
+	if got := sb.outcome(exited); got != "" {
+		t.Errorf("reason = %q, want none", got)
+	}
+
+	// A kill for the turn time limit is reported as such.
+	cmd = exec.Command("sleep", "30")
+	sb, exited = startPolled(t, ResourceLimits{TurnTimeout: time.Second}, cmd)
+	sb.kill(LimitTimeout)
+	<-exited
+	if got := sb.outcome(exited); got != LimitTimeout {
+		t.Errorf("reason = %q, want %q", got, LimitTimeout)
+	}
+}
+
+func TestCreateTerminal_CommandTimeout(t *testing.T) {
+	c := &acpClient{limits: ResourceLimits{CommandTimeout: 300 * time.Millisecond}}
+	start := time.Now()
+	resp, err := c.CreateTerminal(context.Background(), acp.CreateTerminalRequest{
+		Command: "sh",
+		Args:    []string{"-c", "echo started; sleep 30 & sleep 30"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("command ran %s past its timeout", elapsed)
+	}
+	out, err := c.TerminalOutput(context.Background(), acp.TerminalOutputRequest{TerminalId: resp.TerminalId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.Output, "started") || !strings.Contains(out.Output, "time limit") {
+		t.Errorf("output = %q", out.Output)
+	}
+}
+
+func TestKernelVersion(t *testing.T) {
+	for _, tt := range []struct {
+		release      string
+		major, minor int
+		ok           bool
+	}{
+		{"6.8.0-45-generic", 6, 8, true},
+		{"5.4", 5, 4, true},
+		{"5.10-rc1", 5, 10, true},
+		{"4.19.0+", 4, 19, true},
+		{"6", 0, 0, false},
+		{"", 0, 0, false},
+	} {
+		major, minor, ok := kernelVersion(tt.release)
+		if ok != tt.ok || ok && (major != tt.major || minor != tt.minor) {
+			t.Errorf("kernelVersion(%q) = %d, %d, %v", tt.release, major, minor, ok)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+//go:build !linux
+
+package agentsdk
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// cgroup is unavailable off Linux; only wall-clock limits are enforced.
+type cgroup struct{}
+
+func newCgroup(limits ResourceLimits) (*cgroup, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (cg *cgroup) add(pid int) error { return nil }
+func (cg *cgroup) oomKilled() bool   { return false }
+func (cg *cgroup) kill() error       { return errors.ErrUnsupported }
+func (cg *cgroup) remove()           {}
+
+func (cg *cgroup) startIn(cmd *exec.Cmd) (func(), error) {
+	return nil, errors.ErrUnsupported
+}
+
+func confineCmd(cmd *exec.Cmd) {}
+
+func isolateNetwork(cmd *exec.Cmd) error {
+	return errors.ErrUnsupported
+}
+
+func killGroup(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
+
+func treeUsage(pid int) (rss int64, procs int, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
+
+func killTree(pid int) {
+	_ = killGroup(pid)
+}
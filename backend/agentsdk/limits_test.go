@@ -0,0 +1,95 @@
+package agentsdk
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	acp "github.com/coder/acp-go-sdk"
+)
+
+func TestTurnClock_Expires(t *testing.T) {
+	expired := make(chan struct{})
+	startTurnClock(20*time.Millisecond, func() { close(expired) })
+	select {
+	case <-expired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("turn clock never expired")
+	}
+}
+
+func TestTurnClock_PausedWhileWaiting(t *testing.T) {
+	var expired atomic.Int32
+	c := startTurnClock(100*time.Millisecond, func() { expired.Add(1) })
+
+	// Two overlapping permission requests: the clock runs again only after
+	// both are answered.
+	c.pause()
+	c.pause()
+	time.Sleep(250 * time.Millisecond)
+	c.resume()
+	time.Sleep(150 * time.Millisecond)
+	if expired.Load() != 0 {
+		t.Fatal("turn clock ran while a permission request was pending")
+	}
+	c.resume()
+	deadline := time.Now().Add(5 * time.Second)
+	for expired.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := expired.Load(); got != 1 {
+		t.Fatalf("expired %d times after resuming, want 1", got)
+	}
+}
+
+func TestTurnClock_StopPreventsExpiry(t *testing.T) {
+	var expired atomic.Int32
+	c := startTurnClock(50*time.Millisecond, func() { expired.Add(1) })
+	c.pause()
+	c.stop()
+	c.resume() // a permission answered after the turn ended
+	time.Sleep(150 * time.Millisecond)
+	if expired.Load() != 0 {
+		t.Fatal("stopped turn clock expired")
+	}
+}
+
+func TestRequestPermission_PausesTurnClock(t *testing.T) {
+	var expired atomic.Int32
+	c := &acpClient{onFrame: func([]byte) {}}
+	clock := startTurnClock(100*time.Millisecond, func() { expired.Add(1) })
+	defer clock.stop()
+	c.turn.Store(clock)
+
+	answered := make(chan error, 1)
+	go func() {
+		_, err := c.RequestPermission(context.Background(), acp.RequestPermissionRequest{
+			ToolCall: acp.ToolCallUpdate{ToolCallId: "call-1"},
+			Options:  []acp.PermissionOption{{OptionId: "allow", Kind: acp.PermissionOptionKindAllowOnce}},
+		})
+		answered <- err
+	}()
+
+	// Sit in the approvals inbox well past the turn limit.
+	time.Sleep(300 * time.Millisecond)
+	if expired.Load() != 0 {
+		t.Fatal("turn limit counted time spent waiting for the user")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for c.respondToPermission("call-1", true, "allow") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("permission request never registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := <-answered; err != nil {
+		t.Fatal(err)
+	}
+	for expired.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if expired.Load() != 1 {
+		t.Fatal("turn limit did not resume after the answer")
+	}
+}
@@ -2,22 +2,73 @@ package agentsdk
 
 import (
 	"context"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 )
 
+// Pool defaults. A pool keeps Size warm connections while it is in use,
+// grows towards Max when more sessions than that started within Window, and
+// shrinks to Min once nothing has been acquired for IdleTTL.
+const (
+	defaultPoolSize    = 3
+	defaultPoolWindow  = 10 * time.Minute
+	defaultPoolIdleTTL = 15 * time.Minute
+
+	// poolMaintainInterval is how often the pool set re-targets its pools and
+	// reaps idle ones.
+	poolMaintainInterval = 30 * time.Second
+)
+
 // PoolConfig configures a ProcessPool.
 type PoolConfig struct {
-	Size      int                                           // number of warm connections to maintain
-	AgentType AgentType                                     // which agent this pool is for
+	Size      int                                          // warm connections kept while in use (default 3)
+	Min       int                                          // floor once idle for IdleTTL (capped at Size)
+	Max       int                                          // ceiling under demand; below Size means Size
+	Window    time.Duration                                // how far back acquires count as demand
+	IdleTTL   time.Duration                                // no acquire for this long → shrink to Min
+	AgentType AgentType                                    // which agent this pool is for
+	Env       map[string]string                            // per-session env its processes boot with
 	Spawn     func(ctx context.Context) (*warmConn, error) // factory for warm connections
+
+	// reserve, when set, is asked before each background spawn; false holds
+	// the pool below target. The pool set uses it to enforce its process and
+	// memory budget; release is called once the spawn has landed or failed.
+	reserve func() (release func(), ok bool)
+}
+
+// PoolStats is a point-in-time snapshot of one pool.
+type PoolStats struct {
+	Agent    AgentType         `json:"agent"`
+	Env      map[string]string `json:"env,omitempty"`
+	Warm     int               `json:"warm"`
+	Spawning int               `json:"spawning"`
+	Target   int               `json:"target"`
+	Min      int               `json:"min"`
+	Size     int               `json:"size"`
+	Max      int               `json:"max"`
+	Demand   int               `json:"demand"` // acquires within the window
+
+	Hits          int64 `json:"hits"`          // acquires served warm
+	Misses        int64 `json:"misses"`        // acquires that spawned synchronously
+	Spawned       int64 `json:"spawned"`       // warm connections added
+	SpawnFailures int64 `json:"spawnFailures"` // background spawns that failed
+	Reaped        int64 `json:"reaped"`        // warm connections killed as surplus
+	Discarded     int64 `json:"discarded"`     // warm connections found dead
+
+	RSSBytes     int64 `json:"rssBytes"`     // resident memory of the warm processes
+	LastAcquired int64 `json:"lastAcquired"` // unix ms; 0 = never
 }
 
 // ProcessPool maintains pre-warmed ACP connections ready for immediate use.
 // Each Acquire() returns a dedicated warm connection (1:1 with session, no reuse).
-// The pool replenishes in the background after each take.
+// After each take the pool tops itself back up to its target, which follows
+// recent demand between Min and Max.
 type ProcessPool struct {
 	cfg  PoolConfig
 	warm chan *warmConn
@@ -25,77 +76,190 @@ type ProcessPool struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	spawning int
+	acquires []time.Time // within Window, oldest first
+	lastUsed time.Time   // last acquire, or Start
+	warmRSS  int64
+	stats    PoolStats // counters only; the rest is filled in by Stats
 }
 
 // newProcessPool creates a pool but does not start warming. Call Start().
 func newProcessPool(cfg PoolConfig) *ProcessPool {
 	if cfg.Size <= 0 {
-		cfg.Size = 3
+		cfg.Size = defaultPoolSize
+	}
+	if cfg.Max < cfg.Size {
+		cfg.Max = cfg.Size
+	}
+	cfg.Min = max(0, min(cfg.Min, cfg.Size))
+	if cfg.Window <= 0 {
+		cfg.Window = defaultPoolWindow
+	}
+	if cfg.IdleTTL <= 0 {
+		cfg.IdleTTL = defaultPoolIdleTTL
 	}
 	return &ProcessPool{
 		cfg:  cfg,
-		warm: make(chan *warmConn, cfg.Size),
+		warm: make(chan *warmConn, cfg.Max),
 	}
 }
 
 // Start begins background warming to fill the pool.
 func (p *ProcessPool) Start(ctx context.Context) {
 	p.ctx, p.cancel = context.WithCancel(ctx)
-	p.fill(p.cfg.Size)
+	p.mu.Lock()
+	p.lastUsed = time.Now()
+	p.mu.Unlock()
+	p.rebalance(time.Now())
+}
+
+// target returns how many warm connections the pool should hold at now.
+// Caller must hold p.mu.
+func (p *ProcessPool) target(now time.Time) int {
+	cutoff := now.Add(-p.cfg.Window)
+	i := 0
+	for i < len(p.acquires) && p.acquires[i].Before(cutoff) {
+		i++
+	}
+	p.acquires = p.acquires[i:]
+
+	if now.Sub(p.lastUsed) >= p.cfg.IdleTTL {
+		return p.cfg.Min
+	}
+	return min(max(p.cfg.Size, len(p.acquires)), p.cfg.Max)
 }
 
-// fill spawns n warm connections in background goroutines.
-func (p *ProcessPool) fill(n int) {
-	for range n {
+// rebalance spawns up to the current target in the background and kills
+// warm connections above it.
+func (p *ProcessPool) rebalance(now time.Time) {
+	if p.ctx.Err() != nil {
+		return
+	}
+	p.mu.Lock()
+	target := p.target(now)
+	need := target - len(p.warm) - p.spawning
+	if need > 0 {
+		p.spawning += need
+	}
+	p.mu.Unlock()
+
+	for range need {
 		p.wg.Add(1)
 		go func() {
 			defer p.wg.Done()
 			p.spawnOne()
 		}()
 	}
+
+	for surplus := len(p.warm) - target; surplus > 0; surplus-- {
+		select {
+		case w := <-p.warm:
+			p.take(w)
+			killWarm(w)
+			p.mu.Lock()
+			p.stats.Reaped++
+			p.mu.Unlock()
+			log.Info().Str("agent", string(p.cfg.AgentType)).Int("target", target).Msg("pool: reaped surplus warm connection")
+		default:
+			return
+		}
+	}
 }
 
-// spawnOne creates one warm connection and adds it to the pool.
+// spawnOne creates one warm connection and adds it to the pool. The caller
+// has already counted it in p.spawning.
 func (p *ProcessPool) spawnOne() {
+	defer func() {
+		p.mu.Lock()
+		p.spawning--
+		p.mu.Unlock()
+	}()
 	if p.ctx.Err() != nil {
 		return
 	}
+	if p.cfg.reserve != nil {
+		release, ok := p.cfg.reserve()
+		if !ok {
+			log.Info().Str("agent", string(p.cfg.AgentType)).Msg("pool: warm budget exhausted, not spawning")
+			return
+		}
+		defer release()
+	}
 
 	w, err := p.cfg.Spawn(p.ctx)
 	if err != nil {
 		if p.ctx.Err() == nil {
+			p.mu.Lock()
+			p.stats.SpawnFailures++
+			p.mu.Unlock()
 			log.Warn().Err(err).Msg("pool: failed to spawn warm connection")
 		}
 		return
 	}
+	w.rss = processRSS(w)
 
+	if p.ctx.Err() != nil {
+		killWarm(w)
+		return
+	}
+	p.mu.Lock()
+	p.warmRSS += w.rss
+	p.stats.Spawned++
+	p.mu.Unlock()
 	select {
 	case p.warm <- w:
-		log.Info().Msg("pool: warm connection added")
-	case <-p.ctx.Done():
+		log.Info().Str("agent", string(p.cfg.AgentType)).Msg("pool: warm connection added")
+	default:
+		// Target dropped below what was in flight; don't block on a full pool.
+		p.take(w)
 		killWarm(w)
 	}
 }
 
+// take accounts for a warm connection leaving the pool.
+func (p *ProcessPool) take(w *warmConn) {
+	p.mu.Lock()
+	p.warmRSS -= w.rss
+	p.mu.Unlock()
+}
+
 // Acquire returns a pre-warmed connection from the pool.
 // If the pool is empty, spawns one synchronously (fallback).
-// Triggers background replenishment after each successful acquire.
+// Every acquire counts towards demand and tops the pool back up.
 func (p *ProcessPool) Acquire(ctx context.Context) (*warmConn, error) {
 	start := time.Now()
+	p.mu.Lock()
+	p.acquires = append(p.acquires, start)
+	p.lastUsed = start
+	p.mu.Unlock()
+
 	for {
 		select {
 		case w := <-p.warm:
+			p.take(w)
 			if isWarmDead(w) {
 				log.Warn().Msg("pool: discarding dead warm connection")
 				killWarm(w)
+				p.mu.Lock()
+				p.stats.Discarded++
+				p.mu.Unlock()
 				continue
 			}
+			p.mu.Lock()
+			p.stats.Hits++
+			p.mu.Unlock()
 			log.Info().
 				Dur("acquire_ms", time.Since(start)).
 				Msg("pool: acquired warm connection from pool")
-			p.replenish()
+			p.rebalance(time.Now())
 			return w, nil
 		default:
+			p.mu.Lock()
+			p.stats.Misses++
+			p.mu.Unlock()
+			p.rebalance(time.Now())
 			log.Warn().Msg("pool: empty, spawning synchronously")
 			w, err := p.cfg.Spawn(ctx)
 			if err != nil {
@@ -109,31 +273,272 @@ func (p *ProcessPool) Acquire(ctx context.Context) (*warmConn, error) {
 	}
 }
 
-// replenish spawns one replacement in the background.
-func (p *ProcessPool) replenish() {
-	p.wg.Add(1)
-	go func() {
-		defer p.wg.Done()
-		p.spawnOne()
-	}()
+// Stats returns a snapshot of the pool.
+func (p *ProcessPool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	s.Agent = p.cfg.AgentType
+	s.Env = p.cfg.Env
+	s.Warm = len(p.warm)
+	s.Spawning = p.spawning
+	s.Target = p.target(time.Now())
+	s.Min, s.Size, s.Max = p.cfg.Min, p.cfg.Size, p.cfg.Max
+	s.Demand = len(p.acquires)
+	s.RSSBytes = p.warmRSS
+	if n := len(p.acquires); n > 0 {
+		s.LastAcquired = p.acquires[n-1].UnixMilli()
+	}
+	return s
 }
 
 // Shutdown kills all warm connections and waits for background goroutines.
 func (p *ProcessPool) Shutdown() {
 	p.cancel()
+	// In-flight spawns see the cancelled context and never block on the
+	// channel, so wait for them first and drain what they left behind.
+	p.wg.Wait()
 
 	// Drain and kill all warm connections in the channel
 	for {
 		select {
 		case w := <-p.warm:
+			p.take(w)
 			killWarm(w)
 		default:
-			p.wg.Wait()
 			return
 		}
 	}
 }
 
+// PoolLimits configures the warm pools across all agents and models.
+type PoolLimits struct {
+	MaxWarm     int   // total warm processes across all pools; 0 = no cap
+	MemoryLimit int64 // total resident memory of warm processes, bytes; 0 = no cap
+
+	// Per-model pools, created the first time a session asks for a model
+	// env that no pool serves yet.
+	ModelPoolSize int // default 1
+	ModelPoolMax  int // default 3
+
+	Window  time.Duration // demand window (default 10m)
+	IdleTTL time.Duration // idle time before a pool shrinks (default 15m)
+}
+
+// poolSet holds one pool per (agent, per-session env). Agents get a base
+// pool (no env override) from StartPool; pools for other model envs are
+// created on first use and removed once they have been idle long enough to
+// drain.
+type poolSet struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	limits PoolLimits
+
+	// spawner returns the Spawn factory for an agent booted with env.
+	spawner func(agent AgentType, env map[string]string) func(ctx context.Context) (*warmConn, error)
+
+	mu       sync.Mutex
+	pools    map[string]*ProcessPool // poolKey → pool
+	base     map[AgentType]bool      // agents with pooling enabled
+	reserved int                     // background spawns holding a budget slot
+}
+
+func newPoolSet(ctx context.Context, limits PoolLimits, spawner func(AgentType, map[string]string) func(context.Context) (*warmConn, error)) *poolSet {
+	if limits.ModelPoolSize <= 0 {
+		limits.ModelPoolSize = 1
+	}
+	if limits.ModelPoolMax <= 0 {
+		limits.ModelPoolMax = 3
+	}
+	s := &poolSet{
+		limits:  limits,
+		spawner: spawner,
+		pools:   make(map[string]*ProcessPool),
+		base:    make(map[AgentType]bool),
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	return s
+}
+
+// poolKey identifies the pool for an agent booted with env.
+func poolKey(agent AgentType, env map[string]string) string {
+	pairs := make([]string, 0, len(env))
+	for k, v := range env {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return string(agent) + "\x00" + strings.Join(pairs, "\x00")
+}
+
+// startBase starts the base pool for agent.
+func (s *poolSet) startBase(agent AgentType, cfg PoolConfig) *ProcessPool {
+	cfg.AgentType = agent
+	cfg.Window, cfg.IdleTTL = s.limits.Window, s.limits.IdleTTL
+	cfg.Spawn = s.spawner(agent, nil)
+	cfg.reserve = s.reserve
+	p := newProcessPool(cfg)
+
+	s.mu.Lock()
+	if old := s.pools[poolKey(agent, nil)]; old != nil {
+		defer old.Shutdown()
+	}
+	s.pools[poolKey(agent, nil)] = p
+	s.base[agent] = true
+	s.mu.Unlock()
+
+	p.Start(s.ctx)
+	return p
+}
+
+// enabled reports whether sessions for agent should go through a pool.
+func (s *poolSet) enabled(agent AgentType) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.base[agent]
+}
+
+// pool returns the pool for (agent, env), creating a per-model pool when
+// there is none yet.
+func (s *poolSet) pool(agent AgentType, env map[string]string) *ProcessPool {
+	key := poolKey(agent, env)
+	s.mu.Lock()
+	p := s.pools[key]
+	if p == nil {
+		p = newProcessPool(PoolConfig{
+			Size:      s.limits.ModelPoolSize,
+			Max:       s.limits.ModelPoolMax,
+			Window:    s.limits.Window,
+			IdleTTL:   s.limits.IdleTTL,
+			AgentType: agent,
+			Env:       env,
+			Spawn:     s.spawner(agent, env),
+			reserve:   s.reserve,
+		})
+		s.pools[key] = p
+		s.mu.Unlock()
+		log.Info().Str("agent", string(agent)).Interface("env", env).Msg("pool: created per-model pool")
+		// Start with a demand-free target of Size; the Acquire that follows
+		// records the demand.
+		p.Start(s.ctx)
+		return p
+	}
+	s.mu.Unlock()
+	return p
+}
+
+// reserve claims a budget slot for one background spawn.
+func (s *poolSet) reserve() (func(), bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	warm, rss := s.reserved, int64(0)
+	for _, p := range s.pools {
+		p.mu.Lock()
+		warm += len(p.warm)
+		rss += p.warmRSS
+		p.mu.Unlock()
+	}
+	if s.limits.MaxWarm > 0 && warm >= s.limits.MaxWarm {
+		return nil, false
+	}
+	if s.limits.MemoryLimit > 0 && rss >= s.limits.MemoryLimit {
+		return nil, false
+	}
+	s.reserved++
+	return func() {
+		s.mu.Lock()
+		s.reserved--
+		s.mu.Unlock()
+	}, true
+}
+
+// maintain re-targets every pool and removes per-model pools that have
+// drained after going idle.
+func (s *poolSet) maintain(now time.Time) {
+	s.mu.Lock()
+	pools := make(map[string]*ProcessPool, len(s.pools))
+	for k, p := range s.pools {
+		pools[k] = p
+	}
+	s.mu.Unlock()
+
+	for key, p := range pools {
+		p.rebalance(now)
+		if s.isBase(p.cfg.AgentType, p.cfg.Env) {
+			continue
+		}
+		p.mu.Lock()
+		drained := p.target(now) == 0 && len(p.warm) == 0 && p.spawning == 0
+		p.mu.Unlock()
+		if !drained {
+			continue
+		}
+		s.mu.Lock()
+		if s.pools[key] == p {
+			delete(s.pools, key)
+		}
+		s.mu.Unlock()
+		p.Shutdown()
+		log.Info().Str("agent", string(p.cfg.AgentType)).Interface("env", p.cfg.Env).Msg("pool: removed idle per-model pool")
+	}
+}
+
+func (s *poolSet) isBase(agent AgentType, env map[string]string) bool {
+	return len(env) == 0 && s.enabled(agent)
+}
+
+// run calls maintain periodically until the set is shut down.
+func (s *poolSet) run() {
+	ticker := time.NewTicker(poolMaintainInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.maintain(now)
+		}
+	}
+}
+
+// stats returns a snapshot of every pool, base pools first.
+func (s *poolSet) stats() []PoolStats {
+	s.mu.Lock()
+	pools := make([]*ProcessPool, 0, len(s.pools))
+	for _, p := range s.pools {
+		pools = append(pools, p)
+	}
+	s.mu.Unlock()
+
+	out := make([]PoolStats, 0, len(pools))
+	for _, p := range pools {
+		out = append(out, p.Stats())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Agent != out[j].Agent {
+			return out[i].Agent < out[j].Agent
+		}
+		if (len(out[i].Env) == 0) != (len(out[j].Env) == 0) {
+			return len(out[i].Env) == 0
+		}
+		return poolKey(out[i].Agent, out[i].Env) < poolKey(out[j].Agent, out[j].Env)
+	})
+	return out
+}
+
+// shutdown stops maintenance and every pool.
+func (s *poolSet) shutdown() {
+	s.cancel()
+	s.mu.Lock()
+	pools := make([]*ProcessPool, 0, len(s.pools))
+	for _, p := range s.pools {
+		pools = append(pools, p)
+	}
+	s.mu.Unlock()
+	for _, p := range pools {
+		p.Shutdown()
+	}
+}
+
 // isWarmDead checks if the warm connection's process has exited.
 func isWarmDead(w *warmConn) bool {
 	if w.done != nil {
@@ -153,3 +558,24 @@ func killWarm(w *warmConn) {
 		w.cmd.Wait()
 	}
 }
+
+// processRSS returns the resident memory of a warm connection's process,
+// read from /proc. 0 where that isn't available (non-Linux, fakes in tests).
+func processRSS(w *warmConn) int64 {
+	if w.cmd == nil || w.cmd.Process == nil {
+		return 0
+	}
+	body, err := os.ReadFile("/proc/" + strconv.Itoa(w.cmd.Process.Pid) + "/statm")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(body))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * int64(os.Getpagesize())
+}
@@ -144,3 +144,99 @@ func TestPool_Shutdown(t *testing.T) {
 		// OK
 	}
 }
+
+// waitFor polls cond until it holds or a second passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPool_SizesFromDemand(t *testing.T) {
+	pool := newProcessPool(PoolConfig{
+		Size:    1,
+		Max:     3,
+		Window:  time.Hour,
+		IdleTTL: time.Hour,
+		Spawn: func(ctx context.Context) (*warmConn, error) {
+			w, _ := fakeWarmConn()
+			return w, nil
+		},
+	})
+	ctx := context.Background()
+	pool.Start(ctx)
+	defer pool.Shutdown()
+
+	for range 4 {
+		if _, err := pool.Acquire(ctx); err != nil {
+			t.Fatalf("Acquire: %v", err)
+		}
+	}
+	// Four starts within the window: grow to Max, not past it.
+	waitFor(t, "pool to grow", func() bool { return pool.Stats().Warm == 3 })
+	if s := pool.Stats(); s.Target != 3 || s.Demand != 4 {
+		t.Errorf("stats = %+v", s)
+	}
+
+	// Idle past IdleTTL: reap down to Min.
+	pool.rebalance(time.Now().Add(2 * time.Hour))
+	s := pool.Stats()
+	if len(pool.warm) != 0 || s.Reaped != 3 {
+		t.Errorf("after idle: warm = %d, reaped = %d", len(pool.warm), s.Reaped)
+	}
+}
+
+func TestPoolSet_PerModelPoolsWithinBudget(t *testing.T) {
+	spawned := map[string]int{}
+	var mu sync.Mutex
+	set := newPoolSet(context.Background(), PoolLimits{MaxWarm: 2, Window: time.Hour, IdleTTL: time.Hour},
+		func(agent AgentType, env map[string]string) func(context.Context) (*warmConn, error) {
+			return func(ctx context.Context) (*warmConn, error) {
+				mu.Lock()
+				spawned[env["MODEL"]]++
+				mu.Unlock()
+				w, _ := fakeWarmConn()
+				return w, nil
+			}
+		})
+	defer set.shutdown()
+
+	base := set.startBase(AgentClaudeCode, PoolConfig{Size: 2, Min: 1})
+	waitFor(t, "base pool to fill", func() bool { return len(base.warm) == 2 })
+
+	opus := map[string]string{"MODEL": "opus"}
+	model := set.pool(AgentClaudeCode, opus)
+	if set.pool(AgentClaudeCode, map[string]string{"MODEL": "opus"}) != model {
+		t.Fatal("same env should map to the same pool")
+	}
+	if set.pool(AgentClaudeCode, nil) != base {
+		t.Fatal("no env should map to the base pool")
+	}
+	if _, err := model.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	// The synchronous spawn always happens; background warming is held back
+	// because the base pool already uses the whole budget.
+	time.Sleep(50 * time.Millisecond)
+	if s := model.Stats(); s.Warm != 0 || s.Misses != 1 {
+		t.Errorf("model pool = %+v", s)
+	}
+	mu.Lock()
+	if spawned["opus"] != 1 {
+		t.Errorf("opus spawns = %d, want just the synchronous one", spawned["opus"])
+	}
+	mu.Unlock()
+
+	// Idle: the per-model pool drains and is dropped; the base pool stays at
+	// its floor.
+	set.maintain(time.Now().Add(2 * time.Hour))
+	stats := set.stats()
+	if len(stats) != 1 || len(stats[0].Env) != 0 || stats[0].Warm != 1 {
+		t.Errorf("after idle: %+v", stats)
+	}
+}
@@ -0,0 +1,219 @@
+package agentsdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Agent registry file.
+//
+// The built-in agents are configured in code (server.go). Any other
+// ACP-compliant agent can be added — or a built-in adjusted — by declaring it
+// in a JSON file:
+//
+//	{
+//	  "agents": {
+//	    "goose": {
+//	      "name": "Goose",
+//	      "command": "goose",
+//	      "args": ["acp"],
+//	      "env": {"OPENAI_BASE_URL": "${AGENT_PROXY_URL}", "OPENAI_API_KEY": "${AGENT_PROXY_TOKEN}"},
+//	      "modelEnv": ["GOOSE_MODEL"],
+//	      "capabilities": {"setModel": true},
+//	      "retention": {"path": "~/.config/goose/config.json", "settings": {"session.cleanup": false}}
+//	    },
+//	    "gemini": {"disabled": true}
+//	  }
+//	}
+//
+// An entry keyed by a built-in type overrides the fields it sets (env is
+// merged key by key); "disabled" removes the agent. Strings in env, args and
+// retention.path may reference ${VAR} for the variables the caller passes
+// in — nothing else from the process environment is expanded, so the file
+// can't accidentally pull in unrelated secrets.
+
+// agentTypePattern restricts declared type names to what's safe in URLs,
+// DB records and AGENT_MODELS agent lists.
+var agentTypePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+type agentFile struct {
+	Agents map[string]agentFileEntry `json:"agents"`
+}
+
+type agentFileEntry struct {
+	Name          string             `json:"name"`
+	Command       string             `json:"command"`
+	Args          []string           `json:"args"`
+	Env           map[string]string  `json:"env"`
+	CleanEnv      *bool              `json:"cleanEnv"`
+	ModelEnv      []string           `json:"modelEnv"`
+	SmallModelEnv string             `json:"smallModelEnv"`
+	ModelPrefix   string             `json:"modelPrefix"`
+	Capabilities  *AgentCapabilities `json:"capabilities"`
+	Retention     *RetentionConfig   `json:"retention"`
+	Disabled      bool               `json:"disabled"`
+}
+
+// LoadAgentRegistry merges the agents declared in the file at path over
+// builtins and returns the result: built-ins first in their given order,
+// then declared agents sorted by type. A missing file yields builtins
+// unchanged. vars are the only names ${VAR} references may use.
+func LoadAgentRegistry(path string, builtins []AgentConfig, vars map[string]string) ([]AgentConfig, error) {
+	body, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return builtins, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file agentFile
+	if err := json.Unmarshal(body, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	declared := make(map[AgentType]agentFileEntry, len(file.Agents))
+	for key, entry := range file.Agents {
+		if !agentTypePattern.MatchString(key) {
+			return nil, fmt.Errorf("agent %q: type must match %s", key, agentTypePattern)
+		}
+		if err := expandEntry(&entry, vars); err != nil {
+			return nil, fmt.Errorf("agent %q: %w", key, err)
+		}
+		declared[AgentType(key)] = entry
+	}
+
+	agents := make([]AgentConfig, 0, len(builtins)+len(declared))
+	for _, b := range builtins {
+		entry, ok := declared[b.Type]
+		if !ok {
+			agents = append(agents, b)
+			continue
+		}
+		delete(declared, b.Type)
+		if !entry.Disabled {
+			agents = append(agents, entry.apply(b))
+		}
+	}
+
+	types := make([]string, 0, len(declared))
+	for t := range declared {
+		types = append(types, string(t))
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		entry := declared[AgentType(t)]
+		if entry.Disabled {
+			continue
+		}
+		if entry.Command == "" {
+			return nil, fmt.Errorf("agent %q: command is required", t)
+		}
+		a := entry.apply(AgentConfig{Type: AgentType(t), Name: t})
+		agents = append(agents, a)
+	}
+	return agents, nil
+}
+
+// apply overlays the entry's set fields onto base.
+func (e agentFileEntry) apply(base AgentConfig) AgentConfig {
+	a := base
+	if e.Name != "" {
+		a.Name = e.Name
+	}
+	if e.Command != "" {
+		a.Command = e.Command
+	}
+	if e.Args != nil {
+		a.Args = e.Args
+	}
+	if len(e.Env) > 0 {
+		env := make(map[string]string, len(base.Env)+len(e.Env))
+		for k, v := range base.Env {
+			env[k] = v
+		}
+		for k, v := range e.Env {
+			env[k] = v
+		}
+		a.Env = env
+	}
+	if e.CleanEnv != nil {
+		a.CleanEnv = *e.CleanEnv
+	}
+	if e.ModelEnv != nil {
+		a.ModelEnv = e.ModelEnv
+	}
+	if e.SmallModelEnv != "" {
+		a.SmallModelEnv = e.SmallModelEnv
+	}
+	if e.ModelPrefix != "" {
+		a.ModelPrefix = e.ModelPrefix
+	}
+	if e.Capabilities != nil {
+		a.Capabilities = *e.Capabilities
+	}
+	if e.Retention != nil {
+		a.Retention = e.Retention
+	}
+	return a
+}
+
+// expandEntry resolves ${VAR} references in the entry's env, args and
+// retention path. Unknown names are an error rather than an empty string, so
+// a typo doesn't silently boot an agent without its credentials.
+func expandEntry(e *agentFileEntry, vars map[string]string) error {
+	var missing []string
+	expand := func(s string) string {
+		return os.Expand(s, func(name string) string {
+			v, ok := vars[name]
+			if !ok {
+				missing = append(missing, name)
+			}
+			return v
+		})
+	}
+	for k, v := range e.Env {
+		e.Env[k] = expand(v)
+	}
+	for i, v := range e.Args {
+		e.Args[i] = expand(v)
+	}
+	if e.Retention != nil {
+		e.Retention.Path = expand(e.Retention.Path)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("unknown variable(s) %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// ACPModel returns model in the form the agent's SetModel expects.
+func (a AgentConfig) ACPModel(model string) string {
+	if a.ModelPrefix != "" && !strings.HasPrefix(model, a.ModelPrefix) {
+		return a.ModelPrefix + model
+	}
+	return model
+}
+
+// ModelEnvFor returns the env vars that make a spawned agent boot on model,
+// with small as its small/fast companion (model when empty). Nil when the
+// agent takes its model from somewhere other than env.
+func (a AgentConfig) ModelEnvFor(model, small string) map[string]string {
+	if len(a.ModelEnv) == 0 && a.SmallModelEnv == "" {
+		return nil
+	}
+	env := make(map[string]string, len(a.ModelEnv)+1)
+	for _, k := range a.ModelEnv {
+		env[k] = model
+	}
+	if a.SmallModelEnv != "" {
+		if small == "" {
+			small = model
+		}
+		env[a.SmallModelEnv] = small
+	}
+	return env
+}
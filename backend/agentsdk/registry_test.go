@@ -0,0 +1,118 @@
+package agentsdk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeRegistry(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".agents.json")
+	if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAgentRegistry(t *testing.T) {
+	builtins := []AgentConfig{
+		{Type: AgentClaudeCode, Name: "Claude Code", Command: "claude-agent-acp", Env: map[string]string{"ANTHROPIC_MODEL": "sonnet"}},
+		{Type: AgentCodex, Name: "Codex", Command: "codex-acp", ModelEnv: []string{"OPENAI_MODEL"}},
+		{Type: AgentGemini, Name: "Gemini", Command: "gemini"},
+	}
+	path := writeRegistry(t, `{"agents": {
+		"zed": {"command": "zed-acp"},
+		"goose": {
+			"name": "Goose",
+			"command": "goose",
+			"args": ["acp", "--home=${HOME}"],
+			"env": {"OPENAI_API_KEY": "${AGENT_PROXY_TOKEN}"},
+			"modelEnv": ["GOOSE_MODEL"],
+			"capabilities": {"setModel": true},
+			"retention": {"path": "${HOME}/.goose.json", "settings": {"session.cleanup": false}}
+		},
+		"claude_code": {"env": {"DISABLE_TELEMETRY": "1"}, "capabilities": {"setModel": true, "effort": true}},
+		"gemini": {"disabled": true}
+	}}`)
+
+	agents, err := LoadAgentRegistry(path, builtins, map[string]string{"HOME": "/home/me", "AGENT_PROXY_TOKEN": "sk-test"})
+	if err != nil {
+		t.Fatalf("LoadAgentRegistry: %v", err)
+	}
+	var types []string
+	for _, a := range agents {
+		types = append(types, string(a.Type))
+	}
+	if got := strings.Join(types, ","); got != "claude_code,codex,goose,zed" {
+		t.Fatalf("types = %s", got)
+	}
+
+	cc := agents[0]
+	if cc.Command != "claude-agent-acp" || cc.Env["ANTHROPIC_MODEL"] != "sonnet" || cc.Env["DISABLE_TELEMETRY"] != "1" {
+		t.Errorf("claude_code override = %+v", cc)
+	}
+	if !cc.Capabilities.Effort {
+		t.Error("claude_code capabilities not applied")
+	}
+	if builtins[0].Env["DISABLE_TELEMETRY"] != "" {
+		t.Error("override mutated the built-in env")
+	}
+
+	goose := agents[2]
+	if goose.Name != "Goose" || goose.Args[1] != "--home=/home/me" || goose.Env["OPENAI_API_KEY"] != "sk-test" {
+		t.Errorf("goose = %+v", goose)
+	}
+	if goose.Retention == nil || goose.Retention.Path != "/home/me/.goose.json" {
+		t.Errorf("goose retention = %+v", goose.Retention)
+	}
+	if env := goose.ModelEnvFor("gpt-5.4", ""); env["GOOSE_MODEL"] != "gpt-5.4" || len(env) != 1 {
+		t.Errorf("ModelEnvFor = %v", env)
+	}
+	if zed := agents[3]; zed.Name != "zed" {
+		t.Errorf("zed name = %q, want the type", zed.Name)
+	}
+}
+
+func TestLoadAgentRegistry_MissingFile(t *testing.T) {
+	builtins := []AgentConfig{{Type: AgentClaudeCode, Command: "claude-agent-acp"}}
+	agents, err := LoadAgentRegistry(filepath.Join(t.TempDir(), "nope.json"), builtins, nil)
+	if err != nil || len(agents) != 1 {
+		t.Fatalf("agents = %+v, err = %v", agents, err)
+	}
+}
+
+func TestLoadAgentRegistry_Rejects(t *testing.T) {
+	for name, body := range map[string]string{
+		"unknown variable": `{"agents": {"x": {"command": "x", "env": {"K": "${AWS_SECRET}"}}}}`,
+		"no command":       `{"agents": {"x": {"name": "X"}}}`,
+		"bad type":         `{"agents": {"Bad Type": {"command": "x"}}}`,
+		"bad json":         `{"agents": `,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadAgentRegistry(writeRegistry(t, body), nil, map[string]string{}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestAgentConfig_ModelMapping(t *testing.T) {
+	cc := AgentConfig{ModelEnv: []string{"ANTHROPIC_MODEL"}, SmallModelEnv: "ANTHROPIC_SMALL_FAST_MODEL"}
+	env := cc.ModelEnvFor("opus", "")
+	if env["ANTHROPIC_MODEL"] != "opus" || env["ANTHROPIC_SMALL_FAST_MODEL"] != "opus" {
+		t.Errorf("ModelEnvFor = %v", env)
+	}
+	if env := (AgentConfig{}).ModelEnvFor("opus", ""); env != nil {
+		t.Errorf("no ModelEnv: got %v, want nil", env)
+	}
+
+	oc := AgentConfig{ModelPrefix: "litellm/"}
+	if got := oc.ACPModel("gpt-5.4"); got != "litellm/gpt-5.4" {
+		t.Errorf("ACPModel = %q", got)
+	}
+	if got := oc.ACPModel("litellm/gpt-5.4"); got != "litellm/gpt-5.4" {
+		t.Errorf("ACPModel double-prefixed: %q", got)
+	}
+}
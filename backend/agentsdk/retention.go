@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 )
@@ -28,12 +29,58 @@ const claudeCodeCleanupForever = 999999
 // settings.json files (server.go writes ~/.gemini/settings.json and
 // ~/.qwen/settings.json on startup), because this function does
 // read-merge-write on top of whatever is already there.
-func EnsureRetentionConfigs() {
+//
+// The built-in agents are handled below; any agent in agents that declares a
+// Retention config (from the registry file) gets it merged in as well.
+func EnsureRetentionConfigs(agents ...AgentConfig) {
 	ensureClaudeCodeRetention()
 	ensureCodexRetention()
 	ensureQwenRetention()
 	ensureGeminiRetention()
 	ensureOpencodeRetention()
+	for _, a := range agents {
+		if a.Retention != nil {
+			ensureDeclaredRetention(a.Type, a.Retention)
+		}
+	}
+}
+
+// ensureDeclaredRetention merges a registry-declared retention config into
+// the agent's settings file. Same read-merge-write rules as the built-ins: an
+// unreadable or non-JSON file is left alone.
+func ensureDeclaredRetention(agent AgentType, rc *RetentionConfig) {
+	path := rc.Path
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Warn().Err(err).Str("agent", string(agent)).Msg("retention: cannot resolve home dir; skipping")
+			return
+		}
+		path = filepath.Join(home, rest)
+	}
+	if path == "" || len(rc.Settings) == 0 {
+		log.Warn().Str("agent", string(agent)).Msg("retention: declared config needs a path and settings; skipping")
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("retention: failed to create settings dir")
+		return
+	}
+
+	settings, err := readJSONOrEmpty(path)
+	if err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("retention: failed to read settings; skipping to avoid clobber")
+		return
+	}
+	for key, value := range rc.Settings {
+		mergeNested(settings, strings.Split(key, "."), value)
+	}
+
+	if err := writeJSONAtomic(path, settings); err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("retention: failed to write settings")
+		return
+	}
+	log.Info().Str("agent", string(agent)).Str("path", path).Msg("retention: configured")
 }
 
 // ensureClaudeCodeRetention sets cleanupPeriodDays in ~/.claude/settings.json
@@ -214,6 +214,31 @@ func TestEnsureRetentionConfigs_AllFiveAgents(t *testing.T) {
 	// codex / opencode are no-ops (no files written), nothing to verify.
 }
 
+func TestEnsureRetentionConfigs_DeclaredAgent(t *testing.T) {
+	home := withFakeHome(t)
+	path := filepath.Join(home, ".config", "goose", "config.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"theme":"dark","session":{"keep":1}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	EnsureRetentionConfigs(AgentConfig{
+		Type: "goose",
+		Retention: &RetentionConfig{
+			Path:     "~/.config/goose/config.json",
+			Settings: map[string]any{"session.cleanup": false},
+		},
+	})
+
+	got := readJSON(t, path)
+	session, _ := got["session"].(map[string]any)
+	if got["theme"] != "dark" || session["keep"] != float64(1) || session["cleanup"] != false {
+		t.Fatalf("merged settings = %v", got)
+	}
+}
+
 func TestMergeNested_ReplacesNonObjectIntermediate(t *testing.T) {
 	settings := map[string]any{"general": "not an object"}
 	mergeNested(settings, []string{"general", "sessionRetention", "enabled"}, false)
@@ -181,8 +181,8 @@ func (s *SessionState) ClearPrompt() {
 }
 
 // AppendAndBroadcast appends data to the message buffer and notifies all connected clients.
-// If a FrameStore is configured, the frame is also enqueued for disk persistence
-// (non-blocking channel send, outside the lock).
+// If a FrameStore is configured, the frame is also queued for disk persistence
+// (outside the lock).
 func (s *SessionState) AppendAndBroadcast(data []byte) {
 	s.Mu.Lock()
 	s.rawMessages = append(s.rawMessages, data)
@@ -194,8 +194,8 @@ func (s *SessionState) AppendAndBroadcast(data []byte) {
 	sessionID := s.sessionID
 	s.Mu.Unlock()
 
-	// Persist to disk outside the lock — the channel send in FrameStore.Append
-	// is non-blocking (drops on overflow with a log warning).
+	// Persist to disk outside the lock — FrameStore.Append only waits when the
+	// session's writer is far behind, and that must not stall readers.
 	if fs != nil {
 		fs.Append(sessionID, data)
 	}
@@ -0,0 +1,489 @@
+package agentsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// defaultOutputRetries is how many times a task's answer is sent back for
+// correction when it does not match TaskConfig.OutputSchema.
+const defaultOutputRetries = 2
+
+// runTask drives session through config.Prompt (and any output-repair
+// rounds) and assembles the result from the frame stream. Tasks run
+// unattended: permission requests are declined unless the session mode
+// approves them itself.
+func runTask(ctx context.Context, session Session, config TaskConfig) (TaskResult, error) {
+	col := newTaskCollector(config.MaxTurns)
+	col.onMaxTurns = func() { _ = session.Stop() }
+	session.SetOnFrame(func(frame []byte) {
+		if id, optionID, ok := declinePermission(frame); ok {
+			_ = session.RespondToPermission(ctx, id, optionID)
+		}
+		col.handle(frame)
+	})
+
+	prompt := config.Prompt
+	if len(config.OutputSchema) > 0 {
+		prompt += "\n\n" + outputInstructions(config.OutputSchema)
+	}
+	retries := config.OutputRetries
+	if retries <= 0 {
+		retries = defaultOutputRetries
+	}
+
+	result := TaskResult{SessionID: session.ID()}
+	for round := 0; ; round++ {
+		col.startRound(prompt)
+		frames, err := session.Send(ctx, prompt)
+		if err != nil {
+			return col.result(result), err
+		}
+		for frame := range frames {
+			var msg struct {
+				Type       string `json:"type"`
+				Message    string `json:"message"`
+				Code       string `json:"code"`
+				StopReason string `json:"stopReason"`
+				Usage      *struct {
+					InputTokens  int `json:"inputTokens"`
+					OutputTokens int `json:"outputTokens"`
+				} `json:"usage"`
+			}
+			if json.Unmarshal(frame, &msg) != nil {
+				continue
+			}
+			switch msg.Type {
+			case "error":
+				return col.result(result), fmt.Errorf("%s: %s", msg.Code, msg.Message)
+			case "turn.complete":
+				result.StopReason = msg.StopReason
+				if msg.Usage != nil {
+					result.Usage.InputTokens += msg.Usage.InputTokens
+					result.Usage.OutputTokens += msg.Usage.OutputTokens
+				}
+			}
+		}
+
+		result = col.result(result)
+		if col.exceeded() {
+			result.StopReason = "max_turns"
+			result.ExitCode = 1
+			return result, &AgentError{
+				Type:    ErrMaxTurns,
+				Agent:   session.AgentType(),
+				Message: fmt.Sprintf("task stopped after %d turns", config.MaxTurns),
+			}
+		}
+		result.ExitCode = 0
+		if result.StopReason != "end_turn" {
+			result.ExitCode = 1
+		}
+		if len(config.OutputSchema) == 0 || result.ExitCode != 0 {
+			return result, nil
+		}
+
+		output, err := parseTaskOutput(config.OutputSchema, result.Text)
+		if err == nil {
+			result.Output = output
+			return result, nil
+		}
+		if round >= retries {
+			return result, &AgentError{
+				Type:    ErrInvalidOutput,
+				Agent:   session.AgentType(),
+				Message: "final answer does not match the output schema",
+				Cause:   err,
+			}
+		}
+		prompt = fmt.Sprintf("Your answer was not valid: %v.\n\n%s", err, outputInstructions(config.OutputSchema))
+	}
+}
+
+// outputInstructions tells the agent how to shape its final answer.
+func outputInstructions(schema json.RawMessage) string {
+	return "When you are done, reply with only a single JSON value that matches this JSON Schema, with no other text:\n" + string(schema)
+}
+
+// declinePermission picks the reject option of a permission.request frame.
+func declinePermission(frame []byte) (toolCallID, optionID string, ok bool) {
+	var req struct {
+		Type     string `json:"type"`
+		ToolCall struct {
+			ToolCallID string `json:"toolCallId"`
+		} `json:"toolCall"`
+		Options []struct {
+			OptionID string `json:"optionId"`
+			Kind     string `json:"kind"`
+		} `json:"options"`
+	}
+	if json.Unmarshal(frame, &req) != nil || req.Type != "permission.request" {
+		return "", "", false
+	}
+	for _, opt := range req.Options {
+		if opt.Kind == "reject_once" || opt.Kind == "reject_always" {
+			return req.ToolCall.ToolCallID, opt.OptionID, true
+		}
+	}
+	return "", "", false
+}
+
+// taskCollector assembles a TaskResult from ACP session/update frames.
+// Frames arrive on the ACP notification goroutine; result() is read from
+// the task goroutine.
+type taskCollector struct {
+	maxTurns   int
+	onMaxTurns func()
+
+	mu        sync.Mutex
+	messages  []Message
+	toolCalls []ToolCall
+	toolIndex map[string]int // toolCallId → index in toolCalls
+	plan      []PlanEntry
+	turns     int
+	inTurn    bool // the current step has produced output and no tool result yet
+	stopped   bool
+}
+
+func newTaskCollector(maxTurns int) *taskCollector {
+	return &taskCollector{maxTurns: maxTurns, toolIndex: map[string]int{}}
+}
+
+// startRound records a prompt and opens the assistant message for its
+// answer.
+func (tc *taskCollector) startRound(prompt string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.messages = append(tc.messages,
+		Message{Role: RoleUser, Content: []Block{{Type: BlockText, Text: prompt}}},
+		Message{Role: RoleAssistant},
+	)
+	tc.inTurn = false
+}
+
+func (tc *taskCollector) handle(frame []byte) {
+	var u struct {
+		SessionUpdate string          `json:"sessionUpdate"`
+		Content       json.RawMessage `json:"content"`
+		ToolCallID    string          `json:"toolCallId"`
+		Title         *string         `json:"title"`
+		Kind          *string         `json:"kind"`
+		Status        *string         `json:"status"`
+		RawInput      json.RawMessage `json:"rawInput"`
+		RawOutput     json.RawMessage `json:"rawOutput"`
+		Entries       []PlanEntry     `json:"entries"`
+	}
+	if json.Unmarshal(frame, &u) != nil || u.SessionUpdate == "" {
+		return
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if len(tc.messages) == 0 {
+		tc.messages = append(tc.messages, Message{Role: RoleAssistant})
+	}
+	msg := &tc.messages[len(tc.messages)-1]
+
+	switch u.SessionUpdate {
+	case "agent_message_chunk", "agent_thought_chunk":
+		var c struct {
+			Text string `json:"text"`
+		}
+		if json.Unmarshal(u.Content, &c) != nil || c.Text == "" {
+			return
+		}
+		tc.step()
+		typ := BlockText
+		if u.SessionUpdate == "agent_thought_chunk" {
+			typ = BlockThinking
+		}
+		if n := len(msg.Content); n > 0 && msg.Content[n-1].Type == typ {
+			msg.Content[n-1].Text += c.Text
+		} else {
+			msg.Content = append(msg.Content, Block{Type: typ, Text: c.Text})
+		}
+
+	case "tool_call":
+		tc.step()
+		call := ToolCall{ID: u.ToolCallID, Input: u.RawInput}
+		if u.Title != nil {
+			call.Title = *u.Title
+		}
+		if u.Kind != nil {
+			call.Kind = *u.Kind
+		}
+		if u.Status != nil {
+			call.Status = *u.Status
+		}
+		tc.toolIndex[call.ID] = len(tc.toolCalls)
+		tc.toolCalls = append(tc.toolCalls, call)
+		msg.Content = append(msg.Content, Block{
+			Type:      BlockToolUse,
+			ToolName:  call.Title,
+			ToolUseID: call.ID,
+			ToolKind:  call.Kind,
+			ToolInput: call.Input,
+		})
+
+	case "tool_call_update":
+		i, ok := tc.toolIndex[u.ToolCallID]
+		if !ok {
+			return
+		}
+		call := &tc.toolCalls[i]
+		if u.Title != nil {
+			call.Title = *u.Title
+		}
+		if u.Kind != nil {
+			call.Kind = *u.Kind
+		}
+		if len(u.RawInput) > 0 {
+			call.Input = u.RawInput
+		}
+		if out := toolOutputText(u.Content, u.RawOutput); out != "" {
+			call.Output = out
+		}
+		if u.Status != nil {
+			call.Status = *u.Status
+			if call.Status == "completed" || call.Status == "failed" {
+				msg.Content = append(msg.Content, Block{Type: BlockToolResult, ToolUseID: call.ID, Text: call.Output})
+				tc.inTurn = false
+			}
+		}
+
+	case "plan":
+		tc.plan = u.Entries
+		msg.Content = append(msg.Content, Block{Type: BlockPlan, PlanEntries: u.Entries})
+	}
+}
+
+// step counts agent output that opens a new step, stopping the task once
+// it goes past maxTurns. Called with mu held.
+func (tc *taskCollector) step() {
+	if tc.inTurn {
+		return
+	}
+	tc.inTurn = true
+	tc.turns++
+	if tc.maxTurns > 0 && tc.turns > tc.maxTurns && !tc.stopped {
+		tc.stopped = true
+		if tc.onMaxTurns != nil {
+			go tc.onMaxTurns() // not on the notification goroutine
+		}
+	}
+}
+
+func (tc *taskCollector) exceeded() bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.stopped
+}
+
+// result copies the collected state into r.
+func (tc *taskCollector) result(r TaskResult) TaskResult {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	r.Messages = append([]Message(nil), tc.messages...)
+	r.ToolCalls = append([]ToolCall(nil), tc.toolCalls...)
+	r.Plan = tc.plan
+	r.Turns = tc.turns
+	if tc.maxTurns > 0 && r.Turns > tc.maxTurns {
+		r.Turns = tc.maxTurns // the step that went over was cut short
+	}
+	r.Text = ""
+	if n := len(tc.messages); n > 0 {
+		r.Text = finalText(tc.messages[n-1])
+	}
+	return r
+}
+
+// finalText is the text the agent wrote after its last tool call.
+func finalText(msg Message) string {
+	var b strings.Builder
+	for _, block := range msg.Content {
+		switch block.Type {
+		case BlockText:
+			b.WriteString(block.Text)
+		case BlockToolUse, BlockToolResult:
+			b.Reset()
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// toolOutputText extracts what a tool returned from a tool_call_update:
+// its text content blocks, or else a string rawOutput.
+func toolOutputText(content, rawOutput json.RawMessage) string {
+	var items []struct {
+		Type    string `json:"type"`
+		Content struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if json.Unmarshal(content, &items) == nil {
+		var parts []string
+		for _, it := range items {
+			if it.Type == "content" && it.Content.Type == "text" && it.Content.Text != "" {
+				parts = append(parts, it.Content.Text)
+			}
+		}
+		if len(parts) > 0 {
+			return strings.Join(parts, "\n")
+		}
+	}
+	var s string
+	if json.Unmarshal(rawOutput, &s) == nil {
+		return s
+	}
+	return ""
+}
+
+// parseTaskOutput pulls the JSON answer out of the agent's final text —
+// tolerating a markdown fence or a sentence around it — and checks it
+// against schema.
+func parseTaskOutput(schema json.RawMessage, text string) (json.RawMessage, error) {
+	raw := extractJSON(text)
+	if raw == nil {
+		return nil, fmt.Errorf("no JSON value found in the answer")
+	}
+	var value any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	var s map[string]any
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, fmt.Errorf("invalid output schema: %w", err)
+	}
+	if err := checkSchema(s, value, "$"); err != nil {
+		return nil, err
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return nil, err
+	}
+	return compact.Bytes(), nil
+}
+
+// extractJSON returns the JSON value in text, or nil.
+func extractJSON(text string) []byte {
+	text = strings.TrimSpace(text)
+	if i := strings.Index(text, "```"); i >= 0 {
+		rest := text[i+3:]
+		if nl := strings.IndexByte(rest, '\n'); nl >= 0 {
+			rest = rest[nl+1:]
+		}
+		if j := strings.Index(rest, "```"); j >= 0 {
+			text = strings.TrimSpace(rest[:j])
+		}
+	}
+	if json.Valid([]byte(text)) {
+		return []byte(text)
+	}
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return nil
+	}
+	end := strings.LastIndexAny(text, "}]")
+	if end <= start || !json.Valid([]byte(text[start:end+1])) {
+		return nil
+	}
+	return []byte(text[start : end+1])
+}
+
+// checkSchema validates value against the parts of JSON Schema agents'
+// answers are usually described with: type, enum, required, properties,
+// additionalProperties: false and items.
+func checkSchema(schema map[string]any, value any, at string) error {
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		return fmt.Errorf("%s: expected %v", at, t)
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", at, value, enum)
+		}
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		if req, ok := schema["required"].([]any); ok {
+			for _, name := range req {
+				if _, ok := v[fmt.Sprint(name)]; !ok {
+					return fmt.Errorf("%s: missing required property %q", at, name)
+				}
+			}
+		}
+		for name, pv := range v {
+			ps, ok := props[name].(map[string]any)
+			if !ok {
+				if extra, ok := schema["additionalProperties"].(bool); ok && !extra {
+					return fmt.Errorf("%s: unexpected property %q", at, name)
+				}
+				continue
+			}
+			if err := checkSchema(ps, pv, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, iv := range v {
+				if err := checkSchema(items, iv, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func matchesType(t any, value any) bool {
+	if list, ok := t.([]any); ok {
+		for _, one := range list {
+			if matchesType(one, value) {
+				return true
+			}
+		}
+		return false
+	}
+	switch t {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	}
+	return true
+}
@@ -0,0 +1,202 @@
+package agentsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	acp "github.com/coder/acp-go-sdk"
+)
+
+// scriptedSession plays back one script of ACP frames per Send, the way
+// acpSession does: session updates through onFrame, turn.complete on the
+// returned channel.
+type scriptedSession struct {
+	rounds  [][]string // frames per Send; Stop() cuts a round short
+	prompts []string
+
+	mu        sync.Mutex
+	onFrame   func([]byte)
+	stopped   chan struct{}
+	responded map[string]string
+}
+
+func (s *scriptedSession) Send(ctx context.Context, prompt string) (<-chan []byte, error) {
+	s.prompts = append(s.prompts, prompt)
+	round := s.rounds[len(s.prompts)-1]
+	s.stopped = make(chan struct{})
+	out := make(chan []byte, 1)
+	go func() {
+		defer close(out)
+		for _, f := range round {
+			s.onFrame([]byte(f))
+			select {
+			case <-s.stopped:
+				out <- []byte(`{"type":"turn.complete","stopReason":"cancelled"}`)
+				return
+			default:
+			}
+		}
+		out <- []byte(`{"type":"turn.complete","stopReason":"end_turn","usage":{"inputTokens":100,"outputTokens":10,"totalTokens":110}}`)
+	}()
+	return out, nil
+}
+
+func (s *scriptedSession) Stop() error {
+	// Stop is asynchronous in ACP; the scripted round checks after each frame.
+	close(s.stopped)
+	return nil
+}
+
+func (s *scriptedSession) RespondToPermission(ctx context.Context, id, optionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.responded == nil {
+		s.responded = map[string]string{}
+	}
+	s.responded[id] = optionID
+	return nil
+}
+
+func (s *scriptedSession) SetOnFrame(fn func([]byte))                        { s.onFrame = fn }
+func (s *scriptedSession) LoadSession(context.Context, string, string) error { return nil }
+func (s *scriptedSession) CancelAllPermissions()                             {}
+func (s *scriptedSession) DenyPermission(context.Context, string) error      { return nil }
+func (s *scriptedSession) SetMode(context.Context, string) error             { return nil }
+func (s *scriptedSession) SetModel(context.Context, string) ([]acp.SessionConfigOption, error) {
+	return nil, nil
+}
+func (s *scriptedSession) SetConfigOption(context.Context, string, string) ([]acp.SessionConfigOption, error) {
+	return nil, nil
+}
+func (s *scriptedSession) Close() error          { return nil }
+func (s *scriptedSession) Done() <-chan struct{} { return nil }
+func (s *scriptedSession) ID() string            { return "sess-1" }
+func (s *scriptedSession) AgentType() AgentType  { return AgentClaudeCode }
+
+func textChunk(text string) string {
+	b, _ := json.Marshal(map[string]any{"sessionUpdate": "agent_message_chunk", "content": map[string]any{"type": "text", "text": text}})
+	return string(b)
+}
+
+const (
+	planFrame     = `{"sessionUpdate":"plan","entries":[{"content":"List files","status":"completed","priority":"high"}]}`
+	toolCallFrame = `{"sessionUpdate":"tool_call","toolCallId":"t1","title":"ls","kind":"execute","status":"pending","rawInput":{"command":"ls"}}`
+	toolDoneFrame = `{"sessionUpdate":"tool_call_update","toolCallId":"t1","status":"completed","content":[{"type":"content","content":{"type":"text","text":"a.md\nb.md"}}]}`
+	permFrame     = `{"type":"permission.request","toolCall":{"toolCallId":"t1"},"options":[{"optionId":"allow","kind":"allow_once"},{"optionId":"reject","kind":"reject_once"}]}`
+)
+
+func TestRunTask_AssemblesResult(t *testing.T) {
+	s := &scriptedSession{rounds: [][]string{{
+		textChunk("Let me look."),
+		planFrame,
+		toolCallFrame,
+		permFrame,
+		toolDoneFrame,
+		textChunk("There are "),
+		textChunk("two files."),
+	}}}
+
+	res, err := runTask(context.Background(), s, TaskConfig{Prompt: "count files"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SessionID != "sess-1" || res.Text != "There are two files." || res.StopReason != "end_turn" || res.ExitCode != 0 {
+		t.Errorf("result = %+v", res)
+	}
+	if res.Usage != (Usage{InputTokens: 100, OutputTokens: 10}) || res.Turns != 2 {
+		t.Errorf("usage = %+v, turns = %d", res.Usage, res.Turns)
+	}
+	if len(res.ToolCalls) != 1 {
+		t.Fatalf("tool calls = %+v", res.ToolCalls)
+	}
+	call := res.ToolCalls[0]
+	if call.Title != "ls" || call.Kind != "execute" || call.Status != "completed" || call.Output != "a.md\nb.md" || string(call.Input) != `{"command":"ls"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+	if len(res.Plan) != 1 || res.Plan[0].Content != "List files" {
+		t.Errorf("plan = %+v", res.Plan)
+	}
+	if len(res.Messages) != 2 || res.Messages[0].Role != RoleUser || res.Messages[1].Role != RoleAssistant {
+		t.Fatalf("messages = %+v", res.Messages)
+	}
+	var types []string
+	for _, b := range res.Messages[1].Content {
+		types = append(types, string(b.Type))
+	}
+	if got := strings.Join(types, ","); got != "text,plan,tool_use,tool_result,text" {
+		t.Errorf("assistant blocks = %s", got)
+	}
+	if s.responded["t1"] != "reject" {
+		t.Errorf("permission response = %v, want the reject option", s.responded)
+	}
+}
+
+func TestRunTask_OutputSchemaRepairsInvalidAnswer(t *testing.T) {
+	schema := json.RawMessage(`{"type":"object","required":["count"],"properties":{"count":{"type":"integer"}}}`)
+	s := &scriptedSession{rounds: [][]string{
+		{textChunk(`{"total": 2}`)},
+		{textChunk("```json\n{\"count\": 2}\n```")},
+	}}
+
+	res, err := runTask(context.Background(), s, TaskConfig{Prompt: "count files", OutputSchema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Output) != `{"count":2}` {
+		t.Errorf("output = %s", res.Output)
+	}
+	if len(s.prompts) != 2 || !strings.Contains(s.prompts[0], `"required":["count"]`) || !strings.Contains(s.prompts[1], `missing required property "count"`) {
+		t.Errorf("prompts = %q", s.prompts)
+	}
+	if res.Usage.InputTokens != 200 || len(res.Messages) != 4 {
+		t.Errorf("usage = %+v, %d messages", res.Usage, len(res.Messages))
+	}
+}
+
+func TestRunTask_OutputSchemaGivesUp(t *testing.T) {
+	schema := json.RawMessage(`{"type":"array","items":{"type":"string"}}`)
+	s := &scriptedSession{rounds: [][]string{{textChunk("no idea")}, {textChunk("[1]")}}}
+
+	_, err := runTask(context.Background(), s, TaskConfig{Prompt: "x", OutputSchema: schema, OutputRetries: 1})
+	var ae *AgentError
+	if !errors.As(err, &ae) || ae.Type != ErrInvalidOutput {
+		t.Fatalf("err = %v, want ErrInvalidOutput", err)
+	}
+	if !strings.Contains(err.Error(), "$[0]: expected string") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestRunTask_MaxTurns(t *testing.T) {
+	s := &scriptedSession{rounds: [][]string{{
+		toolCallFrame, toolDoneFrame, // turn 1
+		strings.Replace(toolCallFrame, "t1", "t2", 1), // turn 2: over the cap
+		textChunk("done"),
+	}}}
+
+	res, err := runTask(context.Background(), s, TaskConfig{SessionConfig: SessionConfig{MaxTurns: 1}, Prompt: "x"})
+	var ae *AgentError
+	if !errors.As(err, &ae) || ae.Type != ErrMaxTurns {
+		t.Fatalf("err = %v, want ErrMaxTurns", err)
+	}
+	if res.StopReason != "max_turns" || res.ExitCode != 1 || res.Turns != 1 {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestExtractJSON(t *testing.T) {
+	for text, want := range map[string]string{
+		`{"a":1}`:                           `{"a":1}`,
+		"Here you go:\n```json\n[1,2]\n```": `[1,2]`,
+		`The answer is {"a": {"b": 2}}.`:    `{"a": {"b": 2}}`,
+		"nothing here":                      "",
+	} {
+		if got := string(extractJSON(text)); got != want {
+			t.Errorf("extractJSON(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
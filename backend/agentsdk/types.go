@@ -12,7 +12,8 @@ import (
 	acp "github.com/coder/acp-go-sdk"
 )
 
-// AgentType identifies which agent CLI to use.
+// AgentType identifies which agent CLI to use. The constants below are the
+// built-in agents; a registry file can declare more (see LoadAgentRegistry).
 type AgentType string
 
 const (
@@ -31,6 +32,28 @@ type AgentConfig struct {
 	Args    []string          // default CLI args
 	Env     map[string]string // agent-specific default env vars
 	CleanEnv bool             // when true, do not inherit the full parent environment
+
+	// How a chosen gateway model reaches the agent.
+	ModelEnv      []string // env vars set to the model at spawn: "OPENAI_MODEL"
+	SmallModelEnv string   // env var for the small/fast companion model, if any
+	ModelPrefix   string   // prefix the agent's SetModel expects: "litellm/"
+
+	Capabilities AgentCapabilities
+	Retention    *RetentionConfig // extra settings to keep transcripts; nil = none
+}
+
+// AgentCapabilities flags the optional ACP calls an agent handles, so callers
+// skip the ones it would reject.
+type AgentCapabilities struct {
+	SetModel bool `json:"setModel"` // session/set_model accepts gateway model names
+	Effort   bool `json:"effort"`   // the "effort" session config option
+}
+
+// RetentionConfig is a read-merge-write into an agent's JSON settings file,
+// applied on startup by EnsureRetentionConfigs.
+type RetentionConfig struct {
+	Path     string         `json:"path"`     // settings file; a leading "~/" is the home dir
+	Settings map[string]any `json:"settings"` // dotted key path → value
 }
 
 // SessionConfig configures an interactive agent session.
@@ -45,19 +68,46 @@ type SessionConfig struct {
 	McpServers   []acp.McpServer   // MCP servers to provide to the agent via ACP
 }
 
-// TaskConfig configures a one-off agent task.
+// TaskConfig configures a one-off agent task. MaxTurns (from
+// SessionConfig) caps the agent's steps — each model response that ends in
+// tool calls or an answer is one step — across the whole task, including
+// any rounds spent repairing the output; 0 means no cap.
 type TaskConfig struct {
 	SessionConfig
 	Prompt  string
 	Timeout time.Duration
+
+	// OutputSchema asks for a machine-readable answer: the agent is told to
+	// finish with a single JSON value matching this JSON Schema, and the
+	// validated value is returned in TaskResult.Output. An answer that does
+	// not match is sent back for correction up to OutputRetries times.
+	OutputSchema  json.RawMessage
+	OutputRetries int // 0 = defaultOutputRetries
 }
 
 // TaskResult is the output of a completed task.
 type TaskResult struct {
 	SessionID string
-	Messages  []Message
-	Usage     Usage
-	ExitCode  int
+	Messages  []Message // the prompt(s) and everything the agent said or did, in order
+	Usage     Usage     // summed over every prompt round
+	ExitCode  int       // 0 when the agent ended its turn normally, 1 otherwise
+
+	Text       string          // the final assistant message
+	Output     json.RawMessage // the validated answer when OutputSchema is set
+	ToolCalls  []ToolCall      // every tool the agent called, in order
+	Plan       []PlanEntry     // the agent's latest plan, if it made one
+	StopReason string          // ACP stop reason of the last round, or "max_turns"
+	Turns      int             // agent steps taken (see TaskConfig)
+}
+
+// ToolCall summarizes one tool call made during a task.
+type ToolCall struct {
+	ID     string
+	Title  string
+	Kind   string // "execute", "edit", "read", ...
+	Status string // "pending", "in_progress", "completed", "failed"
+	Input  json.RawMessage
+	Output string // text the tool returned, when the agent reported it
 }
 
 // Event represents a streaming event from the agent.
@@ -166,9 +216,10 @@ const (
 
 // AgentInfo describes an available agent.
 type AgentInfo struct {
-	Type    AgentType
-	Name    string
-	Version string
+	Type         AgentType
+	Name         string
+	Version      string
+	Capabilities AgentCapabilities
 }
 
 // Session represents an interactive agent conversation.
@@ -184,6 +235,10 @@ type Session interface {
 	// RespondToPermission responds to an EventPermissionRequest using an optionID.
 	RespondToPermission(ctx context.Context, toolCallID string, optionID string) error
 
+	// DenyPermission refuses one pending permission request: with its
+	// reject option when it has one, otherwise by cancelling it.
+	DenyPermission(ctx context.Context, toolCallID string) error
+
 	// CancelAllPermissions cancels all pending permission requests.
 	CancelAllPermissions()
 
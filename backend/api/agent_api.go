@@ -8,6 +8,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/xiaoyuanzhu-com/my-life-db/agentsdk"
 	"github.com/xiaoyuanzhu-com/my-life-db/db"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 )
@@ -18,23 +19,54 @@ func (h *Handlers) GetAgentInfo(c *gin.Context) {
 	agents := h.server.AgentClient().AvailableAgents()
 
 	type agentResponse struct {
-		Type    string `json:"type"`
-		Name    string `json:"name"`
-		Version string `json:"version,omitempty"`
+		Type         string                     `json:"type"`
+		Name         string                     `json:"name"`
+		Version      string                     `json:"version,omitempty"`
+		Capabilities agentsdk.AgentCapabilities `json:"capabilities"`
 	}
 
 	var resp []agentResponse
 	for _, a := range agents {
 		resp = append(resp, agentResponse{
-			Type:    string(a.Type),
-			Name:    a.Name,
-			Version: a.Version,
+			Type:         string(a.Type),
+			Name:         a.Name,
+			Version:      a.Version,
+			Capabilities: a.Capabilities,
 		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{"agents": resp})
 }
 
+// GetAgentPools returns the warm agent process pools and their limits.
+// Admin only: the pools are shared by every account.
+// GET /api/agent/pools
+func (h *Handlers) GetAgentPools(c *gin.Context) {
+	client := h.server.AgentClient()
+	pools := client.PoolStats()
+	if pools == nil {
+		pools = []agentsdk.PoolStats{}
+	}
+	var warm int
+	var rss int64
+	for _, p := range pools {
+		warm += p.Warm
+		rss += p.RSSBytes
+	}
+	limits := client.PoolLimits()
+	c.JSON(http.StatusOK, gin.H{
+		"pools":    pools,
+		"warm":     warm,
+		"rssBytes": rss,
+		"limits": gin.H{
+			"maxWarm":       limits.MaxWarm,
+			"memoryBytes":   limits.MemoryLimit,
+			"modelPoolSize": limits.ModelPoolSize,
+			"modelPoolMax":  limits.ModelPoolMax,
+		},
+	})
+}
+
 // CreateAgentSession creates a new agent session by eagerly spawning the ACP
 // agent process. The ACP session ID becomes the DB primary key.
 // POST /api/agent/sessions
@@ -58,10 +90,22 @@ func (h *Handlers) CreateAgentSession(c *gin.Context) {
 		return
 	}
 
+	user := CurrentUser(c)
+	workingDir, ok := h.resolveUserWorkingDir(user, req.WorkingDir)
+	if !ok {
+		RespondForbidden(c, "workingDir is outside your data root")
+		return
+	}
+	req.WorkingDir = workingDir
+
 	agentTypeStr := req.AgentType
 	if agentTypeStr == "" {
 		agentTypeStr = "claude_code"
 	}
+	if _, ok := h.server.AgentClient().Agent(agentsdk.AgentType(agentTypeStr)); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown agentType: " + agentTypeStr})
+		return
+	}
 
 	// Use requested model, or fall back to first gateway model compatible with this agent.
 	// Validate req.Model against the current gateway list — a stale value from the
@@ -114,6 +158,7 @@ func (h *Handlers) CreateAgentSession(c *gin.Context) {
 			Effort:         effort,
 			Source:         "user",
 			StorageID:      req.StorageID,
+			UserID:         user.ID,
 		},
 	)
 	if err != nil {
@@ -154,8 +199,14 @@ func (h *Handlers) GetAgentSessions(c *gin.Context) {
 		}
 	}
 
+	// Members only see their own sessions; admins see every account's.
+	var userFilter *string
+	if user := CurrentUser(c); !user.IsAdmin() {
+		userFilter = &user.ID
+	}
+
 	// Fetch limit+1 to determine if there are more results
-	sessions, err := h.server.AppDB().ListAgentSessions(includeArchived, cursor, limit+1)
+	sessions, err := h.server.AppDB().ListAgentSessions(includeArchived, cursor, limit+1, userFilter)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to list agent sessions")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list sessions"})
@@ -221,6 +272,9 @@ func (h *Handlers) GetAgentSessions(c *gin.Context) {
 		if s.TriggerKind != "" {
 			entry["triggerKind"] = s.TriggerKind
 		}
+		if s.UserID != db.OwnerUserID {
+			entry["userId"] = s.UserID
+		}
 		if s.TriggerData != "" {
 			// Parse on the wire so the frontend gets a structured object
 			// instead of having to JSON.parse twice.
@@ -357,14 +411,16 @@ func (h *Handlers) UpdateAgentSession(c *gin.Context) {
 			groupID = *req.GroupID
 		}
 		if groupID != "" {
-			// Validate that the target group exists, otherwise the update is silently a no-op.
+			// Validate that the target group exists and is the caller's own,
+			// otherwise the update is silently a no-op (or files the session
+			// under another account's group).
 			g, err := h.server.AppDB().GetAgentSessionGroup(groupID)
 			if err != nil {
 				log.Error().Err(err).Str("groupId", groupID).Msg("failed to look up group")
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update session"})
 				return
 			}
-			if g == nil {
+			if g == nil || g.UserID != CurrentUser(c).ID {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "group not found"})
 				return
 			}
@@ -404,6 +460,15 @@ func (h *Handlers) ArchiveAgentSession(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to archive session"})
 		return
 	}
+	// Compact (and compress, if enabled) the session's frames off the
+	// request path; a session that keeps running just starts a new file.
+	if fs := h.server.FrameStore(); fs != nil {
+		go func() {
+			if err := fs.Archive(sessionID); err != nil {
+				log.Error().Err(err).Str("sessionId", sessionID).Msg("frame_store: archive failed")
+			}
+		}()
+	}
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
@@ -605,6 +670,8 @@ func (h *Handlers) RestartAgentSession(c *gin.Context) {
 //                    when a previous server instance was killed mid-turn)
 //   - 'cancelled':   last_turn_outcome == 'cancelled'  (user stopped the turn)
 //   - 'error':       last_turn_outcome == 'errored'    (note: verb→noun at API)
+//                    or 'limited' (agent killed for exceeding its resource
+//                    limits; lastTurnOutcome keeps the distinction)
 //   - 'idle':        anything else (covers 'completed' and '')
 //
 // The 'unread' view-state is intentionally NOT in this enum — see computeHasUnread.
@@ -624,7 +691,7 @@ func computeSessionState(
 		return "interrupted"
 	case "cancelled":
 		return "cancelled"
-	case "errored":
+	case "errored", "limited":
 		return "error"
 	}
 	return "idle"
@@ -0,0 +1,399 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	acp "github.com/coder/acp-go-sdk"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/agentrunner"
+	"github.com/xiaoyuanzhu-com/my-life-db/agentsdk"
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// Approvals inbox for gated auto agents.
+//
+// An auto agent with `permissions: gated` runs in the agent's default mode
+// instead of bypassPermissions, so it asks before acting. Nobody is on the
+// WebSocket to answer, so every permission.request frame from a gated
+// session is also recorded in agent_approvals and announced with an
+// agent-approval notification, while the turn stays blocked in
+// acpClient.RequestPermission. The owner answers from the inbox API (or from
+// the session's permission card — both go through RespondToPermission), and
+// the turn carries on. Requests nobody answers get the session's timeout
+// policy; requests whose turn ended first are cancelled. The turn's time
+// limit (AGENT_TURN_TIMEOUT_SECS) is paused while a request waits, so the
+// approval timeout alone bounds how long a gated run sits in the inbox.
+
+// approvalSweepInterval is how often timed-out approvals are resolved.
+const approvalSweepInterval = 30 * time.Second
+
+var (
+	errApprovalNotFound = errors.New("approval not found")
+	errApprovalResolved = errors.New("approval already resolved")
+	errApprovalStale    = errors.New("the agent is no longer waiting for this approval")
+)
+
+// permissionRequestMarker identifies permission.request frames cheaply; the
+// frame hook sees every ACP frame.
+var permissionRequestMarker = []byte(`"type":"permission.request"`)
+
+// queueApproval records a permission.request frame from a gated session in
+// the approvals inbox. Frames from other sessions are ignored. Called from
+// the SetupACP frame hook.
+func (m *AgentManager) queueApproval(sessionID string, frame []byte) {
+	if !bytes.Contains(frame, permissionRequestMarker) {
+		return
+	}
+	timeoutMs, onTimeout, err := m.srv.AppDB().GetAgentSessionApprovalPolicy(sessionID)
+	if err != nil {
+		log.Warn().Err(err).Str("sessionId", sessionID).Msg("failed to load approval policy")
+		return
+	}
+	if timeoutMs <= 0 {
+		return // not gated: the permission card in the session is the only prompt
+	}
+
+	var req struct {
+		ToolCall json.RawMessage `json:"toolCall"`
+		Options  json.RawMessage `json:"options"`
+	}
+	var toolCall struct {
+		ToolCallID string `json:"toolCallId"`
+		Title      string `json:"title"`
+	}
+	if json.Unmarshal(frame, &req) != nil || json.Unmarshal(req.ToolCall, &toolCall) != nil || toolCall.ToolCallID == "" {
+		log.Warn().Str("sessionId", sessionID).Msg("malformed permission.request frame, not queued for approval")
+		return
+	}
+
+	var agentName string
+	if rec, _ := m.srv.AppDB().GetAgentSession(sessionID); rec != nil {
+		agentName = rec.AgentName
+	}
+	now := db.NowMs()
+	r := &db.AgentApprovalRecord{
+		ID:         uuid.New().String(),
+		SessionID:  sessionID,
+		ToolCallID: toolCall.ToolCallID,
+		AgentName:  agentName,
+		Title:      toolCall.Title,
+		ToolCall:   req.ToolCall,
+		Options:    req.Options,
+		OnTimeout:  onTimeout,
+		ExpiresAt:  now + timeoutMs,
+		CreatedAt:  now,
+	}
+	if err := m.srv.AppDB().CreateAgentApproval(context.Background(), r); err != nil {
+		log.Error().Err(err).Str("sessionId", sessionID).Str("toolCallId", r.ToolCallID).Msg("failed to queue approval")
+		return
+	}
+	log.Info().
+		Str("sessionId", sessionID).
+		Str("approvalId", r.ID).
+		Str("agent", agentName).
+		Str("title", r.Title).
+		Time("expiresAt", time.UnixMilli(r.ExpiresAt)).
+		Msg("permission request queued for approval")
+	m.notifService.NotifyAgentApproval(r.ID, sessionID, r.Title, "requested")
+}
+
+// RespondToPermission answers a pending permission request on the session's
+// live agent, records the answer in the transcript (permission.resolved) and
+// settles the matching inbox entry, if any. resolvedBy says who answered:
+// "session", "user" or "timeout".
+func (m *AgentManager) RespondToPermission(sessionID string, sessionState *agentsdk.SessionState, toolCallID, optionID, resolvedBy string) error {
+	sess, exists := m.GetSession(sessionID)
+	if !exists {
+		return errors.New("no ACP session")
+	}
+	if err := sess.RespondToPermission(context.Background(), toolCallID, optionID); err != nil {
+		return err
+	}
+	broadcastPermissionResolved(sessionState, toolCallID, optionID)
+
+	r, err := m.srv.AppDB().GetPendingAgentApproval(sessionID, toolCallID)
+	if err != nil {
+		log.Warn().Err(err).Str("sessionId", sessionID).Str("toolCallId", toolCallID).Msg("failed to look up approval")
+	}
+	if r != nil {
+		status := db.ApprovalApproved
+		if kind := optionKind(r.Options, optionID); strings.HasPrefix(kind, "reject") {
+			status = db.ApprovalDenied
+		}
+		m.settleApproval(r, status, optionID, resolvedBy)
+	}
+	return nil
+}
+
+// broadcastPermissionResolved records the answer to a permission request in
+// the transcript, closing its permission card.
+func broadcastPermissionResolved(sessionState *agentsdk.SessionState, toolCallID, optionID string) {
+	if resolvedBytes, err := json.Marshal(map[string]any{
+		"type":       "permission.resolved",
+		"toolCallId": toolCallID,
+		"optionId":   optionID,
+	}); err == nil {
+		sessionState.AppendAndBroadcast(resolvedBytes)
+	}
+}
+
+// settleApproval records an approval's outcome and announces it.
+func (m *AgentManager) settleApproval(r *db.AgentApprovalRecord, status, optionID, resolvedBy string) {
+	ok, err := m.srv.AppDB().ResolveAgentApproval(context.Background(), r.ID, status, optionID, resolvedBy, db.NowMs())
+	if err != nil {
+		log.Warn().Err(err).Str("approvalId", r.ID).Msg("failed to record approval outcome")
+		return
+	}
+	if !ok {
+		return // someone else got there first
+	}
+	log.Info().
+		Str("sessionId", r.SessionID).
+		Str("approvalId", r.ID).
+		Str("status", status).
+		Str("resolvedBy", resolvedBy).
+		Msg("approval resolved")
+	m.notifService.NotifyAgentApproval(r.ID, r.SessionID, r.Title, "resolved")
+}
+
+// ResolveApproval answers an inbox entry. optionID picks one of the
+// request's options and must be of the decision's kind; when empty, the
+// first allow (approve) or reject (deny) option is used. Approving needs an
+// allow option; denying works without a reject option.
+func (m *AgentManager) ResolveApproval(id string, approve bool, optionID, resolvedBy string) (*db.AgentApprovalRecord, error) {
+	r, err := m.srv.AppDB().GetAgentApproval(id)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, errApprovalNotFound
+	}
+	if r.Status != db.ApprovalPending {
+		return r, errApprovalResolved
+	}
+	if optionID == "" {
+		optionID = pickOption(r.Options, approve)
+		if approve && optionID == "" {
+			return r, errors.New("the request has no allow option to approve with")
+		}
+	} else {
+		kind := optionKind(r.Options, optionID)
+		if kind == "" {
+			return r, errors.New("unknown optionId: " + optionID)
+		}
+		if isAllowOption(kind) != approve {
+			return r, errors.New("optionId " + optionID + " is a " + kind + " option, which contradicts the decision")
+		}
+	}
+
+	sessionState := m.PeekState(r.SessionID)
+	sess, live := m.GetSession(r.SessionID)
+	if sessionState == nil || !live {
+		m.settleApproval(r, db.ApprovalCancelled, "", resolvedBy)
+		return r, errApprovalStale
+	}
+	if optionID == "" {
+		// Denied, and the agent offered no reject option: cancelling this
+		// request is the only way to say no. Other requests keep waiting.
+		if err := sess.DenyPermission(context.Background(), r.ToolCallID); err != nil {
+			log.Warn().Err(err).Str("approvalId", id).Msg("approval no longer answerable")
+			m.settleApproval(r, db.ApprovalCancelled, "", resolvedBy)
+			return r, errApprovalStale
+		}
+		broadcastPermissionResolved(sessionState, r.ToolCallID, "")
+		m.settleApproval(r, db.ApprovalDenied, "", resolvedBy)
+	} else if err := m.RespondToPermission(r.SessionID, sessionState, r.ToolCallID, optionID, resolvedBy); err != nil {
+		// The agent stopped waiting (process gone, turn cancelled).
+		log.Warn().Err(err).Str("approvalId", id).Msg("approval no longer answerable")
+		m.settleApproval(r, db.ApprovalCancelled, "", resolvedBy)
+		return r, errApprovalStale
+	}
+	return m.srv.AppDB().GetAgentApproval(id)
+}
+
+// cancelSessionApprovals drops a session's pending approvals once the turn
+// that raised them is over — the agent is no longer waiting on them.
+func (m *AgentManager) cancelSessionApprovals(sessionID string) {
+	n, err := m.srv.AppDB().CancelPendingAgentApprovals(context.Background(), sessionID, db.NowMs())
+	if err != nil {
+		log.Warn().Err(err).Str("sessionId", sessionID).Msg("failed to cancel pending approvals")
+		return
+	}
+	if n > 0 {
+		log.Info().Str("sessionId", sessionID).Int64("count", n).Msg("cancelled approvals left pending by the finished turn")
+		m.notifService.NotifyAgentApproval("", sessionID, "", "resolved")
+	}
+}
+
+// StartApprovalSweeper applies the timeout policy to approvals nobody
+// answered in time. It runs until the server's shutdown context is
+// cancelled. Call once during startup.
+func (m *AgentManager) StartApprovalSweeper() {
+	go func() {
+		ticker := time.NewTicker(approvalSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.shutdownCtx.Done():
+				return
+			case <-ticker.C:
+				m.expireApprovals(time.Now())
+			}
+		}
+	}()
+}
+
+// expireApprovals resolves every approval whose timeout passed by now.
+func (m *AgentManager) expireApprovals(now time.Time) {
+	expired, err := m.srv.AppDB().ListExpiredAgentApprovals(now.UnixMilli())
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to list expired approvals")
+		return
+	}
+	for _, r := range expired {
+		// Approve-on-timeout falls back to deny when there is nothing to
+		// approve with.
+		approve := r.OnTimeout == agentrunner.OnTimeoutApprove && pickOption(r.Options, true) != ""
+		if _, err := m.ResolveApproval(r.ID, approve, "", "timeout"); err != nil && !errors.Is(err, errApprovalStale) {
+			log.Warn().Err(err).Str("approvalId", r.ID).Msg("failed to apply approval timeout")
+		}
+	}
+}
+
+// pickOption returns the first allow option (approve) or reject option
+// (deny) of a permission request, "" when there is none.
+func pickOption(options json.RawMessage, approve bool) string {
+	var opts []acp.PermissionOption
+	if json.Unmarshal(options, &opts) != nil {
+		return ""
+	}
+	want := []acp.PermissionOptionKind{acp.PermissionOptionKindRejectOnce, acp.PermissionOptionKindRejectAlways}
+	if approve {
+		want = []acp.PermissionOptionKind{acp.PermissionOptionKindAllowOnce, acp.PermissionOptionKindAllowAlways}
+	}
+	for _, kind := range want {
+		for _, o := range opts {
+			if o.Kind == kind {
+				return string(o.OptionId)
+			}
+		}
+	}
+	return ""
+}
+
+// isAllowOption reports whether an option kind approves the request.
+func isAllowOption(kind string) bool {
+	return kind == string(acp.PermissionOptionKindAllowOnce) || kind == string(acp.PermissionOptionKindAllowAlways)
+}
+
+// optionKind returns the kind of one of a permission request's options, ""
+// when optionID isn't among them.
+func optionKind(options json.RawMessage, optionID string) string {
+	var opts []acp.PermissionOption
+	if json.Unmarshal(options, &opts) != nil {
+		return ""
+	}
+	for _, o := range opts {
+		if string(o.OptionId) == optionID {
+			return string(o.Kind)
+		}
+	}
+	return ""
+}
+
+// ListAgentApprovals returns the approvals inbox, pending first by default.
+// GET /api/agent/approvals?status=pending|approved|denied|cancelled|all&limit=N
+func (h *Handlers) ListAgentApprovals(c *gin.Context) {
+	status := c.DefaultQuery("status", db.ApprovalPending)
+	if status == "all" {
+		status = ""
+	}
+	limit := 100
+	if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	// Members only see approvals for their own sessions; admins see all.
+	var userFilter *string
+	if user := CurrentUser(c); !user.IsAdmin() {
+		userFilter = &user.ID
+	}
+	approvals, err := h.server.AppDB().ListAgentApprovals(status, limit, userFilter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"approvals": approvals})
+}
+
+// approvalForRequest loads an approval the current user may act on, writing
+// the error response when there is none.
+func (h *Handlers) approvalForRequest(c *gin.Context) *db.AgentApprovalRecord {
+	r, err := h.server.AppDB().GetAgentApproval(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if r != nil && !CurrentUser(c).IsAdmin() {
+		if rec, _ := h.server.AppDB().GetAgentSession(r.SessionID); rec == nil || !canAccessAgentSession(c, rec) {
+			r = nil
+		}
+	}
+	if r == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "approval not found"})
+		return nil
+	}
+	return r
+}
+
+// GetAgentApproval returns one approval.
+// GET /api/agent/approvals/:id
+func (h *Handlers) GetAgentApproval(c *gin.Context) {
+	if r := h.approvalForRequest(c); r != nil {
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+// ResolveAgentApproval approves or denies a pending approval, resuming the
+// agent's turn.
+// POST /api/agent/approvals/:id  {"decision": "approve"|"deny", "optionId"?: string}
+func (h *Handlers) ResolveAgentApproval(c *gin.Context) {
+	var req struct {
+		Decision string `json:"decision"`
+		OptionID string `json:"optionId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Decision != "approve" && req.Decision != "deny" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `decision must be "approve" or "deny"`})
+		return
+	}
+	if h.approvalForRequest(c) == nil {
+		return
+	}
+
+	r, err := h.agentMgr.ResolveApproval(c.Param("id"), req.Decision == "approve", req.OptionID, "user")
+	switch {
+	case errors.Is(err, errApprovalResolved), errors.Is(err, errApprovalStale):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "approval": r})
+	case errors.Is(err, errApprovalNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil && r != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, r)
+	}
+}
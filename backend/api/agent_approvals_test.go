@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/agentrunner"
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+)
+
+const (
+	allowOptions     = `[{"optionId":"allow","name":"Allow","kind":"allow_once"}]`
+	allowDenyOptions = `[{"optionId":"allow","name":"Allow","kind":"allow_once"},{"optionId":"reject","name":"Reject","kind":"reject_once"}]`
+	rejectOptions    = `[{"optionId":"reject","name":"Reject","kind":"reject_once"}]`
+)
+
+// approvalsRouter serves the approvals API over m as user.
+func approvalsRouter(m *AgentManager, user *db.UserRecord) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := &Handlers{server: m.srv, agentMgr: m}
+	r := gin.New()
+	r.Use(func(c *gin.Context) { setCurrentUser(c, user) })
+	r.GET("/api/agent/approvals", h.ListAgentApprovals)
+	r.GET("/api/agent/approvals/:id", h.GetAgentApproval)
+	r.POST("/api/agent/approvals/:id", h.ResolveAgentApproval)
+	return r
+}
+
+// newGatedSession creates a gated session owned by userID with a live fake
+// agent.
+func newGatedSession(t *testing.T, m *AgentManager, sessionID, userID, onTimeout string) *fakeSession {
+	t.Helper()
+	createTestSession(t, m, sessionID, userID)
+	if err := m.srv.AppDB().SaveAgentSessionApprovalPolicy(context.Background(), sessionID, time.Hour.Milliseconds(), onTimeout); err != nil {
+		t.Fatal(err)
+	}
+	sess := newFakeSession(sessionID)
+	m.StoreSession(sessionID, sess)
+	m.GetOrCreateState(sessionID)
+	return sess
+}
+
+// requestApproval has the session's agent ask to run toolCallID and returns
+// the inbox entry it lands in.
+func requestApproval(t *testing.T, m *AgentManager, sessionID, toolCallID, options string) *db.AgentApprovalRecord {
+	t.Helper()
+	frame := fmt.Sprintf(`{"type":"permission.request","toolCall":{"toolCallId":%q,"title":"run %s"},"options":%s}`, toolCallID, toolCallID, options)
+	m.queueApproval(sessionID, []byte(frame))
+	r, err := m.srv.AppDB().GetPendingAgentApproval(sessionID, toolCallID)
+	if err != nil || r == nil {
+		t.Fatalf("approval for %s not queued: %v", toolCallID, err)
+	}
+	return r
+}
+
+func resolveApproval(t *testing.T, r *gin.Engine, id, decision string) (int, db.AgentApprovalRecord) {
+	t.Helper()
+	w := serveJSON(r, http.MethodPost, "/api/agent/approvals/"+id, gin.H{"decision": decision})
+	var got db.AgentApprovalRecord
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, got
+}
+
+func (f *fakeSession) answers() (responses, denied []string, cancelAll int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.responses...), append([]string(nil), f.denied...), f.cancelAll
+}
+
+func TestApprovals_Approve(t *testing.T) {
+	m := newTestAgentManager(t)
+	sess := newGatedSession(t, m, "s", db.OwnerUserID, agentrunner.OnTimeoutDeny)
+	pending := requestApproval(t, m, "s", "call-1", allowDenyOptions)
+	r := approvalsRouter(m, db.OwnerUser())
+
+	code, got := resolveApproval(t, r, pending.ID, "approve")
+	if code != http.StatusOK || got.Status != db.ApprovalApproved || got.OptionID != "allow" || got.ResolvedBy != "user" {
+		t.Fatalf("approve: status %d, approval %+v", code, got)
+	}
+	if responses, _, _ := sess.answers(); fmt.Sprint(responses) != "[call-1=allow]" {
+		t.Fatalf("agent answered %v", responses)
+	}
+	if code, _ := resolveApproval(t, r, pending.ID, "deny"); code != http.StatusConflict {
+		t.Fatalf("second answer: status %d, want 409", code)
+	}
+}
+
+func TestApprovals_Deny(t *testing.T) {
+	m := newTestAgentManager(t)
+	sess := newGatedSession(t, m, "s", db.OwnerUserID, agentrunner.OnTimeoutDeny)
+	withReject := requestApproval(t, m, "s", "call-1", allowDenyOptions)
+	allowOnly := requestApproval(t, m, "s", "call-2", allowOptions)
+	other := requestApproval(t, m, "s", "call-3", allowOptions)
+	r := approvalsRouter(m, db.OwnerUser())
+
+	// A reject option is picked when there is one.
+	code, got := resolveApproval(t, r, withReject.ID, "deny")
+	if code != http.StatusOK || got.Status != db.ApprovalDenied || got.OptionID != "reject" {
+		t.Fatalf("deny: status %d, approval %+v", code, got)
+	}
+
+	// Without one, only that request is refused; the others keep waiting.
+	code, got = resolveApproval(t, r, allowOnly.ID, "deny")
+	if code != http.StatusOK || got.Status != db.ApprovalDenied {
+		t.Fatalf("deny without reject option: status %d, approval %+v", code, got)
+	}
+	responses, denied, cancelAll := sess.answers()
+	if fmt.Sprint(responses) != "[call-1=reject]" || fmt.Sprint(denied) != "[call-2]" || cancelAll != 0 {
+		t.Fatalf("agent answered %v, denied %v, cancelled all %d times", responses, denied, cancelAll)
+	}
+	if still, _ := m.srv.AppDB().GetAgentApproval(other.ID); still.Status != db.ApprovalPending {
+		t.Fatalf("unrelated approval is %s, want pending", still.Status)
+	}
+}
+
+func TestApprovals_DecisionMustMatchOption(t *testing.T) {
+	m := newTestAgentManager(t)
+	sess := newGatedSession(t, m, "s", db.OwnerUserID, agentrunner.OnTimeoutApprove)
+	both := requestApproval(t, m, "s", "call-1", allowDenyOptions)
+	rejectOnly := requestApproval(t, m, "s", "call-2", rejectOptions)
+	r := approvalsRouter(m, db.OwnerUser())
+
+	for _, tt := range []struct {
+		id   string
+		body gin.H
+	}{
+		{both.ID, gin.H{"decision": "deny", "optionId": "allow"}},
+		{both.ID, gin.H{"decision": "approve", "optionId": "reject"}},
+		{rejectOnly.ID, gin.H{"decision": "approve"}},
+	} {
+		if w := serveJSON(r, http.MethodPost, "/api/agent/approvals/"+tt.id, tt.body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%v: status %d, want 400", tt.body, w.Code)
+		}
+	}
+	responses, denied, _ := sess.answers()
+	if len(responses) != 0 || len(denied) != 0 {
+		t.Fatalf("refused answers reached the agent: %v, denied %v", responses, denied)
+	}
+	for _, id := range []string{both.ID, rejectOnly.ID} {
+		if still, _ := m.srv.AppDB().GetAgentApproval(id); still.Status != db.ApprovalPending {
+			t.Fatalf("approval is %s after a refused answer, want pending", still.Status)
+		}
+	}
+
+	// Approve-on-timeout with nothing to approve with denies instead.
+	m.expireApprovals(time.Now().Add(time.Hour + time.Minute))
+	if got, _ := m.srv.AppDB().GetAgentApproval(rejectOnly.ID); got.Status != db.ApprovalDenied || got.OptionID != "reject" {
+		t.Fatalf("timed-out reject-only approval %+v, want denied with reject", got)
+	}
+}
+
+func TestApprovals_TimeoutAppliesPolicy(t *testing.T) {
+	m := newTestAgentManager(t)
+	approveSess := newGatedSession(t, m, "approve", db.OwnerUserID, agentrunner.OnTimeoutApprove)
+	denySess := newGatedSession(t, m, "deny", db.OwnerUserID, agentrunner.OnTimeoutDeny)
+	approve := requestApproval(t, m, "approve", "call-1", allowDenyOptions)
+	deny := requestApproval(t, m, "deny", "call-2", allowOptions)
+
+	// Not due yet: nothing happens.
+	m.expireApprovals(time.Now())
+	if r, _ := m.srv.AppDB().GetAgentApproval(approve.ID); r.Status != db.ApprovalPending {
+		t.Fatalf("approval resolved before its timeout: %s", r.Status)
+	}
+
+	m.expireApprovals(time.Now().Add(time.Hour + time.Minute))
+	for _, tt := range []struct {
+		id, status string
+	}{{approve.ID, db.ApprovalApproved}, {deny.ID, db.ApprovalDenied}} {
+		r, _ := m.srv.AppDB().GetAgentApproval(tt.id)
+		if r.Status != tt.status || r.ResolvedBy != "timeout" {
+			t.Fatalf("timed-out approval %+v, want %s by timeout", r, tt.status)
+		}
+	}
+	if responses, _, _ := approveSess.answers(); fmt.Sprint(responses) != "[call-1=allow]" {
+		t.Fatalf("approve-on-timeout agent answered %v", responses)
+	}
+	if _, denied, _ := denySess.answers(); fmt.Sprint(denied) != "[call-2]" {
+		t.Fatalf("deny-on-timeout agent denied %v", denied)
+	}
+}
+
+func TestApprovals_StaleWhenAgentGone(t *testing.T) {
+	m := newTestAgentManager(t)
+	newGatedSession(t, m, "s", db.OwnerUserID, agentrunner.OnTimeoutDeny)
+	pending := requestApproval(t, m, "s", "call-1", allowDenyOptions)
+	m.RemoveSession("s")
+
+	if code, _ := resolveApproval(t, approvalsRouter(m, db.OwnerUser()), pending.ID, "approve"); code != http.StatusConflict {
+		t.Fatalf("answer with no agent: status %d, want 409", code)
+	}
+	if r, _ := m.srv.AppDB().GetAgentApproval(pending.ID); r.Status != db.ApprovalCancelled {
+		t.Fatalf("approval is %s, want cancelled", r.Status)
+	}
+}
+
+func TestApprovals_MemberSeesOnlyOwnSessions(t *testing.T) {
+	m := newTestAgentManager(t)
+	newGatedSession(t, m, "owner-s", db.OwnerUserID, agentrunner.OnTimeoutDeny)
+	newGatedSession(t, m, "ann-s", "ann", agentrunner.OnTimeoutDeny)
+	ownerReq := requestApproval(t, m, "owner-s", "call-1", allowDenyOptions)
+	annReq := requestApproval(t, m, "ann-s", "call-2", allowDenyOptions)
+	ann := &db.UserRecord{ID: "ann", Username: "ann", Role: db.UserRoleMember, DataRoot: "members/ann"}
+
+	list := func(user *db.UserRecord) []string {
+		t.Helper()
+		w := serveJSON(approvalsRouter(m, user), http.MethodGet, "/api/agent/approvals", nil)
+		var resp struct {
+			Approvals []db.AgentApprovalRecord `json:"approvals"`
+		}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil {
+			t.Fatalf("list: status %d, body %s", w.Code, w.Body)
+		}
+		var ids []string
+		for _, a := range resp.Approvals {
+			ids = append(ids, a.SessionID)
+		}
+		return ids
+	}
+	if got := list(ann); fmt.Sprint(got) != "[ann-s]" {
+		t.Fatalf("member sees approvals of %v", got)
+	}
+	if got := list(db.OwnerUser()); len(got) != 2 {
+		t.Fatalf("owner sees approvals of %v", got)
+	}
+
+	r := approvalsRouter(m, ann)
+	if w := serveJSON(r, http.MethodGet, "/api/agent/approvals/"+ownerReq.ID, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("member reading another account's approval: status %d", w.Code)
+	}
+	if code, _ := resolveApproval(t, r, ownerReq.ID, "approve"); code != http.StatusNotFound {
+		t.Fatalf("member answering another account's approval: status %d", code)
+	}
+	if got, _ := m.srv.AppDB().GetAgentApproval(ownerReq.ID); got.Status != db.ApprovalPending {
+		t.Fatalf("another account's approval is %s, want pending", got.Status)
+	}
+	if code, got := resolveApproval(t, r, annReq.ID, "approve"); code != http.StatusOK || got.Status != db.ApprovalApproved {
+		t.Fatalf("member answering own approval: status %d, approval %+v", code, got)
+	}
+}
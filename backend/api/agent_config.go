@@ -167,11 +167,20 @@ var defaultConfigOptions = map[string][]configOption{
 // agent type, applying AGENT_MODELS rewrite rules: when the gateway has models
 // tagged for this agent the model dropdown is replaced; when no gateway models
 // match but AGENT_MODELS is otherwise set, the model option is dropped.
-// Returns nil for unknown agent types.
+//
+// Agents declared in the registry file have no static defaults; they get a
+// model dropdown when the gateway has models tagged for them, and nil
+// otherwise.
 func buildAgentConfigOptions(agentType string, allModels []server.AgentModelInfo) []configOption {
 	defaults, ok := defaultConfigOptions[agentType]
 	if !ok {
-		return nil
+		if len(server.FilterModelsForAgent(allModels, agentType)) == 0 {
+			return nil
+		}
+		defaults = []configOption{{
+			ID: "model", Category: "model", Name: "Model", Type: "select",
+			Description: "Model to use",
+		}}
 	}
 	opts := make([]configOption, len(defaults))
 	copy(opts, defaults)
@@ -241,14 +250,18 @@ func overlayPersistedConfigOptions(opts []configOption, persisted map[string]str
 }
 
 // GetAgentConfig returns agent configuration for the frontend.
-// Includes per-agent-type default configOptions. When AGENT_MODELS is
-// configured, replaces the model options for each agent type.
+// Includes per-agent-type default configOptions for every registered agent.
+// When AGENT_MODELS is configured, replaces the model options for each agent
+// type.
 func (h *Handlers) GetAgentConfig(c *gin.Context) {
 	cfg := h.server.Cfg()
 
-	result := make(map[string][]configOption, len(defaultConfigOptions))
-	for agentType := range defaultConfigOptions {
-		result[agentType] = buildAgentConfigOptions(agentType, cfg.AgentLLM.Models)
+	agents := h.server.AgentClient().AvailableAgents()
+	result := make(map[string][]configOption, len(agents))
+	for _, a := range agents {
+		if opts := buildAgentConfigOptions(string(a.Type), cfg.AgentLLM.Models); opts != nil {
+			result[string(a.Type)] = opts
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -25,6 +25,11 @@ func defToJSON(d *agentrunner.AgentDef, markdown string) gin.H {
 		"prompt":   d.Prompt,
 		"file":     d.File,
 	}
+	if d.Permissions == agentrunner.PermissionsGated {
+		resp["permissions"] = d.Permissions
+		resp["approvalTimeout"] = d.ApprovalWait().String()
+		resp["onTimeout"] = d.OnTimeout
+	}
 	if markdown != "" {
 		resp["markdown"] = markdown
 	}
@@ -9,10 +9,10 @@ import (
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 )
 
-// ListAgentSessionGroups returns all groups in sort order.
+// ListAgentSessionGroups returns the current account's groups in sort order.
 // GET /api/agent/groups
 func (h *Handlers) ListAgentSessionGroups(c *gin.Context) {
-	groups, err := h.server.AppDB().ListAgentSessionGroups()
+	groups, err := h.server.AppDB().ListAgentSessionGroups(CurrentUser(c).ID)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to list agent session groups")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list groups"})
@@ -39,7 +39,7 @@ func (h *Handlers) CreateAgentSessionGroup(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
 		return
 	}
-	g, err := h.server.AppDB().CreateAgentSessionGroup(c.Request.Context(), name)
+	g, err := h.server.AppDB().CreateAgentSessionGroup(c.Request.Context(), name, CurrentUser(c).ID)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to create agent session group")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create group"})
@@ -64,6 +64,9 @@ func (h *Handlers) UpdateAgentSessionGroup(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
 		return
 	}
+	if !h.ownGroup(c, id) {
+		return
+	}
 	if err := h.server.AppDB().RenameAgentSessionGroup(c.Request.Context(), id, name); err != nil {
 		log.Error().Err(err).Str("id", id).Msg("failed to rename group")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rename group"})
@@ -76,6 +79,9 @@ func (h *Handlers) UpdateAgentSessionGroup(c *gin.Context) {
 // DELETE /api/agent/groups/:id
 func (h *Handlers) DeleteAgentSessionGroup(c *gin.Context) {
 	id := c.Param("id")
+	if !h.ownGroup(c, id) {
+		return
+	}
 	if err := h.server.AppDB().DeleteAgentSessionGroup(c.Request.Context(), id); err != nil {
 		log.Error().Err(err).Str("id", id).Msg("failed to delete group")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete group"})
@@ -94,10 +100,26 @@ func (h *Handlers) ReorderAgentSessionGroups(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := h.server.AppDB().ReorderAgentSessionGroups(c.Request.Context(), req.IDs); err != nil {
+	if err := h.server.AppDB().ReorderAgentSessionGroups(c.Request.Context(), CurrentUser(c).ID, req.IDs); err != nil {
 		log.Error().Err(err).Msg("failed to reorder groups")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reorder groups"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
+
+// ownGroup reports whether group id belongs to the current account,
+// responding 404 (or 500) when it doesn't.
+func (h *Handlers) ownGroup(c *gin.Context, id string) bool {
+	g, err := h.server.AppDB().GetAgentSessionGroup(id)
+	if err != nil {
+		log.Error().Err(err).Str("id", id).Msg("failed to look up group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to look up group"})
+		return false
+	}
+	if g == nil || g.UserID != CurrentUser(c).ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return false
+	}
+	return true
+}
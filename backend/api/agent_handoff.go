@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+	"github.com/xiaoyuanzhu-com/my-life-db/server"
+)
+
+// Turns left running in the predecessor.
+//
+// After a handoff (server/handoff.go) the old process keeps running the
+// turns that were in flight until they finish; those sessions still have
+// is_processing=1 in the app DB. Here they are off limits until the
+// predecessor records the turn's outcome: prompts queue instead of
+// starting a turn, and no agent process is spawned, which would otherwise
+// run a second agent on the same conversation. Once the outcome is in, the
+// queue is dispatched as after any turn.
+//
+// The predecessor stops starting turns once it drains (see BeginDrain), but
+// it may start one while this process is still coming up. So until the
+// drain is over, is_processing is read from the DB whenever a session is
+// about to run here, not only for the sessions listed at startup.
+//
+// The predecessor's side: once draining, it starts no turns. Each session
+// socket is closed with 1012 (service restart) as soon as no turn runs on
+// it, and a prompt arriving meanwhile closes the socket unread; the
+// client's outbox sends it again after reconnecting — to this process.
+
+var errPredecessorTurn = errors.New("session is finishing a turn in the previous server process")
+
+const (
+	// predecessorPollInterval is how often the DB is checked for outcomes.
+	predecessorPollInterval = 2 * time.Second
+	// predecessorTurnTimeout releases sessions the predecessor never
+	// recorded an outcome for: by then it has stopped its remaining turns.
+	predecessorTurnTimeout = server.HandoffDrainTimeout + time.Minute
+)
+
+// TrackPredecessorTurns records the sessions with a turn in flight at
+// startup as running in the predecessor and watches for their outcomes,
+// and for turns the predecessor starts later, until it has drained.
+// Call once, before serving, in a process that took over from another.
+func (m *AgentManager) TrackPredecessorTurns() {
+	deadline := time.Now().Add(predecessorTurnTimeout)
+	m.predecessorMu.Lock()
+	m.predecessorUntil = deadline
+	m.predecessorMu.Unlock()
+	if n := m.trackPredecessorTurns(); n > 0 {
+		log.Info().Int("count", n).Msg("handoff: holding prompts for sessions still processing in the predecessor")
+	}
+	go m.watchPredecessorTurns(predecessorPollInterval, deadline)
+}
+
+// trackPredecessorTurns records the sessions with is_processing=1 that have
+// no turn running here and returns how many were added.
+func (m *AgentManager) trackPredecessorTurns() int {
+	ids, err := m.srv.AppDB().ListProcessingAgentSessionIDs()
+	if err != nil {
+		log.Warn().Err(err).Msg("handoff: failed to list sessions still processing in the predecessor")
+		return 0
+	}
+	added := 0
+	for _, id := range ids {
+		if !m.localTurn(id) && m.holdPredecessorTurn(id) {
+			added++
+		}
+	}
+	return added
+}
+
+// holdPredecessorTurn records a session as running in the predecessor;
+// false if it already was.
+func (m *AgentManager) holdPredecessorTurn(sessionID string) bool {
+	m.predecessorMu.Lock()
+	defer m.predecessorMu.Unlock()
+	if m.predecessorTurns[sessionID] {
+		return false
+	}
+	if m.predecessorTurns == nil {
+		m.predecessorTurns = map[string]bool{}
+	}
+	m.predecessorTurns[sessionID] = true
+	return true
+}
+
+// localTurn reports whether this process runs a turn for the session.
+func (m *AgentManager) localTurn(sessionID string) bool {
+	sessionState := m.PeekState(sessionID)
+	if sessionState == nil {
+		return false
+	}
+	sessionState.Mu.RLock()
+	defer sessionState.Mu.RUnlock()
+	return promptBusy(sessionState)
+}
+
+// predecessorRunning reports whether the session's turn is still running
+// in the predecessor. Until the predecessor has drained, a session marked
+// processing in the DB without a turn here is taken to be one.
+func (m *AgentManager) predecessorRunning(sessionID string) bool {
+	m.predecessorMu.Lock()
+	held := m.predecessorTurns[sessionID]
+	watching := time.Now().Before(m.predecessorUntil)
+	m.predecessorMu.Unlock()
+	if held || !watching {
+		return held
+	}
+	rec, err := m.srv.AppDB().GetAgentSession(sessionID)
+	if err != nil || rec == nil || !rec.IsProcessing || m.localTurn(sessionID) {
+		return false
+	}
+	if m.holdPredecessorTurn(sessionID) {
+		log.Info().Str("sessionId", sessionID).Msg("handoff: holding prompts for a turn the predecessor started after startup")
+	}
+	return true
+}
+
+// watchPredecessorTurns releases each tracked session once the predecessor
+// has recorded its outcome, or all of them at deadline. Until then it also
+// picks up turns the predecessor started after this process came up.
+func (m *AgentManager) watchPredecessorTurns(interval time.Duration, deadline time.Time) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-m.shutdownCtx.Done():
+			return
+		case <-tick.C:
+		}
+		expired := time.Now().After(deadline)
+		if !expired {
+			m.trackPredecessorTurns()
+		}
+		if m.checkPredecessorTurns(expired) == 0 && expired {
+			return
+		}
+	}
+}
+
+// checkPredecessorTurns releases the tracked sessions that are no longer
+// processing (all of them when expired, marking those interrupted) and
+// returns how many remain.
+func (m *AgentManager) checkPredecessorTurns(expired bool) int {
+	m.predecessorMu.Lock()
+	ids := make([]string, 0, len(m.predecessorTurns))
+	for id := range m.predecessorTurns {
+		ids = append(ids, id)
+	}
+	m.predecessorMu.Unlock()
+
+	remaining := 0
+	for _, id := range ids {
+		rec, err := m.srv.AppDB().GetAgentSession(id)
+		if err != nil {
+			log.Warn().Err(err).Str("sessionId", id).Msg("handoff: failed to check predecessor turn")
+			remaining++
+			continue
+		}
+		if rec != nil && rec.IsProcessing {
+			if !expired {
+				remaining++
+				continue
+			}
+			log.Warn().Str("sessionId", id).Msg("handoff: predecessor never recorded an outcome, marking interrupted")
+			if err := m.srv.AppDB().MarkTurnOutcome(context.Background(), id, db.OutcomeInterrupted, "", db.NowMs()); err != nil {
+				log.Warn().Err(err).Str("sessionId", id).Msg("handoff: failed to mark turn interrupted")
+			}
+		}
+		m.releasePredecessorTurn(id)
+	}
+	return remaining
+}
+
+// releasePredecessorTurn lets the session run here again and dispatches
+// whatever queued up behind the predecessor's turn.
+func (m *AgentManager) releasePredecessorTurn(sessionID string) {
+	m.predecessorMu.Lock()
+	delete(m.predecessorTurns, sessionID)
+	m.predecessorMu.Unlock()
+
+	queue, err := m.srv.AppDB().ListQueuedAgentPrompts(sessionID)
+	if err != nil || len(queue) == 0 {
+		return
+	}
+	sessionState := m.GetOrCreateState(sessionID)
+	// No client may be attached to bring the history in; the turn the
+	// predecessor just finished is on disk.
+	m.loadHistory(sessionID, sessionState)
+	log.Info().Str("sessionId", sessionID).Int("queued", len(queue)).Msg("handoff: predecessor turn done, dispatching queued prompts")
+	m.DispatchQueuedPrompt(sessionID, sessionState)
+}
+
+// BeginDrain stops this process from starting turns; clients are sent on
+// to the successor (agent_ws.go). Call once the successor is serving.
+func (m *AgentManager) BeginDrain() {
+	m.drainOnce.Do(func() {
+		log.Info().Msg("handoff: no new turns here; sending clients to the successor")
+		close(m.draining)
+	})
+}
+
+// Draining returns a channel that is closed once BeginDrain was called.
+func (m *AgentManager) Draining() <-chan struct{} { return m.draining }
+
+// isDraining reports whether BeginDrain was called.
+func (m *AgentManager) isDraining() bool {
+	select {
+	case <-m.draining:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/gin-gonic/gin"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/agentsdk"
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+)
+
+func TestPredecessorTurns_HoldPromptsUntilOutcome(t *testing.T) {
+	m := newTestAgentManager(t)
+	ctx := context.Background()
+	appDB := m.srv.AppDB()
+	for _, id := range []string{"busy", "stuck", "idle"} {
+		createTestSession(t, m, id, db.OwnerUserID)
+	}
+	// The predecessor is running turns on busy and stuck.
+	for _, id := range []string{"busy", "stuck"} {
+		if err := appDB.SetPromptInFlight(ctx, id, "before the handoff"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := m.trackPredecessorTurns(); n != 2 {
+		t.Fatalf("tracked %d sessions, want 2", n)
+	}
+
+	sess := newFakeSession("busy")
+	m.StoreSession("busy", sess)
+	state := m.GetOrCreateState("busy")
+
+	if !m.ShouldQueuePrompt("busy", state) {
+		t.Fatal("prompt for a session processing in the predecessor not queued")
+	}
+	if m.ShouldQueuePrompt("idle", m.GetOrCreateState("idle")) {
+		t.Fatal("prompt for an idle session queued")
+	}
+	if _, err := m.EnsureLiveSession("busy", state); !errors.Is(err, errPredecessorTurn) {
+		t.Fatalf("EnsureLiveSession = %v, want errPredecessorTurn", err)
+	}
+
+	if _, err := m.EnqueuePrompt(ctx, "busy", state, "follow-up", ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.checkPredecessorTurns(false); n != 2 {
+		t.Fatalf("%d sessions still held, want 2", n)
+	}
+	sess.noPrompt(t)
+
+	// The predecessor finishes busy: the queued prompt goes out here.
+	if err := appDB.MarkTurnOutcome(ctx, "busy", db.OutcomeCompleted, "", db.NowMs()); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.checkPredecessorTurns(false); n != 1 {
+		t.Fatalf("%d sessions still held, want 1", n)
+	}
+	if got := sess.nextPrompt(t); got != "follow-up" {
+		t.Fatalf("dispatched %q, want the queued follow-up", got)
+	}
+	sess.endTurn()
+
+	// stuck never gets an outcome: at the deadline it is released and
+	// marked interrupted.
+	if n := m.checkPredecessorTurns(true); n != 0 {
+		t.Fatalf("%d sessions still held after the deadline", n)
+	}
+	if m.predecessorRunning("stuck") {
+		t.Fatal("stuck still held after the deadline")
+	}
+	rec, err := appDB.GetAgentSession("stuck")
+	if err != nil || rec.IsProcessing || rec.LastTurnOutcome != db.OutcomeInterrupted {
+		t.Fatalf("stuck = %+v, %v; want interrupted", rec, err)
+	}
+}
+
+func TestPredecessorTurns_HoldTurnsStartedAfterStartup(t *testing.T) {
+	m := newTestAgentManager(t)
+	ctx := context.Background()
+	appDB := m.srv.AppDB()
+	for _, id := range []string{"late", "mine"} {
+		createTestSession(t, m, id, db.OwnerUserID)
+	}
+	// Nothing was processing at startup; the predecessor is still draining.
+	if n := m.trackPredecessorTurns(); n != 0 {
+		t.Fatalf("tracked %d sessions, want 0", n)
+	}
+	m.predecessorUntil = time.Now().Add(time.Hour)
+
+	// The predecessor starts a turn on late after this process came up.
+	if err := appDB.SetPromptInFlight(ctx, "late", "started during startup"); err != nil {
+		t.Fatal(err)
+	}
+	state := m.GetOrCreateState("late")
+	if !m.ShouldQueuePrompt("late", state) {
+		t.Fatal("prompt for a session processing in the predecessor not queued")
+	}
+	if _, err := m.EnsureLiveSession("late", state); !errors.Is(err, errPredecessorTurn) {
+		t.Fatalf("EnsureLiveSession = %v, want errPredecessorTurn", err)
+	}
+
+	// A turn this process runs is its own, not the predecessor's.
+	sess := newFakeSession("mine")
+	m.StoreSession("mine", sess)
+	mine := m.GetOrCreateState("mine")
+	if _, err := m.EnqueuePrompt(ctx, "mine", mine, "here", ""); err != nil {
+		t.Fatal(err)
+	}
+	sess.nextPrompt(t)
+	if n := m.trackPredecessorTurns(); n != 0 || m.predecessorRunning("mine") {
+		t.Fatalf("own turn taken for the predecessor's (tracked %d)", n)
+	}
+	sess.endTurn()
+
+	// Once the predecessor is done draining, the DB is not consulted.
+	m.predecessorUntil = time.Now()
+	if m.predecessorRunning("other") {
+		t.Fatal("session held after the drain window")
+	}
+}
+
+// dialAgentWS connects to a session's socket and returns the close status
+// the server ends it with.
+func dialAgentWS(t *testing.T, url, sessionID string) (*websocket.Conn, <-chan websocket.StatusCode) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(url, "http")+"/ws/"+sessionID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+	closed := make(chan websocket.StatusCode, 1)
+	go func() {
+		for {
+			if _, _, err := conn.Read(ctx); err != nil {
+				closed <- websocket.CloseStatus(err)
+				return
+			}
+		}
+	}()
+	return conn, closed
+}
+
+func waitClosed(t *testing.T, closed <-chan websocket.StatusCode, what string) {
+	t.Helper()
+	select {
+	case code := <-closed:
+		if code != websocket.StatusServiceRestart {
+			t.Fatalf("%s closed with %d, want 1012", what, code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s still open", what)
+	}
+}
+
+func stillOpen(t *testing.T, closed <-chan websocket.StatusCode, what string) {
+	t.Helper()
+	select {
+	case code := <-closed:
+		t.Fatalf("%s closed early (%d)", what, code)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestDrain_SendsClientsToSuccessor(t *testing.T) {
+	m, sess := newQueueTestSession(t)
+	ctx := context.Background()
+	createTestSession(t, m, "idle", db.OwnerUserID)
+	// Some history in memory, so connecting doesn't load any.
+	for _, id := range []string{"s", "idle"} {
+		m.GetOrCreateState(id).AppendAndBroadcast(agentsdk.SynthUserMessageChunk("earlier", ""))
+	}
+	state := m.GetOrCreateState("s")
+	if _, err := m.EnqueuePrompt(ctx, "s", state, "running", ""); err != nil {
+		t.Fatal(err)
+	}
+	sess.nextPrompt(t)
+	if _, err := m.EnqueuePrompt(ctx, "s", state, "queued", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	h := &Handlers{server: m.srv, agentMgr: m}
+	r := gin.New()
+	r.GET("/ws/:id", h.AgentSessionWebSocket)
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+	_, idleClosed := dialAgentWS(t, ts.URL, "idle")
+	prompter, prompterClosed := dialAgentWS(t, ts.URL, "s")
+	_, watcherClosed := dialAgentWS(t, ts.URL, "s")
+
+	m.BeginDrain()
+	waitClosed(t, idleClosed, "idle session's socket")
+	stillOpen(t, watcherClosed, "socket of the session mid-turn")
+
+	// A prompt sent now is neither run nor queued here.
+	prompt, _ := json.Marshal(map[string]any{
+		"type": "session.prompt", "messageId": "m1",
+		"content": []map[string]string{{"type": "text", "text": "during the drain"}},
+	})
+	if err := prompter.Write(ctx, websocket.MessageText, prompt); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, prompterClosed, "socket a prompt arrived on")
+	queue, err := m.srv.AppDB().ListQueuedAgentPrompts("s")
+	if err != nil || len(queue) != 1 || queue[0].Prompt != "queued" {
+		t.Fatalf("queue = %+v, %v; want only the prompt queued before the drain", queue, err)
+	}
+
+	// The turn ends: its clients go, and the queue is left to the successor.
+	sess.endTurn()
+	waitClosed(t, watcherClosed, "socket of the finished session")
+	sess.noPrompt(t)
+	if queue, _ := m.srv.AppDB().ListQueuedAgentPrompts("s"); len(queue) != 1 {
+		t.Fatalf("queue after the turn = %+v, want it left for the successor", queue)
+	}
+}
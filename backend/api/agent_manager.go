@@ -16,18 +16,6 @@ import (
 	"github.com/xiaoyuanzhu-com/my-life-db/server"
 )
 
-// resolveACPModel maps a MyLifeDB model value (e.g. "gpt-5.4") to the form
-// expected by the target ACP agent's SetModel RPC. Opencode resolves IDs as
-// <provider>/<modelID>; bare IDs silently no-op, so gateway-backed models
-// need the "litellm/" prefix (matching the provider block in
-// ~/.config/opencode/opencode.json). Other agents accept bare IDs.
-func resolveACPModel(agentType agentsdk.AgentType, modelID string) string {
-	if agentType == agentsdk.AgentOpencode && !strings.HasPrefix(modelID, "litellm/") {
-		return "litellm/" + modelID
-	}
-	return modelID
-}
-
 // AgentManager owns the in-memory state for active ACP agent sessions and
 // coordinates their lifecycle. Replaces the package-level globals
 // (acpSessions, agentSessionStates) and free functions (CreateSession,
@@ -44,6 +32,18 @@ type AgentManager struct {
 
 	statesMu sync.Mutex
 	states   map[string]*agentsdk.SessionState
+
+	queueMu sync.Mutex // serializes queued-prompt dispatch (agent_prompt_queue.go)
+
+	// Sessions whose turn is still running in the process this one took
+	// over from, and until when it may still be draining (agent_handoff.go).
+	predecessorMu    sync.Mutex
+	predecessorTurns map[string]bool
+	predecessorUntil time.Time
+
+	// Closed once this process hands over to a successor (agent_handoff.go).
+	draining  chan struct{}
+	drainOnce sync.Once
 }
 
 // NewAgentManager constructs a manager wired to the given server's components.
@@ -55,6 +55,7 @@ func NewAgentManager(srv *server.Server) *AgentManager {
 		shutdownCtx:  srv.ShutdownContext(),
 		sessions:     make(map[string]agentsdk.Session),
 		states:       make(map[string]*agentsdk.SessionState),
+		draining:     make(chan struct{}),
 	}
 }
 
@@ -101,78 +102,52 @@ func resolveSessionModel(persisted string, gatewayModels []server.AgentModelInfo
 	return gatewayModels[0].Value, true
 }
 
+// agentSpec returns the registry entry for an agent type; the zero config
+// (no model env, no capabilities) when it isn't registered.
+func (m *AgentManager) agentSpec(t agentsdk.AgentType) agentsdk.AgentConfig {
+	if m.agentClient == nil {
+		return agentsdk.AgentConfig{Type: t}
+	}
+	spec, _ := m.agentClient.Agent(t)
+	return spec
+}
+
 // BuildModelEnv returns the env var overrides needed so a freshly spawned
 // agent process boots with the chosen gateway model. Returns nil when the
 // model matches the agent type's default (gatewayModels[0]) — leaving env
-// untouched lets the agent fall through to the pre-warmed pool.
+// untouched keeps the session on the agent's base pre-warmed pool; any other
+// model is served by a per-model pool keyed on the returned env.
 //
 // Mirrors the inline env-build in CreateSession, factored out so lazy-spawn
 // paths in the WS handler can apply the same per-session model preference.
-// Opencode is intentionally absent: it reads its model from opencode.json, not
-// env vars.
+// Which env vars carry the model is the agent's ModelEnv/SmallModelEnv in the
+// registry; agents without one (opencode reads opencode.json) get nil.
 func (m *AgentManager) BuildModelEnv(agentType agentsdk.AgentType, model string, gatewayModels []server.AgentModelInfo) map[string]string {
 	if model == "" || len(gatewayModels) == 0 || model == gatewayModels[0].Value {
 		return nil
 	}
-	env := make(map[string]string, 2)
-	switch agentType {
-	case agentsdk.AgentClaudeCode:
-		env["ANTHROPIC_MODEL"] = model
-		smallModel := model
-		for _, mi := range gatewayModels {
-			if mi.Value == model {
-				if mi.ClaudeSmall != "" {
-					smallModel = mi.ClaudeSmall
-				}
-				break
-			}
+	smallModel := ""
+	for _, mi := range gatewayModels {
+		if mi.Value == model {
+			smallModel = mi.ClaudeSmall
+			break
 		}
-		env["ANTHROPIC_SMALL_FAST_MODEL"] = smallModel
-	case agentsdk.AgentCodex:
-		env["OPENAI_MODEL"] = model
-	case agentsdk.AgentQwen:
-		env["OPENAI_MODEL"] = model
-	case agentsdk.AgentGemini:
-		env["GEMINI_MODEL"] = model
 	}
+	env := m.agentSpec(agentType).ModelEnvFor(model, smallModel)
 	if len(env) == 0 {
 		return nil
 	}
 	return env
 }
 
-// agentTypeString converts the SDK enum to the string used in AGENT_MODELS
-// and DB records.
-func agentTypeString(t agentsdk.AgentType) string {
-	switch t {
-	case agentsdk.AgentCodex:
-		return "codex"
-	case agentsdk.AgentGemini:
-		return "gemini"
-	case agentsdk.AgentQwen:
-		return "qwen"
-	case agentsdk.AgentOpencode:
-		return "opencode"
-	default:
-		return "claude_code"
-	}
-}
-
-// parseAgentType converts the DB/AGENT_MODELS string back to the SDK enum.
-// Unknown strings fall back to Claude Code.
+// parseAgentType converts the DB/AGENT_MODELS string to the SDK type. Empty
+// means Claude Code; anything else is taken as-is and must be registered by
+// the time a process is spawned for it.
 func parseAgentType(s string) agentsdk.AgentType {
-	switch s {
-	case "codex":
-		return agentsdk.AgentCodex
-	case "gemini":
-		return agentsdk.AgentGemini
-	case "qwen":
-		return agentsdk.AgentQwen
-	case "opencode":
-		return agentsdk.AgentOpencode
-	default:
+	if s == "" {
 		return agentsdk.AgentClaudeCode
 	}
+	return agentsdk.AgentType(s)
 }
 
 // -------- Session map --------
@@ -323,6 +298,41 @@ func (m *AgentManager) reapIdleSessions(maxIdle time.Duration) {
 // already has frames in memory, LoadSession is called so the new agent
 // process inherits conversation memory.
 func (m *AgentManager) EnsureLiveSession(sessionID string, sessionState *agentsdk.SessionState) (agentsdk.Session, error) {
+	return m.ensureLiveSession(sessionID, sessionState, false)
+}
+
+// ResumeLiveSession is EnsureLiveSession for input that arrives with no
+// client attached (scheduled prompts), when the session may be cold: the
+// history is brought back from the frame store first, and a spawned agent
+// always reloads the conversation — if nothing was on disk, its replay
+// becomes the history.
+func (m *AgentManager) ResumeLiveSession(sessionID string, sessionState *agentsdk.SessionState) (agentsdk.Session, error) {
+	m.loadHistory(sessionID, sessionState)
+	return m.ensureLiveSession(sessionID, sessionState, true)
+}
+
+// loadHistory brings a cold session's history back from the frame store,
+// once, when nothing is in memory yet.
+func (m *AgentManager) loadHistory(sessionID string, sessionState *agentsdk.SessionState) {
+	if sessionState.MessageCount() > 0 || m.frameStore == nil {
+		return
+	}
+	sessionState.HistoryOnce.Do(func() {
+		frames, err := m.frameStore.Load(sessionID)
+		if err != nil {
+			log.Info().Err(err).Str("sessionId", sessionID).Msg("frame_store: load error before resuming session")
+			return
+		}
+		if len(frames) > 0 {
+			sessionState.LoadHistoricalFrames(frames)
+		}
+	})
+}
+
+func (m *AgentManager) ensureLiveSession(sessionID string, sessionState *agentsdk.SessionState, resume bool) (agentsdk.Session, error) {
+	if m.predecessorRunning(sessionID) {
+		return nil, errPredecessorTurn
+	}
 	if existing, ok := m.GetSession(sessionID); ok {
 		select {
 		case <-existing.Done():
@@ -339,7 +349,7 @@ func (m *AgentManager) EnsureLiveSession(sessionID string, sessionState *agentsd
 	}
 
 	agentType := parseAgentType(sessionRecord.AgentType)
-	agentTypeStr := agentTypeString(agentType)
+	agentTypeStr := string(agentType)
 	workDir := sessionRecord.WorkingDir
 	storageID := sessionRecord.StorageID
 	mode, _ := m.srv.AppDB().GetAgentSessionPermissionMode(sessionID)
@@ -349,29 +359,33 @@ func (m *AgentManager) EnsureLiveSession(sessionID string, sessionState *agentsd
 	defaultModel, _ := resolveSessionModel(persistedOpts["model"], gatewayModels)
 
 	log.Info().Str("sessionId", sessionID).Msg("no live ACP session, creating lazily")
-	sess, err := m.agentClient.CreateSession(m.shutdownCtx, agentsdk.SessionConfig{
+	cfg := agentsdk.SessionConfig{
 		Agent:        agentType,
 		Mode:         mode,
 		WorkingDir:   workDir,
 		Env:          m.BuildModelEnv(agentType, defaultModel, gatewayModels),
 		McpServers:   m.buildSessionMcpServers(storageID),
 		SystemPrompt: server.BuildAgentSystemPrompt(m.srv.Cfg().UserDataDir, storageID),
-	})
-	if err != nil {
-		return nil, err
 	}
 
 	// Restore conversation memory if frames already exist. Noop OnFrame for
 	// the duration of LoadSession so replayed frames don't dupe rawMessages
 	// or the on-disk JSONL — both already contain them. SetupACP below
-	// installs the real broadcasting handler.
-	if workDir != "" && sessionState.MessageCount() > 0 {
-		sess.SetOnFrame(func(_ []byte) {})
-		if err := sess.LoadSession(m.shutdownCtx, sessionID, workDir); err != nil {
-			log.Warn().Err(err).Str("sessionId", sessionID).Msg("LoadSession failed on lazy create — agent will start with empty memory")
-		} else {
-			log.Info().Str("sessionId", sessionID).Msg("LoadSession succeeded on lazy create — agent memory restored")
+	// installs the real broadcasting handler. A resume with no frames at
+	// all keeps the replay instead: it is the only copy of the history.
+	var sess agentsdk.Session
+	var err error
+	if workDir != "" && (resume || sessionState.MessageCount() > 0) {
+		onLoad := func(_ []byte) {}
+		if sessionState.MessageCount() == 0 {
+			onLoad = sessionState.AppendAndBroadcast
 		}
+		sess, err = m.agentClient.CreateSessionWithLoad(m.shutdownCtx, cfg, sessionID, onLoad)
+	} else {
+		sess, err = m.agentClient.CreateSession(m.shutdownCtx, cfg)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	m.SetupACP(sess, sessionID, mode, defaultModel)
@@ -492,7 +506,7 @@ func (m *AgentManager) AllRuntimeStates() map[string]SessionRuntimeState {
 // When gateway models are configured, model options in config_option_update
 // frames are rewritten so the UI only offers proxy-available models.
 func (m *AgentManager) SetupACP(sess agentsdk.Session, sessionID, mode, defaultModel string) *agentsdk.SessionState {
-	gatewayModels := m.GatewayModels(agentTypeString(sess.AgentType()))
+	gatewayModels := m.GatewayModels(string(sess.AgentType()))
 	sessionState := m.GetOrCreateState(sessionID)
 
 	// A fresh spawn always boots with the latest persisted config, so any
@@ -510,6 +524,7 @@ func (m *AgentManager) SetupACP(sess agentsdk.Session, sessionID, mode, defaultM
 		sessionState.TouchFrame()
 		sessionState.Mu.Unlock()
 		sessionState.AppendAndBroadcast(data)
+		m.queueApproval(sessionID, data)
 	})
 
 	if mode != "" {
@@ -518,7 +533,7 @@ func (m *AgentManager) SetupACP(sess agentsdk.Session, sessionID, mode, defaultM
 		}
 	}
 
-	// Model selection, per agent:
+	// Model selection, per agent (Capabilities.SetModel in the registry):
 	//
 	//   claude_code / codex / gemini:
 	//     The "model" session config option accepts arbitrary gateway-proxied
@@ -528,7 +543,7 @@ func (m *AgentManager) SetupACP(sess agentsdk.Session, sessionID, mode, defaultM
 	//
 	//   opencode:
 	//     Accepts any model declared in opencode.json's provider.litellm.models
-	//     block (see resolveACPModel for the "litellm/" prefix).
+	//     block; its registry ModelPrefix adds the "litellm/" provider.
 	//
 	//   qwen — SKIPPED:
 	//     qwen's session/set_model validates the modelId against an authType-
@@ -543,8 +558,9 @@ func (m *AgentManager) SetupACP(sess agentsdk.Session, sessionID, mode, defaultM
 	//     SetModel is redundant at session creation, and mid-session dropdown
 	//     changes won't take effect without respawning the process anyway.
 	//     We skip the call to avoid a misleading warning.
-	if defaultModel != "" && sess.AgentType() != agentsdk.AgentQwen {
-		modelForACP := resolveACPModel(sess.AgentType(), defaultModel)
+	spec := m.agentSpec(sess.AgentType())
+	if defaultModel != "" && spec.Capabilities.SetModel {
+		modelForACP := spec.ACPModel(defaultModel)
 		updatedOpts, err := sess.SetModel(context.Background(), modelForACP)
 		if err != nil {
 			log.Warn().Err(err).Str("sessionId", sessionID).Str("model", modelForACP).Msg("failed to set initial model")
@@ -566,14 +582,15 @@ func (m *AgentManager) SetupACP(sess agentsdk.Session, sessionID, mode, defaultM
 	if defaultModel != "" && persistedOpts["model"] != "" && persistedOpts["model"] != defaultModel {
 		effortOverride = ""
 	}
-	applyModelEffort(sess, sessionState, gatewayModels, defaultModel, sessionID, effortOverride)
+	m.applyModelEffort(sess, sessionState, gatewayModels, defaultModel, sessionID, effortOverride)
 
 	m.StoreSession(sessionID, sess)
 	return sessionState
 }
 
-// applyModelEffort pushes an "effort" config option into claude-agent-acp via
-// SetConfigOption. Used right after SetModel on both session boot and
+// applyModelEffort pushes an "effort" config option into the agent via
+// SetConfigOption, for agents whose registry entry declares Capabilities.Effort
+// (claude-agent-acp). Used right after SetModel on both session boot and
 // mid-session model changes.
 //
 // When override is non-empty (e.g. a value persisted from a previous run via
@@ -581,7 +598,7 @@ func (m *AgentManager) SetupACP(sess agentsdk.Session, sessionID, mode, defaultM
 // Otherwise the per-model Effort from AGENT_MODELS is used.
 //
 // Returns the effort string actually applied, or "" when nothing was sent
-// (non-claude_code agent, empty modelValue, or no effort to apply). Callers
+// (agent without the capability, empty modelValue, or no effort to apply). Callers
 // use this to keep config_options in sync with what the agent is running.
 //
 // Background: claude-agent-acp defaults Opus to effort="xhigh". Not every
@@ -595,8 +612,8 @@ func (m *AgentManager) SetupACP(sess agentsdk.Session, sessionID, mode, defaultM
 // config_option_update frame because claude-agent-acp returns the new state
 // inline rather than emitting a session/update notification — same trick the
 // user-triggered setConfigOption handler uses to keep the UI in sync.
-func applyModelEffort(sess agentsdk.Session, sessionState *agentsdk.SessionState, gatewayModels []server.AgentModelInfo, modelValue, sessionID, override string) string {
-	if sess.AgentType() != agentsdk.AgentClaudeCode || modelValue == "" {
+func (m *AgentManager) applyModelEffort(sess agentsdk.Session, sessionState *agentsdk.SessionState, gatewayModels []server.AgentModelInfo, modelValue, sessionID, override string) string {
+	if !m.agentSpec(sess.AgentType()).Capabilities.Effort || modelValue == "" {
 		return ""
 	}
 	effort := override
@@ -814,14 +831,14 @@ func (m *AgentManager) CreateSession(ctx context.Context, params SessionParams)
 	// vars the agent process would normally inherit from the pre-warmed pool.
 	// Keeps the spawned process's ANTHROPIC_MODEL / ANTHROPIC_SMALL_FAST_MODEL
 	// (or OPENAI_MODEL / GEMINI_MODEL) consistent with the session's selected
-	// model. A non-empty Env also causes the pool to be skipped — pool env is
-	// baked at process spawn and can't be changed post-hoc.
+	// model. Pool env is baked at process spawn, so a non-empty Env routes the
+	// session to the per-model pool for that env instead of the base pool.
 	//
 	// Note for qwen: OPENAI_MODEL is the *only* reliable way to pick a gateway
 	// model. qwen's ACP session/set_model rejects unknown names (see SetupACP);
 	// it auto-captures a RuntimeModelSnapshot from env+creds on boot instead.
-	// opencode is missing from the switch because opencode reads its model
-	// from opencode.json, not env vars.
+	// opencode declares no ModelEnv because it reads its model from
+	// opencode.json, not env vars.
 	sessionEnv := m.BuildModelEnv(agentType, params.DefaultModel, gatewayModels)
 
 	storageID := params.StorageID
@@ -848,7 +865,7 @@ func (m *AgentManager) CreateSession(ctx context.Context, params SessionParams)
 
 	sessionID := sess.ID()
 
-	if err := m.srv.AppDB().CreateAgentSession(ctx, sessionID, agentTypeStr, params.WorkingDir, params.Title, params.Source, params.AgentName, params.TriggerKind, params.TriggerData, storageID); err != nil {
+	if err := m.srv.AppDB().CreateAgentSession(ctx, sessionID, agentTypeStr, params.WorkingDir, params.Title, params.Source, params.AgentName, params.TriggerKind, params.TriggerData, storageID, params.UserID); err != nil {
 		log.Error().Err(err).Msg("failed to create agent session in DB")
 		sess.Close()
 		return nil, err
@@ -858,6 +875,16 @@ func (m *AgentManager) CreateSession(ctx context.Context, params SessionParams)
 		m.srv.AppDB().SaveAgentSessionPermissionMode(ctx, sessionID, params.PermissionMode)
 	}
 
+	// Gate before SetupACP: the frame hook reads the policy from the DB, and
+	// the first permission request can arrive with the first prompt.
+	if params.Approval != nil {
+		if err := m.srv.AppDB().SaveAgentSessionApprovalPolicy(ctx, sessionID, params.Approval.Timeout.Milliseconds(), params.Approval.OnTimeout); err != nil {
+			log.Error().Err(err).Str("sessionId", sessionID).Msg("failed to persist approval policy")
+			sess.Close()
+			return nil, err
+		}
+	}
+
 	// Persist the model so a server restart can resume the session on the same
 	// one. Without this, the lazy-spawn path in ensureLiveACPSession sees an
 	// empty config_options["model"] and falls back to gatewayModels[0], then
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	acp "github.com/coder/acp-go-sdk"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/agentsdk"
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/server"
+)
+
+// openTestAppDB opens a migrated app DB in a temp dir.
+func openTestAppDB(t *testing.T) *db.DB {
+	t.Helper()
+	d, err := db.Open(db.Config{
+		Path:         filepath.Join(t.TempDir(), "app.sqlite"),
+		Role:         db.DBRoleApp,
+		MaxOpenConns: 4,
+		MaxIdleConns: 2,
+	})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+	if err := d.StartWriter(db.WriterConfig{}); err != nil {
+		t.Fatalf("StartWriter: %v", err)
+	}
+	return d
+}
+
+// newTestAgentManager returns a manager over a fresh app DB, with no agent
+// client: tests put fakeSessions in place of agent processes.
+func newTestAgentManager(t *testing.T) *AgentManager {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	srv := server.NewForTesting(ctx, &server.Config{UserDataDir: t.TempDir()}, openTestAppDB(t))
+	return NewAgentManager(srv)
+}
+
+// createTestSession inserts a session record owned by userID.
+func createTestSession(t *testing.T, m *AgentManager, sessionID, userID string) {
+	t.Helper()
+	if err := m.srv.AppDB().CreateAgentSession(context.Background(), sessionID, "claude_code", t.TempDir(), "", "user", "", "", "", "stor-"+sessionID, userID); err != nil {
+		t.Fatalf("CreateAgentSession: %v", err)
+	}
+}
+
+// fakeSession is an agentsdk.Session standing in for an agent process.
+// Every Send is reported on prompts; the turn stays open until endTurn.
+type fakeSession struct {
+	id      string
+	prompts chan string
+	turns   chan chan []byte
+	done    chan struct{}
+
+	mu        sync.Mutex
+	responses []string // toolCallID=optionID, in order
+	denied    []string // DenyPermission toolCallIDs, in order
+	cancelAll int      // CancelAllPermissions calls
+}
+
+func newFakeSession(id string) *fakeSession {
+	return &fakeSession{
+		id:      id,
+		prompts: make(chan string, 16),
+		turns:   make(chan chan []byte, 16),
+		done:    make(chan struct{}),
+	}
+}
+
+func (f *fakeSession) Send(ctx context.Context, prompt string) (<-chan []byte, error) {
+	events := make(chan []byte, 16)
+	f.turns <- events
+	f.prompts <- prompt
+	return events, nil
+}
+
+// nextPrompt waits for the next Send.
+func (f *fakeSession) nextPrompt(t *testing.T) string {
+	t.Helper()
+	select {
+	case p := <-f.prompts:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("no prompt sent to the agent")
+		return ""
+	}
+}
+
+// noPrompt checks that nothing was sent to the agent within a short wait.
+func (f *fakeSession) noPrompt(t *testing.T) {
+	t.Helper()
+	select {
+	case p := <-f.prompts:
+		t.Fatalf("unexpected prompt sent to the agent: %q", p)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// endTurn completes the oldest open turn.
+func (f *fakeSession) endTurn() {
+	close(<-f.turns)
+}
+
+func (f *fakeSession) LoadSession(context.Context, string, string) error { return nil }
+
+func (f *fakeSession) RespondToPermission(_ context.Context, toolCallID, optionID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, toolCallID+"="+optionID)
+	return nil
+}
+
+func (f *fakeSession) DenyPermission(_ context.Context, toolCallID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.denied = append(f.denied, toolCallID)
+	return nil
+}
+
+func (f *fakeSession) CancelAllPermissions() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelAll++
+}
+
+func (f *fakeSession) SetMode(context.Context, string) error { return nil }
+
+func (f *fakeSession) SetModel(context.Context, string) ([]acp.SessionConfigOption, error) {
+	return nil, nil
+}
+
+func (f *fakeSession) SetConfigOption(context.Context, string, string) ([]acp.SessionConfigOption, error) {
+	return nil, nil
+}
+
+func (f *fakeSession) Stop() error                   { return nil }
+func (f *fakeSession) SetOnFrame(func([]byte))       {}
+func (f *fakeSession) Close() error                  { return nil }
+func (f *fakeSession) Done() <-chan struct{}         { return f.done }
+func (f *fakeSession) ID() string                    { return f.id }
+func (f *fakeSession) AgentType() agentsdk.AgentType { return agentsdk.AgentClaudeCode }
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/agentsdk"
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// Follow-up prompt queue.
+//
+// A prompt that arrives while the session's agent is mid-turn is queued in
+// the app DB (agent_prompt_queue) instead of cancelling the running turn.
+// When a turn completes normally RunPromptTurn dispatches the head of the
+// queue as the next turn; session.cancel/kill flush the queue, handing the
+// flushed prompts back to the client so nothing typed is lost. Errored
+// turns leave the queue alone — the next prompt the user sends lines up
+// behind it and restarts dispatch.
+//
+// Every change is announced with a prompt.queue frame carrying the whole
+// queue. The frame is ephemeral (BroadcastToClients, never in the frame
+// store); session.info carries the current queue on connect.
+
+// errEmptyQueuedPrompt rejects an edit that would leave a queued prompt
+// with nothing to send.
+var errEmptyQueuedPrompt = errors.New("prompt text is required")
+
+// promptBusy reports whether a turn is running or registered to start.
+// Caller must hold sessionState.Mu.RLock() or Mu.Lock().
+func promptBusy(sessionState *agentsdk.SessionState) bool {
+	return sessionState.IsProcessing() || sessionState.PromptDone != nil
+}
+
+// ShouldQueuePrompt reports whether a new prompt for the session must wait
+// in the queue: a turn is in flight — here or, after a handoff, in the
+// predecessor — or earlier prompts are still queued (which keeps them in
+// order).
+func (m *AgentManager) ShouldQueuePrompt(sessionID string, sessionState *agentsdk.SessionState) bool {
+	if m.predecessorRunning(sessionID) {
+		return true
+	}
+	sessionState.Mu.RLock()
+	busy := promptBusy(sessionState)
+	sessionState.Mu.RUnlock()
+	if busy {
+		return true
+	}
+	queue, err := m.srv.AppDB().ListQueuedAgentPrompts(sessionID)
+	return err == nil && len(queue) > 0
+}
+
+// EnqueuePrompt queues a follow-up prompt and announces the new queue. When
+// the session is idle (the queue was left over from an errored turn or a
+// restart) dispatch starts right away.
+func (m *AgentManager) EnqueuePrompt(ctx context.Context, sessionID string, sessionState *agentsdk.SessionState, promptText, messageID string) (*db.QueuedPromptRecord, error) {
+	rec, err := m.srv.AppDB().EnqueueAgentPrompt(ctx, sessionID, promptText, messageID)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("sessionId", sessionID).Str("queueId", rec.ID).Int("promptLen", len(promptText)).Msg("prompt queued behind the running turn")
+	m.BroadcastPromptQueue(sessionID, sessionState, nil)
+
+	sessionState.Mu.RLock()
+	busy := promptBusy(sessionState)
+	sessionState.Mu.RUnlock()
+	if !busy {
+		go m.DispatchQueuedPrompt(sessionID, sessionState)
+	}
+	return rec, nil
+}
+
+// BroadcastPromptQueue sends the session's current queue to connected
+// clients. flushed, when non-empty, lists prompts just dropped by a cancel
+// so the client can offer them back for editing.
+func (m *AgentManager) BroadcastPromptQueue(sessionID string, sessionState *agentsdk.SessionState, flushed []db.QueuedPromptRecord) {
+	queue, err := m.srv.AppDB().ListQueuedAgentPrompts(sessionID)
+	if err != nil {
+		log.Warn().Err(err).Str("sessionId", sessionID).Msg("failed to list prompt queue")
+		return
+	}
+	frame := map[string]any{
+		"type":  "prompt.queue",
+		"items": queue,
+	}
+	if len(flushed) > 0 {
+		frame["flushed"] = flushed
+	}
+	if data, err := json.Marshal(frame); err == nil {
+		sessionState.BroadcastToClients(data)
+	}
+}
+
+// FlushPromptQueue drops the session's queue after a user stop and tells
+// clients what was dropped.
+func (m *AgentManager) FlushPromptQueue(sessionID string, sessionState *agentsdk.SessionState) {
+	flushed, err := m.srv.AppDB().ClearAgentPromptQueue(context.Background(), sessionID)
+	if err != nil {
+		log.Warn().Err(err).Str("sessionId", sessionID).Msg("failed to flush prompt queue")
+		return
+	}
+	if len(flushed) == 0 {
+		return
+	}
+	log.Info().Str("sessionId", sessionID).Int("count", len(flushed)).Msg("flushed prompt queue on stop")
+	m.BroadcastPromptQueue(sessionID, sessionState, flushed)
+}
+
+// DispatchQueuedPrompt starts the head of the session's queue as a new turn
+// if the session is idle. Safe to call at any time: it does nothing when a
+// turn is running (that turn dispatches on completion, or, for a turn left
+// running in the predecessor, watchPredecessorTurns does), the queue is
+// empty, or this process is handing over to a successor, which dispatches
+// the queue once the turn here has finished.
+func (m *AgentManager) DispatchQueuedPrompt(sessionID string, sessionState *agentsdk.SessionState) {
+	// Serializes the idle check, the pop and the prompt registration, so two
+	// dispatchers can't both find the session idle and start turns out of
+	// order.
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+
+	if m.isDraining() || m.predecessorRunning(sessionID) {
+		return
+	}
+	sessionState.Mu.RLock()
+	busy := promptBusy(sessionState)
+	sessionState.Mu.RUnlock()
+	if busy {
+		return
+	}
+
+	rec, err := m.srv.AppDB().PopQueuedAgentPrompt(context.Background(), sessionID)
+	if err != nil {
+		log.Warn().Err(err).Str("sessionId", sessionID).Msg("failed to pop prompt queue")
+		return
+	}
+	if rec == nil {
+		return
+	}
+	m.BroadcastPromptQueue(sessionID, sessionState, nil)
+
+	if err := m.srv.AppDB().TouchAgentSession(context.Background(), sessionID); err != nil {
+		log.Warn().Err(err).Str("sessionId", sessionID).Msg("failed to touch agent session")
+	}
+	sessionState.AppendAndBroadcast(agentsdk.SynthUserMessageChunk(rec.Prompt, rec.MessageID))
+
+	acpSession, err := m.EnsureLiveSession(sessionID, sessionState)
+	if err != nil || acpSession == nil {
+		msg := "Session not found"
+		if err != nil {
+			msg = "Failed to create agent session: " + err.Error()
+		}
+		log.Error().Err(err).Str("sessionId", sessionID).Msg("failed to ensure live ACP session for queued prompt")
+		if dbErr := m.srv.AppDB().MarkTurnOutcome(context.Background(), sessionID, db.OutcomeErrored, msg, db.NowMs()); dbErr != nil {
+			log.Warn().Err(dbErr).Str("sessionId", sessionID).Msg("failed to persist errored outcome")
+		}
+		if errBytes, mErr := json.Marshal(map[string]any{
+			"type": "error", "message": msg, "code": "SESSION_ERROR",
+		}); mErr == nil {
+			sessionState.AppendAndBroadcast(errBytes)
+		}
+		return
+	}
+
+	promptCtx, pCancel := context.WithCancel(m.shutdownCtx)
+	done := make(chan struct{})
+	sessionState.Mu.Lock()
+	sessionState.RegisterPrompt(done, pCancel)
+	sessionState.Mu.Unlock()
+
+	if err := m.srv.AppDB().SetPromptInFlight(context.Background(), sessionID, rec.Prompt); err != nil {
+		log.Warn().Err(err).Str("sessionId", sessionID).Msg("failed to set prompt in-flight in DB")
+	}
+
+	log.Info().Str("sessionId", sessionID).Str("queueId", rec.ID).Int("promptLen", len(rec.Prompt)).Msg("dispatching queued prompt")
+	go m.RunPromptTurn(promptCtx, pCancel, done, acpSession, sessionState, sessionID, rec.Prompt, "queue")
+}
+
+// EditQueuedPrompt replaces the text of a queued prompt and announces the
+// queue. Returns false when the prompt was already sent or removed, and
+// errEmptyQueuedPrompt for blank text, which leaves the prompt as it was.
+func (m *AgentManager) EditQueuedPrompt(ctx context.Context, sessionID string, sessionState *agentsdk.SessionState, queueID, promptText string) (bool, error) {
+	if strings.TrimSpace(promptText) == "" {
+		// Clients edit optimistically; resync them to the stored text.
+		m.BroadcastPromptQueue(sessionID, sessionState, nil)
+		return false, errEmptyQueuedPrompt
+	}
+	found, err := m.srv.AppDB().UpdateQueuedAgentPrompt(ctx, sessionID, queueID, promptText)
+	if err != nil {
+		return false, err
+	}
+	// Broadcast even when it's gone, so a stale client resyncs.
+	m.BroadcastPromptQueue(sessionID, sessionState, nil)
+	return found, nil
+}
+
+// RemoveQueuedPrompt drops one queued prompt and announces the queue.
+// Returns false when the prompt was already sent or removed.
+func (m *AgentManager) RemoveQueuedPrompt(ctx context.Context, sessionID string, sessionState *agentsdk.SessionState, queueID string) (bool, error) {
+	found, err := m.srv.AppDB().DeleteQueuedAgentPrompt(ctx, sessionID, queueID)
+	if err != nil {
+		return false, err
+	}
+	m.BroadcastPromptQueue(sessionID, sessionState, nil)
+	return found, nil
+}
+
+// ClearPromptQueue drops every queued prompt at the user's request.
+func (m *AgentManager) ClearPromptQueue(ctx context.Context, sessionID string, sessionState *agentsdk.SessionState) error {
+	if _, err := m.srv.AppDB().ClearAgentPromptQueue(ctx, sessionID); err != nil {
+		return err
+	}
+	m.BroadcastPromptQueue(sessionID, sessionState, nil)
+	return nil
+}
+
+// GetAgentPromptQueue returns the session's queued follow-up prompts.
+// GET /api/agent/sessions/:id/queue
+func (h *Handlers) GetAgentPromptQueue(c *gin.Context) {
+	queue, err := h.server.AppDB().ListQueuedAgentPrompts(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": queue})
+}
+
+// UpdateQueuedAgentPrompt edits the text of a queued prompt.
+// PATCH /api/agent/sessions/:id/queue/:queueId
+func (h *Handlers) UpdateQueuedAgentPrompt(c *gin.Context) {
+	var req struct {
+		Text string `json:"text" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sessionID := c.Param("id")
+	found, err := h.agentMgr.EditQueuedPrompt(c.Request.Context(), sessionID, h.agentMgr.GetOrCreateState(sessionID), c.Param("queueId"), req.Text)
+	if errors.Is(err, errEmptyQueuedPrompt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "queued prompt not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// DeleteQueuedAgentPrompt removes a queued prompt.
+// DELETE /api/agent/sessions/:id/queue/:queueId
+func (h *Handlers) DeleteQueuedAgentPrompt(c *gin.Context) {
+	sessionID := c.Param("id")
+	found, err := h.agentMgr.RemoveQueuedPrompt(c.Request.Context(), sessionID, h.agentMgr.GetOrCreateState(sessionID), c.Param("queueId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "queued prompt not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// ClearAgentPromptQueue removes every queued prompt.
+// DELETE /api/agent/sessions/:id/queue
+func (h *Handlers) ClearAgentPromptQueue(c *gin.Context) {
+	sessionID := c.Param("id")
+	if err := h.agentMgr.ClearPromptQueue(c.Request.Context(), sessionID, h.agentMgr.GetOrCreateState(sessionID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+)
+
+// newQueueTestSession returns a manager with one session backed by a fake
+// agent.
+func newQueueTestSession(t *testing.T) (*AgentManager, *fakeSession) {
+	t.Helper()
+	m := newTestAgentManager(t)
+	createTestSession(t, m, "s", db.OwnerUserID)
+	sess := newFakeSession("s")
+	m.StoreSession("s", sess)
+	return m, sess
+}
+
+func TestPromptQueue_DispatchesInOrderOnTurnComplete(t *testing.T) {
+	m, sess := newQueueTestSession(t)
+	ctx := context.Background()
+	state := m.GetOrCreateState("s")
+
+	// Idle with an empty queue: the prompt starts right away.
+	if m.ShouldQueuePrompt("s", state) {
+		t.Fatal("prompt for an idle session queued")
+	}
+	if _, err := m.EnqueuePrompt(ctx, "s", state, "first", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := sess.nextPrompt(t); got != "first" {
+		t.Fatalf("started %q, want first", got)
+	}
+
+	if !m.ShouldQueuePrompt("s", state) {
+		t.Fatal("prompt during a turn not queued")
+	}
+	for _, p := range []string{"second", "third"} {
+		if _, err := m.EnqueuePrompt(ctx, "s", state, p, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sess.noPrompt(t)
+
+	// Each turn.complete starts the next queued prompt, oldest first.
+	for _, want := range []string{"second", "third"} {
+		sess.endTurn()
+		if got := sess.nextPrompt(t); got != want {
+			t.Fatalf("dispatched %q, want %q", got, want)
+		}
+	}
+	sess.endTurn()
+	sess.noPrompt(t)
+}
+
+func TestPromptQueue_LeftoverQueueKeepsOrder(t *testing.T) {
+	m, sess := newQueueTestSession(t)
+	state := m.GetOrCreateState("s")
+
+	// A queue left over from an errored turn: a new prompt lines up behind
+	// it even though nothing is running.
+	if _, err := m.srv.AppDB().EnqueueAgentPrompt(context.Background(), "s", "leftover", ""); err != nil {
+		t.Fatal(err)
+	}
+	if !m.ShouldQueuePrompt("s", state) {
+		t.Fatal("prompt jumped a non-empty queue")
+	}
+	if _, err := m.EnqueuePrompt(context.Background(), "s", state, "new", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := sess.nextPrompt(t); got != "leftover" {
+		t.Fatalf("dispatched %q, want the leftover prompt first", got)
+	}
+	sess.endTurn()
+	if got := sess.nextPrompt(t); got != "new" {
+		t.Fatalf("dispatched %q, want new", got)
+	}
+	sess.endTurn()
+}
+
+func TestPromptQueue_FlushedOnStop(t *testing.T) {
+	m, sess := newQueueTestSession(t)
+	ctx := context.Background()
+	state := m.GetOrCreateState("s")
+
+	if _, err := m.EnqueuePrompt(ctx, "s", state, "running", ""); err != nil {
+		t.Fatal(err)
+	}
+	sess.nextPrompt(t)
+	for _, p := range []string{"a", "b"} {
+		if _, err := m.EnqueuePrompt(ctx, "s", state, p, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// What session.cancel and session.kill do: mark the turn stopped,
+	// record the outcome, flush the queue.
+	state.Mu.Lock()
+	state.Killed = true
+	state.SetProcessing(false, "test-cancel")
+	state.Mu.Unlock()
+	if err := m.srv.AppDB().MarkTurnOutcome(ctx, "s", db.OutcomeCancelled, "", db.NowMs()); err != nil {
+		t.Fatal(err)
+	}
+	m.FlushPromptQueue("s", state)
+
+	queue, err := m.srv.AppDB().ListQueuedAgentPrompts("s")
+	if err != nil || len(queue) != 0 {
+		t.Fatalf("queue after stop = %v, %v", queue, err)
+	}
+	var flushed []string
+	for _, raw := range state.GetRecentMessages(0) {
+		var frame struct {
+			Type    string                  `json:"type"`
+			Flushed []db.QueuedPromptRecord `json:"flushed"`
+		}
+		if json.Unmarshal(raw, &frame) == nil && frame.Type == "prompt.queue" && len(frame.Flushed) > 0 {
+			for _, f := range frame.Flushed {
+				flushed = append(flushed, f.Prompt)
+			}
+		}
+	}
+	if fmt.Sprint(flushed) != "[a b]" {
+		t.Fatalf("flushed prompts handed back = %v, want [a b]", flushed)
+	}
+
+	// The stopped turn unwinding does not start anything.
+	sess.endTurn()
+	sess.noPrompt(t)
+}
+
+func TestPromptQueue_ConcurrentDispatchKeepsOrder(t *testing.T) {
+	m, sess := newQueueTestSession(t)
+	ctx := context.Background()
+	state := m.GetOrCreateState("s")
+
+	// Dispatchers racing the enqueues must never start two turns at once
+	// or send a prompt out of order.
+	const n = 20
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					m.DispatchQueuedPrompt("s", state)
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if _, err := m.EnqueuePrompt(ctx, "s", state, fmt.Sprint(i), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if got := sess.nextPrompt(t); got != fmt.Sprint(i) {
+			t.Fatalf("prompt %d sent as %q", i, got)
+		}
+		sess.noPrompt(t) // one turn at a time
+		sess.endTurn()
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestPromptQueue_EditRejectsEmptyText(t *testing.T) {
+	m, _ := newQueueTestSession(t)
+	ctx := context.Background()
+	state := m.GetOrCreateState("s")
+	rec, err := m.srv.AppDB().EnqueueAgentPrompt(ctx, "s", "keep me", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range []string{"", "  \n\t"} {
+		if _, err := m.EditQueuedPrompt(ctx, "s", state, rec.ID, text); !errors.Is(err, errEmptyQueuedPrompt) {
+			t.Fatalf("edit to %q = %v, want errEmptyQueuedPrompt", text, err)
+		}
+	}
+	if found, err := m.EditQueuedPrompt(ctx, "s", state, rec.ID, "edited"); err != nil || !found {
+		t.Fatalf("edit = %v, %v", found, err)
+	}
+	queue, _ := m.srv.AppDB().ListQueuedAgentPrompts("s")
+	if len(queue) != 1 || queue[0].Prompt != "edited" {
+		t.Fatalf("queue = %+v", queue)
+	}
+}
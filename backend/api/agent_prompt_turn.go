@@ -14,9 +14,10 @@ import (
 // Lifecycle handled here: SetProcessing(true/false), emitting turn.start,
 // watching for process death, calling acpSess.Send and draining its events
 // channel, detecting in-band error frames, persisting the turn outcome
-// (errored vs completed), and the post-error ACP teardown that lets the
+// (errored, limited or completed), the post-error ACP teardown that lets the
 // next prompt respawn a fresh process (see comment in the error branch
-// below — and session.cancel in agent_ws.go — for why this is needed).
+// below — and session.cancel in agent_ws.go — for why this is needed), and
+// dispatching the next queued follow-up prompt after a normal completion.
 //
 // Contract with the caller:
 //   - `done` MUST already be registered with sessionState.RegisterPrompt
@@ -97,6 +98,7 @@ func (m *AgentManager) RunPromptTurn(
 
 	sawErrorFrame := false
 	var errorFrameMsg string
+	errorOutcome := db.OutcomeErrored
 	for frame := range events {
 		// Skip frames if session was force-killed (kill handler already
 		// emitted turn.complete), or if a newer turn has taken over — a
@@ -115,10 +117,17 @@ func (m *AgentManager) RunPromptTurn(
 		var ft struct {
 			Type    string `json:"type"`
 			Message string `json:"message"`
+			Code    string `json:"code"`
 		}
 		if json.Unmarshal(frame, &ft) == nil && ft.Type == "error" {
 			sawErrorFrame = true
 			errorFrameMsg = ft.Message
+			if ft.Code == agentsdk.CodeLimitExceeded {
+				// The sandbox killed the agent (memory, pids or turn
+				// time). Reported as its own outcome so the UI can say
+				// why rather than show a generic failure.
+				errorOutcome = db.OutcomeLimited
+			}
 		}
 
 		sessionState.AppendAndBroadcast(frame)
@@ -156,6 +165,10 @@ func (m *AgentManager) RunPromptTurn(
 		return
 	}
 
+	// Whatever the agent was still asking for when the turn ended, it's no
+	// longer waiting on: take it out of the approvals inbox.
+	m.cancelSessionApprovals(sessionID)
+
 	if killed {
 		return
 	}
@@ -187,8 +200,8 @@ func (m *AgentManager) RunPromptTurn(
 				log.Info().Str("sessionId", sessionID).Str("source", sourceLabel).Msg("closed ACP session after error frame — next prompt will respawn")
 			}
 		}
-		if err := m.srv.AppDB().MarkTurnOutcome(context.Background(), sessionID, db.OutcomeErrored, errorFrameMsg, db.NowMs()); err != nil {
-			log.Warn().Err(err).Str("sessionId", sessionID).Msg("failed to persist errored outcome")
+		if err := m.srv.AppDB().MarkTurnOutcome(context.Background(), sessionID, errorOutcome, errorFrameMsg, db.NowMs()); err != nil {
+			log.Warn().Err(err).Str("sessionId", sessionID).Str("outcome", errorOutcome).Msg("failed to persist errored outcome")
 		}
 		m.notifService.NotifyAgentSessionUpdated(sessionID, "result")
 		return
@@ -225,4 +238,7 @@ func (m *AgentManager) RunPromptTurn(
 			log.Info().Str("sessionId", sessionID).Str("source", sourceLabel).Msg("respawned agent process after turn completion to apply queued model change")
 		}
 	}
+
+	// Start the next follow-up prompt queued while this turn ran.
+	m.DispatchQueuedPrompt(sessionID, sessionState)
 }
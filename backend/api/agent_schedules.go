@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/hooks"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// Scheduled prompts for existing sessions.
+//
+// Auto agents get their schedule from their definition file; any other
+// session can have prompts scheduled into it here, once at a given time or
+// on a cron expression. Schedules are stored in agent_session_schedules and
+// armed on the shared CronHook under "session-schedule:<id>" — the agent
+// runner's cron.tick subscriber ignores names that aren't its definitions.
+// When one fires, the session is resumed (agent respawned with its
+// conversation reloaded) if it isn't live, and the prompt goes through the
+// follow-up queue, so a check-in that lands mid-turn waits its turn.
+
+const sessionScheduleHookPrefix = "session-schedule:"
+
+// errInvalidSchedule marks a schedule request the caller got wrong.
+var errInvalidSchedule = errors.New("invalid schedule")
+
+// StartSessionSchedules subscribes to cron ticks and arms every stored
+// schedule. One-shots whose time passed while the server was down fire
+// right away; missed cron runs are skipped.
+func (m *AgentManager) StartSessionSchedules() {
+	cronHook, registry := m.srv.CronHook(), m.srv.HookRegistry()
+	if cronHook == nil || registry == nil {
+		return
+	}
+	registry.Subscribe(hooks.EventCronTick, func(ctx context.Context, payload hooks.Payload) {
+		name, _ := payload.Data["name"].(string)
+		if id, ok := strings.CutPrefix(name, sessionScheduleHookPrefix); ok {
+			m.fireSessionSchedule(ctx, id)
+		}
+	})
+
+	schedules, err := m.srv.AppDB().ListAgentSessionSchedules("")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load session schedules")
+		return
+	}
+	for i := range schedules {
+		if err := m.armSessionSchedule(&schedules[i]); err != nil {
+			log.Error().Err(err).Str("scheduleId", schedules[i].ID).Msg("failed to arm session schedule")
+		}
+	}
+	if len(schedules) > 0 {
+		log.Info().Int("count", len(schedules)).Msg("session schedules armed")
+	}
+}
+
+func (m *AgentManager) armSessionSchedule(r *db.AgentSessionScheduleRecord) error {
+	name := sessionScheduleHookPrefix + r.ID
+	if r.CronExpr != "" {
+		return m.srv.CronHook().AddSchedule(name, r.CronExpr)
+	}
+	m.srv.CronHook().AddOnce(name, time.UnixMilli(r.RunAt))
+	return nil
+}
+
+// ScheduleSessionPrompt schedules prompt into the session, either on
+// cronExpr (5-field) or once at runAt; exactly one must be given.
+func (m *AgentManager) ScheduleSessionPrompt(ctx context.Context, sessionID, prompt, cronExpr string, runAt time.Time) (*db.AgentSessionScheduleRecord, error) {
+	if m.srv.CronHook() == nil {
+		return nil, errors.New("scheduling is not available")
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return nil, fmt.Errorf("%w: prompt is required", errInvalidSchedule)
+	}
+	if (cronExpr == "") == runAt.IsZero() {
+		return nil, fmt.Errorf("%w: give either cron or runAt", errInvalidSchedule)
+	}
+	r := &db.AgentSessionScheduleRecord{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Prompt:    prompt,
+		CronExpr:  cronExpr,
+	}
+	if !runAt.IsZero() {
+		r.RunAt = runAt.UnixMilli()
+	}
+	if err := m.armSessionSchedule(r); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidSchedule, err)
+	}
+	if err := m.srv.AppDB().CreateAgentSessionSchedule(ctx, r); err != nil {
+		m.srv.CronHook().RemoveSchedule(sessionScheduleHookPrefix + r.ID)
+		return nil, err
+	}
+	log.Info().Str("sessionId", sessionID).Str("scheduleId", r.ID).Str("cron", cronExpr).Int64("runAt", r.RunAt).Msg("session prompt scheduled")
+	return r, nil
+}
+
+// CancelSessionSchedule disarms and deletes a schedule. Returns false when
+// it did not exist.
+func (m *AgentManager) CancelSessionSchedule(ctx context.Context, id string) (bool, error) {
+	if cronHook := m.srv.CronHook(); cronHook != nil {
+		cronHook.RemoveSchedule(sessionScheduleHookPrefix + id)
+	}
+	return m.srv.AppDB().DeleteAgentSessionSchedule(ctx, id)
+}
+
+// fireSessionSchedule sends a schedule's prompt into its session.
+func (m *AgentManager) fireSessionSchedule(ctx context.Context, id string) {
+	r, err := m.srv.AppDB().GetAgentSessionSchedule(id)
+	if err != nil {
+		log.Error().Err(err).Str("scheduleId", id).Msg("failed to load session schedule")
+		return
+	}
+	if r == nil {
+		// Deleted between the tick and now.
+		m.srv.CronHook().RemoveSchedule(sessionScheduleHookPrefix + id)
+		return
+	}
+	if rec, _ := m.srv.AppDB().GetAgentSession(r.SessionID); rec == nil {
+		log.Warn().Str("scheduleId", id).Str("sessionId", r.SessionID).Msg("scheduled prompt's session is gone, dropping schedule")
+		_, _ = m.CancelSessionSchedule(ctx, id)
+		return
+	}
+
+	sessionState := m.GetOrCreateState(r.SessionID)
+	if _, err := m.ResumeLiveSession(r.SessionID, sessionState); err != nil {
+		// Queue it anyway: dispatch retries the spawn and reports the
+		// failure into the session.
+		log.Warn().Err(err).Str("sessionId", r.SessionID).Msg("failed to resume session for scheduled prompt")
+	}
+	if _, err := m.EnqueuePrompt(ctx, r.SessionID, sessionState, r.Prompt, ""); err != nil {
+		// The schedule stays as it was: a one-shot fires again on the next
+		// start, a cron schedule on its next tick.
+		log.Error().Err(err).Str("sessionId", r.SessionID).Str("scheduleId", id).Msg("failed to queue scheduled prompt")
+		return
+	}
+
+	// Only a prompt that made it into the queue counts as a run: a one-shot
+	// is done, a cron schedule records it.
+	if r.CronExpr == "" {
+		if _, err := m.srv.AppDB().DeleteAgentSessionSchedule(ctx, id); err != nil {
+			log.Warn().Err(err).Str("scheduleId", id).Msg("failed to delete fired one-shot schedule")
+		}
+	} else if err := m.srv.AppDB().MarkAgentSessionScheduleRun(ctx, id, db.NowMs()); err != nil {
+		log.Warn().Err(err).Str("scheduleId", id).Msg("failed to record session schedule run")
+	}
+	log.Info().Str("sessionId", r.SessionID).Str("scheduleId", id).Msg("scheduled prompt sent")
+}
+
+// ListAgentSessionSchedules returns the prompts scheduled into a session.
+// GET /api/agent/sessions/:id/schedules
+func (h *Handlers) ListAgentSessionSchedules(c *gin.Context) {
+	schedules, err := h.server.AppDB().ListAgentSessionSchedules(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+}
+
+// CreateAgentSessionSchedule schedules a prompt into an existing session:
+// at runAt (unix ms), after delaySeconds, or on a cron expression.
+// POST /api/agent/sessions/:id/schedules
+func (h *Handlers) CreateAgentSessionSchedule(c *gin.Context) {
+	var req struct {
+		Prompt       string `json:"prompt"`
+		Cron         string `json:"cron"`
+		RunAt        int64  `json:"runAt"`
+		DelaySeconds int64  `json:"delaySeconds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sessionID := c.Param("id")
+	if rec, _ := h.server.AppDB().GetAgentSession(sessionID); rec == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	if req.RunAt != 0 && req.DelaySeconds != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "give runAt or delaySeconds, not both"})
+		return
+	}
+	var runAt time.Time
+	switch {
+	case req.RunAt != 0:
+		runAt = time.UnixMilli(req.RunAt)
+	case req.DelaySeconds > 0:
+		runAt = time.Now().Add(time.Duration(req.DelaySeconds) * time.Second)
+	}
+
+	r, err := h.agentMgr.ScheduleSessionPrompt(c.Request.Context(), sessionID, req.Prompt, req.Cron, runAt)
+	if errors.Is(err, errInvalidSchedule) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, r)
+}
+
+// DeleteAgentSessionSchedule cancels a scheduled prompt.
+// DELETE /api/agent/sessions/:id/schedules/:scheduleId
+func (h *Handlers) DeleteAgentSessionSchedule(c *gin.Context) {
+	id := c.Param("scheduleId")
+	r, err := h.server.AppDB().GetAgentSessionSchedule(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if r == nil || r.SessionID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+		return
+	}
+	if _, err := h.agentMgr.CancelSessionSchedule(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+)
+
+// createTestSchedule stores a schedule for sessionID without arming it; the
+// tests fire it by hand.
+func createTestSchedule(t *testing.T, m *AgentManager, id, sessionID, prompt, cronExpr string) {
+	t.Helper()
+	r := &db.AgentSessionScheduleRecord{ID: id, SessionID: sessionID, Prompt: prompt, CronExpr: cronExpr}
+	if cronExpr == "" {
+		r.RunAt = time.Now().UnixMilli()
+	}
+	if err := m.srv.AppDB().CreateAgentSessionSchedule(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSchedule_FiresIntoColdSession(t *testing.T) {
+	m := newTestAgentManager(t)
+	promptLog := useFakeAgentClient(t, m)
+	createTestSession(t, m, "s", db.OwnerUserID)
+	createTestSchedule(t, m, "once", "s", "check the build", "")
+
+	// No agent process and no in-memory state: the schedule has to bring
+	// the session back before its prompt can run.
+	if _, live := m.GetSession("s"); live {
+		t.Fatal("session unexpectedly live")
+	}
+	m.fireSessionSchedule(context.Background(), "once")
+
+	waitForPromptLog(t, promptLog, "check the build")
+	if _, live := m.GetSession("s"); !live {
+		t.Fatal("session not resumed")
+	}
+	if r, _ := m.srv.AppDB().GetAgentSessionSchedule("once"); r != nil {
+		t.Fatalf("fired one-shot still stored: %+v", r)
+	}
+}
+
+func TestSessionSchedule_KeptWhenPromptNotQueued(t *testing.T) {
+	m := newTestAgentManager(t)
+	createTestSession(t, m, "s", db.OwnerUserID)
+	m.StoreSession("s", newFakeSession("s"))
+	createTestSchedule(t, m, "once", "s", "one-shot", "")
+	createTestSchedule(t, m, "cron", "s", "recurring", "0 9 * * *")
+
+	// Break the prompt queue so the enqueue fails.
+	if _, err := m.srv.AppDB().Conn().Exec(`DROP TABLE agent_prompt_queue`); err != nil {
+		t.Fatal(err)
+	}
+	m.fireSessionSchedule(context.Background(), "once")
+	m.fireSessionSchedule(context.Background(), "cron")
+
+	if r, _ := m.srv.AppDB().GetAgentSessionSchedule("once"); r == nil {
+		t.Fatal("one-shot deleted although its prompt never ran")
+	}
+	if r, _ := m.srv.AppDB().GetAgentSessionSchedule("cron"); r == nil || r.LastRunAt != 0 {
+		t.Fatalf("cron schedule recorded a run that never happened: %+v", r)
+	}
+}
@@ -1,6 +1,9 @@
 package api
 
-import "github.com/xiaoyuanzhu-com/my-life-db/agentsdk"
+import (
+	"github.com/xiaoyuanzhu-com/my-life-db/agentrunner"
+	"github.com/xiaoyuanzhu-com/my-life-db/agentsdk"
+)
 
 // SessionParams configures a new agent session. Used by both the REST API
 // (user-initiated) and the agent runner (auto-triggered). Gateway models are
@@ -18,6 +21,10 @@ type SessionParams struct {
 	TriggerKind    string // event type that fired the session, e.g. "cron.tick", "file.created" (auto-run only)
 	TriggerData    string // JSON-encoded hooks.Payload.Data (auto-run only)
 	StorageID string // optional; when empty, agent_manager mints one
+	UserID    string // owning account; db.OwnerUserID for the owner and auto runs
+	// Approval gates the session: permission requests go to the approvals
+	// inbox (auto-run only). Nil = answered in the session, if at all.
+	Approval *agentrunner.ApprovalPolicy
 }
 
 // SessionHandle is returned by AgentManager.CreateSession so the caller can
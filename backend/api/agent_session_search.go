@@ -63,7 +63,7 @@ func (h *Handlers) SearchAgentSessions(c *gin.Context) {
 		// hasn't yet swept the deletion through — skip silently rather than
 		// returning a half-populated row.
 		sess, err := h.server.AppDB().GetAgentSession(hit.SessionID)
-		if err != nil || sess == nil {
+		if err != nil || sess == nil || !canAccessAgentSession(c, sess) {
 			continue
 		}
 		results = append(results, map[string]any{
@@ -3,7 +3,6 @@ package api
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"sync/atomic"
 	"time"
@@ -68,6 +67,28 @@ func (h *Handlers) AgentSessionWebSocket(c *gin.Context) {
 		}
 	}()
 
+	// After a handoff, send the client to the successor once no turn runs
+	// here. Frames are on disk, so it picks up from there on reconnect.
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.agentMgr.Draining():
+		}
+		sessionState.Mu.RLock()
+		done := sessionState.PromptDone
+		sessionState.Mu.RUnlock()
+		if done != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+			}
+		}
+		log.Debug().Str("sessionId", sessionID).Msg("handoff: closing agent WebSocket so the client reconnects to the successor")
+		conn.Close(websocket.StatusServiceRestart, "server restarting")
+	}()
+
 	// Track seen result count for read state persistence
 	var seenResultCount atomic.Int32
 
@@ -142,6 +163,9 @@ func (h *Handlers) AgentSessionWebSocket(c *gin.Context) {
 		}
 		infoFields["source"] = rec.Source
 	}
+	if queue, err := h.server.AppDB().ListQueuedAgentPrompts(sessionID); err == nil && len(queue) > 0 {
+		infoFields["promptQueue"] = queue
+	}
 	if infoFrame, err := json.Marshal(infoFields); err == nil {
 		if err := conn.Write(ctx, websocket.MessageText, infoFrame); err != nil {
 			log.Error().Err(err).Str("sessionId", sessionID).Msg("failed to send session.info")
@@ -292,15 +316,17 @@ func (h *Handlers) AgentSessionWebSocket(c *gin.Context) {
 				// Override the loaded session's stored model with a gateway-compatible one.
 				// SetModel writes the "model" session config option (ACP v0.13.5) to bypass
 				// claude-agent-acp's allowlist check, which would reject custom gateway model names.
-				// qwen skipped here for the same reason as AgentManager.SetupACP:
+				// Agents without Capabilities.SetModel are skipped — for qwen the
+				// reason is the same as in AgentManager.SetupACP:
 				// its ACP session/set_model validates against a static authType
 				// registry that doesn't know our gateway-proxied model names.
 				// Model is env-driven (OPENAI_MODEL) and auto-captured as a
 				// RuntimeModelSnapshot on process boot — so calling SetModel only
 				// produces a misleading "not found for authType" warning.
-				if defaultModel != "" && sess.AgentType() != agentsdk.AgentQwen {
+				spec := h.agentMgr.agentSpec(sess.AgentType())
+				if defaultModel != "" && spec.Capabilities.SetModel {
 					modelCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-					modelForACP := resolveACPModel(sess.AgentType(), defaultModel)
+					modelForACP := spec.ACPModel(defaultModel)
 					updatedOpts, err := sess.SetModel(modelCtx, modelForACP)
 					if err != nil {
 						log.Warn().Err(err).Str("sessionId", sessionID).Str("model", modelForACP).Msg("failed to override model after LoadSession")
@@ -314,7 +340,7 @@ func (h *Handlers) AgentSessionWebSocket(c *gin.Context) {
 					if modelFellBack {
 						effortOverride = ""
 					}
-					applyModelEffort(sess, sessionState, gatewayModels, defaultModel, sessionID, effortOverride)
+					h.agentMgr.applyModelEffort(sess, sessionState, gatewayModels, defaultModel, sessionID, effortOverride)
 				}
 			}
 		})
@@ -390,6 +416,8 @@ func (h *Handlers) AgentSessionWebSocket(c *gin.Context) {
 			OptionID    string          `json:"optionId,omitempty"`
 			ConfigID    string          `json:"configId,omitempty"`
 			ConfigValue string          `json:"configValue,omitempty"`
+			QueueID     string          `json:"queueId,omitempty"`
+			Text        string          `json:"text,omitempty"`
 		}
 		if err := json.Unmarshal(msg, &inMsg); err != nil {
 			log.Debug().Err(err).Msg("failed to parse agent WS message")
@@ -400,6 +428,16 @@ func (h *Handlers) AgentSessionWebSocket(c *gin.Context) {
 
 		switch inMsg.Type {
 		case "session.prompt":
+			// A draining process starts no turns and queues nothing the
+			// successor wouldn't dispatch. Hang up unread: the client's
+			// outbox sends the prompt again after reconnecting, to the
+			// successor.
+			if h.agentMgr.isDraining() {
+				log.Info().Str("sessionId", sessionID).Msg("handoff: prompt arrived while draining, sending the client to the successor")
+				conn.Close(websocket.StatusServiceRestart, "server restarting")
+				return
+			}
+
 			// Per-session dedup of client-minted message IDs. Drops
 			// duplicate retransmits from the frontend outbox after a
 			// connection flap or page refresh — without this, an
@@ -434,6 +472,22 @@ func (h *Handlers) AgentSessionWebSocket(c *gin.Context) {
 				}
 			}
 
+			// A prompt sent mid-turn waits its turn instead of cancelling
+			// the running one; RunPromptTurn dispatches it on completion.
+			// A wedged turn never completes — session.cancel is the way
+			// out, and it flushes the queue back to the client.
+			if h.agentMgr.ShouldQueuePrompt(sessionID, sessionState) {
+				if _, err := h.agentMgr.EnqueuePrompt(ctx, sessionID, sessionState, promptText, inMsg.MessageID); err != nil {
+					log.Error().Err(err).Str("sessionId", sessionID).Msg("failed to queue prompt")
+					if errBytes, mErr := json.Marshal(map[string]any{
+						"type": "error", "message": "Failed to queue message: " + err.Error(), "code": "QUEUE_ERROR",
+					}); mErr == nil {
+						conn.Write(ctx, websocket.MessageText, errBytes)
+					}
+				}
+				continue
+			}
+
 			// Update the session's updated_at so the session list re-sorts
 			// by last user activity (agent responses don't touch this).
 			if err := h.server.AppDB().TouchAgentSession(ctx, sessionID); err != nil {
@@ -639,6 +693,9 @@ func (h *Handlers) AgentSessionWebSocket(c *gin.Context) {
 				sessionState.AppendAndBroadcast(completeBytes)
 			}
 
+			// Stopping a turn stops what was lined up after it too.
+			h.agentMgr.FlushPromptQueue(sessionID, sessionState)
+
 		case "session.kill":
 			// Force-kill: terminates the ACP process when normal cancellation is stuck.
 			// Used as a safety net when the session is unresponsive.
@@ -678,6 +735,7 @@ func (h *Handlers) AgentSessionWebSocket(c *gin.Context) {
 			}); err == nil {
 				sessionState.AppendAndBroadcast(completeBytes)
 			}
+			h.agentMgr.FlushPromptQueue(sessionID, sessionState)
 
 		case "session.setMode":
 			// Mode uses legacy SetSessionMode RPC (only Claude Code has modes).
@@ -830,7 +888,7 @@ func (h *Handlers) AgentSessionWebSocket(c *gin.Context) {
 					// fan it out ourselves to keep the UI in sync. Rewrite the
 					// model dropdown to the gateway list — the inline response
 					// echoes the native CLI model options otherwise.
-					gatewayModels := h.agentMgr.GatewayModels(agentTypeString(acpSession.AgentType()))
+					gatewayModels := h.agentMgr.GatewayModels(string(acpSession.AgentType()))
 					// The session's model isn't changing here (model changes go
 					// through the respawn path above), so the current dropdown
 					// value is the persisted model — pass it so rewriteModelOptions
@@ -844,6 +902,21 @@ func (h *Handlers) AgentSessionWebSocket(c *gin.Context) {
 			}
 			cfgCancel()
 
+		case "queue.edit":
+			if _, err := h.agentMgr.EditQueuedPrompt(ctx, sessionID, sessionState, inMsg.QueueID, inMsg.Text); err != nil {
+				log.Warn().Err(err).Str("sessionId", sessionID).Str("queueId", inMsg.QueueID).Msg("failed to edit queued prompt")
+			}
+
+		case "queue.remove":
+			if _, err := h.agentMgr.RemoveQueuedPrompt(ctx, sessionID, sessionState, inMsg.QueueID); err != nil {
+				log.Warn().Err(err).Str("sessionId", sessionID).Str("queueId", inMsg.QueueID).Msg("failed to remove queued prompt")
+			}
+
+		case "queue.clear":
+			if err := h.agentMgr.ClearPromptQueue(ctx, sessionID, sessionState); err != nil {
+				log.Warn().Err(err).Str("sessionId", sessionID).Msg("failed to clear prompt queue")
+			}
+
 		case "permission.respond":
 			// The answer has to outlive the in-memory ACP session. permission.request
 			// is a persisted frame, so every reload replays it and re-renders the
@@ -852,14 +925,10 @@ func (h *Handlers) AgentSessionWebSocket(c *gin.Context) {
 			// frame happened to clear it (the tool's own tool_call_update, or
 			// turn.complete) — mid-turn, with neither yet written, it came back on
 			// every refresh of an already-answered prompt.
-			var respondErr error
-			if acpSession, exists := h.agentMgr.GetSession(sessionID); exists {
-				respondErr = acpSession.RespondToPermission(context.Background(), inMsg.ToolCallID, inMsg.OptionID)
-			} else {
-				respondErr = errors.New("no ACP session")
-			}
-
-			if respondErr != nil {
+			//
+			// RespondToPermission writes permission.resolved and settles the
+			// approvals-inbox entry of a gated session, if any.
+			if respondErr := h.agentMgr.RespondToPermission(sessionID, sessionState, inMsg.ToolCallID, inMsg.OptionID, "session"); respondErr != nil {
 				// Nothing is persisted: the request genuinely wasn't answered, so
 				// replay should still show it. Tell live clients too — the card was
 				// dismissed optimistically on click and has to come back, otherwise
@@ -878,14 +947,6 @@ func (h *Handlers) AgentSessionWebSocket(c *gin.Context) {
 				break
 			}
 
-			if resolvedBytes, err := json.Marshal(map[string]any{
-				"type":       "permission.resolved",
-				"toolCallId": inMsg.ToolCallID,
-				"optionId":   inMsg.OptionID,
-			}); err == nil {
-				sessionState.AppendAndBroadcast(resolvedBytes)
-			}
-
 			log.Info().
 				Str("sessionId", sessionID).
 				Str("toolCallId", inMsg.ToolCallID).
@@ -11,7 +11,6 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mholt/archives"
-	"github.com/xiaoyuanzhu-com/my-life-db/config"
 	"github.com/xiaoyuanzhu-com/my-life-db/fs"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 	"github.com/xiaoyuanzhu-com/my-life-db/utils"
@@ -81,13 +80,16 @@ func (h *Handlers) ExtractArchive(c *gin.Context) {
 		return
 	}
 
+	if !requirePathAccess(c, body.Path) {
+		return
+	}
+
 	if !isArchiveFile(body.Path) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "File is not a supported archive format"})
 		return
 	}
 
-	cfg := config.Get()
-	absPath := filepath.Join(cfg.UserDataDir, body.Path)
+	absPath := h.server.FS().ResolvePath(body.Path)
 
 	// Verify the file exists
 	if _, err := os.Stat(absPath); err != nil {
@@ -154,7 +156,6 @@ func (h *Handlers) extractArchive(ctx context.Context, archivePath, destRelDir s
 		return nil, fmt.Errorf("seek archive: %w", err)
 	}
 
-	cfg := config.Get()
 	var results []uploadFileResult
 
 	err = extractor.Extract(ctx, f, func(ctx context.Context, fi archives.FileInfo) error {
@@ -181,7 +182,7 @@ func (h *Handlers) extractArchive(ctx context.Context, archivePath, destRelDir s
 		relPath := filepath.Join(destRelDir, nameInArchive)
 
 		// Ensure parent directory exists on disk
-		absDir := filepath.Join(cfg.UserDataDir, filepath.Dir(relPath))
+		absDir := h.server.FS().ResolvePath(filepath.Dir(relPath))
 		if err := os.MkdirAll(absDir, 0755); err != nil {
 			log.Error().Err(err).Str("dir", absDir).Msg("archive: failed to create parent dir")
 			return nil
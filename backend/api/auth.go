@@ -3,8 +3,10 @@ package api
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/xiaoyuanzhu-com/my-life-db/config"
@@ -20,8 +22,13 @@ const (
 )
 
 // Login handles POST /api/auth/login
+//
+// Without a username (or with "owner") this is the original single-owner
+// flow against auth_password_hash. With a username it authenticates one of
+// the accounts in the users table.
 func (h *Handlers) Login(c *gin.Context) {
 	var body struct {
+		Username string `json:"username"`
 		Password string `json:"password"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
@@ -29,6 +36,11 @@ func (h *Handlers) Login(c *gin.Context) {
 		return
 	}
 
+	if body.Username != "" && !strings.EqualFold(body.Username, db.OwnerUser().Username) {
+		h.loginUser(c, body.Username, body.Password)
+		return
+	}
+
 	// Get stored password hash
 	storedHash, err := h.server.AppDB().GetSetting("auth_password_hash")
 	if err != nil {
@@ -56,9 +68,30 @@ func (h *Handlers) Login(c *gin.Context) {
 		return
 	}
 
-	// Generate and persist session
+	h.startSession(c, db.OwnerUser())
+}
+
+// loginUser authenticates a non-owner account by username + password.
+func (h *Handlers) loginUser(c *gin.Context, username, password string) {
+	u, err := h.server.AppDB().GetUserByUsername(username)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to look up user")
+		RespondCoded(c, http.StatusInternalServerError, "AUTH_SESSION_FAILED", "Authentication error")
+		return
+	}
+	if u == nil || u.DisabledAt != nil ||
+		subtle.ConstantTimeCompare([]byte(hashPassword(password)), []byte(u.PasswordHash)) != 1 {
+		log.Warn().Str("username", username).Msg("login attempt with invalid credentials")
+		RespondCoded(c, http.StatusUnauthorized, "AUTH_INVALID_PASSWORD", "Invalid username or password")
+		return
+	}
+	h.startSession(c, u)
+}
+
+// startSession persists a login session for u and sets the session cookie.
+func (h *Handlers) startSession(c *gin.Context, u *db.UserRecord) {
 	sessionToken := generateSessionToken()
-	session, err := h.server.AppDB().CreateSession(c.Request.Context(), sessionToken)
+	session, err := h.server.AppDB().CreateSession(c.Request.Context(), sessionToken, u.ID)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to create session")
 		RespondCoded(c, http.StatusInternalServerError, "AUTH_SESSION_FAILED", "Failed to create session")
@@ -70,11 +103,12 @@ func (h *Handlers) Login(c *gin.Context) {
 	secure := !cfg.IsDevelopment()
 	c.SetCookie(sessionCookieName, sessionToken, sessionCookieMaxAge, "/", "", secure, true)
 
-	log.Info().Str("sessionId", session.ID[:8]+"...").Msg("login successful")
+	log.Info().Str("sessionId", session.ID[:8]+"...").Str("username", u.Username).Msg("login successful")
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":   true,
 		"sessionId": session.ID,
+		"user":      u,
 	})
 }
 
@@ -124,6 +158,23 @@ func (h *Handlers) ValidatePasswordSession(c *gin.Context) *db.Session {
 	return session
 }
 
+// resolveSessionUser loads the account a login session belongs to. Returns
+// nil when the account was deleted or disabled after the session was issued.
+func (h *Handlers) resolveSessionUser(session *db.Session) *db.UserRecord {
+	if session.UserID == db.OwnerUserID {
+		return db.OwnerUser()
+	}
+	u, err := h.server.AppDB().GetUser(session.UserID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load session user")
+		return nil
+	}
+	if u == nil || u.DisabledAt != nil {
+		return nil
+	}
+	return u
+}
+
 // Helper functions
 
 func hashPassword(password string) string {
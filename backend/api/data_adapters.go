@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -8,7 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
-	"github.com/xiaoyuanzhu-com/my-life-db/config"
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 )
 
@@ -70,6 +71,16 @@ func (h *Handlers) GetDataFile(c *gin.Context) {
 		isPinned = pinned
 	}
 
+	media, err := h.server.IndexDB().GetFileMedia(path)
+	if err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("failed to get media metadata")
+	}
+
+	previewError, err := h.server.IndexDB().GetPreviewError(path)
+	if err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("failed to get preview error")
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"path":          file.Path,
 		"name":          file.Name,
@@ -83,7 +94,9 @@ func (h *Handlers) GetDataFile(c *gin.Context) {
 		"textPreview":   file.TextPreview,
 		"previewSqlar":  file.PreviewSqlar,
 		"previewStatus": file.PreviewStatus,
+		"previewError":  previewError,
 		"isPinned":      isPinned,
+		"media":         media,
 	})
 }
 
@@ -95,8 +108,7 @@ func (h *Handlers) DeleteDataFile(c *gin.Context) {
 		return
 	}
 
-	cfg := config.Get()
-	fullPath := filepath.Join(cfg.UserDataDir, path)
+	fullPath := h.server.FS().ResolvePath(path)
 
 	info, err := os.Stat(fullPath)
 	if err != nil && os.IsNotExist(err) {
@@ -105,7 +117,10 @@ func (h *Handlers) DeleteDataFile(c *gin.Context) {
 	}
 
 	if info != nil && info.IsDir() {
-		if err := h.server.FS().DeleteFolder(c.Request.Context(), path); err != nil {
+		if err := h.server.FS().DeleteFolder(c.Request.Context(), path); errors.Is(err, fs.ErrMountPoint) {
+			RespondCoded(c, http.StatusConflict, "LIBRARY_MOUNT_POINT", "Mounted folders are removed in settings")
+			return
+		} else if err != nil {
 			log.Error().Err(err).Str("path", path).Msg("failed to delete folder")
 			RespondCoded(c, http.StatusInternalServerError, "LIBRARY_DELETE_FAILED", "Failed to delete file")
 			return
@@ -149,8 +164,6 @@ func (h *Handlers) PatchDataFile(c *gin.Context) {
 		return
 	}
 
-	cfg := config.Get()
-
 	// Compute new path based on which discriminator was provided.
 	var newPath string
 	switch {
@@ -187,14 +200,20 @@ func (h *Handlers) PatchDataFile(c *gin.Context) {
 			"Body must include 'name' (rename) or 'parent' (move)")
 		return
 	}
+	if !requirePathAccess(c, newPath) {
+		return
+	}
 
-	newFullPath := filepath.Join(cfg.UserDataDir, newPath)
+	newFullPath := h.server.FS().ResolvePath(newPath)
 	if _, err := os.Stat(newFullPath); err == nil {
 		RespondCoded(c, http.StatusConflict, "LIBRARY_FILE_CONFLICT", "A file with this name already exists")
 		return
 	}
 
-	if err := h.server.FS().RenameOrMove(c.Request.Context(), path, newPath); err != nil {
+	if err := h.server.FS().RenameOrMove(c.Request.Context(), path, newPath); errors.Is(err, fs.ErrMountPoint) {
+		RespondCoded(c, http.StatusConflict, "LIBRARY_MOUNT_POINT", "Mounted folders are moved in settings")
+		return
+	} else if err != nil {
 		log.Error().Err(err).Str("path", path).Str("newPath", newPath).Msg("failed to rename/move file")
 		RespondCoded(c, http.StatusInternalServerError, "LIBRARY_RENAME_FAILED", "Failed to rename/move file")
 		return
@@ -240,9 +259,11 @@ func (h *Handlers) CreateDataFolder(c *gin.Context) {
 	} else {
 		folderPath = body.Parent + "/" + body.Name
 	}
+	if !requirePathAccess(c, folderPath) {
+		return
+	}
 
-	cfg := config.Get()
-	fullPath := filepath.Join(cfg.UserDataDir, folderPath)
+	fullPath := h.server.FS().ResolvePath(folderPath)
 	if _, err := os.Stat(fullPath); err == nil {
 		RespondCoded(c, http.StatusConflict, "LIBRARY_FOLDER_CONFLICT", "A folder with this name already exists")
 		return
@@ -0,0 +1,359 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// Duplicates: find copies of the same content and reclaim the space.
+//
+//	GET  /api/data/duplicates?mode=exact|similar&folder=&minSize=&distance=&limit=&offset=
+//	POST /api/data/duplicates/resolve
+//
+// mode=exact groups files by content hash. mode=similar groups images by
+// perceptual hash (computed by the preview worker next to the thumbnail)
+// within distance bits, so re-encodes and resized copies show up too.
+//
+// Paths that already share one inode (hard links) count as a single copy:
+// they cost nothing to keep, and a group whose members are all linked is
+// not reported. Groups are sorted by reclaimable bytes, largest first.
+//
+// Resolve keeps one file of each group and either moves the others to
+// .trash/<batch>/ at the top of the user's data root or (exact duplicates only) replaces them with hard links
+// to the kept file. Hard linking re-checks the contents byte for byte, so
+// a near-duplicate is refused rather than overwritten.
+
+const (
+	duplicatesDefaultLimit    = 50
+	duplicatesMaxLimit        = 500
+	duplicatesDefaultDistance = 6
+)
+
+// DuplicateFile is one member of a duplicate group.
+type DuplicateFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// LinkedTo names an earlier member this path is a hard link of.
+	LinkedTo string `json:"linkedTo,omitempty"`
+}
+
+// DuplicateGroup is a set of files holding the same (or, in similar mode,
+// visually the same) content.
+type DuplicateGroup struct {
+	Key              string          `json:"key"` // content hash, or hex perceptual hash
+	Files            []DuplicateFile `json:"files"`
+	Copies           int             `json:"copies"` // distinct copies on disk
+	ReclaimableBytes int64           `json:"reclaimableBytes"`
+}
+
+// DuplicatesResponse is the response of GET /api/data/duplicates.
+type DuplicatesResponse struct {
+	Mode                  string           `json:"mode"`
+	Groups                []DuplicateGroup `json:"groups"`
+	TotalGroups           int              `json:"totalGroups"`
+	TotalReclaimableBytes int64            `json:"totalReclaimableBytes"`
+}
+
+// GetDuplicates handles GET /api/data/duplicates
+func (h *Handlers) GetDuplicates(c *gin.Context) {
+	mode := c.DefaultQuery("mode", "exact")
+	if mode != "exact" && mode != "similar" {
+		RespondCoded(c, http.StatusBadRequest, "DUPLICATES_INVALID_MODE", "mode must be exact or similar")
+		return
+	}
+
+	limit := duplicatesDefaultLimit
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, duplicatesMaxLimit)
+	}
+	offset := 0
+	if o, err := strconv.Atoi(c.Query("offset")); err == nil && o > 0 {
+		offset = o
+	}
+
+	folder := strings.Trim(c.Query("folder"), "/")
+	if folder != "" {
+		if !requirePathAccess(c, folder) {
+			return
+		}
+	} else {
+		folder = db.NormalizeDataRoot(CurrentUser(c).DataRoot)
+	}
+
+	var groups []DuplicateGroup
+	var err error
+	if mode == "exact" {
+		var minSize int64
+		if s, perr := strconv.ParseInt(c.Query("minSize"), 10, 64); perr == nil && s > 0 {
+			minSize = s
+		}
+		groups, err = h.exactDuplicates(folder, minSize)
+	} else {
+		distance := duplicatesDefaultDistance
+		if d, perr := strconv.Atoi(c.Query("distance")); perr == nil {
+			if d < 0 || d > fs.MaxPhashDistance {
+				RespondCoded(c, http.StatusBadRequest, "DUPLICATES_INVALID_DISTANCE",
+					"distance must be between 0 and "+strconv.Itoa(fs.MaxPhashDistance))
+				return
+			}
+			distance = d
+		}
+		groups, err = h.similarImages(folder, distance)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("mode", mode).Msg("failed to list duplicates")
+		RespondInternalError(c, "Failed to list duplicates")
+		return
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].ReclaimableBytes > groups[j].ReclaimableBytes
+	})
+	resp := DuplicatesResponse{Mode: mode, Groups: []DuplicateGroup{}, TotalGroups: len(groups)}
+	for _, g := range groups {
+		resp.TotalReclaimableBytes += g.ReclaimableBytes
+	}
+	if offset < len(groups) {
+		resp.Groups = groups[offset:min(offset+limit, len(groups))]
+	}
+	RespondData(c, resp)
+}
+
+// exactDuplicates groups the files sharing a content hash.
+func (h *Handlers) exactDuplicates(folder string, minSize int64) ([]DuplicateGroup, error) {
+	files, err := h.server.IndexDB().ListDuplicateFiles(folder, minSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []DuplicateGroup
+	for start := 0; start < len(files); {
+		end := start + 1
+		for end < len(files) && *files[end].Hash == *files[start].Hash {
+			end++
+		}
+		members := make([]DuplicateFile, 0, end-start)
+		for _, f := range files[start:end] {
+			var size int64
+			if f.Size != nil {
+				size = *f.Size
+			}
+			members = append(members, DuplicateFile{Path: f.Path, Size: size})
+		}
+		if g, ok := h.duplicateGroup(*files[start].Hash, members); ok {
+			// Identical content: every extra copy is reclaimable.
+			g.ReclaimableBytes = int64(g.Copies-1) * g.Files[0].Size
+			groups = append(groups, g)
+		}
+		start = end
+	}
+	return groups, nil
+}
+
+// similarImages groups images whose perceptual hashes are within distance
+// bits of each other.
+func (h *Handlers) similarImages(folder string, distance int) ([]DuplicateGroup, error) {
+	images, err := h.server.IndexDB().ListImagePhashes(folder)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]uint64, len(images))
+	for i, img := range images {
+		hashes[i] = img.Phash
+	}
+
+	var groups []DuplicateGroup
+	for _, idx := range fs.SimilarGroups(hashes, distance) {
+		members := make([]DuplicateFile, 0, len(idx))
+		for _, i := range idx {
+			members = append(members, DuplicateFile{Path: images[i].Path, Size: images[i].Size})
+		}
+		key := strconv.FormatUint(images[idx[0]].Phash, 16)
+		if g, ok := h.duplicateGroup(key, members); ok {
+			// Copies differ in size; keeping the largest is the usual pick.
+			var total, largest int64
+			for _, f := range g.Files {
+				if f.LinkedTo == "" {
+					total += f.Size
+					if f.Size > largest {
+						largest = f.Size
+					}
+				}
+			}
+			g.ReclaimableBytes = total - largest
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+// duplicateGroup stats members, drops the ones gone from disk and marks
+// hard links of earlier members. ok is false when fewer than two distinct
+// copies remain.
+func (h *Handlers) duplicateGroup(key string, members []DuplicateFile) (DuplicateGroup, bool) {
+	g := DuplicateGroup{Key: key, Files: make([]DuplicateFile, 0, len(members))}
+	var seen []os.FileInfo
+	var seenPaths []string
+	for _, m := range members {
+		info, err := os.Stat(h.server.FS().ResolvePath(m.Path))
+		if err != nil || info.IsDir() {
+			continue
+		}
+		for i, s := range seen {
+			if os.SameFile(s, info) {
+				m.LinkedTo = seenPaths[i]
+				break
+			}
+		}
+		if m.LinkedTo == "" {
+			seen = append(seen, info)
+			seenPaths = append(seenPaths, m.Path)
+			g.Copies++
+		}
+		g.Files = append(g.Files, m)
+	}
+	return g, g.Copies > 1
+}
+
+// ResolveDuplicatesRequest is the body of POST /api/data/duplicates/resolve.
+type ResolveDuplicatesRequest struct {
+	Action string `json:"action"` // "trash" or "hardlink"
+	Groups []struct {
+		Keep   string   `json:"keep"`
+		Remove []string `json:"remove"`
+	} `json:"groups"`
+}
+
+// ResolveDuplicateResult reports what happened to one removed path.
+type ResolveDuplicateResult struct {
+	Path      string `json:"path"`
+	Keep      string `json:"keep"`
+	OK        bool   `json:"ok"`
+	TrashPath string `json:"trashPath,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ResolveDuplicates handles POST /api/data/duplicates/resolve
+//
+// Every path in the request is checked before anything is touched; then
+// each removal is attempted independently and reported in results. Both
+// actions first re-check that the copy still matches the kept file, so a
+// copy edited since the scan is skipped. All files trashed by one request
+// share a trash batch.
+func (h *Handlers) ResolveDuplicates(c *gin.Context) {
+	var req ResolveDuplicatesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		RespondBadRequest(c, "Invalid request body")
+		return
+	}
+	if req.Action != "trash" && req.Action != "hardlink" {
+		RespondCoded(c, http.StatusBadRequest, "DUPLICATES_INVALID_ACTION", "action must be trash or hardlink")
+		return
+	}
+	if len(req.Groups) == 0 {
+		RespondBadRequest(c, "No groups to resolve")
+		return
+	}
+
+	fsService := h.server.FS()
+	for i := range req.Groups {
+		g := &req.Groups[i]
+		g.Keep = strings.Trim(g.Keep, "/")
+		if len(g.Remove) == 0 {
+			RespondBadRequest(c, "Each group needs at least one path to remove")
+			return
+		}
+		for j := range g.Remove {
+			g.Remove[j] = strings.Trim(g.Remove[j], "/")
+		}
+		for _, p := range append([]string{g.Keep}, g.Remove...) {
+			if !validateRelPath(c, p) || !requirePathAccess(c, p) {
+				return
+			}
+			if fsService.ValidatePath(p) != nil {
+				RespondCoded(c, http.StatusBadRequest, "LIBRARY_INVALID_PATH", "Invalid path: "+p)
+				return
+			}
+		}
+		for _, p := range g.Remove {
+			if p == g.Keep {
+				RespondBadRequest(c, "The kept file cannot also be removed: "+p)
+				return
+			}
+		}
+	}
+
+	ctx := c.Request.Context()
+	batch := fs.TrashBatch(time.Now())
+	trashRoot := db.NormalizeDataRoot(CurrentUser(c).DataRoot)
+	results := []ResolveDuplicateResult{}
+	var reclaimed int64
+	for _, g := range req.Groups {
+		keepInfo, err := os.Stat(fsService.ResolvePath(g.Keep))
+		if err != nil || keepInfo.IsDir() {
+			// Never remove the other copies when the one to keep is gone.
+			for _, p := range g.Remove {
+				results = append(results, ResolveDuplicateResult{Path: p, Keep: g.Keep, Error: "kept file not found"})
+			}
+			continue
+		}
+
+		for _, p := range g.Remove {
+			res := ResolveDuplicateResult{Path: p, Keep: g.Keep}
+			var size int64
+			if info, err := os.Stat(fsService.ResolvePath(p)); err == nil && !os.SameFile(info, keepInfo) {
+				size = info.Size()
+			}
+
+			switch req.Action {
+			case "trash":
+				res.TrashPath, err = fsService.TrashDuplicate(ctx, g.Keep, p, trashRoot, batch)
+				if err == nil {
+					h.server.Notifications().NotifyLibraryChanged(p, "delete")
+				}
+			case "hardlink":
+				err = fsService.ReplaceWithHardlink(ctx, g.Keep, p)
+			}
+
+			if err != nil {
+				log.Warn().Err(err).Str("path", p).Str("keep", g.Keep).Str("action", req.Action).Msg("failed to resolve duplicate")
+				res.Error = resolveErrorMessage(err)
+			} else {
+				res.OK = true
+				reclaimed += size
+			}
+			results = append(results, res)
+		}
+	}
+
+	RespondData(c, gin.H{"results": results, "reclaimedBytes": reclaimed})
+}
+
+// resolveErrorMessage maps fs errors to short client-facing messages.
+func resolveErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrFileNotFound):
+		return "file not found"
+	case errors.Is(err, fs.ErrIsDirectory):
+		return "is a directory"
+	case errors.Is(err, fs.ErrContentMismatch):
+		return "contents differ from the kept file"
+	case errors.Is(err, fs.ErrCrossDevice):
+		return "on a different device from the kept file"
+	case errors.Is(err, fs.ErrInvalidPath):
+		return "invalid path"
+	default:
+		return err.Error()
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
+	"github.com/xiaoyuanzhu-com/my-life-db/server"
+)
+
+// trashIndex is the part of the index TrashFile touches.
+type trashIndex struct{ fs.Database }
+
+func (trashIndex) DeleteFileWithCascade(string) error { return nil }
+
+// newDuplicatesRouter serves the duplicates API over a temp library as user.
+func newDuplicatesRouter(t *testing.T, user *db.UserRecord) (*gin.Engine, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	root := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	srv := server.NewForTesting(ctx, &server.Config{UserDataDir: root}, openTestAppDB(t))
+	srv.SetFSForTesting(fs.NewService(fs.Config{DataRoot: root, DB: trashIndex{}}))
+	h := &Handlers{server: srv}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { setCurrentUser(c, user) })
+	r.GET("/api/data/duplicates", h.GetDuplicates)
+	r.POST("/api/data/duplicates/resolve", h.ResolveDuplicates)
+	return r, root
+}
+
+func writeLibraryFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	full := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func serveJSON(r *gin.Engine, method, target string, body any) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestDuplicates_MemberConfinedToDataRoot(t *testing.T) {
+	ann := &db.UserRecord{ID: "ann", Username: "ann", Role: db.UserRoleMember, DataRoot: "members/ann"}
+	r, root := newDuplicatesRouter(t, ann)
+	for _, p := range []string{"members/ann/a.jpg", "members/ann/b.jpg", "members/bob/a.jpg", "shared.jpg"} {
+		writeLibraryFile(t, root, p, "same picture")
+	}
+
+	if w := serveJSON(r, http.MethodGet, "/api/data/duplicates?folder=members/bob", nil); w.Code != http.StatusForbidden {
+		t.Fatalf("listing another member's folder: status %d, body %s", w.Code, w.Body)
+	}
+
+	forbidden := []struct{ keep, remove string }{
+		{"members/ann/a.jpg", "members/bob/a.jpg"},        // removing someone else's file
+		{"members/bob/a.jpg", "members/ann/a.jpg"},        // keeping someone else's file
+		{"members/ann/a.jpg", "shared.jpg"},               // outside any data root
+		{"members/ann/a.jpg", "members/ann/../bob/a.jpg"}, // escaping through ..
+	}
+	for _, tt := range forbidden {
+		body := gin.H{"action": "trash", "groups": []gin.H{{"keep": tt.keep, "remove": []string{tt.remove}}}}
+		w := serveJSON(r, http.MethodPost, "/api/data/duplicates/resolve", body)
+		if w.Code != http.StatusForbidden && w.Code != http.StatusBadRequest {
+			t.Fatalf("resolve keep=%s remove=%s: status %d, body %s", tt.keep, tt.remove, w.Code, w.Body)
+		}
+	}
+	for _, p := range []string{"members/ann/a.jpg", "members/bob/a.jpg", "shared.jpg"} {
+		if _, err := os.Stat(filepath.Join(root, p)); err != nil {
+			t.Fatalf("%s touched by a refused request: %v", p, err)
+		}
+	}
+
+	// Within the member's root the copy goes to the member's own trash.
+	body := gin.H{"action": "trash", "groups": []gin.H{{"keep": "members/ann/a.jpg", "remove": []string{"members/ann/b.jpg"}}}}
+	w := serveJSON(r, http.MethodPost, "/api/data/duplicates/resolve", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("resolve own duplicate: status %d, body %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data struct {
+			Results []ResolveDuplicateResult `json:"results"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data.Results) != 1 || !resp.Data.Results[0].OK {
+		t.Fatalf("results = %+v", resp.Data.Results)
+	}
+	trashPath := resp.Data.Results[0].TrashPath
+	if !strings.HasPrefix(trashPath, "members/ann/.trash/") || !strings.HasSuffix(trashPath, "/b.jpg") {
+		t.Fatalf("trash path %q is not in the member's trash", trashPath)
+	}
+	if _, err := os.Stat(filepath.Join(root, trashPath)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDuplicates_TrashSkipsChangedCopies(t *testing.T) {
+	r, root := newDuplicatesRouter(t, db.OwnerUser())
+	writeLibraryFile(t, root, "keep.jpg", "same picture")
+	writeLibraryFile(t, root, "copy.jpg", "same picture")
+	// Edited since the scan: same size, different bytes.
+	writeLibraryFile(t, root, "edited.jpg", "same pictur!")
+
+	body := gin.H{"action": "trash", "groups": []gin.H{{"keep": "keep.jpg", "remove": []string{"copy.jpg", "edited.jpg"}}}}
+	w := serveJSON(r, http.MethodPost, "/api/data/duplicates/resolve", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("resolve: status %d, body %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data struct {
+			Results []ResolveDuplicateResult `json:"results"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data.Results) != 2 {
+		t.Fatalf("results = %+v", resp.Data.Results)
+	}
+	if res := resp.Data.Results[0]; !res.OK || res.Path != "copy.jpg" {
+		t.Errorf("identical copy: %+v, want trashed", res)
+	}
+	if res := resp.Data.Results[1]; res.OK || res.Error != "contents differ from the kept file" {
+		t.Errorf("edited copy: %+v, want skipped as a mismatch", res)
+	}
+	if _, err := os.Stat(filepath.Join(root, "copy.jpg")); !os.IsNotExist(err) {
+		t.Errorf("identical copy still in place: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(root, "edited.jpg")); err != nil || string(got) != "same pictur!" {
+		t.Errorf("edited copy = %q, %v; want it left untouched", got, err)
+	}
+}
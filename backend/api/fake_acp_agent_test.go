@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	acp "github.com/coder/acp-go-sdk"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/agentsdk"
+)
+
+// fakeAgentEnv, when set, turns the test binary into a fake ACP agent that
+// appends every prompt it gets to the file the variable names. Tests that
+// need a real agent process — a cold session being spawned — register the
+// test binary itself as the agent.
+const fakeAgentEnv = "MLDB_TEST_FAKE_ACP_AGENT"
+
+func TestMain(m *testing.M) {
+	if promptLog := os.Getenv(fakeAgentEnv); promptLog != "" {
+		agent := &fakeACPAgent{promptLog: promptLog}
+		<-acp.NewAgentSideConnection(agent, os.Stdout, os.Stdin).Done()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// useFakeAgentClient points the manager at an agent client that spawns the
+// fake ACP agent, and returns the file its prompts are logged to.
+func useFakeAgentClient(t *testing.T, m *AgentManager) (promptLog string) {
+	t.Helper()
+	promptLog = t.TempDir() + "/prompts"
+	m.agentClient = agentsdk.NewClient(agentsdk.SessionConfig{}, agentsdk.AgentConfig{
+		Type:    agentsdk.AgentClaudeCode,
+		Name:    "Fake agent",
+		Command: os.Args[0],
+		Env:     map[string]string{fakeAgentEnv: promptLog},
+	})
+	t.Cleanup(func() { _ = m.agentClient.Shutdown(context.Background()) })
+	return promptLog
+}
+
+// waitForPromptLog waits until the fake agent has logged want.
+func waitForPromptLog(t *testing.T, promptLog, want string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, _ := os.ReadFile(promptLog); strings.Contains(string(data), want+"\n") {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	data, _ := os.ReadFile(promptLog)
+	t.Fatalf("agent never got %q; prompts: %q", want, data)
+}
+
+// fakeACPAgent accepts any session and ends every turn right away.
+type fakeACPAgent struct {
+	promptLog string
+}
+
+func (a *fakeACPAgent) Initialize(context.Context, acp.InitializeRequest) (acp.InitializeResponse, error) {
+	return acp.InitializeResponse{
+		ProtocolVersion:   acp.ProtocolVersionNumber,
+		AgentCapabilities: acp.AgentCapabilities{LoadSession: true},
+		AuthMethods:       []acp.AuthMethod{},
+	}, nil
+}
+
+func (a *fakeACPAgent) NewSession(context.Context, acp.NewSessionRequest) (acp.NewSessionResponse, error) {
+	return acp.NewSessionResponse{SessionId: "fake-session"}, nil
+}
+
+func (a *fakeACPAgent) LoadSession(context.Context, acp.LoadSessionRequest) (acp.LoadSessionResponse, error) {
+	return acp.LoadSessionResponse{}, nil
+}
+
+func (a *fakeACPAgent) Prompt(_ context.Context, params acp.PromptRequest) (acp.PromptResponse, error) {
+	var text strings.Builder
+	for _, block := range params.Prompt {
+		if block.Text != nil {
+			text.WriteString(block.Text.Text)
+		}
+	}
+	f, err := os.OpenFile(a.promptLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return acp.PromptResponse{}, err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text.String() + "\n"); err != nil {
+		return acp.PromptResponse{}, err
+	}
+	return acp.PromptResponse{StopReason: acp.StopReasonEndTurn}, nil
+}
+
+func (a *fakeACPAgent) Authenticate(context.Context, acp.AuthenticateRequest) (acp.AuthenticateResponse, error) {
+	return acp.AuthenticateResponse{}, nil
+}
+
+func (a *fakeACPAgent) Logout(context.Context, acp.LogoutRequest) (acp.LogoutResponse, error) {
+	return acp.LogoutResponse{}, nil
+}
+
+func (a *fakeACPAgent) Cancel(context.Context, acp.CancelNotification) error { return nil }
+
+func (a *fakeACPAgent) CloseSession(context.Context, acp.CloseSessionRequest) (acp.CloseSessionResponse, error) {
+	return acp.CloseSessionResponse{}, nil
+}
+
+func (a *fakeACPAgent) ListSessions(context.Context, acp.ListSessionsRequest) (acp.ListSessionsResponse, error) {
+	return acp.ListSessionsResponse{}, nil
+}
+
+func (a *fakeACPAgent) ResumeSession(context.Context, acp.ResumeSessionRequest) (acp.ResumeSessionResponse, error) {
+	return acp.ResumeSessionResponse{}, nil
+}
+
+func (a *fakeACPAgent) SetSessionConfigOption(context.Context, acp.SetSessionConfigOptionRequest) (acp.SetSessionConfigOptionResponse, error) {
+	return acp.SetSessionConfigOptionResponse{}, nil
+}
+
+func (a *fakeACPAgent) SetSessionMode(context.Context, acp.SetSessionModeRequest) (acp.SetSessionModeResponse, error) {
+	return acp.SetSessionModeResponse{}, nil
+}
@@ -0,0 +1,523 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/config"
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+	"github.com/xiaoyuanzhu-com/my-life-db/utils"
+)
+
+// Public share links for library files and folders.
+//
+// Wire shape:
+//
+//	POST   /api/data/shares                        create (authenticated)
+//	GET    /api/data/shares                        list   (authenticated)
+//	DELETE /api/data/shares/:token                 revoke (authenticated)
+//
+//	GET    /api/public/shares/:token               metadata + folder listing (?path=sub)
+//	POST   /api/public/shares/:token/unlock        exchange password for a cookie
+//	GET    /api/public/shares/:token/raw/*path     inline file bytes
+//	GET    /api/public/shares/:token/download      attachment / folder zip (?path=sub)
+//	GET    /api/public/shares/:token/preview/*path thumbnail from sqlar
+//	PUT    /api/public/shares/:token/upload/*name  drop-box upload
+//
+// Paths on the public routes are relative to the shared path, never to
+// USER_DATA_DIR, so a link can't be walked out of its folder. "read" links
+// allow everything except upload; "dropbox" links allow only metadata and
+// upload, and never list the folder's contents.
+
+// shareUploadMaxBytes caps a single drop-box upload, matching WebDAV.
+const shareUploadMaxBytes = webdavMaxBodyBytes
+
+// sharePasswordHeader lets API clients present the link password directly
+// instead of going through /unlock.
+const sharePasswordHeader = "X-Share-Password"
+
+// CreateFileShare handles POST /api/data/shares
+func (h *Handlers) CreateFileShare(c *gin.Context) {
+	var body struct {
+		Path      string `json:"path"`
+		Mode      string `json:"mode"`      // "read" (default) or "dropbox"
+		Password  string `json:"password"`  // optional
+		ExpiresAt *int64 `json:"expiresAt"` // optional, epoch ms
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		RespondBadRequest(c, "Invalid request body")
+		return
+	}
+	body.Path = strings.Trim(body.Path, "/")
+	if !validateRelPath(c, body.Path) || !requirePathAccess(c, body.Path) {
+		return
+	}
+	if body.Mode == "" {
+		body.Mode = db.FileShareModeRead
+	}
+	if body.Mode != db.FileShareModeRead && body.Mode != db.FileShareModeDropbox {
+		RespondBadRequest(c, "mode must be 'read' or 'dropbox'")
+		return
+	}
+	if body.ExpiresAt != nil && *body.ExpiresAt <= db.NowMs() {
+		RespondBadRequest(c, "expiresAt must be in the future")
+		return
+	}
+
+	info, err := os.Stat(h.server.FS().ResolvePath(body.Path))
+	if os.IsNotExist(err) {
+		RespondCoded(c, http.StatusNotFound, "LIBRARY_NOT_FOUND", "File not found")
+		return
+	}
+	if err != nil {
+		RespondInternalError(c, "Failed to access path")
+		return
+	}
+	if body.Mode == db.FileShareModeDropbox && !info.IsDir() {
+		RespondBadRequest(c, "Drop-box links must point at a folder")
+		return
+	}
+
+	share := &db.FileShareRecord{
+		Token:     uuid.New().String(),
+		Path:      body.Path,
+		IsFolder:  info.IsDir(),
+		Mode:      body.Mode,
+		ExpiresAt: body.ExpiresAt,
+		UserID:    CurrentUser(c).ID,
+	}
+	if body.Password != "" {
+		share.PasswordHash = hashPassword(body.Password)
+	}
+	if err := h.server.AppDB().CreateFileShare(c.Request.Context(), share); err != nil {
+		log.Error().Err(err).Str("path", body.Path).Msg("failed to create file share")
+		RespondInternalError(c, "Failed to create share link")
+		return
+	}
+
+	log.Info().Str("path", share.Path).Str("mode", share.Mode).Bool("password", share.HasPassword).Msg("file share created")
+	RespondCreated(c, gin.H{
+		"share":    share,
+		"shareUrl": "/shared/" + share.Token,
+	}, "")
+}
+
+// ListFileShares handles GET /api/data/shares. Members see only their own
+// links; admins see every account's.
+func (h *Handlers) ListFileShares(c *gin.Context) {
+	var userFilter *string
+	if u := CurrentUser(c); !u.IsAdmin() {
+		userFilter = &u.ID
+	}
+	shares, err := h.server.AppDB().ListFileShares(userFilter)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list file shares")
+		RespondInternalError(c, "Failed to list share links")
+		return
+	}
+	RespondList(c, shares, nil)
+}
+
+// DeleteFileShare handles DELETE /api/data/shares/:token
+func (h *Handlers) DeleteFileShare(c *gin.Context) {
+	token := c.Param("token")
+	share, err := h.server.AppDB().GetFileShare(token)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load file share")
+		RespondInternalError(c, "Failed to revoke share link")
+		return
+	}
+	u := CurrentUser(c)
+	if share == nil || (!u.IsAdmin() && share.UserID != u.ID) {
+		RespondNotFound(c, "Share link not found")
+		return
+	}
+	if err := h.server.AppDB().DeleteFileShare(c.Request.Context(), token); err != nil {
+		log.Error().Err(err).Msg("failed to delete file share")
+		RespondInternalError(c, "Failed to revoke share link")
+		return
+	}
+	RespondNoContent(c)
+}
+
+// =============================================================================
+// Public routes
+// =============================================================================
+
+// shareCookieName is the per-link cookie set by /unlock.
+func shareCookieName(token string) string {
+	return "share_" + token
+}
+
+// shareUnlockValue derives the cookie value proving the password was
+// presented. Binding it to the stored hash means changing or removing the
+// password invalidates outstanding cookies.
+func shareUnlockValue(share *db.FileShareRecord) string {
+	sum := sha256.Sum256([]byte(share.Token + ":" + share.PasswordHash))
+	return hex.EncodeToString(sum[:])
+}
+
+// resolveFileShare loads the link for :token and enforces expiry and the
+// password. A link only works while the account that made it exists, is
+// enabled and can still reach the shared path. Writes the error response
+// and returns nil on failure.
+func (h *Handlers) resolveFileShare(c *gin.Context) *db.FileShareRecord {
+	share, err := h.server.AppDB().GetFileShare(c.Param("token"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to resolve file share token")
+		RespondInternalError(c, "Failed to resolve share link")
+		return nil
+	}
+	if share != nil {
+		ok, err := h.shareOwnerCanAccess(share)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to load file share owner")
+			RespondInternalError(c, "Failed to resolve share link")
+			return nil
+		}
+		if !ok {
+			share = nil
+		}
+	}
+	if share == nil {
+		RespondCoded(c, http.StatusNotFound, "SHARE_NOT_FOUND", "Share link not found")
+		return nil
+	}
+	if share.IsExpired(db.NowMs()) {
+		RespondCoded(c, http.StatusGone, "SHARE_EXPIRED", "Share link has expired")
+		return nil
+	}
+	if share.PasswordHash == "" {
+		return share
+	}
+	if pw := c.GetHeader(sharePasswordHeader); pw != "" &&
+		subtle.ConstantTimeCompare([]byte(hashPassword(pw)), []byte(share.PasswordHash)) == 1 {
+		return share
+	}
+	if v, err := c.Cookie(shareCookieName(share.Token)); err == nil &&
+		subtle.ConstantTimeCompare([]byte(v), []byte(shareUnlockValue(share))) == 1 {
+		return share
+	}
+	RespondCoded(c, http.StatusUnauthorized, "SHARE_PASSWORD_REQUIRED", "This link is password-protected")
+	return nil
+}
+
+// shareOwnerCanAccess reports whether the account that made share still
+// exists, is enabled and has the shared path inside its data root.
+func (h *Handlers) shareOwnerCanAccess(share *db.FileShareRecord) (bool, error) {
+	u := db.OwnerUser()
+	if share.UserID != db.OwnerUserID {
+		var err error
+		u, err = h.server.AppDB().GetUser(share.UserID)
+		if err != nil {
+			return false, err
+		}
+		if u == nil || u.DisabledAt != nil {
+			return false, nil
+		}
+	}
+	return u.CanAccessPath(share.Path), nil
+}
+
+// shareTargetPath maps a share-relative sub path onto a USER_DATA_DIR
+// relative path, refusing anything that would leave the shared folder.
+// File links only resolve the empty sub path.
+func shareTargetPath(share *db.FileShareRecord, sub string) (string, bool) {
+	sub = strings.Trim(sub, "/")
+	if sub == "" {
+		return share.Path, true
+	}
+	if !share.IsFolder || strings.Contains(sub, "..") {
+		return "", false
+	}
+	return path.Join(share.Path, sub), true
+}
+
+// resolveShareTarget is shareTargetPath plus a check on disk: the target,
+// with symlinks resolved, must still be inside the shared folder (or be
+// the shared file), so a symlink in a shared folder can't hand out what it
+// points at elsewhere. Returns the library path and where it is on disk.
+func (h *Handlers) resolveShareTarget(share *db.FileShareRecord, sub string) (string, string, bool) {
+	target, ok := shareTargetPath(share, sub)
+	if !ok {
+		return "", "", false
+	}
+	fullPath := h.server.FS().ResolvePath(target)
+	if !withinShare(h.server.FS().ResolvePath(share.Path), fullPath) {
+		return "", "", false
+	}
+	return target, fullPath, true
+}
+
+// withinShare reports whether fullPath, with symlinks resolved, is root or
+// below it. A path that doesn't exist at all passes (callers answer 404);
+// a dangling symlink doesn't.
+func withinShare(root, fullPath string) bool {
+	resolved, err := filepath.EvalSymlinks(fullPath)
+	if err != nil {
+		_, lerr := os.Lstat(fullPath)
+		return os.IsNotExist(lerr)
+	}
+	if r, err := filepath.EvalSymlinks(root); err == nil {
+		root = r
+	}
+	rel, err := filepath.Rel(root, resolved)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// requireShareMode writes a 403 and returns false unless the link's mode
+// matches.
+func requireShareMode(c *gin.Context, share *db.FileShareRecord, mode string) bool {
+	if share.Mode == mode {
+		return true
+	}
+	RespondCoded(c, http.StatusForbidden, "SHARE_MODE_FORBIDDEN", "Not allowed by this share link")
+	return false
+}
+
+// sharedEntry is one child in a shared-folder listing.
+type sharedEntry struct {
+	Name       string `json:"name"`
+	Path       string `json:"path"` // relative to the shared folder
+	Type       string `json:"type"` // "file" or "folder"
+	Size       int64  `json:"size,omitempty"`
+	ModifiedAt int64  `json:"modifiedAt"`
+	HasPreview bool   `json:"hasPreview,omitempty"`
+}
+
+// GetPublicFileShare handles GET /api/public/shares/:token
+func (h *Handlers) GetPublicFileShare(c *gin.Context) {
+	share := h.resolveFileShare(c)
+	if share == nil {
+		return
+	}
+
+	resp := gin.H{
+		"name":      filepath.Base(share.Path),
+		"isFolder":  share.IsFolder,
+		"mode":      share.Mode,
+		"expiresAt": share.ExpiresAt,
+	}
+	if share.Mode != db.FileShareModeRead {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	sub := strings.Trim(c.Query("path"), "/")
+	target, fullPath, ok := h.resolveShareTarget(share, sub)
+	if !ok {
+		RespondCoded(c, http.StatusBadRequest, "LIBRARY_INVALID_PATH", "Invalid path")
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		RespondCoded(c, http.StatusNotFound, "LIBRARY_NOT_FOUND", "File not found")
+		return
+	}
+	if !info.IsDir() {
+		resp["size"] = info.Size()
+		resp["modifiedAt"] = info.ModTime().UnixMilli()
+		resp["mimeType"] = utils.DetectMimeType(target)
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	dirEntries, err := os.ReadDir(fullPath)
+	if err != nil {
+		RespondInternalError(c, "Failed to read folder")
+		return
+	}
+	previews, _ := h.server.IndexDB().GetPreviewSqlarMap(target)
+
+	shareRoot := h.server.FS().ResolvePath(share.Path)
+	entries := make([]sharedEntry, 0, len(dirEntries))
+	for _, de := range dirEntries {
+		if strings.HasPrefix(de.Name(), ".") {
+			continue
+		}
+		fi, err := de.Info()
+		if err != nil {
+			continue
+		}
+		// Symlinks list as what they point at, and only when that is
+		// inside the share.
+		if de.Type()&os.ModeSymlink != 0 {
+			child := filepath.Join(fullPath, de.Name())
+			if !withinShare(shareRoot, child) {
+				continue
+			}
+			if fi, err = os.Stat(child); err != nil {
+				continue
+			}
+		}
+		e := sharedEntry{
+			Name:       de.Name(),
+			Path:       path.Join(sub, de.Name()),
+			Type:       "file",
+			ModifiedAt: fi.ModTime().UnixMilli(),
+		}
+		if fi.IsDir() {
+			e.Type = "folder"
+		} else {
+			e.Size = fi.Size()
+			_, e.HasPreview = previews[de.Name()]
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Type != entries[j].Type {
+			return entries[i].Type == "folder"
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	resp["path"] = sub
+	resp["entries"] = entries
+	c.JSON(http.StatusOK, resp)
+}
+
+// UnlockPublicFileShare handles POST /api/public/shares/:token/unlock
+func (h *Handlers) UnlockPublicFileShare(c *gin.Context) {
+	var body struct {
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		RespondBadRequest(c, "Invalid request body")
+		return
+	}
+	share, err := h.server.AppDB().GetFileShare(c.Param("token"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to resolve file share token")
+		RespondInternalError(c, "Failed to resolve share link")
+		return
+	}
+	if share == nil || share.IsExpired(db.NowMs()) {
+		RespondCoded(c, http.StatusNotFound, "SHARE_NOT_FOUND", "Share link not found")
+		return
+	}
+	if share.PasswordHash != "" &&
+		subtle.ConstantTimeCompare([]byte(hashPassword(body.Password)), []byte(share.PasswordHash)) != 1 {
+		log.Warn().Str("token", share.Token[:8]+"...").Msg("share unlock with invalid password")
+		RespondCoded(c, http.StatusUnauthorized, "SHARE_INVALID_PASSWORD", "Invalid password")
+		return
+	}
+
+	maxAge := sessionCookieMaxAge
+	if share.ExpiresAt != nil {
+		maxAge = int(time.Until(time.UnixMilli(*share.ExpiresAt)).Seconds())
+	}
+	secure := !config.Get().IsDevelopment()
+	c.SetCookie(shareCookieName(share.Token), shareUnlockValue(share), maxAge, "/api/public/shares/"+share.Token, "", secure, true)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ServePublicFileShareRaw handles GET /api/public/shares/:token/raw/*path
+func (h *Handlers) ServePublicFileShareRaw(c *gin.Context) {
+	share := h.resolveFileShare(c)
+	if share == nil || !requireShareMode(c, share, db.FileShareModeRead) {
+		return
+	}
+	target, _, ok := h.resolveShareTarget(share, c.Param("path"))
+	if !ok {
+		RespondCoded(c, http.StatusBadRequest, "LIBRARY_INVALID_PATH", "Invalid path")
+		return
+	}
+	h.recordShareAccess(c, share)
+	h.serveLibraryFile(c, target)
+}
+
+// DownloadPublicFileShare handles GET /api/public/shares/:token/download
+func (h *Handlers) DownloadPublicFileShare(c *gin.Context) {
+	share := h.resolveFileShare(c)
+	if share == nil || !requireShareMode(c, share, db.FileShareModeRead) {
+		return
+	}
+	target, _, ok := h.resolveShareTarget(share, c.Query("path"))
+	if !ok {
+		RespondCoded(c, http.StatusBadRequest, "LIBRARY_INVALID_PATH", "Invalid path")
+		return
+	}
+	h.recordShareAccess(c, share)
+	h.serveLibraryDownload(c, target)
+}
+
+// ServePublicFileSharePreview handles GET /api/public/shares/:token/preview/*path
+func (h *Handlers) ServePublicFileSharePreview(c *gin.Context) {
+	share := h.resolveFileShare(c)
+	if share == nil || !requireShareMode(c, share, db.FileShareModeRead) {
+		return
+	}
+	target, _, ok := h.resolveShareTarget(share, c.Param("path"))
+	if !ok {
+		RespondCoded(c, http.StatusBadRequest, "LIBRARY_INVALID_PATH", "Invalid path")
+		return
+	}
+	rec, err := h.server.IndexDB().GetFileByPath(target)
+	if err != nil || rec == nil || rec.PreviewSqlar == nil || *rec.PreviewSqlar == "" {
+		RespondCoded(c, http.StatusNotFound, "PREVIEW_NOT_FOUND", "No preview available")
+		return
+	}
+	h.serveSqlarEntry(c, *rec.PreviewSqlar)
+}
+
+// UploadPublicFileShare handles PUT /api/public/shares/:token/upload/*name.
+// Drop-box uploads land directly in the shared folder; existing files are
+// never overwritten.
+func (h *Handlers) UploadPublicFileShare(c *gin.Context) {
+	share := h.resolveFileShare(c)
+	if share == nil || !requireShareMode(c, share, db.FileShareModeDropbox) {
+		return
+	}
+	name := strings.Trim(c.Param("name"), "/")
+	if name == "" || strings.Contains(name, "/") || strings.Contains(name, "..") || strings.HasPrefix(name, ".") {
+		RespondCoded(c, http.StatusBadRequest, "LIBRARY_INVALID_PATH", "Invalid file name")
+		return
+	}
+	target := path.Join(share.Path, name)
+	// Lstat: a symlink by that name, even a dangling one, is taken.
+	if _, err := os.Lstat(h.server.FS().ResolvePath(target)); err == nil {
+		RespondCoded(c, http.StatusConflict, "LIBRARY_FILE_CONFLICT", "A file with this name already exists")
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, shareUploadMaxBytes)
+	result, err := h.server.FS().WriteFile(c.Request.Context(), fs.WriteRequest{
+		Path:            target,
+		Content:         c.Request.Body,
+		MimeType:        utils.DetectMimeType(name),
+		Source:          "share-dropbox",
+		ComputeMetadata: true,
+		Sync:            false,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("path", target).Msg("share drop-box upload failed")
+		if respondWriteLimitError(c, err) {
+			return
+		}
+		RespondCoded(c, http.StatusInternalServerError, "UPLOAD_WRITE_FAILED", "Failed to save file")
+		return
+	}
+	h.recordShareAccess(c, share)
+	h.server.Notifications().NotifyLibraryChanged(target, "create")
+
+	log.Info().Str("path", target).Bool("isNew", result.IsNew).Msg("share drop-box upload saved")
+	c.JSON(http.StatusCreated, gin.H{"name": name})
+}
+
+func (h *Handlers) recordShareAccess(c *gin.Context, share *db.FileShareRecord) {
+	if err := h.server.AppDB().RecordFileShareAccess(c.Request.Context(), share.Token); err != nil {
+		log.Warn().Err(err).Msg("failed to record share access")
+	}
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
+	"github.com/xiaoyuanzhu-com/my-life-db/server"
+)
+
+// newPublicShareRouter serves the public share routes over a temp library.
+func newPublicShareRouter(t *testing.T) (*gin.Engine, *db.DB, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	root := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	appDB := openTestAppDB(t)
+	srv := server.NewForTesting(ctx, &server.Config{UserDataDir: root}, appDB)
+	srv.SetFSForTesting(fs.NewService(fs.Config{DataRoot: root, DB: trashIndex{}}))
+	h := &Handlers{server: srv}
+
+	r := gin.New()
+	r.GET("/api/public/shares/:token", h.GetPublicFileShare)
+	r.GET("/api/public/shares/:token/download", h.DownloadPublicFileShare)
+	return r, appDB, root
+}
+
+// createTestShare stores a read link to path made by userID.
+func createTestShare(t *testing.T, appDB *db.DB, token, path string, isFolder bool, userID string) {
+	t.Helper()
+	share := &db.FileShareRecord{Token: token, Path: path, IsFolder: isFolder, Mode: db.FileShareModeRead, UserID: userID}
+	if err := appDB.CreateFileShare(context.Background(), share); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShareTargetPath(t *testing.T) {
+	folder := &db.FileShareRecord{Path: "photos/2024", IsFolder: true}
+	file := &db.FileShareRecord{Path: "docs/report.pdf"}
+
+	cases := []struct {
+		name   string
+		share  *db.FileShareRecord
+		sub    string
+		want   string
+		wantOK bool
+	}{
+		{"folder root", folder, "", "photos/2024", true},
+		{"folder root slash", folder, "/", "photos/2024", true},
+		{"folder child", folder, "/trip/a.jpg", "photos/2024/trip/a.jpg", true},
+		{"folder traversal", folder, "../secret.txt", "", false},
+		{"folder nested traversal", folder, "trip/../../x", "", false},
+		{"file root", file, "", "docs/report.pdf", true},
+		{"file sub path", file, "other.pdf", "", false},
+	}
+	for _, tc := range cases {
+		got, ok := shareTargetPath(tc.share, tc.sub)
+		if ok != tc.wantOK || got != tc.want {
+			t.Errorf("%s: shareTargetPath(%q) = (%q, %v), want (%q, %v)", tc.name, tc.sub, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestWithinShare_Symlinks(t *testing.T) {
+	dir := t.TempDir()
+	share := filepath.Join(dir, "shared")
+	outside := filepath.Join(dir, "private")
+	for _, d := range []string{filepath.Join(share, "sub"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{filepath.Join(share, "sub", "a.txt"), filepath.Join(outside, "secret.txt")} {
+		if err := os.WriteFile(f, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"in-share":  filepath.Join(share, "sub", "a.txt"),
+		"to-file":   filepath.Join(outside, "secret.txt"),
+		"to-folder": outside,
+		"dangling":  filepath.Join(outside, "gone.txt"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(share, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{share, true},
+		{filepath.Join(share, "sub", "a.txt"), true},
+		{filepath.Join(share, "in-share"), true},
+		{filepath.Join(share, "missing.txt"), true}, // 404s later
+		{filepath.Join(share, "to-file"), false},
+		{filepath.Join(share, "to-folder"), false},
+		{filepath.Join(share, "to-folder", "secret.txt"), false},
+		{filepath.Join(share, "dangling"), false},
+	}
+	for _, tc := range cases {
+		if got := withinShare(share, tc.path); got != tc.want {
+			t.Errorf("withinShare(%s) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestShareUnlockValueBindsPassword(t *testing.T) {
+	a := &db.FileShareRecord{Token: "tok", PasswordHash: hashPassword("one")}
+	b := &db.FileShareRecord{Token: "tok", PasswordHash: hashPassword("two")}
+	if shareUnlockValue(a) == shareUnlockValue(b) {
+		t.Fatal("changing the password must invalidate unlock cookies")
+	}
+}
+
+func TestPublicShare_FolderDownloadSkipsSymlinks(t *testing.T) {
+	r, appDB, root := newPublicShareRouter(t)
+	writeLibraryFile(t, root, "shared/a.txt", "shared")
+	writeLibraryFile(t, root, "shared/sub/b.txt", "shared too")
+	writeLibraryFile(t, root, "private/secret.txt", "secret")
+	for name, target := range map[string]string{
+		"shared/leak.txt": filepath.Join(root, "private/secret.txt"),
+		"shared/leakdir":  filepath.Join(root, "private"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createTestShare(t, appDB, "tok", "shared", true, db.OwnerUserID)
+
+	w := serveJSON(r, http.MethodGet, "/api/public/shares/tok/download", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("download: status %d, body %s", w.Code, w.Body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"shared/a.txt", "shared/sub/b.txt"}; !slices.Equal(names, want) {
+		t.Fatalf("zip holds %v, want %v", names, want)
+	}
+
+	if w := serveJSON(r, http.MethodGet, "/api/public/shares/tok/download?path=leak.txt", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("download through symlink: status %d", w.Code)
+	}
+}
+
+func TestPublicShare_FollowsOwnerAccount(t *testing.T) {
+	r, appDB, root := newPublicShareRouter(t)
+	ctx := context.Background()
+	writeLibraryFile(t, root, "members/ann/a.txt", "ann's")
+	ann, err := appDB.CreateUser(ctx, "ann", "Ann", hashPassword("pw"), db.UserRoleMember, "members/ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	createTestShare(t, appDB, "tok", "members/ann/a.txt", false, ann.ID)
+	status := func() int {
+		t.Helper()
+		return serveJSON(r, http.MethodGet, "/api/public/shares/tok", nil).Code
+	}
+	if code := status(); code != http.StatusOK {
+		t.Fatalf("live link: status %d", code)
+	}
+
+	// Narrowing the account's data root drops links outside it.
+	ann.DataRoot = "members/ann/new"
+	if err := appDB.UpdateUser(ctx, ann); err != nil {
+		t.Fatal(err)
+	}
+	if code := status(); code != http.StatusNotFound {
+		t.Fatalf("link outside the narrowed root: status %d, want 404", code)
+	}
+
+	// So does disabling the account.
+	ann.DataRoot = "members/ann"
+	disabledAt := db.NowMs()
+	ann.DisabledAt = &disabledAt
+	if err := appDB.UpdateUser(ctx, ann); err != nil {
+		t.Fatal(err)
+	}
+	if code := status(); code != http.StatusNotFound {
+		t.Fatalf("disabled owner: status %d, want 404", code)
+	}
+	ann.DisabledAt = nil
+	if err := appDB.UpdateUser(ctx, ann); err != nil {
+		t.Fatal(err)
+	}
+	if code := status(); code != http.StatusOK {
+		t.Fatalf("re-enabled owner: status %d", code)
+	}
+
+	// And deleting it revokes the link.
+	if err := appDB.DeleteUser(ctx, ann.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := status(); code != http.StatusNotFound {
+		t.Fatalf("deleted owner: status %d, want 404", code)
+	}
+	if share, _ := appDB.GetFileShare("tok"); share != nil {
+		t.Fatal("link survived its owner")
+	}
+
+	// A link left behind by an account deleted before links were revoked
+	// with it doesn't serve either.
+	createTestShare(t, appDB, "orphan", "members/ann/a.txt", false, ann.ID)
+	if w := serveJSON(r, http.MethodGet, "/api/public/shares/orphan", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("orphaned link: status %d, want 404", w.Code)
+	}
+}
@@ -23,6 +23,7 @@ import (
 )
 
 // ServeRawFile handles GET /raw/*path
+// With w or h in the query, images are served resized (see previews.go).
 func (h *Handlers) ServeRawFile(c *gin.Context) {
 	// Get path from URL (everything after /raw/)
 	path := c.Param("path")
@@ -39,8 +40,19 @@ func (h *Handlers) ServeRawFile(c *gin.Context) {
 		return
 	}
 
-	cfg := config.Get()
-	fullPath := filepath.Join(cfg.UserDataDir, path)
+	if resizeRequested(c) {
+		h.serveResizedRaw(c, path)
+		return
+	}
+	h.serveLibraryFile(c, path)
+}
+
+// serveLibraryFile streams the USER_DATA_DIR-relative file at path (which
+// may lie in a mounted folder) with conditional-request handling. Callers
+// own path validation and access control; shared by /raw and the public
+// share-link routes.
+func (h *Handlers) serveLibraryFile(c *gin.Context, path string) {
+	fullPath := h.server.FS().ResolvePath(path)
 
 	// Check if file exists
 	info, err := os.Stat(fullPath)
@@ -92,6 +104,12 @@ func (h *Handlers) SaveRawFile(c *gin.Context) {
 		return
 	}
 
+	if c.Request.ContentLength > 0 {
+		if err := h.server.FS().CheckWriteSize(path, c.Request.ContentLength); respondWriteLimitError(c, err) {
+			return
+		}
+	}
+
 	// Use fs.Service.WriteFile() - single entry point for all file operations
 	// This handles: file locking, metadata computation (hash, text preview), DB upsert
 	mimeType := utils.DetectMimeType(path)
@@ -105,6 +123,9 @@ func (h *Handlers) SaveRawFile(c *gin.Context) {
 	})
 	if err != nil {
 		log.Error().Err(err).Str("path", path).Msg("failed to write file")
+		if respondWriteLimitError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write file"})
 		return
 	}
@@ -127,6 +148,27 @@ func (h *Handlers) ServeSqlarFile(c *gin.Context) {
 		return
 	}
 
+	// A scoped account only gets the thumbnails of files under its data
+	// root. Entries are keyed by path hash, so look up which file owns it.
+	if root := db.NormalizeDataRoot(CurrentUser(c).DataRoot); root != "" {
+		ok, err := h.server.IndexDB().HasPreviewSqlarUnder(root, name)
+		if err != nil {
+			log.Error().Err(err).Str("name", name).Msg("failed to check sqlar entry scope")
+			RespondInternalError(c, "Failed to load file")
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found in archive"})
+			return
+		}
+	}
+
+	h.serveSqlarEntry(c, name)
+}
+
+// serveSqlarEntry serves one (possibly zlib-compressed) sqlar entry with
+// immutable caching. Shared by /sqlar and the public share-link previews.
+func (h *Handlers) serveSqlarEntry(c *gin.Context, name string) {
 	// Query sqlar table (lives in the index DB)
 	var sqlarFile db.SqlarFile
 	err := h.server.IndexDB().Read().QueryRow(`
@@ -193,8 +235,14 @@ func (h *Handlers) DownloadLibraryPath(c *gin.Context) {
 		return
 	}
 
-	cfg := config.Get()
-	fullPath := filepath.Join(cfg.UserDataDir, path)
+	h.serveLibraryDownload(c, path)
+}
+
+// serveLibraryDownload sends the USER_DATA_DIR-relative path as an
+// attachment: files stream as-is, folders as a zip. Callers own path
+// validation and access control.
+func (h *Handlers) serveLibraryDownload(c *gin.Context, path string) {
+	fullPath := h.server.FS().ResolvePath(path)
 
 	info, err := os.Stat(fullPath)
 	if os.IsNotExist(err) {
@@ -237,8 +285,11 @@ func (h *Handlers) downloadFolder(c *gin.Context, fullPath, name string) {
 		if err != nil {
 			return err
 		}
-		// Skip directories as entries (they're implied by file paths)
-		if info.IsDir() {
+		// Skip directories as entries (they're implied by file paths), and
+		// anything that isn't a plain file: Walk doesn't follow symlinks,
+		// but os.Open would, zipping whatever they point at — possibly
+		// outside the folder or the caller's data root.
+		if !info.Mode().IsRegular() {
 			return nil
 		}
 
@@ -322,6 +373,10 @@ func parseFields(fieldsParam string) fieldSet {
 //   - query: search query for server-side filtering (returns flat results)
 func (h *Handlers) GetLibraryTree(c *gin.Context) {
 	requestedPath := c.Query("path")
+	if requestedPath == "" {
+		// Scoped accounts see their data root as the tree root.
+		requestedPath = db.NormalizeDataRoot(CurrentUser(c).DataRoot)
+	}
 
 	// Parse depth (default: 1)
 	depth := 1
@@ -366,9 +421,10 @@ func (h *Handlers) GetLibraryTree(c *gin.Context) {
 		fullPath = requestedPath
 		requestedPath = "" // relative path within baseDir is empty
 	} else {
-		// Relative path: join with UserDataDir
+		// Relative path: resolve within the library (mounted folders
+		// included)
 		baseDir = cfg.UserDataDir
-		fullPath = filepath.Join(cfg.UserDataDir, requestedPath)
+		fullPath = h.server.FS().ResolvePath(requestedPath)
 	}
 
 	// Check if path exists
@@ -484,11 +540,19 @@ func (h *Handlers) searchFiles(rootPath, requestedPath, query string, limit int,
 	return results, totalWalked
 }
 
+// readTreeDir lists relativePath under baseDir: through fs.Service when
+// baseDir is the library, so mounted folders show up, and straight from
+// disk otherwise.
+func (h *Handlers) readTreeDir(baseDir, relativePath string) ([]os.DirEntry, error) {
+	if baseDir == config.Get().UserDataDir {
+		return h.server.FS().ReadDir(relativePath)
+	}
+	return os.ReadDir(filepath.Join(baseDir, relativePath))
+}
+
 // readDirRecursive reads directory contents recursively up to specified depth
 func (h *Handlers) readDirRecursive(baseDir, relativePath string, maxDepth, currentDepth int, fields fieldSet, count *int, limit int, foldersOnly bool) []FileNode {
-	fullPath := filepath.Join(baseDir, relativePath)
-
-	entries, err := os.ReadDir(fullPath)
+	entries, err := h.readTreeDir(baseDir, relativePath)
 	if err != nil {
 		return []FileNode{}
 	}
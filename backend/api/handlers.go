@@ -1,25 +1,44 @@
 package api
 
-import "github.com/xiaoyuanzhu-com/my-life-db/server"
+import (
+	"path/filepath"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/s3"
+	"github.com/xiaoyuanzhu-com/my-life-db/server"
+)
 
 // Handlers holds references to server components and the agent session manager.
 type Handlers struct {
 	server   *server.Server
 	agentMgr *AgentManager
+	s3       *s3.Handler
 }
 
 // NewHandlers creates a new Handlers instance wired to the given server.
-// Constructs the AgentManager, which owns the in-memory ACP session state.
+// Constructs the AgentManager, which owns the in-memory ACP session state,
+// and the S3 protocol handler.
 func NewHandlers(srv *server.Server) *Handlers {
 	mgr := NewAgentManager(srv)
 	if fs := srv.FrameStore(); fs != nil {
 		mgr.SetFrameStore(fs)
 	}
+	if srv.HandedOver() {
+		mgr.TrackPredecessorTurns()
+	}
 	mgr.StartIdleReaper()
-	return &Handlers{
+	mgr.StartSessionSchedules()
+	mgr.StartApprovalSweeper()
+	h := &Handlers{
 		server:   srv,
 		agentMgr: mgr,
 	}
+	// Multipart parts are staged under APP_DATA_DIR so half-finished
+	// uploads never show up in the library.
+	h.s3 = s3.NewHandler(srv.FS(), h.lookupS3Credential, s3MountPrefix,
+		filepath.Join(srv.Cfg().AppDataDir, "s3-multipart"))
+	// Drop WebDAV upload spools orphaned by a crash mid-request.
+	sweepWebDAVStaging(h.webdavStagingDir())
+	return h
 }
 
 // AgentMgr exposes the session manager so external wiring (e.g. agentrunner
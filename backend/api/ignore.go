@@ -0,0 +1,31 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
+)
+
+// ExplainIgnore handles GET /api/data/ignore/explain?path=...
+//
+// Reports whether a USER_DATA_DIR-relative path is excluded from indexing
+// and, if a rule decided it, which one: a built-in skip name, a settings
+// pattern, or a line of a .mldbignore file. The path need not exist.
+func (h *Handlers) ExplainIgnore(c *gin.Context) {
+	path := strings.Trim(c.Query("path"), "/")
+	if path == "" {
+		RespondBadRequest(c, "Path is required")
+		return
+	}
+	if err := h.server.FS().ValidatePath(path); err != nil {
+		RespondBadRequest(c, "Invalid path")
+		return
+	}
+
+	RespondData(c, struct {
+		Path string `json:"path"`
+		fs.IgnoreMatch
+	}{path, h.server.FS().ExplainExcluded(path)})
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/jobs"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// Background jobs: the persistent queue behind previews, text and media
+// indexing and session transcripts (see package jobs).
+//
+//	GET  /api/system/jobs?failures=
+//	POST /api/system/jobs/prioritize   {paths}
+//	POST /api/system/jobs/pause        {kind?}
+//	POST /api/system/jobs/resume       {kind?}
+//	POST /api/system/jobs/retry        {kind?}
+//
+// Progress is also pushed on the event stream (/api/data/events) as
+// jobs-progress events carrying the same stats, at most once a second
+// while the queue changes. Prioritize is for the paths a client has on
+// screen; the control routes are admin-only, as are the failed jobs
+// listed by GET, since their keys are paths anywhere in the library.
+
+const (
+	jobsDefaultFailures = 20
+	jobsMaxFailures     = 200
+	jobsMaxPrioritize   = 500
+)
+
+// JobsResponse is the response of GET /api/system/jobs.
+type JobsResponse struct {
+	jobs.Stats
+	Failures []db.Job `json:"failures,omitempty"`
+}
+
+// GetJobs handles GET /api/system/jobs
+func (h *Handlers) GetJobs(c *gin.Context) {
+	q := h.server.Jobs()
+	stats, err := q.Stats()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read job stats")
+		RespondInternalError(c, "Failed to read job queue")
+		return
+	}
+	resp := JobsResponse{Stats: stats}
+
+	if CurrentUser(c).IsAdmin() {
+		limit := jobsDefaultFailures
+		if l, err := strconv.Atoi(c.Query("failures")); err == nil && l >= 0 {
+			limit = min(l, jobsMaxFailures)
+		}
+		if limit > 0 {
+			resp.Failures, err = q.Failures(c.Query("kind"), limit)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to list failed jobs")
+				RespondInternalError(c, "Failed to read job queue")
+				return
+			}
+		}
+	}
+	RespondData(c, resp)
+}
+
+// PrioritizeJobs handles POST /api/system/jobs/prioritize
+func (h *Handlers) PrioritizeJobs(c *gin.Context) {
+	var req struct {
+		Paths []string `json:"paths"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Paths) == 0 {
+		RespondBadRequest(c, "paths is required")
+		return
+	}
+	if len(req.Paths) > jobsMaxPrioritize {
+		RespondBadRequest(c, "Too many paths (max "+strconv.Itoa(jobsMaxPrioritize)+")")
+		return
+	}
+	for i, p := range req.Paths {
+		p = strings.Trim(p, "/")
+		if !validateRelPath(c, p) || !requirePathAccess(c, p) {
+			return
+		}
+		req.Paths[i] = p
+	}
+
+	n, err := h.server.Jobs().Prioritize(c.Request.Context(), req.Paths)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to prioritize jobs")
+		RespondInternalError(c, "Failed to prioritize jobs")
+		return
+	}
+	RespondData(c, gin.H{"prioritized": n})
+}
+
+// jobKindRequest is the optional body of the control routes; an empty
+// kind means every kind.
+type jobKindRequest struct {
+	Kind string `json:"kind"`
+}
+
+// PauseJobs handles POST /api/system/jobs/pause
+func (h *Handlers) PauseJobs(c *gin.Context) {
+	req, ok := bindJobKind(c)
+	if !ok {
+		return
+	}
+	if err := h.server.Jobs().Pause(req.Kind); err != nil {
+		respondJobsError(c, err)
+		return
+	}
+	h.respondJobStats(c)
+}
+
+// ResumeJobs handles POST /api/system/jobs/resume
+func (h *Handlers) ResumeJobs(c *gin.Context) {
+	req, ok := bindJobKind(c)
+	if !ok {
+		return
+	}
+	if err := h.server.Jobs().Resume(req.Kind); err != nil {
+		respondJobsError(c, err)
+		return
+	}
+	h.respondJobStats(c)
+}
+
+// RetryJobs handles POST /api/system/jobs/retry
+func (h *Handlers) RetryJobs(c *gin.Context) {
+	req, ok := bindJobKind(c)
+	if !ok {
+		return
+	}
+	n, err := h.server.Jobs().RetryFailed(c.Request.Context(), req.Kind)
+	if err != nil {
+		respondJobsError(c, err)
+		return
+	}
+	RespondData(c, gin.H{"retried": n})
+}
+
+// bindJobKind reads the optional {kind} body.
+func bindJobKind(c *gin.Context) (jobKindRequest, bool) {
+	var req jobKindRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			RespondBadRequest(c, "Invalid request body")
+			return req, false
+		}
+	}
+	return req, true
+}
+
+func (h *Handlers) respondJobStats(c *gin.Context) {
+	stats, err := h.server.Jobs().Stats()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read job stats")
+		RespondInternalError(c, "Failed to read job queue")
+		return
+	}
+	RespondData(c, stats)
+}
+
+func respondJobsError(c *gin.Context, err error) {
+	if errors.Is(err, jobs.ErrUnknownKind) {
+		RespondCoded(c, http.StatusBadRequest, "JOBS_UNKNOWN_KIND", err.Error())
+		return
+	}
+	log.Error().Err(err).Msg("job queue operation failed")
+	RespondInternalError(c, "Job queue operation failed")
+}
@@ -3,9 +3,11 @@ package api
 import (
 	"crypto/subtle"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/xiaoyuanzhu-com/my-life-db/auth"
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 )
 
@@ -15,12 +17,15 @@ import (
 // Backend supports two modes:
 //
 //	none      — all APIs are open
-//	password  — accepts either an owner-session cookie (set by
+//	password  — accepts either a session cookie (set by
 //	            POST /api/system/auth/login) or HTTP Basic Auth. WebDAV
 //	            clients (Finder, iOS Files, rclone, Obsidian Remotely Save)
 //	            send Basic Auth and cannot manage a session cookie, so
 //	            both shapes share the same gate.
 //
+// Either way the authenticated account is stored on the request context
+// (see CurrentUser); "none" mode leaves it unset, which reads as the owner.
+//
 // Third-party access (OAuth, Connect, scope tokens) is the cloud gateway's
 // responsibility, not the backend's.
 func (h *Handlers) AuthMiddleware() gin.HandlerFunc {
@@ -31,17 +36,23 @@ func (h *Handlers) AuthMiddleware() gin.HandlerFunc {
 		}
 		if auth.IsPasswordAuthEnabled() {
 			// Session cookie path (web UI).
-			if h.ValidatePasswordSession(c) != nil {
-				c.Next()
-				return
+			if session := h.ValidatePasswordSession(c); session != nil {
+				if u := h.resolveSessionUser(session); u != nil {
+					setCurrentUser(c, u)
+					c.Next()
+					return
+				}
 			}
-			// HTTP Basic Auth path (WebDAV clients + curl). The
-			// username is ignored — only the password is verified
-			// against the stored owner password hash, matching the
-			// single-user model of POST /api/system/auth/login.
-			if _, pass, ok := c.Request.BasicAuth(); ok && h.validatePasswordBasic(pass) {
-				c.Next()
-				return
+			// HTTP Basic Auth path (WebDAV clients + curl). The owner
+			// password is accepted with any username, matching the
+			// single-owner model of POST /api/system/auth/login; other
+			// accounts must send their own username.
+			if user, pass, ok := c.Request.BasicAuth(); ok {
+				if u := h.validateBasic(user, pass); u != nil {
+					setCurrentUser(c, u)
+					c.Next()
+					return
+				}
 			}
 			// No valid credential. WebDAV clients require a Basic
 			// challenge to prompt the user; emit it on every 401 so
@@ -75,3 +86,28 @@ func (h *Handlers) validatePasswordBasic(pass string) bool {
 	presented := hashPassword(pass)
 	return subtle.ConstantTimeCompare([]byte(presented), []byte(storedHash)) == 1
 }
+
+// validateBasic resolves HTTP Basic credentials to an account: an empty
+// username or "owner" is checked against the owner password, any other
+// username + password must match an enabled row in the users table.
+// Returns nil on failure.
+func (h *Handlers) validateBasic(user, pass string) *db.UserRecord {
+	if user == "" || strings.EqualFold(user, db.OwnerUser().Username) {
+		if h.validatePasswordBasic(pass) {
+			return db.OwnerUser()
+		}
+		return nil
+	}
+	u, err := h.server.AppDB().GetUserByUsername(user)
+	if err != nil {
+		log.Error().Err(err).Msg("auth: failed to look up basic auth user")
+		return nil
+	}
+	if u == nil || u.DisabledAt != nil {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashPassword(pass)), []byte(u.PasswordHash)) != 1 {
+		return nil
+	}
+	return u
+}
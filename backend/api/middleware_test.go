@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/server"
+)
+
+func TestValidateBasic_OwnerPasswordOnlyForOwner(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	appDB := openTestAppDB(t)
+	h := &Handlers{server: server.NewForTesting(ctx, &server.Config{UserDataDir: t.TempDir()}, appDB)}
+	if err := appDB.SetSetting(ctx, "auth_password_hash", hashPassword("owner-pw")); err != nil {
+		t.Fatal(err)
+	}
+	ann, err := appDB.CreateUser(ctx, "ann", "Ann", hashPassword("owner-pw"), db.UserRoleMember, "members/ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := appDB.CreateUser(ctx, "bob", "Bob", hashPassword("bob-pw"), db.UserRoleMember, "members/bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		user, pass string
+		ok         bool
+		want       string // account ID when ok
+	}{
+		{"", "owner-pw", true, db.OwnerUserID},
+		{"owner", "owner-pw", true, db.OwnerUserID},
+		{"Owner", "owner-pw", true, db.OwnerUserID},
+		{"owner", "bob-pw", false, ""},
+		// A member sharing the owner's password is still only that member.
+		{"ann", "owner-pw", true, ann.ID},
+		// Any other username with the owner password is rejected.
+		{"bob", "owner-pw", false, ""},
+		{"nobody", "owner-pw", false, ""},
+		{"", "bob-pw", false, ""},
+	}
+	for _, c := range cases {
+		u := h.validateBasic(c.user, c.pass)
+		if (u != nil) != c.ok || (u != nil && u.ID != c.want) {
+			t.Errorf("validateBasic(%q, %q) = %+v, want ok=%v id=%q", c.user, c.pass, u, c.ok, c.want)
+		}
+	}
+}
@@ -6,16 +6,18 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 	"github.com/xiaoyuanzhu-com/my-life-db/notifications"
 )
 
 // NotificationStream handles GET /api/data/events (SSE).
 //
-// All subscribers see every event. The backend is user-agnostic — third-party
-// scope filtering is the responsibility of the upstream gateway, not this
-// process.
+// Each subscriber sees the events of its own account: file events under its
+// data root and agent events for sessions it can access (eventVisible).
 func (h *Handlers) NotificationStream(c *gin.Context) {
+	visible := h.eventVisible(CurrentUser(c))
+
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
@@ -52,6 +54,9 @@ func (h *Handlers) NotificationStream(c *gin.Context) {
 			if !ok {
 				return
 			}
+			if !visible(event) {
+				continue
+			}
 			sendSSEEventGin(c, event)
 			c.Writer.Flush()
 
@@ -67,6 +72,35 @@ func (h *Handlers) NotificationStream(c *gin.Context) {
 	}
 }
 
+// eventVisible returns the filter for u's event stream. Path events are
+// limited to u's data root; agent session and approval events, to sessions
+// u may access (admins see all). Session ownership is looked up once per
+// session and remembered for the life of the stream.
+func (h *Handlers) eventVisible(u *db.UserRecord) func(notifications.Event) bool {
+	owned := map[string]bool{}
+	return func(e notifications.Event) bool {
+		if e.Path != "" && !u.CanAccessPath(e.Path) {
+			return false
+		}
+		switch e.Type {
+		case notifications.EventAgentSessionUpdated, notifications.EventAgentApproval:
+			if u.IsAdmin() {
+				return true
+			}
+			data, _ := e.Data.(map[string]interface{})
+			sessionID, _ := data["sessionId"].(string)
+			ok, seen := owned[sessionID]
+			if !seen {
+				rec, err := h.server.AppDB().GetAgentSession(sessionID)
+				ok = err == nil && rec != nil && rec.UserID == u.ID
+				owned[sessionID] = ok
+			}
+			return ok
+		}
+		return true
+	}
+}
+
 func sendSSEEventGin(c *gin.Context, event notifications.Event) {
 	data, err := json.Marshal(event)
 	if err != nil {
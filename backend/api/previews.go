@@ -0,0 +1,170 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+	"github.com/xiaoyuanzhu-com/my-life-db/utils"
+)
+
+// Responsive images: previews and resizes rendered on request and cached
+// in SQLAR (see fs/renditions.go).
+//
+//	GET /preview/*path?size=small|medium|large[&v=]
+//	GET /raw/*path?w=&h=&fit=contain|cover|fill[&v=]
+//
+// /preview works for any file with a preview generator (images, video,
+// documents, music with cover art); /raw resizes images only and ignores
+// the parameters for anything else. WebP is sent to clients that accept
+// it when an encoder is installed, JPEG otherwise.
+//
+// The ETag names the source file's size and mtime plus the variant, so it
+// is checked before anything is rendered. Responses revalidate by default;
+// a v parameter (any value, typically the file's hash or mtime) marks the
+// URL as versioned and makes the response immutable.
+
+// ServePreview handles GET /preview/*path
+func (h *Handlers) ServePreview(c *gin.Context) {
+	path := strings.TrimPrefix(c.Param("path"), "/")
+	if path == "" || strings.Contains(path, "..") {
+		RespondCoded(c, http.StatusBadRequest, "LIBRARY_INVALID_PATH", "Invalid path")
+		return
+	}
+	size := c.DefaultQuery("size", fs.PreviewMedium)
+	if size != fs.PreviewSmall && size != fs.PreviewMedium && size != fs.PreviewLarge {
+		respondRenditionError(c, path, fs.ErrUnsupportedPreviewSize)
+		return
+	}
+
+	h.serveRendition(c, path, "preview-"+size, func(format string) (*fs.Rendition, error) {
+		return h.server.FS().PreviewRendition(c.Request.Context(), path, size, format)
+	})
+}
+
+// resizeRequested reports whether a /raw request asks for a resize.
+func resizeRequested(c *gin.Context) bool {
+	return c.Query("w") != "" || c.Query("h") != ""
+}
+
+// serveResizedRaw handles GET /raw/*path with w/h/fit. Callers own path
+// validation and access control.
+func (h *Handlers) serveResizedRaw(c *gin.Context, path string) {
+	if !strings.HasPrefix(utils.DetectMimeType(path), "image/") {
+		h.serveLibraryFile(c, path)
+		return
+	}
+
+	var opts fs.ResizeOptions
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"w", &opts.Width}, {"h", &opts.Height}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > fs.MaxResizeDimension {
+			RespondCoded(c, http.StatusBadRequest, "RESIZE_INVALID_SIZE",
+				fmt.Sprintf("%s must be between 0 and %d", p.name, fs.MaxResizeDimension))
+			return
+		}
+		*p.dst = n
+	}
+	switch opts.Fit = c.DefaultQuery("fit", fs.FitContain); opts.Fit {
+	case fs.FitContain, fs.FitCover, fs.FitFill:
+	default:
+		RespondCoded(c, http.StatusBadRequest, "RESIZE_INVALID_FIT", "fit must be contain, cover or fill")
+		return
+	}
+
+	h.serveRendition(c, path, "raw-"+opts.Variant(), func(format string) (*fs.Rendition, error) {
+		opts.Format = format
+		return h.server.FS().ResizedImage(c.Request.Context(), path, opts)
+	})
+}
+
+// serveRendition negotiates the format, answers conditional requests from
+// the file's stat alone, and otherwise renders (or fetches) the rendition.
+func (h *Handlers) serveRendition(c *gin.Context, path, variant string, render func(format string) (*fs.Rendition, error)) {
+	format := fs.FormatJPEG
+	if fs.WebPAvailable() && strings.Contains(c.GetHeader("Accept"), "image/webp") {
+		format = fs.FormatWebP
+	}
+
+	version, err := h.server.FS().RenditionVersion(path, variant)
+	if err != nil {
+		respondRenditionError(c, path, err)
+		return
+	}
+	if etag := renditionETag(path, version, format); etagMatches(c.GetHeader("If-None-Match"), etag) {
+		setRenditionHeaders(c, etag)
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	r, err := render(format)
+	if err != nil {
+		respondRenditionError(c, path, err)
+		return
+	}
+	if r.MimeType != "image/webp" {
+		format = fs.FormatJPEG
+	}
+	setRenditionHeaders(c, renditionETag(path, version, format))
+	c.Header("Last-Modified", r.ModTime.UTC().Format(http.TimeFormat))
+	c.Header("Content-Type", r.MimeType)
+	http.ServeContent(c.Writer, c.Request, "", r.ModTime, bytes.NewReader(r.Data))
+}
+
+// setRenditionHeaders sets ETag, Cache-Control and Vary for a rendition.
+func setRenditionHeaders(c *gin.Context, etag string) {
+	c.Header("ETag", etag)
+	if c.Query("v") != "" {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+	c.Header("Vary", "Accept, Accept-Encoding")
+}
+
+// renditionETag is strong: the same version and format always encode to
+// the same bytes from the cache.
+func renditionETag(path, version, format string) string {
+	return fmt.Sprintf(`"%s-%s-%s"`, version, format, computePathHash(path))
+}
+
+// etagMatches reports whether an If-None-Match header lists etag.
+func etagMatches(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == etag || t == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func respondRenditionError(c *gin.Context, path string, err error) {
+	switch {
+	case errors.Is(err, fs.ErrFileNotFound):
+		RespondCoded(c, http.StatusNotFound, "LIBRARY_NOT_FOUND", "File not found")
+	case errors.Is(err, fs.ErrIsDirectory), errors.Is(err, fs.ErrInvalidPath):
+		RespondCoded(c, http.StatusBadRequest, "LIBRARY_INVALID_PATH", "Invalid path")
+	case errors.Is(err, fs.ErrUnsupportedPreviewSize):
+		RespondCoded(c, http.StatusBadRequest, "PREVIEW_INVALID_SIZE", "size must be small, medium or large")
+	case errors.Is(err, fs.ErrNoPreview), errors.Is(err, fs.ErrGeneratorUnavailable):
+		RespondCoded(c, http.StatusNotFound, "PREVIEW_UNAVAILABLE", "No preview available for this file")
+	default:
+		log.Error().Err(err).Str("path", path).Msg("failed to render preview")
+		RespondInternalError(c, "Failed to render preview")
+	}
+}
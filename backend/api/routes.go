@@ -11,23 +11,34 @@ import (
 // Auth model:
 //
 //   - "none" (default): all APIs are open
-//   - "password":      AuthMiddleware enforces an owner session cookie or
-//                      HTTP Basic Auth on every /api/* route (and on the
+//   - "password":      AuthMiddleware enforces a session cookie or HTTP
+//                      Basic Auth on every /api/* route (and on the
 //                      /webdav surface) except the password-login + public
-//                      ones.
+//                      ones, and resolves the account (owner, admin or
+//                      member) into the request context.
+//
+// Members may be confined to a data root: DataScopeMiddleware guards the
+// path-addressed file surfaces and AgentSessionAccessMiddleware keeps them
+// on their own agent sessions.
 //
 // Third-party OAuth ("Connect" protocol) lives in the cloud gateway, not
-// the backend. The backend is a user-agnostic data store.
+// the backend.
 func SetupRoutes(r *gin.Engine, h *Handlers) {
 	auth := h.AuthMiddleware()
+	scope := h.DataScopeMiddleware()
+	sessionAccess := h.AgentSessionAccessMiddleware()
 
 	// =========================================================================
 	// Outside `/api/` — byte I/O surfaces
 	// =========================================================================
 	// Raw file serving — owner-only when password mode is on; open otherwise.
-	r.GET("/raw/*path", auth, h.ServeRawFile)
-	r.PUT("/raw/*path", auth, h.SaveRawFile)
+	r.GET("/raw/*path", auth, scope, h.ServeRawFile)
+	r.PUT("/raw/*path", auth, scope, h.SaveRawFile)
+	// Sqlar entries are named by path hash, not path, so the handler checks
+	// them against the caller's data root itself.
 	r.GET("/sqlar/*path", auth, h.ServeSqlarFile)
+	// Preview sizes (small/medium/large) rendered on request, cached in sqlar.
+	r.GET("/preview/*path", auth, scope, h.ServePreview)
 
 	// WebDAV file access at /webdav. Uses the standard auth middleware:
 	// in password mode the middleware accepts HTTP Basic Auth so WebDAV
@@ -40,6 +51,12 @@ func SetupRoutes(r *gin.Engine, h *Handlers) {
 		r.Handle(m, "/webdav/*path", auth, h.WebDAVHandler)
 	}
 
+	// S3-compatible API at /s3 (path-style). Deliberately outside `auth`:
+	// requests are authenticated by their SigV4 signature against the
+	// s3_credentials store, in every auth mode.
+	r.Any("/s3", h.S3Handler)
+	r.Any("/s3/*path", h.S3Handler)
+
 	// =========================================================================
 	// /api/* — public group (no auth required)
 	// =========================================================================
@@ -53,6 +70,17 @@ func SetupRoutes(r *gin.Engine, h *Handlers) {
 		public.GET("/agent/share/:token", h.GetSharedSession)
 		public.GET("/agent/share/:token/messages", h.GetSharedSessionMessages)
 
+		// --- /api/public/shares/:token — public file/folder share links ---
+		// Link-scoped: every path is relative to the shared path, and the
+		// link's mode (read vs drop-box), expiry and password are enforced
+		// per request by resolveFileShare.
+		public.GET("/public/shares/:token", h.GetPublicFileShare)
+		public.POST("/public/shares/:token/unlock", h.UnlockPublicFileShare)
+		public.GET("/public/shares/:token/raw/*path", h.ServePublicFileShareRaw)
+		public.GET("/public/shares/:token/download", h.DownloadPublicFileShare)
+		public.GET("/public/shares/:token/preview/*path", h.ServePublicFileSharePreview)
+		public.PUT("/public/shares/:token/upload/*name", h.UploadPublicFileShare)
+
 		// --- /api/public/apps — public read-only onboarding catalog ---
 		// These routes expose static app import metadata and seed prompts only.
 		// User data, collectors, uploads, sessions, and all /api/data/* routes
@@ -81,6 +109,7 @@ func SetupRoutes(r *gin.Engine, h *Handlers) {
 		// /api/data/* — file I/O, search, events, uploads, ingestion config
 		// ---------------------------------------------------------------------
 		data := api.Group("/data")
+		data.Use(scope)
 		{
 			// File metadata + lifecycle (REST: path is the resource).
 			data.GET("/files/*path", h.GetDataFile)
@@ -103,6 +132,17 @@ func SetupRoutes(r *gin.Engine, h *Handlers) {
 			data.GET("/root", h.GetLibraryRoot)
 			data.GET("/directories", h.GetDirectories)
 			data.GET("/search", h.Search)
+			data.GET("/ignore/explain", h.ExplainIgnore)
+
+			// Duplicate detection and resolution (trash or hard link).
+			data.GET("/duplicates", h.GetDuplicates)
+			data.POST("/duplicates/resolve", h.ResolveDuplicates)
+
+			// Public share links (management side; the public read/upload
+			// routes live in the public group above).
+			data.GET("/shares", h.ListFileShares)
+			data.POST("/shares", h.CreateFileShare)
+			data.DELETE("/shares/:token", h.DeleteFileShare)
 
 			// Filesystem event stream.
 			data.GET("/events", h.NotificationStream)
@@ -119,6 +159,11 @@ func SetupRoutes(r *gin.Engine, h *Handlers) {
 			data.PUT("/collectors/:id", h.UpsertCollector)
 		}
 
+		// ---------------------------------------------------------------------
+		// /api/timeline — files, agent sessions and explore posts by day
+		// ---------------------------------------------------------------------
+		api.GET("/timeline", h.GetTimeline)
+
 		// ---------------------------------------------------------------------
 		// /api/explore/* — feed posts and comments
 		// ---------------------------------------------------------------------
@@ -131,14 +176,55 @@ func SetupRoutes(r *gin.Engine, h *Handlers) {
 		}
 
 		// ---------------------------------------------------------------------
-		// /api/system/* — owner-only control plane (settings + stats)
+		// /api/system/* — control plane (settings + stats)
 		// ---------------------------------------------------------------------
 		system := api.Group("/system")
 		{
+			// Settings are server-wide: every account reads them, only
+			// admins change or reset them.
 			system.GET("/settings", h.GetSettings)
-			system.PUT("/settings", h.UpdateSettings)
-			system.POST("/settings", h.ResetSettings)
+			system.PUT("/settings", h.RequireAdmin(), h.UpdateSettings)
+			system.POST("/settings", h.RequireAdmin(), h.ResetSettings)
 			system.GET("/stats", h.GetStats)
+			system.GET("/storage", h.GetStorageUsage)
+
+			// Background job queue. Anyone may read the backlog and move
+			// their visible paths up; controlling the queue is admin-only.
+			system.GET("/jobs", h.GetJobs)
+			system.POST("/jobs/prioritize", h.PrioritizeJobs)
+			jobsAdmin := system.Group("/jobs")
+			jobsAdmin.Use(h.RequireAdmin())
+			{
+				jobsAdmin.POST("/pause", h.PauseJobs)
+				jobsAdmin.POST("/resume", h.ResumeJobs)
+				jobsAdmin.POST("/retry", h.RetryJobs)
+			}
+
+			// Filesystem scans. Reports name paths anywhere in the
+			// library, so both routes are admin-only.
+			scan := system.Group("/scan")
+			scan.Use(h.RequireAdmin())
+			{
+				scan.GET("", h.GetScanReports)
+				scan.POST("", h.StartScan)
+			}
+
+			// Accounts. /me is open to every signed-in account; the
+			// management routes are admin-only.
+			system.GET("/me", h.GetCurrentUser)
+			users := system.Group("/users")
+			users.Use(h.RequireAdmin())
+			{
+				users.GET("", h.ListUsers)
+				users.POST("", h.CreateUser)
+				users.PATCH("/:id", h.UpdateUser)
+				users.DELETE("/:id", h.DeleteUser)
+			}
+
+			// S3 access keys. Each account manages its own; admins see all.
+			system.GET("/s3-credentials", h.ListS3Credentials)
+			system.POST("/s3-credentials", h.CreateS3Credential)
+			system.DELETE("/s3-credentials/:id", h.DeleteS3Credential)
 		}
 	}
 
@@ -153,24 +239,37 @@ func SetupRoutes(r *gin.Engine, h *Handlers) {
 	{
 		agentRoutes.GET("/config", h.GetAgentConfig)
 		agentRoutes.GET("/info", h.GetAgentInfo)
+		agentRoutes.GET("/pools", h.RequireAdmin(), h.GetAgentPools)
 
 		agentRoutes.GET("/sessions", h.GetAgentSessions)
 		agentRoutes.GET("/sessions/all", h.GetAgentSessions)
 		agentRoutes.GET("/sessions/search", h.SearchAgentSessions)
 		agentRoutes.POST("/sessions", h.CreateAgentSession)
-		agentRoutes.GET("/sessions/:id", h.GetAgentSession)
-		agentRoutes.PATCH("/sessions/:id", h.UpdateAgentSession)
-		agentRoutes.GET("/sessions/:id/messages", h.GetAgentMessages)
-			agentRoutes.GET("/sessions/:id/turns", h.GetAgentTurns)
-		agentRoutes.GET("/sessions/:id/changed-files", h.GetAgentChangedFiles)
-		agentRoutes.POST("/sessions/:id/deactivate", h.DeactivateAgentSession)
-		agentRoutes.POST("/sessions/:id/restart", h.RestartAgentSession)
-		agentRoutes.POST("/sessions/:id/archive", h.ArchiveAgentSession)
-		agentRoutes.POST("/sessions/:id/unarchive", h.UnarchiveAgentSession)
-		agentRoutes.POST("/sessions/:id/share", h.ShareAgentSession)
-		agentRoutes.DELETE("/sessions/:id/share", h.UnshareAgentSession)
-
-		// Session groups (sidebar organization).
+		agentRoutes.GET("/sessions/:id", sessionAccess, h.GetAgentSession)
+		agentRoutes.PATCH("/sessions/:id", sessionAccess, h.UpdateAgentSession)
+		agentRoutes.GET("/sessions/:id/messages", sessionAccess, h.GetAgentMessages)
+		agentRoutes.GET("/sessions/:id/turns", sessionAccess, h.GetAgentTurns)
+		agentRoutes.GET("/sessions/:id/changed-files", sessionAccess, h.GetAgentChangedFiles)
+		agentRoutes.GET("/sessions/:id/queue", sessionAccess, h.GetAgentPromptQueue)
+		agentRoutes.DELETE("/sessions/:id/queue", sessionAccess, h.ClearAgentPromptQueue)
+		agentRoutes.PATCH("/sessions/:id/queue/:queueId", sessionAccess, h.UpdateQueuedAgentPrompt)
+		agentRoutes.DELETE("/sessions/:id/queue/:queueId", sessionAccess, h.DeleteQueuedAgentPrompt)
+		agentRoutes.GET("/sessions/:id/schedules", sessionAccess, h.ListAgentSessionSchedules)
+		agentRoutes.POST("/sessions/:id/schedules", sessionAccess, h.CreateAgentSessionSchedule)
+		agentRoutes.DELETE("/sessions/:id/schedules/:scheduleId", sessionAccess, h.DeleteAgentSessionSchedule)
+		agentRoutes.POST("/sessions/:id/deactivate", sessionAccess, h.DeactivateAgentSession)
+		agentRoutes.POST("/sessions/:id/restart", sessionAccess, h.RestartAgentSession)
+		agentRoutes.POST("/sessions/:id/archive", sessionAccess, h.ArchiveAgentSession)
+		agentRoutes.POST("/sessions/:id/unarchive", sessionAccess, h.UnarchiveAgentSession)
+		agentRoutes.POST("/sessions/:id/share", sessionAccess, h.ShareAgentSession)
+		agentRoutes.DELETE("/sessions/:id/share", sessionAccess, h.UnshareAgentSession)
+
+		// Approvals inbox: permission requests from gated auto agents.
+		agentRoutes.GET("/approvals", h.ListAgentApprovals)
+		agentRoutes.GET("/approvals/:id", h.GetAgentApproval)
+		agentRoutes.POST("/approvals/:id", h.ResolveAgentApproval)
+
+		// Session groups (sidebar organization). Each account has its own.
 		agentRoutes.GET("/groups", h.ListAgentSessionGroups)
 		agentRoutes.POST("/groups", h.CreateAgentSessionGroup)
 		agentRoutes.PUT("/groups/order", h.ReorderAgentSessionGroups)
@@ -184,21 +283,24 @@ func SetupRoutes(r *gin.Engine, h *Handlers) {
 		agentRoutes.POST("/attachments", h.UploadAgentAttachment)
 		agentRoutes.DELETE("/attachments/:storageId/:filename", h.DeleteAgentAttachment)
 
-		// Auto agent definitions (markdown files with triggers that spawn sessions).
+		// Auto agent definitions (markdown files with triggers that spawn
+		// sessions). Auto runs act as the owner, so only admins may create,
+		// change, delete or run them.
 		agentRoutes.GET("/defs", h.ListAutoAgents)
 		agentRoutes.GET("/defs/:name", h.GetAutoAgent)
-		agentRoutes.PUT("/defs/:name", h.SaveAutoAgent)
-		agentRoutes.DELETE("/defs/:name", h.DeleteAutoAgent)
-		agentRoutes.POST("/defs/:name/run", h.RunAutoAgent)
+		agentRoutes.PUT("/defs/:name", h.RequireAdmin(), h.SaveAutoAgent)
+		agentRoutes.DELETE("/defs/:name", h.RequireAdmin(), h.DeleteAutoAgent)
+		agentRoutes.POST("/defs/:name/run", h.RequireAdmin(), h.RunAutoAgent)
 
-		// Skills + MCP listing for the composer + menu.
+		// Skills + MCP listing for the composer + menu. Toggling a server
+		// changes .mcp.json for every account's agents: admin-only.
 		agentRoutes.GET("/skills", h.ListSkills)
 		agentRoutes.GET("/mcp-servers", h.ListMCPServers)
 		agentRoutes.GET("/mcp-servers/:name/tools", h.ListMCPServerTools)
-		agentRoutes.PATCH("/mcp-servers/:name", h.UpdateMCPServer)
+		agentRoutes.PATCH("/mcp-servers/:name", h.RequireAdmin(), h.UpdateMCPServer)
 	}
 	// WebSocket routes — registered on main router because gin's group-level
 	// middleware doesn't compose cleanly with route-level middleware here.
-	r.GET("/api/agent/sessions/:id/subscribe", auth, h.AgentSessionWebSocket)
+	r.GET("/api/agent/sessions/:id/subscribe", auth, sessionAccess, h.AgentSessionWebSocket)
 	r.GET("/api/agent/share/:token/subscribe", h.SharedSessionSubscribeWebSocket)
 }
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+	"github.com/xiaoyuanzhu-com/my-life-db/s3"
+)
+
+// S3-compatible API.
+//
+// Wire shape:
+//
+//	ANY    /s3/<bucket>/<key>                     S3 REST (SigV4, path-style)
+//
+//	GET    /api/system/s3-credentials             list access keys
+//	POST   /api/system/s3-credentials             mint a key (secret shown once)
+//	DELETE /api/system/s3-credentials/:id         revoke
+//
+// The /s3 surface does not use AuthMiddleware: every request must carry a
+// SigV4 signature from an access key in s3_credentials, in every auth mode.
+// A key acts as its owning account and is confined to its root folder,
+// which in turn must stay inside the account's data root. Protocol details
+// live in the s3 package.
+
+// s3MountPrefix is where the S3 handler is routed; clients use
+// "<base URL>/s3" as their endpoint with path-style addressing.
+const s3MountPrefix = "/s3"
+
+// s3TouchInterval throttles last_used_at writes for busy keys.
+const s3TouchInterval = time.Minute
+
+// S3Handler handles every request under /s3.
+func (h *Handlers) S3Handler(c *gin.Context) {
+	h.s3.ServeHTTP(c.Writer, c.Request)
+}
+
+// lookupS3Credential resolves an access key for the s3 handler. Keys of
+// deleted or disabled accounts, and keys whose root has fallen outside the
+// account's (since narrowed) data root, stop authenticating.
+func (h *Handlers) lookupS3Credential(accessKeyID string) (*s3.Credential, error) {
+	rec, err := h.server.AppDB().GetS3Credential(accessKeyID)
+	if err != nil || rec == nil {
+		return nil, err
+	}
+
+	u := db.OwnerUser()
+	if rec.UserID != db.OwnerUserID {
+		u, err = h.server.AppDB().GetUser(rec.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if u == nil || u.DisabledAt != nil {
+			return nil, nil
+		}
+	}
+	root := rec.Root
+	if root == "" {
+		root = db.NormalizeDataRoot(u.DataRoot)
+	}
+	if !u.CanAccessPath(root) {
+		return nil, nil
+	}
+
+	if rec.LastUsedAt == nil || db.NowMs()-*rec.LastUsedAt > s3TouchInterval.Milliseconds() {
+		if err := h.server.AppDB().TouchS3Credential(context.Background(), accessKeyID); err != nil {
+			log.Warn().Err(err).Str("accessKeyId", accessKeyID).Msg("failed to record s3 credential use")
+		}
+	}
+
+	return &s3.Credential{
+		AccessKeyID: rec.AccessKeyID,
+		SecretKey:   rec.SecretKey,
+		Root:        root,
+		ReadOnly:    rec.ReadOnly,
+	}, nil
+}
+
+// generateS3AccessKey mints an AWS-shaped key pair: a 20-character
+// uppercase key id and a 40-character secret.
+func generateS3AccessKey() (accessKeyID, secretKey string) {
+	id := make([]byte, 10)
+	rand.Read(id)
+	secret := make([]byte, 30)
+	rand.Read(secret)
+	return "MLDB" + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(id)[:16],
+		base64.RawURLEncoding.EncodeToString(secret)
+}
+
+// ListS3Credentials handles GET /api/system/s3-credentials
+func (h *Handlers) ListS3Credentials(c *gin.Context) {
+	var userFilter *string
+	if u := CurrentUser(c); !u.IsAdmin() {
+		userFilter = &u.ID
+	}
+	creds, err := h.server.AppDB().ListS3Credentials(userFilter)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list s3 credentials")
+		RespondInternalError(c, "Failed to list access keys")
+		return
+	}
+	RespondList(c, creds, nil)
+}
+
+// CreateS3Credential handles POST /api/system/s3-credentials
+func (h *Handlers) CreateS3Credential(c *gin.Context) {
+	var body struct {
+		Name     string `json:"name"`
+		Root     string `json:"root"`     // optional; defaults to the account's data root
+		ReadOnly bool   `json:"readOnly"` // optional
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		RespondBadRequest(c, "Invalid request body")
+		return
+	}
+	if strings.Contains(body.Root, "..") {
+		RespondBadRequest(c, "Invalid root")
+		return
+	}
+	u := CurrentUser(c)
+	root := db.NormalizeDataRoot(body.Root)
+	if root != "" && !requirePathAccess(c, root) {
+		return
+	}
+
+	accessKeyID, secretKey := generateS3AccessKey()
+	rec := &db.S3CredentialRecord{
+		AccessKeyID: accessKeyID,
+		SecretKey:   secretKey,
+		Name:        strings.TrimSpace(body.Name),
+		UserID:      u.ID,
+		Root:        root,
+		ReadOnly:    body.ReadOnly,
+	}
+	if err := h.server.AppDB().CreateS3Credential(c.Request.Context(), rec); err != nil {
+		log.Error().Err(err).Msg("failed to create s3 credential")
+		RespondInternalError(c, "Failed to create access key")
+		return
+	}
+
+	log.Info().Str("accessKeyId", accessKeyID).Str("userId", u.ID).Str("root", root).Bool("readOnly", rec.ReadOnly).Msg("s3 credential created")
+	RespondCreated(c, struct {
+		*db.S3CredentialRecord
+		SecretKey string `json:"secretKey"`
+		Endpoint  string `json:"endpoint"`
+	}{rec, secretKey, s3MountPrefix}, "/api/system/s3-credentials/"+accessKeyID)
+}
+
+// DeleteS3Credential handles DELETE /api/system/s3-credentials/:id
+func (h *Handlers) DeleteS3Credential(c *gin.Context) {
+	id := c.Param("id")
+	rec, err := h.server.AppDB().GetS3Credential(id)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load s3 credential")
+		RespondInternalError(c, "Failed to revoke access key")
+		return
+	}
+	u := CurrentUser(c)
+	if rec == nil || (!u.IsAdmin() && rec.UserID != u.ID) {
+		RespondNotFound(c, "Access key not found")
+		return
+	}
+	if err := h.server.AppDB().RevokeS3Credential(c.Request.Context(), id); err != nil {
+		log.Error().Err(err).Msg("failed to revoke s3 credential")
+		RespondInternalError(c, "Failed to revoke access key")
+		return
+	}
+	log.Info().Str("accessKeyId", id).Msg("s3 credential revoked")
+	RespondNoContent(c)
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// Filesystem scans: the periodic pass that reconciles the index with
+// changes the watcher missed (see fs/scanner.go).
+//
+//	GET  /api/system/scan?limit=   recent scan reports, newest first
+//	POST /api/system/scan          {full?} — scan now
+//
+// Scans are incremental unless full is set: directories whose mtime and
+// inode match the last scan are not listed, so files edited in place
+// inside them are only seen by a full scan.
+
+const (
+	scanDefaultReports = 10
+	scanMaxReports     = 50
+)
+
+// GetScanReports handles GET /api/system/scan
+func (h *Handlers) GetScanReports(c *gin.Context) {
+	limit := scanDefaultReports
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, scanMaxReports)
+	}
+	reports, err := h.server.FS().ScanReports(limit)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read scan reports")
+		RespondInternalError(c, "Failed to read scan reports")
+		return
+	}
+	RespondData(c, gin.H{"reports": reports})
+}
+
+// StartScan handles POST /api/system/scan
+func (h *Handlers) StartScan(c *gin.Context) {
+	var req struct {
+		Full bool `json:"full"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			RespondBadRequest(c, "Invalid request body")
+			return
+		}
+	}
+	h.server.FS().Rescan(req.Full)
+	RespondAccepted(c, gin.H{"scheduled": true, "full": req.Full})
+}
@@ -1,7 +1,10 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -27,6 +30,7 @@ type SearchResultItem struct {
 	PreviewStatus *string           `json:"previewStatus,omitempty"`
 	Highlights    map[string]string `json:"highlights,omitempty"`
 	MatchContext  *MatchContext     `json:"matchContext,omitempty"`
+	Media         *db.FileMedia     `json:"media,omitempty"`
 }
 
 // MatchContext provides context about where the match was found.
@@ -60,14 +64,24 @@ type Timing struct {
 }
 
 // Search handles GET /api/search
+//
+// Besides keywords, q may contain media filters: taken:2024,
+// taken:2024-05, taken:2023-06..2024-01 (capture date, inclusive) and
+// near:lat,lon[,km] (taken within km of a point, default 5). A query of
+// filters alone lists the matching files, most recently taken first.
 func (h *Handlers) Search(c *gin.Context) {
 	query := strings.TrimSpace(c.Query("q"))
-	if query == "" {
+	text, mediaFilter, err := parseMediaFilters(query)
+	if err != nil {
+		RespondCoded(c, http.StatusBadRequest, "SEARCH_INVALID_FILTER", err.Error())
+		return
+	}
+	if text == "" && mediaFilter == nil {
 		RespondCoded(c, http.StatusBadRequest, "SEARCH_QUERY_REQUIRED", "Query parameter 'q' is required")
 		return
 	}
 
-	if len(query) < 2 {
+	if text != "" && len(text) < 2 {
 		RespondCoded(c, http.StatusBadRequest, "SEARCH_QUERY_TOO_SHORT", "Query must be at least 2 characters")
 		return
 	}
@@ -84,6 +98,10 @@ func (h *Handlers) Search(c *gin.Context) {
 
 	typeFilter := c.Query("type")
 	pathFilter := c.Query("path")
+	if pathFilter == "" {
+		// Scoped accounts search only their own data root.
+		pathFilter = db.NormalizeDataRoot(CurrentUser(c).DataRoot)
+	}
 
 	// Parse search types
 	typesParam := c.Query("types")
@@ -105,23 +123,34 @@ func (h *Handlers) Search(c *gin.Context) {
 	totalStart := time.Now()
 	var searchMs, enrichMs int64
 
-	// Keyword search via FTS5
+	// Keyword search via FTS5, or a plain media listing when the query is
+	// filters only.
 	searchStart := time.Now()
-	hits, hitsTotal, err := h.server.IndexDB().SearchFTS(query, db.FTSSearchOptions{
+	opts := db.FTSSearchOptions{
 		Limit:      limit,
 		Offset:     offset,
 		TypeFilter: typeFilter,
 		PathFilter: pathFilter,
-	})
+		Media:      mediaFilter,
+	}
+	var hits []db.FTSHit
+	var hitsTotal int
+	source := "keyword"
+	if text == "" {
+		source = "media"
+		hits, hitsTotal, err = h.server.IndexDB().SearchMedia(opts)
+	} else {
+		hits, hitsTotal, err = h.server.IndexDB().SearchFTS(text, opts)
+	}
 	searchMs = time.Since(searchStart).Milliseconds()
 	if err != nil {
-		log.Error().Err(err).Msg("fts5 search failed")
+		log.Error().Err(err).Str("source", source).Msg("search failed")
 	} else {
-		sources = append(sources, "keyword")
+		sources = append(sources, source)
 		total = hitsTotal
 
 		enrichStart := time.Now()
-		terms := extractSearchTerms(query)
+		terms := extractSearchTerms(text)
 
 		// Batch enrichment: gather all hit paths once, then issue one query
 		// per data source instead of multiple queries per hit.
@@ -141,6 +170,11 @@ func (h *Handlers) Search(c *gin.Context) {
 			pinnedSet = map[string]bool{}
 		}
 		_ = pinnedSet // currently unused in response shape; reserved for future enrichment
+		mediaByPath, err := h.server.IndexDB().GetFileMediaByPaths(paths)
+		if err != nil {
+			log.Error().Err(err).Msg("batch fetch media failed")
+			mediaByPath = map[string]*db.FileMedia{}
+		}
 
 		for _, hit := range hits {
 			file := filesByPath[hit.FilePath]
@@ -177,6 +211,7 @@ func (h *Handlers) Search(c *gin.Context) {
 				PreviewStatus: file.PreviewStatus,
 				Highlights:    highlights,
 				MatchContext:  matchContext,
+				Media:         mediaByPath[file.Path],
 			})
 		}
 		enrichMs = time.Since(enrichStart).Milliseconds()
@@ -200,6 +235,65 @@ func (h *Handlers) Search(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+var takenDateRe = regexp.MustCompile(`^\d{4}(-(0[1-9]|1[0-2])(-(0[1-9]|[12]\d|3[01]))?)?$`)
+
+// defaultNearRadiusKm is the radius of a near: filter without one.
+const defaultNearRadiusKm = 5
+
+// parseMediaFilters splits the taken: and near: terms out of a search
+// query. It returns the remaining keywords and the filter (nil if the
+// query had none).
+func parseMediaFilters(query string) (string, *db.MediaFilter, error) {
+	var filter db.MediaFilter
+	var rest []string
+	found := false
+	for _, term := range strings.Fields(query) {
+		key, value, ok := strings.Cut(term, ":")
+		switch {
+		case ok && strings.EqualFold(key, "taken"):
+			from, to, isRange := strings.Cut(value, "..")
+			if !isRange {
+				to = from
+			}
+			for _, d := range []string{from, to} {
+				if d != "" && !takenDateRe.MatchString(d) {
+					return "", nil, fmt.Errorf("invalid taken: date %q (use YYYY, YYYY-MM or YYYY-MM-DD)", d)
+				}
+			}
+			if from == "" && to == "" {
+				return "", nil, errors.New("taken: needs a date")
+			}
+			filter.TakenFrom, filter.TakenTo = from, to
+		case ok && strings.EqualFold(key, "near"):
+			parts := strings.Split(value, ",")
+			if len(parts) < 2 || len(parts) > 3 {
+				return "", nil, fmt.Errorf("invalid near: filter %q (use near:lat,lon or near:lat,lon,km)", value)
+			}
+			nums := make([]float64, 3)
+			nums[2] = defaultNearRadiusKm
+			for i, p := range parts {
+				n, err := strconv.ParseFloat(strings.TrimSuffix(p, "km"), 64)
+				if err != nil {
+					return "", nil, fmt.Errorf("invalid near: filter %q (use near:lat,lon or near:lat,lon,km)", value)
+				}
+				nums[i] = n
+			}
+			if nums[0] < -90 || nums[0] > 90 || nums[1] < -180 || nums[1] > 180 || nums[2] <= 0 || nums[2] > 1000 {
+				return "", nil, errors.New("near: coordinates or radius out of range")
+			}
+			filter.Near = &db.GeoFilter{Latitude: nums[0], Longitude: nums[1], RadiusKm: nums[2]}
+		default:
+			rest = append(rest, term)
+			continue
+		}
+		found = true
+	}
+	if !found {
+		return query, nil, nil
+	}
+	return strings.Join(rest, " "), &filter, nil
+}
+
 // safeSubstring safely extracts a substring up to maxLen characters (not bytes)
 // This handles unicode properly by counting runes instead of bytes
 func safeSubstring(s string, maxLen int) string {
@@ -0,0 +1,44 @@
+package api
+
+import "testing"
+
+func TestParseMediaFilters(t *testing.T) {
+	text, f, err := parseMediaFilters("beach taken:2023-06..2023-08 near:41.38,2.17,10km sunset")
+	if err != nil {
+		t.Fatalf("parseMediaFilters: %v", err)
+	}
+	if text != "beach sunset" {
+		t.Errorf("text = %q, want %q", text, "beach sunset")
+	}
+	if f.TakenFrom != "2023-06" || f.TakenTo != "2023-08" {
+		t.Errorf("taken = %q..%q", f.TakenFrom, f.TakenTo)
+	}
+	if f.Near == nil || f.Near.Latitude != 41.38 || f.Near.Longitude != 2.17 || f.Near.RadiusKm != 10 {
+		t.Errorf("near = %+v", f.Near)
+	}
+
+	// A single date covers itself; near: defaults its radius.
+	_, f, err = parseMediaFilters("taken:2024 near:-33.9,151.2")
+	if err != nil {
+		t.Fatalf("parseMediaFilters: %v", err)
+	}
+	if f.TakenFrom != "2024" || f.TakenTo != "2024" || f.Near.RadiusKm != defaultNearRadiusKm {
+		t.Errorf("filter = %+v near %+v", f, f.Near)
+	}
+
+	// Open-ended range
+	if _, f, _ = parseMediaFilters("taken:..2020-01-15"); f.TakenFrom != "" || f.TakenTo != "2020-01-15" {
+		t.Errorf("open range = %+v", f)
+	}
+
+	// No filters: the query passes through untouched.
+	if text, f, err := parseMediaFilters("meeting  notes"); text != "meeting  notes" || f != nil || err != nil {
+		t.Errorf("plain query = %q %v %v", text, f, err)
+	}
+
+	for _, bad := range []string{"taken:June", "taken:..", "taken:2024-13", "near:91,0", "near:1", "near:a,b", "near:0,0,5000"} {
+		if _, _, err := parseMediaFilters(bad); err == nil {
+			t.Errorf("parseMediaFilters(%q) succeeded, want error", bad)
+		}
+	}
+}
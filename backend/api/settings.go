@@ -2,10 +2,12 @@ package api
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 	"github.com/xiaoyuanzhu-com/my-life-db/models"
+	"github.com/xiaoyuanzhu-com/my-life-db/server"
 )
 
 // GetSettings handles GET /api/settings
@@ -37,9 +39,28 @@ func (h *Handlers) UpdateSettings(c *gin.Context) {
 		return
 	}
 
+	// Mounted folders and symlink following reach outside the data root
+	if (updates.Indexing.MountedFolders != nil || updates.Indexing.FollowSymlinks != nil) && !CurrentUser(c).IsAdmin() {
+		RespondForbidden(c, "Only admins can change mounted folders and symlink following")
+		return
+	}
+
 	// Merge updates with current settings
 	merged := mergeSettings(current, &updates)
 
+	// Mounted folders are checked against the disk before they are saved
+	if updates.Indexing.MountedFolders != nil {
+		mounts, err := h.server.FS().CheckMounts(server.MountsFromSettings(merged.Indexing.MountedFolders))
+		if err != nil {
+			RespondCoded(c, http.StatusBadRequest, "SETTINGS_INVALID_MOUNT", err.Error())
+			return
+		}
+		merged.Indexing.MountedFolders = make([]models.MountedFolder, 0, len(mounts))
+		for _, m := range mounts {
+			merged.Indexing.MountedFolders = append(merged.Indexing.MountedFolders, models.MountedFolder{Path: m.Path, Source: m.Source})
+		}
+	}
+
 	// Save merged settings
 	if err := h.server.AppDB().SaveUserSettings(c.Request.Context(), merged); err != nil {
 		log.Error().Err(err).Msg("failed to save settings")
@@ -53,6 +74,20 @@ func (h *Handlers) UpdateSettings(c *gin.Context) {
 		log.Info().Str("level", merged.Preferences.LogLevel).Msg("log level updated")
 	}
 
+	// Ignore patterns take effect without a restart
+	if updates.Indexing.IgnorePatterns != nil {
+		h.server.FS().SetIgnorePatterns(merged.Indexing.IgnorePatterns)
+	}
+	// So do mounted folders and symlink following; both rescan the library
+	if updates.Indexing.MountedFolders != nil {
+		if err := h.server.FS().SetMounts(server.MountsFromSettings(merged.Indexing.MountedFolders)); err != nil {
+			log.Error().Err(err).Msg("failed to apply mounted folders")
+		}
+	}
+	if updates.Indexing.FollowSymlinks != nil {
+		h.server.FS().SetFollowSymlinks(*merged.Indexing.FollowSymlinks)
+	}
+
 	c.JSON(http.StatusOK, merged)
 }
 
@@ -92,9 +127,39 @@ func mergeSettings(current, updates *models.UserSettings) *models.UserSettings {
 		merged.Storage.BackupPath = updates.Storage.BackupPath
 	}
 	merged.Storage.AutoBackup = updates.Storage.AutoBackup
-	if updates.Storage.MaxFileSize > 0 {
+	// 0 removes the limit.
+	if updates.Storage.MaxFileSize != nil && *updates.Storage.MaxFileSize >= 0 {
 		merged.Storage.MaxFileSize = updates.Storage.MaxFileSize
 	}
+	// A present folderQuotas map replaces the current one ({} clears it).
+	// Keys are normalized to bare top-level folder names.
+	if updates.Storage.FolderQuotas != nil {
+		merged.Storage.FolderQuotas = make(map[string]int, len(updates.Storage.FolderQuotas))
+		for folder, mb := range updates.Storage.FolderQuotas {
+			folder = strings.Trim(folder, "/")
+			if folder == "" || strings.Contains(folder, "/") || strings.Contains(folder, "..") || mb <= 0 {
+				continue
+			}
+			merged.Storage.FolderQuotas[folder] = mb
+		}
+	}
+
+	// A present ignorePatterns list replaces the current one ([] clears it).
+	if updates.Indexing.IgnorePatterns != nil {
+		merged.Indexing.IgnorePatterns = make([]string, 0, len(updates.Indexing.IgnorePatterns))
+		for _, p := range updates.Indexing.IgnorePatterns {
+			if p = strings.TrimSpace(p); p != "" {
+				merged.Indexing.IgnorePatterns = append(merged.Indexing.IgnorePatterns, p)
+			}
+		}
+	}
+	if updates.Indexing.FollowSymlinks != nil {
+		merged.Indexing.FollowSymlinks = updates.Indexing.FollowSymlinks
+	}
+	// A present mountedFolders list replaces the current one ([] clears it).
+	if updates.Indexing.MountedFolders != nil {
+		merged.Indexing.MountedFolders = updates.Indexing.MountedFolders
+	}
 
 	return &merged
 }
@@ -123,9 +188,17 @@ func (h *Handlers) ResetSettings(c *gin.Context) {
 	settings, err := h.server.AppDB().LoadUserSettings()
 	if err != nil {
 		log.Error().Err(err).Msg("failed to load settings after reset")
+		h.server.FS().SetIgnorePatterns(nil)
+		h.server.FS().SetMounts(nil)
+		h.server.FS().SetFollowSymlinks(false)
 		c.JSON(http.StatusOK, gin.H{"success": true})
 		return
 	}
+	h.server.FS().SetIgnorePatterns(settings.Indexing.IgnorePatterns)
+	if err := h.server.FS().SetMounts(server.MountsFromSettings(settings.Indexing.MountedFolders)); err != nil {
+		log.Error().Err(err).Msg("failed to apply mounted folders")
+	}
+	h.server.FS().SetFollowSymlinks(settings.Indexing.FollowSymlinks != nil && *settings.Indexing.FollowSymlinks)
 
 	c.JSON(http.StatusOK, settings)
 }
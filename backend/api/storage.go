@@ -0,0 +1,146 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+	"github.com/xiaoyuanzhu-com/my-life-db/utils"
+)
+
+// Storage usage and limits.
+//
+// Wire shape:
+//
+//	GET /api/system/storage?largest=20&days=90
+//
+// Limits (Storage.MaxFileSize, Storage.FolderQuotas in settings) are
+// enforced by fs.Service on every write; upload handlers additionally
+// check the declared length up front and answer 413 with
+// UPLOAD_FILE_TOO_LARGE or STORAGE_QUOTA_EXCEEDED.
+
+const (
+	storageDefaultLargest = 20
+	storageMaxLargest     = 200
+	storageDefaultDays    = 90
+	storageMimeTypeLimit  = 20
+)
+
+// respondWriteLimitError answers 413 if err is a size-limit or quota
+// rejection from fs.Service. Returns false (and writes nothing) otherwise.
+func respondWriteLimitError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, fs.ErrFileTooLarge):
+		RespondCoded(c, http.StatusRequestEntityTooLarge, "UPLOAD_FILE_TOO_LARGE", "File exceeds the maximum upload size")
+	case errors.Is(err, fs.ErrQuotaExceeded):
+		RespondCoded(c, http.StatusRequestEntityTooLarge, "STORAGE_QUOTA_EXCEEDED", "Folder storage quota exceeded")
+	default:
+		return false
+	}
+	return true
+}
+
+type storageQuota struct {
+	Folder     string `json:"folder"`
+	LimitBytes int64  `json:"limitBytes"`
+	UsedBytes  int64  `json:"usedBytes"`
+}
+
+// GetStorageUsage handles GET /api/system/storage. Everything is scoped to
+// the caller's data root; growth history covers the whole library and is
+// only returned to unscoped accounts.
+func (h *Handlers) GetStorageUsage(c *gin.Context) {
+	largest := storageDefaultLargest
+	if v, err := strconv.Atoi(c.Query("largest")); err == nil && v >= 0 {
+		largest = min(v, storageMaxLargest)
+	}
+	days := storageDefaultDays
+	if v, err := strconv.Atoi(c.Query("days")); err == nil && v > 0 {
+		days = v
+	}
+
+	u := CurrentUser(c)
+	root := db.NormalizeDataRoot(u.DataRoot)
+	indexDB := h.server.IndexDB()
+
+	byFolder, err := indexDB.UsageByFolder(root)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to compute storage usage by folder")
+		RespondInternalError(c, "Failed to compute storage usage")
+		return
+	}
+	byMimeType, err := indexDB.UsageByMimeType(root, storageMimeTypeLimit)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to compute storage usage by mime type")
+		RespondInternalError(c, "Failed to compute storage usage")
+		return
+	}
+	largestFiles, err := indexDB.LargestFiles(root, largest)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list largest files")
+		RespondInternalError(c, "Failed to compute storage usage")
+		return
+	}
+
+	var fileCount, totalSize int64
+	for _, f := range byFolder {
+		fileCount += f.FileCount
+		totalSize += f.Size
+	}
+
+	settings, err := h.server.AppDB().LoadUserSettings()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load settings")
+		RespondInternalError(c, "Failed to compute storage usage")
+		return
+	}
+	// Quotas on top-level folders the caller can see, or that contain
+	// their data root.
+	quotas := []storageQuota{}
+	for folder, mb := range settings.Storage.FolderQuotas {
+		if !u.CanAccessPath(folder) && !strings.HasPrefix(root+"/", folder+"/") {
+			continue
+		}
+		used, err := indexDB.SumFileSizes(folder)
+		if err != nil {
+			log.Error().Err(err).Str("folder", folder).Msg("failed to measure quota folder")
+			continue
+		}
+		quotas = append(quotas, storageQuota{Folder: folder, LimitBytes: int64(mb) << 20, UsedBytes: used})
+	}
+
+	var maxFileSizeBytes int64
+	if mb := settings.Storage.MaxFileSize; mb != nil {
+		maxFileSizeBytes = int64(*mb) << 20
+	}
+	resp := gin.H{
+		"fileCount":        fileCount,
+		"totalSize":        totalSize,
+		"maxFileSizeBytes": maxFileSizeBytes,
+		"byFolder":         byFolder,
+		"byMimeType":       byMimeType,
+		"largestFiles":     largestFiles,
+		"quotas":           quotas,
+	}
+	if avail, err := utils.DiskAvailableBytes(h.userDataRootAbs(u)); err == nil {
+		resp["diskAvailableBytes"] = avail
+	}
+	if root == "" {
+		since := time.Now().Add(-time.Duration(days) * 24 * time.Hour).UnixMilli()
+		history, err := h.server.AppDB().ListStorageSnapshots(since)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to list storage snapshots")
+			RespondInternalError(c, "Failed to compute storage usage")
+			return
+		}
+		resp["history"] = history
+	}
+	RespondData(c, resp)
+}
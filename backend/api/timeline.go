@@ -0,0 +1,302 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// Timeline: one chronological lens over the library, agent sessions and
+// explore posts.
+//
+// Wire shape:
+//
+//	GET /api/timeline?cursor=&limit=50&kinds=file,session,post&folder=&tz=Europe/Paris
+//
+// Items are ordered newest first. Files sit at their capture time when the
+// media worker found one (EXIF, video metadata) and at the time they were
+// added otherwise; sessions and posts at their creation time. Pages are
+// grouped into calendar days in tz (default: the server's zone); each day
+// carries the whole day's per-kind counts, so a day split across pages
+// reports the same totals on both. Pass the returned cursor back to get the
+// next, older page.
+//
+// folder narrows files to that folder and sessions to ones run in it;
+// posts have no folder and drop out. Members see their own data root and
+// sessions; explore posts are shared.
+
+const (
+	timelineDefaultLimit = 50
+	timelineMaxLimit     = 200
+)
+
+var timelineKinds = []string{db.TimelineKindFile, db.TimelineKindSession, db.TimelineKindPost}
+
+// TimelineItem is one entry of the timeline; exactly one of File, Session
+// and Post is set, matching Kind.
+type TimelineItem struct {
+	Kind    string                 `json:"kind"`
+	At      int64                  `json:"at"`
+	File    *db.FileRecord         `json:"file,omitempty"`
+	Media   *db.FileMedia          `json:"media,omitempty"`
+	Session *db.AgentSessionRecord `json:"session,omitempty"`
+	Post    *db.ExplorePost        `json:"post,omitempty"`
+}
+
+// TimelineDay groups the items of one calendar day.
+type TimelineDay struct {
+	Date   string         `json:"date"`   // YYYY-MM-DD in the requested zone
+	Counts map[string]int `json:"counts"` // whole-day totals per requested kind
+	Items  []TimelineItem `json:"items"`
+}
+
+// TimelineResponse is the response of GET /api/timeline.
+type TimelineResponse struct {
+	Days    []TimelineDay `json:"days"`
+	Cursor  *string       `json:"cursor"`
+	HasMore bool          `json:"hasMore"`
+}
+
+// timelineQuery is a parsed timeline request, shared by the page and the
+// day-count queries.
+type timelineQuery struct {
+	kinds      map[string]bool
+	folder     string  // data-root-relative; scoped to the member's root
+	sessionDir string  // absolute form of the requested folder, if any
+	userID     *string // restrict sessions to this account
+	posts      bool
+}
+
+// GetTimeline handles GET /api/timeline
+func (h *Handlers) GetTimeline(c *gin.Context) {
+	limit := timelineDefaultLimit
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, timelineMaxLimit)
+	}
+
+	var before *db.TimelineCursor
+	if cs := c.Query("cursor"); cs != "" {
+		if before = db.ParseTimelineCursor(cs); before == nil {
+			RespondCoded(c, http.StatusBadRequest, "TIMELINE_INVALID_CURSOR", "Invalid cursor")
+			return
+		}
+	}
+
+	loc := time.Local
+	if tz := c.Query("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			RespondCoded(c, http.StatusBadRequest, "TIMELINE_INVALID_TZ", "Unknown time zone: "+tz)
+			return
+		}
+		loc = l
+	}
+
+	q := timelineQuery{kinds: map[string]bool{}}
+	if ks := c.Query("kinds"); ks != "" {
+		for _, k := range strings.Split(ks, ",") {
+			k = strings.TrimSpace(k)
+			if !slices.Contains(timelineKinds, k) {
+				RespondCoded(c, http.StatusBadRequest, "TIMELINE_INVALID_KIND", "Unknown kind: "+k)
+				return
+			}
+			q.kinds[k] = true
+		}
+	} else {
+		for _, k := range timelineKinds {
+			q.kinds[k] = true
+		}
+	}
+
+	u := CurrentUser(c)
+	folder := strings.Trim(c.Query("folder"), "/")
+	if folder != "" {
+		if !requirePathAccess(c, folder) {
+			return
+		}
+		q.folder = folder
+		q.sessionDir = h.server.FS().ResolvePath(folder)
+	} else {
+		q.folder = db.NormalizeDataRoot(u.DataRoot)
+		q.posts = true
+	}
+	if !u.IsAdmin() {
+		q.userID = &u.ID
+	}
+
+	// Take limit+1 from every source; the merged head is the page.
+	entries, err := h.timelineEntries(q, db.TimelineRange{Before: before, Limit: limit + 1})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list timeline")
+		RespondInternalError(c, "Failed to load timeline")
+		return
+	}
+	resp := TimelineResponse{Days: []TimelineDay{}}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		resp.HasMore = true
+	}
+	if len(entries) == 0 {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	cursor := db.CreateTimelineCursor(entries[len(entries)-1])
+	resp.Cursor = &cursor
+
+	items, err := h.hydrateTimeline(entries)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load timeline items")
+		RespondInternalError(c, "Failed to load timeline")
+		return
+	}
+
+	dayOf := func(at int64) string { return time.UnixMilli(at).In(loc).Format(time.DateOnly) }
+	for _, item := range items {
+		date := dayOf(item.At)
+		if n := len(resp.Days); n == 0 || resp.Days[n-1].Date != date {
+			resp.Days = append(resp.Days, TimelineDay{Date: date, Items: []TimelineItem{}})
+		}
+		day := &resp.Days[len(resp.Days)-1]
+		day.Items = append(day.Items, item)
+	}
+
+	// Whole-day counts for every day on the page, grouped in SQL.
+	spans := make([]db.TimelineSpan, len(resp.Days))
+	for i, day := range resp.Days {
+		start, _ := time.ParseInLocation(time.DateOnly, day.Date, loc)
+		spans[i] = db.TimelineSpan{Since: start.UnixMilli(), Until: start.AddDate(0, 0, 1).UnixMilli()}
+	}
+	counts, err := h.timelineDayCounts(q, spans)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to count timeline days")
+		RespondInternalError(c, "Failed to load timeline")
+		return
+	}
+	for i := range resp.Days {
+		resp.Days[i].Counts = counts[i]
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// timelineEntries lists r from every requested source and merges them
+// into timeline order.
+func (h *Handlers) timelineEntries(q timelineQuery, r db.TimelineRange) ([]db.TimelineEntry, error) {
+	var entries []db.TimelineEntry
+	if q.kinds[db.TimelineKindFile] {
+		files, err := h.server.IndexDB().ListTimelineFiles(q.folder, r)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, files...)
+	}
+	if q.kinds[db.TimelineKindSession] {
+		sessions, err := h.server.AppDB().ListTimelineSessions(q.userID, q.sessionDir, r)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, sessions...)
+	}
+	if q.kinds[db.TimelineKindPost] && q.posts {
+		posts, err := h.server.AppDB().ListTimelinePosts(r)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, posts...)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Newer(entries[j]) })
+	return entries, nil
+}
+
+// timelineDayCounts counts every requested source in each span, one map of
+// per-kind totals per span.
+func (h *Handlers) timelineDayCounts(q timelineQuery, spans []db.TimelineSpan) ([]map[string]int, error) {
+	counts := make([]map[string]int, len(spans))
+	for i := range counts {
+		counts[i] = map[string]int{}
+	}
+	add := func(kind string, n []int, err error) error {
+		if err != nil {
+			return err
+		}
+		for i := range counts {
+			counts[i][kind] = n[i]
+		}
+		return nil
+	}
+	if q.kinds[db.TimelineKindFile] {
+		n, err := h.server.IndexDB().CountTimelineFiles(q.folder, spans)
+		if err := add(db.TimelineKindFile, n, err); err != nil {
+			return nil, err
+		}
+	}
+	if q.kinds[db.TimelineKindSession] {
+		n, err := h.server.AppDB().CountTimelineSessions(q.userID, q.sessionDir, spans)
+		if err := add(db.TimelineKindSession, n, err); err != nil {
+			return nil, err
+		}
+	}
+	if q.kinds[db.TimelineKindPost] && q.posts {
+		n, err := h.server.AppDB().CountTimelinePosts(spans)
+		if err := add(db.TimelineKindPost, n, err); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// hydrateTimeline loads the records behind entries. Entries whose record
+// vanished in between (deleted file, removed post) are dropped.
+func (h *Handlers) hydrateTimeline(entries []db.TimelineEntry) ([]TimelineItem, error) {
+	ids := map[string][]string{}
+	for _, e := range entries {
+		ids[e.Kind] = append(ids[e.Kind], e.ID)
+	}
+
+	files, err := h.server.IndexDB().GetFilesByPaths(ids[db.TimelineKindFile])
+	if err != nil {
+		return nil, err
+	}
+	media, err := h.server.IndexDB().GetFileMediaByPaths(ids[db.TimelineKindFile])
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := h.server.AppDB().GetAgentSessionsByIDs(ids[db.TimelineKindSession])
+	if err != nil {
+		return nil, err
+	}
+	posts, err := h.server.AppDB().GetExplorePostsByIDs(ids[db.TimelineKindPost])
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]TimelineItem, 0, len(entries))
+	for _, e := range entries {
+		item := TimelineItem{Kind: e.Kind, At: e.At}
+		switch e.Kind {
+		case db.TimelineKindFile:
+			if item.File = files[e.ID]; item.File == nil {
+				continue
+			}
+			item.Media = media[e.ID]
+		case db.TimelineKindSession:
+			if item.Session = sessions[e.ID]; item.Session == nil {
+				continue
+			}
+		case db.TimelineKindPost:
+			if item.Post = posts[e.ID]; item.Post == nil {
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -2,10 +2,12 @@ package api
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -85,6 +87,17 @@ func (h *Handlers) TUSHandler(c *gin.Context) {
 		Str("path", c.Request.URL.Path).
 		Msg("TUS request received")
 
+	// Creation requests declare the final size; refuse ones over the
+	// per-file limit before any bytes are sent. The destination (and so
+	// any folder quota) is only known at finalize time.
+	if c.Request.Method == http.MethodPost {
+		if n, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64); err == nil {
+			if err := h.server.FS().CheckWriteSize("", n); respondWriteLimitError(c, err) {
+				return
+			}
+		}
+	}
+
 	// Manually strip the /api/data/uploads/tus prefix from the request URL.
 	// TUS handler expects paths without the base path prefix.
 	// We need to manually strip because http.StripPrefix doesn't work well with Gin's wildcard routes.
@@ -121,8 +134,6 @@ func (h *Handlers) FinalizeUpload(c *gin.Context) {
 		return
 	}
 
-	cfg := config.Get()
-
 	// Determine destination:
 	// - If Destination field is not provided (nil): use "inbox" (default)
 	// - If Destination is empty string (""): use data root (empty path)
@@ -134,8 +145,12 @@ func (h *Handlers) FinalizeUpload(c *gin.Context) {
 		destination = *body.Destination
 	}
 
+	if !requirePathAccess(c, destination) {
+		return
+	}
+
 	// Ensure destination directory exists
-	destDir := filepath.Join(cfg.UserDataDir, destination)
+	destDir := h.server.FS().ResolvePath(destination)
 	if err := os.MkdirAll(destDir, 0755); err != nil {
 		RespondCoded(c, http.StatusInternalServerError, "UPLOAD_WRITE_FAILED", "Failed to create destination directory")
 		return
@@ -144,6 +159,7 @@ func (h *Handlers) FinalizeUpload(c *gin.Context) {
 	// Process each upload
 	var paths []string
 	var results []uploadFileResult
+	var limitErr error
 	for _, upload := range body.Uploads {
 		if upload.UploadID == "" || upload.Filename == "" {
 			log.Warn().
@@ -222,6 +238,12 @@ func (h *Handlers) FinalizeUpload(c *gin.Context) {
 
 		if err != nil {
 			log.Error().Err(err).Str("path", destPath).Msg("failed to write uploaded file")
+			if errors.Is(err, fs.ErrFileTooLarge) || errors.Is(err, fs.ErrQuotaExceeded) {
+				// Retrying can't succeed; drop the staged upload.
+				limitErr = err
+				os.Remove(srcPath)
+				os.Remove(srcPath + ".info")
+			}
 			continue
 		}
 
@@ -243,6 +265,9 @@ func (h *Handlers) FinalizeUpload(c *gin.Context) {
 	}
 
 	if len(paths) == 0 {
+		if respondWriteLimitError(c, limitErr) {
+			return
+		}
 		RespondCoded(c, http.StatusBadRequest, "UPLOAD_NO_FILES", "No valid files to finalize")
 		return
 	}
@@ -282,14 +307,20 @@ func (h *Handlers) SimpleUpload(c *gin.Context) {
 	filename = utils.SanitizeFilename(filename)
 
 	// Ensure destination directory exists
-	cfg := config.Get()
-	destDir := filepath.Join(cfg.UserDataDir, dir)
+	destDir := h.server.FS().ResolvePath(dir)
 	if err := os.MkdirAll(destDir, 0755); err != nil {
 		log.Error().Err(err).Str("dir", destDir).Msg("simple upload: failed to create destination directory")
 		RespondCoded(c, http.StatusInternalServerError, "UPLOAD_WRITE_FAILED", "Failed to create destination directory")
 		return
 	}
 
+	// Reject over-limit uploads before reading the body.
+	if c.Request.ContentLength > 0 {
+		if err := h.server.FS().CheckWriteSize(filepath.Join(dir, filename), c.Request.ContentLength); respondWriteLimitError(c, err) {
+			return
+		}
+	}
+
 	// Buffer the request body so we can compute hash before deciding whether to write.
 	// Simple uploads are small files (typically ≤1MB), so buffering in memory is fine.
 	defer c.Request.Body.Close()
@@ -333,6 +364,9 @@ func (h *Handlers) SimpleUpload(c *gin.Context) {
 		})
 		if err != nil {
 			log.Error().Err(err).Str("path", destPath).Msg("simple upload: failed to write file")
+			if respondWriteLimitError(c, err) {
+				return
+			}
 			RespondCoded(c, http.StatusInternalServerError, "UPLOAD_WRITE_FAILED", "Failed to write file")
 			return
 		}
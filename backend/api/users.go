@@ -0,0 +1,327 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// ctxUserKey is the gin context key AuthMiddleware stores the resolved
+// *db.UserRecord under.
+const ctxUserKey = "mld.user"
+
+// CurrentUser returns the account the request is authenticated as. Requests
+// that went through AuthMiddleware in "none" mode — and any code path that
+// runs without the middleware — act as the owner.
+func CurrentUser(c *gin.Context) *db.UserRecord {
+	if v, ok := c.Get(ctxUserKey); ok {
+		if u, ok := v.(*db.UserRecord); ok && u != nil {
+			return u
+		}
+	}
+	return db.OwnerUser()
+}
+
+// setCurrentUser records the authenticated account on the request context.
+func setCurrentUser(c *gin.Context, u *db.UserRecord) {
+	c.Set(ctxUserKey, u)
+}
+
+// requirePathAccess responds 403 and returns false when the current user's
+// data root does not cover the USER_DATA_DIR-relative path p.
+func requirePathAccess(c *gin.Context, p string) bool {
+	if CurrentUser(c).CanAccessPath(p) {
+		return true
+	}
+	RespondCoded(c, http.StatusForbidden, "LIBRARY_FORBIDDEN", "Path is outside your data root")
+	return false
+}
+
+// DataScopeMiddleware confines scoped accounts to their data root on the
+// path-addressed file surfaces (/raw, /api/data/*). It covers the `*path`
+// route param and the `path` / `parent` query params; handlers that take a
+// path from the request body call requirePathAccess themselves.
+func (h *Handlers) DataScopeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u := CurrentUser(c)
+		if db.NormalizeDataRoot(u.DataRoot) == "" {
+			c.Next()
+			return
+		}
+		candidates := []string{c.Param("path"), c.Query("path"), c.Query("parent")}
+		for _, p := range candidates {
+			if strings.Trim(p, "/") == "" {
+				continue
+			}
+			if !requirePathAccess(c, p) {
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin rejects requests from accounts that can't manage users.
+func (h *Handlers) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !CurrentUser(c).IsAdmin() {
+			RespondForbidden(c, "Admin access required")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// userDataRootAbs returns the absolute directory a user is confined to.
+func (h *Handlers) userDataRootAbs(u *db.UserRecord) string {
+	return filepath.Join(h.server.Cfg().UserDataDir, db.NormalizeDataRoot(u.DataRoot))
+}
+
+// resolveUserWorkingDir defaults an empty agent working dir to the user's
+// data root and rejects one outside it. Unscoped users pass through as-is.
+func (h *Handlers) resolveUserWorkingDir(u *db.UserRecord, workingDir string) (string, bool) {
+	if db.NormalizeDataRoot(u.DataRoot) == "" {
+		return workingDir, true
+	}
+	root := h.userDataRootAbs(u)
+	if workingDir == "" {
+		return root, true
+	}
+	rel, err := filepath.Rel(root, filepath.Clean(workingDir))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return workingDir, true
+}
+
+// canAccessAgentSession reports whether the current user may read or drive
+// the given agent session. Admins see everything; members only their own.
+func canAccessAgentSession(c *gin.Context, rec *db.AgentSessionRecord) bool {
+	u := CurrentUser(c)
+	return u.IsAdmin() || rec.UserID == u.ID
+}
+
+// AgentSessionAccessMiddleware guards the /api/agent/sessions/:id routes so
+// members can't address another account's sessions by id. Unknown ids fall
+// through to the handler, which owns the 404.
+func (h *Handlers) AgentSessionAccessMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CurrentUser(c).IsAdmin() {
+			c.Next()
+			return
+		}
+		rec, err := h.server.AppDB().GetAgentSession(c.Param("id"))
+		if err != nil {
+			log.Error().Err(err).Str("sessionId", c.Param("id")).Msg("failed to load agent session for access check")
+			RespondInternalError(c, "Failed to load session")
+			c.Abort()
+			return
+		}
+		if rec != nil && !canAccessAgentSession(c, rec) {
+			RespondNotFound(c, "Session not found")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// =============================================================================
+// /api/system/users — account management (admin only)
+// =============================================================================
+
+// userRequest is the body of POST /api/system/users and PATCH
+// /api/system/users/:id. Pointer fields distinguish "not provided" from
+// "set to empty" on PATCH.
+type userRequest struct {
+	Username    string  `json:"username"`
+	DisplayName *string `json:"displayName"`
+	Password    *string `json:"password"`
+	Role        *string `json:"role"`
+	DataRoot    *string `json:"dataRoot"`
+	Disabled    *bool   `json:"disabled"`
+}
+
+func validUserRole(role string) bool {
+	return role == db.UserRoleAdmin || role == db.UserRoleMember
+}
+
+// GetCurrentUser handles GET /api/system/me
+func (h *Handlers) GetCurrentUser(c *gin.Context) {
+	RespondData(c, CurrentUser(c))
+}
+
+// ListUsers handles GET /api/system/users
+func (h *Handlers) ListUsers(c *gin.Context) {
+	users, err := h.server.AppDB().ListUsers()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list users")
+		RespondInternalError(c, "Failed to list users")
+		return
+	}
+	RespondList(c, users, nil)
+}
+
+// CreateUser handles POST /api/system/users
+func (h *Handlers) CreateUser(c *gin.Context) {
+	var req userRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		RespondBadRequest(c, "Invalid request body")
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" || strings.EqualFold(req.Username, db.OwnerUser().Username) {
+		RespondBadRequest(c, "A username other than 'owner' is required")
+		return
+	}
+	if req.Password == nil || *req.Password == "" {
+		RespondBadRequest(c, "Password is required")
+		return
+	}
+	role := db.UserRoleMember
+	if req.Role != nil {
+		role = *req.Role
+	}
+	if !validUserRole(role) {
+		RespondBadRequest(c, "Role must be 'admin' or 'member'")
+		return
+	}
+	dataRoot := ""
+	if req.DataRoot != nil {
+		dataRoot = *req.DataRoot
+	}
+	if strings.Contains(dataRoot, "..") {
+		RespondBadRequest(c, "Invalid data root")
+		return
+	}
+	displayName := ""
+	if req.DisplayName != nil {
+		displayName = *req.DisplayName
+	}
+
+	existing, err := h.server.AppDB().GetUserByUsername(req.Username)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to look up user")
+		RespondInternalError(c, "Failed to create user")
+		return
+	}
+	if existing != nil {
+		RespondConflict(c, "Username already exists")
+		return
+	}
+
+	u, err := h.server.AppDB().CreateUser(c.Request.Context(), req.Username, displayName, hashPassword(*req.Password), role, dataRoot)
+	if err != nil {
+		log.Error().Err(err).Str("username", req.Username).Msg("failed to create user")
+		RespondInternalError(c, "Failed to create user")
+		return
+	}
+	if u.DataRoot != "" {
+		if _, statErr := os.Stat(filepath.Join(h.server.Cfg().UserDataDir, u.DataRoot)); os.IsNotExist(statErr) {
+			if err := h.server.FS().CreateFolder(c.Request.Context(), u.DataRoot); err != nil {
+				log.Warn().Err(err).Str("dataRoot", u.DataRoot).Msg("failed to create user data root")
+			}
+		}
+	}
+
+	log.Info().Str("userId", u.ID).Str("username", u.Username).Str("role", u.Role).Str("dataRoot", u.DataRoot).Msg("user created")
+	RespondCreated(c, u, "/api/system/users/"+u.ID)
+}
+
+// UpdateUser handles PATCH /api/system/users/:id
+func (h *Handlers) UpdateUser(c *gin.Context) {
+	u, err := h.server.AppDB().GetUser(c.Param("id"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load user")
+		RespondInternalError(c, "Failed to update user")
+		return
+	}
+	if u == nil {
+		RespondNotFound(c, "User not found")
+		return
+	}
+
+	var req userRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		RespondBadRequest(c, "Invalid request body")
+		return
+	}
+
+	revokeSessions := false
+	if req.DisplayName != nil {
+		u.DisplayName = *req.DisplayName
+	}
+	if req.Password != nil {
+		if *req.Password == "" {
+			RespondBadRequest(c, "Password cannot be empty")
+			return
+		}
+		u.PasswordHash = hashPassword(*req.Password)
+		revokeSessions = true
+	}
+	if req.Role != nil {
+		if !validUserRole(*req.Role) {
+			RespondBadRequest(c, "Role must be 'admin' or 'member'")
+			return
+		}
+		u.Role = *req.Role
+	}
+	if req.DataRoot != nil {
+		if strings.Contains(*req.DataRoot, "..") {
+			RespondBadRequest(c, "Invalid data root")
+			return
+		}
+		u.DataRoot = *req.DataRoot
+	}
+	if req.Disabled != nil {
+		if *req.Disabled {
+			now := db.NowMs()
+			u.DisabledAt = &now
+			revokeSessions = true
+		} else {
+			u.DisabledAt = nil
+		}
+	}
+
+	if err := h.server.AppDB().UpdateUser(c.Request.Context(), u); err != nil {
+		log.Error().Err(err).Str("userId", u.ID).Msg("failed to update user")
+		RespondInternalError(c, "Failed to update user")
+		return
+	}
+	if revokeSessions {
+		if err := h.server.AppDB().DeleteUserSessions(c.Request.Context(), u.ID); err != nil {
+			log.Warn().Err(err).Str("userId", u.ID).Msg("failed to revoke user sessions")
+		}
+	}
+	RespondData(c, u)
+}
+
+// DeleteUser handles DELETE /api/system/users/:id. The user's files and
+// agent sessions are left in place.
+func (h *Handlers) DeleteUser(c *gin.Context) {
+	id := c.Param("id")
+	u, err := h.server.AppDB().GetUser(id)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load user")
+		RespondInternalError(c, "Failed to delete user")
+		return
+	}
+	if u == nil {
+		RespondNotFound(c, "User not found")
+		return
+	}
+	if err := h.server.AppDB().DeleteUser(c.Request.Context(), id); err != nil {
+		log.Error().Err(err).Str("userId", id).Msg("failed to delete user")
+		RespondInternalError(c, "Failed to delete user")
+		return
+	}
+	log.Info().Str("userId", id).Str("username", u.Username).Msg("user deleted")
+	RespondNoContent(c)
+}
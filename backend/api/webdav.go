@@ -17,7 +17,12 @@
 // Filesystem mapping:
 //   - The handler serves files rooted at <USER_DATA_DIR>. A request to
 //     `/webdav/notes/foo.md` reads/writes `<USER_DATA_DIR>/notes/foo.md`.
-//   - The stdlib's `webdav.Dir` rejects `..` escapes for us.
+//   - Accounts with a data root see that folder as the WebDAV root
+//     instead, so `/webdav/foo.md` maps to `<USER_DATA_DIR>/<root>/foo.md`.
+//   - Names are cleaned before they are joined to the root, so `..` can't
+//     escape it.
+//   - Writes, deletes and moves go through fs.Service (see webdavFS), so
+//     they are indexed immediately and fire file.* hooks exactly once.
 //
 // URL-prefix handling:
 //   - gin's `*path` captures everything after `/webdav`. Before delegating
@@ -26,17 +31,30 @@
 //     as the resource path. This keeps PROPFIND/MOVE/COPY targets correct.
 //
 // Locks:
-//   - A single process-wide in-memory lock store (Server.WebDAVLocks).
-//     Locks aren't durable across restarts — acceptable for personal-server
-//     use, per design doc.
+//   - A single process-wide lock store (Server.WebDAVLocks). Locks with a
+//     timeout are persisted in the app DB and survive restarts.
+//   - Lock roots are namespaced by the account's data root (see
+//     scopedLockSystem), so two accounts' `/foo.md` are distinct resources
+//     and a lock under a shared folder conflicts across accounts.
+//
+// Quota:
+//   - PROPFIND on the mount root reports RFC 4331 quota-used-bytes (indexed
+//     file sizes under the account's root) and quota-available-bytes (free
+//     disk space).
 package api
 
 import (
+	"context"
 	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/net/webdav"
 
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 )
 
@@ -45,9 +63,14 @@ import (
 // uploads should use the TUS surface.
 const webdavMaxBodyBytes int64 = 1 << 30 // 1 GB
 
+// webdavStagingDir is where upload bodies are spooled, under APP_DATA_DIR.
+func (h *Handlers) webdavStagingDir() string {
+	return filepath.Join(h.server.Cfg().AppDataDir, "webdav-staging")
+}
+
 // WebDAVHandler is the gin entrypoint for /webdav/*path. Auth has already
 // been enforced by AuthMiddleware; this handler just rewrites the path
-// and delegates to a webdav.Handler rooted at USER_DATA_DIR.
+// and delegates to a webdav.Handler over the caller's data root.
 func (h *Handlers) WebDAVHandler(c *gin.Context) {
 	// Suffix is whatever follows /webdav in the request URL — gin's
 	// catch-all `*path` returns it WITH the leading slash, e.g. a
@@ -59,15 +82,28 @@ func (h *Handlers) WebDAVHandler(c *gin.Context) {
 		suffix = "/"
 	}
 
-	// Cap request body so a misconfigured client can't OOM us.
+	// Cap request body so a misconfigured client can't OOM us, and track
+	// read errors so a truncated upload is never committed.
 	if c.Request.Body != nil {
-		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, webdavMaxBodyBytes)
+		body := &webdavBody{ReadCloser: http.MaxBytesReader(c.Writer, c.Request.Body, webdavMaxBodyBytes)}
+		c.Request.Body = body
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), webdavBodyKey{}, body))
 	}
 
-	// Build the filesystem rooted at USER_DATA_DIR. webdav.Dir refuses
-	// `..` escapes for us, so this is the only access-control check
-	// needed on the file path.
-	fs := webdav.Dir(h.server.Cfg().UserDataDir)
+	root := db.NormalizeDataRoot(CurrentUser(c).DataRoot)
+	fs := &webdavFS{h: h, root: root, stagingDir: h.webdavStagingDir()}
+
+	// webdav.Handler can only answer 405 when a write fails, so reject PUTs
+	// over the size limit or quota up front with a proper 413. Bodies
+	// without a declared length are still cut off by fs.Service.
+	if c.Request.Method == http.MethodPut && c.Request.ContentLength > 0 {
+		if rel, _, err := fs.resolve(suffix); err == nil {
+			if err := h.server.FS().CheckWriteSize(rel, c.Request.ContentLength); err != nil {
+				c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+				return
+			}
+		}
+	}
 
 	// Strip the /webdav prefix from the URL path before delegating, and
 	// set Handler.Prefix to "" since we've already done the strip.
@@ -78,7 +114,7 @@ func (h *Handlers) WebDAVHandler(c *gin.Context) {
 	handler := &webdav.Handler{
 		Prefix:     "",
 		FileSystem: fs,
-		LockSystem: h.server.WebDAVLocks(),
+		LockSystem: scopedLockSystem{ls: h.server.WebDAVLocks(), prefix: webdavLockPrefix(root)},
 		Logger: func(req *http.Request, err error) {
 			if err == nil {
 				return
@@ -90,3 +126,60 @@ func (h *Handlers) WebDAVHandler(c *gin.Context) {
 	}
 	handler.ServeHTTP(c.Writer, c.Request)
 }
+
+// webdavLockPrefix is the lock namespace for an account's data root.
+func webdavLockPrefix(root string) string {
+	if root == "" {
+		return ""
+	}
+	return "/" + root
+}
+
+// scopedLockSystem maps an account's WebDAV names onto USER_DATA_DIR-wide
+// lock roots by prepending the account's data root, and strips it again
+// from the details it hands back.
+type scopedLockSystem struct {
+	ls     webdav.LockSystem
+	prefix string // "" or "/<data root>"
+}
+
+func (s scopedLockSystem) scope(name string) string {
+	if name == "" || s.prefix == "" {
+		return name
+	}
+	if clean := path.Clean("/" + name); clean != "/" {
+		return s.prefix + clean
+	}
+	return s.prefix
+}
+
+func (s scopedLockSystem) unscope(name string) string {
+	if s.prefix == "" {
+		return name
+	}
+	if rest := strings.TrimPrefix(name, s.prefix); rest != "" {
+		return rest
+	}
+	return "/"
+}
+
+func (s scopedLockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (func(), error) {
+	return s.ls.Confirm(now, s.scope(name0), s.scope(name1), conditions...)
+}
+
+func (s scopedLockSystem) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	details.Root = s.scope(details.Root)
+	return s.ls.Create(now, details)
+}
+
+func (s scopedLockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	details, err := s.ls.Refresh(now, token, duration)
+	if err == nil {
+		details.Root = s.unscope(details.Root)
+	}
+	return details, err
+}
+
+func (s scopedLockSystem) Unlock(now time.Time, token string) error {
+	return s.ls.Unlock(now, token)
+}
@@ -0,0 +1,467 @@
+package api
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+	"github.com/xiaoyuanzhu-com/my-life-db/utils"
+)
+
+// webdavFS is the webdav.FileSystem behind /webdav. Reads go straight to
+// disk; every mutation goes through fs.Service so WebDAV writes get the
+// same per-file locking, hashing, indexing and file.* hook events as the
+// web UI:
+//
+//   - A writable OpenFile spools into stagingDir (outside USER_DATA_DIR, so
+//     the watcher never sees partial uploads) and Close commits the result
+//     with a single synchronous WriteFile. The library only ever sees the
+//     finished file, which fixes the created-empty-then-changed event pair
+//     sync clients used to produce.
+//   - MKCOL, DELETE and MOVE map to CreateFolder, DeleteFile/DeleteFolder
+//     and RenameOrMove, keeping pins and search rows attached on moves.
+//   - Mounted folders appear in listings of the collection holding them
+//     and resolve to their source; they cannot be moved or deleted.
+//   - The mount root reports RFC 4331 quota properties.
+type webdavFS struct {
+	h          *Handlers
+	root       string // account data root, USER_DATA_DIR-relative ('' = whole dir)
+	stagingDir string
+}
+
+// webdavBodyKey carries the request's *webdavBody in the context so an
+// upload can tell a complete body from one cut short.
+type webdavBodyKey struct{}
+
+// webdavBody records the first non-EOF error reading the request body.
+type webdavBody struct {
+	io.ReadCloser
+	mu  sync.Mutex
+	err error
+}
+
+func (b *webdavBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		b.mu.Lock()
+		if b.err == nil {
+			b.err = err
+		}
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+func (b *webdavBody) readErr() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// resolve maps a WebDAV name to a USER_DATA_DIR-relative path and its
+// absolute location (in a mounted folder's source for paths inside one).
+// Names are cleaned before joining, so ".." can never climb above the
+// account's root.
+func (w *webdavFS) resolve(name string) (rel, abs string, err error) {
+	if (filepath.Separator != '/' && strings.ContainsRune(name, filepath.Separator)) || strings.ContainsRune(name, 0) {
+		return "", "", os.ErrInvalid
+	}
+	rel = strings.TrimPrefix(path.Join("/", w.root, path.Clean("/"+name)), "/")
+	return rel, w.h.server.FS().ResolvePath(rel), nil
+}
+
+func isWebDAVRoot(name string) bool {
+	return path.Clean("/"+name) == "/"
+}
+
+// webdavErr translates fs.Service errors into the os errors webdav.Handler
+// maps to status codes.
+func webdavErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrFileNotFound), errors.Is(err, iofs.ErrNotExist):
+		return os.ErrNotExist
+	case errors.Is(err, fs.ErrInvalidPath), errors.Is(err, fs.ErrMountPoint):
+		return os.ErrPermission
+	}
+	return err
+}
+
+// requireParent returns os.ErrNotExist unless abs's parent is a directory;
+// WebDAV never creates intermediate collections implicitly.
+func requireParent(abs string) error {
+	info, err := os.Stat(filepath.Dir(abs))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+func (w *webdavFS) notify(rel, op string) {
+	w.h.server.Notifications().NotifyLibraryChanged(rel, op)
+}
+
+func (w *webdavFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	rel, abs, err := w.resolve(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(abs); err == nil {
+		return os.ErrExist
+	}
+	if err := requireParent(abs); err != nil {
+		return err
+	}
+	if err := w.h.server.FS().CreateFolder(ctx, rel); err != nil {
+		return webdavErr(err)
+	}
+	w.notify(rel, "create")
+	return nil
+}
+
+func (w *webdavFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	rel, abs, err := w.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		file, err := os.Open(abs)
+		if err != nil {
+			return nil, err
+		}
+		var f webdav.File = file
+		if len(w.h.server.FS().MountsIn(rel)) > 0 {
+			f = &webdavDir{File: f, fs: w, rel: rel}
+		}
+		if isWebDAVRoot(name) {
+			return &webdavRootDir{File: f, fs: w, abs: abs}, nil
+		}
+		return f, nil
+	}
+
+	if isWebDAVRoot(name) {
+		return nil, os.ErrPermission
+	}
+	if err := w.h.server.FS().ValidatePath(rel); err != nil {
+		return nil, os.ErrPermission
+	}
+	info, statErr := os.Stat(abs)
+	switch {
+	case statErr == nil && info.IsDir():
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrIsDirectory}
+	case statErr == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, os.ErrExist
+	case os.IsNotExist(statErr) && flag&os.O_CREATE == 0:
+		return nil, os.ErrNotExist
+	case statErr != nil && !os.IsNotExist(statErr):
+		return nil, statErr
+	}
+	if err := requireParent(abs); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(w.stagingDir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(w.stagingDir, "put-*")
+	if err != nil {
+		return nil, err
+	}
+	u := &webdavUpload{File: tmp, fs: w, ctx: ctx, rel: rel}
+	// Partial writes (no O_TRUNC) start from the current content.
+	if statErr == nil && flag&os.O_TRUNC == 0 {
+		if err := u.seed(abs, flag&os.O_APPEND != 0); err != nil {
+			u.discard()
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+func (w *webdavFS) RemoveAll(ctx context.Context, name string) error {
+	if isWebDAVRoot(name) {
+		return os.ErrPermission
+	}
+	rel, abs, err := w.resolve(name)
+	if err != nil {
+		return err
+	}
+	info, err := os.Lstat(abs)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err = w.h.server.FS().DeleteFolder(ctx, rel)
+	} else {
+		err = w.h.server.FS().DeleteFile(ctx, rel)
+	}
+	if err != nil {
+		return webdavErr(err)
+	}
+	w.notify(rel, "delete")
+	return nil
+}
+
+func (w *webdavFS) Rename(ctx context.Context, oldName, newName string) error {
+	if isWebDAVRoot(oldName) || isWebDAVRoot(newName) {
+		return os.ErrPermission
+	}
+	oldRel, oldAbs, err := w.resolve(oldName)
+	if err != nil {
+		return err
+	}
+	newRel, newAbs, err := w.resolve(newName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(oldAbs); err != nil {
+		return err
+	}
+	if err := requireParent(newAbs); err != nil {
+		return err
+	}
+	if err := w.h.server.FS().RenameOrMove(ctx, oldRel, newRel); err != nil {
+		return webdavErr(err)
+	}
+	op := "rename"
+	if path.Dir(oldRel) != path.Dir(newRel) {
+		op = "move"
+	}
+	w.notify(newRel, op)
+	return nil
+}
+
+func (w *webdavFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	rel, abs, err := w.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	// A mounted folder goes by its library name, not its source's.
+	if base := path.Base(rel); !isWebDAVRoot(name) && info.Name() != base {
+		return renamedFileInfo{FileInfo: info, name: base}, nil
+	}
+	return info, nil
+}
+
+// webdavUpload is a writable file being spooled for a PUT or COPY. It is
+// committed to the library on Close.
+type webdavUpload struct {
+	*os.File
+	fs     *webdavFS
+	ctx    context.Context
+	rel    string
+	closed bool
+}
+
+// seed copies the existing file into the spool for non-truncating opens.
+func (u *webdavUpload) seed(abs string, appendMode bool) error {
+	src, err := os.Open(abs)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := io.Copy(u.File, src); err != nil {
+		return err
+	}
+	if !appendMode {
+		_, err = u.File.Seek(0, io.SeekStart)
+	}
+	return err
+}
+
+// Stat reports the spooled content under the destination's name. The
+// spool's mtime is carried over on commit, so the ETag webdav.Handler
+// derives from this matches later PROPFINDs.
+func (u *webdavUpload) Stat() (os.FileInfo, error) {
+	info, err := u.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return renamedFileInfo{FileInfo: info, name: path.Base(u.rel)}, nil
+}
+
+func (u *webdavUpload) discard() {
+	u.File.Close()
+	os.Remove(u.File.Name())
+}
+
+// Close commits the spooled content through fs.Service, unless the request
+// body was cut short, in which case the destination is left untouched.
+func (u *webdavUpload) Close() error {
+	if u.closed {
+		return os.ErrClosed
+	}
+	u.closed = true
+	defer u.discard()
+
+	if body, ok := u.ctx.Value(webdavBodyKey{}).(*webdavBody); ok {
+		if err := body.readErr(); err != nil {
+			return err
+		}
+	}
+	if err := u.ctx.Err(); err != nil {
+		return err
+	}
+
+	info, err := u.File.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := u.File.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	result, err := u.fs.h.server.FS().WriteFile(u.ctx, fs.WriteRequest{
+		Path:            u.rel,
+		Content:         u.File,
+		Source:          "webdav",
+		ComputeMetadata: true,
+		Sync:            true,
+		ModTime:         info.ModTime(),
+	})
+	if err != nil {
+		log.Error().Err(err).Str("path", u.rel).Msg("webdav: failed to write file")
+		return webdavErr(err)
+	}
+	op := "write"
+	if result.IsNew {
+		op = "create"
+	}
+	u.fs.notify(u.rel, op)
+	return nil
+}
+
+type renamedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi renamedFileInfo) Name() string { return fi.name }
+
+// webdavDir is a collection holding mounted folders opened for reading:
+// its listing comes from fs.Service, which puts the mounted folders in.
+type webdavDir struct {
+	webdav.File
+	fs      *webdavFS
+	rel     string
+	entries []os.FileInfo
+	read    bool
+}
+
+func (d *webdavDir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.read {
+		d.read = true
+		entries, err := d.fs.h.server.FS().ReadDir(d.rel)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if info, err := e.Info(); err == nil {
+				d.entries = append(d.entries, info)
+			}
+		}
+	}
+	if count <= 0 {
+		out := d.entries
+		d.entries = nil
+		return out, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.entries))
+	out := d.entries[:n]
+	d.entries = d.entries[n:]
+	return out, nil
+}
+
+// webdavRootDir is the mount root opened for reading. It exposes the RFC
+// 4331 quota properties as dead properties, the only hook webdav.Handler
+// offers for extra PROPFIND properties — so unlike true live properties
+// they also show up in allprop responses, which clients ignore.
+type webdavRootDir struct {
+	webdav.File
+	fs  *webdavFS
+	abs string
+}
+
+var (
+	quotaAvailableBytesName = xml.Name{Space: "DAV:", Local: "quota-available-bytes"}
+	quotaUsedBytesName      = xml.Name{Space: "DAV:", Local: "quota-used-bytes"}
+)
+
+func (d *webdavRootDir) DeadProps() (map[xml.Name]webdav.Property, error) {
+	props := make(map[xml.Name]webdav.Property, 2)
+	if used, err := d.fs.h.server.IndexDB().SumFileSizes(d.fs.root); err == nil {
+		props[quotaUsedBytesName] = webdav.Property{
+			XMLName:  quotaUsedBytesName,
+			InnerXML: []byte(strconv.FormatInt(used, 10)),
+		}
+	} else {
+		log.Warn().Err(err).Msg("webdav: failed to compute quota-used-bytes")
+	}
+	if avail, err := utils.DiskAvailableBytes(d.abs); err == nil {
+		props[quotaAvailableBytesName] = webdav.Property{
+			XMLName:  quotaAvailableBytesName,
+			InnerXML: []byte(strconv.FormatInt(avail, 10)),
+		}
+	}
+	return props, nil
+}
+
+// Patch refuses every PROPPATCH, as webdav.Handler does for files without
+// dead-property support.
+func (d *webdavRootDir) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	pstat := webdav.Propstat{Status: http.StatusForbidden}
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			pstat.Props = append(pstat.Props, webdav.Property{XMLName: p.XMLName})
+		}
+	}
+	return []webdav.Propstat{pstat}, nil
+}
+
+// staleSpoolMaxAge bounds how long an abandoned spool file (process killed
+// mid-upload) may linger before sweepWebDAVStaging removes it.
+const staleSpoolMaxAge = 24 * time.Hour
+
+// sweepWebDAVStaging removes spool files left behind by a crash.
+func sweepWebDAVStaging(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-staleSpoolMaxAge)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		os.Remove(filepath.Join(dir, e.Name()))
+	}
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/webdav"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
+	"github.com/xiaoyuanzhu-com/my-life-db/server"
+)
+
+// webdavIndex is the part of the index a WebDAV write touches, in memory.
+type webdavIndex struct {
+	fs.Database
+	mu    sync.Mutex
+	files map[string]*db.FileRecord
+}
+
+func (x *webdavIndex) GetFileByPath(path string) (*db.FileRecord, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.files[path], nil
+}
+
+func (x *webdavIndex) UpsertFile(r *db.FileRecord) (bool, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	_, existed := x.files[r.Path]
+	x.files[r.Path] = r
+	return !existed, nil
+}
+
+func (x *webdavIndex) UpdateFileField(string, string, interface{}) error { return nil }
+
+// webdavTestLibrary is a library served over WebDAV by newWebDAVRouter.
+type webdavTestLibrary struct {
+	root    string // USER_DATA_DIR
+	staging string
+	index   *webdavIndex
+	limits  fs.WriteLimits
+}
+
+// newWebDAVRouter serves /webdav over a temp library as user.
+func newWebDAVRouter(t *testing.T, user *db.UserRecord) (*gin.Engine, *webdavTestLibrary) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	lib := &webdavTestLibrary{root: t.TempDir(), index: &webdavIndex{files: map[string]*db.FileRecord{}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	srv := server.NewForTesting(ctx, &server.Config{UserDataDir: lib.root, AppDataDir: t.TempDir()}, openTestAppDB(t))
+	srv.SetFSForTesting(fs.NewService(fs.Config{
+		DataRoot:    lib.root,
+		DB:          lib.index,
+		WriteLimits: func(string) fs.WriteLimits { return lib.limits },
+	}))
+	h := &Handlers{server: srv}
+	lib.staging = h.webdavStagingDir()
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { setCurrentUser(c, user) })
+	r.Any("/webdav/*path", h.WebDAVHandler)
+	return r, lib
+}
+
+func webdavPut(r *gin.Engine, target string, body io.Reader, length int64) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, target, body)
+	req.ContentLength = length
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// stagedUploads lists the spool files left in the staging dir.
+func (lib *webdavTestLibrary) stagedUploads(t *testing.T) []string {
+	t.Helper()
+	entries, err := os.ReadDir(lib.staging)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+// watchingReader checks, on its first read, what the library looks like
+// while the body is still streaming in.
+type watchingReader struct {
+	io.Reader
+	once    sync.Once
+	onFirst func()
+}
+
+func (r *watchingReader) Read(p []byte) (int, error) {
+	r.once.Do(r.onFirst)
+	return r.Reader.Read(p)
+}
+
+// failingReader returns some bytes, then fails like a dropped connection.
+type failingReader struct{ sent bool }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.sent {
+		return 0, io.ErrUnexpectedEOF
+	}
+	r.sent = true
+	return copy(p, "half a file"), nil
+}
+
+func TestWebDAV_PutStagesThenRenamesIntoPlace(t *testing.T) {
+	r, lib := newWebDAVRouter(t, db.OwnerUser())
+	if err := os.Mkdir(filepath.Join(lib.root, "notes"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(lib.root, "notes", "a.md")
+
+	body := &watchingReader{Reader: strings.NewReader("first version"), onFirst: func() {
+		// Mid-upload the content lives in the staging dir only.
+		if staged := lib.stagedUploads(t); len(staged) != 1 {
+			t.Errorf("staged uploads mid-PUT = %v, want one spool file", staged)
+		}
+		if _, err := os.Stat(dest); !os.IsNotExist(err) {
+			t.Errorf("destination visible before the upload finished: %v", err)
+		}
+	}}
+	if w := webdavPut(r, "/webdav/notes/a.md", body, -1); w.Code != http.StatusCreated {
+		t.Fatalf("PUT new file: status %d, body %s", w.Code, w.Body)
+	}
+	if data, err := os.ReadFile(dest); err != nil || string(data) != "first version" {
+		t.Fatalf("committed file = %q, %v", data, err)
+	}
+	if rec, _ := lib.index.GetFileByPath("notes/a.md"); rec == nil {
+		t.Fatal("committed file not indexed")
+	}
+
+	// x/net/webdav answers 201 to every successful PUT.
+	if w := webdavPut(r, "/webdav/notes/a.md", strings.NewReader("second"), 6); w.Code != http.StatusCreated {
+		t.Fatalf("PUT over existing file: status %d, body %s", w.Code, w.Body)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "second" {
+		t.Fatalf("overwritten file = %q", data)
+	}
+	if staged := lib.stagedUploads(t); len(staged) != 0 {
+		t.Fatalf("spool files left behind: %v", staged)
+	}
+}
+
+func TestWebDAV_TruncatedPutLeavesFileUntouched(t *testing.T) {
+	r, lib := newWebDAVRouter(t, db.OwnerUser())
+	writeLibraryFile(t, lib.root, "a.md", "original")
+
+	if w := webdavPut(r, "/webdav/a.md", &failingReader{}, -1); w.Code < 400 {
+		t.Fatalf("truncated PUT: status %d", w.Code)
+	}
+	if data, _ := os.ReadFile(filepath.Join(lib.root, "a.md")); string(data) != "original" {
+		t.Fatalf("file after truncated PUT = %q", data)
+	}
+	if staged := lib.stagedUploads(t); len(staged) != 0 {
+		t.Fatalf("spool files left behind: %v", staged)
+	}
+}
+
+func TestWebDAV_PutOverLimits(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		limits fs.WriteLimits
+	}{
+		{"size limit", fs.WriteLimits{MaxFileSize: 10}},
+		{"quota", fs.WriteLimits{QuotaFolder: "notes", QuotaLeft: 10}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, lib := newWebDAVRouter(t, db.OwnerUser())
+			lib.limits = tt.limits
+			content := strings.Repeat("x", 20)
+
+			// A declared length over the limit is refused before the body
+			// is read.
+			if w := webdavPut(r, "/webdav/big.bin", strings.NewReader(content), int64(len(content))); w.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("PUT with Content-Length over the limit: status %d", w.Code)
+			}
+			// Without one the write is cut off while streaming.
+			if w := webdavPut(r, "/webdav/big.bin", strings.NewReader(content), -1); w.Code < 400 {
+				t.Fatalf("streamed PUT over the limit: status %d", w.Code)
+			}
+			if _, err := os.Stat(filepath.Join(lib.root, "big.bin")); !os.IsNotExist(err) {
+				t.Fatalf("file over the limit was written: %v", err)
+			}
+			if staged := lib.stagedUploads(t); len(staged) != 0 {
+				t.Fatalf("spool files left behind: %v", staged)
+			}
+
+			if w := webdavPut(r, "/webdav/small.bin", strings.NewReader("ok"), 2); w.Code != http.StatusCreated {
+				t.Fatalf("PUT within the limit: status %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestWebDAV_MemberWritesUnderDataRoot(t *testing.T) {
+	ann := &db.UserRecord{ID: "ann", Username: "ann", Role: db.UserRoleMember, DataRoot: "members/ann"}
+	r, lib := newWebDAVRouter(t, ann)
+	if err := os.MkdirAll(filepath.Join(lib.root, "members", "ann"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := webdavPut(r, "/webdav/../../escape.md", strings.NewReader("x"), 1); w.Code != http.StatusCreated {
+		t.Fatalf("PUT: status %d, body %s", w.Code, w.Body)
+	}
+	if _, err := os.Stat(filepath.Join(lib.root, "escape.md")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("write escaped the data root: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(lib.root, "members", "ann", "escape.md")); err != nil || string(data) != "x" {
+		t.Fatalf("member's file = %q, %v", data, err)
+	}
+}
+
+func TestScopedLockSystem_NamespacesDataRoots(t *testing.T) {
+	ls := webdav.NewMemLS()
+	alice := scopedLockSystem{ls: ls, prefix: webdavLockPrefix("family/alice")}
+	owner := scopedLockSystem{ls: ls, prefix: webdavLockPrefix("")}
+	now := time.Now()
+
+	tok, err := alice.Create(now, webdav.LockDetails{Root: "/notes.md", Duration: time.Minute, ZeroDepth: true})
+	if err != nil {
+		t.Fatalf("alice Create: %v", err)
+	}
+	// The owner's /notes.md is a different file...
+	if _, err := owner.Create(now, webdav.LockDetails{Root: "/notes.md", Duration: time.Minute, ZeroDepth: true}); err != nil {
+		t.Fatalf("owner Create /notes.md: %v", err)
+	}
+	// ...but alice's file, seen from the owner's root, is the same one.
+	if _, err := owner.Create(now, webdav.LockDetails{Root: "/family/alice/notes.md", Duration: time.Minute, ZeroDepth: true}); err != webdav.ErrLocked {
+		t.Fatalf("owner Create alice's file: got %v, want ErrLocked", err)
+	}
+
+	details, err := alice.Refresh(now, tok, time.Minute)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if details.Root != "/notes.md" {
+		t.Fatalf("Refresh root = %q, want /notes.md", details.Root)
+	}
+
+	rootTok, err := alice.Create(now, webdav.LockDetails{Root: "/", Duration: time.Minute, ZeroDepth: true})
+	if err != nil {
+		t.Fatalf("alice Create /: %v", err)
+	}
+	if details, err := alice.Refresh(now, rootTok, time.Minute); err != nil || details.Root != "/" {
+		t.Fatalf("Refresh / = %q, %v", details.Root, err)
+	}
+}
@@ -3,10 +3,11 @@
 // Two modes are supported:
 //
 //	none      — all APIs are open
-//	password  — owner session cookie required (set by POST /api/system/auth/login)
+//	password  — session cookie required (set by POST /api/system/auth/login),
+//	            either for the owner or for an account in the users table
 //
 // Third-party access (OAuth, Connect, scoped tokens) is the cloud gateway's
-// responsibility; the backend itself is user-agnostic.
+// responsibility.
 package auth
 
 import (
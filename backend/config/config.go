@@ -40,6 +40,36 @@ type Config struct {
 	AgentAPIKey     string // AGENT_API_KEY — gateway API key
 	AgentModels     string // AGENT_MODELS — JSON array of available models
 
+	// AgentFramesCompress (AGENT_FRAMES_COMPRESS=1) stores the frames of
+	// archived agent sessions zstd-compressed.
+	AgentFramesCompress bool
+
+	// AgentRegistryFile (AGENT_REGISTRY_FILE) declares extra ACP agents;
+	// defaults to <APP_DATA_DIR>/agents.json. It names commands the server
+	// runs, so it must live outside USER_DATA_DIR.
+	AgentRegistryFile string
+
+	// Warm agent process pools: AGENT_POOL_MAX_WARM caps the pre-spawned
+	// processes across all agents and models (0 = no cap),
+	// AGENT_POOL_MEMORY_MB caps their combined resident memory (0 = no cap).
+	AgentPoolMaxWarm  int
+	AgentPoolMemoryMB int
+
+	// Resource limits for each agent process and everything it runs
+	// (0 = no limit): AGENT_LIMIT_CPUS (cores, fractions allowed),
+	// AGENT_LIMIT_MEMORY_MB, AGENT_LIMIT_PIDS, AGENT_TURN_TIMEOUT_SECS (time
+	// waiting on a permission request doesn't count) and
+	// AGENT_COMMAND_TIMEOUT_SECS (terminal commands).
+	// AGENT_ISOLATE_NETWORK=1 runs terminal commands without network access.
+	// Both only reach commands run through the ACP terminal API, not an
+	// agent's built-in shell tool (claude-agent-acp's Bash).
+	AgentLimitCPUs          float64
+	AgentLimitMemoryMB      int
+	AgentLimitPids          int
+	AgentTurnTimeoutSecs    int
+	AgentCommandTimeoutSecs int
+	AgentIsolateNetwork     bool
+
 	// Debug settings
 	DBLogQueries bool
 	DebugModules string
@@ -85,6 +115,11 @@ func load() *Config {
 	simpleExtPath := filepath.Join(extDir, libBase)
 	simpleDictDir := filepath.Join(extDir, "dict")
 
+	agentRegistryFile := getEnv("AGENT_REGISTRY_FILE", filepath.Join(appDataDir, "agents.json"))
+	if abs, err := filepath.Abs(agentRegistryFile); err == nil {
+		agentRegistryFile = abs
+	}
+
 	authMode := getEnv("MLD_AUTH_MODE", "none")
 	switch strings.ToLower(authMode) {
 	case "none", "password":
@@ -120,6 +155,22 @@ func load() *Config {
 		AgentAPIKey:     getEnv("AGENT_API_KEY", ""),
 		AgentModels:     getEnv("AGENT_MODELS", ""),
 
+		// Agent frames
+		AgentFramesCompress: getEnv("AGENT_FRAMES_COMPRESS", "") == "1",
+		AgentRegistryFile:   agentRegistryFile,
+
+		// Agent process pools
+		AgentPoolMaxWarm:  getEnvInt("AGENT_POOL_MAX_WARM", 8),
+		AgentPoolMemoryMB: getEnvInt("AGENT_POOL_MEMORY_MB", 0),
+
+		// Agent process limits
+		AgentLimitCPUs:          getEnvFloat("AGENT_LIMIT_CPUS", 0),
+		AgentLimitMemoryMB:      getEnvInt("AGENT_LIMIT_MEMORY_MB", 0),
+		AgentLimitPids:          getEnvInt("AGENT_LIMIT_PIDS", 0),
+		AgentTurnTimeoutSecs:    getEnvInt("AGENT_TURN_TIMEOUT_SECS", 0),
+		AgentCommandTimeoutSecs: getEnvInt("AGENT_COMMAND_TIMEOUT_SECS", 0),
+		AgentIsolateNetwork:     getEnv("AGENT_ISOLATE_NETWORK", "") == "1",
+
 		// Debug
 		DBLogQueries: getEnv("DB_LOG_QUERIES", "") == "1",
 		DebugModules: getEnv("DEBUG", ""),
@@ -162,7 +213,11 @@ var appEnvKeys = []string{
 	// Auth
 	"MLD_AUTH_MODE",
 	// Agent LLM gateway
-	"AGENT_BASE_URL", "AGENT_API_KEY", "AGENT_MODELS",
+	"AGENT_BASE_URL", "AGENT_API_KEY", "AGENT_MODELS", "AGENT_FRAMES_COMPRESS",
+	"AGENT_REGISTRY_FILE",
+	"AGENT_POOL_MAX_WARM", "AGENT_POOL_MEMORY_MB",
+	"AGENT_LIMIT_CPUS", "AGENT_LIMIT_MEMORY_MB", "AGENT_LIMIT_PIDS",
+	"AGENT_TURN_TIMEOUT_SECS", "AGENT_COMMAND_TIMEOUT_SECS", "AGENT_ISOLATE_NETWORK",
 	// ANTHROPIC_* (deployment mirrors AGENT_* for agent child processes)
 	"ANTHROPIC_API_KEY", "ANTHROPIC_BASE_URL", "ANTHROPIC_CUSTOM_HEADERS",
 	"ANTHROPIC_MODEL", "ANTHROPIC_SMALL_FAST_MODEL",
@@ -204,3 +259,12 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+// Approval statuses, persisted in agent_approvals.status.
+const (
+	ApprovalPending   = "pending"
+	ApprovalApproved  = "approved"
+	ApprovalDenied    = "denied"
+	ApprovalCancelled = "cancelled" // the turn ended (or the server restarted) unanswered
+)
+
+// AgentApprovalRecord is a permission request from a gated auto-agent run,
+// waiting in (or answered from) the approvals inbox.
+type AgentApprovalRecord struct {
+	ID         string          `json:"id"`
+	SessionID  string          `json:"sessionId"`
+	ToolCallID string          `json:"toolCallId"`
+	AgentName  string          `json:"agentName,omitempty"`
+	Title      string          `json:"title"`
+	ToolCall   json.RawMessage `json:"toolCall"`
+	Options    json.RawMessage `json:"options"`
+	Status     string          `json:"status"`
+	OptionID   string          `json:"optionId,omitempty"`
+	ResolvedBy string          `json:"resolvedBy,omitempty"`
+	OnTimeout  string          `json:"onTimeout"`
+	ExpiresAt  int64           `json:"expiresAt"`
+	CreatedAt  int64           `json:"createdAt"`
+	ResolvedAt int64           `json:"resolvedAt,omitempty"`
+}
+
+const agentApprovalColumns = `id, session_id, tool_call_id, agent_name, title, tool_call, options, status, option_id, resolved_by, on_timeout, expires_at, created_at, resolved_at`
+
+func scanAgentApproval(row interface{ Scan(...any) error }) (*AgentApprovalRecord, error) {
+	var r AgentApprovalRecord
+	var toolCall, options string
+	if err := row.Scan(&r.ID, &r.SessionID, &r.ToolCallID, &r.AgentName, &r.Title, &toolCall, &options, &r.Status, &r.OptionID, &r.ResolvedBy, &r.OnTimeout, &r.ExpiresAt, &r.CreatedAt, &r.ResolvedAt); err != nil {
+		return nil, err
+	}
+	r.ToolCall = json.RawMessage(toolCall)
+	r.Options = json.RawMessage(options)
+	return &r, nil
+}
+
+func (d *DB) queryAgentApprovals(query string, args ...any) ([]AgentApprovalRecord, error) {
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	approvals := []AgentApprovalRecord{}
+	for rows.Next() {
+		r, err := scanAgentApproval(rows)
+		if err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
+// CreateAgentApproval inserts a pending approval. The caller sets ID and
+// ExpiresAt.
+func (d *DB) CreateAgentApproval(ctx context.Context, r *AgentApprovalRecord) error {
+	if r.CreatedAt == 0 {
+		r.CreatedAt = NowMs()
+	}
+	r.Status = ApprovalPending
+	if len(r.ToolCall) == 0 {
+		r.ToolCall = json.RawMessage(`{}`)
+	}
+	if len(r.Options) == 0 {
+		r.Options = json.RawMessage(`[]`)
+	}
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`INSERT INTO agent_approvals (`+agentApprovalColumns+`)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.ID, r.SessionID, r.ToolCallID, r.AgentName, r.Title, string(r.ToolCall), string(r.Options),
+			r.Status, r.OptionID, r.ResolvedBy, r.OnTimeout, r.ExpiresAt, r.CreatedAt, r.ResolvedAt,
+		)
+		return err
+	})
+}
+
+// GetAgentApproval returns an approval by ID, or nil if not found.
+func (d *DB) GetAgentApproval(id string) (*AgentApprovalRecord, error) {
+	r, err := scanAgentApproval(d.conn.QueryRow(
+		`SELECT `+agentApprovalColumns+` FROM agent_approvals WHERE id = ?`, id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// GetPendingAgentApproval returns the pending approval for a session's tool
+// call, or nil if there is none.
+func (d *DB) GetPendingAgentApproval(sessionID, toolCallID string) (*AgentApprovalRecord, error) {
+	r, err := scanAgentApproval(d.conn.QueryRow(
+		`SELECT `+agentApprovalColumns+` FROM agent_approvals
+		 WHERE session_id = ? AND tool_call_id = ? AND status = 'pending'`, sessionID, toolCallID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// ListAgentApprovals returns approvals newest first, filtered by status when
+// non-empty. When userID is non-nil only approvals for that account's
+// sessions are returned.
+func (d *DB) ListAgentApprovals(status string, limit int, userID *string) ([]AgentApprovalRecord, error) {
+	query := `SELECT ` + agentApprovalColumns + ` FROM agent_approvals WHERE 1 = 1`
+	var args []any
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	if userID != nil {
+		query += ` AND session_id IN (SELECT session_id FROM agent_sessions WHERE user_id = ?)`
+		args = append(args, *userID)
+	}
+	query += ` ORDER BY created_at DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	return d.queryAgentApprovals(query, args...)
+}
+
+// ListExpiredAgentApprovals returns pending approvals whose timeout has
+// passed at nowMs, oldest first.
+func (d *DB) ListExpiredAgentApprovals(nowMs int64) ([]AgentApprovalRecord, error) {
+	return d.queryAgentApprovals(
+		`SELECT `+agentApprovalColumns+` FROM agent_approvals
+		 WHERE status = 'pending' AND expires_at <= ? ORDER BY expires_at`, nowMs,
+	)
+}
+
+// ResolveAgentApproval records the answer to a pending approval. Returns
+// false when it was not pending (already answered, cancelled or unknown),
+// so two concurrent answers can't both win.
+func (d *DB) ResolveAgentApproval(ctx context.Context, id, status, optionID, resolvedBy string, atMs int64) (bool, error) {
+	var resolved bool
+	err := d.Write(ctx, func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`UPDATE agent_approvals
+			 SET status = ?, option_id = ?, resolved_by = ?, resolved_at = ?
+			 WHERE id = ? AND status = 'pending'`,
+			status, optionID, resolvedBy, atMs, id,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		resolved = n > 0
+		return err
+	})
+	return resolved, err
+}
+
+// CancelPendingAgentApprovals marks a session's pending approvals — every
+// session's when sessionID is empty — as cancelled. Returns how many were.
+func (d *DB) CancelPendingAgentApprovals(ctx context.Context, sessionID string, atMs int64) (int64, error) {
+	var affected int64
+	err := d.Write(ctx, func(tx *sql.Tx) error {
+		query := `UPDATE agent_approvals SET status = 'cancelled', resolved_at = ? WHERE status = 'pending'`
+		args := []any{atMs}
+		if sessionID != "" {
+			query += ` AND session_id = ?`
+			args = append(args, sessionID)
+		}
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		affected, err = res.RowsAffected()
+		return err
+	})
+	return affected, err
+}
+
+// SaveAgentSessionApprovalPolicy gates a session: its permission requests go
+// to the approvals inbox, wait up to timeoutMs, then get onTimeout.
+func (d *DB) SaveAgentSessionApprovalPolicy(ctx context.Context, sessionID string, timeoutMs int64, onTimeout string) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`UPDATE agent_sessions SET approval_timeout_ms = ?, approval_on_timeout = ?
+			 WHERE session_id = ?`,
+			timeoutMs, onTimeout, sessionID,
+		)
+		return err
+	})
+}
+
+// GetAgentSessionApprovalPolicy returns a session's approval policy;
+// timeoutMs is 0 when the session isn't gated.
+func (d *DB) GetAgentSessionApprovalPolicy(sessionID string) (timeoutMs int64, onTimeout string, err error) {
+	err = d.conn.QueryRow(
+		`SELECT approval_timeout_ms, approval_on_timeout FROM agent_sessions WHERE session_id = ?`, sessionID,
+	).Scan(&timeoutMs, &onTimeout)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	return timeoutMs, onTimeout, err
+}
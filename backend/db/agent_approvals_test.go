@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAgentApprovals(t *testing.T) {
+	d := openTestAppDB(t)
+	ctx := context.Background()
+
+	for _, id := range []string{"s1", "s2"} {
+		if err := d.CreateAgentSession(ctx, id, "claude_code", "", "", "auto", "cleanup", "", "", "st-"+id, OwnerUserID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ms, _, err := d.GetAgentSessionApprovalPolicy("s1"); err != nil || ms != 0 {
+		t.Fatalf("policy before gating = %d, %v", ms, err)
+	}
+	if err := d.SaveAgentSessionApprovalPolicy(ctx, "s1", 60000, "approve"); err != nil {
+		t.Fatal(err)
+	}
+	if ms, onTimeout, err := d.GetAgentSessionApprovalPolicy("s1"); err != nil || ms != 60000 || onTimeout != "approve" {
+		t.Fatalf("policy = %d, %q, %v", ms, onTimeout, err)
+	}
+
+	a := &AgentApprovalRecord{ID: "a", SessionID: "s1", ToolCallID: "t1", Title: "rm -rf build", ExpiresAt: 100, CreatedAt: 1}
+	b := &AgentApprovalRecord{ID: "b", SessionID: "s1", ToolCallID: "t2", ExpiresAt: 200, CreatedAt: 2}
+	c := &AgentApprovalRecord{ID: "c", SessionID: "s2", ToolCallID: "t1", ExpiresAt: 300, CreatedAt: 3}
+	for _, r := range []*AgentApprovalRecord{a, b, c} {
+		if err := d.CreateAgentApproval(ctx, r); err != nil {
+			t.Fatalf("Create %s: %v", r.ID, err)
+		}
+	}
+
+	if got, err := d.GetPendingAgentApproval("s1", "t1"); err != nil || got == nil || got.ID != "a" || string(got.Options) != "[]" {
+		t.Fatalf("GetPending = %+v, %v", got, err)
+	}
+	if got, _ := d.ListAgentApprovals(ApprovalPending, 0, nil); len(got) != 3 || got[0].ID != "c" {
+		t.Fatalf("pending = %+v", got)
+	}
+	if got, _ := d.ListExpiredAgentApprovals(200); len(got) != 2 || got[0].ID != "a" {
+		t.Fatalf("expired = %+v", got)
+	}
+
+	// Only the first answer wins.
+	if ok, err := d.ResolveAgentApproval(ctx, "a", ApprovalDenied, "reject", "user", 50); !ok || err != nil {
+		t.Fatalf("Resolve = %v, %v", ok, err)
+	}
+	if ok, _ := d.ResolveAgentApproval(ctx, "a", ApprovalApproved, "allow", "timeout", 60); ok {
+		t.Error("second Resolve reported success")
+	}
+	got, _ := d.GetAgentApproval("a")
+	if got.Status != ApprovalDenied || got.OptionID != "reject" || got.ResolvedBy != "user" || got.ResolvedAt != 50 {
+		t.Errorf("resolved = %+v", got)
+	}
+	if got, _ := d.GetPendingAgentApproval("s1", "t1"); got != nil {
+		t.Errorf("GetPending after resolve = %+v", got)
+	}
+
+	if n, err := d.CancelPendingAgentApprovals(ctx, "s1", 70); n != 1 || err != nil {
+		t.Fatalf("Cancel s1 = %d, %v", n, err)
+	}
+	if got, _ := d.GetAgentApproval("b"); got.Status != ApprovalCancelled {
+		t.Errorf("b status = %q", got.Status)
+	}
+	if n, _ := d.CancelPendingAgentApprovals(ctx, "", 80); n != 1 {
+		t.Errorf("Cancel all = %d, want 1", n)
+	}
+	if got, _ := d.ListAgentApprovals("", 0, nil); len(got) != 3 {
+		t.Errorf("all = %+v", got)
+	}
+	other := "someone-else"
+	if got, _ := d.ListAgentApprovals("", 0, &other); len(got) != 0 {
+		t.Errorf("other user's approvals = %+v", got)
+	}
+}
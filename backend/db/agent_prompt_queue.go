@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// QueuedPromptRecord is a follow-up prompt waiting for the session's current
+// turn to finish.
+type QueuedPromptRecord struct {
+	ID        string `json:"id"`
+	SessionID string `json:"sessionId"`
+	Prompt    string `json:"prompt"`
+	MessageID string `json:"messageId,omitempty"`
+	Position  int64  `json:"position"`
+	CreatedAt int64  `json:"createdAt"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// EnqueueAgentPrompt appends a prompt to the end of the session's queue.
+func (d *DB) EnqueueAgentPrompt(ctx context.Context, sessionID, prompt, messageID string) (*QueuedPromptRecord, error) {
+	r := &QueuedPromptRecord{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Prompt:    prompt,
+		MessageID: messageID,
+		CreatedAt: NowMs(),
+	}
+	r.UpdatedAt = r.CreatedAt
+	err := d.Write(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRow(
+			`SELECT COALESCE(MAX(position), 0) + 1 FROM agent_prompt_queue WHERE session_id = ?`,
+			sessionID,
+		).Scan(&r.Position); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			`INSERT INTO agent_prompt_queue (id, session_id, prompt, message_id, position, created_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			r.ID, r.SessionID, r.Prompt, r.MessageID, r.Position, r.CreatedAt, r.UpdatedAt,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ListQueuedAgentPrompts returns the session's queue in dispatch order.
+func (d *DB) ListQueuedAgentPrompts(sessionID string) ([]QueuedPromptRecord, error) {
+	rows, err := d.conn.Query(
+		`SELECT id, session_id, prompt, message_id, position, created_at, updated_at
+		 FROM agent_prompt_queue WHERE session_id = ? ORDER BY position`,
+		sessionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queue := []QueuedPromptRecord{}
+	for rows.Next() {
+		var r QueuedPromptRecord
+		if err := rows.Scan(&r.ID, &r.SessionID, &r.Prompt, &r.MessageID, &r.Position, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		queue = append(queue, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+// UpdateQueuedAgentPrompt replaces the text of a queued prompt. Returns false
+// when the item is gone (already sent, removed, or never existed).
+func (d *DB) UpdateQueuedAgentPrompt(ctx context.Context, sessionID, id, prompt string) (bool, error) {
+	var found bool
+	err := d.Write(ctx, func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`UPDATE agent_prompt_queue SET prompt = ?, updated_at = ? WHERE id = ? AND session_id = ?`,
+			prompt, NowMs(), id, sessionID,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		found = n > 0
+		return err
+	})
+	return found, err
+}
+
+// DeleteQueuedAgentPrompt removes one queued prompt. Returns false when the
+// item is gone.
+func (d *DB) DeleteQueuedAgentPrompt(ctx context.Context, sessionID, id string) (bool, error) {
+	var found bool
+	err := d.Write(ctx, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM agent_prompt_queue WHERE id = ? AND session_id = ?`, id, sessionID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		found = n > 0
+		return err
+	})
+	return found, err
+}
+
+// PopQueuedAgentPrompt removes and returns the head of the session's queue,
+// or nil when the queue is empty.
+func (d *DB) PopQueuedAgentPrompt(ctx context.Context, sessionID string) (*QueuedPromptRecord, error) {
+	var popped *QueuedPromptRecord
+	err := d.Write(ctx, func(tx *sql.Tx) error {
+		var r QueuedPromptRecord
+		err := tx.QueryRow(
+			`SELECT id, session_id, prompt, message_id, position, created_at, updated_at
+			 FROM agent_prompt_queue WHERE session_id = ? ORDER BY position LIMIT 1`,
+			sessionID,
+		).Scan(&r.ID, &r.SessionID, &r.Prompt, &r.MessageID, &r.Position, &r.CreatedAt, &r.UpdatedAt)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM agent_prompt_queue WHERE id = ?`, r.ID); err != nil {
+			return err
+		}
+		popped = &r
+		return nil
+	})
+	return popped, err
+}
+
+// ClearAgentPromptQueue empties the session's queue and returns what it held,
+// in dispatch order.
+func (d *DB) ClearAgentPromptQueue(ctx context.Context, sessionID string) ([]QueuedPromptRecord, error) {
+	queue, err := d.ListQueuedAgentPrompts(sessionID)
+	if err != nil || len(queue) == 0 {
+		return queue, err
+	}
+	err = d.Write(ctx, func(tx *sql.Tx) error {
+		for _, r := range queue {
+			if _, err := tx.Exec(`DELETE FROM agent_prompt_queue WHERE id = ?`, r.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return queue, err
+}
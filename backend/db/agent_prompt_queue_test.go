@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAgentPromptQueue(t *testing.T) {
+	d := openTestAppDB(t)
+	ctx := context.Background()
+
+	first, err := d.EnqueueAgentPrompt(ctx, "s1", "run the tests", "m1")
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	second, _ := d.EnqueueAgentPrompt(ctx, "s1", "then fix them", "")
+	third, _ := d.EnqueueAgentPrompt(ctx, "s1", "and commit", "")
+	if _, err := d.EnqueueAgentPrompt(ctx, "s2", "other session", ""); err != nil {
+		t.Fatalf("Enqueue s2: %v", err)
+	}
+
+	if ok, err := d.UpdateQueuedAgentPrompt(ctx, "s1", second.ID, "then fix the failures"); !ok || err != nil {
+		t.Fatalf("Update = %v, %v", ok, err)
+	}
+	if ok, _ := d.UpdateQueuedAgentPrompt(ctx, "s2", second.ID, "wrong session"); ok {
+		t.Error("Update matched an item from another session")
+	}
+	if ok, err := d.DeleteQueuedAgentPrompt(ctx, "s1", third.ID); !ok || err != nil {
+		t.Fatalf("Delete = %v, %v", ok, err)
+	}
+
+	head, err := d.PopQueuedAgentPrompt(ctx, "s1")
+	if err != nil || head == nil || head.ID != first.ID || head.MessageID != "m1" {
+		t.Fatalf("Pop = %+v, %v; want the first item", head, err)
+	}
+	queue, _ := d.ListQueuedAgentPrompts("s1")
+	if len(queue) != 1 || queue[0].Prompt != "then fix the failures" {
+		t.Fatalf("queue = %+v", queue)
+	}
+
+	// New items go after the remaining ones, not into the freed slot.
+	fourth, _ := d.EnqueueAgentPrompt(ctx, "s1", "push", "")
+	if fourth.Position <= queue[0].Position {
+		t.Errorf("position %d not after %d", fourth.Position, queue[0].Position)
+	}
+
+	flushed, err := d.ClearAgentPromptQueue(ctx, "s1")
+	if err != nil || len(flushed) != 2 || flushed[0].ID != second.ID || flushed[1].ID != fourth.ID {
+		t.Fatalf("Clear = %+v, %v", flushed, err)
+	}
+	if head, _ := d.PopQueuedAgentPrompt(ctx, "s1"); head != nil {
+		t.Errorf("Pop after clear = %+v", head)
+	}
+	if queue, _ := d.ListQueuedAgentPrompts("s2"); len(queue) != 1 {
+		t.Errorf("s2 queue = %+v", queue)
+	}
+}
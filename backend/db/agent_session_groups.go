@@ -11,21 +11,22 @@ import (
 // AgentSessionGroupRecord represents a single group row.
 type AgentSessionGroupRecord struct {
 	ID        string `json:"id"`
+	UserID    string `json:"-"` // owning account; '' = the owner
 	Name      string `json:"name"`
 	SortOrder int    `json:"sortOrder"`
 	CreatedAt int64  `json:"createdAt"`
 	UpdatedAt int64  `json:"updatedAt"`
 }
 
-// CreateAgentSessionGroup inserts a new group, appending it after the current
-// max sort_order. Returns the created record.
-func (d *DB) CreateAgentSessionGroup(ctx context.Context, name string) (*AgentSessionGroupRecord, error) {
+// CreateAgentSessionGroup inserts a new group for userID, appending it after
+// that account's current max sort_order. Returns the created record.
+func (d *DB) CreateAgentSessionGroup(ctx context.Context, name, userID string) (*AgentSessionGroupRecord, error) {
 	id := uuid.New().String()
 	now := NowMs()
 
 	// Find current max sort_order; default to 0.
 	var maxOrder sql.NullInt64
-	if err := d.conn.QueryRow(`SELECT MAX(sort_order) FROM agent_session_groups`).Scan(&maxOrder); err != nil {
+	if err := d.conn.QueryRow(`SELECT MAX(sort_order) FROM agent_session_groups WHERE user_id = ?`, userID).Scan(&maxOrder); err != nil {
 		return nil, err
 	}
 	next := 0
@@ -35,9 +36,9 @@ func (d *DB) CreateAgentSessionGroup(ctx context.Context, name string) (*AgentSe
 
 	if err := d.Write(ctx, func(tx *sql.Tx) error {
 		_, err := tx.Exec(
-			`INSERT INTO agent_session_groups (id, name, sort_order, created_at, updated_at)
-			 VALUES (?, ?, ?, ?, ?)`,
-			id, name, next, now, now,
+			`INSERT INTO agent_session_groups (id, user_id, name, sort_order, created_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?)`,
+			id, userID, name, next, now, now,
 		)
 		return err
 	}); err != nil {
@@ -46,6 +47,7 @@ func (d *DB) CreateAgentSessionGroup(ctx context.Context, name string) (*AgentSe
 
 	return &AgentSessionGroupRecord{
 		ID:        id,
+		UserID:    userID,
 		Name:      name,
 		SortOrder: next,
 		CreatedAt: now,
@@ -53,12 +55,14 @@ func (d *DB) CreateAgentSessionGroup(ctx context.Context, name string) (*AgentSe
 	}, nil
 }
 
-// ListAgentSessionGroups returns all groups ordered by sort_order ASC.
-func (d *DB) ListAgentSessionGroups() ([]AgentSessionGroupRecord, error) {
+// ListAgentSessionGroups returns userID's groups ordered by sort_order ASC.
+func (d *DB) ListAgentSessionGroups(userID string) ([]AgentSessionGroupRecord, error) {
 	rows, err := d.conn.Query(
-		`SELECT id, name, sort_order, created_at, updated_at
+		`SELECT id, user_id, name, sort_order, created_at, updated_at
 		 FROM agent_session_groups
+		 WHERE user_id = ?
 		 ORDER BY sort_order ASC, created_at ASC`,
+		userID,
 	)
 	if err != nil {
 		return nil, err
@@ -68,7 +72,7 @@ func (d *DB) ListAgentSessionGroups() ([]AgentSessionGroupRecord, error) {
 	var groups []AgentSessionGroupRecord
 	for rows.Next() {
 		var g AgentSessionGroupRecord
-		if err := rows.Scan(&g.ID, &g.Name, &g.SortOrder, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		if err := rows.Scan(&g.ID, &g.UserID, &g.Name, &g.SortOrder, &g.CreatedAt, &g.UpdatedAt); err != nil {
 			return nil, err
 		}
 		groups = append(groups, g)
@@ -83,9 +87,9 @@ func (d *DB) ListAgentSessionGroups() ([]AgentSessionGroupRecord, error) {
 func (d *DB) GetAgentSessionGroup(id string) (*AgentSessionGroupRecord, error) {
 	var g AgentSessionGroupRecord
 	err := d.conn.QueryRow(
-		`SELECT id, name, sort_order, created_at, updated_at FROM agent_session_groups WHERE id = ?`,
+		`SELECT id, user_id, name, sort_order, created_at, updated_at FROM agent_session_groups WHERE id = ?`,
 		id,
-	).Scan(&g.ID, &g.Name, &g.SortOrder, &g.CreatedAt, &g.UpdatedAt)
+	).Scan(&g.ID, &g.UserID, &g.Name, &g.SortOrder, &g.CreatedAt, &g.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -123,14 +127,15 @@ func (d *DB) DeleteAgentSessionGroup(ctx context.Context, id string) error {
 // ReorderAgentSessionGroups assigns sort_order = 0..N-1 in the given ID order.
 // IDs not present in the input are left at their current sort_order (which will
 // likely sort below the explicit list since explicit values start at 0). To get
-// a clean ordering, callers should pass the full list of group IDs.
-func (d *DB) ReorderAgentSessionGroups(ctx context.Context, orderedIDs []string) error {
+// a clean ordering, callers should pass the full list of group IDs. Only
+// userID's groups are touched.
+func (d *DB) ReorderAgentSessionGroups(ctx context.Context, userID string, orderedIDs []string) error {
 	return d.Write(ctx, func(tx *sql.Tx) error {
 		now := NowMs()
 		for i, id := range orderedIDs {
 			if _, err := tx.Exec(
-				`UPDATE agent_session_groups SET sort_order = ?, updated_at = ? WHERE id = ?`,
-				i, now, id,
+				`UPDATE agent_session_groups SET sort_order = ?, updated_at = ? WHERE id = ? AND user_id = ?`,
+				i, now, id, userID,
 			); err != nil {
 				return fmt.Errorf("reorder group %s: %w", id, err)
 			}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAgentSessionGroups_PerUser(t *testing.T) {
+	d := openTestAppDB(t)
+	ctx := context.Background()
+
+	ownerGroup, err := d.CreateAgentSessionGroup(ctx, "Work", OwnerUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a1, _ := d.CreateAgentSessionGroup(ctx, "Alice 1", "alice")
+	a2, _ := d.CreateAgentSessionGroup(ctx, "Alice 2", "alice")
+	if a1.SortOrder != 0 || a2.SortOrder != 1 {
+		t.Errorf("alice sort orders = %d, %d; want 0, 1 (independent of the owner's)", a1.SortOrder, a2.SortOrder)
+	}
+
+	if got, _ := d.ListAgentSessionGroups(OwnerUserID); len(got) != 1 || got[0].ID != ownerGroup.ID {
+		t.Errorf("owner groups = %+v", got)
+	}
+	if got, _ := d.ListAgentSessionGroups("alice"); len(got) != 2 {
+		t.Errorf("alice groups = %+v", got)
+	}
+	if g, _ := d.GetAgentSessionGroup(a1.ID); g == nil || g.UserID != "alice" {
+		t.Errorf("Get = %+v", g)
+	}
+
+	// Reordering only touches the caller's groups.
+	if err := d.ReorderAgentSessionGroups(ctx, "alice", []string{a2.ID, a1.ID, ownerGroup.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := d.ListAgentSessionGroups("alice"); got[0].ID != a2.ID {
+		t.Errorf("alice order = %+v", got)
+	}
+	if g, _ := d.GetAgentSessionGroup(ownerGroup.ID); g.SortOrder != 0 {
+		t.Errorf("owner group sort order = %d, want untouched 0", g.SortOrder)
+	}
+}
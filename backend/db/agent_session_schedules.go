@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// AgentSessionScheduleRecord is a prompt scheduled into an existing agent
+// session: once at RunAt, or on CronExpr.
+type AgentSessionScheduleRecord struct {
+	ID        string `json:"id"`
+	SessionID string `json:"sessionId"`
+	Prompt    string `json:"prompt"`
+	CronExpr  string `json:"cron,omitempty"`
+	RunAt     int64  `json:"runAt,omitempty"`
+	LastRunAt int64  `json:"lastRunAt,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+const agentSessionScheduleColumns = `id, session_id, prompt, cron_expr, run_at, last_run_at, created_at`
+
+func scanAgentSessionSchedule(row interface{ Scan(...any) error }) (*AgentSessionScheduleRecord, error) {
+	var r AgentSessionScheduleRecord
+	if err := row.Scan(&r.ID, &r.SessionID, &r.Prompt, &r.CronExpr, &r.RunAt, &r.LastRunAt, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateAgentSessionSchedule inserts a schedule. The caller sets ID.
+func (d *DB) CreateAgentSessionSchedule(ctx context.Context, r *AgentSessionScheduleRecord) error {
+	if r.CreatedAt == 0 {
+		r.CreatedAt = NowMs()
+	}
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`INSERT INTO agent_session_schedules (`+agentSessionScheduleColumns+`)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			r.ID, r.SessionID, r.Prompt, r.CronExpr, r.RunAt, r.LastRunAt, r.CreatedAt,
+		)
+		return err
+	})
+}
+
+// GetAgentSessionSchedule returns a schedule by ID, or nil if not found.
+func (d *DB) GetAgentSessionSchedule(id string) (*AgentSessionScheduleRecord, error) {
+	r, err := scanAgentSessionSchedule(d.conn.QueryRow(
+		`SELECT `+agentSessionScheduleColumns+` FROM agent_session_schedules WHERE id = ?`, id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// ListAgentSessionSchedules returns one session's schedules, or every
+// session's when sessionID is empty, oldest first.
+func (d *DB) ListAgentSessionSchedules(sessionID string) ([]AgentSessionScheduleRecord, error) {
+	query := `SELECT ` + agentSessionScheduleColumns + ` FROM agent_session_schedules`
+	var args []any
+	if sessionID != "" {
+		query += ` WHERE session_id = ?`
+		args = append(args, sessionID)
+	}
+	rows, err := d.conn.Query(query+` ORDER BY created_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []AgentSessionScheduleRecord{}
+	for rows.Next() {
+		r, err := scanAgentSessionSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// MarkAgentSessionScheduleRun records that a schedule fired at atMs.
+func (d *DB) MarkAgentSessionScheduleRun(ctx context.Context, id string, atMs int64) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE agent_session_schedules SET last_run_at = ? WHERE id = ?`, atMs, id)
+		return err
+	})
+}
+
+// DeleteAgentSessionSchedule removes a schedule. Returns false when it did
+// not exist.
+func (d *DB) DeleteAgentSessionSchedule(ctx context.Context, id string) (bool, error) {
+	var found bool
+	err := d.Write(ctx, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM agent_session_schedules WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		found = n > 0
+		return err
+	})
+	return found, err
+}
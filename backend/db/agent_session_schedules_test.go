@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAgentSessionSchedules(t *testing.T) {
+	d := openTestAppDB(t)
+	ctx := context.Background()
+
+	daily := &AgentSessionScheduleRecord{ID: "a", SessionID: "s1", Prompt: "check my inbox", CronExpr: "0 8 * * *"}
+	once := &AgentSessionScheduleRecord{ID: "b", SessionID: "s1", Prompt: "follow up", RunAt: 1700000000000}
+	other := &AgentSessionScheduleRecord{ID: "c", SessionID: "s2", Prompt: "other", CronExpr: "@hourly"}
+	for _, r := range []*AgentSessionScheduleRecord{daily, once, other} {
+		if err := d.CreateAgentSessionSchedule(ctx, r); err != nil {
+			t.Fatalf("Create %s: %v", r.ID, err)
+		}
+	}
+
+	if got, _ := d.ListAgentSessionSchedules("s1"); len(got) != 2 {
+		t.Fatalf("s1 schedules = %+v", got)
+	}
+	if got, _ := d.ListAgentSessionSchedules(""); len(got) != 3 {
+		t.Fatalf("all schedules = %+v", got)
+	}
+
+	if err := d.MarkAgentSessionScheduleRun(ctx, "a", 42); err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.GetAgentSessionSchedule("a")
+	if err != nil || got == nil || got.LastRunAt != 42 || got.CronExpr != "0 8 * * *" {
+		t.Fatalf("Get = %+v, %v", got, err)
+	}
+
+	if ok, err := d.DeleteAgentSessionSchedule(ctx, "b"); !ok || err != nil {
+		t.Fatalf("Delete = %v, %v", ok, err)
+	}
+	if ok, _ := d.DeleteAgentSessionSchedule(ctx, "b"); ok {
+		t.Error("second Delete reported found")
+	}
+	if got, _ := d.GetAgentSessionSchedule("b"); got != nil {
+		t.Errorf("Get after delete = %+v", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // ── Agent session CRUD ──────────────────────────────────────────────────────
@@ -34,32 +35,36 @@ type AgentSessionRecord struct {
 	LastPromptText    string  `json:"lastPromptText,omitempty"`
 	LastPromptAt      *int64  `json:"lastPromptAt,omitempty"`
 	IsProcessing      bool    `json:"isProcessing"`
-	LastTurnOutcome   string  `json:"lastTurnOutcome,omitempty"`   // '' | 'completed' | 'cancelled' | 'interrupted' | 'errored'
+	LastTurnOutcome   string  `json:"lastTurnOutcome,omitempty"`   // '' | 'completed' | 'cancelled' | 'interrupted' | 'errored' | 'limited'
 	LastTurnOutcomeAt *int64  `json:"lastTurnOutcomeAt,omitempty"` // epoch ms
-	LastErrorMessage  string  `json:"lastErrorMessage,omitempty"`  // populated only when outcome='errored'
+	LastErrorMessage  string  `json:"lastErrorMessage,omitempty"`  // populated only when outcome='errored' or 'limited'
+	UserID            string  `json:"userId,omitempty"`            // owning account; OwnerUserID ('') for the owner
 }
 
 // Last-turn outcome constants. Persisted in the last_turn_outcome column and
 // surfaced through the API. Note: the API translates 'errored' -> 'error' for
-// the user-facing sessionState enum (verb form in DB, noun form in UI).
+// the user-facing sessionState enum (verb form in DB, noun form in UI), and
+// maps 'limited' to 'error' too.
 const (
 	OutcomeCompleted   = "completed"
 	OutcomeCancelled   = "cancelled"
 	OutcomeInterrupted = "interrupted"
 	OutcomeErrored     = "errored"
+	OutcomeLimited     = "limited" // agent killed for exceeding its resource limits
 )
 
 // CreateAgentSession inserts a new agent session record.
 // triggerKind / triggerData are populated only for auto sessions; pass empty strings otherwise.
-func (d *DB) CreateAgentSession(ctx context.Context, sessionID, agentType, workingDir, title, source, agentName, triggerKind, triggerData, storageID string) error {
+// userID attributes the session to an account (OwnerUserID for the owner and for auto runs).
+func (d *DB) CreateAgentSession(ctx context.Context, sessionID, agentType, workingDir, title, source, agentName, triggerKind, triggerData, storageID, userID string) error {
 	now := NowMs()
 	if source == "" {
 		source = "user"
 	}
 	return d.Write(ctx, func(tx *sql.Tx) error {
 		_, err := tx.Exec(
-			`INSERT INTO agent_sessions (session_id, agent_type, working_dir, title, source, agent_name, trigger_kind, trigger_data, storage_id, created_at, updated_at)
-			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`INSERT INTO agent_sessions (session_id, agent_type, working_dir, title, source, agent_name, trigger_kind, trigger_data, storage_id, user_id, created_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 			 ON CONFLICT(session_id) DO UPDATE SET
 			   agent_type = excluded.agent_type,
 			   working_dir = excluded.working_dir,
@@ -70,28 +75,23 @@ func (d *DB) CreateAgentSession(ctx context.Context, sessionID, agentType, worki
 			   trigger_data = CASE WHEN excluded.trigger_data != '' THEN excluded.trigger_data ELSE agent_sessions.trigger_data END,
 			   storage_id = CASE WHEN excluded.storage_id != '' THEN excluded.storage_id ELSE agent_sessions.storage_id END,
 			   updated_at = excluded.updated_at`,
-			sessionID, agentType, workingDir, title, source, agentName, triggerKind, triggerData, storageID, now, now,
+			sessionID, agentType, workingDir, title, source, agentName, triggerKind, triggerData, storageID, userID, now, now,
 		)
 		return err
 	})
 }
 
-// GetAgentSession retrieves a single session record.
-func (d *DB) GetAgentSession(sessionID string) (*AgentSessionRecord, error) {
+// agentSessionColumns is the column list scanAgentSession expects.
+const agentSessionColumns = `session_id, agent_type, working_dir, title, source, agent_name, trigger_kind, trigger_data, storage_id, group_id, pinned_at, created_at, updated_at, archived_at, last_prompt_text, last_prompt_at, is_processing, last_turn_outcome, last_turn_outcome_at, last_error_message, user_id`
+
+// scanAgentSession scans a row selected with agentSessionColumns.
+func scanAgentSession(row interface{ Scan(...any) error }) (AgentSessionRecord, error) {
 	var r AgentSessionRecord
 	var archivedAt, pinnedAt, lastPromptAt, lastTurnOutcomeAt sql.NullInt64
 	var groupID, lastPromptText sql.NullString
 	var isProcessing int
-	err := d.conn.QueryRow(
-		`SELECT session_id, agent_type, working_dir, title, source, agent_name, trigger_kind, trigger_data, storage_id, group_id, pinned_at, created_at, updated_at, archived_at, last_prompt_text, last_prompt_at, is_processing, last_turn_outcome, last_turn_outcome_at, last_error_message
-		 FROM agent_sessions WHERE session_id = ?`,
-		sessionID,
-	).Scan(&r.SessionID, &r.AgentType, &r.WorkingDir, &r.Title, &r.Source, &r.AgentName, &r.TriggerKind, &r.TriggerData, &r.StorageID, &groupID, &pinnedAt, &r.CreatedAt, &r.UpdatedAt, &archivedAt, &lastPromptText, &lastPromptAt, &isProcessing, &r.LastTurnOutcome, &lastTurnOutcomeAt, &r.LastErrorMessage)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
+	if err := row.Scan(&r.SessionID, &r.AgentType, &r.WorkingDir, &r.Title, &r.Source, &r.AgentName, &r.TriggerKind, &r.TriggerData, &r.StorageID, &groupID, &pinnedAt, &r.CreatedAt, &r.UpdatedAt, &archivedAt, &lastPromptText, &lastPromptAt, &isProcessing, &r.LastTurnOutcome, &lastTurnOutcomeAt, &r.LastErrorMessage, &r.UserID); err != nil {
+		return r, err
 	}
 	if archivedAt.Valid {
 		r.ArchivedAt = &archivedAt.Int64
@@ -112,15 +112,57 @@ func (d *DB) GetAgentSession(sessionID string) (*AgentSessionRecord, error) {
 	if lastTurnOutcomeAt.Valid {
 		r.LastTurnOutcomeAt = &lastTurnOutcomeAt.Int64
 	}
+	return r, nil
+}
+
+// GetAgentSession retrieves a single session record.
+func (d *DB) GetAgentSession(sessionID string) (*AgentSessionRecord, error) {
+	r, err := scanAgentSession(d.conn.QueryRow(
+		`SELECT `+agentSessionColumns+` FROM agent_sessions WHERE session_id = ?`,
+		sessionID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 	return &r, nil
 }
 
+// GetAgentSessionsByIDs retrieves multiple session records in a single
+// query, keyed by session ID. Unknown IDs are simply absent.
+func (d *DB) GetAgentSessionsByIDs(ids []string) (map[string]*AgentSessionRecord, error) {
+	result := make(map[string]*AgentSessionRecord, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := d.conn.Query(`SELECT `+agentSessionColumns+` FROM agent_sessions WHERE session_id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r, err := scanAgentSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[r.SessionID] = &r
+	}
+	return result, rows.Err()
+}
+
 // ListAgentSessions returns sessions ordered by most recent activity with cursor-based pagination.
 // cursor is the updated_at value of the last item from the previous page (0 for first page).
 // limit is the max number of results to return (0 for no limit).
-func (d *DB) ListAgentSessions(includeArchived bool, cursor int64, limit int) ([]AgentSessionRecord, error) {
-	query := `SELECT session_id, agent_type, working_dir, title, source, agent_name, trigger_kind, trigger_data, storage_id, group_id, pinned_at, created_at, updated_at, archived_at, last_prompt_text, last_prompt_at, is_processing, last_turn_outcome, last_turn_outcome_at, last_error_message
-		 FROM agent_sessions`
+// userID, when non-nil, restricts the list to sessions owned by that account.
+func (d *DB) ListAgentSessions(includeArchived bool, cursor int64, limit int, userID *string) ([]AgentSessionRecord, error) {
+	query := `SELECT ` + agentSessionColumns + ` FROM agent_sessions`
 
 	var conditions []string
 	var args []interface{}
@@ -131,6 +173,10 @@ func (d *DB) ListAgentSessions(includeArchived bool, cursor int64, limit int) ([
 		conditions = append(conditions, `updated_at < ?`)
 		args = append(args, cursor)
 	}
+	if userID != nil {
+		conditions = append(conditions, `user_id = ?`)
+		args = append(args, *userID)
+	}
 	if len(conditions) > 0 {
 		query += ` WHERE ` + conditions[0]
 		for _, c := range conditions[1:] {
@@ -150,32 +196,10 @@ func (d *DB) ListAgentSessions(includeArchived bool, cursor int64, limit int) ([
 
 	var results []AgentSessionRecord
 	for rows.Next() {
-		var r AgentSessionRecord
-		var archivedAt, pinnedAt, lastPromptAt, lastTurnOutcomeAt sql.NullInt64
-		var groupID, lastPromptText sql.NullString
-		var isProcessing int
-		if err := rows.Scan(&r.SessionID, &r.AgentType, &r.WorkingDir, &r.Title, &r.Source, &r.AgentName, &r.TriggerKind, &r.TriggerData, &r.StorageID, &groupID, &pinnedAt, &r.CreatedAt, &r.UpdatedAt, &archivedAt, &lastPromptText, &lastPromptAt, &isProcessing, &r.LastTurnOutcome, &lastTurnOutcomeAt, &r.LastErrorMessage); err != nil {
+		r, err := scanAgentSession(rows)
+		if err != nil {
 			return nil, err
 		}
-		if archivedAt.Valid {
-			r.ArchivedAt = &archivedAt.Int64
-		}
-		if groupID.Valid {
-			r.GroupID = &groupID.String
-		}
-		if pinnedAt.Valid {
-			r.PinnedAt = &pinnedAt.Int64
-		}
-		if lastPromptText.Valid {
-			r.LastPromptText = lastPromptText.String
-		}
-		if lastPromptAt.Valid {
-			r.LastPromptAt = &lastPromptAt.Int64
-		}
-		r.IsProcessing = isProcessing != 0
-		if lastTurnOutcomeAt.Valid {
-			r.LastTurnOutcomeAt = &lastTurnOutcomeAt.Int64
-		}
 		results = append(results, r)
 	}
 	if err := rows.Err(); err != nil {
@@ -699,8 +723,9 @@ func (d *DB) SetPromptInFlight(ctx context.Context, sessionID, promptText string
 
 // MarkTurnOutcome records the outcome of a turn that just ended: clears
 // is_processing, persists the outcome and timestamp, and stores an error
-// message (only meaningful when outcome='errored'). Bumps last_message_at so
-// the search index picks up any new assistant text from the completed turn.
+// message (only meaningful when outcome='errored' or 'limited'). Bumps
+// last_message_at so the search index picks up any new assistant text from
+// the completed turn.
 //
 // outcome must be one of the Outcome* constants. Pass empty errMessage for
 // non-error outcomes.
@@ -741,6 +766,25 @@ func (d *DB) MarkAllInProgressInterrupted(ctx context.Context, interruptedAt int
 	return affected, err
 }
 
+// ListProcessingAgentSessionIDs returns the sessions with a turn in flight
+// (is_processing=1).
+func (d *DB) ListProcessingAgentSessionIDs() ([]string, error) {
+	rows, err := d.conn.Query(`SELECT session_id FROM agent_sessions WHERE is_processing = 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 // ClearLastOutcome clears the last_turn_outcome state for a session (dismiss
 // banner). Resets all three outcome columns so the session derives back to
 // 'idle'.
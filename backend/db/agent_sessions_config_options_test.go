@@ -26,7 +26,7 @@ func openTestAppDB(t *testing.T) *DB {
 func TestAgentSessionConfigOptions_Empty(t *testing.T) {
 	d := openTestAppDB(t)
 	ctx := context.Background()
-	if err := d.CreateAgentSession(ctx, "s1", "claude_code", "/tmp", "", "user", "", "", "", "stor1"); err != nil {
+	if err := d.CreateAgentSession(ctx, "s1", "claude_code", "/tmp", "", "user", "", "", "", "stor1", OwnerUserID); err != nil {
 		t.Fatalf("CreateAgentSession: %v", err)
 	}
 	got, err := d.GetAgentSessionConfigOptions("s1")
@@ -41,7 +41,7 @@ func TestAgentSessionConfigOptions_Empty(t *testing.T) {
 func TestAgentSessionConfigOptions_SaveAndGet(t *testing.T) {
 	d := openTestAppDB(t)
 	ctx := context.Background()
-	if err := d.CreateAgentSession(ctx, "s1", "claude_code", "/tmp", "", "user", "", "", "", "stor1"); err != nil {
+	if err := d.CreateAgentSession(ctx, "s1", "claude_code", "/tmp", "", "user", "", "", "", "stor1", OwnerUserID); err != nil {
 		t.Fatalf("CreateAgentSession: %v", err)
 	}
 	if err := d.SaveAgentSessionConfigOption(ctx, "s1", "model", "gpt-5.4"); err != nil {
@@ -59,7 +59,7 @@ func TestAgentSessionConfigOptions_SaveAndGet(t *testing.T) {
 func TestAgentSessionConfigOptions_MergePreservesOtherKeys(t *testing.T) {
 	d := openTestAppDB(t)
 	ctx := context.Background()
-	if err := d.CreateAgentSession(ctx, "s1", "codex", "/tmp", "", "user", "", "", "", "stor1"); err != nil {
+	if err := d.CreateAgentSession(ctx, "s1", "codex", "/tmp", "", "user", "", "", "", "stor1", OwnerUserID); err != nil {
 		t.Fatalf("CreateAgentSession: %v", err)
 	}
 	if err := d.SaveAgentSessionConfigOption(ctx, "s1", "model", "gpt-5.4"); err != nil {
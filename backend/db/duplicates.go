@@ -0,0 +1,123 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// FilePhash is an image's perceptual hash, as stored in files.phash.
+type FilePhash struct {
+	Path  string
+	Size  int64
+	Phash uint64
+}
+
+// ListDuplicateFiles returns the files under folder ("" = the whole
+// library) of at least minSize bytes whose content hash is shared with
+// another file in that scope, ordered by hash so each group is contiguous,
+// oldest copy first.
+func (d *DB) ListDuplicateFiles(folder string, minSize int64) ([]FileRecord, error) {
+	clause, args := folderFilter(folder)
+	query := `
+		SELECT path, name, is_folder, size, mime_type, hash,
+			   modified_at, created_at, last_scanned_at, text_preview, preview_sqlar, preview_status
+		FROM files
+		WHERE is_folder = 0 AND COALESCE(size, 0) >= ?` + clause + `
+		  AND hash IN (
+			SELECT hash FROM files
+			WHERE is_folder = 0 AND hash IS NOT NULL AND hash != ''` + clause + `
+			GROUP BY hash HAVING COUNT(*) > 1
+		  )
+		ORDER BY hash, created_at, path
+	`
+	queryArgs := append([]any{minSize}, args...)
+	queryArgs = append(queryArgs, args...)
+
+	rows, err := d.conn.Query(query, queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []FileRecord
+	for rows.Next() {
+		var f FileRecord
+		var isFolder int
+		var size sql.NullInt64
+		var hash, mimeType, textPreview, previewSqlar, previewStatus sql.NullString
+		var lastScannedAt sql.NullInt64
+
+		if err := rows.Scan(
+			&f.Path, &f.Name, &isFolder, &size, &mimeType,
+			&hash, &f.ModifiedAt, &f.CreatedAt, &lastScannedAt,
+			&textPreview, &previewSqlar, &previewStatus,
+		); err != nil {
+			return nil, err
+		}
+
+		f.IsFolder = isFolder == 1
+		f.Size = IntPtr(size)
+		f.Hash = StringPtr(hash)
+		f.MimeType = StringPtr(mimeType)
+		f.TextPreview = StringPtr(textPreview)
+		f.PreviewSqlar = StringPtr(previewSqlar)
+		f.PreviewStatus = StringPtr(previewStatus)
+		f.LastScannedAt = lastScannedAt.Int64
+
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// ListImagePhashes returns the perceptual hashes of the images under
+// folder ("" = the whole library) that have one.
+func (d *DB) ListImagePhashes(folder string) ([]FilePhash, error) {
+	clause, args := folderFilter(folder)
+	rows, err := d.conn.Query(`
+		SELECT path, COALESCE(size, 0), phash FROM files
+		WHERE is_folder = 0 AND phash IS NOT NULL`+clause+`
+		ORDER BY created_at, path
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []FilePhash
+	for rows.Next() {
+		var h FilePhash
+		var phash int64
+		if err := rows.Scan(&h.Path, &h.Size, &phash); err != nil {
+			return nil, err
+		}
+		h.Phash = uint64(phash)
+		hashes = append(hashes, h)
+	}
+	return hashes, rows.Err()
+}
+
+// GetImagesMissingPhash returns images that have a thumbnail but no
+// perceptual hash (indexed before phash existed). Images whose hash
+// already failed carry a preview_error and are left out.
+func (d *DB) GetImagesMissingPhash(limit int) ([]FileWithMime, error) {
+	rows, err := d.conn.Query(`
+		SELECT path, mime_type FROM files
+		WHERE is_folder = 0 AND mime_type LIKE 'image/%'
+		  AND preview_status = 'ready' AND phash IS NULL
+		  AND preview_error IS NULL
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []FileWithMime
+	for rows.Next() {
+		var f FileWithMime
+		if err := rows.Scan(&f.Path, &f.MimeType); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
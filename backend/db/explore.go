@@ -277,6 +277,35 @@ func (d *DB) ListExplorePostsAfter(cursor string, limit int) (*ExplorePostListRe
 	}, nil
 }
 
+// GetExplorePostsByIDs retrieves multiple posts (without comments) in a
+// single query, keyed by post ID. Unknown IDs are simply absent.
+func (d *DB) GetExplorePostsByIDs(ids []string) (map[string]*ExplorePost, error) {
+	result := make(map[string]*ExplorePost, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := d.conn.Query(fmt.Sprintf(`SELECT %s FROM explore_posts WHERE id IN (%s)`,
+		explorePostColumns, placeholders), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts, err := collectExplorePosts(rows)
+	if err != nil {
+		return nil, err
+	}
+	for i := range posts {
+		result[posts[i].ID] = &posts[i]
+	}
+	return result, nil
+}
+
 // collectExplorePosts scans all rows into a slice of ExplorePost.
 func collectExplorePosts(rows *sql.Rows) ([]ExplorePost, error) {
 	var posts []ExplorePost
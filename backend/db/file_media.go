@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// FileMedia is the media metadata of one file (the file_media table). All
+// fields but Path and ExtractedAt are optional: nil means the file did not
+// carry that piece of information.
+type FileMedia struct {
+	Path        string   `json:"-"`
+	TakenAt     *int64   `json:"takenAt,omitempty"`      // epoch ms
+	TakenLocal  *string  `json:"takenAtLocal,omitempty"` // "YYYY-MM-DD HH:MM:SS", wall clock where shot
+	CameraMake  *string  `json:"cameraMake,omitempty"`
+	CameraModel *string  `json:"cameraModel,omitempty"`
+	LensModel   *string  `json:"lensModel,omitempty"`
+	Latitude    *float64 `json:"latitude,omitempty"`
+	Longitude   *float64 `json:"longitude,omitempty"`
+	Altitude    *float64 `json:"altitude,omitempty"`
+	Width       *int     `json:"width,omitempty"`
+	Height      *int     `json:"height,omitempty"`
+	Orientation *int     `json:"orientation,omitempty"` // EXIF orientation, 1-8
+	DurationMs  *int64   `json:"durationMs,omitempty"`
+	Title       *string  `json:"title,omitempty"`
+	Artist      *string  `json:"artist,omitempty"`
+	Album       *string  `json:"album,omitempty"`
+	ExtractedAt int64    `json:"extractedAt"`
+}
+
+const fileMediaColumns = `path, taken_at, taken_local, camera_make, camera_model, lens_model,
+	latitude, longitude, altitude, width, height, orientation, duration_ms,
+	title, artist, album, extracted_at`
+
+func scanFileMedia(row interface{ Scan(...any) error }) (*FileMedia, error) {
+	var m FileMedia
+	err := row.Scan(&m.Path, &m.TakenAt, &m.TakenLocal, &m.CameraMake, &m.CameraModel, &m.LensModel,
+		&m.Latitude, &m.Longitude, &m.Altitude, &m.Width, &m.Height, &m.Orientation, &m.DurationMs,
+		&m.Title, &m.Artist, &m.Album, &m.ExtractedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// UpsertFileMedia stores the media metadata of m.Path, replacing any
+// previous row. ExtractedAt defaults to now.
+func (d *DB) UpsertFileMedia(ctx context.Context, m *FileMedia) error {
+	if m.ExtractedAt == 0 {
+		m.ExtractedAt = NowMs()
+	}
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO file_media (`+fileMediaColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.Path, m.TakenAt, m.TakenLocal, m.CameraMake, m.CameraModel, m.LensModel,
+			m.Latitude, m.Longitude, m.Altitude, m.Width, m.Height, m.Orientation, m.DurationMs,
+			m.Title, m.Artist, m.Album, m.ExtractedAt)
+		if err != nil {
+			return fmt.Errorf("upsert file_media: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetFileMedia returns the media metadata of a file, or nil if it has none.
+func (d *DB) GetFileMedia(path string) (*FileMedia, error) {
+	m, err := scanFileMedia(d.conn.QueryRow(`SELECT `+fileMediaColumns+` FROM file_media WHERE path = ?`, path))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GetFileMediaByPaths returns the media metadata of the given files, keyed
+// by path. Files without a row are absent from the map.
+func (d *DB) GetFileMediaByPaths(paths []string) (map[string]*FileMedia, error) {
+	result := make(map[string]*FileMedia, len(paths))
+	if len(paths) == 0 {
+		return result, nil
+	}
+
+	placeholders := make([]string, len(paths))
+	args := make([]any, len(paths))
+	for i, p := range paths {
+		placeholders[i] = "?"
+		args[i] = p
+	}
+
+	rows, err := d.conn.Query(`SELECT `+fileMediaColumns+` FROM file_media WHERE path IN (`+strings.Join(placeholders, ",")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanFileMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[m.Path] = m
+	}
+	return result, rows.Err()
+}
+
+// DeleteFileMedia removes a file's media row. No-op if missing.
+func (d *DB) DeleteFileMedia(ctx context.Context, path string) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM file_media WHERE path = ?`, path)
+		return err
+	})
+}
+
+// ListFilesWithoutMedia returns every file that has no file_media row yet,
+// with its MIME type. The media worker decides which ones it can read.
+func (d *DB) ListFilesWithoutMedia() ([]FileWithMime, error) {
+	rows, err := d.conn.Query(`
+		SELECT f.path, COALESCE(f.mime_type, '') FROM files f
+		WHERE f.is_folder = 0
+		  AND NOT EXISTS (SELECT 1 FROM file_media m WHERE m.path = f.path)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []FileWithMime
+	for rows.Next() {
+		var f FileWithMime
+		if err := rows.Scan(&f.Path, &f.MimeType); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// MediaFilter restricts a search to files whose media metadata matches.
+// Zero-valued fields don't filter.
+type MediaFilter struct {
+	// TakenFrom and TakenTo are date prefixes ("2024", "2024-05",
+	// "2024-05-01") bounding the wall-clock capture date, both inclusive.
+	TakenFrom string
+	TakenTo   string
+	Near      *GeoFilter
+}
+
+// GeoFilter matches files taken within RadiusKm of a point. Distances use
+// an equirectangular approximation, accurate to well under 1% at the
+// radii a "near" search uses; a circle crossing the antimeridian is
+// clipped at ±180°.
+type GeoFilter struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64
+}
+
+// kmPerDegree is the length of one degree of latitude.
+const kmPerDegree = 111.32
+
+// where returns the WHERE clauses (over a table or alias named file_media)
+// and their arguments.
+func (f *MediaFilter) where() ([]string, []any) {
+	var parts []string
+	var args []any
+	if f.TakenFrom != "" {
+		parts = append(parts, "file_media.taken_local >= ?")
+		args = append(args, f.TakenFrom)
+	}
+	if f.TakenTo != "" {
+		// '~' sorts after every character of "YYYY-MM-DD HH:MM:SS", so
+		// this keeps everything that starts with TakenTo.
+		parts = append(parts, "file_media.taken_local < ?")
+		args = append(args, f.TakenTo+"~")
+	}
+	if g := f.Near; g != nil {
+		latDelta := g.RadiusKm / kmPerDegree
+		cosLat := math.Max(math.Cos(g.Latitude*math.Pi/180), 0.01)
+		lonDelta := latDelta / cosLat
+		// Bounding box first (uses the location index), then the
+		// squared distance in degrees of latitude.
+		parts = append(parts,
+			"file_media.latitude BETWEEN ? AND ?",
+			"file_media.longitude BETWEEN ? AND ?",
+			"(file_media.latitude - ?) * (file_media.latitude - ?) + "+
+				"(file_media.longitude - ?) * (file_media.longitude - ?) * ? <= ?")
+		args = append(args,
+			g.Latitude-latDelta, g.Latitude+latDelta,
+			g.Longitude-lonDelta, g.Longitude+lonDelta,
+			g.Latitude, g.Latitude, g.Longitude, g.Longitude, cosLat*cosLat, latDelta*latDelta)
+	}
+	return parts, args
+}
+
+// SearchMedia lists the files matching opts.Media (and the type and path
+// filters), most recently taken first. It serves searches that consist
+// only of media filters; the hits carry no snippet or score.
+func (d *DB) SearchMedia(opts FTSSearchOptions) ([]FTSHit, int, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	offset := max(opts.Offset, 0)
+
+	whereParts := []string{"files.is_folder = 0"}
+	var args []any
+	if opts.PathFilter != "" {
+		prefix := strings.TrimSuffix(opts.PathFilter, "/") + "/"
+		whereParts = append(whereParts, "file_media.path LIKE ? ESCAPE '\\'")
+		args = append(args, escapeLikePrefix(prefix)+"%")
+	}
+	if opts.TypeFilter != "" {
+		whereParts = append(whereParts, "files.mime_type LIKE ? ESCAPE '\\'")
+		args = append(args, escapeLikePrefix(opts.TypeFilter)+"%")
+	}
+	if opts.Media != nil {
+		mediaParts, mediaArgs := opts.Media.where()
+		whereParts = append(whereParts, mediaParts...)
+		args = append(args, mediaArgs...)
+	}
+	fromSQL := `
+		FROM file_media
+		JOIN files ON files.path = file_media.path
+		WHERE ` + strings.Join(whereParts, " AND ")
+
+	var total int
+	if err := d.conn.QueryRow(`SELECT COUNT(*) `+fromSQL, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count media hits: %w", err)
+	}
+
+	rows, err := d.conn.Query(`SELECT file_media.path `+fromSQL+`
+		ORDER BY file_media.taken_at IS NULL, file_media.taken_at DESC, file_media.path
+		LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query media: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []FTSHit
+	for rows.Next() {
+		var h FTSHit
+		if err := rows.Scan(&h.FilePath); err != nil {
+			return nil, 0, fmt.Errorf("scan media row: %w", err)
+		}
+		h.FilePathHL = h.FilePath
+		hits = append(hits, h)
+	}
+	return hits, total, rows.Err()
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// File share modes.
+const (
+	FileShareModeRead    = "read"    // browse + download
+	FileShareModeDropbox = "dropbox" // upload only; contents are never listed
+)
+
+// FileShareRecord represents a public share link for a library path.
+type FileShareRecord struct {
+	Token        string `json:"token"`
+	Path         string `json:"path"`
+	IsFolder     bool   `json:"isFolder"`
+	Mode         string `json:"mode"`
+	PasswordHash string `json:"-"` // never serialize
+	HasPassword  bool   `json:"hasPassword"`
+	ExpiresAt    *int64 `json:"expiresAt,omitempty"`
+	UserID       string `json:"userId,omitempty"`
+	AccessCount  int64  `json:"accessCount"`
+	LastAccessAt *int64 `json:"lastAccessAt,omitempty"`
+	CreatedAt    int64  `json:"createdAt"`
+}
+
+// IsExpired reports whether the link has passed its expiry at nowMs.
+func (r *FileShareRecord) IsExpired(nowMs int64) bool {
+	return r.ExpiresAt != nil && *r.ExpiresAt <= nowMs
+}
+
+const fileShareColumns = `token, path, is_folder, mode, password_hash, expires_at, user_id, access_count, last_access_at, created_at`
+
+func scanFileShare(row interface{ Scan(...any) error }) (*FileShareRecord, error) {
+	var r FileShareRecord
+	var isFolder int
+	var expiresAt, lastAccessAt sql.NullInt64
+	if err := row.Scan(&r.Token, &r.Path, &isFolder, &r.Mode, &r.PasswordHash, &expiresAt, &r.UserID, &r.AccessCount, &lastAccessAt, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	r.IsFolder = isFolder == 1
+	r.HasPassword = r.PasswordHash != ""
+	r.ExpiresAt = IntPtr(expiresAt)
+	r.LastAccessAt = IntPtr(lastAccessAt)
+	return &r, nil
+}
+
+// CreateFileShare inserts a new share link. The caller mints the token.
+func (d *DB) CreateFileShare(ctx context.Context, r *FileShareRecord) error {
+	if r.Mode != FileShareModeRead && r.Mode != FileShareModeDropbox {
+		return fmt.Errorf("invalid share mode %q", r.Mode)
+	}
+	r.CreatedAt = NowMs()
+	r.HasPassword = r.PasswordHash != ""
+	isFolder := 0
+	if r.IsFolder {
+		isFolder = 1
+	}
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`INSERT INTO file_shares (token, path, is_folder, mode, password_hash, expires_at, user_id, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.Token, r.Path, isFolder, r.Mode, r.PasswordHash, r.ExpiresAt, r.UserID, r.CreatedAt,
+		)
+		return err
+	})
+}
+
+// GetFileShare fetches a share link by token. Returns nil if not found.
+// Expiry is not checked here; see FileShareRecord.IsExpired.
+func (d *DB) GetFileShare(token string) (*FileShareRecord, error) {
+	r, err := scanFileShare(d.conn.QueryRow(`SELECT `+fileShareColumns+` FROM file_shares WHERE token = ?`, token))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// ListFileShares returns share links, newest first. userID, when non-nil,
+// restricts the list to links created by that account.
+func (d *DB) ListFileShares(userID *string) ([]FileShareRecord, error) {
+	query := `SELECT ` + fileShareColumns + ` FROM file_shares`
+	var args []any
+	if userID != nil {
+		query += ` WHERE user_id = ?`
+		args = append(args, *userID)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []FileShareRecord
+	for rows.Next() {
+		r, err := scanFileShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// DeleteFileShare revokes a share link.
+func (d *DB) DeleteFileShare(ctx context.Context, token string) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM file_shares WHERE token = ?`, token)
+		return err
+	})
+}
+
+// RecordFileShareAccess bumps the access counter and last-access time.
+func (d *DB) RecordFileShareAccess(ctx context.Context, token string) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`UPDATE file_shares SET access_count = access_count + 1, last_access_at = ? WHERE token = ?`,
+			NowMs(), token,
+		)
+		return err
+	})
+}
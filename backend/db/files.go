@@ -45,6 +45,20 @@ func (d *DB) GetPreviewSqlarMap(dirPath string) (map[string]string, error) {
 	return result, rows.Err()
 }
 
+// HasPreviewSqlarUnder reports whether sqlarName is the preview of a file
+// under the USER_DATA_DIR-relative folder root.
+func (d *DB) HasPreviewSqlarUnder(root, sqlarName string) (bool, error) {
+	// path range [root/, root0) is every path below root ('0' follows '/')
+	// and stays on the path index.
+	root = strings.Trim(root, "/")
+	var n int
+	err := d.conn.QueryRow(`
+		SELECT COUNT(*) FROM files
+		WHERE path >= ? AND path < ? AND preview_sqlar = ?
+	`, root+"/", root+"0", sqlarName).Scan(&n)
+	return n > 0, err
+}
+
 // GetCreatedAtMap returns a map of name -> created_at (epoch ms) for direct
 // children of dirPath. Includes both files and folders. Used by the library
 // tree handler to surface "first seen" time as a sortable createdAt field.
@@ -774,9 +788,9 @@ func (d *DB) GetFileStats() (map[string]interface{}, error) {
 }
 
 // RenameFilePath updates a single file's path and name, including all related
-// tables. Updates: files, files_fts (index DB) plus app.pins (app DB,
-// ATTACHed read-write on the writer connection). All happen in one atomic
-// transaction so a crash mid-rename can never leave an orphan pin.
+// tables. Updates: files, files_fts, file_media (index DB) plus app.pins
+// (app DB, ATTACHed read-write on the writer connection). All happen in one
+// atomic transaction so a crash mid-rename can never leave an orphan pin.
 func (d *DB) RenameFilePath(ctx context.Context, oldPath, newPath, newName string) error {
 	return d.Write(ctx, func(tx *sql.Tx) error {
 		// Update files
@@ -788,6 +802,9 @@ func (d *DB) RenameFilePath(ctx context.Context, oldPath, newPath, newName strin
 		if _, err := tx.Exec(`UPDATE files_fts SET file_path = ? WHERE file_path = ?`, newPath, oldPath); err != nil {
 			return fmt.Errorf("failed to update files_fts: %w", err)
 		}
+		if _, err := tx.Exec(`UPDATE file_media SET path = ? WHERE path = ?`, newPath, oldPath); err != nil {
+			return fmt.Errorf("failed to update file_media: %w", err)
+		}
 
 		// Update pins in the app DB (ATTACHed rw as 'app' on the index writer
 		// connection). Same transaction → fully atomic with the index changes.
@@ -800,8 +817,9 @@ func (d *DB) RenameFilePath(ctx context.Context, oldPath, newPath, newName strin
 }
 
 // RenameFilePaths updates all paths that start with oldPath prefix (for folder
-// renames). Updates: files, files_fts (index DB) plus app.pins (app
-// DB, ATTACHed rw on the writer connection). All in one atomic transaction.
+// renames). Updates: files, files_fts, file_media (index DB) plus app.pins
+// (app DB, ATTACHed rw on the writer connection). All in one atomic
+// transaction.
 func (d *DB) RenameFilePaths(ctx context.Context, oldPath, newPath string) error {
 	return d.Write(ctx, func(tx *sql.Tx) error {
 		// substr offset must be SQL length(oldPath)+1: SQLite substr counts
@@ -827,6 +845,13 @@ func (d *DB) RenameFilePaths(ctx context.Context, oldPath, newPath string) error
 		`, newPath, oldPath, oldPath, oldPath); err != nil {
 			return fmt.Errorf("failed to update files_fts: %w", err)
 		}
+		if _, err := tx.Exec(`
+			UPDATE file_media
+			SET path = ? || substr(path, length(?) + 1)
+			WHERE path = ? OR path LIKE ? || '/%'
+		`, newPath, oldPath, oldPath, oldPath); err != nil {
+			return fmt.Errorf("failed to update file_media: %w", err)
+		}
 
 		// Update pins in the app DB. Same prefix-rewrite as the other tables
 		// so pins under a renamed folder follow it.
@@ -852,6 +877,8 @@ func (d *DB) UpdateFileField(ctx context.Context, path string, field string, val
 		"hash":           true,
 		"size":           true,
 		"modified_at":    true,
+		"phash":          true,
+		"preview_error":  true,
 	}
 
 	if !allowedFields[field] {
@@ -868,7 +895,7 @@ func (d *DB) UpdateFileField(ctx context.Context, path string, field string, val
 // MoveFileAtomic atomically moves a file record from oldPath to newPath.
 // This is used when detecting external file moves via fsnotify.
 // It updates the file record and ALL related tables in a single transaction:
-// files, files_fts (index DB) plus app.pins (app DB, ATTACHed rw).
+// files, files_fts, file_media (index DB) plus app.pins (app DB, ATTACHed rw).
 func (d *DB) MoveFileAtomic(ctx context.Context, oldPath, newPath string, newRecord *FileRecord) error {
 	return d.Write(ctx, func(tx *sql.Tx) error {
 		// 1. Insert/update new path with smart COALESCE handling
@@ -903,10 +930,13 @@ func (d *DB) MoveFileAtomic(ctx context.Context, oldPath, newPath string, newRec
 			}
 		}
 
-		// 3. Update related index-DB tables: files_fts
+		// 3. Update related index-DB tables: files_fts, file_media
 		if _, err := tx.Exec(`UPDATE files_fts SET file_path = ? WHERE file_path = ?`, newPath, oldPath); err != nil {
 			return fmt.Errorf("failed to update files_fts: %w", err)
 		}
+		if _, err := tx.Exec(`UPDATE file_media SET path = ? WHERE path = ?`, newPath, oldPath); err != nil {
+			return fmt.Errorf("failed to update file_media: %w", err)
+		}
 
 		// 5. Update pins in the app DB (ATTACHed rw as 'app' on the writer
 		// connection). Atomic with the index changes above.
@@ -949,6 +979,18 @@ func (d *DB) GetFilesMissingPreviews(limit int) ([]FileWithMime, error) {
 	return files, rows.Err()
 }
 
+// GetPreviewError returns why a file's last preview attempt produced
+// nothing; "" when it has a preview, none was attempted, or the file is
+// not indexed.
+func (d *DB) GetPreviewError(path string) (string, error) {
+	var reason sql.NullString
+	err := d.conn.QueryRow(`SELECT preview_error FROM files WHERE path = ?`, path).Scan(&reason)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return reason.String, err
+}
+
 // ListAllFilePaths returns all file paths in the database (for reconciliation).
 // The caller is responsible for closing the returned rows.
 func (d *DB) ListAllFilePaths() ([]string, error) {
@@ -971,7 +1013,7 @@ func (d *DB) ListAllFilePaths() ([]string, error) {
 }
 
 // DeleteFileWithCascade removes a file record and all related records in a
-// single atomic transaction. Cleans up: files, files_fts (index DB)
+// single atomic transaction. Cleans up: files, files_fts, file_media (index DB)
 // plus app.pins (app DB, ATTACHed rw on the writer connection).
 //
 // Used during reconciliation (orphan cleanup when a file disappears from disk)
@@ -984,6 +1026,9 @@ func (d *DB) DeleteFileWithCascade(ctx context.Context, path string) error {
 		if _, err := tx.Exec("DELETE FROM files_fts WHERE file_path = ?", path); err != nil {
 			return fmt.Errorf("failed to delete files_fts: %w", err)
 		}
+		if _, err := tx.Exec("DELETE FROM file_media WHERE path = ?", path); err != nil {
+			return fmt.Errorf("failed to delete file_media: %w", err)
+		}
 
 		// Delete file record
 		if _, err := tx.Exec("DELETE FROM files WHERE path = ?", path); err != nil {
@@ -1000,9 +1045,9 @@ func (d *DB) DeleteFileWithCascade(ctx context.Context, path string) error {
 }
 
 // BatchDeleteFilesWithCascade removes multiple file records and all related
-// rows (files_fts in the index DB; pins in the app DB) in one atomic
-// transaction. Used by reconciliation to avoid one-transaction-per-orphan
-// when there are thousands of records to remove.
+// rows (files_fts and file_media in the index DB; pins in the app DB) in one
+// atomic transaction. Used by reconciliation to avoid one-transaction-per-
+// orphan when there are thousands of records to remove.
 //
 // Caller is responsible for chunking to stay under SQLite's parameter limit
 // (SQLITE_MAX_VARIABLE_NUMBER, typically 999 on older builds, 32766 on newer).
@@ -1022,6 +1067,9 @@ func (d *DB) BatchDeleteFilesWithCascade(ctx context.Context, paths []string) er
 		if _, err := tx.Exec("DELETE FROM files_fts WHERE file_path IN ("+placeholders+")", args...); err != nil {
 			return fmt.Errorf("failed to delete files_fts: %w", err)
 		}
+		if _, err := tx.Exec("DELETE FROM file_media WHERE path IN ("+placeholders+")", args...); err != nil {
+			return fmt.Errorf("failed to delete file_media: %w", err)
+		}
 		if _, err := tx.Exec("DELETE FROM files WHERE path IN ("+placeholders+")", args...); err != nil {
 			return fmt.Errorf("failed to delete files: %w", err)
 		}
@@ -1034,14 +1082,17 @@ func (d *DB) BatchDeleteFilesWithCascade(ctx context.Context, paths []string) er
 }
 
 // DeleteFilesWithCascadePrefix removes a folder and all records under it in
-// a single atomic transaction. Cleans up: files, files_fts (index DB) plus
-// app.pins (app DB, ATTACHed rw on the writer connection).
+// a single atomic transaction. Cleans up: files, files_fts, file_media
+// (index DB) plus app.pins (app DB, ATTACHed rw on the writer connection).
 func (d *DB) DeleteFilesWithCascadePrefix(ctx context.Context, pathPrefix string) error {
 	return d.Write(ctx, func(tx *sql.Tx) error {
 		// Delete search index documents
 		if _, err := tx.Exec("DELETE FROM files_fts WHERE file_path = ? OR file_path LIKE ? || '/%'", pathPrefix, pathPrefix); err != nil {
 			return fmt.Errorf("failed to delete files_fts: %w", err)
 		}
+		if _, err := tx.Exec("DELETE FROM file_media WHERE path = ? OR path LIKE ? || '/%'", pathPrefix, pathPrefix); err != nil {
+			return fmt.Errorf("failed to delete file_media: %w", err)
+		}
 
 		// Delete file records
 		if _, err := tx.Exec("DELETE FROM files WHERE path = ? OR path LIKE ? || '/%'", pathPrefix, pathPrefix); err != nil {
@@ -1056,3 +1107,23 @@ func (d *DB) DeleteFilesWithCascadePrefix(ctx context.Context, pathPrefix string
 		return nil
 	})
 }
+
+// SumFileSizes returns the total size of the files under folder (a
+// data-root-relative path; "" = the whole library).
+func (d *DB) SumFileSizes(folder string) (int64, error) {
+	clause, args := folderFilter(folder)
+	var total int64
+	err := d.conn.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM files WHERE is_folder = 0`+clause, args...).Scan(&total)
+	return total, err
+}
+
+// folderFilter returns a WHERE fragment (starting with " AND") matching
+// paths under folder, or nothing for "" (the whole library).
+func folderFilter(folder string) (string, []any) {
+	folder = strings.Trim(folder, "/")
+	if folder == "" {
+		return "", nil
+	}
+	// "folder/" <= path < "folder0" ('0' sorts right after '/').
+	return ` AND path >= ? AND path < ?`, []any{folder + "/", folder + "0"}
+}
@@ -30,6 +30,7 @@ type FTSSearchOptions struct {
 	Offset     int
 	TypeFilter string // matched against files.mime_type via STARTS WITH
 	PathFilter string // matched against files.file_path via STARTS WITH
+	Media      *MediaFilter
 }
 
 // IndexFile upserts a row into files_fts. Use INSERT OR REPLACE on the
@@ -137,6 +138,14 @@ func (d *DB) SearchFTS(query string, opts FTSSearchOptions) ([]FTSHit, int, erro
 		args = append(args, escapeLikePrefix(opts.TypeFilter)+"%")
 	}
 
+	joinSQL := ""
+	if opts.Media != nil {
+		joinSQL = "JOIN file_media ON file_media.path = files_fts.file_path"
+		mediaParts, mediaArgs := opts.Media.where()
+		whereParts = append(whereParts, mediaParts...)
+		args = append(args, mediaArgs...)
+	}
+
 	whereSQL := strings.Join(whereParts, " AND ")
 
 	// Count total hits (for pagination). simple_query() / MATCH already
@@ -145,6 +154,7 @@ func (d *DB) SearchFTS(query string, opts FTSSearchOptions) ([]FTSHit, int, erro
 		SELECT COUNT(*)
 		FROM files_fts
 		LEFT JOIN files ON files.path = files_fts.file_path
+		` + joinSQL + `
 		WHERE ` + whereSQL
 
 	var total int
@@ -164,6 +174,7 @@ func (d *DB) SearchFTS(query string, opts FTSSearchOptions) ([]FTSHit, int, erro
 			bm25(files_fts) AS score
 		FROM files_fts
 		LEFT JOIN files ON files.path = files_fts.file_path
+		` + joinSQL + `
 		WHERE ` + whereSQL + `
 		ORDER BY score
 		LIMIT ? OFFSET ?`
@@ -11,9 +11,10 @@ import (
 // newRenameTestDB builds a minimal *DB for exercising RenameFilePaths without
 // the FTS5 'simple' extension or the production cross-DB wiring.
 //
-// RenameFilePaths only issues three UPDATEs touching files.path/name,
-// files_fts.file_path and app.pins.file_path, so plain stand-in tables (and an
-// ATTACHed in-memory 'app' schema) reproduce the real statements faithfully.
+// RenameFilePaths only issues UPDATEs touching files.path/name,
+// files_fts.file_path, file_media.path and app.pins.file_path, so plain
+// stand-in tables (and an ATTACHed in-memory 'app' schema) reproduce the real
+// statements faithfully.
 // A single pooled connection keeps the ATTACH alive and lets the writer
 // goroutine see the same in-memory database the test inserts into.
 func newRenameTestDB(t *testing.T) *DB {
@@ -31,6 +32,7 @@ func newRenameTestDB(t *testing.T) *DB {
 		`ATTACH DATABASE ':memory:' AS app`,
 		`CREATE TABLE files (path TEXT PRIMARY KEY, name TEXT NOT NULL)`,
 		`CREATE TABLE files_fts (file_path TEXT, content TEXT)`,
+		`CREATE TABLE file_media (path TEXT PRIMARY KEY)`,
 		`CREATE TABLE app.pins (file_path TEXT PRIMARY KEY)`,
 	}
 	for _, s := range stmts {
@@ -105,6 +107,9 @@ func TestRenameFilePaths_CJKFolder(t *testing.T) {
 	mustExec(t, conn, `INSERT INTO files_fts (file_path, content) VALUES (?, ?)`, "照片/a.jpg", "x")
 	mustExec(t, conn, `INSERT INTO files_fts (file_path, content) VALUES (?, ?)`, "照片备份/c.jpg", "x")
 
+	mustExec(t, conn, `INSERT INTO file_media (path) VALUES (?)`, "照片/子目录/b.png")
+	mustExec(t, conn, `INSERT INTO file_media (path) VALUES (?)`, "照片备份/c.jpg")
+
 	mustExec(t, conn, `INSERT INTO app.pins (file_path) VALUES (?)`, "照片/a.jpg")
 	mustExec(t, conn, `INSERT INTO app.pins (file_path) VALUES (?)`, "照片备份/c.jpg")
 
@@ -122,6 +127,9 @@ func TestRenameFilePaths_CJKFolder(t *testing.T) {
 	assertEqualSlice(t, "files_fts.file_path", queryColumn(t, conn, `SELECT file_path FROM files_fts ORDER BY file_path`),
 		[]string{"我的照片/a.jpg", "照片备份/c.jpg"})
 
+	assertEqualSlice(t, "file_media.path", queryColumn(t, conn, `SELECT path FROM file_media ORDER BY path`),
+		[]string{"我的照片/子目录/b.png", "照片备份/c.jpg"})
+
 	assertEqualSlice(t, "app.pins.file_path", queryColumn(t, conn, `SELECT file_path FROM app.pins ORDER BY file_path`),
 		[]string{"我的照片/a.jpg", "照片备份/c.jpg"})
 }
@@ -0,0 +1,296 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Job statuses (jobs.status).
+const (
+	JobStatusPending = "pending"
+	JobStatusRunning = "running"
+	JobStatusFailed  = "failed"
+)
+
+// Job is one row of the background job queue.
+type Job struct {
+	ID        int64   `json:"id"`
+	Kind      string  `json:"kind"`
+	Key       string  `json:"key"`
+	Priority  int     `json:"priority"`
+	Status    string  `json:"status"`
+	Attempts  int     `json:"attempts"`
+	LastError *string `json:"lastError,omitempty"`
+	RunAfter  int64   `json:"runAfter"`
+	CreatedAt int64   `json:"createdAt"`
+	UpdatedAt int64   `json:"updatedAt"`
+}
+
+// JobCounts summarizes the queue for one kind.
+type JobCounts struct {
+	Kind    string `json:"kind"`
+	Pending int    `json:"pending"`
+	Running int    `json:"running"`
+	Failed  int    `json:"failed"`
+	// Retrying counts the pending jobs that failed before and wait out
+	// their backoff.
+	Retrying int `json:"retrying"`
+	// OldestPendingAt is when the longest-waiting pending job was queued
+	// (ms), 0 when none is.
+	OldestPendingAt int64 `json:"oldestPendingAt"`
+}
+
+const jobColumns = `id, kind, key, priority, status, attempts, last_error, run_after, created_at, updated_at`
+
+func scanJob(row interface{ Scan(...any) error }) (*Job, error) {
+	var j Job
+	var lastError sql.NullString
+	if err := row.Scan(&j.ID, &j.Kind, &j.Key, &j.Priority, &j.Status, &j.Attempts,
+		&lastError, &j.RunAfter, &j.CreatedAt, &j.UpdatedAt); err != nil {
+		return nil, err
+	}
+	j.LastError = StringPtr(lastError)
+	return &j, nil
+}
+
+// EnqueueJobs queues keys of one kind at priority. Keys already queued
+// keep their place but take the higher priority; a failed job starts
+// over; a running one is marked to run again when it finishes, so the
+// work it does reflects the latest change.
+func (d *DB) EnqueueJobs(ctx context.Context, kind string, keys []string, priority int) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	now := NowMs()
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(`
+			INSERT INTO jobs (kind, key, priority, status, attempts, run_after, created_at, updated_at)
+			VALUES (?, ?, ?, 'pending', 0, ?, ?, ?)
+			ON CONFLICT(kind, key) DO UPDATE SET
+				priority = max(jobs.priority, excluded.priority),
+				rerun = CASE WHEN jobs.status = 'running' THEN 1 ELSE jobs.rerun END,
+				attempts = CASE WHEN jobs.status = 'failed' THEN 0 ELSE jobs.attempts END,
+				run_after = CASE WHEN jobs.status = 'running' THEN jobs.run_after ELSE excluded.run_after END,
+				status = CASE WHEN jobs.status = 'running' THEN 'running' ELSE 'pending' END,
+				updated_at = excluded.updated_at
+		`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, key := range keys {
+			if _, err := stmt.Exec(kind, key, priority, now, now, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ClaimJob marks the next runnable job of kind as running and returns it:
+// highest priority first, then the one queued longest. nil when nothing
+// is due.
+func (d *DB) ClaimJob(ctx context.Context, kind string) (*Job, error) {
+	var job *Job
+	err := d.Write(ctx, func(tx *sql.Tx) error {
+		now := NowMs()
+		j, err := scanJob(tx.QueryRow(`
+			SELECT `+jobColumns+` FROM jobs
+			WHERE kind = ? AND status = 'pending' AND run_after <= ?
+			ORDER BY priority DESC, created_at, id
+			LIMIT 1
+		`, kind, now))
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			UPDATE jobs SET status = 'running', attempts = attempts + 1, updated_at = ? WHERE id = ?
+		`, now, j.ID); err != nil {
+			return err
+		}
+		j.Status = JobStatusRunning
+		j.Attempts++
+		j.UpdatedAt = now
+		job = j
+		return nil
+	})
+	return job, err
+}
+
+// CompleteJob removes a finished job, or queues it again if it was
+// re-enqueued while running.
+func (d *DB) CompleteJob(ctx context.Context, id int64) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM jobs WHERE id = ? AND rerun = 0`, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			UPDATE jobs SET status = 'pending', rerun = 0, attempts = 0, last_error = NULL, run_after = 0, updated_at = ?
+			WHERE id = ?
+		`, NowMs(), id)
+		return err
+	})
+}
+
+// RetryJob records a failed run and puts the job back in the queue to run
+// no earlier than runAfter (ms). A job re-enqueued while running runs
+// again right away.
+func (d *DB) RetryJob(ctx context.Context, id int64, errMsg string, runAfter int64) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			UPDATE jobs SET status = 'pending', last_error = ?, updated_at = ?,
+				run_after = CASE WHEN rerun = 1 THEN 0 ELSE ? END,
+				attempts = CASE WHEN rerun = 1 THEN 0 ELSE attempts END,
+				rerun = 0
+			WHERE id = ?
+		`, errMsg, NowMs(), runAfter, id)
+		return err
+	})
+}
+
+// ReleaseJob puts a job interrupted by shutdown back in the queue and gives
+// back the attempt it used, so the interruption doesn't count against it.
+func (d *DB) ReleaseJob(ctx context.Context, id int64) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			UPDATE jobs SET status = 'pending', run_after = 0, updated_at = ?,
+				attempts = CASE WHEN rerun = 1 THEN 0 ELSE MAX(attempts - 1, 0) END,
+				rerun = 0
+			WHERE id = ?
+		`, NowMs(), id)
+		return err
+	})
+}
+
+// FailJob gives up on a job. It stays in the table as failed until it is
+// retried or queued again.
+func (d *DB) FailJob(ctx context.Context, id int64, errMsg string) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			UPDATE jobs SET last_error = ?, updated_at = ?,
+				status = CASE WHEN rerun = 1 THEN 'pending' ELSE 'failed' END,
+				attempts = CASE WHEN rerun = 1 THEN 0 ELSE attempts END,
+				run_after = 0,
+				rerun = 0
+			WHERE id = ?
+		`, errMsg, NowMs(), id)
+		return err
+	})
+}
+
+// ResetRunningJobs returns jobs left running by a previous process to the
+// queue, giving back the attempt the interrupted run used. Called once on
+// startup, before any worker claims work.
+func (d *DB) ResetRunningJobs(ctx context.Context) (int, error) {
+	return d.updateJobs(ctx, `
+		UPDATE jobs SET status = 'pending', rerun = 0, attempts = MAX(attempts - 1, 0), updated_at = ?
+		WHERE status = 'running'
+	`, NowMs())
+}
+
+// RetryFailedJobs queues the failed jobs of kind ("" = every kind) again
+// with a fresh set of attempts.
+func (d *DB) RetryFailedJobs(ctx context.Context, kind string) (int, error) {
+	query := `UPDATE jobs SET status = 'pending', attempts = 0, run_after = 0, updated_at = ? WHERE status = 'failed'`
+	if kind != "" {
+		return d.updateJobs(ctx, query+` AND kind = ?`, NowMs(), kind)
+	}
+	return d.updateJobs(ctx, query, NowMs())
+}
+
+// PrioritizeJobs raises the pending jobs for keys (of any kind) to at
+// least priority.
+func (d *DB) PrioritizeJobs(ctx context.Context, keys []string, priority int) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	args := []any{priority, NowMs(), priority}
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	return d.updateJobs(ctx, `
+		UPDATE jobs SET priority = ?, updated_at = ?
+		WHERE status = 'pending' AND priority < ? AND key IN (`+strings.Repeat("?,", len(keys)-1)+`?)
+	`, args...)
+}
+
+// updateJobs runs an UPDATE on the jobs table and reports the rows it
+// changed.
+func (d *DB) updateJobs(ctx context.Context, query string, args ...any) (int, error) {
+	var n int64
+	err := d.Write(ctx, func(tx *sql.Tx) error {
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return int(n), err
+}
+
+// CountJobs summarizes the queue per kind.
+func (d *DB) CountJobs() ([]JobCounts, error) {
+	rows, err := d.conn.Query(`
+		SELECT kind,
+			SUM(status = 'pending'),
+			SUM(status = 'running'),
+			SUM(status = 'failed'),
+			SUM(status = 'pending' AND attempts > 0),
+			COALESCE(MIN(CASE WHEN status = 'pending' THEN created_at END), 0)
+		FROM jobs
+		GROUP BY kind
+		ORDER BY kind
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []JobCounts
+	for rows.Next() {
+		var c JobCounts
+		if err := rows.Scan(&c.Kind, &c.Pending, &c.Running, &c.Failed, &c.Retrying, &c.OldestPendingAt); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// ListJobs returns up to limit jobs with status ("" = any) of kind ("" =
+// every kind), most recently updated first.
+func (d *DB) ListJobs(kind, status string, limit int) ([]Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE 1 = 1`
+	var args []any
+	if kind != "" {
+		query += ` AND kind = ?`
+		args = append(args, kind)
+	}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY updated_at DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *j)
+	}
+	return jobs, rows.Err()
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newJobsTestDB builds an in-memory *DB holding only the jobs table, created
+// by migration 049 itself.
+func newJobsTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	conn, err := sql.Open("sqlite3", ":memory:?_busy_timeout=5000")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	conn.SetMaxOpenConns(1)
+	conn.SetMaxIdleConns(1)
+	conn.SetConnMaxLifetime(0)
+
+	for _, m := range migrations {
+		if m.Version == 49 {
+			if err := m.Up(conn); err != nil {
+				t.Fatalf("migration 049: %v", err)
+			}
+		}
+	}
+
+	d := &DB{conn: conn, writeConn: conn, role: DBRoleIndex}
+	if err := d.StartWriter(WriterConfig{}); err != nil {
+		t.Fatalf("StartWriter: %v", err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+	return d
+}
+
+func TestJobs_ClaimOrderAndDedup(t *testing.T) {
+	d := newJobsTestDB(t)
+	ctx := context.Background()
+
+	if err := d.EnqueueJobs(ctx, "preview", []string{"a", "b", "c"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	// Queuing b again raises its priority without adding a row.
+	if err := d.EnqueueJobs(ctx, "preview", []string{"b"}, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.EnqueueJobs(ctx, "preview", []string{"a"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	for {
+		j, err := d.ClaimJob(ctx, "preview")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j == nil {
+			break
+		}
+		if j.Status != JobStatusRunning || j.Attempts != 1 {
+			t.Errorf("claimed %s: status %s, attempts %d", j.Key, j.Status, j.Attempts)
+		}
+		order = append(order, j.Key)
+	}
+	if len(order) != 3 || order[0] != "b" || order[1] != "a" || order[2] != "c" {
+		t.Errorf("claim order = %v, want [b a c]", order)
+	}
+	if j, _ := d.ClaimJob(ctx, "textindex"); j != nil {
+		t.Errorf("claimed %s from another kind", j.Key)
+	}
+}
+
+func TestJobs_RetryFailAndRerun(t *testing.T) {
+	d := newJobsTestDB(t)
+	ctx := context.Background()
+
+	if err := d.EnqueueJobs(ctx, "k", []string{"x"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	j, _ := d.ClaimJob(ctx, "k")
+
+	// Backed off into the future: not claimable yet.
+	if err := d.RetryJob(ctx, j.ID, "boom", NowMs()+60_000); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := d.ClaimJob(ctx, "k"); again != nil {
+		t.Fatal("claimed a job during its backoff")
+	}
+	counts, _ := d.CountJobs()
+	if len(counts) != 1 || counts[0].Pending != 1 || counts[0].Retrying != 1 {
+		t.Errorf("counts = %+v", counts)
+	}
+
+	// Queued again by a new change: due now, attempts kept.
+	_ = d.EnqueueJobs(ctx, "k", []string{"x"}, 0)
+	j, _ = d.ClaimJob(ctx, "k")
+	if j == nil || j.Attempts != 2 {
+		t.Fatalf("reclaimed job = %+v", j)
+	}
+	if err := d.FailJob(ctx, j.ID, "gave up"); err != nil {
+		t.Fatal(err)
+	}
+	failed, _ := d.ListJobs("k", JobStatusFailed, 10)
+	if len(failed) != 1 || failed[0].LastError == nil || *failed[0].LastError != "gave up" {
+		t.Fatalf("failed jobs = %+v", failed)
+	}
+
+	if n, _ := d.RetryFailedJobs(ctx, ""); n != 1 {
+		t.Errorf("RetryFailedJobs = %d, want 1", n)
+	}
+	j, _ = d.ClaimJob(ctx, "k")
+	if j == nil || j.Attempts != 1 {
+		t.Fatalf("retried job = %+v", j)
+	}
+
+	// Queued while running: completing it queues it once more.
+	_ = d.EnqueueJobs(ctx, "k", []string{"x"}, 0)
+	if err := d.CompleteJob(ctx, j.ID); err != nil {
+		t.Fatal(err)
+	}
+	j, _ = d.ClaimJob(ctx, "k")
+	if j == nil {
+		t.Fatal("rerun job was dropped")
+	}
+	_ = d.CompleteJob(ctx, j.ID)
+	if all, _ := d.ListJobs("", "", 10); len(all) != 0 {
+		t.Errorf("jobs left after completion: %+v", all)
+	}
+}
+
+func TestJobs_ResetRunningAndPrioritize(t *testing.T) {
+	d := newJobsTestDB(t)
+	ctx := context.Background()
+
+	_ = d.EnqueueJobs(ctx, "k", []string{"a", "b"}, 0)
+	if j, _ := d.ClaimJob(ctx, "k"); j == nil || j.Key != "a" {
+		t.Fatalf("claimed %+v", j)
+	}
+	if n, _ := d.ResetRunningJobs(ctx); n != 1 {
+		t.Errorf("ResetRunningJobs = %d, want 1", n)
+	}
+	// The interrupted run doesn't count as an attempt.
+	if pending, _ := d.ListJobs("k", JobStatusPending, 10); len(pending) != 2 || pending[0].Attempts != 0 || pending[1].Attempts != 0 {
+		t.Errorf("pending after reset = %+v, want no attempts used", pending)
+	}
+	if n, _ := d.PrioritizeJobs(ctx, []string{"b", "missing"}, 20); n != 1 {
+		t.Errorf("PrioritizeJobs = %d, want 1", n)
+	}
+	if j, _ := d.ClaimJob(ctx, "k"); j == nil || j.Key != "b" {
+		t.Errorf("claimed %+v, want the prioritized job", j)
+	}
+}
+
+func TestJobs_ReleaseGivesAttemptBack(t *testing.T) {
+	d := newJobsTestDB(t)
+	ctx := context.Background()
+
+	_ = d.EnqueueJobs(ctx, "k", []string{"a"}, 0)
+	j, _ := d.ClaimJob(ctx, "k")
+	_ = d.RetryJob(ctx, j.ID, "boom", 0)
+	j, _ = d.ClaimJob(ctx, "k")
+	if j == nil || j.Attempts != 2 {
+		t.Fatalf("claimed %+v, want second attempt", j)
+	}
+	if err := d.ReleaseJob(ctx, j.ID); err != nil {
+		t.Fatal(err)
+	}
+	j, _ = d.ClaimJob(ctx, "k")
+	if j == nil || j.Attempts != 2 {
+		t.Fatalf("claimed %+v after release, want the released attempt reused", j)
+	}
+}
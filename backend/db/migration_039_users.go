@@ -0,0 +1,49 @@
+package db
+
+import "database/sql"
+
+// Migration 039 — user accounts.
+//
+// Until now the backend was single-owner: one password (settings
+// auth_password_hash) and every row implicitly belonged to that owner. This
+// migration adds a `users` table for additional accounts and attributes
+// login sessions and agent sessions to a user.
+//
+// The owner is NOT a row in `users`: it stays the implicit account behind
+// auth_password_hash, represented by the empty user id. Existing sessions
+// and agent_sessions therefore backfill to the owner for free via the ''
+// column default.
+//
+// `data_root` is a USER_DATA_DIR-relative folder the account is confined
+// to ('' = the whole data directory, only meaningful for admins).
+func init() {
+	RegisterMigration(Migration{
+		Version:     39,
+		Description: "Add users table; attribute sessions and agent_sessions to a user",
+		Target:      DBRoleApp,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS users (
+					id            TEXT PRIMARY KEY,
+					username      TEXT NOT NULL UNIQUE COLLATE NOCASE,
+					display_name  TEXT NOT NULL DEFAULT '',
+					password_hash TEXT NOT NULL,
+					role          TEXT NOT NULL DEFAULT 'member',
+					data_root     TEXT NOT NULL DEFAULT '',
+					created_at    INTEGER NOT NULL,
+					updated_at    INTEGER NOT NULL,
+					disabled_at   INTEGER
+				)`,
+				`ALTER TABLE sessions ADD COLUMN user_id TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE agent_sessions ADD COLUMN user_id TEXT NOT NULL DEFAULT ''`,
+				`CREATE INDEX IF NOT EXISTS idx_agent_sessions_user_id ON agent_sessions(user_id)`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,44 @@
+package db
+
+import "database/sql"
+
+// Migration 040 — public share links for library files and folders.
+//
+// Until now the only public surface was agent-session share tokens (a
+// column on agent_sessions). File shares need their own table because one
+// path can have several links with different modes, passwords and expiry.
+//
+//   mode          — 'read' (browse + download) | 'dropbox' (upload only)
+//   password_hash — '' when the link is not password-protected
+//   expires_at    — epoch ms; NULL = never expires
+//   user_id       — account that created the link (OwnerUserID for the owner)
+func init() {
+	RegisterMigration(Migration{
+		Version:     40,
+		Description: "Add file_shares table (public share links for library paths)",
+		Target:      DBRoleApp,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS file_shares (
+					token          TEXT PRIMARY KEY,
+					path           TEXT NOT NULL,
+					is_folder      INTEGER NOT NULL DEFAULT 0,
+					mode           TEXT NOT NULL DEFAULT 'read',
+					password_hash  TEXT NOT NULL DEFAULT '',
+					expires_at     INTEGER,
+					user_id        TEXT NOT NULL DEFAULT '',
+					access_count   INTEGER NOT NULL DEFAULT 0,
+					last_access_at INTEGER,
+					created_at     INTEGER NOT NULL
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_file_shares_path ON file_shares(path)`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package db
+
+import "database/sql"
+
+// Migration 041 — access keys for the S3-compatible API.
+//
+// Successor to the integration_credentials table migration 038 dropped,
+// narrowed to the one protocol that needs stored secrets. Unlike passwords
+// the secret is kept verbatim: SigV4 is an HMAC over the request, so the
+// server must hold the same key the client signs with.
+//
+//   user_id    — owning account (OwnerUserID for the owner)
+//   root       — USER_DATA_DIR-relative folder the key is confined to;
+//                must lie inside the owner's data root ('' = whole data dir)
+//   read_only  — 1 rejects every mutating request
+//   revoked_at — soft delete; lookups filter on revoked_at IS NULL
+func init() {
+	RegisterMigration(Migration{
+		Version:     41,
+		Description: "Add s3_credentials table (access keys for the S3-compatible API)",
+		Target:      DBRoleApp,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS s3_credentials (
+					access_key_id TEXT PRIMARY KEY,
+					secret_key    TEXT NOT NULL,
+					name          TEXT NOT NULL DEFAULT '',
+					user_id       TEXT NOT NULL DEFAULT '',
+					root          TEXT NOT NULL DEFAULT '',
+					read_only     INTEGER NOT NULL DEFAULT 0,
+					created_at    INTEGER NOT NULL,
+					last_used_at  INTEGER,
+					revoked_at    INTEGER
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_s3_credentials_user_id ON s3_credentials(user_id)`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
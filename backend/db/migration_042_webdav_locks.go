@@ -0,0 +1,44 @@
+package db
+
+import "database/sql"
+
+// Migration 042 — durable WebDAV locks.
+//
+// Until now locks lived in webdav.NewMemLS and vanished on restart, so a
+// client holding a LOCK across a redeploy (Office, Finder) got 412s on its
+// next write. Only finite-timeout locks are persisted; the handler's
+// per-request write locks never reach this table.
+//
+//   token       — opaque lock token handed to the client (urn:uuid:...)
+//   root        — lock root as "/<USER_DATA_DIR-relative path>"
+//   owner_xml   — verbatim <owner> element from the LOCK request
+//   zero_depth  — 1 = Depth: 0, 0 = Depth: infinity
+//   duration_ms — requested timeout
+//   expires_at  — unix ms; expired rows are skipped on load and swept
+func init() {
+	RegisterMigration(Migration{
+		Version:     42,
+		Description: "Add webdav_locks table (durable WebDAV locks)",
+		Target:      DBRoleApp,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS webdav_locks (
+					token       TEXT PRIMARY KEY,
+					root        TEXT NOT NULL,
+					owner_xml   TEXT NOT NULL DEFAULT '',
+					zero_depth  INTEGER NOT NULL DEFAULT 0,
+					duration_ms INTEGER NOT NULL,
+					expires_at  INTEGER NOT NULL,
+					created_at  INTEGER NOT NULL
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_webdav_locks_expires_at ON webdav_locks(expires_at)`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,36 @@
+package db
+
+import "database/sql"
+
+// Migration 043 — periodic library size snapshots.
+//
+// The server records one row a day so the storage usage endpoint can show
+// growth over time; the files table only knows the present.
+//
+//   file_count, total_size — whole library (files only)
+//   by_folder              — JSON object, top-level folder → bytes
+func init() {
+	RegisterMigration(Migration{
+		Version:     43,
+		Description: "Add storage_snapshots table (library size history)",
+		Target:      DBRoleApp,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS storage_snapshots (
+					id         INTEGER PRIMARY KEY AUTOINCREMENT,
+					taken_at   INTEGER NOT NULL,
+					file_count INTEGER NOT NULL,
+					total_size INTEGER NOT NULL,
+					by_folder  TEXT NOT NULL DEFAULT '{}'
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_storage_snapshots_taken_at ON storage_snapshots(taken_at)`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,37 @@
+package db
+
+import "database/sql"
+
+// Migration 044 — re-extract documents into files_fts.
+//
+// The text indexer used to give PDFs, Office documents, EPUBs and mail an
+// FTS row with empty content (filename only), and indexed HTML with its
+// markup. Now that it extracts their text, drop those rows: the startup
+// backfill re-indexes every file missing from files_fts.
+func init() {
+	RegisterMigration(Migration{
+		Version:     44,
+		Description: "Drop files_fts rows of extractable documents so backfill re-extracts them",
+		Target:      DBRoleIndex,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`DELETE FROM files_fts WHERE content = '' AND (
+					lower(file_path) LIKE '%.pdf' OR
+					lower(file_path) LIKE '%.docx' OR lower(file_path) LIKE '%.docm' OR
+					lower(file_path) LIKE '%.xlsx' OR lower(file_path) LIKE '%.xlsm' OR
+					lower(file_path) LIKE '%.pptx' OR lower(file_path) LIKE '%.pptm' OR
+					lower(file_path) LIKE '%.epub' OR
+					lower(file_path) LIKE '%.eml' OR
+					lower(file_path) LIKE '%.xhtml'
+				)`,
+				`DELETE FROM files_fts WHERE lower(file_path) LIKE '%.html' OR lower(file_path) LIKE '%.htm'`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
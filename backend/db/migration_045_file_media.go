@@ -0,0 +1,55 @@
+package db
+
+import "database/sql"
+
+// Migration 045 — media metadata extracted from photos, video and audio.
+//
+// One row per file the media worker has looked at; a row with only
+// extracted_at set means "examined, nothing found" so the backfill does
+// not reopen it.
+//
+//   taken_at    — capture instant, epoch ms (EXIF DateTimeOriginal, MP4 mvhd)
+//   taken_local — wall-clock capture time "YYYY-MM-DD HH:MM:SS" as shot;
+//                 the taken: search filter matches on this so a photo taken
+//                 on New Year's Eve stays in the year it was taken
+//   latitude/longitude/altitude — WGS84 degrees / metres
+//   duration_ms — audio/video running time
+func init() {
+	RegisterMigration(Migration{
+		Version:     45,
+		Description: "Add file_media table (EXIF, GPS and audio/video metadata)",
+		Target:      DBRoleIndex,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS file_media (
+					path         TEXT PRIMARY KEY,
+					taken_at     INTEGER,
+					taken_local  TEXT,
+					camera_make  TEXT,
+					camera_model TEXT,
+					lens_model   TEXT,
+					latitude     REAL,
+					longitude    REAL,
+					altitude     REAL,
+					width        INTEGER,
+					height       INTEGER,
+					orientation  INTEGER,
+					duration_ms  INTEGER,
+					title        TEXT,
+					artist       TEXT,
+					album        TEXT,
+					extracted_at INTEGER NOT NULL
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_file_media_taken_at ON file_media(taken_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_file_media_taken_local ON file_media(taken_local)`,
+				`CREATE INDEX IF NOT EXISTS idx_file_media_location ON file_media(latitude, longitude)`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
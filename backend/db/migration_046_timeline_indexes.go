@@ -0,0 +1,19 @@
+package db
+
+import "database/sql"
+
+// Migration 046 — index agent sessions by creation time for /api/timeline,
+// which pages them newest-first alongside files and explore posts (the
+// session list itself orders by updated_at). explore_posts.created_at is
+// already indexed (migration 019).
+func init() {
+	RegisterMigration(Migration{
+		Version:     46,
+		Description: "Index agent_sessions.created_at for the timeline",
+		Target:      DBRoleApp,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_agent_sessions_created_at ON agent_sessions(created_at)`)
+			return err
+		},
+	})
+}
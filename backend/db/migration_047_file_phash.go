@@ -0,0 +1,31 @@
+package db
+
+import "database/sql"
+
+// Migration 047 — duplicate detection.
+//
+//   phash — 64-bit perceptual hash (dHash) of image files, written by the
+//           preview worker alongside the thumbnail; NULL until computed and
+//           for non-images. Stored as the signed reinterpretation of the
+//           uint64 bits.
+//
+// Exact duplicates group on files.hash, which had no index until now.
+func init() {
+	RegisterMigration(Migration{
+		Version:     47,
+		Description: "Add files.phash and index files.hash for duplicate detection",
+		Target:      DBRoleIndex,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`ALTER TABLE files ADD COLUMN phash INTEGER`,
+				`CREATE INDEX IF NOT EXISTS idx_files_hash ON files(hash)`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
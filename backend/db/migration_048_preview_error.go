@@ -0,0 +1,37 @@
+package db
+
+import "database/sql"
+
+// Migration 048 — pluggable preview generators.
+//
+//	preview_error — why the last preview attempt produced nothing (the
+//	                generator's error, or why no generator could show the
+//	                file); NULL once a preview is ready.
+//
+// Previews that failed before, and audio/video/SVG files that never got
+// one, are queued again for the new generators.
+func init() {
+	RegisterMigration(Migration{
+		Version:     48,
+		Description: "Add files.preview_error and requeue previews for the new generators",
+		Target:      DBRoleIndex,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`ALTER TABLE files ADD COLUMN preview_error TEXT`,
+				`UPDATE files SET preview_status = 'pending'
+				 WHERE is_folder = 0 AND (
+				   preview_status = 'failed'
+				   OR (preview_status IS NULL AND (
+				     mime_type LIKE 'audio/%' OR mime_type LIKE 'video/%' OR mime_type = 'image/svg+xml'
+				   ))
+				 )`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
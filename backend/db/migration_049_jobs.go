@@ -0,0 +1,48 @@
+package db
+
+import "database/sql"
+
+// Migration 049 — persistent background job queue (see package jobs).
+//
+// One row per outstanding unit of work, keyed by (kind, key): enqueueing
+// work that is already queued only raises its priority. Rows are deleted
+// when the work succeeds, so the table holds the backlog plus the jobs
+// that ran out of attempts.
+//
+//	priority  — higher runs first
+//	status    — pending, running or failed
+//	attempts  — runs so far; reset when the job is queued again
+//	run_after — not before this time (ms), for retry backoff
+//	rerun     — queued again while running; run once more when done
+func init() {
+	RegisterMigration(Migration{
+		Version:     49,
+		Description: "Add the background jobs table",
+		Target:      DBRoleIndex,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS jobs (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					kind TEXT NOT NULL,
+					key TEXT NOT NULL,
+					priority INTEGER NOT NULL DEFAULT 0,
+					status TEXT NOT NULL DEFAULT 'pending',
+					attempts INTEGER NOT NULL DEFAULT 0,
+					last_error TEXT,
+					run_after INTEGER NOT NULL DEFAULT 0,
+					rerun INTEGER NOT NULL DEFAULT 0,
+					created_at INTEGER NOT NULL,
+					updated_at INTEGER NOT NULL,
+					UNIQUE (kind, key)
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_jobs_claim ON jobs(kind, status, priority DESC, run_after)`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
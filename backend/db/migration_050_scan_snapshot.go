@@ -0,0 +1,55 @@
+package db
+
+import "database/sql"
+
+// Migration 050 — incremental filesystem scans.
+//
+// scan_dirs is the directory snapshot the scanner compares against: one row
+// per directory it has listed, with the mtime (ns) and inode it had then. A
+// directory whose mtime and inode are unchanged has the same entries, so
+// the scanner skips listing it and only descends into the child
+// directories recorded here (parent = its path; the data root is "").
+//
+// scan_reports keeps the outcome of the most recent scans.
+func init() {
+	RegisterMigration(Migration{
+		Version:     50,
+		Description: "Add the scan directory snapshot and scan reports",
+		Target:      DBRoleIndex,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS scan_dirs (
+					path TEXT PRIMARY KEY,
+					parent TEXT NOT NULL,
+					mtime INTEGER NOT NULL,
+					inode INTEGER NOT NULL,
+					scanned_at INTEGER NOT NULL
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_scan_dirs_parent ON scan_dirs(parent)`,
+				`CREATE TABLE IF NOT EXISTS scan_reports (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					triggered_by TEXT NOT NULL,
+					full_scan INTEGER NOT NULL,
+					started_at INTEGER NOT NULL,
+					duration_ms INTEGER NOT NULL,
+					dirs_listed INTEGER NOT NULL,
+					dirs_changed INTEGER NOT NULL,
+					dirs_skipped INTEGER NOT NULL,
+					files_seen INTEGER NOT NULL,
+					files_processed INTEGER NOT NULL,
+					orphans_removed INTEGER NOT NULL,
+					dirs_removed INTEGER NOT NULL,
+					error_count INTEGER NOT NULL,
+					changed_dirs TEXT,
+					errors TEXT
+				)`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,42 @@
+package db
+
+import "database/sql"
+
+// Migration 051 — queued follow-up prompts.
+//
+// A prompt sent while the session's agent is mid-turn waits here until the
+// turn completes, then becomes the next turn. Rows are durable so the queue
+// survives a restart and stays editable until it is sent.
+//
+//   id          — queue item ID (uuid)
+//   session_id  — agent_sessions.session_id
+//   prompt      — prompt text, editable until dispatched
+//   message_id  — client-minted messageId echoed when the prompt is sent
+//   position    — dispatch order within the session
+func init() {
+	RegisterMigration(Migration{
+		Version:     51,
+		Description: "Add agent_prompt_queue table (queued follow-up prompts)",
+		Target:      DBRoleApp,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS agent_prompt_queue (
+					id          TEXT PRIMARY KEY,
+					session_id  TEXT NOT NULL,
+					prompt      TEXT NOT NULL,
+					message_id  TEXT NOT NULL DEFAULT '',
+					position    INTEGER NOT NULL,
+					created_at  INTEGER NOT NULL,
+					updated_at  INTEGER NOT NULL
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_agent_prompt_queue_session ON agent_prompt_queue(session_id, position)`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,43 @@
+package db
+
+import "database/sql"
+
+// Migration 052 — scheduled prompts for existing agent sessions.
+//
+// Auto agents get their schedule from their definition file; an ordinary
+// interactive session gets one from here. Each row is sent into its session
+// as a prompt, either once or on a cron expression.
+//
+//   id          — schedule ID (uuid)
+//   session_id  — agent_sessions.session_id
+//   prompt      — text sent into the session when the schedule fires
+//   cron_expr   — 5-field cron expression; '' for a one-shot
+//   run_at      — unix ms of a one-shot; 0 for a cron schedule
+//   last_run_at — unix ms of the last firing, 0 = never
+func init() {
+	RegisterMigration(Migration{
+		Version:     52,
+		Description: "Add agent_session_schedules table (scheduled prompts)",
+		Target:      DBRoleApp,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS agent_session_schedules (
+					id          TEXT PRIMARY KEY,
+					session_id  TEXT NOT NULL,
+					prompt      TEXT NOT NULL,
+					cron_expr   TEXT NOT NULL DEFAULT '',
+					run_at      INTEGER NOT NULL DEFAULT 0,
+					last_run_at INTEGER NOT NULL DEFAULT 0,
+					created_at  INTEGER NOT NULL
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_agent_session_schedules_session ON agent_session_schedules(session_id)`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,67 @@
+package db
+
+import "database/sql"
+
+// Migration 053 — approvals inbox for gated auto-agent runs.
+//
+// A gated auto agent asks before acting; each permission request it raises
+// is recorded in agent_approvals while the turn waits for the owner's
+// answer. The session's policy lives on agent_sessions, so it still applies
+// after the agent process is respawned:
+//
+//   agent_sessions.approval_timeout_ms — how long a request waits; 0 = not gated
+//   agent_sessions.approval_on_timeout — 'deny' | 'approve'
+//
+// agent_approvals:
+//
+//   id           — approval ID (uuid)
+//   session_id   — agent_sessions.session_id
+//   tool_call_id — ACP tool call the request is about
+//   agent_name   — auto agent that asked (denormalized for the inbox)
+//   title        — the tool call's title, e.g. "rm -rf build/"
+//   tool_call    — the ACP toolCall JSON, as shown on the permission card
+//   options      — the ACP permission options JSON
+//   status       — 'pending' | 'approved' | 'denied' | 'cancelled'
+//   option_id    — option the request was answered with
+//   resolved_by  — 'user' (inbox), 'session' (permission card), 'timeout'
+//   on_timeout   — 'deny' | 'approve', applied at expires_at
+//   expires_at   — unix ms when the timeout policy applies
+//   created_at   — unix ms
+//   resolved_at  — unix ms, 0 while pending
+func init() {
+	RegisterMigration(Migration{
+		Version:     53,
+		Description: "Add agent_approvals table (approvals inbox for gated auto agents)",
+		Target:      DBRoleApp,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS agent_approvals (
+					id           TEXT PRIMARY KEY,
+					session_id   TEXT NOT NULL,
+					tool_call_id TEXT NOT NULL,
+					agent_name   TEXT NOT NULL DEFAULT '',
+					title        TEXT NOT NULL DEFAULT '',
+					tool_call    TEXT NOT NULL DEFAULT '{}',
+					options      TEXT NOT NULL DEFAULT '[]',
+					status       TEXT NOT NULL DEFAULT 'pending',
+					option_id    TEXT NOT NULL DEFAULT '',
+					resolved_by  TEXT NOT NULL DEFAULT '',
+					on_timeout   TEXT NOT NULL DEFAULT 'deny',
+					expires_at   INTEGER NOT NULL,
+					created_at   INTEGER NOT NULL,
+					resolved_at  INTEGER NOT NULL DEFAULT 0
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_agent_approvals_status ON agent_approvals(status, expires_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_agent_approvals_session ON agent_approvals(session_id, tool_call_id)`,
+				`ALTER TABLE agent_sessions ADD COLUMN approval_timeout_ms INTEGER NOT NULL DEFAULT 0`,
+				`ALTER TABLE agent_sessions ADD COLUMN approval_on_timeout TEXT NOT NULL DEFAULT ''`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
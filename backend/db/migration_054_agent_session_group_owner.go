@@ -0,0 +1,29 @@
+package db
+
+import "database/sql"
+
+// Migration 054 — session groups belong to an account.
+//
+// Groups used to be one shared list, so every member saw (and could rename,
+// reorder or delete) everyone's groups. Each account now has its own;
+// existing groups go to the owner via the empty default, like the user_id
+// columns of migration 039.
+func init() {
+	RegisterMigration(Migration{
+		Version:     54,
+		Description: "Attribute agent_session_groups to a user",
+		Target:      DBRoleApp,
+		Up: func(db *sql.DB) error {
+			stmts := []string{
+				`ALTER TABLE agent_session_groups ADD COLUMN user_id TEXT NOT NULL DEFAULT ''`,
+				`CREATE INDEX IF NOT EXISTS idx_agent_session_groups_user_id ON agent_session_groups(user_id)`,
+			}
+			for _, s := range stmts {
+				if _, err := db.Exec(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,21 @@
+package db
+
+import "database/sql"
+
+// Migration 055 — the per-file size limit is off by default.
+//
+// Storage.MaxFileSize used to default to 50 MB, and every settings save
+// wrote that default back. Nothing enforced it until write limits landed,
+// so a stored 50 is the old default rather than a choice: drop it and let
+// the new default (no limit) apply.
+func init() {
+	RegisterMigration(Migration{
+		Version:     55,
+		Description: "Drop the stored 50 MB default file size limit",
+		Target:      DBRoleApp,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`DELETE FROM settings WHERE key = 'storage_max_file_size' AND value = '50'`)
+			return err
+		},
+	})
+}
@@ -26,6 +26,8 @@ const (
 	PreviewStatusPending = "pending"
 	PreviewStatusReady   = "ready"
 	PreviewStatusFailed  = "failed"
+	// No generator could show the file (no cover art, tool not installed).
+	PreviewStatusUnsupported = "unsupported"
 )
 
 // Pin represents a pinned file
@@ -44,6 +46,7 @@ type Setting struct {
 // Session represents an authentication session record
 type Session struct {
 	ID         string `json:"id"`
+	UserID     string `json:"userId"` // OwnerUserID ('') for the owner
 	CreatedAt  int64  `json:"createdAt"`
 	ExpiresAt  int64  `json:"expiresAt"`
 	LastUsedAt int64  `json:"lastUsedAt"`
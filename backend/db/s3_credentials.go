@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// S3CredentialRecord represents an access key for the S3-compatible API.
+type S3CredentialRecord struct {
+	AccessKeyID string `json:"accessKeyId"`
+	SecretKey   string `json:"-"` // shown once at creation, never serialized after
+	Name        string `json:"name"`
+	UserID      string `json:"userId,omitempty"`
+	Root        string `json:"root"` // USER_DATA_DIR-relative; '' = whole data dir
+	ReadOnly    bool   `json:"readOnly"`
+	CreatedAt   int64  `json:"createdAt"`
+	LastUsedAt  *int64 `json:"lastUsedAt,omitempty"`
+}
+
+const s3CredentialColumns = `access_key_id, secret_key, name, user_id, root, read_only, created_at, last_used_at`
+
+func scanS3Credential(row interface{ Scan(...any) error }) (*S3CredentialRecord, error) {
+	var r S3CredentialRecord
+	var readOnly int
+	var lastUsedAt sql.NullInt64
+	if err := row.Scan(&r.AccessKeyID, &r.SecretKey, &r.Name, &r.UserID, &r.Root, &readOnly, &r.CreatedAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	r.ReadOnly = readOnly == 1
+	r.LastUsedAt = IntPtr(lastUsedAt)
+	return &r, nil
+}
+
+// CreateS3Credential inserts a new access key. The caller mints the key id
+// and secret.
+func (d *DB) CreateS3Credential(ctx context.Context, r *S3CredentialRecord) error {
+	r.Root = NormalizeDataRoot(r.Root)
+	r.CreatedAt = NowMs()
+	readOnly := 0
+	if r.ReadOnly {
+		readOnly = 1
+	}
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`INSERT INTO s3_credentials (access_key_id, secret_key, name, user_id, root, read_only, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			r.AccessKeyID, r.SecretKey, r.Name, r.UserID, r.Root, readOnly, r.CreatedAt,
+		)
+		return err
+	})
+}
+
+// GetS3Credential fetches an active (non-revoked) access key. Returns nil if
+// not found.
+func (d *DB) GetS3Credential(accessKeyID string) (*S3CredentialRecord, error) {
+	r, err := scanS3Credential(d.conn.QueryRow(
+		`SELECT `+s3CredentialColumns+` FROM s3_credentials WHERE access_key_id = ? AND revoked_at IS NULL`,
+		accessKeyID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// ListS3Credentials returns active access keys, newest first. userID, when
+// non-nil, restricts the list to keys owned by that account.
+func (d *DB) ListS3Credentials(userID *string) ([]S3CredentialRecord, error) {
+	query := `SELECT ` + s3CredentialColumns + ` FROM s3_credentials WHERE revoked_at IS NULL`
+	var args []any
+	if userID != nil {
+		query += ` AND user_id = ?`
+		args = append(args, *userID)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creds []S3CredentialRecord
+	for rows.Next() {
+		r, err := scanS3Credential(rows)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// RevokeS3Credential soft-deletes an access key; it stops authenticating
+// immediately.
+func (d *DB) RevokeS3Credential(ctx context.Context, accessKeyID string) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`UPDATE s3_credentials SET revoked_at = ? WHERE access_key_id = ? AND revoked_at IS NULL`,
+			NowMs(), accessKeyID,
+		)
+		return err
+	})
+}
+
+// TouchS3Credential records that an access key was just used.
+func (d *DB) TouchS3Credential(ctx context.Context, accessKeyID string) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE s3_credentials SET last_used_at = ? WHERE access_key_id = ?`, NowMs(), accessKeyID)
+		return err
+	})
+}
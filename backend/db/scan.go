@@ -0,0 +1,235 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// scanReportsKept is how many scan reports SaveScanReport keeps.
+const scanReportsKept = 50
+
+// ScanDir is a directory as the last scan saw it. Path is relative to the
+// data root ("" is the root itself).
+type ScanDir struct {
+	Path  string
+	Mtime int64 // ns
+	Inode uint64
+}
+
+// ScanError is a path the scanner could not read.
+type ScanError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// ScanReport is the outcome of one filesystem scan.
+type ScanReport struct {
+	ID int64 `json:"id"`
+	// Trigger is what started the scan: startup, interval, rules (an
+	// ignore-rule change) or api.
+	Trigger string `json:"trigger"`
+	// Full scans list every directory and stat every file; incremental ones
+	// skip directories whose snapshot is unchanged.
+	Full       bool  `json:"full"`
+	StartedAt  int64 `json:"startedAt"`
+	DurationMs int64 `json:"durationMs"`
+	// DirsListed were read from disk, DirsChanged of them differed from
+	// (or were missing in) the snapshot; DirsSkipped matched it.
+	DirsListed     int `json:"dirsListed"`
+	DirsChanged    int `json:"dirsChanged"`
+	DirsSkipped    int `json:"dirsSkipped"`
+	FilesSeen      int `json:"filesSeen"`
+	FilesProcessed int `json:"filesProcessed"`
+	// OrphansRemoved counts the records of vanished files; DirsRemoved the
+	// vanished directories whose records were removed wholesale.
+	OrphansRemoved int `json:"orphansRemoved"`
+	DirsRemoved    int `json:"dirsRemoved"`
+	ErrorCount     int `json:"errorCount"`
+	// ChangedDirs and Errors are capped samples; the counts above are exact.
+	ChangedDirs []string    `json:"changedDirs,omitempty"`
+	Errors      []ScanError `json:"errors,omitempty"`
+}
+
+// GetScanDir returns the snapshot of one directory, nil if it has none.
+func (d *DB) GetScanDir(path string) (*ScanDir, error) {
+	sd := ScanDir{Path: path}
+	var inode int64
+	err := d.conn.QueryRow(`SELECT mtime, inode FROM scan_dirs WHERE path = ?`, path).Scan(&sd.Mtime, &inode)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sd.Inode = uint64(inode)
+	return &sd, nil
+}
+
+// ListScanDirs returns the snapshots of the directories directly inside
+// parent.
+func (d *DB) ListScanDirs(parent string) ([]ScanDir, error) {
+	rows, err := d.conn.Query(`SELECT path, mtime, inode FROM scan_dirs WHERE parent = ? AND path <> '' ORDER BY path`, parent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dirs []ScanDir
+	for rows.Next() {
+		var sd ScanDir
+		var inode int64
+		if err := rows.Scan(&sd.Path, &sd.Mtime, &inode); err != nil {
+			return nil, err
+		}
+		sd.Inode = uint64(inode)
+		dirs = append(dirs, sd)
+	}
+	return dirs, rows.Err()
+}
+
+// SaveScanDirs records directory snapshots, replacing earlier ones.
+func (d *DB) SaveScanDirs(ctx context.Context, dirs []ScanDir) error {
+	if len(dirs) == 0 {
+		return nil
+	}
+	now := NowMs()
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(`
+			INSERT INTO scan_dirs (path, parent, mtime, inode, scanned_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(path) DO UPDATE SET
+				mtime = excluded.mtime, inode = excluded.inode, scanned_at = excluded.scanned_at
+		`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, sd := range dirs {
+			parent := ""
+			if i := strings.LastIndexByte(sd.Path, '/'); i >= 0 {
+				parent = sd.Path[:i]
+			}
+			// inode is stored as its int64 bit pattern; SQLite has no
+			// unsigned integers.
+			if _, err := stmt.Exec(sd.Path, parent, sd.Mtime, int64(sd.Inode), now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteScanDirs forgets the snapshot of path and every directory below
+// it, so the next scan lists them again. "" clears the whole snapshot.
+func (d *DB) DeleteScanDirs(ctx context.Context, path string) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		if path == "" {
+			_, err := tx.Exec(`DELETE FROM scan_dirs`)
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM scan_dirs WHERE path = ? OR (path >= ? AND path < ?)`, path, path+"/", path+"0")
+		return err
+	})
+}
+
+// ListIndexedChildren returns the names of the indexed files directly in
+// dir ("" = the data root) and of the directories directly in dir that
+// hold indexed files, for reconciling one directory against its listing.
+// It reads dir's whole subtree from the path index, but holds only the
+// distinct names.
+func (d *DB) ListIndexedChildren(dir string) (files, dirs []string, err error) {
+	// substr counts characters: skip "dir/" to leave the path below dir.
+	start := 1
+	if dir != "" {
+		start = utf8.RuneCountInString(dir) + 2
+	}
+	clause, rangeArgs := folderFilter(dir)
+	rows, err := d.conn.Query(`
+		SELECT DISTINCT
+			CASE WHEN instr(rest, '/') = 0 THEN rest ELSE substr(rest, 1, instr(rest, '/') - 1) END,
+			instr(rest, '/') = 0
+		FROM (SELECT substr(path, ?) AS rest FROM files WHERE is_folder = 0`+clause+`)
+	`, append([]any{start}, rangeArgs...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var isFile bool
+		if err := rows.Scan(&name, &isFile); err != nil {
+			return nil, nil, err
+		}
+		if isFile {
+			files = append(files, name)
+		} else {
+			dirs = append(dirs, name)
+		}
+	}
+	return files, dirs, rows.Err()
+}
+
+// SaveScanReport records a scan report and drops all but the most recent
+// scanReportsKept.
+func (d *DB) SaveScanReport(ctx context.Context, r *ScanReport) error {
+	changed, err := json.Marshal(r.ChangedDirs)
+	if err != nil {
+		return err
+	}
+	errs, err := json.Marshal(r.Errors)
+	if err != nil {
+		return err
+	}
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+			INSERT INTO scan_reports (triggered_by, full_scan, started_at, duration_ms, dirs_listed, dirs_changed, dirs_skipped,
+				files_seen, files_processed, orphans_removed, dirs_removed, error_count, changed_dirs, errors)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, r.Trigger, r.Full, r.StartedAt, r.DurationMs, r.DirsListed, r.DirsChanged, r.DirsSkipped,
+			r.FilesSeen, r.FilesProcessed, r.OrphansRemoved, r.DirsRemoved, r.ErrorCount, string(changed), string(errs))
+		if err != nil {
+			return err
+		}
+		if r.ID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM scan_reports WHERE id <= ?`, r.ID-scanReportsKept)
+		return err
+	})
+}
+
+// ListScanReports returns up to limit scan reports, newest first.
+func (d *DB) ListScanReports(limit int) ([]ScanReport, error) {
+	rows, err := d.conn.Query(`
+		SELECT id, triggered_by, full_scan, started_at, duration_ms, dirs_listed, dirs_changed, dirs_skipped,
+			files_seen, files_processed, orphans_removed, dirs_removed, error_count, changed_dirs, errors
+		FROM scan_reports
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []ScanReport{}
+	for rows.Next() {
+		var r ScanReport
+		var changed, errs sql.NullString
+		if err := rows.Scan(&r.ID, &r.Trigger, &r.Full, &r.StartedAt, &r.DurationMs, &r.DirsListed, &r.DirsChanged, &r.DirsSkipped,
+			&r.FilesSeen, &r.FilesProcessed, &r.OrphansRemoved, &r.DirsRemoved, &r.ErrorCount, &changed, &errs); err != nil {
+			return nil, err
+		}
+		if changed.Valid {
+			_ = json.Unmarshal([]byte(changed.String), &r.ChangedDirs)
+		}
+		if errs.Valid {
+			_ = json.Unmarshal([]byte(errs.String), &r.Errors)
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
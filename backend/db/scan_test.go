@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"sort"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newScanTestDB builds an in-memory *DB with the tables of migration 050 and
+// a stand-in files table.
+func newScanTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	conn, err := sql.Open("sqlite3", ":memory:?_busy_timeout=5000")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	conn.SetMaxOpenConns(1)
+	conn.SetMaxIdleConns(1)
+	conn.SetConnMaxLifetime(0)
+
+	mustExec(t, conn, `CREATE TABLE files (path TEXT PRIMARY KEY, is_folder INTEGER NOT NULL DEFAULT 0)`)
+	for _, m := range migrations {
+		if m.Version == 50 {
+			if err := m.Up(conn); err != nil {
+				t.Fatalf("migration 050: %v", err)
+			}
+		}
+	}
+
+	d := &DB{conn: conn, writeConn: conn, role: DBRoleIndex}
+	if err := d.StartWriter(WriterConfig{}); err != nil {
+		t.Fatalf("StartWriter: %v", err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+	return d
+}
+
+func TestListIndexedChildren(t *testing.T) {
+	d := newScanTestDB(t)
+	for _, p := range []string{"top.md", "a/1.md", "a/2.md", "a/b/3.md", "a/b/c/4.md", "ab/5.md", "日记/六月/1.md", "日记/x.md"} {
+		mustExec(t, d.conn, `INSERT INTO files (path) VALUES (?)`, p)
+	}
+	mustExec(t, d.conn, `INSERT INTO files (path, is_folder) VALUES ('a/empty', 1)`)
+
+	for _, tc := range []struct {
+		dir         string
+		files, dirs []string
+	}{
+		{"", []string{"top.md"}, []string{"a", "ab", "日记"}},
+		{"a", []string{"1.md", "2.md"}, []string{"b"}},
+		{"a/b", []string{"3.md"}, []string{"c"}},
+		{"日记", []string{"x.md"}, []string{"六月"}},
+		{"missing", nil, nil},
+	} {
+		files, dirs, err := d.ListIndexedChildren(tc.dir)
+		if err != nil {
+			t.Fatalf("ListIndexedChildren(%q): %v", tc.dir, err)
+		}
+		sort.Strings(files)
+		sort.Strings(dirs)
+		if !reflect.DeepEqual(files, tc.files) || !reflect.DeepEqual(dirs, tc.dirs) {
+			t.Errorf("ListIndexedChildren(%q) = %v, %v; want %v, %v", tc.dir, files, dirs, tc.files, tc.dirs)
+		}
+	}
+}
+
+func TestScanDirs_SaveListDelete(t *testing.T) {
+	d := newScanTestDB(t)
+	ctx := context.Background()
+
+	dirs := []ScanDir{
+		{Path: "", Mtime: 1, Inode: 10},
+		{Path: "a", Mtime: 2, Inode: 1 << 63}, // past int64: stored as its bit pattern
+		{Path: "a/b", Mtime: 3, Inode: 12},
+		{Path: "ab", Mtime: 4, Inode: 13},
+	}
+	if err := d.SaveScanDirs(ctx, dirs); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SaveScanDirs(ctx, []ScanDir{{Path: "ab", Mtime: 5, Inode: 13}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if root, err := d.GetScanDir(""); err != nil || root == nil || *root != dirs[0] {
+		t.Errorf("GetScanDir(root) = %+v, %v", root, err)
+	}
+	top, err := d.ListScanDirs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ScanDir{dirs[1], {Path: "ab", Mtime: 5, Inode: 13}}
+	if !reflect.DeepEqual(top, want) {
+		t.Errorf("ListScanDirs(root) = %+v, want %+v", top, want)
+	}
+
+	if err := d.DeleteScanDirs(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	for path, kept := range map[string]bool{"": true, "a": false, "a/b": false, "ab": true} {
+		if sd, _ := d.GetScanDir(path); (sd != nil) != kept {
+			t.Errorf("after DeleteScanDirs(a): %q kept = %v, want %v", path, sd != nil, kept)
+		}
+	}
+}
+
+func TestScanReports_KeepsRecent(t *testing.T) {
+	d := newScanTestDB(t)
+	ctx := context.Background()
+
+	for i := 0; i < scanReportsKept+3; i++ {
+		r := &ScanReport{Trigger: "interval", StartedAt: int64(i), FilesSeen: i}
+		if i == scanReportsKept+2 {
+			r.Full = true
+			r.ChangedDirs = []string{"a"}
+			r.Errors = []ScanError{{Path: "b", Error: "permission denied"}}
+		}
+		if err := d.SaveScanReport(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reports, err := d.ListScanReports(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != scanReportsKept {
+		t.Fatalf("kept %d reports, want %d", len(reports), scanReportsKept)
+	}
+	latest := reports[0]
+	if !latest.Full || latest.FilesSeen != scanReportsKept+2 ||
+		!reflect.DeepEqual(latest.ChangedDirs, []string{"a"}) ||
+		len(latest.Errors) != 1 || latest.Errors[0].Path != "b" {
+		t.Errorf("latest report = %+v", latest)
+	}
+	if oldest := reports[len(reports)-1]; oldest.FilesSeen != 3 {
+		t.Errorf("oldest kept report = %+v", oldest)
+	}
+}
@@ -11,16 +11,17 @@ const (
 	SessionDuration = 30 * 24 * time.Hour
 )
 
-// CreateSession creates a new session in the database
-func (d *DB) CreateSession(ctx context.Context, id string) (*Session, error) {
+// CreateSession creates a new session in the database. userID is the
+// account the session authenticates as (OwnerUserID for the owner).
+func (d *DB) CreateSession(ctx context.Context, id, userID string) (*Session, error) {
 	now := NowMs()
 	expiresAt := time.Now().Add(SessionDuration).UnixMilli()
 
 	if err := d.Write(ctx, func(tx *sql.Tx) error {
 		_, err := tx.Exec(`
-			INSERT INTO sessions (id, created_at, expires_at, last_used_at)
-			VALUES (?, ?, ?, ?)
-		`, id, now, expiresAt, now)
+			INSERT INTO sessions (id, user_id, created_at, expires_at, last_used_at)
+			VALUES (?, ?, ?, ?, ?)
+		`, id, userID, now, expiresAt, now)
 		return err
 	}); err != nil {
 		return nil, err
@@ -28,6 +29,7 @@ func (d *DB) CreateSession(ctx context.Context, id string) (*Session, error) {
 
 	return &Session{
 		ID:         id,
+		UserID:     userID,
 		CreatedAt:  now,
 		ExpiresAt:  expiresAt,
 		LastUsedAt: now,
@@ -38,10 +40,10 @@ func (d *DB) CreateSession(ctx context.Context, id string) (*Session, error) {
 func (d *DB) GetSession(id string) (*Session, error) {
 	var s Session
 	err := d.conn.QueryRow(`
-		SELECT id, created_at, expires_at, last_used_at
+		SELECT id, user_id, created_at, expires_at, last_used_at
 		FROM sessions
 		WHERE id = ? AND expires_at > ?
-	`, id, NowMs()).Scan(&s.ID, &s.CreatedAt, &s.ExpiresAt, &s.LastUsedAt)
+	`, id, NowMs()).Scan(&s.ID, &s.UserID, &s.CreatedAt, &s.ExpiresAt, &s.LastUsedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -213,27 +213,50 @@ func (d *DB) LoadUserSettings() (*models.UserSettings, error) {
 
 	// Build storage
 	storage := models.Storage{
-		DataPath:    pickFromMap("storage_data_path", "MY_DATA_DIR", "./data"),
-		AutoBackup:  pickFromMap("storage_auto_backup", "", "false") == "true",
-		MaxFileSize: 50,
+		DataPath:   pickFromMap("storage_data_path", "MY_DATA_DIR", "./data"),
+		AutoBackup: pickFromMap("storage_auto_backup", "", "false") == "true",
 	}
 
-	// Parse max file size
-	if sizeStr := pickFromMap("storage_max_file_size", "", "50"); sizeStr != "" {
-		if size, err := strconv.Atoi(sizeStr); err == nil {
-			storage.MaxFileSize = size
-		}
+	// Parse max file size (0 = no limit)
+	maxFileSize := 0
+	if size, err := strconv.Atoi(pickFromMap("storage_max_file_size", "", "0")); err == nil && size > 0 {
+		maxFileSize = size
 	}
+	storage.MaxFileSize = &maxFileSize
 
 	// Optional storage fields
 	if backupPath := pickFromMap("storage_backup_path", "", ""); backupPath != "" {
 		storage.BackupPath = backupPath
 	}
+	if quotas := pickFromMap("storage_folder_quotas", "", ""); quotas != "" {
+		if err := json.Unmarshal([]byte(quotas), &storage.FolderQuotas); err != nil {
+			storage.FolderQuotas = nil
+		}
+	}
+
+	// Build indexing
+	var indexing models.Indexing
+	if patterns := pickFromMap("indexing_ignore_patterns", "", ""); patterns != "" {
+		if err := json.Unmarshal([]byte(patterns), &indexing.IgnorePatterns); err != nil {
+			indexing.IgnorePatterns = nil
+		}
+	}
+	if follow := pickFromMap("indexing_follow_symlinks", "", ""); follow != "" {
+		if b, err := strconv.ParseBool(follow); err == nil {
+			indexing.FollowSymlinks = &b
+		}
+	}
+	if mounts := pickFromMap("indexing_mounted_folders", "", ""); mounts != "" {
+		if err := json.Unmarshal([]byte(mounts), &indexing.MountedFolders); err != nil {
+			indexing.MountedFolders = nil
+		}
+	}
 
 	return &models.UserSettings{
 		Preferences: preferences,
 		Extraction:  extraction,
 		Storage:     storage,
+		Indexing:    indexing,
 	}, nil
 }
 
@@ -274,7 +297,35 @@ func (d *DB) SaveUserSettings(ctx context.Context, settings *models.UserSettings
 		updates["storage_backup_path"] = settings.Storage.BackupPath
 	}
 	updates["storage_auto_backup"] = strconv.FormatBool(settings.Storage.AutoBackup)
-	updates["storage_max_file_size"] = strconv.Itoa(settings.Storage.MaxFileSize)
+	if settings.Storage.MaxFileSize != nil {
+		updates["storage_max_file_size"] = strconv.Itoa(*settings.Storage.MaxFileSize)
+	}
+	if settings.Storage.FolderQuotas != nil {
+		quotas, err := json.Marshal(settings.Storage.FolderQuotas)
+		if err != nil {
+			return err
+		}
+		updates["storage_folder_quotas"] = string(quotas)
+	}
+
+	// Indexing
+	if settings.Indexing.IgnorePatterns != nil {
+		patterns, err := json.Marshal(settings.Indexing.IgnorePatterns)
+		if err != nil {
+			return err
+		}
+		updates["indexing_ignore_patterns"] = string(patterns)
+	}
+	if settings.Indexing.FollowSymlinks != nil {
+		updates["indexing_follow_symlinks"] = strconv.FormatBool(*settings.Indexing.FollowSymlinks)
+	}
+	if settings.Indexing.MountedFolders != nil {
+		mounts, err := json.Marshal(settings.Indexing.MountedFolders)
+		if err != nil {
+			return err
+		}
+		updates["indexing_mounted_folders"] = string(mounts)
+	}
 
 	return d.UpdateSettings(ctx, updates)
 }
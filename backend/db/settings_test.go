@@ -0,0 +1,33 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUserSettings_MaxFileSizeDefaultsToNoLimitAndSavesZero(t *testing.T) {
+	d := openTestAppDB(t)
+	ctx := context.Background()
+
+	s, err := d.LoadUserSettings()
+	if err != nil {
+		t.Fatalf("LoadUserSettings: %v", err)
+	}
+	if s.Storage.MaxFileSize == nil || *s.Storage.MaxFileSize != 0 {
+		t.Fatalf("default MaxFileSize = %v, want 0 (no limit)", s.Storage.MaxFileSize)
+	}
+
+	for _, mb := range []int{25, 0} {
+		s.Storage.MaxFileSize = &mb
+		if err := d.SaveUserSettings(ctx, s); err != nil {
+			t.Fatalf("SaveUserSettings(%d): %v", mb, err)
+		}
+		got, err := d.LoadUserSettings()
+		if err != nil {
+			t.Fatalf("LoadUserSettings: %v", err)
+		}
+		if *got.Storage.MaxFileSize != mb {
+			t.Fatalf("MaxFileSize after saving %d = %d", mb, *got.Storage.MaxFileSize)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// FolderUsage is the file count and size of one folder's subtree.
+type FolderUsage struct {
+	Folder    string `json:"folder"` // "" = files directly in the root
+	FileCount int64  `json:"fileCount"`
+	Size      int64  `json:"size"`
+}
+
+// MimeTypeUsage is the file count and size of one MIME type.
+type MimeTypeUsage struct {
+	MimeType  string `json:"mimeType"` // "" = unknown
+	FileCount int64  `json:"fileCount"`
+	Size      int64  `json:"size"`
+}
+
+// LargeFile is one entry of a largest-files listing.
+type LargeFile struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	MimeType   string `json:"mimeType,omitempty"`
+	ModifiedAt int64  `json:"modifiedAt"`
+}
+
+// UsageByFolder groups the files under root by the top-level folder they
+// live in (relative to root), largest first.
+func (d *DB) UsageByFolder(root string) ([]FolderUsage, error) {
+	clause, args := folderFilter(root)
+	// substr() counts characters, so the offset is in runes.
+	offset := 1
+	if root = strings.Trim(root, "/"); root != "" {
+		offset = utf8.RuneCountInString(root) + 2
+	}
+	rows, err := d.conn.Query(`
+		SELECT CASE WHEN instr(rest, '/') > 0 THEN substr(rest, 1, instr(rest, '/') - 1) ELSE '' END AS folder,
+		       COUNT(*), COALESCE(SUM(size), 0)
+		FROM (SELECT substr(path, ?) AS rest, size FROM files WHERE is_folder = 0`+clause+`)
+		GROUP BY folder
+		ORDER BY 3 DESC`,
+		append([]any{offset}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []FolderUsage
+	for rows.Next() {
+		var u FolderUsage
+		if err := rows.Scan(&u.Folder, &u.FileCount, &u.Size); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// UsageByMimeType groups the files under root by MIME type, largest first.
+func (d *DB) UsageByMimeType(root string, limit int) ([]MimeTypeUsage, error) {
+	clause, args := folderFilter(root)
+	rows, err := d.conn.Query(`
+		SELECT COALESCE(mime_type, ''), COUNT(*), COALESCE(SUM(size), 0)
+		FROM files WHERE is_folder = 0`+clause+`
+		GROUP BY 1
+		ORDER BY 3 DESC
+		LIMIT ?`,
+		append(args, limit)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []MimeTypeUsage
+	for rows.Next() {
+		var u MimeTypeUsage
+		if err := rows.Scan(&u.MimeType, &u.FileCount, &u.Size); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// LargestFiles returns the biggest files under root.
+func (d *DB) LargestFiles(root string, limit int) ([]LargeFile, error) {
+	clause, args := folderFilter(root)
+	rows, err := d.conn.Query(`
+		SELECT path, COALESCE(size, 0), COALESCE(mime_type, ''), modified_at
+		FROM files WHERE is_folder = 0`+clause+`
+		ORDER BY size DESC
+		LIMIT ?`,
+		append(args, limit)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []LargeFile
+	for rows.Next() {
+		var f LargeFile
+		if err := rows.Scan(&f.Path, &f.Size, &f.MimeType, &f.ModifiedAt); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// StorageSnapshot is a point-in-time record of library size, kept in the
+// app DB to chart growth.
+type StorageSnapshot struct {
+	TakenAt   int64            `json:"takenAt"`
+	FileCount int64            `json:"fileCount"`
+	TotalSize int64            `json:"totalSize"`
+	ByFolder  map[string]int64 `json:"byFolder"` // top-level folder → bytes
+}
+
+// InsertStorageSnapshot records a snapshot.
+func (d *DB) InsertStorageSnapshot(ctx context.Context, s *StorageSnapshot) error {
+	byFolder, err := json.Marshal(s.ByFolder)
+	if err != nil {
+		return err
+	}
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`INSERT INTO storage_snapshots (taken_at, file_count, total_size, by_folder) VALUES (?, ?, ?, ?)`,
+			s.TakenAt, s.FileCount, s.TotalSize, string(byFolder),
+		)
+		return err
+	})
+}
+
+// ListStorageSnapshots returns snapshots taken at or after sinceMs, oldest
+// first.
+func (d *DB) ListStorageSnapshots(sinceMs int64) ([]StorageSnapshot, error) {
+	rows, err := d.conn.Query(
+		`SELECT taken_at, file_count, total_size, by_folder FROM storage_snapshots
+		 WHERE taken_at >= ? ORDER BY taken_at`,
+		sinceMs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snaps []StorageSnapshot
+	for rows.Next() {
+		var s StorageSnapshot
+		var byFolder string
+		if err := rows.Scan(&s.TakenAt, &s.FileCount, &s.TotalSize, &byFolder); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(byFolder), &s.ByFolder); err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, s)
+	}
+	return snaps, rows.Err()
+}
+
+// LatestStorageSnapshotAt returns when the newest snapshot was taken, or 0
+// if there is none.
+func (d *DB) LatestStorageSnapshotAt() (int64, error) {
+	var takenAt int64
+	err := d.conn.QueryRow(`SELECT COALESCE(MAX(taken_at), 0) FROM storage_snapshots`).Scan(&takenAt)
+	return takenAt, err
+}
+
+// DeleteStorageSnapshotsBefore prunes snapshots older than beforeMs.
+func (d *DB) DeleteStorageSnapshotsBefore(ctx context.Context, beforeMs int64) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM storage_snapshots WHERE taken_at < ?`, beforeMs)
+		return err
+	})
+}
@@ -0,0 +1,315 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Timeline entry kinds. They double as the cursor tie-breaker, so their
+// string order is part of the timeline's sort order.
+const (
+	TimelineKindFile    = "file"
+	TimelineKindPost    = "post"
+	TimelineKindSession = "session"
+)
+
+// TimelineEntry is one item of the merged timeline: what it is, its ID
+// within its kind (file path, post ID, session ID) and when it happened.
+type TimelineEntry struct {
+	Kind string
+	ID   string
+	At   int64
+}
+
+// TimelineCursor marks a position in the merged timeline, which is ordered
+// by (At, Kind, ID) descending across every source.
+type TimelineCursor struct {
+	At   int64
+	Kind string
+	ID   string
+}
+
+// CreateTimelineCursor creates a cursor string for the position of e.
+// Format: {epochMs}:{kind}:{id} (e.g., "1738424226000:file:inbox/a.jpg")
+func CreateTimelineCursor(e TimelineEntry) string {
+	return strconv.FormatInt(e.At, 10) + ":" + e.Kind + ":" + e.ID
+}
+
+// ParseTimelineCursor parses a cursor string; nil if it is malformed.
+func ParseTimelineCursor(cursor string) *TimelineCursor {
+	parts := strings.SplitN(cursor, ":", 3)
+	if len(parts) != 3 {
+		return nil
+	}
+	at, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil
+	}
+	switch parts[1] {
+	case TimelineKindFile, TimelineKindPost, TimelineKindSession:
+	default:
+		return nil
+	}
+	return &TimelineCursor{At: at, Kind: parts[1], ID: parts[2]}
+}
+
+// Newer reports whether e comes before o in the timeline order.
+func (e TimelineEntry) Newer(o TimelineEntry) bool {
+	if e.At != o.At {
+		return e.At > o.At
+	}
+	if e.Kind != o.Kind {
+		return e.Kind > o.Kind
+	}
+	return e.ID > o.ID
+}
+
+// TimelineRange selects a slice of one timeline source: entries older than
+// Before (nil = from the newest), with Since <= At < Until (0 = unbounded),
+// at most Limit of them (0 = all).
+type TimelineRange struct {
+	Before *TimelineCursor
+	Since  int64
+	Until  int64
+	Limit  int
+}
+
+// TimelineSpan is a [Since, Until) slice of the timeline in epoch ms,
+// typically one local day.
+type TimelineSpan struct {
+	Since int64
+	Until int64
+}
+
+// timelineSource describes how one table feeds the timeline. A source whose
+// timestamp can come from more than one column is split into parts, one per
+// column, so every part filters and orders on an indexed column.
+type timelineSource struct {
+	kind  string
+	parts []timelinePart
+}
+
+// timelinePart is one SELECT of a timeline source.
+type timelinePart struct {
+	from  string // FROM clause, may include joins
+	at    string // indexed timestamp column, epoch ms
+	id    string // ID expression
+	where []string
+	args  []any
+}
+
+// selectWhere returns " WHERE ..." for the part's own filters plus extra,
+// with their arguments; "" when there are none.
+func (p timelinePart) selectWhere(extra []string, extraArgs []any) (string, []any) {
+	where := append(append([]string(nil), p.where...), extra...)
+	args := append(append([]any(nil), p.args...), extraArgs...)
+	if len(where) == 0 {
+		return "", args
+	}
+	return ` WHERE ` + strings.Join(where, " AND "), args
+}
+
+// listTimeline returns the source's entries in r, newest first.
+func (d *DB) listTimeline(src timelineSource, r TimelineRange) ([]TimelineEntry, error) {
+	var selects []string
+	var args []any
+	for _, p := range src.parts {
+		var where []string
+		var whereArgs []any
+		if c := r.Before; c != nil {
+			// Keyset on (at, kind, id) with kind fixed per source: a kind that
+			// sorts below the cursor's may share its timestamp, one above may not.
+			switch {
+			case src.kind < c.Kind:
+				where = append(where, p.at+" <= ?")
+				whereArgs = append(whereArgs, c.At)
+			case src.kind > c.Kind:
+				where = append(where, p.at+" < ?")
+				whereArgs = append(whereArgs, c.At)
+			default:
+				// Spelled so the at bound stays a plain index range.
+				where = append(where, p.at+" <= ? AND ("+p.at+" < ? OR "+p.id+" < ?)")
+				whereArgs = append(whereArgs, c.At, c.At, c.ID)
+			}
+		}
+		if r.Since > 0 {
+			where = append(where, p.at+" >= ?")
+			whereArgs = append(whereArgs, r.Since)
+		}
+		if r.Until > 0 {
+			where = append(where, p.at+" < ?")
+			whereArgs = append(whereArgs, r.Until)
+		}
+		clause, clauseArgs := p.selectWhere(where, whereArgs)
+		query := fmt.Sprintf(`SELECT %s AS id, %s AS at FROM %s%s ORDER BY %s DESC, %s DESC`, p.id, p.at, p.from, clause, p.at, p.id)
+		args = append(args, clauseArgs...)
+		if r.Limit > 0 {
+			query += ` LIMIT ?`
+			args = append(args, r.Limit)
+		}
+		selects = append(selects, query)
+	}
+
+	query := selects[0]
+	if len(selects) > 1 {
+		// Each part walks its own index up to the limit; merge the heads.
+		for i, sel := range selects {
+			selects[i] = `SELECT id, at FROM (` + sel + `)`
+		}
+		query = strings.Join(selects, ` UNION ALL `) + ` ORDER BY at DESC, id DESC`
+		if r.Limit > 0 {
+			query += ` LIMIT ?`
+			args = append(args, r.Limit)
+		}
+	}
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list timeline %ss: %w", src.kind, err)
+	}
+	defer rows.Close()
+
+	var entries []TimelineEntry
+	for rows.Next() {
+		e := TimelineEntry{Kind: src.kind}
+		if err := rows.Scan(&e.ID, &e.At); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// countTimeline counts the source's entries in each of spans, which must not
+// overlap. The grouping happens in SQL and only the spans' index ranges are
+// read.
+func (d *DB) countTimeline(src timelineSource, spans []TimelineSpan) ([]int, error) {
+	counts := make([]int, len(spans))
+	if len(spans) == 0 {
+		return counts, nil
+	}
+
+	var selects []string
+	var args []any
+	for _, p := range src.parts {
+		var day strings.Builder
+		var ranges []string
+		var dayArgs, rangeArgs []any
+		day.WriteString("CASE")
+		for i, s := range spans {
+			fmt.Fprintf(&day, " WHEN %s >= ? AND %s < ? THEN %d", p.at, p.at, i)
+			dayArgs = append(dayArgs, s.Since, s.Until)
+			ranges = append(ranges, "("+p.at+" >= ? AND "+p.at+" < ?)")
+			rangeArgs = append(rangeArgs, s.Since, s.Until)
+		}
+		day.WriteString(" END")
+		clause, clauseArgs := p.selectWhere([]string{"(" + strings.Join(ranges, " OR ") + ")"}, rangeArgs)
+		selects = append(selects, fmt.Sprintf(`SELECT %s AS day FROM %s%s`, day.String(), p.from, clause))
+		args = append(append(args, dayArgs...), clauseArgs...)
+	}
+	query := `SELECT day, COUNT(*) FROM (` + strings.Join(selects, ` UNION ALL `) + `) GROUP BY day`
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("count timeline %ss: %w", src.kind, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day, n int
+		if err := rows.Scan(&day, &n); err != nil {
+			return nil, err
+		}
+		counts[day] = n
+	}
+	return counts, rows.Err()
+}
+
+// timelineFiles is the source of library files (not folders) under folder
+// ("" = the whole library), placed at their capture time when the media
+// worker found one and at the time they were added otherwise. The two
+// timestamps live in different tables, so each gets its own part.
+func timelineFiles(folder string) timelineSource {
+	captured := timelinePart{
+		from:  `file_media JOIN files ON files.path = file_media.path`,
+		at:    `file_media.taken_at`,
+		id:    `files.path`,
+		where: []string{`file_media.taken_at IS NOT NULL`, `files.is_folder = 0`},
+	}
+	added := timelinePart{
+		from: `files`,
+		at:   `files.created_at`,
+		id:   `files.path`,
+		where: []string{`files.is_folder = 0`,
+			`NOT EXISTS (SELECT 1 FROM file_media WHERE file_media.path = files.path AND file_media.taken_at IS NOT NULL)`},
+	}
+	if folder = strings.Trim(folder, "/"); folder != "" {
+		// Same range trick as folderFilter, qualified for the join.
+		for _, p := range []*timelinePart{&captured, &added} {
+			p.where = append(p.where, `files.path >= ? AND files.path < ?`)
+			p.args = append(p.args, folder+"/", folder+"0")
+		}
+	}
+	return timelineSource{kind: TimelineKindFile, parts: []timelinePart{captured, added}}
+}
+
+// timelineSessions is the source of non-archived agent sessions by creation
+// time. userID (optional) restricts them to one account; workingDir
+// (optional, absolute) to sessions run in that directory or below it.
+func timelineSessions(userID *string, workingDir string) timelineSource {
+	p := timelinePart{
+		from:  `agent_sessions`,
+		at:    `created_at`,
+		id:    `session_id`,
+		where: []string{`archived_at IS NULL`},
+	}
+	if userID != nil {
+		p.where = append(p.where, `user_id = ?`)
+		p.args = append(p.args, *userID)
+	}
+	if workingDir = strings.TrimSuffix(workingDir, "/"); workingDir != "" {
+		p.where = append(p.where, `(working_dir = ? OR working_dir LIKE ? ESCAPE '\')`)
+		p.args = append(p.args, workingDir, escapeLikePrefix(workingDir+"/")+"%")
+	}
+	return timelineSource{kind: TimelineKindSession, parts: []timelinePart{p}}
+}
+
+// timelinePosts is the source of explore posts by creation time.
+func timelinePosts() timelineSource {
+	return timelineSource{kind: TimelineKindPost, parts: []timelinePart{{
+		from: `explore_posts`,
+		at:   `created_at`,
+		id:   `id`,
+	}}}
+}
+
+// ListTimelineFiles lists library files under folder; see timelineFiles.
+func (d *DB) ListTimelineFiles(folder string, r TimelineRange) ([]TimelineEntry, error) {
+	return d.listTimeline(timelineFiles(folder), r)
+}
+
+// CountTimelineFiles counts library files under folder in each span.
+func (d *DB) CountTimelineFiles(folder string, spans []TimelineSpan) ([]int, error) {
+	return d.countTimeline(timelineFiles(folder), spans)
+}
+
+// ListTimelineSessions lists agent sessions; see timelineSessions.
+func (d *DB) ListTimelineSessions(userID *string, workingDir string, r TimelineRange) ([]TimelineEntry, error) {
+	return d.listTimeline(timelineSessions(userID, workingDir), r)
+}
+
+// CountTimelineSessions counts agent sessions in each span.
+func (d *DB) CountTimelineSessions(userID *string, workingDir string, spans []TimelineSpan) ([]int, error) {
+	return d.countTimeline(timelineSessions(userID, workingDir), spans)
+}
+
+// ListTimelinePosts lists explore posts by creation time.
+func (d *DB) ListTimelinePosts(r TimelineRange) ([]TimelineEntry, error) {
+	return d.listTimeline(timelinePosts(), r)
+}
+
+// CountTimelinePosts counts explore posts in each span.
+func (d *DB) CountTimelinePosts(spans []TimelineSpan) ([]int, error) {
+	return d.countTimeline(timelinePosts(), spans)
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTimeline_KeysetPagingAcrossKinds(t *testing.T) {
+	d := openTestAppDB(t)
+	ctx := context.Background()
+
+	// Sessions and posts share timestamps so the cursor has to break ties
+	// by kind and then ID.
+	for _, s := range []struct {
+		id, dir string
+		at      int64
+	}{
+		{"s1", "/data/notes", 3000},
+		{"s2", "/data/notes/deep", 2000},
+		{"s3", "/data/notesx", 2000},
+		{"s4", "/tmp", 1000},
+	} {
+		if err := d.CreateAgentSession(ctx, s.id, "claude_code", s.dir, "", "user", "", "", "", "", OwnerUserID); err != nil {
+			t.Fatalf("CreateAgentSession: %v", err)
+		}
+		if _, err := d.conn.Exec(`UPDATE agent_sessions SET created_at = ? WHERE session_id = ?`, s.at, s.id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []*ExplorePost{
+		{ID: "p1", Author: "a", Title: "one", CreatedAt: 3000},
+		{ID: "p2", Author: "a", Title: "two", CreatedAt: 2000},
+	} {
+		if err := d.InsertExplorePost(ctx, p); err != nil {
+			t.Fatalf("InsertExplorePost: %v", err)
+		}
+	}
+
+	merged := func(r TimelineRange) []string {
+		sessions, err := d.ListTimelineSessions(nil, "", r)
+		if err != nil {
+			t.Fatalf("ListTimelineSessions: %v", err)
+		}
+		posts, err := d.ListTimelinePosts(r)
+		if err != nil {
+			t.Fatalf("ListTimelinePosts: %v", err)
+		}
+		all := append(sessions, posts...)
+		sort.Slice(all, func(i, j int) bool { return all[i].Newer(all[j]) })
+		if r.Limit > 0 && len(all) > r.Limit {
+			all = all[:r.Limit]
+		}
+		var ids []string
+		for _, e := range all {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	want := []string{"s1", "p1", "s3", "s2", "p2", "s4"}
+	if got := merged(TimelineRange{}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("full timeline = %v, want %v", got, want)
+	}
+
+	// Walk it two at a time through the string cursor.
+	var paged []string
+	var before *TimelineCursor
+	for range 10 {
+		page := merged(TimelineRange{Before: before, Limit: 2})
+		if len(page) == 0 {
+			break
+		}
+		paged = append(paged, page...)
+		last := page[len(page)-1]
+		kind := TimelineKindSession
+		if last[0] == 'p' {
+			kind = TimelineKindPost
+		}
+		var at int64
+		switch last {
+		case "s1", "p1":
+			at = 3000
+		case "s4":
+			at = 1000
+		default:
+			at = 2000
+		}
+		before = ParseTimelineCursor(CreateTimelineCursor(TimelineEntry{Kind: kind, ID: last, At: at}))
+		if before == nil {
+			t.Fatal("cursor did not round-trip")
+		}
+	}
+	if !reflect.DeepEqual(paged, want) {
+		t.Errorf("paged timeline = %v, want %v", paged, want)
+	}
+
+	// Day-count style range query: [2000, 3000).
+	if got := merged(TimelineRange{Since: 2000, Until: 3000}); !reflect.DeepEqual(got, []string{"s3", "s2", "p2"}) {
+		t.Errorf("range = %v", got)
+	}
+
+	// Day counts group the same rows in SQL.
+	counts, err := d.CountTimelineSessions(nil, "", []TimelineSpan{{Since: 2000, Until: 3000}, {Since: 3000, Until: 4000}, {Since: 5000, Until: 6000}})
+	if err != nil || !reflect.DeepEqual(counts, []int{2, 1, 0}) {
+		t.Errorf("session counts = %v, %v", counts, err)
+	}
+
+	// Working-dir filter matches the folder and below, not siblings.
+	entries, err := d.ListTimelineSessions(nil, "/data/notes/", TimelineRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != "s1" || entries[1].ID != "s2" {
+		t.Errorf("folder filter = %+v", entries)
+	}
+}
+
+func TestParseTimelineCursor(t *testing.T) {
+	c := ParseTimelineCursor("1738424226000:file:inbox/a:b.jpg")
+	if c == nil || c.At != 1738424226000 || c.Kind != TimelineKindFile || c.ID != "inbox/a:b.jpg" {
+		t.Errorf("parsed %+v", c)
+	}
+	for _, bad := range []string{"", "123", "123:file", "x:file:a", "123:folder:a"} {
+		if ParseTimelineCursor(bad) != nil {
+			t.Errorf("ParseTimelineCursor(%q) accepted", bad)
+		}
+	}
+}
+
+// newTimelineFilesTestDB builds stand-ins for the index tables the file
+// timeline reads, with their timestamp indexes.
+func newTimelineFilesTestDB(t *testing.T) *DB {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = conn.Close() })
+	for _, s := range []string{
+		`CREATE TABLE files (path TEXT PRIMARY KEY, is_folder INTEGER NOT NULL DEFAULT 0, created_at INTEGER NOT NULL)`,
+		`CREATE INDEX idx_files_created_at ON files(created_at)`,
+		`CREATE TABLE file_media (path TEXT PRIMARY KEY, taken_at INTEGER)`,
+		`CREATE INDEX idx_file_media_taken_at ON file_media(taken_at)`,
+	} {
+		mustExec(t, conn, s)
+	}
+	return &DB{conn: conn, role: DBRoleIndex}
+}
+
+func TestTimeline_FilesAtCaptureTime(t *testing.T) {
+	d := newTimelineFilesTestDB(t)
+	for _, f := range []struct {
+		path    string
+		folder  int
+		created int64
+	}{
+		{"a.jpg", 0, 5000},       // captured at 1000
+		{"b.md", 0, 3000},        // no media row
+		{"c.mp4", 0, 4000},       // media row without a capture time
+		{"other/d.jpg", 0, 2000}, // captured at 3000, ties with b.md
+		{"other", 1, 6000},
+	} {
+		mustExec(t, d.conn, `INSERT INTO files (path, is_folder, created_at) VALUES (?, ?, ?)`, f.path, f.folder, f.created)
+	}
+	mustExec(t, d.conn, `INSERT INTO file_media (path, taken_at) VALUES ('a.jpg', 1000), ('c.mp4', NULL), ('other/d.jpg', 3000)`)
+
+	ids := func(entries []TimelineEntry) []string {
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.ID)
+		}
+		return out
+	}
+	want := []string{"c.mp4", "other/d.jpg", "b.md", "a.jpg"}
+	entries, err := d.ListTimelineFiles("", TimelineRange{})
+	if err != nil || !reflect.DeepEqual(ids(entries), want) {
+		t.Fatalf("files = %v, %v; want %v", ids(entries), err, want)
+	}
+
+	// Paging merges the captured and added parts without gaps.
+	var paged []string
+	var before *TimelineCursor
+	for range 10 {
+		page, err := d.ListTimelineFiles("", TimelineRange{Before: before, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		paged = append(paged, ids(page)...)
+		last := page[len(page)-1]
+		before = &TimelineCursor{At: last.At, Kind: last.Kind, ID: last.ID}
+	}
+	if !reflect.DeepEqual(paged, want) {
+		t.Errorf("paged files = %v, want %v", paged, want)
+	}
+
+	if entries, _ := d.ListTimelineFiles("other/", TimelineRange{}); !reflect.DeepEqual(ids(entries), []string{"other/d.jpg"}) {
+		t.Errorf("folder files = %v", ids(entries))
+	}
+
+	spans := []TimelineSpan{{Since: 0, Until: 2000}, {Since: 2000, Until: 4000}, {Since: 4000, Until: 5000}, {Since: 5000, Until: 7000}}
+	counts, err := d.CountTimelineFiles("", spans)
+	if err != nil || !reflect.DeepEqual(counts, []int{1, 2, 1, 0}) {
+		t.Errorf("file counts = %v, %v", counts, err)
+	}
+	if counts, _ := d.CountTimelineFiles("other", spans); !reflect.DeepEqual(counts, []int{0, 1, 0, 0}) {
+		t.Errorf("folder file counts = %v", counts)
+	}
+}
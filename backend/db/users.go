@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// User roles. The owner is the implicit account behind the
+// auth_password_hash setting and is never stored in the users table; admins
+// and members are rows.
+const (
+	UserRoleOwner  = "owner"
+	UserRoleAdmin  = "admin"
+	UserRoleMember = "member"
+)
+
+// OwnerUserID is the user id recorded on sessions and agent sessions that
+// belong to the owner. Empty so pre-multi-user rows backfill to the owner.
+const OwnerUserID = ""
+
+// UserRecord represents a single users row.
+type UserRecord struct {
+	ID           string `json:"id"`
+	Username     string `json:"username"`
+	DisplayName  string `json:"displayName"`
+	PasswordHash string `json:"-"` // never serialize
+	Role         string `json:"role"`
+	DataRoot     string `json:"dataRoot"` // USER_DATA_DIR-relative; '' = whole data dir
+	CreatedAt    int64  `json:"createdAt"`
+	UpdatedAt    int64  `json:"updatedAt"`
+	DisabledAt   *int64 `json:"disabledAt,omitempty"`
+}
+
+// OwnerUser returns the synthetic record for the owner account.
+func OwnerUser() *UserRecord {
+	return &UserRecord{ID: OwnerUserID, Username: "owner", Role: UserRoleOwner}
+}
+
+// IsOwner reports whether u is the implicit owner account.
+func (u *UserRecord) IsOwner() bool {
+	return u.Role == UserRoleOwner
+}
+
+// IsAdmin reports whether u may manage other users (owner or admin).
+func (u *UserRecord) IsAdmin() bool {
+	return u.Role == UserRoleOwner || u.Role == UserRoleAdmin
+}
+
+// CanAccessPath reports whether the USER_DATA_DIR-relative path p lies
+// inside the user's data root. An empty data root grants the whole tree.
+// The root folder itself ("" or "/") is only accessible to unscoped users.
+func (u *UserRecord) CanAccessPath(p string) bool {
+	root := NormalizeDataRoot(u.DataRoot)
+	if root == "" {
+		return true
+	}
+	p = strings.Trim(path.Clean("/"+p), "/")
+	return p == root || strings.HasPrefix(p, root+"/")
+}
+
+// NormalizeDataRoot cleans a data root into the canonical "a/b" form (no
+// leading/trailing slash, "" for the whole data dir).
+func NormalizeDataRoot(root string) string {
+	root = strings.Trim(path.Clean("/"+strings.TrimSpace(root)), "/")
+	if root == "." {
+		return ""
+	}
+	return root
+}
+
+const userColumns = `id, username, display_name, password_hash, role, data_root, created_at, updated_at, disabled_at`
+
+func scanUser(row interface{ Scan(...any) error }) (*UserRecord, error) {
+	var u UserRecord
+	var disabledAt sql.NullInt64
+	if err := row.Scan(&u.ID, &u.Username, &u.DisplayName, &u.PasswordHash, &u.Role, &u.DataRoot, &u.CreatedAt, &u.UpdatedAt, &disabledAt); err != nil {
+		return nil, err
+	}
+	u.DisabledAt = IntPtr(disabledAt)
+	return &u, nil
+}
+
+// CreateUser inserts a new user. passwordHash is the already-hashed password.
+func (d *DB) CreateUser(ctx context.Context, username, displayName, passwordHash, role, dataRoot string) (*UserRecord, error) {
+	u := &UserRecord{
+		ID:           uuid.New().String(),
+		Username:     username,
+		DisplayName:  displayName,
+		PasswordHash: passwordHash,
+		Role:         role,
+		DataRoot:     NormalizeDataRoot(dataRoot),
+		CreatedAt:    NowMs(),
+	}
+	u.UpdatedAt = u.CreatedAt
+	if err := d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`INSERT INTO users (id, username, display_name, password_hash, role, data_root, created_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			u.ID, u.Username, u.DisplayName, u.PasswordHash, u.Role, u.DataRoot, u.CreatedAt, u.UpdatedAt,
+		)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// GetUser fetches a user by id. Returns nil if not found.
+func (d *DB) GetUser(id string) (*UserRecord, error) {
+	u, err := scanUser(d.conn.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return u, err
+}
+
+// GetUserByUsername fetches a user by case-insensitive username. Returns nil
+// if not found.
+func (d *DB) GetUserByUsername(username string) (*UserRecord, error) {
+	u, err := scanUser(d.conn.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = ?`, username))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return u, err
+}
+
+// ListUsers returns all users ordered by creation time.
+func (d *DB) ListUsers() ([]UserRecord, error) {
+	rows, err := d.conn.Query(`SELECT ` + userColumns + ` FROM users ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []UserRecord
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// UpdateUser persists the mutable fields of u (display name, password hash,
+// role, data root, disabled state).
+func (d *DB) UpdateUser(ctx context.Context, u *UserRecord) error {
+	u.DataRoot = NormalizeDataRoot(u.DataRoot)
+	u.UpdatedAt = NowMs()
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`UPDATE users SET display_name = ?, password_hash = ?, role = ?, data_root = ?, disabled_at = ?, updated_at = ?
+			 WHERE id = ?`,
+			u.DisplayName, u.PasswordHash, u.Role, u.DataRoot, u.DisabledAt, u.UpdatedAt, u.ID,
+		)
+		return err
+	})
+}
+
+// DeleteUser removes a user, all of their login sessions and the share
+// links they made. Agent sessions keep their user_id so history stays
+// attributable.
+func (d *DB) DeleteUser(ctx context.Context, id string) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM file_shares WHERE user_id = ?`, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM users WHERE id = ?`, id)
+		return err
+	})
+}
+
+// DeleteUserSessions revokes every login session of a user (used when the
+// account is disabled or its password changes).
+func (d *DB) DeleteUserSessions(ctx context.Context, userID string) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+		return err
+	})
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUserRecord_CanAccessPath(t *testing.T) {
+	cases := []struct {
+		root, path string
+		want       bool
+	}{
+		{"", "anything/at/all", true},
+		{"", "", true},
+		{"family/alice", "family/alice", true},
+		{"family/alice", "family/alice/notes/a.md", true},
+		{"family/alice", "/family/alice/notes/a.md", true},
+		{"/family/alice/", "family/alice/x", true},
+		{"family/alice", "family/alicex/a.md", false},
+		{"family/alice", "family", false},
+		{"family/alice", "", false},
+		{"family/alice", "family/alice/../bob/a.md", false},
+	}
+	for _, tc := range cases {
+		u := &UserRecord{Role: UserRoleMember, DataRoot: tc.root}
+		if got := u.CanAccessPath(tc.path); got != tc.want {
+			t.Errorf("root=%q path=%q: got %v, want %v", tc.root, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestUsers_CRUDAndSessionAttribution(t *testing.T) {
+	d := openTestAppDB(t)
+	ctx := context.Background()
+
+	u, err := d.CreateUser(ctx, "Alice", "Alice A.", "hash1", UserRoleMember, "/family/alice/")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if u.DataRoot != "family/alice" {
+		t.Fatalf("data root not normalized: %q", u.DataRoot)
+	}
+
+	got, err := d.GetUserByUsername("alice")
+	if err != nil || got == nil {
+		t.Fatalf("GetUserByUsername (case-insensitive): %v, %v", got, err)
+	}
+	if got.ID != u.ID || got.PasswordHash != "hash1" {
+		t.Fatalf("unexpected user: %+v", got)
+	}
+
+	if _, err := d.CreateSession(ctx, "tok-alice", u.ID); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	sess, err := d.GetSession("tok-alice")
+	if err != nil || sess == nil || sess.UserID != u.ID {
+		t.Fatalf("session not attributed to user: %+v, %v", sess, err)
+	}
+
+	if err := d.CreateAgentSession(ctx, "a1", "claude_code", "/tmp", "", "user", "", "", "", "stor1", u.ID); err != nil {
+		t.Fatalf("CreateAgentSession: %v", err)
+	}
+	if err := d.CreateAgentSession(ctx, "o1", "claude_code", "/tmp", "", "user", "", "", "", "stor2", OwnerUserID); err != nil {
+		t.Fatalf("CreateAgentSession: %v", err)
+	}
+	mine, err := d.ListAgentSessions(false, 0, 0, &u.ID)
+	if err != nil {
+		t.Fatalf("ListAgentSessions: %v", err)
+	}
+	if len(mine) != 1 || mine[0].SessionID != "a1" || mine[0].UserID != u.ID {
+		t.Fatalf("expected only a1 for user, got %+v", mine)
+	}
+	all, err := d.ListAgentSessions(false, 0, 0, nil)
+	if err != nil || len(all) != 2 {
+		t.Fatalf("expected 2 sessions unfiltered, got %d (%v)", len(all), err)
+	}
+
+	if err := d.CreateFileShare(ctx, &FileShareRecord{Token: "share-alice", Path: "members/alice", IsFolder: true, Mode: FileShareModeRead, UserID: u.ID}); err != nil {
+		t.Fatalf("CreateFileShare: %v", err)
+	}
+
+	if err := d.DeleteUser(ctx, u.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if share, _ := d.GetFileShare("share-alice"); share != nil {
+		t.Fatalf("expected share link to be revoked with the user")
+	}
+	if sess, _ := d.GetSession("tok-alice"); sess != nil {
+		t.Fatalf("expected login session to be revoked with the user")
+	}
+	if gone, _ := d.GetUser(u.ID); gone != nil {
+		t.Fatalf("expected user to be deleted")
+	}
+}
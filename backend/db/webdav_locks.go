@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// WebDAVLockRecord is a persisted WebDAV lock.
+type WebDAVLockRecord struct {
+	Token      string
+	Root       string
+	OwnerXML   string
+	ZeroDepth  bool
+	DurationMs int64
+	ExpiresAt  int64
+	CreatedAt  int64
+}
+
+// ListWebDAVLocks returns locks that have not expired as of nowMs.
+func (d *DB) ListWebDAVLocks(nowMs int64) ([]WebDAVLockRecord, error) {
+	rows, err := d.conn.Query(
+		`SELECT token, root, owner_xml, zero_depth, duration_ms, expires_at, created_at
+		 FROM webdav_locks WHERE expires_at > ? ORDER BY created_at`,
+		nowMs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locks []WebDAVLockRecord
+	for rows.Next() {
+		var r WebDAVLockRecord
+		var zeroDepth int
+		if err := rows.Scan(&r.Token, &r.Root, &r.OwnerXML, &zeroDepth, &r.DurationMs, &r.ExpiresAt, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.ZeroDepth = zeroDepth == 1
+		locks = append(locks, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return locks, nil
+}
+
+// SaveWebDAVLock inserts a lock, or updates its timeout on refresh.
+func (d *DB) SaveWebDAVLock(ctx context.Context, r *WebDAVLockRecord) error {
+	if r.CreatedAt == 0 {
+		r.CreatedAt = NowMs()
+	}
+	zeroDepth := 0
+	if r.ZeroDepth {
+		zeroDepth = 1
+	}
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`INSERT INTO webdav_locks (token, root, owner_xml, zero_depth, duration_ms, expires_at, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT(token) DO UPDATE SET duration_ms = excluded.duration_ms, expires_at = excluded.expires_at`,
+			r.Token, r.Root, r.OwnerXML, zeroDepth, r.DurationMs, r.ExpiresAt, r.CreatedAt,
+		)
+		return err
+	})
+}
+
+// DeleteWebDAVLock removes a lock (UNLOCK, or expiry noticed in memory).
+func (d *DB) DeleteWebDAVLock(ctx context.Context, token string) error {
+	return d.Write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM webdav_locks WHERE token = ?`, token)
+		return err
+	})
+}
+
+// DeleteExpiredWebDAVLocks sweeps locks that expired at or before nowMs.
+func (d *DB) DeleteExpiredWebDAVLocks(ctx context.Context, nowMs int64) (int64, error) {
+	var n int64
+	err := d.Write(ctx, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM webdav_locks WHERE expires_at <= ?`, nowMs)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return n, err
+}
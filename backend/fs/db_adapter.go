@@ -84,11 +84,51 @@ func (a *dbAdapter) DeleteFilesWithCascadePrefix(pathPrefix string) error {
 	return a.indexDB.DeleteFilesWithCascadePrefix(context.Background(), pathPrefix)
 }
 
+// GetScanDir returns the scan snapshot of a directory, nil if it has none
+func (a *dbAdapter) GetScanDir(path string) (*db.ScanDir, error) {
+	return a.indexDB.GetScanDir(path)
+}
+
+// ListScanDirs returns the scan snapshots of the directories inside parent
+func (a *dbAdapter) ListScanDirs(parent string) ([]db.ScanDir, error) {
+	return a.indexDB.ListScanDirs(parent)
+}
+
+// SaveScanDirs records directory snapshots
+func (a *dbAdapter) SaveScanDirs(dirs []db.ScanDir) error {
+	return a.indexDB.SaveScanDirs(context.Background(), dirs)
+}
+
+// DeleteScanDirs forgets the snapshot of a directory and everything below it
+func (a *dbAdapter) DeleteScanDirs(path string) error {
+	return a.indexDB.DeleteScanDirs(context.Background(), path)
+}
+
+// ListIndexedChildren returns the indexed files and directories directly in dir
+func (a *dbAdapter) ListIndexedChildren(dir string) ([]string, []string, error) {
+	return a.indexDB.ListIndexedChildren(dir)
+}
+
+// SaveScanReport records the outcome of a scan
+func (a *dbAdapter) SaveScanReport(r *db.ScanReport) error {
+	return a.indexDB.SaveScanReport(context.Background(), r)
+}
+
+// ListScanReports returns the most recent scan reports
+func (a *dbAdapter) ListScanReports(limit int) ([]db.ScanReport, error) {
+	return a.indexDB.ListScanReports(limit)
+}
+
 // GetFilesMissingPreviews returns files that need preview generation
 func (a *dbAdapter) GetFilesMissingPreviews(limit int) ([]db.FileWithMime, error) {
 	return a.indexDB.GetFilesMissingPreviews(limit)
 }
 
+// GetImagesMissingPhash returns thumbnailed images without a perceptual hash
+func (a *dbAdapter) GetImagesMissingPhash(limit int) ([]db.FileWithMime, error) {
+	return a.indexDB.GetImagesMissingPhash(limit)
+}
+
 // SqlarStore stores data in the SQLAR table
 func (a *dbAdapter) SqlarStore(name string, data []byte, mode int) bool {
 	return a.indexDB.SqlarStore(context.Background(), name, data, mode)
@@ -98,3 +138,18 @@ func (a *dbAdapter) SqlarStore(name string, data []byte, mode int) bool {
 func (a *dbAdapter) SqlarExists(name string) bool {
 	return a.indexDB.SqlarExists(name)
 }
+
+// SqlarGet returns the data stored under name, or nil
+func (a *dbAdapter) SqlarGet(name string) []byte {
+	return a.indexDB.SqlarGet(name)
+}
+
+// SqlarList lists the SQLAR entries under prefix
+func (a *dbAdapter) SqlarList(prefix string) []db.SqlarFileInfo {
+	return a.indexDB.SqlarList(prefix)
+}
+
+// SqlarDelete removes an entry from the SQLAR table
+func (a *dbAdapter) SqlarDelete(name string) bool {
+	return a.indexDB.SqlarDelete(context.Background(), name)
+}
@@ -15,9 +15,20 @@ var (
 	// ErrFileTooLarge is returned when a file exceeds max size
 	ErrFileTooLarge = errors.New("file too large")
 
+	// ErrQuotaExceeded is returned when a write would push a folder past
+	// its storage quota
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+
 	// ErrNotDirectory is returned when operation requires a directory
 	ErrNotDirectory = errors.New("not a directory")
 
 	// ErrIsDirectory is returned when operation requires a file
 	ErrIsDirectory = errors.New("is a directory")
+
+	// ErrInvalidMount is returned when a mounted folder is misconfigured
+	ErrInvalidMount = errors.New("invalid mounted folder")
+
+	// ErrMountPoint is returned when an operation would move or delete a
+	// mounted folder (or a folder holding one) instead of its contents
+	ErrMountPoint = errors.New("path is or holds a mounted folder")
 )
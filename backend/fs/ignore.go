@@ -0,0 +1,288 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// IgnoreFileName is the per-directory ignore file. It uses gitignore
+// syntax; patterns are relative to the directory holding the file.
+const IgnoreFileName = ".mldbignore"
+
+// Ignore rule sources, in increasing order of precedence. Within
+// .mldbignore files, deeper files take precedence over shallower ones and
+// later lines over earlier ones, as with .gitignore.
+const (
+	IgnoreSourceBuiltin  = "builtin"
+	IgnoreSourceSettings = "settings"
+	IgnoreSourceFile     = "file"
+)
+
+// IgnoreMatch explains why a path is (or is not) ignored.
+type IgnoreMatch struct {
+	Ignored     bool   `json:"ignored"`
+	Source      string `json:"source,omitempty"`      // builtin, settings or file
+	File        string `json:"file,omitempty"`        // data-root-relative .mldbignore (source "file")
+	Line        int    `json:"line,omitempty"`        // 1-based line in File
+	Pattern     string `json:"pattern,omitempty"`     // the rule as written
+	MatchedPath string `json:"matchedPath,omitempty"` // path the rule matched: the path itself or an ancestor folder
+}
+
+// ignoreRule is one compiled gitignore pattern.
+type ignoreRule struct {
+	pattern string // as written, for explanations
+	line    int
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp // matched against the path relative to the rule's base
+}
+
+// ignoreRules is the rule list of one source (one .mldbignore or the
+// settings list), anchored at base ("" = data root).
+type ignoreRules struct {
+	base   string
+	source string
+	file   string
+	rules  []ignoreRule
+}
+
+// parseIgnoreRules compiles gitignore-syntax lines. Invalid patterns are
+// dropped.
+func parseIgnoreRules(data []byte) []ignoreRule {
+	var rules []ignoreRule
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		if r, ok := compileIgnorePattern(sc.Text()); ok {
+			r.line = n
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+func compileIgnorePattern(line string) (ignoreRule, bool) {
+	raw := strings.TrimSuffix(line, "\r")
+	p := raw
+	// Trailing spaces are ignored unless escaped with a backslash.
+	for strings.HasSuffix(p, " ") && !strings.HasSuffix(p, `\ `) {
+		p = p[:len(p)-1]
+	}
+	if p == "" || strings.HasPrefix(p, "#") {
+		return ignoreRule{}, false
+	}
+	r := ignoreRule{pattern: p}
+	if strings.HasPrefix(p, "!") {
+		r.negate = true
+		p = p[1:]
+	} else if strings.HasPrefix(p, `\!`) || strings.HasPrefix(p, `\#`) {
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		r.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	if p == "" {
+		return ignoreRule{}, false
+	}
+	// A slash anywhere but the end anchors the pattern to its base;
+	// otherwise it matches at any depth.
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case strings.HasPrefix(p[i:], "**/") && (i == 0 || p[i-1] == '/'):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**") && i+2 == len(p) && (i == 0 || p[i-1] == '/'):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(p[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := p[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(p):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(p[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	r.re = re
+	return r, true
+}
+
+// ignoreMatcher evaluates the built-in skip names, the settings-level
+// patterns and every .mldbignore on the way to a path. .mldbignore files
+// are read lazily, one directory at a time, and cached until the watcher
+// reports a change (invalidate).
+type ignoreMatcher struct {
+	root *libraryRoot
+
+	mu       sync.RWMutex
+	settings *ignoreRules
+	files    map[string]*ignoreRules // dir → rules; nil entry = no ignore file
+}
+
+func newIgnoreMatcher(root *libraryRoot) *ignoreMatcher {
+	return &ignoreMatcher{root: root, files: make(map[string]*ignoreRules)}
+}
+
+// setPatterns replaces the settings-level patterns (anchored at the data
+// root, like a root .mldbignore).
+func (m *ignoreMatcher) setPatterns(patterns []string) {
+	rules := &ignoreRules{source: IgnoreSourceSettings}
+	for i, p := range patterns {
+		if r, ok := compileIgnorePattern(p); ok {
+			r.line = i + 1
+			rules.rules = append(rules.rules, r)
+		}
+	}
+	m.mu.Lock()
+	m.settings = rules
+	m.mu.Unlock()
+}
+
+// invalidate drops the cached rules of dir and every directory below it.
+func (m *ignoreMatcher) invalidate(dir string) {
+	dir = strings.Trim(filepath.ToSlash(dir), "/")
+	if dir == "." {
+		dir = ""
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for d := range m.files {
+		if dir == "" || d == dir || strings.HasPrefix(d, dir+"/") {
+			delete(m.files, d)
+		}
+	}
+}
+
+// rulesFor returns the (cached) .mldbignore rules of dir.
+func (m *ignoreMatcher) rulesFor(dir string) *ignoreRules {
+	m.mu.RLock()
+	rules, ok := m.files[dir]
+	m.mu.RUnlock()
+	if ok {
+		return rules
+	}
+
+	file := path.Join(dir, IgnoreFileName)
+	data, err := os.ReadFile(m.root.abs(file))
+	if err == nil {
+		rules = &ignoreRules{base: dir, source: IgnoreSourceFile, file: file, rules: parseIgnoreRules(data)}
+	}
+	m.mu.Lock()
+	m.files[dir] = rules
+	m.mu.Unlock()
+	return rules
+}
+
+// match explains whether rel (a data-root-relative path) is ignored.
+// isDir reports whether rel itself is a directory; it is only called when
+// a directory-only rule would decide the outcome.
+//
+// As in git, a path is ignored if any ancestor folder is, and a negation
+// can't re-include a path whose parent folder is ignored.
+func (m *ignoreMatcher) match(rel string, isDir func() bool) IgnoreMatch {
+	rel = strings.Trim(filepath.ToSlash(rel), "/")
+	if rel == "" || rel == "." {
+		return IgnoreMatch{}
+	}
+	parts := strings.Split(rel, "/")
+
+	m.mu.RLock()
+	settings := m.settings
+	m.mu.RUnlock()
+
+	// Sources in increasing precedence: settings, then .mldbignore files
+	// from the root down. Each directory's file only applies below it.
+	sources := make([]*ignoreRules, 0, len(parts)+1)
+	if settings != nil {
+		sources = append(sources, settings)
+	}
+	for i := 0; i < len(parts); i++ {
+		if rules := m.rulesFor(strings.Join(parts[:i], "/")); rules != nil {
+			sources = append(sources, rules)
+		}
+	}
+
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		last := i == len(parts)-1
+		if indexSkipNames[parts[i]] || parts[i] == TrashDir {
+			return IgnoreMatch{Ignored: true, Source: IgnoreSourceBuiltin, Pattern: parts[i], MatchedPath: prefix}
+		}
+		prefixIsDir := func() bool { return !last || (isDir != nil && isDir()) }
+
+		var decided *IgnoreMatch
+		for _, src := range sources {
+			if src.base != "" && !strings.HasPrefix(prefix, src.base+"/") {
+				continue
+			}
+			relToBase := strings.TrimPrefix(prefix, src.base+"/")
+			if src.base == "" {
+				relToBase = prefix
+			}
+			for _, r := range src.rules {
+				if !r.re.MatchString(relToBase) {
+					continue
+				}
+				if r.dirOnly && !prefixIsDir() {
+					continue
+				}
+				decided = &IgnoreMatch{
+					Ignored:     !r.negate,
+					Source:      src.source,
+					File:        src.file,
+					Line:        r.line,
+					Pattern:     r.pattern,
+					MatchedPath: prefix,
+				}
+			}
+		}
+		if decided != nil && (decided.Ignored || last) {
+			return *decided
+		}
+	}
+	return IgnoreMatch{}
+}
+
+// ignoreRulesChanged re-applies the ignore rules after the settings list
+// or a .mldbignore changed. A debounced rescan drops newly ignored files
+// from the index (reconcile treats them as orphans) and picks up newly
+// un-ignored ones.
+func (s *Service) ignoreRulesChanged() {
+	if s.scanner != nil {
+		s.scanner.requestRescan("rules", true)
+	}
+}
@@ -0,0 +1,146 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeIgnoreTestFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	full := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompileIgnorePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.cr2", "raw.cr2", true},
+		{"*.cr2", "photos/2024/raw.cr2", true},
+		{"*.cr2", "photos/raw.jpg", false},
+		{"saves", "games/elden/saves", true},
+		{"/saves", "saves", true},
+		{"/saves", "games/saves", false},
+		{"games/*/saves", "games/elden/saves", true},
+		{"games/*/saves", "games/a/b/saves", false},
+		{"games/**/saves", "games/a/b/saves", true},
+		{"games/**/saves", "games/saves", true},
+		{"**/cache", "a/b/cache", true},
+		{"raw/**", "raw/x/y.cr2", true},
+		{"img?.png", "img1.png", true},
+		{"img?.png", "img10.png", false},
+		{"[ab].txt", "a.txt", true},
+		{"[!ab].txt", "a.txt", false},
+		{`\#notes`, "#notes", true},
+	}
+	for _, tt := range tests {
+		r, ok := compileIgnorePattern(tt.pattern)
+		if !ok {
+			t.Fatalf("compileIgnorePattern(%q) failed", tt.pattern)
+		}
+		if got := r.re.MatchString(tt.path); got != tt.want {
+			t.Errorf("pattern %q on %q = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+
+	for _, p := range []string{"", "   ", "# comment", "!", "/"} {
+		if _, ok := compileIgnorePattern(p); ok {
+			t.Errorf("compileIgnorePattern(%q) should produce no rule", p)
+		}
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	root := t.TempDir()
+	writeIgnoreTestFile(t, root, IgnoreFileName, "*.cr2\nbuild/\n")
+	writeIgnoreTestFile(t, root, "photos/"+IgnoreFileName, "!keep.cr2\n/tmp\n")
+	if err := os.MkdirAll(filepath.Join(root, "code", "build"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeIgnoreTestFile(t, root, "notes/build", "a file named build")
+
+	m := newIgnoreMatcher(newLibraryRoot(root))
+	m.setPatterns([]string{"games/*/saves/"})
+	isDir := func(rel string) func() bool {
+		return func() bool {
+			info, err := os.Stat(filepath.Join(root, rel))
+			return err == nil && info.IsDir()
+		}
+	}
+
+	tests := []struct {
+		path    string
+		ignored bool
+		source  string
+	}{
+		{"photos/a.cr2", true, IgnoreSourceFile},
+		{"photos/keep.cr2", false, IgnoreSourceFile}, // negated by the deeper file
+		{"other/keep.cr2", true, IgnoreSourceFile},
+		{"photos/tmp/x.jpg", true, IgnoreSourceFile}, // anchored to photos/
+		{"tmp/x.jpg", false, ""},
+		{"code/build/out.bin", true, IgnoreSourceFile},
+		{"notes/build", false, ""}, // dir-only rule, plain file
+		{"games/elden/saves/slot1.sav", true, IgnoreSourceSettings},
+		{"games/elden/config.ini", false, ""},
+		{"proj/node_modules/x.js", true, IgnoreSourceBuiltin},
+		{".trash/20260101-000000/notes/a.md", true, IgnoreSourceBuiltin},
+		{"members/ann/.trash/20260101-000000.000/a.md", true, IgnoreSourceBuiltin}, // a member's trash
+		{"notes/today.md", false, ""},
+	}
+	for _, tt := range tests {
+		got := m.match(tt.path, isDir(tt.path))
+		if got.Ignored != tt.ignored || got.Source != tt.source {
+			t.Errorf("match(%q) = %+v, want ignored=%v source=%q", tt.path, got, tt.ignored, tt.source)
+		}
+	}
+
+	got := m.match("photos/a.cr2", nil)
+	if got.File != IgnoreFileName || got.Line != 1 || got.Pattern != "*.cr2" || got.MatchedPath != "photos/a.cr2" {
+		t.Errorf("explanation = %+v", got)
+	}
+}
+
+func TestIgnoreMatcher_ParentExclusionWins(t *testing.T) {
+	root := t.TempDir()
+	writeIgnoreTestFile(t, root, IgnoreFileName, "raw/\n!raw/keep.txt\n")
+	if err := os.MkdirAll(filepath.Join(root, "raw"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newIgnoreMatcher(newLibraryRoot(root))
+	// As in git, a file can't be re-included once its folder is ignored.
+	if got := m.match("raw/keep.txt", nil); !got.Ignored || got.MatchedPath != "raw" {
+		t.Errorf("match(raw/keep.txt) = %+v, want ignored via raw", got)
+	}
+}
+
+func TestIgnoreMatcher_Invalidate(t *testing.T) {
+	root := t.TempDir()
+	m := newIgnoreMatcher(newLibraryRoot(root))
+
+	if m.match("a/b.log", nil).Ignored {
+		t.Fatal("nothing should be ignored yet")
+	}
+	writeIgnoreTestFile(t, root, "a/"+IgnoreFileName, "*.log\n")
+	if m.match("a/b.log", nil).Ignored {
+		t.Fatal("the missing file should stay cached until invalidated")
+	}
+	m.invalidate("a")
+	if !m.match("a/b.log", nil).Ignored {
+		t.Error("a/b.log should be ignored after invalidate")
+	}
+
+	writeIgnoreTestFile(t, root, IgnoreFileName, "a/\n")
+	m.invalidate(".")
+	if got := m.match("a/c.txt", nil); !got.Ignored || got.File != IgnoreFileName {
+		t.Errorf("match(a/c.txt) = %+v, want ignored by the root file", got)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package fs
+
+import "os"
+
+// fileInode returns 0: inode numbers are not exposed on this platform, so
+// directory snapshots compare mtimes only.
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
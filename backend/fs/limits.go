@@ -0,0 +1,62 @@
+package fs
+
+import (
+	"io"
+)
+
+// writeLimits returns the limits for a write to path that replaces a file
+// of replacedSize bytes. The replaced bytes are freed by the write, so
+// they count toward what the quota folder has left.
+func (s *Service) writeLimits(path string, replacedSize int64) (WriteLimits, bool) {
+	if s.cfg.WriteLimits == nil {
+		return WriteLimits{}, false
+	}
+	limits := s.cfg.WriteLimits(path)
+	if limits.QuotaFolder != "" {
+		limits.QuotaLeft += replacedSize
+	}
+	return limits, limits.MaxFileSize > 0 || limits.QuotaFolder != ""
+}
+
+// CheckWriteSize reports whether a write of size bytes to path would be
+// rejected, so handlers that know the length up front (Content-Length,
+// Upload-Length) can fail before reading the body. WriteFile enforces the
+// same limits while streaming regardless.
+func (s *Service) CheckWriteSize(path string, size int64) error {
+	var replaced int64
+	if existing, _ := s.cfg.DB.GetFileByPath(path); existing != nil && existing.Size != nil {
+		replaced = *existing.Size
+	}
+	limits, ok := s.writeLimits(path, replaced)
+	if !ok {
+		return nil
+	}
+	return limits.check(size)
+}
+
+func (l WriteLimits) check(size int64) error {
+	if l.MaxFileSize > 0 && size > l.MaxFileSize {
+		return ErrFileTooLarge
+	}
+	if l.QuotaFolder != "" && size > l.QuotaLeft {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// limitedReader fails with ErrFileTooLarge or ErrQuotaExceeded as soon as
+// more bytes than the limits allow have been read.
+type limitedReader struct {
+	r      io.Reader
+	limits WriteLimits
+	n      int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if limitErr := l.limits.check(l.n); limitErr != nil {
+		return n, limitErr
+	}
+	return n, err
+}
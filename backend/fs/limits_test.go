@@ -0,0 +1,38 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLimitedReader(t *testing.T) {
+	cases := []struct {
+		name    string
+		limits  WriteLimits
+		size    int
+		wantErr error
+	}{
+		{"unlimited", WriteLimits{}, 1000, nil},
+		{"at max size", WriteLimits{MaxFileSize: 100}, 100, nil},
+		{"over max size", WriteLimits{MaxFileSize: 100}, 101, ErrFileTooLarge},
+		{"within quota", WriteLimits{QuotaFolder: "imports", QuotaLeft: 100}, 100, nil},
+		{"over quota", WriteLimits{QuotaFolder: "imports", QuotaLeft: 100}, 101, ErrQuotaExceeded},
+		{"quota already exhausted", WriteLimits{QuotaFolder: "imports", QuotaLeft: -5}, 1, ErrQuotaExceeded},
+		{"empty write with exhausted quota", WriteLimits{QuotaFolder: "imports", QuotaLeft: -5}, 0, ErrQuotaExceeded},
+		{"size checked before quota", WriteLimits{MaxFileSize: 10, QuotaFolder: "imports", QuotaLeft: 5}, 20, ErrFileTooLarge},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &limitedReader{r: strings.NewReader(strings.Repeat("x", tc.size)), limits: tc.limits}
+			_, err := io.Copy(io.Discard, r)
+			if tc.wantErr == nil && err != nil {
+				t.Fatalf("got %v, want nil", err)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package fs
+
+import (
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// Mount maps a directory outside the data root into the library at Path,
+// a data-root-relative path. Its files are indexed, watched and served
+// under Path like any other; on disk they stay in Source.
+type Mount struct {
+	Path   string `json:"path"`
+	Source string `json:"source"`
+}
+
+// libraryRoot maps library paths (relative to the data root, slash- or
+// OS-separated) to paths on disk and back: the data root, with the mounted
+// folders layered over it. A mounted folder shadows anything at its path
+// in the data root.
+type libraryRoot struct {
+	dataRoot string
+	// canonRoot is dataRoot with symlinks resolved, for containment checks
+	// on resolved symlink targets.
+	canonRoot string
+	mounts    atomic.Pointer[[]mountPoint] // longest Path first
+}
+
+type mountPoint struct {
+	Mount
+	canon string // Source with symlinks resolved
+}
+
+func newLibraryRoot(dataRoot string) *libraryRoot {
+	r := &libraryRoot{dataRoot: dataRoot, canonRoot: canonicalPath(dataRoot)}
+	r.mounts.Store(&[]mountPoint{})
+	return r
+}
+
+// canonicalPath resolves symlinks in p, falling back to the cleaned path
+// when it does not exist (yet).
+func canonicalPath(p string) string {
+	if c, err := filepath.EvalSymlinks(p); err == nil {
+		return c
+	}
+	return filepath.Clean(p)
+}
+
+// within reports whether p is dir or below it (both cleaned, absolute).
+func within(dir, p string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// libraryPath normalizes rel to the slash-separated form without leading
+// or trailing slashes ("" for the root).
+func libraryPath(rel string) string {
+	rel = strings.Trim(filepath.ToSlash(rel), "/")
+	if rel == "." {
+		return ""
+	}
+	return rel
+}
+
+// mountFor returns the mounted folder holding rel and rel's path inside
+// it.
+func (r *libraryRoot) mountFor(rel string) (mountPoint, string, bool) {
+	rel = libraryPath(rel)
+	for _, m := range *r.mounts.Load() {
+		if rel == m.Path {
+			return m, "", true
+		}
+		if rest, ok := strings.CutPrefix(rel, m.Path+"/"); ok {
+			return m, rest, true
+		}
+	}
+	return mountPoint{}, "", false
+}
+
+// abs returns where the library path rel lives on disk.
+func (r *libraryRoot) abs(rel string) string {
+	if m, rest, ok := r.mountFor(rel); ok {
+		return filepath.Join(m.Source, filepath.FromSlash(rest))
+	}
+	return filepath.Join(r.dataRoot, rel)
+}
+
+// rel maps a path on disk back to its library path, as filepath.Rel from
+// the data root would ("." for the root). ok is false outside the library.
+func (r *libraryRoot) rel(abs string) (string, bool) {
+	for _, m := range *r.mounts.Load() {
+		if within(m.Source, abs) {
+			inside, err := filepath.Rel(m.Source, abs)
+			if err != nil {
+				return "", false
+			}
+			return filepath.Join(filepath.FromSlash(m.Path), inside), true
+		}
+	}
+	rel, err := filepath.Rel(r.dataRoot, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// isMountPoint reports whether rel is the path of a mounted folder.
+func (r *libraryRoot) isMountPoint(rel string) bool {
+	m, rest, ok := r.mountFor(rel)
+	return ok && rest == "" && m.Path != ""
+}
+
+// holdsMount reports whether rel is a mounted folder or a folder of the
+// data root with one somewhere below it.
+func (r *libraryRoot) holdsMount(rel string) bool {
+	rel = libraryPath(rel)
+	for _, m := range *r.mounts.Load() {
+		if rel == "" || m.Path == rel || strings.HasPrefix(m.Path, rel+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// mountsIn returns the mounted folders directly inside the library
+// folder dir, by name.
+func (r *libraryRoot) mountsIn(dir string) map[string]Mount {
+	dir = libraryPath(dir)
+	var in map[string]Mount
+	for _, m := range *r.mounts.Load() {
+		parent := path.Dir(m.Path)
+		if parent == "." {
+			parent = ""
+		}
+		// A mount inside another mounted folder is rejected by
+		// validateMounts, so dir is always a data-root folder here.
+		if parent == dir {
+			if in == nil {
+				in = make(map[string]Mount)
+			}
+			in[path.Base(m.Path)] = m.Mount
+		}
+	}
+	return in
+}
+
+// contains reports whether the resolved path canon lies in the data root
+// or a mounted folder, i.e. is indexed under a library path of its own.
+func (r *libraryRoot) contains(canon string) bool {
+	if within(r.canonRoot, canon) {
+		return true
+	}
+	for _, m := range *r.mounts.Load() {
+		if within(m.canon, canon) {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the mounted folders, ordered by path.
+func (r *libraryRoot) list() []Mount {
+	mounts := *r.mounts.Load()
+	out := make([]Mount, 0, len(mounts))
+	for _, m := range mounts {
+		out = append(out, m.Mount)
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Path < out[k].Path })
+	return out
+}
+
+// setMounts replaces the mounted folders after validateMounts.
+func (r *libraryRoot) setMounts(mounts []Mount) error {
+	mounts, err := validateMounts(r.canonRoot, mounts)
+	if err != nil {
+		return err
+	}
+	points := make([]mountPoint, len(mounts))
+	for i, m := range mounts {
+		points[i] = mountPoint{Mount: m, canon: canonicalPath(m.Source)}
+	}
+	sort.Slice(points, func(i, k int) bool { return len(points[i].Path) > len(points[k].Path) })
+	r.mounts.Store(&points)
+	return nil
+}
+
+// validateMounts normalizes mounted folders and checks that they fit
+// together: absolute sources outside the data root (which would index
+// files twice, or loop), and neither paths nor sources nested in one
+// another. It does not require the sources to exist — a disk that is not
+// attached right now keeps its folder configured, and its files indexed.
+func validateMounts(canonRoot string, mounts []Mount) ([]Mount, error) {
+	out := make([]Mount, 0, len(mounts))
+	for _, m := range mounts {
+		p := filepath.ToSlash(m.Path)
+		if strings.Contains(p, "..") {
+			return nil, fmt.Errorf("%w: path %q must stay inside the library", ErrInvalidMount, m.Path)
+		}
+		// A leading slash is the library root, not the server's
+		p = libraryPath(path.Clean("/" + p))
+		if p == "" {
+			return nil, fmt.Errorf("%w: path is required", ErrInvalidMount)
+		}
+		if isTrashPath(p) {
+			return nil, fmt.Errorf("%w: %q is inside the trash", ErrInvalidMount, p)
+		}
+		if !filepath.IsAbs(m.Source) {
+			return nil, fmt.Errorf("%w: source of %q must be an absolute path", ErrInvalidMount, p)
+		}
+		src := filepath.Clean(m.Source)
+		if canon := canonicalPath(src); within(canonRoot, canon) || within(canon, canonRoot) {
+			return nil, fmt.Errorf("%w: source of %q overlaps the data directory", ErrInvalidMount, p)
+		}
+		for _, o := range out {
+			if o.Path == p || strings.HasPrefix(p, o.Path+"/") || strings.HasPrefix(o.Path, p+"/") {
+				return nil, fmt.Errorf("%w: %q and %q are nested", ErrInvalidMount, o.Path, p)
+			}
+			if a, b := canonicalPath(o.Source), canonicalPath(src); within(a, b) || within(b, a) {
+				return nil, fmt.Errorf("%w: sources of %q and %q overlap", ErrInvalidMount, o.Path, p)
+			}
+		}
+		out = append(out, Mount{Path: p, Source: src})
+	}
+	return out, nil
+}
+
+// ResolvePath returns where the library path rel lives on disk: in the
+// data root, or in the source of the mounted folder holding it. rel must
+// already be validated.
+func (s *Service) ResolvePath(rel string) string {
+	return s.root.abs(rel)
+}
+
+// Mounts returns the mounted folders.
+func (s *Service) Mounts() []Mount {
+	return s.root.list()
+}
+
+// CheckMounts validates mounted folders for saving: on top of what
+// SetMounts accepts, each source must be a directory right now, and the
+// folder it is mounted in must exist while its own path does not.
+func (s *Service) CheckMounts(mounts []Mount) ([]Mount, error) {
+	mounts, err := validateMounts(s.root.canonRoot, mounts)
+	if err != nil {
+		return nil, err
+	}
+	current := s.root.mountsByPath()
+	for _, m := range mounts {
+		if info, err := os.Stat(m.Source); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("%w: source of %q is not a directory", ErrInvalidMount, m.Path)
+		}
+		if parent := path.Dir(m.Path); parent != "." {
+			if info, err := os.Stat(filepath.Join(s.cfg.DataRoot, filepath.FromSlash(parent))); err != nil || !info.IsDir() {
+				return nil, fmt.Errorf("%w: folder %q does not exist", ErrInvalidMount, parent)
+			}
+		}
+		if _, mounted := current[m.Path]; !mounted {
+			if _, err := os.Lstat(filepath.Join(s.cfg.DataRoot, filepath.FromSlash(m.Path))); err == nil {
+				return nil, fmt.Errorf("%w: %q already exists in the library", ErrInvalidMount, m.Path)
+			}
+		}
+	}
+	return mounts, nil
+}
+
+// mountsByPath returns the current mounted folders keyed by path.
+func (r *libraryRoot) mountsByPath() map[string]Mount {
+	byPath := make(map[string]Mount)
+	for _, m := range *r.mounts.Load() {
+		byPath[m.Path] = m.Mount
+	}
+	return byPath
+}
+
+// SetMounts replaces the mounted folders. Removed ones drop out of the
+// index and new ones are indexed by a full scan, scheduled here; the
+// watcher starts watching new sources right away.
+func (s *Service) SetMounts(mounts []Mount) error {
+	before := s.root.mountsByPath()
+	if err := s.root.setMounts(mounts); err != nil {
+		return err
+	}
+	after := s.root.mountsByPath()
+	changed := len(before) != len(after)
+	for p, m := range after {
+		if before[p] != m {
+			changed = true
+			if s.watcher != nil && s.watcher.watcher != nil {
+				if err := s.watcher.watchRecursive(m.Source); err != nil {
+					log.Warn().Err(err).Str("path", p).Msg("failed to watch mounted folder")
+				}
+			}
+		}
+	}
+	if changed && s.scanner != nil {
+		s.scanner.requestRescan("mounts", true)
+	}
+	return nil
+}
+
+// MountsIn returns the mounted folders directly inside the library folder
+// dir, by name.
+func (s *Service) MountsIn(dir string) map[string]Mount {
+	return s.root.mountsIn(dir)
+}
+
+// FollowSymlinks reports whether the scanner follows symlinks.
+func (s *Service) FollowSymlinks() bool {
+	return s.followSymlinks.Load()
+}
+
+// SetFollowSymlinks turns symlink following on or off, rescanning the
+// library when that changes what it holds.
+func (s *Service) SetFollowSymlinks(follow bool) {
+	if s.followSymlinks.Swap(follow) != follow && s.scanner != nil {
+		s.scanner.requestRescan("symlinks", true)
+	}
+}
+
+// ReadDir lists the library folder rel: its entries on disk, with the
+// mounted folders inside it in place of anything at their paths. Entries
+// are sorted by name.
+func (s *Service) ReadDir(rel string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(s.root.abs(rel))
+	if err != nil {
+		return nil, err
+	}
+	mounts := s.root.mountsIn(rel)
+	if len(mounts) == 0 {
+		return entries, nil
+	}
+	merged := entries[:0]
+	for _, e := range entries {
+		if _, shadowed := mounts[e.Name()]; !shadowed {
+			merged = append(merged, e)
+		}
+	}
+	for name, m := range mounts {
+		merged = append(merged, mountDirEntry{name: name, source: m.Source})
+	}
+	sort.Slice(merged, func(i, k int) bool { return merged[i].Name() < merged[k].Name() })
+	return merged, nil
+}
+
+// mountDirEntry is a mounted folder as an entry of the folder holding it.
+type mountDirEntry struct {
+	name   string
+	source string
+}
+
+func (e mountDirEntry) Name() string        { return e.name }
+func (e mountDirEntry) IsDir() bool         { return true }
+func (e mountDirEntry) Type() iofs.FileMode { return iofs.ModeDir }
+func (e mountDirEntry) Info() (iofs.FileInfo, error) {
+	info, err := os.Stat(e.source)
+	if err != nil {
+		return nil, err
+	}
+	return namedFileInfo{FileInfo: info, name: e.name}, nil
+}
+
+// namedFileInfo reports a directory under the name it has in the library.
+type namedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi namedFileInfo) Name() string { return fi.name }
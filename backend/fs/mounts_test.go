@@ -0,0 +1,129 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLibraryRoot_MapsMountedFolders(t *testing.T) {
+	dataRoot, ext := t.TempDir(), t.TempDir()
+	r := newLibraryRoot(dataRoot)
+	if err := r.setMounts([]Mount{{Path: "/media/disk/", Source: ext}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for rel, want := range map[string]string{
+		"":                 dataRoot,
+		"notes/a.md":       filepath.Join(dataRoot, "notes", "a.md"),
+		"media":            filepath.Join(dataRoot, "media"),
+		"media/disk":       ext,
+		"media/disk/x.jpg": filepath.Join(ext, "x.jpg"),
+		"media/diskette":   filepath.Join(dataRoot, "media", "diskette"),
+	} {
+		if got := r.abs(rel); got != want {
+			t.Errorf("abs(%q) = %q, want %q", rel, got, want)
+		}
+	}
+
+	for abs, want := range map[string]string{
+		dataRoot:                            ".",
+		filepath.Join(dataRoot, "notes"):    "notes",
+		ext:                                 filepath.Join("media", "disk"),
+		filepath.Join(ext, "2024", "x.jpg"): filepath.Join("media", "disk", "2024", "x.jpg"),
+	} {
+		if got, ok := r.rel(abs); !ok || got != want {
+			t.Errorf("rel(%q) = %q, %v; want %q", abs, got, ok, want)
+		}
+	}
+	if got, ok := r.rel(filepath.Dir(dataRoot)); ok {
+		t.Errorf("rel(parent of data root) = %q, want outside the library", got)
+	}
+
+	if !r.isMountPoint("media/disk") || r.isMountPoint("media") || r.isMountPoint("media/disk/2024") {
+		t.Error("isMountPoint misreports media/disk and its neighbours")
+	}
+	for rel, want := range map[string]bool{"": true, "media": true, "media/disk": true, "media/disk/2024": false, "notes": false} {
+		if got := r.holdsMount(rel); got != want {
+			t.Errorf("holdsMount(%q) = %v, want %v", rel, got, want)
+		}
+	}
+	if in := r.mountsIn("media"); len(in) != 1 || in["disk"].Source != ext {
+		t.Errorf("mountsIn(media) = %v", in)
+	}
+}
+
+func TestValidateMounts(t *testing.T) {
+	dataRoot, ext := t.TempDir(), t.TempDir()
+	canonRoot := canonicalPath(dataRoot)
+	for _, dir := range []string{filepath.Join(dataRoot, "sub"), filepath.Join(ext, "sub")} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		mounts []Mount
+	}{
+		{"empty path", []Mount{{Path: "/", Source: ext}}},
+		{"climbs out", []Mount{{Path: "../x", Source: ext}}},
+		{"relative source", []Mount{{Path: "x", Source: "disk"}}},
+		{"in the trash", []Mount{{Path: TrashDir + "/x", Source: ext}}},
+		{"source in the data root", []Mount{{Path: "x", Source: filepath.Join(dataRoot, "sub")}}},
+		{"source holds the data root", []Mount{{Path: "x", Source: filepath.Dir(dataRoot)}}},
+		{"nested paths", []Mount{{Path: "x", Source: ext}, {Path: "x/y", Source: t.TempDir()}}},
+		{"overlapping sources", []Mount{{Path: "x", Source: ext}, {Path: "y", Source: filepath.Join(ext, "sub")}}},
+	} {
+		if _, err := validateMounts(canonRoot, tc.mounts); !errors.Is(err, ErrInvalidMount) {
+			t.Errorf("%s: err = %v, want ErrInvalidMount", tc.name, err)
+		}
+	}
+
+	// A missing source is fine: the disk may come back.
+	got, err := validateMounts(canonRoot, []Mount{{Path: "a/b/", Source: ext + "/"}, {Path: "c", Source: ext + "-gone"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Path != "a/b" || got[0].Source != ext {
+		t.Errorf("normalized mount = %+v", got[0])
+	}
+}
+
+func TestService_ReadDirMergesMountedFolders(t *testing.T) {
+	dataRoot, ext := t.TempDir(), t.TempDir()
+	writeScanFile(t, dataRoot, "a.md", "a")
+	writeScanFile(t, dataRoot, "disk/hidden.md", "shadowed by the mount")
+	writeScanFile(t, ext, "x.jpg", "x")
+	s := NewService(Config{DataRoot: dataRoot, DB: newScanDB(), Mounts: []Mount{{Path: "disk", Source: ext}}})
+
+	entries, err := s.ReadDir("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, ",") != "a.md,disk" {
+		t.Errorf("ReadDir(root) = %v", names)
+	}
+	if info, err := entries[1].Info(); err != nil || !info.IsDir() || info.Name() != "disk" {
+		t.Errorf("mount entry info = %v, %v", info, err)
+	}
+	if inside, err := s.ReadDir("disk"); err != nil || len(inside) != 1 || inside[0].Name() != "x.jpg" {
+		t.Errorf("ReadDir(disk) = %v, %v", inside, err)
+	}
+
+	if err := s.DeleteFolder(t.Context(), "disk"); !errors.Is(err, ErrMountPoint) {
+		t.Errorf("DeleteFolder(mount) = %v, want ErrMountPoint", err)
+	}
+	if err := s.RenameOrMove(t.Context(), "disk", "elsewhere"); !errors.Is(err, ErrMountPoint) {
+		t.Errorf("RenameOrMove(mount) = %v, want ErrMountPoint", err)
+	}
+	if _, err := os.Stat(filepath.Join(ext, "x.jpg")); err != nil {
+		t.Errorf("mounted source was touched: %v", err)
+	}
+}
@@ -22,7 +22,7 @@ type moveDetector struct {
 	recentRenames map[string]renameInfo
 	mu            sync.Mutex
 	ttl           time.Duration
-	dataRoot      string // For file size comparison
+	root          *libraryRoot // For file size comparison
 }
 
 // renameInfo stores information about a recent RENAME event
@@ -34,12 +34,12 @@ type renameInfo struct {
 
 // newMoveDetector creates a move detector with specified TTL
 // TTL is how long we remember a RENAME before considering it expired
-// dataRoot is used to look up file sizes for better matching accuracy
-func newMoveDetector(ttl time.Duration, dataRoot string) *moveDetector {
+// root is used to look up file sizes for better matching accuracy (nil skips it)
+func newMoveDetector(ttl time.Duration, root *libraryRoot) *moveDetector {
 	return &moveDetector{
 		recentRenames: make(map[string]renameInfo),
 		ttl:           ttl,
-		dataRoot:      dataRoot,
+		root:          root,
 	}
 }
 
@@ -79,8 +79,8 @@ func (m *moveDetector) CheckMove(newPath string) (oldPath string, isMove bool) {
 
 	// Get size of new file for comparison
 	var newSize int64
-	if m.dataRoot != "" {
-		if info, err := os.Stat(filepath.Join(m.dataRoot, newPath)); err == nil {
+	if m.root != nil {
+		if info, err := os.Stat(m.root.abs(newPath)); err == nil {
 			newSize = info.Size()
 		}
 	}
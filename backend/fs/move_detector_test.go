@@ -6,7 +6,7 @@ import (
 )
 
 func TestMoveDetector_SameFilename(t *testing.T) {
-	md := newMoveDetector(500*time.Millisecond, "")
+	md := newMoveDetector(500*time.Millisecond, nil)
 
 	// Track a rename (size 0 means unknown)
 	md.TrackRename("inbox/document.md", 0)
@@ -24,7 +24,7 @@ func TestMoveDetector_SameFilename(t *testing.T) {
 }
 
 func TestMoveDetector_DifferentFilename(t *testing.T) {
-	md := newMoveDetector(500*time.Millisecond, "")
+	md := newMoveDetector(500*time.Millisecond, nil)
 
 	// Track a rename
 	md.TrackRename("inbox/document.md", 0)
@@ -38,7 +38,7 @@ func TestMoveDetector_DifferentFilename(t *testing.T) {
 }
 
 func TestMoveDetector_TTLExpiry(t *testing.T) {
-	md := newMoveDetector(50*time.Millisecond, "")
+	md := newMoveDetector(50*time.Millisecond, nil)
 
 	// Track a rename
 	md.TrackRename("inbox/document.md", 0)
@@ -55,7 +55,7 @@ func TestMoveDetector_TTLExpiry(t *testing.T) {
 }
 
 func TestMoveDetector_MultipleRenames(t *testing.T) {
-	md := newMoveDetector(500*time.Millisecond, "")
+	md := newMoveDetector(500*time.Millisecond, nil)
 
 	// Track multiple renames
 	md.TrackRename("inbox/file1.md", 0)
@@ -87,7 +87,7 @@ func TestMoveDetector_MultipleRenames(t *testing.T) {
 }
 
 func TestMoveDetector_SameDirectoryRename(t *testing.T) {
-	md := newMoveDetector(500*time.Millisecond, "")
+	md := newMoveDetector(500*time.Millisecond, nil)
 
 	// Track a rename (same directory, same filename - shouldn't match)
 	md.TrackRename("notes/old-name.md", 0)
@@ -101,7 +101,7 @@ func TestMoveDetector_SameDirectoryRename(t *testing.T) {
 }
 
 func TestMoveDetector_ExactFilenameMatch(t *testing.T) {
-	md := newMoveDetector(500*time.Millisecond, "")
+	md := newMoveDetector(500*time.Millisecond, nil)
 
 	// Track renames with similar filenames
 	md.TrackRename("inbox/test.md", 0)
@@ -116,7 +116,7 @@ func TestMoveDetector_ExactFilenameMatch(t *testing.T) {
 }
 
 func TestMoveDetector_Clear(t *testing.T) {
-	md := newMoveDetector(500*time.Millisecond, "")
+	md := newMoveDetector(500*time.Millisecond, nil)
 
 	md.TrackRename("inbox/file1.md", 0)
 	md.TrackRename("inbox/file2.md", 0)
@@ -139,7 +139,7 @@ func TestMoveDetector_Clear(t *testing.T) {
 }
 
 func TestMoveDetector_NoRenameTracked(t *testing.T) {
-	md := newMoveDetector(500*time.Millisecond, "")
+	md := newMoveDetector(500*time.Millisecond, nil)
 
 	// Check for move without any renames tracked
 	_, isMove := md.CheckMove("notes/document.md")
@@ -150,7 +150,7 @@ func TestMoveDetector_NoRenameTracked(t *testing.T) {
 }
 
 func TestMoveDetector_DuplicateRename(t *testing.T) {
-	md := newMoveDetector(500*time.Millisecond, "")
+	md := newMoveDetector(500*time.Millisecond, nil)
 
 	// Track the same path twice
 	md.TrackRename("inbox/file.md", 0)
@@ -169,7 +169,7 @@ func TestMoveDetector_DuplicateRename(t *testing.T) {
 }
 
 func TestMoveDetector_CleanupOnCheck(t *testing.T) {
-	md := newMoveDetector(50*time.Millisecond, "")
+	md := newMoveDetector(50*time.Millisecond, nil)
 
 	// Track multiple renames
 	md.TrackRename("inbox/old1.md", 0)
@@ -191,7 +191,7 @@ func TestMoveDetector_CleanupOnCheck(t *testing.T) {
 }
 
 func TestMoveDetector_MostRecentMatch(t *testing.T) {
-	md := newMoveDetector(500*time.Millisecond, "")
+	md := newMoveDetector(500*time.Millisecond, nil)
 
 	// Track two renames with the same filename from different directories
 	md.TrackRename("inbox/document.md", 0)
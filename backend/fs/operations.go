@@ -2,12 +2,15 @@ package fs
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/xiaoyuanzhu-com/my-life-db/db"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
@@ -33,8 +36,17 @@ func (s *Service) writeFile(ctx context.Context, req WriteRequest) (*WriteResult
 		oldHash = *existing.Hash
 	}
 
-	// 4. Write to filesystem
-	fullPath := filepath.Join(s.cfg.DataRoot, req.Path)
+	// 4. Write to filesystem, enforcing size limits and quotas while
+	// streaming (the temp file is discarded if they are exceeded)
+	content := req.Content
+	var replacedSize int64
+	if existing != nil && existing.Size != nil {
+		replacedSize = *existing.Size
+	}
+	if limits, ok := s.writeLimits(req.Path, replacedSize); ok {
+		content = &limitedReader{r: content, limits: limits}
+	}
+	fullPath := s.root.abs(req.Path)
 
 	// Ensure parent directory exists
 	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
@@ -42,7 +54,7 @@ func (s *Service) writeFile(ctx context.Context, req WriteRequest) (*WriteResult
 	}
 
 	// Write file atomically (write to temp, then rename)
-	if err := s.writeFileAtomic(fullPath, req.Content); err != nil {
+	if err := s.writeFileAtomic(fullPath, content, req.ModTime); err != nil {
 		return nil, fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -71,10 +83,12 @@ func (s *Service) writeFile(ctx context.Context, req WriteRequest) (*WriteResult
 			}
 		} else {
 			// Asynchronous: compute metadata in background and persist to DB.
-			// Captures req.Path, req.Source, and oldHash for the goroutine.
+			// Captures req.Path, req.Source, oldHash and whether a record
+			// existed for the goroutine.
 			asyncPath := req.Path
 			asyncSource := req.Source
 			asyncOldHash := oldHash
+			asyncIsNew := existing == nil
 			s.wg.Add(1)
 			go func() {
 				defer s.wg.Done()
@@ -109,7 +123,7 @@ func (s *Service) writeFile(ctx context.Context, req WriteRequest) (*WriteResult
 				if contentChanged {
 					s.notifyFileChange(FileChangeEvent{
 						FilePath:       asyncPath,
-						IsNew:          true,
+						IsNew:          asyncIsNew,
 						ContentChanged: true,
 						Trigger:        asyncSource,
 					})
@@ -187,7 +201,7 @@ func (s *Service) readFile(ctx context.Context, path string) (io.ReadCloser, err
 	}
 
 	// 3. Open file from filesystem
-	fullPath := filepath.Join(s.cfg.DataRoot, path)
+	fullPath := s.root.abs(path)
 	file, err := os.Open(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -214,7 +228,7 @@ func (s *Service) deleteFile(ctx context.Context, path string) error {
 	defer mu.Unlock()
 
 	// 3. Delete from filesystem
-	fullPath := filepath.Join(s.cfg.DataRoot, path)
+	fullPath := s.root.abs(path)
 	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete file from filesystem: %w", err)
 	}
@@ -258,8 +272,8 @@ func (s *Service) moveFile(ctx context.Context, src, dst string) error {
 	}
 
 	// 4. Move on filesystem
-	srcFullPath := filepath.Join(s.cfg.DataRoot, src)
-	dstFullPath := filepath.Join(s.cfg.DataRoot, dst)
+	srcFullPath := s.root.abs(src)
+	dstFullPath := s.root.abs(dst)
 
 	// Ensure destination directory exists
 	if err := os.MkdirAll(filepath.Dir(dstFullPath), 0755); err != nil {
@@ -311,9 +325,13 @@ func (s *Service) renameOrMove(ctx context.Context, oldPath, newPath string) err
 	if err := s.ValidatePath(newPath); err != nil {
 		return fmt.Errorf("invalid destination path: %w", err)
 	}
+	// Mounted folders are moved in settings, not on disk
+	if s.root.holdsMount(oldPath) || s.root.isMountPoint(newPath) {
+		return ErrMountPoint
+	}
 
 	// 2. Check source exists and determine if it's a directory
-	oldFullPath := filepath.Join(s.cfg.DataRoot, oldPath)
+	oldFullPath := s.root.abs(oldPath)
 	info, err := os.Stat(oldFullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -324,13 +342,18 @@ func (s *Service) renameOrMove(ctx context.Context, oldPath, newPath string) err
 	isDir := info.IsDir()
 
 	// 3. Ensure destination parent directory exists
-	newFullPath := filepath.Join(s.cfg.DataRoot, newPath)
+	newFullPath := s.root.abs(newPath)
 	if err := os.MkdirAll(filepath.Dir(newFullPath), 0755); err != nil {
 		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
-	// 4. Rename on filesystem
-	if err := os.Rename(oldFullPath, newFullPath); err != nil {
+	// 4. Rename on filesystem (files may cross into or out of a mounted
+	// folder on another file system; folders may not)
+	rename := os.Rename
+	if !isDir {
+		rename = s.renameAcross
+	}
+	if err := rename(oldFullPath, newFullPath); err != nil {
 		return fmt.Errorf("failed to rename: %w", err)
 	}
 
@@ -369,9 +392,14 @@ func (s *Service) deleteFolder(ctx context.Context, path string) error {
 	if err := s.ValidatePath(path); err != nil {
 		return err
 	}
+	// Removing a mounted folder would delete its source; unmount it in
+	// settings instead
+	if s.root.holdsMount(path) {
+		return ErrMountPoint
+	}
 
 	// 2. Delete from filesystem
-	fullPath := filepath.Join(s.cfg.DataRoot, path)
+	fullPath := s.root.abs(path)
 	if err := os.RemoveAll(fullPath); err != nil {
 		return fmt.Errorf("failed to delete folder from filesystem: %w", err)
 	}
@@ -398,7 +426,7 @@ func (s *Service) createFolder(ctx context.Context, path string) error {
 	}
 
 	// 2. Create on filesystem
-	fullPath := filepath.Join(s.cfg.DataRoot, path)
+	fullPath := s.root.abs(path)
 	if err := os.MkdirAll(fullPath, 0755); err != nil {
 		return fmt.Errorf("failed to create folder: %w", err)
 	}
@@ -448,7 +476,7 @@ func (s *Service) buildFileRecord(path string, info os.FileInfo, metadata *Metad
 	}
 
 	// Set preview_status to pending for previewable file types
-	if needsPreview(mimeType) {
+	if s.preview.accepts(mimeType) {
 		pending := db.PreviewStatusPending
 		record.PreviewStatus = &pending
 	}
@@ -456,8 +484,9 @@ func (s *Service) buildFileRecord(path string, info os.FileInfo, metadata *Metad
 	return record
 }
 
-// writeFileAtomic writes content to a file atomically (write to temp, then rename)
-func (s *Service) writeFileAtomic(path string, content io.Reader) error {
+// writeFileAtomic writes content to a file atomically (write to temp, then rename).
+// A non-zero modTime is stamped on the file before it becomes visible.
+func (s *Service) writeFileAtomic(path string, content io.Reader, modTime time.Time) error {
 	// Create temp file in same directory (ensures same filesystem for atomic rename)
 	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
 	if err != nil {
@@ -488,6 +517,12 @@ func (s *Service) writeFileAtomic(path string, content io.Reader) error {
 		return err
 	}
 
+	if !modTime.IsZero() {
+		if err := os.Chtimes(tmpPath, modTime, modTime); err != nil {
+			return err
+		}
+	}
+
 	// Atomic rename
 	if err := os.Rename(tmpPath, path); err != nil {
 		return err
@@ -498,6 +533,20 @@ func (s *Service) writeFileAtomic(path string, content io.Reader) error {
 	return nil
 }
 
+// renameAcross renames the file src to dst, falling back to copy and
+// remove when they are on different file systems (a mounted folder and the
+// data root, say).
+func (s *Service) renameAcross(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := s.copyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
 // copyFile copies a file from src to dst
 func (s *Service) copyFile(src, dst string) error {
 	srcFile, err := os.Open(src)
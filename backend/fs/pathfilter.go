@@ -17,6 +17,9 @@ import (
 // dist/, build/, out/, target/ — these often hold user-meaningful
 // artifacts and aren't always large).
 //
+// Users exclude their own folders with .mldbignore files and the
+// settings-level pattern list (ignore.go), not by growing this map.
+//
 // Each entry below is annotated with: what tool produces it, and the
 // typical total size / file count we'd otherwise drag through FTS.
 var indexSkipNames = map[string]bool{
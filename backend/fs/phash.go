@@ -0,0 +1,101 @@
+package fs
+
+import (
+	"image"
+	"math/bits"
+
+	"golang.org/x/image/draw"
+)
+
+// MaxPhashDistance is the largest Hamming distance SimilarGroups accepts.
+// Beyond about 10 of 64 bits dHash matches stop meaning "the same
+// picture", and since groups chain transitively a loose threshold merges
+// unrelated images into a few huge groups. It also keeps the bands used to
+// find candidates at 5 bits or more, so bucket sizes stay manageable.
+const MaxPhashDistance = 10
+
+// perceptualHash computes a 64-bit difference hash (dHash) of img: the
+// image is shrunk to 9x8 grayscale and each bit records whether a pixel is
+// brighter than its right neighbour. Re-encodes, resizes and small edits
+// keep most bits, so near-identical pictures land a few bits apart.
+func perceptualHash(img image.Image) uint64 {
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	// BiLinear is a kernel scaler: it averages the whole source area
+	// behind each output pixel instead of point-sampling it.
+	draw.BiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small.GrayAt(x, y).Y > small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// SimilarGroups clusters perceptual hashes that are within maxDistance bits
+// of each other (transitively) and returns the clusters of two or more as
+// index lists into hashes, in input order.
+//
+// Candidates are found by splitting the hash into maxDistance+1 bands:
+// two hashes differing in at most maxDistance bits must agree exactly on
+// at least one band, so only hashes sharing a band are compared.
+func SimilarGroups(hashes []uint64, maxDistance int) [][]int {
+	maxDistance = max(0, min(maxDistance, MaxPhashDistance))
+	parent := make([]int, len(hashes))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	bands := maxDistance + 1
+	for b := 0; b < bands; b++ {
+		lo, hi := b*64/bands, (b+1)*64/bands
+		mask := uint64(1)<<(hi-lo) - 1
+		buckets := map[uint64][]int{}
+		for i, h := range hashes {
+			key := h >> lo & mask
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, members := range buckets {
+			for x := 0; x < len(members); x++ {
+				for y := x + 1; y < len(members); y++ {
+					i, j := members[x], members[y]
+					if bits.OnesCount64(hashes[i]^hashes[j]) > maxDistance {
+						continue
+					}
+					if ri, rj := find(i), find(j); ri != rj {
+						parent[max(ri, rj)] = min(ri, rj)
+					}
+				}
+			}
+		}
+	}
+
+	byRoot := map[int][]int{}
+	var roots []int
+	for i := range hashes {
+		r := find(i)
+		if _, ok := byRoot[r]; !ok {
+			roots = append(roots, r)
+		}
+		byRoot[r] = append(byRoot[r], i)
+	}
+	var groups [][]int
+	for _, r := range roots {
+		if len(byRoot[r]) > 1 {
+			groups = append(groups, byRoot[r])
+		}
+	}
+	return groups
+}
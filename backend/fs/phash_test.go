@@ -0,0 +1,71 @@
+package fs
+
+import (
+	"image"
+	"image/color"
+	"math/bits"
+	"reflect"
+	"testing"
+)
+
+// gradient draws a diagonal gradient with a dark square, scaled to w x h.
+func gradient(w, h int, shift uint8) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8((x*200/w + y*55/h)) + shift
+			if x > w/4 && x < w/2 && y > h/4 && y < h/2 {
+				v = 10
+			}
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func TestPerceptualHash_StableAcrossResize(t *testing.T) {
+	a := perceptualHash(gradient(640, 480, 0))
+	b := perceptualHash(gradient(160, 120, 0))
+	c := perceptualHash(gradient(640, 480, 20)) // brightened
+	if d := bits.OnesCount64(a ^ b); d > 4 {
+		t.Errorf("resized copy is %d bits away", d)
+	}
+	if d := bits.OnesCount64(a ^ c); d > 4 {
+		t.Errorf("brightened copy is %d bits away", d)
+	}
+
+	flipped := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	src := gradient(640, 480, 0)
+	for y := 0; y < 480; y++ {
+		for x := 0; x < 640; x++ {
+			flipped.Set(639-x, y, src.At(x, y))
+		}
+	}
+	if d := bits.OnesCount64(a ^ perceptualHash(flipped)); d <= MaxPhashDistance {
+		t.Errorf("mirrored image is only %d bits away", d)
+	}
+}
+
+func TestSimilarGroups(t *testing.T) {
+	hashes := []uint64{
+		0x0000000000000000,
+		0xffffffffffffffff,
+		0x0000000000000007, // 3 bits from [0]
+		0x00000000000000ff, // 5 bits from [2]: joins through it at distance 5
+		0xfffffffffffffffe, // 1 bit from [1]
+		0x0f0f0f0f0f0f0f0f, // far from everything
+	}
+
+	if got, want := SimilarGroups(hashes, 3), [][]int{{0, 2}, {1, 4}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("distance 3 = %v, want %v", got, want)
+	}
+	if got, want := SimilarGroups(hashes, 5), [][]int{{0, 2, 3}, {1, 4}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("distance 5 = %v, want %v", got, want)
+	}
+	if got := SimilarGroups(hashes, 0); got != nil {
+		t.Errorf("distance 0 = %v, want none", got)
+	}
+	if got, want := SimilarGroups([]uint64{42, 42}, 0), [][]int{{0, 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("identical hashes = %v, want %v", got, want)
+	}
+}
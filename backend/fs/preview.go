@@ -3,24 +3,20 @@ package fs
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/gen2brain/heic"
 	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/jobs"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 	"golang.org/x/image/draw"
-
-	// Register WebP decoder so image.Decode can handle it
-	_ "golang.org/x/image/webp"
 )
 
 // Preview worker constants
@@ -28,12 +24,41 @@ const (
 	previewQueueSize  = 100
 	thumbnailMaxWidth = 1200
 	thumbnailQuality  = 85
+	// previewTimeout bounds one file's trip through the generators.
+	previewTimeout = 60 * time.Second
+)
+
+// PreviewGenerator renders a preview image for the MIME types it accepts.
+// The worker tries the generators that accept a file in order until one
+// succeeds, then scales the image to a thumbnail and stores it.
+//
+// A generator that has nothing to show for a particular file returns an
+// error wrapping ErrNoPreview; one whose external tool is missing, an
+// error wrapping ErrGeneratorUnavailable. Both let the next generator try,
+// and if none succeeds the file is marked unsupported rather than failed.
+type PreviewGenerator interface {
+	// Name identifies the generator in logs and recorded reasons.
+	Name() string
+	// Accepts reports whether the generator handles mimeType.
+	Accepts(mimeType string) bool
+	// Generate renders a preview of the file at fullPath (absolute).
+	Generate(ctx context.Context, fullPath, mimeType string) (image.Image, error)
+}
+
+// Job queue kinds for preview work (see Config.Jobs).
+const (
+	PreviewJobKind = "preview"
+	PhashJobKind   = "phash"
 )
 
 // previewJob represents a file that needs preview generation
 type previewJob struct {
 	filePath string
 	mimeType string
+	// phashOnly computes the perceptual hash of an image that already has
+	// a thumbnail (files indexed before phash existed) without storing a
+	// new one.
+	phashOnly bool
 }
 
 // PreviewNotifier is called after a preview is generated for a file.
@@ -42,16 +67,22 @@ type PreviewNotifier func(filePath string, previewType string)
 
 // previewWorker processes files asynchronously to generate previews
 type previewWorker struct {
-	service  *Service
-	queue    chan previewJob
-	notifier PreviewNotifier
+	service    *Service
+	queue      chan previewJob
+	notifier   PreviewNotifier
+	generators []PreviewGenerator
 }
 
 // ---------- MIME type helpers ----------
 
-// needsPreview returns true for MIME types that support preview generation
-func needsPreview(mimeType string) bool {
-	return isImageMime(mimeType) || isDocumentMime(mimeType)
+// accepts returns true for MIME types some generator can preview
+func (w *previewWorker) accepts(mimeType string) bool {
+	for _, g := range w.generators {
+		if g.Accepts(mimeType) {
+			return true
+		}
+	}
+	return false
 }
 
 // isImageMime returns true for image/* MIME types
@@ -81,12 +112,17 @@ func isDocumentMime(mimeType string) bool {
 
 // ---------- Worker lifecycle ----------
 
-// newPreviewWorker creates a preview worker owned by the given service
-func newPreviewWorker(service *Service, notifier PreviewNotifier) *previewWorker {
+// newPreviewWorker creates a preview worker owned by the given service.
+// nil generators means DefaultPreviewGenerators.
+func newPreviewWorker(service *Service, notifier PreviewNotifier, generators []PreviewGenerator) *previewWorker {
+	if generators == nil {
+		generators = DefaultPreviewGenerators()
+	}
 	return &previewWorker{
-		service:  service,
-		queue:    make(chan previewJob, previewQueueSize),
-		notifier: notifier,
+		service:    service,
+		queue:      make(chan previewJob, previewQueueSize),
+		notifier:   notifier,
+		generators: generators,
 	}
 }
 
@@ -94,13 +130,22 @@ func newPreviewWorker(service *Service, notifier PreviewNotifier) *previewWorker
 // Intended to be called as a goroutine.
 func (w *previewWorker) run() {
 	for job := range w.queue {
-		w.processJob(job)
+		_ = w.processJob(context.Background(), job)
 	}
 }
 
-// enqueue sends a preview job to the worker. Non-blocking: if the queue is
-// full the job is dropped and a warning is logged.
-func (w *previewWorker) enqueue(job previewJob) {
+// enqueue schedules a preview job. With a job queue configured the job is
+// persisted there; otherwise it goes to the in-memory channel without
+// blocking, and is dropped with a warning if the channel is full.
+func (w *previewWorker) enqueue(job previewJob, priority int) {
+	if q := w.service.cfg.Jobs; q != nil {
+		kind := PreviewJobKind
+		if job.phashOnly {
+			kind = PhashJobKind
+		}
+		q.Enqueue(kind, job.filePath, priority)
+		return
+	}
 	select {
 	case w.queue <- job:
 		// queued
@@ -114,58 +159,58 @@ func (w *previewWorker) enqueue(job previewJob) {
 
 // ---------- Preview generation dispatch ----------
 
-// processJob dispatches to the correct generator based on MIME type,
-// stores the result in SQLAR, and updates the file record.
-func (w *previewWorker) processJob(job previewJob) {
+// processJob runs the generators for the file's MIME type, stores the
+// thumbnail in SQLAR, and updates the file record. The error is for the
+// job queue's retries: a failed generation (recorded on the file as
+// failed) or a failed store; files with no preview to show are not errors.
+func (w *previewWorker) processJob(ctx context.Context, job previewJob) error {
 	// Check if file still exists before attempting generation
-	fullPath := filepath.Join(w.service.cfg.DataRoot, job.filePath)
+	fullPath := w.service.root.abs(job.filePath)
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
 		log.Info().
 			Str("path", job.filePath).
 			Msg("skipping preview for missing file")
-		return
+		return nil
 	}
 
-	var data []byte
-	var err error
-	var previewType string
-	var sqlarName string
-
-	pathHash := db.GeneratePathHash(job.filePath)
-
-	switch {
-	case isImageMime(job.mimeType):
-		previewType = "thumbnail"
-		sqlarName = pathHash + "/preview/thumbnail.jpg"
-		data, err = w.generateImageThumbnail(job.filePath, job.mimeType)
-
-	case isDocumentMime(job.mimeType):
-		previewType = "thumbnail"
-		sqlarName = pathHash + "/preview/thumbnail.jpg"
-		data, err = w.generateDocumentPreview(job.filePath)
-
-	default:
-		return
+	if job.phashOnly {
+		return w.processPhashJob(job)
 	}
 
+	const previewType = "thumbnail"
+	sqlarName := db.GeneratePathHash(job.filePath) + "/preview/thumbnail.jpg"
+
+	data, phash, err := w.generate(ctx, job)
 	if err != nil {
-		log.Error().Err(err).
-			Str("path", job.filePath).
-			Str("mime", job.mimeType).
-			Msg("preview generation failed")
+		status := db.PreviewStatusFailed
+		if errors.Is(err, ErrNoPreview) || errors.Is(err, ErrGeneratorUnavailable) {
+			status = db.PreviewStatusUnsupported
+			log.Info().Err(err).
+				Str("path", job.filePath).
+				Str("mime", job.mimeType).
+				Msg("no preview for file")
+		} else {
+			log.Error().Err(err).
+				Str("path", job.filePath).
+				Str("mime", job.mimeType).
+				Msg("preview generation failed")
+		}
 
-		// Mark as failed so it won't be re-queued every scan cycle
-		if updateErr := w.service.cfg.DB.UpdateFileField(job.filePath, "preview_status", db.PreviewStatusFailed); updateErr != nil {
+		// Record the outcome so the file isn't re-queued every scan cycle
+		if updateErr := w.service.cfg.DB.UpdateFileField(job.filePath, "preview_status", status); updateErr != nil {
 			log.Error().Err(updateErr).
 				Str("path", job.filePath).
-				Msg("failed to update preview_status to failed")
+				Msgf("failed to update preview_status to %s", status)
 		}
-		return
-	}
-
-	// Placeholder generators return nil, nil — nothing to store yet
-	if data == nil {
-		return
+		_ = w.service.cfg.DB.UpdateFileField(job.filePath, "preview_error", err.Error())
+		// A phash from before the content changed no longer describes it
+		if isImageMime(job.mimeType) {
+			_ = w.service.cfg.DB.UpdateFileField(job.filePath, "phash", nil)
+		}
+		if status == db.PreviewStatusUnsupported {
+			return nil
+		}
+		return err
 	}
 
 	// Store in SQLAR
@@ -175,7 +220,7 @@ func (w *previewWorker) processJob(job previewJob) {
 			Str("path", job.filePath).
 			Str("sqlar", sqlarName).
 			Msg("failed to store preview in sqlar")
-		return
+		return fmt.Errorf("store preview %s in sqlar", sqlarName)
 	}
 
 	// Update file record: set sqlar path and status to ready
@@ -183,13 +228,17 @@ func (w *previewWorker) processJob(job previewJob) {
 		log.Error().Err(err).
 			Str("path", job.filePath).
 			Msg("failed to update preview_sqlar field")
-		return
+		return err
 	}
 	if err := w.service.cfg.DB.UpdateFileField(job.filePath, "preview_status", db.PreviewStatusReady); err != nil {
 		log.Error().Err(err).
 			Str("path", job.filePath).
 			Msg("failed to update preview_status to ready")
-		return
+		return err
+	}
+	_ = w.service.cfg.DB.UpdateFileField(job.filePath, "preview_error", nil)
+	if phash != nil {
+		w.storePhash(job.filePath, *phash)
 	}
 
 	log.Info().
@@ -202,6 +251,7 @@ func (w *previewWorker) processJob(job previewJob) {
 	if w.notifier != nil {
 		w.notifier(job.filePath, previewType)
 	}
+	return nil
 }
 
 // ---------- Missing preview catch-up ----------
@@ -209,108 +259,171 @@ func (w *previewWorker) processJob(job previewJob) {
 // queueMissingPreviews finds files with preview_status='pending' and enqueues
 // them for generation. Called by the scanner after each scan cycle.
 func (w *previewWorker) queueMissingPreviews() {
-	files, err := w.service.cfg.DB.GetFilesMissingPreviews(50)
+	// The channel only holds previewQueueSize jobs; a persistent queue
+	// takes the backlog in bigger bites.
+	batch := 50
+	if w.service.cfg.Jobs != nil {
+		batch = 1000
+	}
+
+	files, err := w.service.cfg.DB.GetFilesMissingPreviews(batch)
 	if err != nil {
 		log.Warn().Err(err).Msg("failed to query files missing previews")
 		return
 	}
 
 	for _, f := range files {
-		w.enqueue(previewJob{filePath: f.Path, mimeType: f.MimeType})
+		w.enqueue(previewJob{filePath: f.Path, mimeType: f.MimeType}, jobs.PriorityBackground)
 	}
 
 	if len(files) > 0 {
 		log.Info().Int("count", len(files)).Msg("queued files with missing previews")
 	}
-}
 
-// ---------- Document preview (screenitshot) ----------
-
-// generateDocumentPreview runs screenitshot CLI to produce a PNG screenshot
-// of a document, then resizes and encodes it as a JPEG thumbnail.
-func (w *previewWorker) generateDocumentPreview(filePath string) ([]byte, error) {
-	fullPath := filepath.Join(w.service.cfg.DataRoot, filePath)
-
-	tmpFile, err := os.CreateTemp("", "screenitshot-*.png")
+	// Images thumbnailed before perceptual hashing existed.
+	images, err := w.service.cfg.DB.GetImagesMissingPhash(batch)
 	if err != nil {
-		return nil, fmt.Errorf("create temp file: %w", err)
+		log.Warn().Err(err).Msg("failed to query images missing perceptual hashes")
+		return
+	}
+	for _, f := range images {
+		w.enqueue(previewJob{filePath: f.Path, mimeType: f.MimeType, phashOnly: true}, jobs.PriorityBackground)
+	}
+	if len(images) > 0 {
+		log.Info().Int("count", len(images)).Msg("queued images with missing perceptual hashes")
 	}
-	tmpPath := tmpFile.Name()
-	tmpFile.Close()
-	defer os.Remove(tmpPath)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
+// ---------- Job queue handlers ----------
 
-	cmd := exec.CommandContext(ctx, "screenitshot", fullPath, "-o", tmpPath)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+// RunPreviewJob is the job queue handler for PreviewJobKind: it generates
+// the thumbnail of the file at path.
+func (s *Service) RunPreviewJob(ctx context.Context, path string) error {
+	return s.runPreviewJob(ctx, path, false)
+}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("screenitshot: %w: %s", err, stderr.String())
-	}
+// RunPhashJob is the job queue handler for PhashJobKind: it computes the
+// perceptual hash of an image that already has a thumbnail.
+func (s *Service) RunPhashJob(ctx context.Context, path string) error {
+	return s.runPreviewJob(ctx, path, true)
+}
 
-	f, err := os.Open(tmpPath)
+func (s *Service) runPreviewJob(ctx context.Context, path string, phashOnly bool) error {
+	file, err := s.cfg.DB.GetFileByPath(path)
 	if err != nil {
-		return nil, fmt.Errorf("open screenshot: %w", err)
+		return err
 	}
-	defer f.Close()
+	// Deleted, or no longer something we preview, since it was queued.
+	if file == nil || file.IsFolder || file.MimeType == nil || !s.preview.accepts(*file.MimeType) {
+		return nil
+	}
+	return s.preview.processJob(ctx, previewJob{filePath: path, mimeType: *file.MimeType, phashOnly: phashOnly})
+}
+
+// ---------- Perceptual hash ----------
 
-	img, _, err := image.Decode(f)
+// processPhashJob decodes an image only to compute its perceptual hash.
+// Undecodable images are not retried: the failure is kept in
+// preview_error, which takes them out of GetImagesMissingPhash until the
+// thumbnail is regenerated.
+func (w *previewWorker) processPhashJob(job previewJob) error {
+	img, err := decodeImageFile(w.service.root.abs(job.filePath), job.mimeType)
 	if err != nil {
-		return nil, fmt.Errorf("decode screenshot: %w", err)
+		log.Warn().Err(err).Str("path", job.filePath).Msg("perceptual hash: decode failed")
+		_ = w.service.cfg.DB.UpdateFileField(job.filePath, "preview_error", "perceptual hash: "+err.Error())
+		return nil
 	}
+	w.storePhash(job.filePath, perceptualHash(img))
+	return nil
+}
 
-	// Resize and encode as JPEG thumbnail
-	thumb := resizeToMaxWidth(img, thumbnailMaxWidth)
-	var buf bytes.Buffer
-	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
-		return nil, fmt.Errorf("encode document thumbnail: %w", err)
+// storePhash records an image's perceptual hash; the column holds the
+// uint64 bits as a signed SQLite integer.
+func (w *previewWorker) storePhash(filePath string, phash uint64) {
+	if err := w.service.cfg.DB.UpdateFileField(filePath, "phash", int64(phash)); err != nil {
+		log.Error().Err(err).
+			Str("path", filePath).
+			Msg("failed to update phash")
 	}
-
-	return buf.Bytes(), nil
 }
 
-// ---------- Image thumbnail ----------
-
-// generateImageThumbnail decodes an image file, resizes it to thumbnailMaxWidth,
-// and encodes the result as JPEG.
-func (w *previewWorker) generateImageThumbnail(filePath, mimeType string) ([]byte, error) {
-	fullPath := filepath.Join(w.service.cfg.DataRoot, filePath)
+// ---------- Generation ----------
 
-	f, err := os.Open(fullPath)
+// generate renders the job's file and turns the image into a JPEG
+// thumbnail. For images the perceptual hash of the thumbnail is returned
+// too.
+func (w *previewWorker) generate(ctx context.Context, job previewJob) ([]byte, *uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+	img, err := w.render(ctx, w.service.root.abs(job.filePath), job.mimeType)
 	if err != nil {
-		return nil, fmt.Errorf("open image: %w", err)
-	}
-	defer f.Close()
-
-	var img image.Image
-
-	// HEIC/HEIF needs a dedicated decoder (not registered with image.Decode)
-	if mimeType == "image/heic" || mimeType == "image/heif" {
-		img, err = heic.Decode(f)
-		if err != nil {
-			return nil, fmt.Errorf("decode heic: %w", err)
-		}
-	} else {
-		// For JPEG, PNG, GIF, WebP and anything else with a registered decoder.
-		// GIF decodes to the first frame automatically via image.Decode.
-		img, _, err = image.Decode(f)
-		if err != nil {
-			return nil, fmt.Errorf("decode image (%s): %w", mimeType, err)
-		}
+		return nil, nil, err
 	}
 
-	// Resize
 	thumb := resizeToMaxWidth(img, thumbnailMaxWidth)
+	var phash *uint64
+	if isImageMime(job.mimeType) {
+		h := perceptualHash(thumb)
+		phash = &h
+	}
 
-	// Encode as JPEG
 	var buf bytes.Buffer
 	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
-		return nil, fmt.Errorf("encode jpeg thumbnail: %w", err)
+		return nil, nil, fmt.Errorf("encode jpeg thumbnail: %w", err)
+	}
+	return buf.Bytes(), phash, nil
+}
+
+// render runs the generators that accept mimeType in order and returns
+// the first image produced.
+//
+// When every generator fails, the error of the last one that actually
+// tried (not ErrNoPreview or ErrGeneratorUnavailable) is returned; if none
+// did, the joined reasons are, so the caller can tell "failed" from
+// "unsupported".
+func (w *previewWorker) render(ctx context.Context, fullPath, mimeType string) (image.Image, error) {
+	var failure error
+	var reasons []error
+	for _, g := range w.generators {
+		if !g.Accepts(mimeType) {
+			continue
+		}
+		out, err := generateSafely(ctx, g, fullPath, mimeType)
+		if err == nil && out != nil {
+			return out, nil
+		}
+		if err == nil {
+			err = ErrNoPreview
+		}
+		err = fmt.Errorf("%s: %w", g.Name(), err)
+		if errors.Is(err, ErrNoPreview) || errors.Is(err, ErrGeneratorUnavailable) {
+			reasons = append(reasons, err)
+		} else {
+			failure = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if failure != nil {
+		return nil, failure
+	}
+	if len(reasons) == 0 {
+		return nil, fmt.Errorf("%w: no generator for %s", ErrNoPreview, mimeType)
 	}
+	return nil, errors.Join(reasons...)
+}
 
-	return buf.Bytes(), nil
+// generateSafely runs one generator, turning a panic (a decoder or the SVG
+// renderer tripping over a malformed file) into an error for that file.
+func generateSafely(ctx context.Context, g PreviewGenerator, fullPath, mimeType string) (img image.Image, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().Str("generator", g.Name()).Str("path", fullPath).Interface("panic", r).Msg("preview generator panicked")
+			img, err = nil, fmt.Errorf("generator panicked: %v", r)
+		}
+	}()
+	return g.Generate(ctx, fullPath, mimeType)
 }
 
 // resizeToMaxWidth scales an image so its width is at most maxWidth pixels,
@@ -335,8 +448,8 @@ func resizeToMaxWidth(src image.Image, maxWidth int) image.Image {
 
 // Ensure standard image decoders are registered (JPEG, PNG, GIF are auto-registered
 // by their packages when imported). We import them above for encoding as well, which
-// also triggers registration. WebP is registered via the blank import of
-// golang.org/x/image/webp.
+// also triggers registration. WebP, BMP and TIFF are registered via the blank
+// imports in preview_generators.go.
 //
 // The init guard below silences "imported and not used" for the standard decoders
 // whose Decode functions we never call directly (we rely on image.Decode).
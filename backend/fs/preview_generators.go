@@ -0,0 +1,326 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/gen2brain/heic"
+	"github.com/xiaoyuanzhu-com/my-life-db/workers/mediameta"
+	"golang.org/x/image/draw"
+
+	// Register more decoders with image.Decode.
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// Built-in preview generators. The in-process ones (images, SVG, cover
+// art) always work; documents need the screenitshot CLI and video frames
+// an ffmpeg binary, and report ErrGeneratorUnavailable when theirs is not
+// installed.
+
+var (
+	// ErrNoPreview is returned by a generator that accepts a file's type
+	// but has nothing to show for this file (audio without cover art, an
+	// image format without a Go decoder). The next generator gets a try.
+	ErrNoPreview = errors.New("no preview available")
+
+	// ErrGeneratorUnavailable is returned by a generator whose external
+	// tool is not installed.
+	ErrGeneratorUnavailable = errors.New("preview generator unavailable")
+)
+
+// DefaultPreviewGenerators returns the generators used when
+// Config.PreviewGenerators is nil, in the order they are tried.
+func DefaultPreviewGenerators() []PreviewGenerator {
+	return []PreviewGenerator{
+		imageGenerator{},
+		svgGenerator{},
+		coverArtGenerator{},
+		documentGenerator{command: "screenitshot"},
+		ffmpegGenerator{command: "ffmpeg"},
+	}
+}
+
+// ---------- Images ----------
+
+// imageGenerator decodes images with the Go decoders: JPEG, PNG, GIF,
+// WebP, BMP, TIFF and HEIC/HEIF, turned upright per their EXIF
+// orientation.
+type imageGenerator struct{}
+
+func (imageGenerator) Name() string { return "image" }
+
+func (imageGenerator) Accepts(mimeType string) bool {
+	return isImageMime(mimeType) && mimeType != "image/svg+xml"
+}
+
+func (imageGenerator) Generate(ctx context.Context, fullPath, mimeType string) (image.Image, error) {
+	img, err := decodeImageFile(fullPath, mimeType)
+	if errors.Is(err, image.ErrFormat) {
+		return nil, fmt.Errorf("%w: no decoder for %s", ErrNoPreview, mimeType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The HEIC decoder applies the container's rotation itself.
+	if mimeType != "image/heic" && mimeType != "image/heif" {
+		if m, err := mediameta.ExtractFile(fullPath); err == nil && m != nil && m.Orientation >= 2 && m.Orientation <= 8 {
+			// orient copies every pixel twice: shrink to thumbnail size first.
+			img = orient(shrinkForOrientation(img, m.Orientation, thumbnailMaxWidth), m.Orientation)
+		}
+	}
+	return img, nil
+}
+
+// shrinkForOrientation scales img down so that, once turned upright for
+// orientation, it is at most maxWidth wide. Orientations 5-8 swap the
+// axes, so for them the stored height is what gets bounded.
+func shrinkForOrientation(img image.Image, orientation, maxWidth int) image.Image {
+	if orientation < 5 {
+		return resizeToMaxWidth(img, maxWidth)
+	}
+	b := img.Bounds()
+	if b.Dy() <= maxWidth {
+		return img
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx()*maxWidth/b.Dy(), maxWidth))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+// orient returns img transformed to display upright given its EXIF
+// orientation (1-8; anything else leaves it as is).
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	// Convert once so the pixel shuffle below copies bytes instead of
+	// going through color.Color.
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	// Orientations 5-8 swap the axes.
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 anticlockwise
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
+
+// decodeImageFile opens and decodes an image file.
+func decodeImageFile(fullPath, mimeType string) (image.Image, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("open image: %w", err)
+	}
+	defer f.Close()
+
+	// HEIC/HEIF needs a dedicated decoder (not registered with image.Decode)
+	if mimeType == "image/heic" || mimeType == "image/heif" {
+		img, err := heic.Decode(f)
+		if err != nil {
+			return nil, fmt.Errorf("decode heic: %w", err)
+		}
+		return img, nil
+	}
+	// Anything else with a registered decoder. GIF decodes to the first
+	// frame automatically via image.Decode.
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decode image (%s): %w", mimeType, err)
+	}
+	return img, nil
+}
+
+// ---------- SVG ----------
+
+// svgGenerator rasterizes SVG documents (see preview_svg.go).
+type svgGenerator struct{}
+
+func (svgGenerator) Name() string { return "svg" }
+
+func (svgGenerator) Accepts(mimeType string) bool { return mimeType == "image/svg+xml" }
+
+func (svgGenerator) Generate(ctx context.Context, fullPath, mimeType string) (image.Image, error) {
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxSVGBytes {
+		return nil, fmt.Errorf("%w: svg larger than %d bytes", ErrNoPreview, maxSVGBytes)
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	return rasterizeSVG(ctx, data)
+}
+
+// ---------- Cover art ----------
+
+// coverArtGenerator shows the picture embedded in music files (ID3, MP4,
+// FLAC) and in some MP4 videos.
+type coverArtGenerator struct{}
+
+func (coverArtGenerator) Name() string { return "cover-art" }
+
+func (coverArtGenerator) Accepts(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "audio/") || mimeType == "video/mp4" || mimeType == "video/x-m4v"
+}
+
+func (coverArtGenerator) Generate(ctx context.Context, fullPath, mimeType string) (image.Image, error) {
+	pic, err := mediameta.CoverArtFile(fullPath)
+	if errors.Is(err, mediameta.ErrNoCoverArt) {
+		return nil, fmt.Errorf("%w: no embedded cover art", ErrNoPreview)
+	}
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(pic))
+	if err != nil {
+		return nil, fmt.Errorf("decode cover art: %w", err)
+	}
+	return img, nil
+}
+
+// ---------- Documents (screenitshot) ----------
+
+// documentGenerator runs the screenitshot CLI to screenshot the first page
+// of a document.
+type documentGenerator struct {
+	command string
+}
+
+func (documentGenerator) Name() string { return "document" }
+
+func (documentGenerator) Accepts(mimeType string) bool { return isDocumentMime(mimeType) }
+
+func (g documentGenerator) Generate(ctx context.Context, fullPath, mimeType string) (image.Image, error) {
+	bin, err := exec.LookPath(g.command)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s not installed", ErrGeneratorUnavailable, g.command)
+	}
+
+	tmpFile, err := os.CreateTemp("", "screenitshot-*.png")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	tmpFile.Close()
+	defer os.Remove(tmpPath)
+
+	cmd := exec.CommandContext(ctx, bin, fullPath, "-o", tmpPath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", g.command, err, stderr.String())
+	}
+
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("open screenshot: %w", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decode screenshot: %w", err)
+	}
+	return img, nil
+}
+
+// ---------- Video frames (ffmpeg) ----------
+
+// ffmpegGenerator grabs a poster frame from videos, and decodes image
+// formats Go cannot (AVIF, JPEG XL, ...) when the image generator gave up.
+type ffmpegGenerator struct {
+	command string
+}
+
+// ffmpegSeek is where the poster frame is taken, past fade-ins and black
+// leaders.
+const ffmpegSeek = "1"
+
+func (ffmpegGenerator) Name() string { return "ffmpeg" }
+
+func (ffmpegGenerator) Accepts(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "video/") ||
+		(isImageMime(mimeType) && mimeType != "image/svg+xml")
+}
+
+func (g ffmpegGenerator) Generate(ctx context.Context, fullPath, mimeType string) (image.Image, error) {
+	bin, err := exec.LookPath(g.command)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s not installed", ErrGeneratorUnavailable, g.command)
+	}
+
+	frame := func(seek bool) ([]byte, error) {
+		args := []string{"-hide_banner", "-loglevel", "error"}
+		if seek {
+			args = append(args, "-ss", ffmpegSeek)
+		}
+		args = append(args,
+			"-i", fullPath,
+			"-frames:v", "1",
+			"-vf", fmt.Sprintf("scale='min(%d,iw)':-2", thumbnailMaxWidth),
+			"-f", "image2pipe", "-c:v", "png", "-",
+		)
+		cmd := exec.CommandContext(ctx, bin, args...)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("%s: %w: %s", g.command, err, strings.TrimSpace(stderr.String()))
+		}
+		return stdout.Bytes(), nil
+	}
+
+	video := strings.HasPrefix(mimeType, "video/")
+	out, err := frame(video)
+	if err == nil && len(out) == 0 && video {
+		// Shorter than the seek point: take the first frame.
+		out, err = frame(false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: no video frame", ErrNoPreview)
+	}
+	img, _, err := image.Decode(bytes.NewReader(out))
+	if err != nil {
+		return nil, fmt.Errorf("decode ffmpeg frame: %w", err)
+	}
+	return img, nil
+}
@@ -0,0 +1,1053 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/vector"
+)
+
+// A small SVG renderer for thumbnails: basic shapes and paths (arcs
+// included), nested transforms, fills and strokes with opacity, on a white
+// background. Gradients paint in their first stop colour; text, images,
+// <use>, clipping, masks and filters are not drawn. That is enough for
+// icons, logos, diagrams and most exported drawings to be recognizable.
+//
+// Documents are untrusted input: rendering stops, keeping what was drawn,
+// once the element count or the raster work budget runs out, and fails
+// when the context ends.
+
+const (
+	maxSVGBytes    = 8 << 20
+	maxSVGElements = 50000
+	// svgMinSide is the size small icons are scaled up to.
+	svgMinSide = 256
+	// svgMaxCoord clamps device coordinates: the rasterizer walks every
+	// row a segment crosses, on-canvas or not.
+	svgMaxCoord = 16384
+	// svgMaxWork bounds the raster work of one document, counted as the
+	// pixels each fill covers plus the rows its segments cross: about a
+	// hundred full-size fills, a second or two.
+	svgMaxWork = 1 << 27
+)
+
+var errSVGInvalid = errors.New("invalid svg")
+
+// svgHiddenElements are containers whose content is only drawn by
+// reference (or not at all).
+var svgHiddenElements = map[string]bool{
+	"defs": true, "clipPath": true, "mask": true, "symbol": true, "pattern": true,
+	"marker": true, "filter": true, "title": true, "desc": true, "metadata": true,
+	"text": true, "style": true, "script": true, "foreignObject": true,
+}
+
+// svgStyle is the inherited drawing state.
+type svgStyle struct {
+	fill          *color.NRGBA // nil = none
+	stroke        *color.NRGBA
+	color         color.NRGBA // currentColor
+	strokeWidth   float64
+	fillOpacity   float64
+	strokeOpacity float64
+	opacity       float64
+	ctm           affine
+	hidden        bool
+}
+
+// affine is the matrix [a c e; b d f; 0 0 1].
+type affine [6]float64
+
+var identity = affine{1, 0, 0, 1, 0, 0}
+
+// mul returns m·n: n applied first.
+func (m affine) mul(n affine) affine {
+	return affine{
+		m[0]*n[0] + m[2]*n[1],
+		m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3],
+		m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4],
+		m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+func (m affine) apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+// scale is the factor lengths grow by on average (for stroke widths).
+func (m affine) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+type point struct{ x, y float64 }
+
+// svgRenderer holds the state of one rendering.
+type svgRenderer struct {
+	canvas    *image.RGBA
+	z         *vector.Rasterizer
+	gradients map[string]color.NRGBA
+	gradient  string // id of the gradient whose stops are being read
+	elements  int
+	work      int // raster work so far, see svgMaxWork
+}
+
+// rasterizeSVG renders an SVG document to an opaque image.
+func rasterizeSVG(ctx context.Context, data []byte) (image.Image, error) {
+	r, err := renderSVG(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	return r.result()
+}
+
+// renderSVG draws the document and returns the renderer, whose canvas is
+// nil when no <svg> element was found.
+func renderSVG(ctx context.Context, data []byte) (*svgRenderer, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+
+	r := &svgRenderer{gradients: map[string]color.NRGBA{}}
+	black := color.NRGBA{0, 0, 0, 255}
+	stack := []svgStyle{}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if r.canvas != nil {
+				break // keep what was drawn before the damage
+			}
+			return nil, fmt.Errorf("%w: %v", errSVGInvalid, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			r.elements++
+			if r.elements > maxSVGElements || r.work > svgMaxWork {
+				return r, nil
+			}
+			name := t.Name.Local
+			attrs := svgAttrs(t.Attr)
+
+			var parent svgStyle
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			} else {
+				if name != "svg" {
+					return nil, fmt.Errorf("%w: root element is <%s>", errSVGInvalid, name)
+				}
+				parent = svgStyle{
+					fill: &black, color: black, strokeWidth: 1,
+					fillOpacity: 1, strokeOpacity: 1, opacity: 1,
+				}
+				parent.ctm = r.setup(attrs)
+			}
+			st := r.style(parent, attrs)
+			if svgHiddenElements[name] {
+				st.hidden = true
+			}
+			stack = append(stack, st)
+
+			switch name {
+			case "linearGradient", "radialGradient":
+				r.gradient = attrs["id"]
+			case "stop":
+				r.gradientStop(attrs, st)
+			default:
+				if !st.hidden {
+					r.drawElement(name, attrs, st)
+				}
+			}
+
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			if t.Name.Local == "linearGradient" || t.Name.Local == "radialGradient" {
+				r.gradient = ""
+			}
+		}
+	}
+	return r, nil
+}
+
+func (r *svgRenderer) result() (image.Image, error) {
+	if r.canvas == nil {
+		return nil, fmt.Errorf("%w: no <svg> element", errSVGInvalid)
+	}
+	return r.canvas, nil
+}
+
+// setup sizes the canvas from the root element and returns the
+// viewBox-to-canvas transform (uniform scale, centred).
+func (r *svgRenderer) setup(attrs map[string]string) affine {
+	minX, minY, vw, vh := 0.0, 0.0, 0.0, 0.0
+	if vb := svgNumbers(attrs["viewBox"]); len(vb) == 4 && vb[2] > 0 && vb[3] > 0 {
+		minX, minY, vw, vh = vb[0], vb[1], vb[2], vb[3]
+	}
+	w := svgLength(attrs["width"], 0)
+	h := svgLength(attrs["height"], 0)
+	switch {
+	case w > 0 && h > 0:
+	case vw > 0 && w > 0:
+		h = w * vh / vw
+	case vw > 0 && h > 0:
+		w = h * vw / vh
+	case vw > 0:
+		w, h = vw, vh
+	default:
+		w, h = 300, 150
+	}
+	if vw == 0 {
+		vw, vh = w, h
+	}
+
+	// Scale the document so its long side is within [svgMinSide,
+	// thumbnailMaxWidth].
+	long := math.Max(w, h)
+	k := 1.0
+	if long < svgMinSide {
+		k = svgMinSide / long
+	} else if long > thumbnailMaxWidth {
+		k = thumbnailMaxWidth / long
+	}
+	cw := max(1, int(math.Round(w*k)))
+	ch := max(1, int(math.Round(h*k)))
+
+	r.canvas = image.NewRGBA(image.Rect(0, 0, cw, ch))
+	draw.Draw(r.canvas, r.canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	r.z = vector.NewRasterizer(cw, ch)
+
+	s := math.Min(float64(cw)/vw, float64(ch)/vh)
+	ox := (float64(cw) - vw*s) / 2
+	oy := (float64(ch) - vh*s) / 2
+	return affine{s, 0, 0, s, ox - minX*s, oy - minY*s}
+}
+
+// style applies an element's presentation attributes and style="" (which
+// wins) on top of the inherited state.
+func (r *svgRenderer) style(parent svgStyle, attrs map[string]string) svgStyle {
+	st := parent
+	props := map[string]string{}
+	for _, k := range []string{"fill", "stroke", "stroke-width", "fill-opacity", "stroke-opacity", "opacity", "color", "display", "visibility"} {
+		if v, ok := attrs[k]; ok {
+			props[k] = v
+		}
+	}
+	for _, decl := range strings.Split(attrs["style"], ";") {
+		if k, v, ok := strings.Cut(decl, ":"); ok {
+			props[strings.TrimSpace(k)] = strings.TrimSpace(strings.TrimSuffix(v, "!important"))
+		}
+	}
+
+	if v, ok := props["color"]; ok {
+		if c, ok := r.paint(v, st.color); ok && c != nil {
+			st.color = *c
+		}
+	}
+	if v, ok := props["fill"]; ok {
+		if c, ok := r.paint(v, st.color); ok {
+			st.fill = c
+		}
+	}
+	if v, ok := props["stroke"]; ok {
+		if c, ok := r.paint(v, st.color); ok {
+			st.stroke = c
+		}
+	}
+	if v, ok := props["stroke-width"]; ok {
+		st.strokeWidth = svgLength(v, st.strokeWidth)
+	}
+	if v, ok := props["fill-opacity"]; ok {
+		st.fillOpacity = svgOpacity(v, st.fillOpacity)
+	}
+	if v, ok := props["stroke-opacity"]; ok {
+		st.strokeOpacity = svgOpacity(v, st.strokeOpacity)
+	}
+	if v, ok := props["opacity"]; ok {
+		st.opacity *= svgOpacity(v, 1)
+	}
+	if props["display"] == "none" || props["visibility"] == "hidden" {
+		st.hidden = true
+	}
+	if tf, ok := attrs["transform"]; ok {
+		st.ctm = st.ctm.mul(parseTransform(tf))
+	}
+	return st
+}
+
+// paint parses a fill or stroke value. ok is false for values that leave
+// the inherited paint alone.
+func (r *svgRenderer) paint(v string, current color.NRGBA) (*color.NRGBA, bool) {
+	v = strings.TrimSpace(v)
+	switch {
+	case v == "none" || v == "transparent":
+		return nil, true
+	case v == "currentColor":
+		c := current
+		return &c, true
+	case strings.HasPrefix(v, "url("):
+		id, _, _ := strings.Cut(strings.TrimPrefix(v, "url("), ")")
+		id = strings.Trim(strings.TrimSpace(id), `'"`)
+		if c, ok := r.gradients[strings.TrimPrefix(id, "#")]; ok {
+			return &c, true
+		}
+		// Fallback colour after the url, else a neutral grey.
+		if _, fallback, ok := strings.Cut(v, ")"); ok {
+			if c, ok := parseSVGColor(fallback); ok {
+				return &c, true
+			}
+		}
+		grey := color.NRGBA{128, 128, 128, 255}
+		return &grey, true
+	}
+	if c, ok := parseSVGColor(v); ok {
+		return &c, true
+	}
+	return nil, false
+}
+
+// gradientStop records the first stop colour of the gradient being read.
+func (r *svgRenderer) gradientStop(attrs map[string]string, st svgStyle) {
+	if r.gradient == "" {
+		return
+	}
+	if _, done := r.gradients[r.gradient]; done {
+		return
+	}
+	v := attrs["stop-color"]
+	for _, decl := range strings.Split(attrs["style"], ";") {
+		if k, val, ok := strings.Cut(decl, ":"); ok && strings.TrimSpace(k) == "stop-color" {
+			v = val
+		}
+	}
+	if c, ok := r.paint(v, st.color); ok && c != nil {
+		r.gradients[r.gradient] = *c
+	}
+}
+
+// drawElement fills and strokes one shape element.
+func (r *svgRenderer) drawElement(name string, attrs map[string]string, st svgStyle) {
+	num := func(k string) float64 { return svgLength(attrs[k], 0) }
+	p := &svgPath{m: st.ctm}
+
+	switch name {
+	case "rect":
+		x, y, w, h := num("x"), num("y"), num("width"), num("height")
+		if w <= 0 || h <= 0 {
+			return
+		}
+		rx, ry := num("rx"), num("ry")
+		if _, ok := attrs["ry"]; !ok {
+			ry = rx
+		}
+		if _, ok := attrs["rx"]; !ok {
+			rx = ry
+		}
+		rx, ry = math.Min(rx, w/2), math.Min(ry, h/2)
+		if rx <= 0 || ry <= 0 {
+			p.moveTo(x, y)
+			p.lineTo(x+w, y)
+			p.lineTo(x+w, y+h)
+			p.lineTo(x, y+h)
+			p.close()
+			break
+		}
+		p.moveTo(x+rx, y)
+		p.lineTo(x+w-rx, y)
+		p.arcTo(rx, ry, 0, false, true, x+w, y+ry)
+		p.lineTo(x+w, y+h-ry)
+		p.arcTo(rx, ry, 0, false, true, x+w-rx, y+h)
+		p.lineTo(x+rx, y+h)
+		p.arcTo(rx, ry, 0, false, true, x, y+h-ry)
+		p.lineTo(x, y+ry)
+		p.arcTo(rx, ry, 0, false, true, x+rx, y)
+		p.close()
+	case "circle", "ellipse":
+		cx, cy := num("cx"), num("cy")
+		rx, ry := num("rx"), num("ry")
+		if name == "circle" {
+			rx, ry = num("r"), num("r")
+		}
+		if rx <= 0 || ry <= 0 {
+			return
+		}
+		p.moveTo(cx+rx, cy)
+		p.arcTo(rx, ry, 0, false, true, cx-rx, cy)
+		p.arcTo(rx, ry, 0, false, true, cx+rx, cy)
+		p.close()
+	case "line":
+		p.moveTo(num("x1"), num("y1"))
+		p.lineTo(num("x2"), num("y2"))
+		st.fill = nil
+	case "polyline", "polygon":
+		pts := svgNumbers(attrs["points"])
+		if len(pts) < 4 {
+			return
+		}
+		p.moveTo(pts[0], pts[1])
+		for i := 2; i+1 < len(pts); i += 2 {
+			p.lineTo(pts[i], pts[i+1])
+		}
+		if name == "polygon" {
+			p.close()
+		}
+	case "path":
+		parsePathData(attrs["d"], p)
+	default:
+		return
+	}
+
+	if st.fill != nil {
+		r.fill(p.subpaths, *st.fill, st.fillOpacity*st.opacity)
+	}
+	if st.stroke != nil && st.strokeWidth > 0 {
+		r.stroke(p, *st.stroke, st.strokeOpacity*st.opacity, st.strokeWidth*st.ctm.scale())
+	}
+}
+
+// fill rasterizes subpaths over their bounding box only, so small shapes
+// on a large canvas stay cheap.
+func (r *svgRenderer) fill(subpaths [][]point, c color.NRGBA, opacity float64) {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, sp := range subpaths {
+		if len(sp) < 3 {
+			continue
+		}
+		for _, pt := range sp {
+			minX, minY = math.Min(minX, pt.x), math.Min(minY, pt.y)
+			maxX, maxY = math.Max(maxX, pt.x), math.Max(maxY, pt.y)
+		}
+	}
+	box := image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY))).
+		Intersect(r.canvas.Bounds())
+	if minX > maxX || box.Empty() {
+		return
+	}
+	// Charge the work up front: a single path can hold enough segments
+	// to blow the budget on its own.
+	work := box.Dx() * box.Dy()
+	for _, sp := range subpaths {
+		if len(sp) < 3 {
+			continue
+		}
+		for i := range sp {
+			work += int(math.Abs(sp[i].y-sp[(i+1)%len(sp)].y)) + 1
+		}
+	}
+	r.work += work
+	if r.work > svgMaxWork {
+		return
+	}
+
+	ox, oy := float64(box.Min.X), float64(box.Min.Y)
+	r.z.Reset(box.Dx(), box.Dy())
+	for _, sp := range subpaths {
+		if len(sp) < 3 {
+			continue
+		}
+		r.z.MoveTo(float32(sp[0].x-ox), float32(sp[0].y-oy))
+		for _, pt := range sp[1:] {
+			r.z.LineTo(float32(pt.x-ox), float32(pt.y-oy))
+		}
+		r.z.ClosePath()
+	}
+	r.paintMask(c, opacity, box)
+}
+
+// stroke outlines each segment with a quad and each vertex with an
+// octagon (round-ish joins and caps). All polygons wind the same way, so
+// overlaps saturate instead of cancelling.
+func (r *svgRenderer) stroke(p *svgPath, c color.NRGBA, opacity, width float64) {
+	hw := width / 2
+	var polys [][]point
+	for i, sp := range p.subpaths {
+		pts := sp
+		if p.closed[i] && len(sp) > 1 {
+			pts = append(pts[:len(pts):len(pts)], sp[0])
+		}
+		for j := 0; j+1 < len(pts); j++ {
+			a, b := pts[j], pts[j+1]
+			dx, dy := b.x-a.x, b.y-a.y
+			l := math.Hypot(dx, dy)
+			if l == 0 {
+				continue
+			}
+			nx, ny := -dy/l*hw, dx/l*hw
+			polys = append(polys, []point{
+				{a.x + nx, a.y + ny}, {b.x + nx, b.y + ny},
+				{b.x - nx, b.y - ny}, {a.x - nx, a.y - ny},
+			})
+		}
+		for _, v := range pts {
+			oct := make([]point, 8)
+			for k := range oct {
+				angle := float64(k) * math.Pi / 4
+				oct[k] = point{v.x + hw*math.Cos(angle), v.y + hw*math.Sin(angle)}
+			}
+			polys = append(polys, oct)
+		}
+	}
+	for _, poly := range polys {
+		if signedArea(poly) < 0 {
+			for i, j := 0, len(poly)-1; i < j; i, j = i+1, j-1 {
+				poly[i], poly[j] = poly[j], poly[i]
+			}
+		}
+	}
+	r.fill(polys, c, opacity)
+}
+
+func signedArea(poly []point) float64 {
+	var a float64
+	for i := range poly {
+		j := (i + 1) % len(poly)
+		a += poly[i].x*poly[j].y - poly[j].x*poly[i].y
+	}
+	return a
+}
+
+// paintMask paints c through the rasterizer's mask, which covers box.
+func (r *svgRenderer) paintMask(c color.NRGBA, opacity float64, box image.Rectangle) {
+	c.A = uint8(math.Round(float64(c.A) * math.Max(0, math.Min(1, opacity))))
+	if c.A == 0 {
+		return
+	}
+	r.z.DrawOp = draw.Over
+	r.z.Draw(r.canvas, box, image.NewUniform(c), image.Point{})
+}
+
+// ---------- Paths ----------
+
+// svgPath flattens a path into device-space polylines.
+type svgPath struct {
+	m        affine
+	subpaths [][]point
+	closed   []bool
+	// Current and subpath start points in user space.
+	cx, cy, sx, sy float64
+}
+
+func (p *svgPath) device(x, y float64) point {
+	dx, dy := p.m.apply(x, y)
+	clamp := func(v float64) float64 {
+		if math.IsNaN(v) {
+			return 0
+		}
+		return math.Max(-svgMaxCoord, math.Min(svgMaxCoord, v))
+	}
+	return point{clamp(dx), clamp(dy)}
+}
+
+func (p *svgPath) moveTo(x, y float64) {
+	p.subpaths = append(p.subpaths, []point{p.device(x, y)})
+	p.closed = append(p.closed, false)
+	p.cx, p.cy, p.sx, p.sy = x, y, x, y
+}
+
+func (p *svgPath) lineTo(x, y float64) {
+	if len(p.subpaths) == 0 {
+		p.moveTo(p.cx, p.cy)
+	}
+	last := len(p.subpaths) - 1
+	p.subpaths[last] = append(p.subpaths[last], p.device(x, y))
+	p.cx, p.cy = x, y
+}
+
+func (p *svgPath) cubeTo(x1, y1, x2, y2, x, y float64) {
+	a := p.device(p.cx, p.cy)
+	b, c, d := p.device(x1, y1), p.device(x2, y2), p.device(x, y)
+	// Enough segments for the control polygon's length at ~3 px each.
+	length := math.Hypot(b.x-a.x, b.y-a.y) + math.Hypot(c.x-b.x, c.y-b.y) + math.Hypot(d.x-c.x, d.y-c.y)
+	n := int(math.Max(4, math.Min(64, length/3)))
+	if len(p.subpaths) == 0 {
+		p.moveTo(p.cx, p.cy)
+	}
+	last := len(p.subpaths) - 1
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		u := 1 - t
+		p.subpaths[last] = append(p.subpaths[last], point{
+			u*u*u*a.x + 3*u*u*t*b.x + 3*u*t*t*c.x + t*t*t*d.x,
+			u*u*u*a.y + 3*u*u*t*b.y + 3*u*t*t*c.y + t*t*t*d.y,
+		})
+	}
+	p.cx, p.cy = x, y
+}
+
+func (p *svgPath) quadTo(x1, y1, x, y float64) {
+	p.cubeTo(p.cx+2.0/3*(x1-p.cx), p.cy+2.0/3*(y1-p.cy), x+2.0/3*(x1-x), y+2.0/3*(y1-y), x, y)
+}
+
+func (p *svgPath) close() {
+	if len(p.closed) > 0 {
+		p.closed[len(p.closed)-1] = true
+	}
+	p.cx, p.cy = p.sx, p.sy
+}
+
+// arcTo draws an elliptical arc to (x, y) as cubic Béziers, converting
+// from SVG's endpoint parameterization to a centre one (SVG 1.1 F.6.5).
+func (p *svgPath) arcTo(rx, ry, rotation float64, large, sweep bool, x, y float64) {
+	x0, y0 := p.cx, p.cy
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 || (x0 == x && y0 == y) {
+		p.lineTo(x, y)
+		return
+	}
+	phi := rotation * math.Pi / 180
+	cosPhi, sinPhi := math.Cos(phi), math.Sin(phi)
+	dx, dy := (x0-x)/2, (y0-y)/2
+	x1p := cosPhi*dx + sinPhi*dy
+	y1p := -sinPhi*dx + cosPhi*dy
+
+	// Scale up radii that cannot span the endpoints.
+	if l := x1p*x1p/(rx*rx) + y1p*y1p/(ry*ry); l > 1 {
+		s := math.Sqrt(l)
+		rx, ry = rx*s, ry*s
+	}
+	num := rx*rx*ry*ry - rx*rx*y1p*y1p - ry*ry*x1p*x1p
+	den := rx*rx*y1p*y1p + ry*ry*x1p*x1p
+	coef := 0.0
+	if den != 0 && num > 0 {
+		coef = math.Sqrt(num / den)
+	}
+	if large == sweep {
+		coef = -coef
+	}
+	cxp := coef * rx * y1p / ry
+	cyp := -coef * ry * x1p / rx
+	cx := cosPhi*cxp - sinPhi*cyp + (x0+x)/2
+	cy := sinPhi*cxp + cosPhi*cyp + (y0+y)/2
+
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta1 := angle(1, 0, (x1p-cxp)/rx, (y1p-cyp)/ry)
+	delta := angle((x1p-cxp)/rx, (y1p-cyp)/ry, (-x1p-cxp)/rx, (-y1p-cyp)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	// One cubic per quarter turn or less.
+	segs := int(math.Ceil(math.Abs(delta) / (math.Pi / 2)))
+	step := delta / float64(segs)
+	k := 4.0 / 3 * math.Tan(step/4)
+	pointAt := func(t float64) (float64, float64) {
+		ex, ey := rx*math.Cos(t), ry*math.Sin(t)
+		return cosPhi*ex - sinPhi*ey + cx, sinPhi*ex + cosPhi*ey + cy
+	}
+	derivAt := func(t float64) (float64, float64) {
+		ex, ey := -rx*math.Sin(t), ry*math.Cos(t)
+		return cosPhi*ex - sinPhi*ey, sinPhi*ex + cosPhi*ey
+	}
+	t := theta1
+	for i := 0; i < segs; i++ {
+		ax, ay := pointAt(t)
+		adx, ady := derivAt(t)
+		bx, by := pointAt(t + step)
+		bdx, bdy := derivAt(t + step)
+		if i == segs-1 {
+			bx, by = x, y
+		}
+		p.cubeTo(ax+k*adx, ay+k*ady, bx-k*bdx, by-k*bdy, bx, by)
+		t += step
+	}
+}
+
+// parsePathData feeds the commands of a d="" attribute to p. Parsing stops
+// at the first error, keeping what came before (as browsers do).
+func parsePathData(d string, p *svgPath) {
+	s := &svgScanner{s: d}
+	var cmd byte
+	// Reflected control points for S/T.
+	var lastCtrlX, lastCtrlY float64
+	var lastCmd byte
+
+	for {
+		s.skipSeparators()
+		if s.done() {
+			return
+		}
+		if c := s.s[s.i]; isPathCommand(c) {
+			cmd = c
+			s.i++
+		} else if cmd == 0 {
+			return
+		}
+		rel := cmd >= 'a'
+		ox, oy := 0.0, 0.0
+		if rel {
+			ox, oy = p.cx, p.cy
+		}
+		nums := func(n int) ([]float64, bool) {
+			out := make([]float64, n)
+			for i := range out {
+				v, ok := s.number()
+				if !ok {
+					return nil, false
+				}
+				out[i] = v
+			}
+			return out, true
+		}
+
+		switch cmd | 0x20 { // lower case
+		case 'z':
+			p.close()
+			lastCmd = 'z'
+			cmd = 0
+			continue
+		case 'm':
+			v, ok := nums(2)
+			if !ok {
+				return
+			}
+			p.moveTo(ox+v[0], oy+v[1])
+			// Further coordinate pairs are implicit line-tos.
+			if rel {
+				cmd = 'l'
+			} else {
+				cmd = 'L'
+			}
+		case 'l':
+			v, ok := nums(2)
+			if !ok {
+				return
+			}
+			p.lineTo(ox+v[0], oy+v[1])
+		case 'h':
+			v, ok := nums(1)
+			if !ok {
+				return
+			}
+			p.lineTo(ox+v[0], p.cy)
+		case 'v':
+			v, ok := nums(1)
+			if !ok {
+				return
+			}
+			p.lineTo(p.cx, oy+v[0])
+		case 'c':
+			v, ok := nums(6)
+			if !ok {
+				return
+			}
+			p.cubeTo(ox+v[0], oy+v[1], ox+v[2], oy+v[3], ox+v[4], oy+v[5])
+			lastCtrlX, lastCtrlY = ox+v[2], oy+v[3]
+		case 's':
+			v, ok := nums(4)
+			if !ok {
+				return
+			}
+			x1, y1 := p.cx, p.cy
+			if lastCmd == 'c' || lastCmd == 's' {
+				x1, y1 = 2*p.cx-lastCtrlX, 2*p.cy-lastCtrlY
+			}
+			p.cubeTo(x1, y1, ox+v[0], oy+v[1], ox+v[2], oy+v[3])
+			lastCtrlX, lastCtrlY = ox+v[0], oy+v[1]
+		case 'q':
+			v, ok := nums(4)
+			if !ok {
+				return
+			}
+			p.quadTo(ox+v[0], oy+v[1], ox+v[2], oy+v[3])
+			lastCtrlX, lastCtrlY = ox+v[0], oy+v[1]
+		case 't':
+			v, ok := nums(2)
+			if !ok {
+				return
+			}
+			x1, y1 := p.cx, p.cy
+			if lastCmd == 'q' || lastCmd == 't' {
+				x1, y1 = 2*p.cx-lastCtrlX, 2*p.cy-lastCtrlY
+			}
+			p.quadTo(x1, y1, ox+v[0], oy+v[1])
+			lastCtrlX, lastCtrlY = x1, y1
+		case 'a':
+			r, ok := nums(3)
+			if !ok {
+				return
+			}
+			large, ok1 := s.flag()
+			sweep, ok2 := s.flag()
+			end, ok3 := nums(2)
+			if !ok1 || !ok2 || !ok3 {
+				return
+			}
+			p.arcTo(r[0], r[1], r[2], large, sweep, ox+end[0], oy+end[1])
+		default:
+			return
+		}
+		lastCmd = cmd | 0x20
+	}
+}
+
+func isPathCommand(c byte) bool {
+	return strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", c) >= 0
+}
+
+// svgScanner reads numbers out of path data, point lists and transform
+// arguments, where separators are optional wherever unambiguous
+// ("M1.5.5-2" is M 1.5 0.5 -2).
+type svgScanner struct {
+	s string
+	i int
+}
+
+func (s *svgScanner) done() bool { return s.i >= len(s.s) }
+
+func (s *svgScanner) skipSeparators() {
+	for s.i < len(s.s) && strings.IndexByte(" \t\r\n,", s.s[s.i]) >= 0 {
+		s.i++
+	}
+}
+
+func (s *svgScanner) number() (float64, bool) {
+	s.skipSeparators()
+	start := s.i
+	if s.i < len(s.s) && (s.s[s.i] == '+' || s.s[s.i] == '-') {
+		s.i++
+	}
+	digits, dot := false, false
+mantissa:
+	for ; s.i < len(s.s); s.i++ {
+		switch c := s.s[s.i]; {
+		case c >= '0' && c <= '9':
+			digits = true
+		case c == '.' && !dot:
+			dot = true
+		default:
+			break mantissa
+		}
+	}
+	if digits && s.i < len(s.s) && (s.s[s.i] == 'e' || s.s[s.i] == 'E') {
+		j := s.i + 1
+		if j < len(s.s) && (s.s[j] == '+' || s.s[j] == '-') {
+			j++
+		}
+		if j < len(s.s) && s.s[j] >= '0' && s.s[j] <= '9' {
+			for j < len(s.s) && s.s[j] >= '0' && s.s[j] <= '9' {
+				j++
+			}
+			s.i = j
+		}
+	}
+	if !digits {
+		s.i = start
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s.s[start:s.i], 64)
+	return v, err == nil
+}
+
+// flag reads an arc flag, which may be glued to what follows ("a1 1 0 00 1 1").
+func (s *svgScanner) flag() (bool, bool) {
+	s.skipSeparators()
+	if s.i < len(s.s) && (s.s[s.i] == '0' || s.s[s.i] == '1') {
+		s.i++
+		return s.s[s.i-1] == '1', true
+	}
+	return false, false
+}
+
+// ---------- Attribute values ----------
+
+func svgAttrs(attrs []xml.Attr) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for _, a := range attrs {
+		m[a.Name.Local] = a.Value
+	}
+	return m
+}
+
+// svgNumbers parses a list of numbers (viewBox, points).
+func svgNumbers(v string) []float64 {
+	s := &svgScanner{s: v}
+	var out []float64
+	for {
+		n, ok := s.number()
+		if !ok {
+			return out
+		}
+		out = append(out, n)
+	}
+}
+
+// svgLength parses a length, ignoring units (px) and treating em as 16px;
+// percentages and garbage give def.
+func svgLength(v string, def float64) float64 {
+	v = strings.TrimSpace(v)
+	mult := 1.0
+	switch {
+	case v == "", strings.HasSuffix(v, "%"):
+		return def
+	case strings.HasSuffix(v, "em"):
+		v, mult = strings.TrimSuffix(v, "em"), 16
+	default:
+		v = strings.TrimRight(v, "abcdefghijklmnopqrstuvwxyz")
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return def
+	}
+	return n * mult
+}
+
+func svgOpacity(v string, def float64) float64 {
+	v = strings.TrimSpace(v)
+	pct := strings.HasSuffix(v, "%")
+	n, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+	if err != nil {
+		return def
+	}
+	if pct {
+		n /= 100
+	}
+	return math.Max(0, math.Min(1, n))
+}
+
+// parseTransform parses a transform list; functions apply right to left.
+func parseTransform(v string) affine {
+	m := identity
+	for {
+		v = strings.TrimLeft(v, " \t\r\n,")
+		open := strings.IndexByte(v, '(')
+		end := strings.IndexByte(v, ')')
+		if open < 0 || end < open {
+			return m
+		}
+		name := strings.TrimSpace(v[:open])
+		args := svgNumbers(v[open+1 : end])
+		v = v[end+1:]
+		arg := func(i int, def float64) float64 {
+			if i < len(args) {
+				return args[i]
+			}
+			return def
+		}
+
+		var t affine
+		switch name {
+		case "matrix":
+			if len(args) != 6 {
+				return m
+			}
+			copy(t[:], args)
+		case "translate":
+			t = affine{1, 0, 0, 1, arg(0, 0), arg(1, 0)}
+		case "scale":
+			sx := arg(0, 1)
+			t = affine{sx, 0, 0, arg(1, sx), 0, 0}
+		case "rotate":
+			a := arg(0, 0) * math.Pi / 180
+			cos, sin := math.Cos(a), math.Sin(a)
+			cx, cy := arg(1, 0), arg(2, 0)
+			t = affine{1, 0, 0, 1, cx, cy}.
+				mul(affine{cos, sin, -sin, cos, 0, 0}).
+				mul(affine{1, 0, 0, 1, -cx, -cy})
+		case "skewX":
+			t = affine{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			t = affine{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		default:
+			return m
+		}
+		m = m.mul(t)
+	}
+}
+
+var svgNamedColors = map[string]color.NRGBA{
+	"black": {0, 0, 0, 255}, "white": {255, 255, 255, 255},
+	"red": {255, 0, 0, 255}, "green": {0, 128, 0, 255}, "blue": {0, 0, 255, 255},
+	"yellow": {255, 255, 0, 255}, "orange": {255, 165, 0, 255}, "purple": {128, 0, 128, 255},
+	"gray": {128, 128, 128, 255}, "grey": {128, 128, 128, 255},
+	"silver": {192, 192, 192, 255}, "lightgray": {211, 211, 211, 255}, "lightgrey": {211, 211, 211, 255},
+	"darkgray": {169, 169, 169, 255}, "darkgrey": {169, 169, 169, 255},
+	"navy": {0, 0, 128, 255}, "teal": {0, 128, 128, 255}, "maroon": {128, 0, 0, 255},
+	"olive": {128, 128, 0, 255}, "lime": {0, 255, 0, 255}, "aqua": {0, 255, 255, 255},
+	"cyan": {0, 255, 255, 255}, "fuchsia": {255, 0, 255, 255}, "magenta": {255, 0, 255, 255},
+	"pink": {255, 192, 203, 255}, "brown": {165, 42, 42, 255}, "gold": {255, 215, 0, 255},
+	"steelblue": {70, 130, 180, 255}, "skyblue": {135, 206, 235, 255},
+	"darkblue": {0, 0, 139, 255}, "darkgreen": {0, 100, 0, 255}, "darkred": {139, 0, 0, 255},
+	"whitesmoke": {245, 245, 245, 255}, "gainsboro": {220, 220, 220, 255},
+}
+
+// parseSVGColor parses #rgb, #rrggbb (with optional alpha), rgb()/rgba()
+// and the common named colours.
+func parseSVGColor(v string) (color.NRGBA, bool) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if c, ok := svgNamedColors[v]; ok {
+		return c, true
+	}
+	if strings.HasPrefix(v, "#") {
+		hex := v[1:]
+		if len(hex) == 3 || len(hex) == 4 {
+			var b strings.Builder
+			for _, ch := range hex {
+				b.WriteRune(ch)
+				b.WriteRune(ch)
+			}
+			hex = b.String()
+		}
+		if len(hex) != 6 && len(hex) != 8 {
+			return color.NRGBA{}, false
+		}
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return color.NRGBA{}, false
+		}
+		if len(hex) == 6 {
+			n = n<<8 | 0xFF
+		}
+		return color.NRGBA{uint8(n >> 24), uint8(n >> 16), uint8(n >> 8), uint8(n)}, true
+	}
+	if strings.HasPrefix(v, "rgb") {
+		open, end := strings.IndexByte(v, '('), strings.IndexByte(v, ')')
+		if open < 0 || end < open {
+			return color.NRGBA{}, false
+		}
+		parts := strings.FieldsFunc(v[open+1:end], func(r rune) bool { return r == ',' || r == ' ' || r == '/' })
+		if len(parts) < 3 {
+			return color.NRGBA{}, false
+		}
+		var ch [3]uint8
+		for i := range ch {
+			p := parts[i]
+			n, err := strconv.ParseFloat(strings.TrimSuffix(p, "%"), 64)
+			if err != nil {
+				return color.NRGBA{}, false
+			}
+			if strings.HasSuffix(p, "%") {
+				n = n * 255 / 100
+			}
+			ch[i] = uint8(math.Max(0, math.Min(255, math.Round(n))))
+		}
+		a := 1.0
+		if len(parts) > 3 {
+			a = svgOpacity(parts[3], 1)
+		}
+		return color.NRGBA{ch[0], ch[1], ch[2], uint8(math.Round(a * 255))}, true
+	}
+	return color.NRGBA{}, false
+}
@@ -0,0 +1,164 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func rgbAt(img image.Image, x, y int) [3]uint8 {
+	c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+	return [3]uint8{c.R, c.G, c.B}
+}
+
+func TestRasterizeSVG(t *testing.T) {
+	svg := `<?xml version="1.0"?>
+<!DOCTYPE svg>
+<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 50" width="100">
+  <defs>
+    <linearGradient id="g"><stop offset="0" style="stop-color:#00f"/><stop offset="1" stop-color="red"/></linearGradient>
+    <rect id="hidden" width="100" height="50" fill="black"/>
+  </defs>
+  <rect width="40" height="40" fill="#f00"/>
+  <g transform="translate(50 0)" style="fill: rgb(0, 128, 0)">
+    <path d="M0,0h20v20H0z"/>
+    <path d="m25 0 a10 10 0 1 1 0 20 a10 10 0 1 1 0-20z" fill="url(#g)"/>
+  </g>
+  <line x1="0" y1="45" x2="100" y2="45" stroke="black" stroke-width="2"/>
+  <circle cx="20" cy="20" r="5" display="none"/>
+</svg>`
+	img, err := rasterizeSVG(context.Background(), []byte(svg))
+	if err != nil {
+		t.Fatalf("rasterizeSVG: %v", err)
+	}
+	// 100x50 is scaled up so the long side is svgMinSide.
+	if b := img.Bounds(); b.Dx() != svgMinSide || b.Dy() != svgMinSide/2 {
+		t.Fatalf("size = %v", b)
+	}
+	k := float64(svgMinSide) / 100
+	at := func(x, y float64) [3]uint8 { return rgbAt(img, int(x*k), int(y*k)) }
+
+	for _, tc := range []struct {
+		name string
+		x, y float64
+		want [3]uint8
+	}{
+		{"rect", 20, 20, [3]uint8{255, 0, 0}},
+		{"inherited group fill", 60, 10, [3]uint8{0, 128, 0}},
+		{"gradient first stop", 80, 10, [3]uint8{0, 0, 255}},
+		{"stroke", 50, 45, [3]uint8{0, 0, 0}},
+		{"background", 45, 30, [3]uint8{255, 255, 255}},
+		{"hidden circle", 20.5, 20.5, [3]uint8{255, 0, 0}},
+	} {
+		if got := at(tc.x, tc.y); got != tc.want {
+			t.Errorf("%s: pixel at (%v,%v) = %v, want %v", tc.name, tc.x, tc.y, got, tc.want)
+		}
+	}
+}
+
+func TestRasterizeSVG_StrokedShapesAndErrors(t *testing.T) {
+	svg := `<svg width="256" height="256"><circle cx="128" cy="128" r="100" fill="none" stroke="blue" stroke-width="10"/></svg>`
+	img, err := rasterizeSVG(context.Background(), []byte(svg))
+	if err != nil {
+		t.Fatalf("rasterizeSVG: %v", err)
+	}
+	if got := rgbAt(img, 128, 128); got != [3]uint8{255, 255, 255} {
+		t.Errorf("unfilled centre = %v", got)
+	}
+	if got := rgbAt(img, 228, 128); got != [3]uint8{0, 0, 255} {
+		t.Errorf("ring = %v", got)
+	}
+
+	for _, bad := range []string{"", "<html><body/></html>", "not xml at all"} {
+		if _, err := rasterizeSVG(context.Background(), []byte(bad)); err == nil {
+			t.Errorf("rasterizeSVG(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRasterizeSVG_Bounded(t *testing.T) {
+	// Thousands of canvas-sized fills: the work budget ends the rendering
+	// early with what was drawn.
+	var b strings.Builder
+	b.WriteString(`<svg width="1024" height="1024">`)
+	for i := 0; i < 5000; i++ {
+		b.WriteString(`<rect width="1024" height="1024" fill="red" fill-opacity="0.01"/>`)
+	}
+	b.WriteString(`</svg>`)
+	r, err := renderSVG(context.Background(), []byte(b.String()))
+	if err != nil {
+		t.Fatalf("renderSVG: %v", err)
+	}
+	if r.work <= svgMaxWork {
+		t.Errorf("work = %d, want the budget of %d exceeded", r.work, svgMaxWork)
+	}
+	if r.elements > 200 {
+		t.Errorf("read %d elements, want rendering stopped soon after the budget ran out", r.elements)
+	}
+	if _, err := r.result(); err != nil {
+		t.Errorf("result: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := rasterizeSVG(ctx, []byte(`<svg><rect width="10" height="10"/></svg>`)); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled rendering = %v, want context.Canceled", err)
+	}
+}
+
+// FuzzRasterizeSVG checks that no document makes the renderer panic or
+// return neither an image nor an error.
+func FuzzRasterizeSVG(f *testing.F) {
+	for _, seed := range []string{
+		`<svg viewBox="0 0 10 10"><path d="M0 0L10 10"/></svg>`,
+		`<svg width="1e308" height="-5"><circle r="1e300"/></svg>`,
+		`<svg><path d="M1.5.5-2a1 1 0 00 1 1c1,2,3,4,5,6s1 2 3 4q1 2 3 4t1 1z" stroke="red" stroke-width="NaN"/></svg>`,
+		`<svg viewBox="0 0 0 0" transform="matrix(0 0 0 0 0 0)"><polygon points="1 2 3"/></svg>`,
+		`<svg><g transform="rotate(45 1e300 1) skewX(90)"><rect width="5" height="5" rx="-1"/></g></svg>`,
+		`<svg><linearGradient id="g"><stop stop-color="rgb(300,-1,50%)"/></linearGradient><rect fill="url(#g) #zzz" width="1" height="1"/></svg>`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		img, err := rasterizeSVG(context.Background(), data)
+		if err == nil && img == nil {
+			t.Fatal("no image and no error")
+		}
+	})
+}
+
+func TestSVGNumbers(t *testing.T) {
+	tests := map[string][]float64{
+		"0 0 24 24":     {0, 0, 24, 24},
+		"1.5.5-2e1,3":   {1.5, 0.5, -20, 3},
+		"10,20 30,40 x": {10, 20, 30, 40},
+		"1e":            {1},
+	}
+	for in, want := range tests {
+		if got := svgNumbers(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("svgNumbers(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestParseSVGColor(t *testing.T) {
+	tests := map[string]color.NRGBA{
+		"#abc":              {0xAA, 0xBB, 0xCC, 255},
+		"#11223380":         {0x11, 0x22, 0x33, 0x80},
+		"rgb(10%, 20, 255)": {26, 20, 255, 255},
+		"rgba(0,0,0,0.5)":   {0, 0, 0, 128},
+		"Teal":              {0, 128, 128, 255},
+	}
+	for in, want := range tests {
+		if got, ok := parseSVGColor(in); !ok || got != want {
+			t.Errorf("parseSVGColor(%q) = %v, %v, want %v", in, got, ok, want)
+		}
+	}
+	if _, ok := parseSVGColor("#12"); ok {
+		t.Error("accepted #12")
+	}
+}
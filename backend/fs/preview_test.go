@@ -0,0 +1,181 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// stubGenerator is a PreviewGenerator with a canned outcome.
+type stubGenerator struct {
+	name   string
+	accept string
+	img    image.Image
+	err    error
+	calls  *int
+	panics bool
+}
+
+func (g stubGenerator) Name() string                 { return g.name }
+func (g stubGenerator) Accepts(mimeType string) bool { return mimeType == g.accept }
+func (g stubGenerator) Generate(ctx context.Context, fullPath, mimeType string) (image.Image, error) {
+	if g.calls != nil {
+		*g.calls++
+	}
+	if g.panics {
+		panic("corrupt input")
+	}
+	return g.img, g.err
+}
+
+func newTestPreviewWorker(t *testing.T, generators ...PreviewGenerator) *previewWorker {
+	t.Helper()
+	root := t.TempDir()
+	s := &Service{cfg: Config{DataRoot: root}, root: newLibraryRoot(root)}
+	return newPreviewWorker(s, nil, generators)
+}
+
+func solidImage(w, h int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestPreviewGenerate_FallsBackInOrder(t *testing.T) {
+	var skipped, unused int
+	w := newTestPreviewWorker(t,
+		stubGenerator{name: "other", accept: "image/x-other", calls: &unused},
+		stubGenerator{name: "first", accept: "image/x-test", err: ErrNoPreview, calls: &skipped},
+		stubGenerator{name: "second", accept: "image/x-test", img: solidImage(2400, 100, color.White)},
+	)
+
+	data, phash, err := w.generate(context.Background(), previewJob{filePath: "a.test", mimeType: "image/x-test"})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if skipped != 1 || unused != 0 {
+		t.Errorf("calls: first=%d other=%d", skipped, unused)
+	}
+	thumb, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("thumbnail is not a JPEG: %v", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != thumbnailMaxWidth || b.Dy() != 50 {
+		t.Errorf("thumbnail size = %v", b)
+	}
+	if phash == nil {
+		t.Error("image preview has no perceptual hash")
+	}
+	if !w.accepts("image/x-test") || w.accepts("text/plain") {
+		t.Error("accepts does not follow the generators")
+	}
+}
+
+func TestPreviewGenerate_Outcomes(t *testing.T) {
+	boom := errors.New("boom")
+	tests := []struct {
+		name        string
+		generators  []PreviewGenerator
+		unsupported bool
+	}{
+		{"no generator", nil, true},
+		{"all skip", []PreviewGenerator{
+			stubGenerator{name: "a", accept: "video/x-test", err: ErrNoPreview},
+			stubGenerator{name: "b", accept: "video/x-test", err: ErrGeneratorUnavailable},
+		}, true},
+		{"real failure wins", []PreviewGenerator{
+			stubGenerator{name: "a", accept: "video/x-test", err: boom},
+			stubGenerator{name: "b", accept: "video/x-test", err: ErrGeneratorUnavailable},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Non-nil even when empty, so the defaults don't step in.
+			w := newTestPreviewWorker(t, append([]PreviewGenerator{}, tt.generators...)...)
+			_, _, err := w.generate(context.Background(), previewJob{filePath: "a.vid", mimeType: "video/x-test"})
+			if err == nil {
+				t.Fatal("generate succeeded")
+			}
+			unsupported := errors.Is(err, ErrNoPreview) || errors.Is(err, ErrGeneratorUnavailable)
+			if unsupported != tt.unsupported {
+				t.Errorf("err = %v, unsupported = %v", err, unsupported)
+			}
+			if !tt.unsupported && !errors.Is(err, boom) {
+				t.Errorf("err = %v, want boom", err)
+			}
+		})
+	}
+}
+
+func TestPreviewGenerate_PanicIsFailure(t *testing.T) {
+	var next int
+	w := newTestPreviewWorker(t,
+		stubGenerator{name: "fragile", accept: "image/x-test", panics: true},
+		stubGenerator{name: "fallback", accept: "image/x-test", img: solidImage(10, 10, color.White), calls: &next},
+	)
+	if _, _, err := w.generate(context.Background(), previewJob{filePath: "a.test", mimeType: "image/x-test"}); err != nil {
+		t.Fatalf("generate after a panicking generator: %v", err)
+	}
+	if next != 1 {
+		t.Error("fallback generator not tried after the panic")
+	}
+
+	w = newTestPreviewWorker(t, stubGenerator{name: "fragile", accept: "image/x-test", panics: true})
+	_, _, err := w.generate(context.Background(), previewJob{filePath: "a.test", mimeType: "image/x-test"})
+	if err == nil || errors.Is(err, ErrNoPreview) {
+		t.Fatalf("err = %v, want a generation failure", err)
+	}
+}
+
+func TestPreviewGenerate_CoverArt(t *testing.T) {
+	var pic bytes.Buffer
+	if err := png.Encode(&pic, solidImage(64, 64, color.NRGBA{200, 0, 0, 255})); err != nil {
+		t.Fatal(err)
+	}
+	body := append([]byte{0}, "image/png\x00\x03\x00"...)
+	body = append(body, pic.Bytes()...)
+	frame := append([]byte("APIC"), binary.BigEndian.AppendUint32(nil, uint32(len(body)))...)
+	frame = append(append(frame, 0, 0), body...)
+	n := len(frame)
+	mp3 := append([]byte{'I', 'D', '3', 3, 0, 0, byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}, frame...)
+
+	w := newTestPreviewWorker(t, DefaultPreviewGenerators()...)
+	if err := os.WriteFile(filepath.Join(w.service.cfg.DataRoot, "song.mp3"), mp3, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data, phash, err := w.generate(context.Background(), previewJob{filePath: "song.mp3", mimeType: "audio/mpeg"})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if phash != nil {
+		t.Error("audio got a perceptual hash")
+	}
+	thumb, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, _, _ := thumb.At(32, 32).RGBA(); r>>8 < 150 {
+		t.Errorf("thumbnail is not the cover: %v", thumb.At(32, 32))
+	}
+
+	// Without cover art the file is unsupported, not failed.
+	if err := os.WriteFile(filepath.Join(w.service.cfg.DataRoot, "bare.flac"), []byte("fLaC\x80\x00\x00\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = w.generate(context.Background(), previewJob{filePath: "bare.flac", mimeType: "audio/flac"})
+	if !errors.Is(err, ErrNoPreview) {
+		t.Errorf("bare.flac: err = %v, want ErrNoPreview", err)
+	}
+}
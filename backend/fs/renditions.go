@@ -0,0 +1,366 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+	"github.com/xiaoyuanzhu-com/my-life-db/utils"
+	"golang.org/x/image/draw"
+)
+
+// Renditions: resized copies of a file's preview image made on request and
+// cached in SQLAR next to the thumbnail.
+//
+//	<pathHash>/preview/thumbnail.jpg              thumbnail (preview worker)
+//	<pathHash>/preview/<size>-<version>.<ext>     named preview sizes
+//	<pathHash>/raw/<w>x<h>-<fit>-<version>.<ext>  ad-hoc /raw resizes
+//
+// version identifies the source file's content (size and mtime), so an
+// edited file never serves a stale copy; older versions are dropped when
+// a new one is stored. Sizes the thumbnail covers are cut from it instead
+// of decoding the original again.
+
+// Named preview sizes (bounding width in pixels).
+const (
+	PreviewSmall  = "small"  // grid tiles
+	PreviewMedium = "medium" // detail panes
+	PreviewLarge  = "large"  // lightbox
+)
+
+var previewSizeWidths = map[string]int{
+	PreviewSmall:  320,
+	PreviewMedium: 800,
+	PreviewLarge:  1920,
+}
+
+// Rendition output formats.
+const (
+	FormatJPEG = "jpeg"
+	FormatWebP = "webp"
+)
+
+// Fit modes for ResizeOptions, after CSS object-fit.
+const (
+	FitContain = "contain" // scale to fit inside the box
+	FitCover   = "cover"   // scale to cover the box, crop the overflow
+	FitFill    = "fill"    // stretch to the box
+)
+
+const (
+	// MaxResizeDimension bounds the requested width and height.
+	MaxResizeDimension = 4096
+	// maxRawVariants is how many ad-hoc resizes are kept per file.
+	maxRawVariants  = 8
+	renditionJPEGQ  = 82
+	renditionWebPQ  = 80
+	renditionPrefix = "preview"
+	rawPrefix       = "raw"
+)
+
+// ErrUnsupportedPreviewSize is returned for an unknown named size.
+var ErrUnsupportedPreviewSize = errors.New("unsupported preview size")
+
+// renditionSlots bounds concurrent renders: decoding a large photo takes
+// hundreds of megabytes.
+var renditionSlots = make(chan struct{}, max(2, runtime.NumCPU()/2))
+
+// ResizeOptions describes an ad-hoc resize. Zero Width or Height leaves
+// that side unconstrained; images are never scaled up.
+type ResizeOptions struct {
+	Width  int
+	Height int
+	Fit    string // FitContain (default), FitCover or FitFill
+	Format string // FormatJPEG (default) or FormatWebP
+}
+
+// Rendition is an encoded preview image.
+type Rendition struct {
+	Data     []byte
+	MimeType string
+	// Version identifies the source content and options; fit for an ETag.
+	Version string
+	ModTime time.Time
+}
+
+// RenditionVersion returns the version a rendition of path would carry
+// for variant, without rendering it, so callers can answer conditional
+// requests cheaply.
+func (s *Service) RenditionVersion(path, variant string) (string, error) {
+	info, err := s.statRegularFile(path)
+	if err != nil {
+		return "", err
+	}
+	return variant + "-" + sourceVersion(info), nil
+}
+
+// PreviewRendition returns the named preview size of a file, rendering
+// and caching it on first request. Any file with a preview generator
+// qualifies; format falls back to JPEG when WebP cannot be encoded.
+func (s *Service) PreviewRendition(ctx context.Context, path, size, format string) (*Rendition, error) {
+	width, ok := previewSizeWidths[size]
+	if !ok {
+		return nil, ErrUnsupportedPreviewSize
+	}
+	return s.rendition(ctx, path, renditionPrefix, size, ResizeOptions{Width: width, Format: format}, 0)
+}
+
+// ResizedImage returns an image file resized to opts, cached like the
+// named sizes (the few most recent per file).
+func (s *Service) ResizedImage(ctx context.Context, path string, opts ResizeOptions) (*Rendition, error) {
+	opts = opts.normalized()
+	return s.rendition(ctx, path, rawPrefix, opts.Variant(), opts, maxRawVariants)
+}
+
+// Variant names the resize for caching and ETags.
+func (o ResizeOptions) Variant() string {
+	o = o.normalized()
+	return fmt.Sprintf("%dx%d-%s", o.Width, o.Height, o.Fit)
+}
+
+// normalized clamps the box to MaxResizeDimension and defaults Fit.
+func (o ResizeOptions) normalized() ResizeOptions {
+	o.Width = max(0, min(o.Width, MaxResizeDimension))
+	o.Height = max(0, min(o.Height, MaxResizeDimension))
+	if o.Fit != FitCover && o.Fit != FitFill {
+		o.Fit = FitContain
+	}
+	return o
+}
+
+// rendition serves a cached variant or renders, stores and prunes it.
+// keep > 0 caps the variants kept under dir; otherwise only stale
+// versions of the same variant are dropped.
+func (s *Service) rendition(ctx context.Context, path, dir, variant string, opts ResizeOptions, keep int) (*Rendition, error) {
+	info, err := s.statRegularFile(path)
+	if err != nil {
+		return nil, err
+	}
+	version := variant + "-" + sourceVersion(info)
+	base := db.GeneratePathHash(path) + "/" + dir + "/"
+
+	format := opts.Format
+	if format != FormatWebP || !WebPAvailable() {
+		format = FormatJPEG
+	}
+	name := base + version + "." + renditionExt(format)
+	if data := s.cfg.DB.SqlarGet(name); data != nil {
+		return &Rendition{Data: data, MimeType: renditionMime(format), Version: version, ModTime: info.ModTime()}, nil
+	}
+
+	select {
+	case renditionSlots <- struct{}{}:
+		defer func() { <-renditionSlots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	src, err := s.renditionSource(ctx, path, info, opts)
+	if err != nil {
+		return nil, err
+	}
+	img := resizeImage(src, opts)
+
+	data, err := encodeRendition(ctx, img, format)
+	if err != nil && format == FormatWebP {
+		log.Warn().Err(err).Str("path", path).Msg("webp encoding failed, falling back to jpeg")
+		format = FormatJPEG
+		name = base + version + "." + renditionExt(format)
+		data, err = encodeRendition(ctx, img, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cfg.DB.SqlarStore(name, data, 0644) {
+		s.pruneRenditions(base, variant, version, keep)
+	}
+	return &Rendition{Data: data, MimeType: renditionMime(format), Version: version, ModTime: info.ModTime()}, nil
+}
+
+// renditionSource picks the image to scale: the stored thumbnail when it
+// is current and big enough, else a fresh render through the preview
+// generators.
+func (s *Service) renditionSource(ctx context.Context, path string, info os.FileInfo, opts ResizeOptions) (image.Image, error) {
+	if opts.Height == 0 && opts.Width > 0 && opts.Width <= thumbnailMaxWidth {
+		if img := s.currentThumbnail(path, info); img != nil {
+			return img, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+	return s.preview.render(ctx, s.root.abs(path), utils.DetectMimeType(path))
+}
+
+// currentThumbnail decodes the stored thumbnail if it was made from the
+// file as it is now. It is thumbnailMaxWidth wide, or narrower when that
+// is the whole image, so it serves any width up to thumbnailMaxWidth.
+func (s *Service) currentThumbnail(path string, info os.FileInfo) image.Image {
+	record, err := s.cfg.DB.GetFileByPath(path)
+	if err != nil || record == nil || record.PreviewSqlar == nil || record.PreviewStatus == nil ||
+		*record.PreviewStatus != db.PreviewStatusReady || record.ModifiedAt != info.ModTime().UnixMilli() {
+		return nil
+	}
+	data := s.cfg.DB.SqlarGet(*record.PreviewSqlar)
+	if data == nil {
+		return nil
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	return img
+}
+
+// pruneRenditions drops other versions of variant under base and, with
+// keep > 0, the oldest other entries beyond keep. The current version is
+// kept in every format.
+func (s *Service) pruneRenditions(base, variant, version string, keep int) {
+	entries := s.cfg.DB.SqlarList(base)
+	var others []db.SqlarFileInfo
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name, base+version+".") {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimPrefix(e.Name, base), variant+"-") {
+			s.cfg.DB.SqlarDelete(e.Name)
+			continue
+		}
+		if strings.HasSuffix(e.Name, "/thumbnail.jpg") {
+			continue
+		}
+		others = append(others, e)
+	}
+	if keep <= 0 || len(others) < keep {
+		return
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].Mtime < others[j].Mtime })
+	for _, e := range others[:len(others)-keep+1] {
+		s.cfg.DB.SqlarDelete(e.Name)
+	}
+}
+
+// statRegularFile validates path and stats it as a regular file.
+func (s *Service) statRegularFile(path string) (os.FileInfo, error) {
+	if err := s.ValidatePath(path); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(s.root.abs(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, ErrIsDirectory
+	}
+	return info, nil
+}
+
+// sourceVersion identifies a file's content by size and mtime.
+func sourceVersion(info os.FileInfo) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%d", info.Size(), info.ModTime().UnixNano())
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+func renditionExt(format string) string {
+	if format == FormatWebP {
+		return "webp"
+	}
+	return "jpg"
+}
+
+func renditionMime(format string) string {
+	if format == FormatWebP {
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
+
+func encodeRendition(ctx context.Context, img image.Image, format string) ([]byte, error) {
+	if format == FormatWebP {
+		return encodeWebP(ctx, img, renditionWebPQ)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: renditionJPEGQ}); err != nil {
+		return nil, fmt.Errorf("encode jpeg: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ---------- Resizing ----------
+
+// resizeImage scales src into the box described by opts without ever
+// scaling up.
+func resizeImage(src image.Image, opts ResizeOptions) image.Image {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	bw, bh := opts.Width, opts.Height
+	if sw == 0 || sh == 0 || (bw == 0 && bh == 0) {
+		return src
+	}
+	// One side missing: the box is unconstrained along it.
+	fit := opts.Fit
+	if bw == 0 || bh == 0 {
+		fit = FitContain
+		if bw == 0 {
+			bw = sw * bh / sh
+		} else {
+			bh = sh * bw / sw
+		}
+	}
+
+	switch fit {
+	case FitFill:
+		return scaleTo(src, b, min(bw, sw), min(bh, sh))
+	case FitCover:
+		// Crop the source to the box's aspect ratio, centred, then scale
+		// down (never up) to the box.
+		fill := math.Max(float64(bw)/float64(sw), float64(bh)/float64(sh))
+		cw := min(sw, int(float64(bw)/fill+0.5))
+		ch := min(sh, int(float64(bh)/fill+0.5))
+		crop := image.Rect(b.Min.X+(sw-cw)/2, b.Min.Y+(sh-ch)/2, 0, 0)
+		crop.Max = crop.Min.Add(image.Pt(cw, ch))
+		scale := math.Min(1, fill)
+		return scaleTo(src, crop, max(1, int(float64(cw)*scale+0.5)), max(1, int(float64(ch)*scale+0.5)))
+	default:
+		scale := math.Min(1, math.Min(float64(bw)/float64(sw), float64(bh)/float64(sh)))
+		if scale == 1 {
+			return src
+		}
+		return scaleTo(src, b, max(1, int(float64(sw)*scale+0.5)), max(1, int(float64(sh)*scale+0.5)))
+	}
+}
+
+// scaleTo scales the r part of src to w x h. Big reductions go through a
+// cheap bilinear pass to twice the target first, so the Catmull-Rom pass
+// that sets the quality stays small.
+func scaleTo(src image.Image, r image.Rectangle, w, h int) image.Image {
+	if r.Dx() == w && r.Dy() == h && r == src.Bounds() {
+		return src
+	}
+	if r.Dx() > 4*w && r.Dy() > 4*h {
+		mid := image.NewRGBA(image.Rect(0, 0, 2*w, 2*h))
+		draw.ApproxBiLinear.Scale(mid, mid.Bounds(), src, r, draw.Src, nil)
+		src, r = mid, mid.Bounds()
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, r, draw.Src, nil)
+	return dst
+}
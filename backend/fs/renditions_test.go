@@ -0,0 +1,199 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+)
+
+// sqlarDB is an in-memory Database with just the calls renditions make.
+type sqlarDB struct {
+	Database
+	entries map[string][]byte
+	stores  int
+}
+
+func (d *sqlarDB) GetFileByPath(path string) (*db.FileRecord, error) { return nil, nil }
+
+func (d *sqlarDB) SqlarStore(name string, data []byte, mode int) bool {
+	d.stores++
+	d.entries[name] = data
+	return true
+}
+
+func (d *sqlarDB) SqlarGet(name string) []byte { return d.entries[name] }
+
+func (d *sqlarDB) SqlarList(prefix string) []db.SqlarFileInfo {
+	var out []db.SqlarFileInfo
+	for name, data := range d.entries {
+		if strings.HasPrefix(name, prefix) {
+			out = append(out, db.SqlarFileInfo{Name: name, Size: len(data)})
+		}
+	}
+	return out
+}
+
+func (d *sqlarDB) SqlarDelete(name string) bool {
+	_, ok := d.entries[name]
+	delete(d.entries, name)
+	return ok
+}
+
+func TestResizeImage(t *testing.T) {
+	src := solidImage(400, 200, color.White)
+	tests := []struct {
+		name string
+		opts ResizeOptions
+		w, h int
+	}{
+		{"contain width", ResizeOptions{Width: 100}, 100, 50},
+		{"contain height", ResizeOptions{Height: 50}, 100, 50},
+		{"contain box", ResizeOptions{Width: 100, Height: 100}, 100, 50},
+		{"cover box", ResizeOptions{Width: 100, Height: 100, Fit: FitCover}, 100, 100},
+		{"fill box", ResizeOptions{Width: 100, Height: 100, Fit: FitFill}, 100, 100},
+		{"never upscales", ResizeOptions{Width: 800}, 400, 200},
+		{"cover larger than source", ResizeOptions{Width: 800, Height: 800, Fit: FitCover}, 200, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := resizeImage(src, tt.opts).Bounds()
+			if b.Dx() != tt.w || b.Dy() != tt.h {
+				t.Errorf("got %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.w, tt.h)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// Two pixels side by side: red on the left, blue on the right.
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	// Orientation 6 is stored rotated 90 anticlockwise; upright, the
+	// left pixel ends up on top.
+	out := orient(src, 6)
+	if b := out.Bounds(); b.Dx() != 1 || b.Dy() != 2 {
+		t.Fatalf("bounds = %v, want 1x2", b)
+	}
+	if out.At(0, 0) != red || out.At(0, 1) != blue {
+		t.Errorf("orientation 6: got %v, %v", out.At(0, 0), out.At(0, 1))
+	}
+
+	out = orient(src, 3)
+	if out.At(0, 0) != blue || out.At(1, 0) != red {
+		t.Errorf("orientation 3: got %v, %v", out.At(0, 0), out.At(1, 0))
+	}
+	if orient(src, 1) != image.Image(src) {
+		t.Error("orientation 1 should return the image unchanged")
+	}
+}
+
+func TestShrinkForOrientation(t *testing.T) {
+	for _, tc := range []struct {
+		w, h, orientation int
+		wantW, wantH      int // upright
+	}{
+		{3000, 1000, 3, 1200, 400},
+		{1000, 3000, 6, 1200, 400}, // stored on its side: upright 3000x1000
+		{3000, 1000, 8, 1000, 3000},
+		{800, 600, 6, 600, 800},
+	} {
+		src := image.NewRGBA(image.Rect(0, 0, tc.w, tc.h))
+		out := orient(shrinkForOrientation(src, tc.orientation, 1200), tc.orientation)
+		if b := out.Bounds(); b.Dx() != tc.wantW || b.Dy() != tc.wantH {
+			t.Errorf("%dx%d orientation %d: upright %v, want %dx%d", tc.w, tc.h, tc.orientation, b, tc.wantW, tc.wantH)
+		}
+	}
+}
+
+func TestPreviewRendition_CachesPerVersion(t *testing.T) {
+	root := t.TempDir()
+	store := &sqlarDB{entries: map[string][]byte{}}
+	s := NewService(Config{DataRoot: root, DB: store})
+
+	full := filepath.Join(root, "photo.png")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, solidImage(1000, 500, color.White)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	r, err := s.PreviewRendition(ctx, "photo.png", PreviewSmall, FormatJPEG)
+	if err != nil {
+		t.Fatalf("PreviewRendition: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(r.Data))
+	if err != nil {
+		t.Fatalf("decode rendition: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 320 || b.Dy() != 160 {
+		t.Errorf("small rendition is %v, want 320x160", b)
+	}
+
+	again, err := s.PreviewRendition(ctx, "photo.png", PreviewSmall, FormatJPEG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.stores != 1 || again.Version != r.Version {
+		t.Errorf("second request rendered again (stores=%d)", store.stores)
+	}
+
+	// A changed file gets a new version, and the old one is dropped.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(full, later, later); err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := s.PreviewRendition(ctx, "photo.png", PreviewSmall, FormatJPEG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Version == r.Version {
+		t.Error("version did not change with the file")
+	}
+	if len(store.entries) != 1 {
+		t.Errorf("cache holds %d entries, want 1", len(store.entries))
+	}
+
+	if _, err := s.PreviewRendition(ctx, "photo.png", "huge", FormatJPEG); err != ErrUnsupportedPreviewSize {
+		t.Errorf("unknown size: err = %v", err)
+	}
+}
+
+func TestResizedImage_KeepsFewVariants(t *testing.T) {
+	root := t.TempDir()
+	store := &sqlarDB{entries: map[string][]byte{}}
+	s := NewService(Config{DataRoot: root, DB: store})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, solidImage(300, 300, color.Black)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a.png"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for w := 10; w < 10+2*maxRawVariants; w++ {
+		if _, err := s.ResizedImage(context.Background(), "a.png", ResizeOptions{Width: w, Height: w, Fit: FitCover}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(store.entries) != maxRawVariants {
+		t.Errorf("cache holds %d variants, want %d", len(store.entries), maxRawVariants)
+	}
+}
@@ -2,11 +2,13 @@ package fs
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 )
 
@@ -17,6 +19,10 @@ const (
 	// Initial scan delay after startup
 	initialScanDelay = 10 * time.Second
 
+	// Delay before a rescan requested by an ignore-rule change, so a burst
+	// of edits (editor save sequences, several files) triggers one scan
+	rescanDelay = 2 * time.Second
+
 	// Max concurrent metadata processing during scan
 	maxScanConcurrency = 10
 
@@ -24,6 +30,20 @@ const (
 	// SQLITE_MAX_VARIABLE_NUMBER (999 on older builds) since each row uses one
 	// parameter per DELETE statement.
 	orphanDeleteBatchSize = 200
+
+	// Every fullScanEvery-th periodic scan is full: it lists every directory
+	// and stats every file, catching in-place edits that leave directory
+	// mtimes alone. With the default interval, about once a day.
+	fullScanEvery = 24
+
+	// Files needing processing are handed to processFiles, and directory
+	// snapshots saved, in batches of these sizes.
+	scanProcessBatchSize  = 500
+	scanSnapshotBatchSize = 500
+
+	// Caps on the samples kept in a scan report.
+	maxReportChangedDirs = 100
+	maxReportErrors      = 50
 )
 
 // scanner handles periodic filesystem scanning
@@ -35,6 +55,20 @@ type scanner struct {
 	// and the periodic ticker run in separate goroutines, so without this guard
 	// they can overlap when reconciliation outlasts the scan interval.
 	scanMu sync.Mutex
+
+	// periodic counts the scans run by the ticker, to make every
+	// fullScanEvery-th one full.
+	periodic int
+
+	// rescan carries requests for an out-of-schedule scan (see
+	// requestRescan); rescanTimer debounces them. rescanTrigger and
+	// rescanFull describe the scan requested, rescanFull set if any of the
+	// requests merged into it wanted a full one.
+	rescan        chan struct{}
+	rescanMu      sync.Mutex
+	rescanTimer   *time.Timer
+	rescanTrigger string
+	rescanFull    bool
 }
 
 // newScanner creates a new filesystem scanner
@@ -46,6 +80,7 @@ func newScanner(service *Service, interval time.Duration) *scanner {
 		service:  service,
 		interval: interval,
 		stopChan: make(chan struct{}),
+		rescan:   make(chan struct{}, 1),
 	}
 }
 
@@ -55,9 +90,10 @@ func (s *scanner) Start() error {
 		Dur("interval", s.interval).
 		Msg("starting filesystem scanner")
 
-	// Initial scan after delay
+	// Initial scan after delay. Incremental like the periodic ones: the
+	// snapshot makes it full only on first run.
 	time.AfterFunc(initialScanDelay, func() {
-		s.scan()
+		s.scan("startup", false)
 	})
 
 	// Periodic scans
@@ -68,7 +104,24 @@ func (s *scanner) Start() error {
 		for {
 			select {
 			case <-ticker.C:
-				s.scan()
+				s.periodic++
+				s.scan("interval", s.periodic%fullScanEvery == 0)
+			case <-s.rescan:
+				s.rescanMu.Lock()
+				trigger, full := s.rescanTrigger, s.rescanFull
+				s.rescanTrigger, s.rescanFull = "", false
+				s.rescanMu.Unlock()
+
+				// Unlike the ticker, a requested rescan waits for a scan
+				// in progress: that one may have walked with stale rules.
+				s.scanMu.Lock()
+				s.runScan(trigger, full)
+				s.scanMu.Unlock()
+				if w := s.service.watcher; w != nil && w.watcher != nil {
+					// Watch directories the new rules un-ignored.
+					w.watchRecursive(s.service.cfg.DataRoot)
+					w.watchMounts()
+				}
 			case <-s.stopChan:
 				ticker.Stop()
 				return
@@ -82,116 +135,475 @@ func (s *scanner) Start() error {
 
 // Stop stops the scanner
 func (s *scanner) Stop() {
+	s.rescanMu.Lock()
+	if s.rescanTimer != nil {
+		s.rescanTimer.Stop()
+	}
+	s.rescanMu.Unlock()
 	close(s.stopChan)
 }
 
-// scan performs a full filesystem scan with two phases:
-// Phase 1: Walk filesystem, identify files needing processing, track all seen paths
-// Phase 2: Reconcile - remove DB records for files that no longer exist on disk
-func (s *scanner) scan() {
+// requestRescan schedules a scan rescanDelay from now, pushing back one
+// already scheduled. full makes it list every directory, as an ignore-rule
+// change requires: directories the new rules un-ignore may sit in ones the
+// snapshot has as unchanged.
+func (s *scanner) requestRescan(trigger string, full bool) {
+	s.rescanMu.Lock()
+	defer s.rescanMu.Unlock()
+	s.rescanTrigger = trigger
+	s.rescanFull = s.rescanFull || full
+	if s.rescanTimer != nil {
+		s.rescanTimer.Stop()
+	}
+	s.rescanTimer = time.AfterFunc(rescanDelay, func() {
+		select {
+		case s.rescan <- struct{}{}:
+		default: // one already pending
+		}
+	})
+}
+
+// Rescan schedules an out-of-schedule scan, full or incremental. It runs
+// after the debounce of requestRescan, or once a scan in progress ends.
+func (s *Service) Rescan(full bool) {
+	s.scanner.requestRescan("api", full)
+}
+
+// ScanReports returns the reports of the most recent scans, newest first.
+func (s *Service) ScanReports(limit int) ([]db.ScanReport, error) {
+	return s.cfg.DB.ListScanReports(limit)
+}
+
+// scan runs a scan unless one is already in progress.
+func (s *scanner) scan(trigger string, full bool) {
 	if !s.scanMu.TryLock() {
 		log.Info().Msg("filesystem scan already in progress, skipping this invocation")
 		return
 	}
 	defer s.scanMu.Unlock()
+	s.runScan(trigger, full)
+}
 
-	log.Info().Str("root", s.service.cfg.DataRoot).Msg("starting filesystem scan")
+// runScan is the body of scan; the caller holds scanMu.
+//
+// The scan walks the tree one directory at a time against the snapshot in
+// scan_dirs. A directory whose mtime and inode match its snapshot has the
+// same entries as last time, so unless the scan is full it is not listed:
+// the walk only descends into the child directories the snapshot records.
+// A listed directory is reconciled on the spot — new and changed files are
+// processed, records of files no longer in it removed — so the scan never
+// holds more than one directory's entries per level of depth.
+//
+// Editing a file in place leaves its directory's mtime alone, so only full
+// scans (and the watcher, while running) see such edits.
+func (s *scanner) runScan(trigger string, full bool) {
+	log.Info().
+		Str("root", s.service.cfg.DataRoot).
+		Str("trigger", trigger).
+		Bool("full", full).
+		Msg("starting filesystem scan")
 	startTime := time.Now()
 
-	var filesToProcess []fileToProcess
-	seenPaths := make(map[string]bool) // Track all files seen on disk
+	w := &scanWalk{
+		scanner: s,
+		full:    full,
+		report:  db.ScanReport{Trigger: trigger, Full: full, StartedAt: startTime.UnixMilli()},
+	}
+	if info, err := os.Lstat(s.service.cfg.DataRoot); err != nil {
+		// Never reconcile against a missing root (an unmounted volume
+		// would look like a library with every file deleted).
+		w.fail("", err)
+	} else if prev, err := s.service.cfg.DB.GetScanDir(""); err != nil {
+		w.fail("", err)
+	} else {
+		w.dir("", info, prev)
+		w.flush()
+	}
+	w.report.DurationMs = time.Since(startTime).Milliseconds()
 
-	// Phase 1: Walk filesystem and identify files needing processing
-	var totalFiles, excludedFiles, dirs, symlinks int
-	err := filepath.Walk(s.service.cfg.DataRoot, func(path string, info os.FileInfo, err error) error {
+	// Cleanup stale lock entries to prevent memory leaks
+	if cleaned := s.service.fileLock.cleanupStale(); cleaned > 0 {
+		log.Info().
+			Int("cleanedLocks", cleaned).
+			Msg("cleaned up stale file locks")
+	}
+
+	// Check for files missing previews (backfill for pre-existing files)
+	s.service.preview.queueMissingPreviews()
+
+	if err := s.service.cfg.DB.SaveScanReport(&w.report); err != nil {
+		log.Warn().Err(err).Msg("failed to save scan report")
+	}
+
+	log.Info().
+		Bool("full", full).
+		Int("dirsListed", w.report.DirsListed).
+		Int("dirsChanged", w.report.DirsChanged).
+		Int("dirsSkipped", w.report.DirsSkipped).
+		Int("filesSeen", w.report.FilesSeen).
+		Int("filesProcessed", w.report.FilesProcessed).
+		Int("orphansRemoved", w.report.OrphansRemoved).
+		Int("dirsRemoved", w.report.DirsRemoved).
+		Int("errors", w.report.ErrorCount).
+		Dur("totalDuration", time.Since(startTime)).
+		Msg("filesystem scan complete")
+}
+
+// scanWalk is the state of one scan.
+type scanWalk struct {
+	scanner *scanner
+	full    bool
+	report  db.ScanReport
+
+	// pending holds files waiting to be processed, snapshots directories
+	// done with; both are written out in batches.
+	pending   []fileToProcess
+	snapshots []db.ScanDir
+	// failedDirs holds the directories with a file that failed to
+	// process; their snapshots are saved as never scanned.
+	failedDirs map[string]bool
+
+	// linked and linkedFiles hold the resolved targets of the symlinks
+	// followed so far, so each target is indexed once.
+	linked      []string
+	linkedFiles map[string]bool
+}
+
+// dir scans the directory rel, whose previous snapshot is prev (nil if it
+// has none). It reports whether rel and everything below it were scanned
+// completely; only then is rel's snapshot saved, after those of its
+// subdirectories, so a directory that failed (or a scan cut short) is
+// listed again next time rather than hidden behind an unchanged parent.
+func (w *scanWalk) dir(rel string, info os.FileInfo, prev *db.ScanDir) bool {
+	select {
+	case <-w.scanner.stopChan:
+		return false
+	default:
+	}
+
+	cur := db.ScanDir{Path: rel, Mtime: info.ModTime().UnixNano(), Inode: fileInode(info)}
+	if !w.full && prev != nil && *prev == cur {
+		w.report.DirsSkipped++
+		return w.descendSnapshot(rel)
+	}
+
+	if prev == nil || *prev != cur {
+		w.report.DirsChanged++
+		if len(w.report.ChangedDirs) < maxReportChangedDirs {
+			w.report.ChangedDirs = append(w.report.ChangedDirs, rel)
+		}
+	}
+	if !w.list(rel) {
+		return false
+	}
+	w.snapshots = append(w.snapshots, cur)
+	if len(w.snapshots) >= scanSnapshotBatchSize {
+		w.flush()
+	}
+	return true
+}
+
+// descendSnapshot scans the subdirectories of an unchanged directory, as
+// recorded in the snapshot.
+func (w *scanWalk) descendSnapshot(rel string) bool {
+	s := w.scanner.service
+	children, err := s.cfg.DB.ListScanDirs(rel)
+	if err != nil {
+		w.fail(rel, err)
+		return false
+	}
+	ok := true
+	for i := range children {
+		child := &children[i]
+		var info os.FileInfo
+		if s.root.isMountPoint(child.Path) {
+			info, err = os.Stat(s.root.abs(child.Path))
+		} else {
+			info, err = os.Lstat(s.root.abs(child.Path))
+		}
 		if err != nil {
-			return nil // Skip errors
+			w.fail(child.Path, err)
+			ok = false
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if info = w.followLink(child.Path); info == nil {
+				continue
+			}
+		}
+		if !info.IsDir() || s.validator.IsExcluded(child.Path) {
+			continue
+		}
+		if !w.dir(child.Path, info, child) {
+			ok = false
 		}
+	}
+	return ok
+}
+
+// list reads the directory rel from disk, scans its files and
+// subdirectories, and reconciles the index against it.
+func (w *scanWalk) list(rel string) bool {
+	s := w.scanner.service
+	entries, err := os.ReadDir(s.root.abs(rel))
+	if err != nil {
+		w.fail(rel, err)
+		return false
+	}
+	w.report.DirsListed++
+
+	snapshots, err := s.cfg.DB.ListScanDirs(rel)
+	if err != nil {
+		w.fail(rel, err)
+		return false
+	}
+	prevChildren := make(map[string]*db.ScanDir, len(snapshots))
+	for i := range snapshots {
+		prevChildren[snapshots[i].Path] = &snapshots[i]
+	}
 
-		// Get relative path
-		relPath, err := filepath.Rel(s.service.cfg.DataRoot, path)
+	ok := true
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+	mounts := s.root.mountsIn(rel)
+	for name, m := range mounts {
+		childRel := filepath.Join(rel, name)
+		if s.validator.IsExcluded(childRel) {
+			continue
+		}
+		// A mounted folder whose source is missing keeps its records: a
+		// detached disk is not a deleted folder.
+		dirs[name] = true
+		info, err := os.Stat(m.Source)
+		if err == nil && !info.IsDir() {
+			err = ErrNotDirectory
+		}
 		if err != nil {
-			return nil
+			w.fail(childRel, err)
+			ok = false
+			continue
+		}
+		if !w.dir(childRel, info, prevChildren[childRel]) {
+			ok = false
 		}
+	}
 
-		// Skip excluded paths (skip entire directory if excluded)
-		if s.service.validator.IsExcluded(relPath) {
-			if info.IsDir() {
-				return filepath.SkipDir
-			}
-			excludedFiles++
-			return nil
+	for _, e := range entries {
+		childRel := filepath.Join(rel, e.Name())
+
+		// Skip excluded paths (skip entire directory if excluded), and
+		// entries shadowed by a mounted folder
+		if _, shadowed := mounts[e.Name()]; shadowed || s.validator.IsExcluded(childRel) {
+			continue
 		}
 
-		// Skip directories (after exclusion check)
-		if info.IsDir() {
-			dirs++
-			return nil
+		info, err := e.Info()
+		if err != nil {
+			if !os.IsNotExist(err) {
+				w.fail(childRel, err)
+				ok = false
+			}
+			continue // removed since the listing
 		}
 
-		// Skip symlinks. filepath.Walk uses Lstat, so symlinks appear here as
-		// non-directory entries even when they point to directories. Without
-		// this guard, downstream metadata processing follows the link via
-		// os.Open and fails with "is a directory" for symlinked dirs (common
-		// in vendored speech/ML toolkits like Kaldi/PaddleSpeech that link
-		// shared utils/ folders into every example). Skipping all symlinks
-		// also avoids cycles and double-indexing of shared targets.
-		if info.Mode()&os.ModeSymlink != 0 {
-			symlinks++
-			return nil
+		// Skip symlinks unless they are followed. ReadDir does not follow
+		// them, so symlinks appear here as non-directory entries even when
+		// they point to directories. Without this guard, downstream
+		// metadata processing follows the link via os.Open and fails with
+		// "is a directory" for symlinked dirs (common in vendored
+		// speech/ML toolkits like Kaldi/PaddleSpeech that link shared
+		// utils/ folders into every example). followLink guards against
+		// cycles and double-indexing of shared targets.
+		if e.Type()&os.ModeSymlink != 0 {
+			if info = w.followLink(childRel); info == nil {
+				continue
+			}
 		}
 
-		totalFiles++
-		seenPaths[relPath] = true // Track this file as seen on disk
+		if info.IsDir() {
+			dirs[e.Name()] = true
+			if !w.dir(childRel, info, prevChildren[childRel]) {
+				ok = false
+			}
+			continue
+		}
 
-		// Check if file needs processing
-		needsProcessing, reason := s.checkNeedsProcessing(relPath, info)
-		if needsProcessing {
-			filesToProcess = append(filesToProcess, fileToProcess{
-				path:   relPath,
+		files[e.Name()] = true
+		w.report.FilesSeen++
+		if needsProcessing, reason := w.scanner.checkNeedsProcessing(childRel, info); needsProcessing {
+			w.pending = append(w.pending, fileToProcess{
+				path:   childRel,
 				info:   info,
 				reason: reason,
 			})
+			if len(w.pending) >= scanProcessBatchSize {
+				w.processPending()
+			}
 		}
+	}
 
-		return nil
-	})
+	// Snapshots of subdirectories that are gone (or now excluded) go too,
+	// whether or not they held indexed files.
+	for path := range prevChildren {
+		if !dirs[filepath.Base(path)] {
+			if err := s.cfg.DB.DeleteScanDirs(path); err != nil {
+				w.fail(path, err)
+				ok = false
+			}
+		}
+	}
+	return w.reconcile(rel, files, dirs) && ok
+}
 
+// followLink returns the info of what the symlink rel points at, or nil
+// when it is not to be indexed: following is off, the link is broken, or
+// its target lies in the library (indexed under its own path already) or
+// was reached through another link during this scan. For directories that
+// means overlapping one followed before, which also stops cycles: a link
+// back up into a followed directory overlaps it.
+func (w *scanWalk) followLink(rel string) os.FileInfo {
+	s := w.scanner.service
+	if !s.followSymlinks.Load() {
+		return nil
+	}
+	target, err := filepath.EvalSymlinks(s.root.abs(rel))
 	if err != nil {
-		log.Error().Err(err).Msg("scan walk error")
-		return
+		log.Debug().Err(err).Str("path", rel).Msg("skipping broken symlink")
+		return nil
+	}
+	if s.root.contains(target) {
+		return nil
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil
+	}
+	for _, seen := range w.linked {
+		if within(seen, target) || (info.IsDir() && within(target, seen)) {
+			log.Debug().Str("path", rel).Str("target", target).Msg("skipping symlink into a directory already followed")
+			return nil
+		}
+	}
+	if info.IsDir() {
+		w.linked = append(w.linked, target)
+		return info
+	}
+	if w.linkedFiles[target] {
+		return nil
 	}
+	if w.linkedFiles == nil {
+		w.linkedFiles = make(map[string]bool)
+	}
+	w.linkedFiles[target] = true
+	return info
+}
 
-	log.Info().
-		Int("totalFiles", totalFiles).
-		Int("filesNeedingProcessing", len(filesToProcess)).
-		Dur("walkDuration", time.Since(startTime)).
-		Msg("filesystem walk complete, processing files")
+// reconcile removes the records of files and directories that the index
+// has directly in rel but the listing does not. This handles files deleted
+// or moved while the server was stopped, or while the watcher missed them.
+func (w *scanWalk) reconcile(rel string, files, dirs map[string]bool) bool {
+	s := w.scanner.service
+	indexedFiles, indexedDirs, err := s.cfg.DB.ListIndexedChildren(rel)
+	if err != nil {
+		w.fail(rel, err)
+		return false
+	}
 
-	// Process files that need updates (in parallel with bounded concurrency)
-	if len(filesToProcess) > 0 {
-		s.processFiles(filesToProcess)
+	ok := true
+	var orphans []string
+	for _, name := range indexedFiles {
+		if !files[name] {
+			orphans = append(orphans, filepath.Join(rel, name))
+		}
+	}
+	// Delete orphans in chunks. One transaction per batch keeps the writer
+	// lock release frequent enough to not starve concurrent scan workers.
+	for i := 0; i < len(orphans); i += orphanDeleteBatchSize {
+		batch := orphans[i:min(i+orphanDeleteBatchSize, len(orphans))]
+		if err := s.cfg.DB.BatchDeleteFilesWithCascade(batch); err != nil {
+			w.fail(rel, err)
+			ok = false
+			continue
+		}
+		w.report.OrphansRemoved += len(batch)
+		for _, path := range batch {
+			s.fileLock.releaseFileLock(path)
+		}
 	}
 
-	// Phase 2: Reconcile - remove orphaned DB records
-	orphansRemoved := s.reconcileOrphans(seenPaths)
+	var gone []string
+	for _, name := range indexedDirs {
+		if !dirs[name] {
+			gone = append(gone, filepath.Join(rel, name))
+		}
+	}
+	for _, path := range gone {
+		if err := s.cfg.DB.DeleteFilesWithCascadePrefix(path); err != nil {
+			w.fail(path, err)
+			ok = false
+			continue
+		}
+		w.report.DirsRemoved++
+	}
 
-	// Cleanup stale lock entries to prevent memory leaks
-	if cleaned := s.service.fileLock.cleanupStale(); cleaned > 0 {
+	if len(orphans) > 0 || len(gone) > 0 {
 		log.Info().
-			Int("cleanedLocks", cleaned).
-			Msg("cleaned up stale file locks")
+			Str("dir", rel).
+			Int("orphans", len(orphans)).
+			Int("dirs", len(gone)).
+			Msg("removed records of vanished files")
 	}
+	return ok
+}
 
-	// Check for files missing previews (backfill for pre-existing files)
-	s.service.preview.queueMissingPreviews()
+// processPending processes the files queued so far.
+func (w *scanWalk) processPending() {
+	if len(w.pending) == 0 {
+		return
+	}
+	processed, failures := w.scanner.processFiles(w.pending)
+	w.report.FilesProcessed += processed
+	for _, f := range failures {
+		w.fail(f.Path, errors.New(f.Error))
+		if w.failedDirs == nil {
+			w.failedDirs = make(map[string]bool)
+		}
+		w.failedDirs[libraryPath(filepath.Dir(f.Path))] = true
+	}
+	w.pending = w.pending[:0]
+}
 
-	log.Info().
-		Int("totalFiles", totalFiles).
-		Int("filesProcessed", len(filesToProcess)).
-		Int("orphansRemoved", orphansRemoved).
-		Dur("totalDuration", time.Since(startTime)).
-		Msg("filesystem scan complete")
+// unscannedMtime marks a directory snapshot as never scanned: no directory
+// has it, so the next scan lists the directory again. Its row is kept so an
+// unchanged parent still leads there.
+const unscannedMtime = -1
+
+// flush processes pending files, then saves the directory snapshots
+// collected so far. Files go first: a directory must not be recorded as
+// scanned while files in it still wait, nor once one of them has failed.
+func (w *scanWalk) flush() {
+	w.processPending()
+	if len(w.snapshots) == 0 {
+		return
+	}
+	for i := range w.snapshots {
+		if w.failedDirs[w.snapshots[i].Path] {
+			w.snapshots[i].Mtime = unscannedMtime
+		}
+	}
+	if err := w.scanner.service.cfg.DB.SaveScanDirs(w.snapshots); err != nil {
+		w.fail("", err)
+	}
+	w.snapshots = w.snapshots[:0]
+}
+
+// fail records an error in the report.
+func (w *scanWalk) fail(path string, err error) {
+	log.Warn().Err(err).Str("path", path).Msg("filesystem scan error")
+	w.report.ErrorCount++
+	if len(w.report.Errors) < maxReportErrors {
+		w.report.Errors = append(w.report.Errors, db.ScanError{Path: path, Error: err.Error()})
+	}
 }
 
 // fileToProcess represents a file that needs processing
@@ -228,14 +640,15 @@ func (s *scanner) checkNeedsProcessing(path string, info os.FileInfo) (bool, str
 	return false, "" // File is up to date
 }
 
-// processFiles processes multiple files concurrently with bounded concurrency
-func (s *scanner) processFiles(files []fileToProcess) {
+// processFiles processes multiple files concurrently with bounded concurrency.
+// It returns how many were processed and the ones that failed.
+func (s *scanner) processFiles(files []fileToProcess) (int, []db.ScanError) {
 	// Use worker pool to limit concurrency
 	sem := make(chan struct{}, maxScanConcurrency)
 	var wg sync.WaitGroup
 
 	processed := 0
-	failed := 0
+	var failures []db.ScanError
 	var counterMu sync.Mutex
 
 	for _, file := range files {
@@ -262,7 +675,7 @@ func (s *scanner) processFiles(files []fileToProcess) {
 					Str("reason", f.reason).
 					Msg("failed to process file during scan")
 				counterMu.Lock()
-				failed++
+				failures = append(failures, db.ScanError{Path: f.path, Error: err.Error()})
 				counterMu.Unlock()
 			} else {
 				counterMu.Lock()
@@ -276,72 +689,11 @@ func (s *scanner) processFiles(files []fileToProcess) {
 
 	log.Info().
 		Int("processed", processed).
-		Int("failed", failed).
+		Int("failed", len(failures)).
 		Int("total", len(files)).
 		Msg("scan processing complete")
-}
-
-// reconcileOrphans removes DB records for files that no longer exist on disk.
-// This handles files deleted or moved while the server was stopped.
-// Returns the number of orphaned records removed.
-func (s *scanner) reconcileOrphans(seenPaths map[string]bool) int {
-	// Get all file paths from database
-	dbPaths, err := s.service.cfg.DB.ListAllFilePaths()
-	if err != nil {
-		log.Error().Err(err).Msg("failed to list file paths from database for reconciliation")
-		return 0
-	}
-
-	// Find orphans (in DB but not on disk)
-	var orphans []string
-	for _, dbPath := range dbPaths {
-		if !seenPaths[dbPath] {
-			orphans = append(orphans, dbPath)
-		}
-	}
-
-	if len(orphans) == 0 {
-		return 0
-	}
-
-	log.Info().
-		Int("count", len(orphans)).
-		Int("batchSize", orphanDeleteBatchSize).
-		Msg("found orphaned DB records, removing in batches")
-
-	// Delete orphans in chunks. One transaction per batch keeps the writer
-	// lock release frequent enough to not starve concurrent scan workers,
-	// while still cutting reconcile time from O(orphans) transactions to
-	// O(orphans/batchSize).
-	removed := 0
-	for i := 0; i < len(orphans); i += orphanDeleteBatchSize {
-		end := i + orphanDeleteBatchSize
-		if end > len(orphans) {
-			end = len(orphans)
-		}
-		batch := orphans[i:end]
-
-		if err := s.service.cfg.DB.BatchDeleteFilesWithCascade(batch); err != nil {
-			log.Warn().
-				Err(err).
-				Int("batchStart", i).
-				Int("batchSize", len(batch)).
-				Msg("failed to delete orphan batch")
-			continue
-		}
-
-		removed += len(batch)
-		for _, path := range batch {
-			s.service.fileLock.releaseFileLock(path)
-		}
-
-		log.Info().
-			Int("removed", removed).
-			Int("total", len(orphans)).
-			Msg("orphan batch removed")
-	}
 
-	return removed
+	return processed, failures
 }
 
 // processFile processes a single file during scan
@@ -0,0 +1,393 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+)
+
+// scanDB is an in-memory Database with what the scanner uses: file records,
+// the directory snapshot and scan reports.
+type scanDB struct {
+	Database
+	mu       sync.Mutex
+	files    map[string]*db.FileRecord
+	dirs     map[string]db.ScanDir
+	reports  []db.ScanReport
+	upserted []string
+	// failUpsert makes UpsertFile fail for these paths.
+	failUpsert map[string]bool
+}
+
+func newScanDB() *scanDB {
+	return &scanDB{files: map[string]*db.FileRecord{}, dirs: map[string]db.ScanDir{}}
+}
+
+func (d *scanDB) GetFileByPath(path string) (*db.FileRecord, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.files[path], nil
+}
+
+func (d *scanDB) UpsertFile(r *db.FileRecord) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.failUpsert[r.Path] {
+		return false, errors.New("upsert failed")
+	}
+	_, exists := d.files[r.Path]
+	d.files[r.Path] = r
+	d.upserted = append(d.upserted, r.Path)
+	return !exists, nil
+}
+
+func (d *scanDB) BatchDeleteFilesWithCascade(paths []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, p := range paths {
+		delete(d.files, p)
+	}
+	return nil
+}
+
+func (d *scanDB) DeleteFileWithCascade(path string) error {
+	return d.BatchDeleteFilesWithCascade([]string{path})
+}
+
+func (d *scanDB) DeleteFilesWithCascadePrefix(prefix string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for p := range d.files {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			delete(d.files, p)
+		}
+	}
+	return nil
+}
+
+func (d *scanDB) GetScanDir(path string) (*db.ScanDir, error) {
+	if sd, ok := d.dirs[path]; ok {
+		return &sd, nil
+	}
+	return nil, nil
+}
+
+func (d *scanDB) ListScanDirs(parent string) ([]db.ScanDir, error) {
+	var out []db.ScanDir
+	for p, sd := range d.dirs {
+		if p != "" && parentOf(p) == parent {
+			out = append(out, sd)
+		}
+	}
+	return out, nil
+}
+
+func (d *scanDB) SaveScanDirs(dirs []db.ScanDir) error {
+	for _, sd := range dirs {
+		d.dirs[sd.Path] = sd
+	}
+	return nil
+}
+
+func (d *scanDB) DeleteScanDirs(path string) error {
+	for p := range d.dirs {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			delete(d.dirs, p)
+		}
+	}
+	return nil
+}
+
+func (d *scanDB) ListIndexedChildren(dir string) ([]string, []string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var files, dirs []string
+	seen := map[string]bool{}
+	for p := range d.files {
+		rest, ok := p, dir == ""
+		if !ok {
+			rest, ok = strings.CutPrefix(p, dir+"/")
+		}
+		if !ok {
+			continue
+		}
+		if name, _, nested := strings.Cut(rest, "/"); nested {
+			if !seen[name] {
+				seen[name] = true
+				dirs = append(dirs, name)
+			}
+		} else {
+			files = append(files, name)
+		}
+	}
+	return files, dirs, nil
+}
+
+func (d *scanDB) SaveScanReport(r *db.ScanReport) error {
+	d.reports = append(d.reports, *r)
+	return nil
+}
+
+func (d *scanDB) GetFilesMissingPreviews(limit int) ([]db.FileWithMime, error) { return nil, nil }
+func (d *scanDB) GetImagesMissingPhash(limit int) ([]db.FileWithMime, error)   { return nil, nil }
+
+func parentOf(p string) string {
+	if i := strings.LastIndexByte(p, '/'); i >= 0 {
+		return p[:i]
+	}
+	return ""
+}
+
+func (d *scanDB) paths() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var out []string
+	for p := range d.files {
+		out = append(out, p)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// dirsMtime returns the snapshot mtime of a directory.
+func (d *scanDB) dirsMtime(path string) time.Time {
+	return time.Unix(0, d.dirs[path].Mtime)
+}
+
+func writeScanFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	full := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// touchDir moves a directory's mtime, as file systems with coarse
+// timestamps may not between two quick changes.
+func touchDir(t *testing.T, dir string, at time.Time) {
+	t.Helper()
+	if err := os.Chtimes(dir, at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScan_SkipsUnchangedDirsAndReconciles(t *testing.T) {
+	root := t.TempDir()
+	for _, p := range []string{"top.md", "a/1.md", "a/b/2.md", "a/b/3.md", "c/d/4.md"} {
+		writeScanFile(t, root, p, p)
+	}
+	store := newScanDB()
+	s := NewService(Config{DataRoot: root, DB: store})
+
+	s.scanner.runScan("startup", false)
+	if got := store.paths(); len(got) != 5 {
+		t.Fatalf("indexed %v after first scan", got)
+	}
+	first := store.reports[0]
+	if first.DirsListed != 5 || first.DirsChanged != 5 || first.FilesSeen != 5 || first.FilesProcessed != 5 {
+		t.Errorf("first scan report = %+v", first)
+	}
+
+	// Nothing changed: every directory matches its snapshot.
+	s.scanner.runScan("interval", false)
+	second := store.reports[1]
+	if second.DirsListed != 0 || second.DirsSkipped != 5 || second.FilesSeen != 0 {
+		t.Errorf("unchanged scan report = %+v", second)
+	}
+
+	// A file goes from a nested directory and a whole tree goes from the
+	// root, both behind the scanner's back; a/ itself is untouched.
+	later := time.Now().Add(time.Minute)
+	if err := os.Remove(filepath.Join(root, "a/b/2.md")); err != nil {
+		t.Fatal(err)
+	}
+	writeScanFile(t, root, "a/b/new.md", "new")
+	touchDir(t, filepath.Join(root, "a/b"), later)
+	if err := os.RemoveAll(filepath.Join(root, "c")); err != nil {
+		t.Fatal(err)
+	}
+	touchDir(t, root, later)
+
+	store.upserted = nil
+	s.scanner.runScan("interval", false)
+	third := store.reports[2]
+	if third.DirsListed != 2 || third.DirsSkipped != 1 || third.OrphansRemoved != 1 || third.DirsRemoved != 1 {
+		t.Errorf("incremental scan report = %+v", third)
+	}
+	want := []string{"a/1.md", "a/b/3.md", "a/b/new.md", "top.md"}
+	if got := store.paths(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("indexed %v, want %v", got, want)
+	}
+	if len(store.upserted) != 1 || store.upserted[0] != "a/b/new.md" {
+		t.Errorf("processed %v, want only the new file", store.upserted)
+	}
+	if _, ok := store.dirs["c"]; ok {
+		t.Error("snapshot of removed directory c was kept")
+	}
+
+	// An in-place edit leaves directory mtimes alone: only a full scan
+	// sees it.
+	writeScanFile(t, root, "a/1.md", "edited in place")
+	future := later.Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(root, "a/1.md"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	touchDir(t, filepath.Join(root, "a"), store.dirsMtime("a"))
+	store.upserted = nil
+	s.scanner.runScan("interval", true)
+	if full := store.reports[3]; full.DirsListed != 3 || full.DirsSkipped != 0 {
+		t.Errorf("full scan report = %+v", full)
+	}
+	if len(store.upserted) != 1 || store.upserted[0] != "a/1.md" {
+		t.Errorf("full scan processed %v, want the edited file", store.upserted)
+	}
+}
+
+func TestScan_UnreadableDirIsRetried(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("root reads directories regardless of permissions")
+	}
+	root := t.TempDir()
+	writeScanFile(t, root, "locked/x.md", "x")
+	store := newScanDB()
+	s := NewService(Config{DataRoot: root, DB: store})
+
+	locked := filepath.Join(root, "locked")
+	if err := os.Chmod(locked, 0o000); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0o755)
+
+	s.scanner.runScan("startup", false)
+	if r := store.reports[0]; r.ErrorCount != 1 || len(r.Errors) != 1 || r.Errors[0].Path != "locked" {
+		t.Errorf("report = %+v", r)
+	}
+	// Neither the unreadable directory nor its parent is recorded, so the
+	// next scan lists both again.
+	if len(store.dirs) != 0 {
+		t.Errorf("snapshot = %+v, want empty", store.dirs)
+	}
+
+	if err := os.Chmod(locked, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s.scanner.runScan("interval", false)
+	if got := store.paths(); len(got) != 1 || got[0] != "locked/x.md" {
+		t.Errorf("indexed %v after the directory became readable", got)
+	}
+}
+
+func TestScan_IndexesMountedFoldersAndKeepsThemWhenMissing(t *testing.T) {
+	root, ext := t.TempDir(), t.TempDir()
+	writeScanFile(t, root, "media/a.md", "a")
+	writeScanFile(t, root, "media/disk/shadowed.md", "hidden by the mount")
+	writeScanFile(t, ext, "2024/x.jpg", "x")
+	store := newScanDB()
+	s := NewService(Config{DataRoot: root, DB: store, Mounts: []Mount{{Path: "media/disk", Source: ext}}})
+
+	s.scanner.runScan("startup", false)
+	want := []string{"media/a.md", "media/disk/2024/x.jpg"}
+	if got := store.paths(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("indexed %v, want %v", got, want)
+	}
+
+	// A detached disk is reported, not treated as a deleted folder.
+	gone := ext + "-detached"
+	if err := os.Rename(ext, gone); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Rename(gone, ext)
+	s.scanner.runScan("interval", true)
+	if r := store.reports[1]; r.ErrorCount != 1 || r.Errors[0].Path != "media/disk" {
+		t.Errorf("report = %+v", r)
+	}
+	if got := store.paths(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("indexed %v with the source missing, want %v", got, want)
+	}
+
+	// Unmounting drops its files.
+	if err := s.SetMounts(nil); err != nil {
+		t.Fatal(err)
+	}
+	s.scanner.runScan("mounts", true)
+	want = []string{"media/a.md", "media/disk/shadowed.md"}
+	if got := store.paths(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("indexed %v after unmounting, want %v", got, want)
+	}
+}
+
+func TestScan_RetriesDirectoryWithFailedFile(t *testing.T) {
+	root := t.TempDir()
+	writeScanFile(t, root, "docs/a.md", "a")
+	writeScanFile(t, root, "docs/b.md", "b")
+	store := newScanDB()
+	store.failUpsert = map[string]bool{"docs/b.md": true}
+	s := NewService(Config{DataRoot: root, DB: store})
+
+	s.scanner.runScan("startup", false)
+	if r := store.reports[0]; r.ErrorCount != 1 || r.Errors[0].Path != "docs/b.md" {
+		t.Fatalf("report = %+v", r)
+	}
+
+	// Nothing changed on disk, but docs must be listed again for b.md.
+	store.failUpsert = nil
+	s.scanner.runScan("interval", false)
+	want := []string{"docs/a.md", "docs/b.md"}
+	if got := store.paths(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("indexed %v, want %v", got, want)
+	}
+
+	// Once indexed, docs is skipped like any unchanged directory.
+	s.scanner.runScan("interval", false)
+	if r := store.reports[2]; r.DirsListed != 0 {
+		t.Errorf("third scan listed %d directories, want 0", r.DirsListed)
+	}
+}
+
+func TestScan_FollowsSymlinksOnceWithoutCycles(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	writeScanFile(t, root, "notes/n.md", "n")
+	writeScanFile(t, outside, "shared/s.md", "s")
+	writeScanFile(t, outside, "single.md", "one")
+	for link, target := range map[string]string{
+		"a-shared":       filepath.Join(outside, "shared"),
+		"b-shared-again": filepath.Join(outside, "shared"),
+		"c-single.md":    filepath.Join(outside, "single.md"),
+		"d-notes":        filepath.Join(root, "notes"),
+		"e-broken":       filepath.Join(outside, "missing"),
+		"0-outside":      outside,
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(outside, "shared", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	store := newScanDB()
+	s := NewService(Config{DataRoot: root, DB: store})
+
+	s.scanner.runScan("startup", false)
+	if got := store.paths(); strings.Join(got, ",") != "notes/n.md" {
+		t.Fatalf("indexed %v with symlinks off", got)
+	}
+
+	s.SetFollowSymlinks(true)
+	s.scanner.runScan("symlinks", true)
+	// The first link to a directory wins; later links into it, the loop
+	// inside it and the link back into the library are skipped.
+	want := []string{"0-outside/shared/s.md", "0-outside/single.md", "notes/n.md"}
+	if got := store.paths(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("indexed %v, want %v", got, want)
+	}
+}
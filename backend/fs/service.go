@@ -4,8 +4,10 @@ import (
 	"context"
 	"io"
 	"sync"
+	"sync/atomic"
 
 	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/jobs"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 )
 
@@ -18,6 +20,12 @@ type Service struct {
 	// Configuration
 	cfg Config
 
+	// root maps library paths to disk (the data root plus mounted
+	// folders); shared with the validator.
+	root *libraryRoot
+	// followSymlinks makes the scanner index what symlinks point at.
+	followSymlinks atomic.Bool
+
 	// Sub-components
 	validator *validator
 	processor *metadataProcessor
@@ -42,15 +50,22 @@ type Service struct {
 func NewService(cfg Config) *Service {
 	s := &Service{
 		cfg:        cfg,
-		validator:  newValidator(),
+		validator:  newValidator(cfg.DataRoot),
 		fileLock:   &fileLock{},
 		stopChan:   make(chan struct{}),
 		changeChan: make(chan FileChangeEvent, changeNotificationBufferSize),
 	}
 
+	s.root = s.validator.root
+	s.validator.ignore.setPatterns(cfg.IgnorePatterns)
+	if err := s.root.setMounts(cfg.Mounts); err != nil {
+		log.Error().Err(err).Msg("ignoring mounted folders")
+	}
+	s.followSymlinks.Store(cfg.FollowSymlinks)
+
 	// Initialize sub-components
 	s.processor = newMetadataProcessor(s)
-	s.preview = newPreviewWorker(s, cfg.PreviewNotifier)
+	s.preview = newPreviewWorker(s, cfg.PreviewNotifier, cfg.PreviewGenerators)
 
 	// Only create watcher if enabled
 	if cfg.WatchEnabled {
@@ -173,13 +188,13 @@ func (s *Service) changeNotificationWorker() {
 			// Queue preview generation if needed
 			if event.ContentChanged || event.IsNew {
 				file, _ := s.cfg.DB.GetFileByPath(event.FilePath)
-				if file != nil && file.MimeType != nil && needsPreview(*file.MimeType) {
+				if file != nil && file.MimeType != nil && s.preview.accepts(*file.MimeType) {
 					// Set preview_status to pending (reset any previous failure)
 					_ = s.cfg.DB.UpdateFileField(event.FilePath, "preview_status", db.PreviewStatusPending)
 					s.preview.enqueue(previewJob{
 						filePath: event.FilePath,
 						mimeType: *file.MimeType,
-					})
+					}, jobs.PriorityNormal)
 				}
 			}
 
@@ -212,6 +227,20 @@ func (s *Service) IsExcluded(path string) bool {
 	return s.validator.IsExcluded(path)
 }
 
+// ExplainExcluded reports whether a path is excluded from indexing and
+// which rule decided it.
+func (s *Service) ExplainExcluded(path string) IgnoreMatch {
+	return s.validator.explainExcluded(path)
+}
+
+// SetIgnorePatterns replaces the settings-level ignore patterns and
+// rescans so files the change newly ignores (or un-ignores) are dropped
+// from (or added to) the index.
+func (s *Service) SetIgnorePatterns(patterns []string) {
+	s.validator.ignore.setPatterns(patterns)
+	s.ignoreRulesChanged()
+}
+
 // DataRoot returns the root directory for user data files
 func (s *Service) DataRoot() string {
 	return s.cfg.DataRoot
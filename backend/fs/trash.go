@@ -0,0 +1,278 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// TrashDir is the folder files are moved to instead of being deleted
+// outright (duplicate resolution). It sits at the top of the trashing
+// user's data root, the library root for unscoped users, so a member's
+// trash stays inside what they can reach. Each trashing lands in a
+// timestamped batch folder that mirrors the original path below that root,
+// so restoring is a move back. A folder of this name is never indexed,
+// wherever it is; emptying it is up to the user.
+const TrashDir = ".trash"
+
+// trashBatchAttempts bounds the numbered variants of a batch tried when the
+// file's trash path is already taken.
+const trashBatchAttempts = 100
+
+// ErrContentMismatch is returned when two files expected to be identical
+// are not.
+var ErrContentMismatch = errors.New("file contents differ")
+
+// ErrCrossDevice is returned when a hard link would have to span two
+// filesystems, e.g. a mounted folder and the data directory.
+var ErrCrossDevice = errors.New("files are on different devices")
+
+// TrashBatch returns a fresh batch folder name for one trashing operation.
+func TrashBatch(now time.Time) string {
+	return now.UTC().Format("20060102-150405.000")
+}
+
+// TrashFile moves a file into <root>/TrashDir/batch/<path below root> and
+// drops it from the index (files, pins, files_fts, file_media). root is the
+// library folder whose trash receives the file ("" for the library root)
+// and must contain path. When that trash path is taken, say by the same
+// path trashed earlier in the same batch, the batch gets a numeric suffix.
+// Returns the trash path.
+func (s *Service) TrashFile(ctx context.Context, path, root, batch string) (string, error) {
+	root, below, err := s.trashTarget(path, root)
+	if err != nil {
+		return "", err
+	}
+
+	mu := s.fileLock.acquireFileLock(path)
+	mu.Lock()
+	defer mu.Unlock()
+
+	return s.moveToTrash(path, root, below, batch)
+}
+
+// TrashDuplicate is TrashFile for a duplicate of keep: it first checks
+// byte for byte that dup still holds the same content as keep, and leaves
+// it in place with ErrContentMismatch when it no longer does.
+func (s *Service) TrashDuplicate(ctx context.Context, keep, dup, root, batch string) (string, error) {
+	if err := s.ValidatePath(keep); err != nil {
+		return "", err
+	}
+	root, below, err := s.trashTarget(dup, root)
+	if err != nil {
+		return "", err
+	}
+	if keep == dup {
+		return "", ErrInvalidPath
+	}
+
+	locks := s.acquireMultipleLocks(keep, dup)
+	defer s.releaseMultipleLocks(locks)
+
+	if _, err := s.verifyDuplicate(keep, dup); err != nil {
+		return "", err
+	}
+	return s.moveToTrash(dup, root, below, batch)
+}
+
+// trashTarget validates a path to trash under root and returns the
+// normalized root and the path below it.
+func (s *Service) trashTarget(path, root string) (string, string, error) {
+	if err := s.ValidatePath(path); err != nil {
+		return "", "", err
+	}
+	if isTrashPath(path) {
+		return "", "", ErrInvalidPath
+	}
+	root = strings.Trim(filepath.ToSlash(root), "/")
+	below := path
+	if root != "" {
+		if !strings.HasPrefix(path, root+"/") {
+			return "", "", ErrInvalidPath
+		}
+		below = strings.TrimPrefix(path, root+"/")
+	}
+	return root, below, nil
+}
+
+// moveToTrash does the move for TrashFile. The caller holds path's lock.
+func (s *Service) moveToTrash(path, root, below, batch string) (string, error) {
+	fullPath := s.root.abs(path)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrFileNotFound
+		}
+		return "", fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		return "", ErrIsDirectory
+	}
+
+	var trashPath, trashFull string
+	for i := 1; ; i++ {
+		if i > trashBatchAttempts {
+			return "", fmt.Errorf("trash path already exists: %s", trashPath)
+		}
+		name := batch
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d", batch, i)
+		}
+		trashPath = filepath.ToSlash(filepath.Join(root, TrashDir, name, below))
+		trashFull = s.root.abs(trashPath)
+		if _, err := os.Lstat(trashFull); os.IsNotExist(err) {
+			break
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(trashFull), 0755); err != nil {
+		return "", fmt.Errorf("failed to create trash directory: %w", err)
+	}
+	if err := s.renameAcross(fullPath, trashFull); err != nil {
+		return "", fmt.Errorf("failed to move file to trash: %w", err)
+	}
+
+	if err := s.cfg.DB.DeleteFileWithCascade(path); err != nil {
+		return "", fmt.Errorf("failed to delete file from database: %w", err)
+	}
+	s.fileLock.releaseFileLock(path)
+
+	log.Info().Str("path", path).Str("trash", trashPath).Msg("file moved to trash")
+	return trashPath, nil
+}
+
+// ReplaceWithHardlink replaces dup with a hard link to keep after checking
+// byte for byte that both hold the same content. The two paths then share
+// one copy on disk; the index keeps both records. Fails on filesystems
+// without hard links, and with ErrCrossDevice across devices.
+func (s *Service) ReplaceWithHardlink(ctx context.Context, keep, dup string) error {
+	if err := s.ValidatePath(keep); err != nil {
+		return err
+	}
+	if err := s.ValidatePath(dup); err != nil {
+		return err
+	}
+	if keep == dup {
+		return ErrInvalidPath
+	}
+
+	locks := s.acquireMultipleLocks(keep, dup)
+	defer s.releaseMultipleLocks(locks)
+
+	linked, err := s.verifyDuplicate(keep, dup)
+	if err != nil {
+		return err
+	}
+	if linked {
+		return nil
+	}
+
+	keepFull := s.root.abs(keep)
+	dupFull := s.root.abs(dup)
+	// Link next to dup, then rename over it: dup never goes missing.
+	tmp := filepath.Join(filepath.Dir(dupFull), "."+filepath.Base(dupFull)+".mldb-link")
+	_ = os.Remove(tmp)
+	if err := os.Link(keepFull, tmp); err != nil {
+		if errors.Is(err, syscall.EXDEV) {
+			return ErrCrossDevice
+		}
+		return fmt.Errorf("failed to create hard link: %w", err)
+	}
+	if err := os.Rename(tmp, dupFull); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to replace file with hard link: %w", err)
+	}
+
+	log.Info().Str("keep", keep).Str("dup", dup).Msg("duplicate replaced with hard link")
+	return nil
+}
+
+// verifyDuplicate checks that dup holds the same content as keep, with
+// ErrContentMismatch when it does not. linked reports that both are
+// already the same file. The caller holds both locks.
+func (s *Service) verifyDuplicate(keep, dup string) (linked bool, err error) {
+	keepFull := s.root.abs(keep)
+	dupFull := s.root.abs(dup)
+	keepInfo, err := os.Stat(keepFull)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, ErrFileNotFound
+		}
+		return false, err
+	}
+	dupInfo, err := os.Stat(dupFull)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, ErrFileNotFound
+		}
+		return false, err
+	}
+	if keepInfo.IsDir() || dupInfo.IsDir() {
+		return false, ErrIsDirectory
+	}
+	if os.SameFile(keepInfo, dupInfo) {
+		return true, nil
+	}
+	same, err := sameContent(keepFull, dupFull, keepInfo.Size(), dupInfo.Size())
+	if err != nil {
+		return false, err
+	}
+	if !same {
+		return false, ErrContentMismatch
+	}
+	return false, nil
+}
+
+// sameContent compares two files byte for byte.
+func sameContent(a, b string, sizeA, sizeB int64) (bool, error) {
+	if sizeA != sizeB {
+		return false, nil
+	}
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA := make([]byte, 64<<10)
+	bufB := make([]byte, 64<<10)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if na != nb || !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+// isTrashPath reports whether path is a TrashDir or inside one.
+func isTrashPath(path string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(filepath.Clean(path)), "/") {
+		if part == TrashDir {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+)
+
+func TestTrashFile_IntoDataRootTrash(t *testing.T) {
+	root := t.TempDir()
+	writeScanFile(t, root, "members/ann/photos/a.jpg", "first")
+	writeScanFile(t, root, "top.md", "top")
+	store := newScanDB()
+	store.files["members/ann/photos/a.jpg"] = &db.FileRecord{Path: "members/ann/photos/a.jpg"}
+	s := NewService(Config{DataRoot: root, DB: store})
+	ctx := context.Background()
+	batch := TrashBatch(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	got, err := s.TrashFile(ctx, "members/ann/photos/a.jpg", "members/ann", batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "members/ann/.trash/20260102-030405.000/photos/a.jpg"; got != want {
+		t.Fatalf("trash path = %q, want %q", got, want)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, got)); err != nil || string(data) != "first" {
+		t.Fatalf("trashed file = %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "members/ann/photos/a.jpg")); !os.IsNotExist(err) {
+		t.Fatalf("original still there: %v", err)
+	}
+	if store.files["members/ann/photos/a.jpg"] != nil {
+		t.Fatal("trashed file still indexed")
+	}
+	if !isTrashPath(got) {
+		t.Fatalf("%q not recognized as trash", got)
+	}
+
+	// The same path trashed again in the same batch does not collide.
+	writeScanFile(t, root, "members/ann/photos/a.jpg", "second")
+	again, err := s.TrashFile(ctx, "members/ann/photos/a.jpg", "members/ann", batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "members/ann/.trash/20260102-030405.000-2/photos/a.jpg"; again != want {
+		t.Fatalf("second trash path = %q, want %q", again, want)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, got)); string(data) != "first" {
+		t.Fatalf("first trashed copy overwritten: %q", data)
+	}
+
+	// Outside the given root, and from inside a trash, nothing moves.
+	if _, err := s.TrashFile(ctx, "top.md", "members/ann", batch); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("trash outside root = %v, want ErrInvalidPath", err)
+	}
+	if _, err := s.TrashFile(ctx, got, "members/ann", batch); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("trash from trash = %v, want ErrInvalidPath", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "top.md")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplaceWithHardlink(t *testing.T) {
+	root := t.TempDir()
+	writeScanFile(t, root, "keep.bin", "same bytes")
+	writeScanFile(t, root, "dup.bin", "same bytes")
+	writeScanFile(t, root, "near.bin", "same bytez")
+	s := NewService(Config{DataRoot: root, DB: newScanDB()})
+	ctx := context.Background()
+
+	// Same size, different bytes: refused, and the file is untouched.
+	if err := s.ReplaceWithHardlink(ctx, "keep.bin", "near.bin"); !errors.Is(err, ErrContentMismatch) {
+		t.Fatalf("near duplicate = %v, want ErrContentMismatch", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "near.bin")); string(data) != "same bytez" {
+		t.Fatalf("near duplicate changed: %q", data)
+	}
+
+	if err := s.ReplaceWithHardlink(ctx, "keep.bin", "dup.bin"); err != nil {
+		t.Fatal(err)
+	}
+	keep, _ := os.Stat(filepath.Join(root, "keep.bin"))
+	dup, _ := os.Stat(filepath.Join(root, "dup.bin"))
+	if !os.SameFile(keep, dup) {
+		t.Fatal("dup is not a hard link of keep")
+	}
+	// Linking again is a no-op.
+	if err := s.ReplaceWithHardlink(ctx, "keep.bin", "dup.bin"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplaceWithHardlink_CrossDevice(t *testing.T) {
+	root := t.TempDir()
+	ext, err := os.MkdirTemp("/dev/shm", "mldb-trash-test")
+	if err != nil {
+		t.Skipf("no second filesystem: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(ext) })
+	var rootStat, extStat syscall.Stat_t
+	if syscall.Stat(root, &rootStat) != nil || syscall.Stat(ext, &extStat) != nil || rootStat.Dev == extStat.Dev {
+		t.Skip("temp dir and /dev/shm share a device")
+	}
+
+	writeScanFile(t, root, "keep.bin", "same bytes")
+	writeScanFile(t, ext, "dup.bin", "same bytes")
+	s := NewService(Config{DataRoot: root, DB: newScanDB(), Mounts: []Mount{{Path: "disk", Source: ext}}})
+
+	if err := s.ReplaceWithHardlink(context.Background(), "keep.bin", "disk/dup.bin"); !errors.Is(err, ErrCrossDevice) {
+		t.Fatalf("cross-device link = %v, want ErrCrossDevice", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(ext, "dup.bin")); err != nil || string(data) != "same bytes" {
+		t.Fatalf("dup after failed link = %q, %v", data, err)
+	}
+	entries, _ := os.ReadDir(ext)
+	if len(entries) != 1 {
+		t.Fatalf("left behind in the mount: %v", entries)
+	}
+}
@@ -15,6 +15,7 @@ type WriteRequest struct {
 	Source          string    // "api", "upload", "external" (for logging)
 	ComputeMetadata bool      // Compute hash + preview immediately?
 	Sync            bool      // Wait for metadata or async?
+	ModTime         time.Time // Optional; stamped on the file instead of the write time
 }
 
 // WriteResult contains information about the write operation
@@ -40,6 +41,12 @@ type FileChangeEvent struct {
 	Trigger        string // "fsnotify", "api", "scan"
 }
 
+// JobQueue schedules persistent background work; *jobs.Queue implements
+// it.
+type JobQueue interface {
+	Enqueue(kind, key string, priority int)
+}
+
 // FileChangeHandler is called when files change (e.g., to update derived state).
 type FileChangeHandler func(event FileChangeEvent)
 
@@ -53,14 +60,53 @@ type Config struct {
 	// Preview notification callback (optional, for SSE)
 	PreviewNotifier PreviewNotifier
 
+	// Preview generators, tried in order (optional; nil means
+	// DefaultPreviewGenerators).
+	PreviewGenerators []PreviewGenerator
+
+	// Background job queue (optional). When set, preview work is queued
+	// there under PreviewJobKind and PhashJobKind, to be run by
+	// RunPreviewJob and RunPhashJob; otherwise it goes through a bounded
+	// in-memory channel that drops work when full and forgets it on
+	// restart.
+	Jobs JobQueue
+
 	// Library notification callback (optional, for SSE).
 	// Fired when the watcher detects external file create/write/move/delete
 	// — i.e., changes that did NOT originate from an API handler. Lets the
 	// notifications service publish library-changed without fs/ depending
 	// on the notifications package.
 	LibraryNotifier LibraryNotifier
+
+	// Write limits callback (optional). Consulted on every WriteFile;
+	// nil means unlimited.
+	WriteLimits WriteLimitsFunc
+
+	// Settings-level ignore patterns (gitignore syntax, optional). Change
+	// them at runtime with Service.SetIgnorePatterns.
+	IgnorePatterns []string
+
+	// Mounted folders: directories outside DataRoot indexed under a
+	// library path (optional). Change them at runtime with
+	// Service.SetMounts.
+	Mounts []Mount
+
+	// FollowSymlinks indexes the files and directories symlinks point at,
+	// when those lie outside the library; symlinks are skipped otherwise.
+	FollowSymlinks bool
+}
+
+// WriteLimits bounds a single write.
+type WriteLimits struct {
+	MaxFileSize int64  // bytes; 0 = unlimited
+	QuotaFolder string // folder whose quota applies; "" = none
+	QuotaLeft   int64  // bytes QuotaFolder may still grow by (indexed sizes)
 }
 
+// WriteLimitsFunc returns the limits for a write to path (relative to the
+// data root).
+type WriteLimitsFunc func(path string) WriteLimits
+
 // LibraryNotifier is called after the watcher reconciles an external
 // filesystem change. `operation` is one of "create", "write", "move", "delete".
 // For "move", `path` is the new path.
@@ -83,10 +129,23 @@ type Database interface {
 	BatchDeleteFilesWithCascade(paths []string) error
 	DeleteFilesWithCascadePrefix(pathPrefix string) error
 
+	// Incremental scan snapshot and reports
+	GetScanDir(path string) (*db.ScanDir, error)
+	ListScanDirs(parent string) ([]db.ScanDir, error)
+	SaveScanDirs(dirs []db.ScanDir) error
+	DeleteScanDirs(path string) error
+	ListIndexedChildren(dir string) (files, dirs []string, err error)
+	SaveScanReport(r *db.ScanReport) error
+	ListScanReports(limit int) ([]db.ScanReport, error)
+
 	// Preview operations
 	GetFilesMissingPreviews(limit int) ([]db.FileWithMime, error)
+	GetImagesMissingPhash(limit int) ([]db.FileWithMime, error)
 
 	// SQLAR operations (for preview storage)
 	SqlarStore(name string, data []byte, mode int) bool
 	SqlarExists(name string) bool
+	SqlarGet(name string) []byte
+	SqlarList(prefix string) []db.SqlarFileInfo
+	SqlarDelete(name string) bool
 }
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"os"
 	"path/filepath"
 	"strings"
 )
@@ -8,20 +9,33 @@ import (
 // validator handles path validation (security only).
 //
 // Indexing-skip decisions are NOT validation — they are a separate concern
-// handled by IsIndexSkipped/IsIndexSkippedName in pathfilter.go. The
-// scanner/watcher consult those directly.
-type validator struct{}
+// handled by the built-in skip names in pathfilter.go plus the user's
+// ignore rules in ignore.go. The validator only carries the matcher so the
+// scanner/watcher have one place to ask.
+type validator struct {
+	root   *libraryRoot
+	ignore *ignoreMatcher
+}
 
 // newValidator creates a new validator.
-func newValidator() *validator {
-	return &validator{}
+func newValidator(dataRoot string) *validator {
+	root := newLibraryRoot(dataRoot)
+	return &validator{root: root, ignore: newIgnoreMatcher(root)}
 }
 
-// IsExcluded reports whether the path should be skipped during indexing.
-// This is a thin wrapper around IsIndexSkipped kept for the scanner/watcher
-// callsites; new code should call IsIndexSkipped directly.
+// IsExcluded reports whether the path should be skipped during indexing:
+// it sits under a built-in skip name (IsIndexSkipped) or matches the
+// user's ignore rules (.mldbignore files and the settings list).
 func (v *validator) IsExcluded(path string) bool {
-	return IsIndexSkipped(path)
+	return v.explainExcluded(path).Ignored
+}
+
+// explainExcluded is IsExcluded with the deciding rule attached.
+func (v *validator) explainExcluded(path string) IgnoreMatch {
+	return v.ignore.match(path, func() bool {
+		info, err := os.Stat(v.root.abs(path))
+		return err == nil && info.IsDir()
+	})
 }
 
 // ValidatePath checks if a path is valid and not malicious (security only).
@@ -5,7 +5,7 @@ import (
 )
 
 func TestValidatePath_SecurityOnly(t *testing.T) {
-	v := newValidator()
+	v := newValidator(t.TempDir())
 
 	// Security violations should still fail
 	securityTests := []struct {
@@ -51,7 +51,7 @@ func TestValidatePath_SecurityOnly(t *testing.T) {
 }
 
 func TestExclusionPatterns(t *testing.T) {
-	v := newValidator()
+	v := newValidator(t.TempDir())
 
 	tests := []struct {
 		path     string
@@ -33,7 +33,7 @@ func newWatcher(service *Service) *watcher {
 	// Initialize debouncer with default delay to coalesce rapid events
 	w.debouncer = newDebouncer(DefaultDebounceDelay, w.processDebounced)
 	// Initialize move detector with default TTL to correlate RENAME+CREATE events
-	w.moveDetector = newMoveDetector(DefaultMoveDetectorTTL, service.cfg.DataRoot)
+	w.moveDetector = newMoveDetector(DefaultMoveDetectorTTL, service.root)
 	return w
 }
 
@@ -52,6 +52,7 @@ func (w *watcher) Start() error {
 		log.Error().Err(err).Msg("failed to watch data directory")
 		return err
 	}
+	w.watchMounts()
 
 	// Start the event loop
 	w.service.wg.Add(1)
@@ -102,15 +103,39 @@ func (w *watcher) processDebounced(path string, eventType EventType) {
 	}
 }
 
-// watchRecursive adds all directories under root to the watcher
+// watchMounts watches the sources of the mounted folders. A source that
+// is missing (a detached disk) is logged and left unwatched; the scanner
+// reports it too.
+func (w *watcher) watchMounts() {
+	for _, m := range w.service.root.list() {
+		if err := w.watchRecursive(m.Source); err != nil {
+			log.Warn().Err(err).Str("path", m.Path).Msg("failed to watch mounted folder")
+		}
+	}
+}
+
+// watchRecursive adds all directories under root (the data root or a
+// mounted folder's source) to the watcher
 func (w *watcher) watchRecursive(root string) error {
+	if _, err := os.Stat(root); err != nil {
+		return err
+	}
 	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil // Skip errors
 		}
 
-		// Get relative path
-		relPath, _ := filepath.Rel(w.service.cfg.DataRoot, path)
+		// Get library path
+		relPath, ok := w.service.root.rel(path)
+		if !ok {
+			return nil
+		}
+
+		// A data-root directory shadowed by a mounted folder is not part
+		// of the library
+		if info.IsDir() && w.service.root.abs(relPath) != filepath.Clean(path) {
+			return filepath.SkipDir
+		}
 
 		// Skip excluded paths
 		if w.service.validator.IsExcluded(relPath) {
@@ -166,11 +191,19 @@ func (w *watcher) eventLoop() {
 
 // handleEvent processes a single filesystem event
 func (w *watcher) handleEvent(event fsnotify.Event) {
-	relPath, err := filepath.Rel(w.service.cfg.DataRoot, event.Name)
-	if err != nil {
+	relPath, ok := w.service.root.rel(event.Name)
+	if !ok {
 		return
 	}
 
+	// An ignore file changed: drop its cached rules and re-apply them.
+	// Checked before the exclusion test so edits are seen even when the
+	// rules end up ignoring the file itself.
+	if filepath.Base(relPath) == IgnoreFileName {
+		w.service.validator.ignore.invalidate(filepath.Dir(relPath))
+		w.service.ignoreRulesChanged()
+	}
+
 	// Skip excluded paths
 	if w.service.validator.IsExcluded(relPath) {
 		return
@@ -205,6 +238,9 @@ func (w *watcher) handleEvent(event fsnotify.Event) {
 	// Handle directory creation
 	if info.IsDir() {
 		if isCreate {
+			// A directory moved in may bring its own ignore files; forget
+			// anything cached for that subtree.
+			w.service.validator.ignore.invalidate(relPath)
 			// Add new directory to watcher
 			w.watcher.Add(event.Name)
 			// Notify clients so the parent folder view picks up the new
@@ -337,7 +373,7 @@ func (w *watcher) handleDelete(path string) {
 // (e.g., via AirDrop, manual copy, etc.)
 func (w *watcher) processExternalFile(path string, trigger string) {
 	// Get file info
-	fullPath := filepath.Join(w.service.cfg.DataRoot, path)
+	fullPath := w.service.root.abs(path)
 	info, err := os.Stat(fullPath)
 	if err != nil {
 		log.Warn().
@@ -437,7 +473,7 @@ func (w *watcher) processExternalFile(path string, trigger string) {
 // related records (pins).
 func (w *watcher) processMove(oldPath, newPath string) {
 	// Get file info at new location
-	fullPath := filepath.Join(w.service.cfg.DataRoot, newPath)
+	fullPath := w.service.root.abs(newPath)
 	info, err := os.Stat(fullPath)
 	if err != nil {
 		log.Warn().
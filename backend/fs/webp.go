@@ -0,0 +1,79 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// WebP encoding. Go has no WebP encoder, so renditions are handed to
+// cwebp, or to an ffmpeg built with libwebp. Without either, WebP is
+// reported unavailable and callers fall back to JPEG.
+
+var errWebPUnavailable = errors.New("no webp encoder installed")
+
+var webpEncoder = sync.OnceValue(func() []string {
+	if bin, err := exec.LookPath("cwebp"); err == nil {
+		return []string{bin}
+	}
+	if bin, err := exec.LookPath("ffmpeg"); err == nil {
+		out, err := exec.Command(bin, "-hide_banner", "-encoders").Output()
+		if err == nil && bytes.Contains(out, []byte("libwebp")) {
+			return []string{bin, "ffmpeg"}
+		}
+	}
+	return nil
+})
+
+// WebPAvailable reports whether WebP renditions can be encoded.
+func WebPAvailable() bool {
+	return webpEncoder() != nil
+}
+
+// encodeWebP encodes img as a lossy WebP at quality (0-100).
+func encodeWebP(ctx context.Context, img image.Image, quality int) ([]byte, error) {
+	enc := webpEncoder()
+	if enc == nil {
+		return nil, errWebPUnavailable
+	}
+
+	// The encoders read PNG, losslessly, from a temp file: cwebp cannot
+	// read stdin.
+	in, err := os.CreateTemp("", "rendition-*.png")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(in.Name())
+	err = png.Encode(in, img)
+	if cerr := in.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write temp png: %w", err)
+	}
+	out := strings.TrimSuffix(in.Name(), ".png") + ".webp"
+	defer os.Remove(out)
+
+	q := strconv.Itoa(quality)
+	var cmd *exec.Cmd
+	if len(enc) == 1 {
+		cmd = exec.CommandContext(ctx, enc[0], "-quiet", "-q", q, in.Name(), "-o", out)
+	} else {
+		cmd = exec.CommandContext(ctx, enc[0], "-hide_banner", "-loglevel", "error", "-y",
+			"-i", in.Name(), "-c:v", "libwebp", "-quality", q, out)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", enc[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return os.ReadFile(out)
+}
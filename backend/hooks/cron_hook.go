@@ -76,7 +76,62 @@ func (h *CronHook) AddSchedule(name string, expr string) error {
 	return nil
 }
 
-// RemoveSchedule removes a named cron schedule.
+// AddOnce adds or replaces a named one-shot schedule that emits a single
+// cron.tick at the given time (immediately when it is already past), then
+// removes itself. The payload carries the name and "at" (RFC 3339) instead
+// of a schedule expression.
+func (h *CronHook) AddOnce(name string, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if id, exists := h.entries[name]; exists {
+		h.scheduler.Remove(id)
+		delete(h.entries, name)
+	}
+
+	var id cron.EntryID
+	id = h.scheduler.Schedule(&onceSchedule{at: at}, cron.FuncJob(func() {
+		h.mu.Lock()
+		if h.entries[name] == id {
+			delete(h.entries, name)
+		}
+		h.mu.Unlock()
+		h.scheduler.Remove(id)
+
+		h.registry.Emit(Payload{
+			EventType: EventCronTick,
+			Timestamp: time.Now(),
+			Data: map[string]any{
+				"name": name,
+				"at":   at.Format(time.RFC3339),
+			},
+		})
+	}))
+
+	h.entries[name] = id
+	log.Info().Str("name", name).Time("at", at).Msg("one-shot schedule added")
+}
+
+// onceSchedule fires once at a fixed time. The scheduler asks for the next
+// activation when the entry is added and again after each run; the second
+// answer (zero) means never.
+type onceSchedule struct {
+	at        time.Time
+	scheduled bool
+}
+
+func (s *onceSchedule) Next(t time.Time) time.Time {
+	if s.scheduled {
+		return time.Time{}
+	}
+	s.scheduled = true
+	if s.at.Before(t) {
+		return t
+	}
+	return s.at
+}
+
+// RemoveSchedule removes a named cron or one-shot schedule.
 func (h *CronHook) RemoveSchedule(name string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -98,3 +98,52 @@ func TestCronHookRemoveSchedule(t *testing.T) {
 		t.Errorf("expected no ticks after removal, but got %d more", finalCount-countAfterRemoval)
 	}
 }
+
+func TestCronHookAddOnceFiresOnce(t *testing.T) {
+	reg := NewRegistry()
+	hook := NewCronHook(reg)
+
+	ticks := make(chan Payload, 4)
+	reg.Subscribe(EventCronTick, func(_ context.Context, p Payload) {
+		ticks <- p
+	})
+
+	reg.Register(hook)
+	if err := reg.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer reg.Stop()
+
+	hook.AddOnce("soon", time.Now().Add(300*time.Millisecond))
+	hook.AddOnce("overdue", time.Now().Add(-time.Hour))
+
+	got := map[string]bool{}
+	deadline := time.After(3 * time.Second)
+	for len(got) < 2 {
+		select {
+		case p := <-ticks:
+			name, _ := p.Data["name"].(string)
+			if got[name] {
+				t.Fatalf("%s fired twice", name)
+			}
+			got[name] = true
+			if p.Data["at"] == nil {
+				t.Errorf("%s: payload has no at: %v", name, p.Data)
+			}
+		case <-deadline:
+			t.Fatalf("expected both one-shots to fire, got %v", got)
+		}
+	}
+
+	select {
+	case p := <-ticks:
+		t.Errorf("unexpected extra tick: %v", p.Data)
+	case <-time.After(1200 * time.Millisecond):
+	}
+	hook.mu.Lock()
+	left := len(hook.entries)
+	hook.mu.Unlock()
+	if left != 0 {
+		t.Errorf("%d entries left after firing", left)
+	}
+}
@@ -0,0 +1,454 @@
+// Package jobs runs background work (previews, text and media indexing,
+// session transcripts) off a persistent queue in the index DB.
+//
+// Work is identified by a kind and a key (usually a file path). Producers
+// Enqueue and forget: a job survives restarts, is deduplicated while
+// queued, runs in priority order, and is retried with exponential backoff
+// until it succeeds or runs out of attempts. Each kind has its own pool of
+// workers, so a slow kind (video thumbnails) never starves a fast one
+// (text indexing).
+//
+// Priorities: PriorityUser for paths on the user's screen, PriorityNormal
+// for live changes, PriorityBackground for scans and backfills.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// Priorities. Higher runs first.
+const (
+	PriorityBackground = 0
+	PriorityNormal     = 10
+	PriorityUser       = 20
+)
+
+// Defaults for Options fields left zero.
+const (
+	DefaultConcurrency = 1
+	DefaultMaxAttempts = 5
+	DefaultBackoff     = 10 * time.Second
+	DefaultTimeout     = 5 * time.Minute
+
+	maxBackoff = time.Hour
+	// idlePoll bounds how long an idle worker sleeps before looking for
+	// retries whose backoff has elapsed.
+	idlePoll = 5 * time.Second
+	// progressInterval throttles progress notifications.
+	progressInterval = time.Second
+)
+
+// Handler does the work for one key. Returning an error schedules a retry,
+// unless it is wrapped by Permanent.
+type Handler func(ctx context.Context, key string) error
+
+// Options configures a kind of job.
+type Options struct {
+	Concurrency int           // workers; DefaultConcurrency if zero
+	MaxAttempts int           // runs before giving up; DefaultMaxAttempts if zero
+	Backoff     time.Duration // delay before the first retry, doubling after; DefaultBackoff if zero
+	Timeout     time.Duration // per run; DefaultTimeout if zero
+}
+
+// Store is the persistence the queue runs on; *db.DB implements it.
+type Store interface {
+	EnqueueJobs(ctx context.Context, kind string, keys []string, priority int) error
+	ClaimJob(ctx context.Context, kind string) (*db.Job, error)
+	CompleteJob(ctx context.Context, id int64) error
+	RetryJob(ctx context.Context, id int64, errMsg string, runAfter int64) error
+	ReleaseJob(ctx context.Context, id int64) error
+	FailJob(ctx context.Context, id int64, errMsg string) error
+	ResetRunningJobs(ctx context.Context) (int, error)
+	RetryFailedJobs(ctx context.Context, kind string) (int, error)
+	PrioritizeJobs(ctx context.Context, keys []string, priority int) (int, error)
+	CountJobs() ([]db.JobCounts, error)
+	ListJobs(kind, status string, limit int) ([]db.Job, error)
+}
+
+// ErrUnknownKind is returned for a kind nobody registered.
+var ErrUnknownKind = errors.New("unknown job kind")
+
+// permanentError marks a failure retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job fails at once instead of being retried.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// KindStats is the state of one kind, as reported by Stats.
+type KindStats struct {
+	db.JobCounts
+	Concurrency int  `json:"concurrency"`
+	Paused      bool `json:"paused"`
+	// Completed and Errors count runs since the process started.
+	Completed int64 `json:"completed"`
+	Errors    int64 `json:"errors"`
+}
+
+// Stats is a snapshot of the whole queue.
+type Stats struct {
+	Paused bool        `json:"paused"`
+	Kinds  []KindStats `json:"kinds"`
+}
+
+// kind is a registered kind and its worker pool.
+type kind struct {
+	name      string
+	handler   Handler
+	opts      Options
+	wake      chan struct{}
+	paused    bool
+	completed int64
+	errors    int64
+}
+
+// Queue dispatches persistent jobs to registered handlers.
+type Queue struct {
+	store Store
+
+	mu         sync.Mutex
+	kinds      map[string]*kind
+	paused     bool
+	dirty      bool
+	onProgress func(Stats)
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a queue backed by store. Register the kinds, then Start.
+func New(store Store) *Queue {
+	return &Queue{store: store, kinds: make(map[string]*kind)}
+}
+
+// Register installs the handler for a kind. Must be called before Start.
+func (q *Queue) Register(name string, handler Handler, opts Options) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.kinds[name] = &kind{name: name, handler: handler, opts: opts, wake: make(chan struct{}, 1)}
+}
+
+// SetProgressNotifier sets a callback receiving a Stats snapshot, at most
+// once a second, whenever the queue changed.
+func (q *Queue) SetProgressNotifier(fn func(Stats)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.onProgress = fn
+}
+
+// Start requeues jobs interrupted by the last shutdown and starts the
+// workers. They stop when ctx is cancelled or Stop is called.
+func (q *Queue) Start(ctx context.Context) {
+	if n, err := q.store.ResetRunningJobs(ctx); err != nil {
+		log.Error().Err(err).Msg("jobs: failed to requeue interrupted jobs")
+	} else if n > 0 {
+		log.Info().Int("count", n).Msg("jobs: requeued jobs interrupted by shutdown")
+	}
+
+	ctx, q.cancel = context.WithCancel(ctx)
+	q.mu.Lock()
+	for _, k := range q.kinds {
+		for range k.opts.Concurrency {
+			q.wg.Add(1)
+			go q.work(ctx, k)
+		}
+	}
+	q.mu.Unlock()
+
+	q.wg.Add(1)
+	go q.reportProgress(ctx)
+}
+
+// Stop cancels running jobs and waits for the workers to exit. Cancelled
+// jobs go back to the queue on the next Start.
+func (q *Queue) Stop() {
+	if q.cancel != nil {
+		q.cancel()
+	}
+	q.wg.Wait()
+}
+
+// Enqueue queues one key. Errors are logged: producers are event handlers
+// with nobody to report to, and the next scan queues the work again.
+func (q *Queue) Enqueue(kind, key string, priority int) {
+	q.EnqueueMany(kind, []string{key}, priority)
+}
+
+// EnqueueMany queues keys of one kind in a single transaction.
+func (q *Queue) EnqueueMany(kind string, keys []string, priority int) {
+	if len(keys) == 0 {
+		return
+	}
+	if err := q.store.EnqueueJobs(context.Background(), kind, keys, priority); err != nil {
+		log.Error().Err(err).Str("kind", kind).Int("count", len(keys)).Msg("jobs: failed to enqueue")
+		return
+	}
+	q.wake(kind)
+	q.markDirty()
+}
+
+// Prioritize moves the queued work for keys (any kind) to PriorityUser,
+// for paths the user is looking at.
+func (q *Queue) Prioritize(ctx context.Context, keys []string) (int, error) {
+	n, err := q.store.PrioritizeJobs(ctx, keys, PriorityUser)
+	if n > 0 {
+		q.markDirty()
+	}
+	return n, err
+}
+
+// Pause stops workers of kind ("" = every kind) from claiming new jobs;
+// running ones finish. Pausing is not persisted across restarts.
+func (q *Queue) Pause(name string) error {
+	return q.setPaused(name, true)
+}
+
+// Resume undoes Pause.
+func (q *Queue) Resume(name string) error {
+	return q.setPaused(name, false)
+}
+
+func (q *Queue) setPaused(name string, paused bool) error {
+	q.mu.Lock()
+	if name == "" {
+		q.paused = paused
+		for _, k := range q.kinds {
+			k.paused = paused
+		}
+	} else if k, ok := q.kinds[name]; ok {
+		k.paused = paused
+	} else {
+		q.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownKind, name)
+	}
+	q.dirty = true
+	q.mu.Unlock()
+
+	if !paused {
+		q.wake(name)
+	}
+	return nil
+}
+
+// RetryFailed queues the failed jobs of kind ("" = every kind) again.
+func (q *Queue) RetryFailed(ctx context.Context, name string) (int, error) {
+	if name != "" && !q.known(name) {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownKind, name)
+	}
+	n, err := q.store.RetryFailedJobs(ctx, name)
+	if n > 0 {
+		q.wake(name)
+		q.markDirty()
+	}
+	return n, err
+}
+
+// Failures lists the most recent failed jobs of kind ("" = every kind).
+func (q *Queue) Failures(name string, limit int) ([]db.Job, error) {
+	return q.store.ListJobs(name, db.JobStatusFailed, limit)
+}
+
+// Stats reports the backlog and state of every registered kind.
+func (q *Queue) Stats() (Stats, error) {
+	counts, err := q.store.CountJobs()
+	if err != nil {
+		return Stats{}, err
+	}
+	byKind := make(map[string]db.JobCounts, len(counts))
+	for _, c := range counts {
+		byKind[c.Kind] = c
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := Stats{Paused: q.paused, Kinds: make([]KindStats, 0, len(q.kinds))}
+	for name, k := range q.kinds {
+		c := byKind[name]
+		c.Kind = name
+		stats.Kinds = append(stats.Kinds, KindStats{
+			JobCounts:   c,
+			Concurrency: k.opts.Concurrency,
+			Paused:      k.paused,
+			Completed:   k.completed,
+			Errors:      k.errors,
+		})
+	}
+	sort.Slice(stats.Kinds, func(i, j int) bool { return stats.Kinds[i].Kind < stats.Kinds[j].Kind })
+	return stats, nil
+}
+
+// ---------- Workers ----------
+
+// work claims and runs jobs of one kind until ctx is done.
+func (q *Queue) work(ctx context.Context, k *kind) {
+	defer q.wg.Done()
+	for ctx.Err() == nil {
+		if !q.isPaused(k) {
+			job, err := q.store.ClaimJob(ctx, k.name)
+			if err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Str("kind", k.name).Msg("jobs: failed to claim job")
+			}
+			if job != nil {
+				q.run(ctx, k, job)
+				continue
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case <-k.wake:
+		case <-time.After(idlePoll):
+		}
+	}
+}
+
+// run executes one job and records the outcome.
+func (q *Queue) run(ctx context.Context, k *kind, job *db.Job) {
+	q.markDirty()
+	runCtx, cancel := context.WithTimeout(ctx, k.opts.Timeout)
+	err := safeCall(runCtx, k.handler, job.Key)
+	cancel()
+
+	// Record the outcome even while shutting down; an interrupted job is
+	// simply retried.
+	store := context.Background()
+	q.mu.Lock()
+	if err == nil {
+		k.completed++
+	} else {
+		k.errors++
+	}
+	q.dirty = true
+	q.mu.Unlock()
+
+	var perr permanentError
+	switch {
+	case err == nil:
+		err = q.store.CompleteJob(store, job.ID)
+	case ctx.Err() != nil:
+		// Shutdown, not the job's fault: give the attempt back.
+		err = q.store.ReleaseJob(store, job.ID)
+	case errors.As(err, &perr) || job.Attempts >= k.opts.MaxAttempts:
+		log.Warn().Err(err).Str("kind", k.name).Str("key", job.Key).Int("attempts", job.Attempts).Msg("jobs: job failed")
+		err = q.store.FailJob(store, job.ID, err.Error())
+	default:
+		delay := backoff(k.opts.Backoff, job.Attempts)
+		log.Debug().Err(err).Str("kind", k.name).Str("key", job.Key).Dur("retryIn", delay).Msg("jobs: job will be retried")
+		err = q.store.RetryJob(store, job.ID, err.Error(), time.Now().Add(delay).UnixMilli())
+		if delay < idlePoll {
+			time.AfterFunc(delay, func() { q.wake(k.name) })
+		}
+	}
+	if err != nil {
+		log.Error().Err(err).Str("kind", k.name).Int64("id", job.ID).Msg("jobs: failed to record job outcome")
+	}
+}
+
+// safeCall runs a handler, turning a panic into a permanent failure.
+func safeCall(ctx context.Context, h Handler, key string) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = Permanent(fmt.Errorf("panic: %v", p))
+		}
+	}()
+	return h(ctx, key)
+}
+
+// backoff is the delay before retrying after the given number of
+// attempts: base, doubling each time, capped at maxBackoff.
+func backoff(base time.Duration, attempts int) time.Duration {
+	d := base
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+func (q *Queue) isPaused(k *kind) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return k.paused
+}
+
+func (q *Queue) known(name string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.kinds[name]
+	return ok
+}
+
+// wake nudges the idle workers of kind ("" = every kind).
+func (q *Queue) wake(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for n, k := range q.kinds {
+		if name == "" || n == name {
+			select {
+			case k.wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// ---------- Progress ----------
+
+func (q *Queue) markDirty() {
+	q.mu.Lock()
+	q.dirty = true
+	q.mu.Unlock()
+}
+
+// reportProgress sends a Stats snapshot to the progress notifier once a
+// second while the queue keeps changing.
+func (q *Queue) reportProgress(ctx context.Context) {
+	defer q.wg.Done()
+	t := time.NewTicker(progressInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		q.mu.Lock()
+		notify, dirty := q.onProgress, q.dirty
+		q.dirty = false
+		q.mu.Unlock()
+		if notify == nil || !dirty {
+			continue
+		}
+		stats, err := q.Stats()
+		if err != nil {
+			log.Warn().Err(err).Msg("jobs: failed to read queue stats")
+			continue
+		}
+		notify(stats)
+	}
+}
@@ -0,0 +1,293 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+)
+
+// memStore is an in-memory Store with the semantics of the jobs table,
+// minus rerun.
+type memStore struct {
+	mu     sync.Mutex
+	nextID int64
+	jobs   map[int64]*db.Job
+}
+
+func newMemStore() *memStore { return &memStore{jobs: map[int64]*db.Job{}} }
+
+func (s *memStore) EnqueueJobs(ctx context.Context, kind string, keys []string, priority int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		s.nextID++
+		s.jobs[s.nextID] = &db.Job{ID: s.nextID, Kind: kind, Key: key, Priority: priority, Status: db.JobStatusPending}
+	}
+	return nil
+}
+
+func (s *memStore) ClaimJob(ctx context.Context, kind string) (*db.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*db.Job
+	for _, j := range s.jobs {
+		if j.Kind == kind && j.Status == db.JobStatusPending && j.RunAfter <= time.Now().UnixMilli() {
+			due = append(due, j)
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	sort.Slice(due, func(i, k int) bool {
+		if due[i].Priority != due[k].Priority {
+			return due[i].Priority > due[k].Priority
+		}
+		return due[i].ID < due[k].ID
+	})
+	j := due[0]
+	j.Status = db.JobStatusRunning
+	j.Attempts++
+	c := *j
+	return &c, nil
+}
+
+func (s *memStore) CompleteJob(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+	return nil
+}
+
+func (s *memStore) RetryJob(ctx context.Context, id int64, errMsg string, runAfter int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.jobs[id]
+	j.Status, j.LastError, j.RunAfter = db.JobStatusPending, &errMsg, runAfter
+	return nil
+}
+
+func (s *memStore) ReleaseJob(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.jobs[id]
+	j.Status, j.RunAfter, j.Attempts = db.JobStatusPending, 0, max(j.Attempts-1, 0)
+	return nil
+}
+
+func (s *memStore) FailJob(ctx context.Context, id int64, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.jobs[id]
+	j.Status, j.LastError = db.JobStatusFailed, &errMsg
+	return nil
+}
+
+func (s *memStore) ResetRunningJobs(ctx context.Context) (int, error) { return 0, nil }
+
+func (s *memStore) RetryFailedJobs(ctx context.Context, kind string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, j := range s.jobs {
+		if j.Status == db.JobStatusFailed && (kind == "" || j.Kind == kind) {
+			j.Status, j.Attempts, j.RunAfter = db.JobStatusPending, 0, 0
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memStore) PrioritizeJobs(ctx context.Context, keys []string, priority int) (int, error) {
+	return 0, nil
+}
+
+func (s *memStore) CountJobs() ([]db.JobCounts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byKind := map[string]*db.JobCounts{}
+	for _, j := range s.jobs {
+		c := byKind[j.Kind]
+		if c == nil {
+			c = &db.JobCounts{Kind: j.Kind}
+			byKind[j.Kind] = c
+		}
+		switch j.Status {
+		case db.JobStatusPending:
+			c.Pending++
+		case db.JobStatusRunning:
+			c.Running++
+		case db.JobStatusFailed:
+			c.Failed++
+		}
+	}
+	var out []db.JobCounts
+	for _, c := range byKind {
+		out = append(out, *c)
+	}
+	return out, nil
+}
+
+func (s *memStore) ListJobs(kind, status string, limit int) ([]db.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []db.Job
+	for _, j := range s.jobs {
+		if (kind == "" || j.Kind == kind) && (status == "" || j.Status == status) {
+			out = append(out, *j)
+		}
+	}
+	return out, nil
+}
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQueue_RetriesUntilSuccess(t *testing.T) {
+	store := newMemStore()
+	q := New(store)
+
+	var mu sync.Mutex
+	calls := 0
+	q.Register("k", func(ctx context.Context, key string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}, Options{Backoff: time.Millisecond})
+
+	q.Start(context.Background())
+	defer q.Stop()
+	q.Enqueue("k", "a", PriorityNormal)
+
+	waitFor(t, "job to succeed", func() bool {
+		jobs, _ := store.ListJobs("", "", 10)
+		return len(jobs) == 0
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 3 {
+		t.Errorf("handler ran %d times, want 3", calls)
+	}
+}
+
+func TestQueue_GivesUp(t *testing.T) {
+	store := newMemStore()
+	q := New(store)
+
+	q.Register("limited", func(ctx context.Context, key string) error {
+		return errors.New("always")
+	}, Options{MaxAttempts: 2, Backoff: time.Millisecond})
+	q.Register("permanent", func(ctx context.Context, key string) error {
+		return Permanent(errors.New("bad input"))
+	}, Options{})
+
+	q.Start(context.Background())
+	defer q.Stop()
+	q.Enqueue("limited", "a", PriorityNormal)
+	q.Enqueue("permanent", "b", PriorityNormal)
+
+	waitFor(t, "both jobs to fail", func() bool {
+		failed, _ := q.Failures("", 10)
+		return len(failed) == 2
+	})
+	failed, _ := q.Failures("limited", 10)
+	if len(failed) != 1 || failed[0].Attempts != 2 {
+		t.Errorf("limited job = %+v, want failed after 2 attempts", failed)
+	}
+	failed, _ = q.Failures("permanent", 10)
+	if len(failed) != 1 || failed[0].Attempts != 1 {
+		t.Errorf("permanent job = %+v, want failed after 1 attempt", failed)
+	}
+}
+
+func TestQueue_PauseResume(t *testing.T) {
+	store := newMemStore()
+	q := New(store)
+
+	ran := make(chan string, 1)
+	q.Register("k", func(ctx context.Context, key string) error {
+		ran <- key
+		return nil
+	}, Options{})
+	if err := q.Pause("k"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Pause("nope"); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("Pause(unknown) = %v", err)
+	}
+
+	q.Start(context.Background())
+	defer q.Stop()
+	q.Enqueue("k", "a", PriorityNormal)
+
+	select {
+	case key := <-ran:
+		t.Fatalf("paused kind ran %s", key)
+	case <-time.After(50 * time.Millisecond):
+	}
+	stats, _ := q.Stats()
+	if len(stats.Kinds) != 1 || !stats.Kinds[0].Paused || stats.Kinds[0].Pending != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	if err := q.Resume(""); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("resumed kind did not run")
+	}
+}
+
+func TestQueue_ShutdownGivesAttemptBack(t *testing.T) {
+	store := newMemStore()
+	q := New(store)
+
+	started := make(chan struct{})
+	q.Register("k", func(ctx context.Context, key string) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, Options{MaxAttempts: 1})
+
+	q.Start(context.Background())
+	q.Enqueue("k", "a", PriorityNormal)
+	<-started
+	q.Stop()
+
+	jobs, _ := store.ListJobs("k", "", 10)
+	if len(jobs) != 1 || jobs[0].Status != db.JobStatusPending || jobs[0].Attempts != 0 {
+		t.Fatalf("job after shutdown = %+v, want pending with no attempts used", jobs)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		4:  80 * time.Second,
+		20: maxBackoff,
+	} {
+		if got := backoff(10*time.Second, attempts); got != want {
+			t.Errorf("backoff(10s, %d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
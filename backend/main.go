@@ -50,6 +50,16 @@ func main() {
 				Models:  agentModels,
 			}
 		}(),
+		AgentFramesCompress:     cfg.AgentFramesCompress,
+		AgentRegistryFile:       cfg.AgentRegistryFile,
+		AgentPoolMaxWarm:        cfg.AgentPoolMaxWarm,
+		AgentPoolMemoryMB:       cfg.AgentPoolMemoryMB,
+		AgentLimitCPUs:          cfg.AgentLimitCPUs,
+		AgentLimitMemoryMB:      cfg.AgentLimitMemoryMB,
+		AgentLimitPids:          cfg.AgentLimitPids,
+		AgentTurnTimeoutSecs:    cfg.AgentTurnTimeoutSecs,
+		AgentCommandTimeoutSecs: cfg.AgentCommandTimeoutSecs,
+		AgentIsolateNetwork:     cfg.AgentIsolateNetwork,
 	}
 
 	// Create server
@@ -58,6 +68,10 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to create server")
 	}
 
+	// A successor started by a handoff (SIGUSR2) needs the original
+	// environment, so keep a copy before clearing it.
+	srv.SetHandoffEnv(os.Environ())
+
 	// All env vars have been read into memory — clear them from the process
 	// so secrets (API keys, OAuth credentials) are not exposed via
 	// /proc/self/environ or printenv.
@@ -81,6 +95,7 @@ func main() {
 			DefaultModel:   params.DefaultModel,
 			TriggerKind:    params.TriggerKind,
 			TriggerData:    params.TriggerData,
+			Approval:       params.Approval,
 		})
 		if err != nil {
 			return nil, nil, err
@@ -88,6 +103,19 @@ func main() {
 		return handle.AcpSession, handle.PromptDone, nil
 	})
 
+	// A handoff keeps this process serving its sessions until no prompt is
+	// in flight, starting no new ones.
+	srv.SetDrainStart(handlers.AgentMgr().BeginDrain)
+	srv.SetDrainCheck(func() int {
+		n := 0
+		for _, st := range handlers.AgentMgr().AllRuntimeStates() {
+			if st.IsProcessing {
+				n++
+			}
+		}
+		return n
+	})
+
 	// Setup static file serving and SPA fallback
 	setupStaticRoutes(srv.Router())
 
@@ -101,10 +129,49 @@ func main() {
 		}
 	}()
 
-	// Graceful shutdown
+	// Graceful shutdown. SIGUSR2 hands the socket to a freshly started
+	// successor first (zero-downtime restart); a failed handoff leaves this
+	// process serving.
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR2)
+	handedOff := false
+	for sig := range quit {
+		if sig != syscall.SIGUSR2 {
+			break
+		}
+		log.Info().Msg("handing over to a new server process")
+		handoffCtx, cancelHandoff := context.WithCancel(context.Background())
+		interrupted := make(chan struct{})
+		go func() {
+			// SIGINT/SIGTERM during the handoff cut it short and shut down.
+			for {
+				select {
+				case sig := <-quit:
+					if sig != syscall.SIGUSR2 {
+						close(interrupted)
+						cancelHandoff()
+						return
+					}
+				case <-handoffCtx.Done():
+					return
+				}
+			}
+		}()
+		err := srv.Handoff(handoffCtx)
+		cancelHandoff()
+		if err == nil {
+			handedOff = true
+			break
+		}
+		select {
+		case <-interrupted:
+		default:
+			log.Error().Err(err).Msg("handoff failed, carrying on")
+			continue
+		}
+		break
+	}
+	signal.Stop(quit)
 
 	log.Info().Msg("shutting down server")
 
@@ -121,6 +188,12 @@ func main() {
 	}
 
 	log.Info().Msg("server stopped")
+
+	if handedOff {
+		// Stay the successor's parent so supervisors tracking this PID
+		// follow the new process.
+		os.Exit(srv.WaitSuccessor())
+	}
 }
 
 // setupStaticRoutes configures static file serving
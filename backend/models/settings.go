@@ -7,6 +7,7 @@ type UserSettings struct {
 	Extraction  Extraction                `json:"extraction"`
 	Enrichment  map[string]map[string]any `json:"enrichment,omitempty"`
 	Storage     Storage                   `json:"storage"`
+	Indexing    Indexing                  `json:"indexing"`
 }
 
 type Preferences struct {
@@ -29,8 +30,33 @@ type Extraction struct {
 }
 
 type Storage struct {
-	DataPath    string `json:"dataPath"`
-	BackupPath  string `json:"backupPath,omitempty"`
-	AutoBackup  bool   `json:"autoBackup"`
-	MaxFileSize int    `json:"maxFileSize"`
+	DataPath   string `json:"dataPath"`
+	BackupPath string `json:"backupPath,omitempty"`
+	AutoBackup bool   `json:"autoBackup"`
+	// MaxFileSize caps each written file, in MB; 0 means no limit. Pointer
+	// so partial PUTs can leave it alone and still set it to 0.
+	MaxFileSize *int `json:"maxFileSize,omitempty"`
+	// Per-top-level-folder quotas in MB, keyed by folder name (e.g.
+	// "imports"). Folders without an entry are unlimited.
+	FolderQuotas map[string]int `json:"folderQuotas,omitempty"`
+}
+
+type Indexing struct {
+	// Gitignore-syntax patterns applied from the data root, as if they were
+	// the first lines of a root .mldbignore (so any .mldbignore overrides
+	// them).
+	IgnorePatterns []string `json:"ignorePatterns,omitempty"`
+	// FollowSymlinks indexes what symlinks outside the library point at
+	// (off by default). Pointer so partial PUTs can leave it alone.
+	FollowSymlinks *bool `json:"followSymlinks,omitempty"`
+	// MountedFolders are directories outside the data root shown in the
+	// library under a path of their own.
+	MountedFolders []MountedFolder `json:"mountedFolders,omitempty"`
+}
+
+// MountedFolder maps Source, an absolute directory on the server, into the
+// library at Path (relative to the data root).
+type MountedFolder struct {
+	Path   string `json:"path"`
+	Source string `json:"source"`
 }
@@ -14,6 +14,8 @@ const (
 	EventPreviewUpdated       EventType = "preview-updated"
 	EventConnected            EventType = "connected"
 	EventAgentSessionUpdated EventType = "agent-session-updated"
+	EventJobsProgress        EventType = "jobs-progress"
+	EventAgentApproval       EventType = "agent-approval"
 )
 
 // Event represents a notification event
@@ -128,6 +130,32 @@ func (s *Service) NotifyAgentSessionUpdated(sessionID string, operation string)
 	})
 }
 
+// NotifyAgentApproval sends an agent-approval event
+// Used when a gated auto agent asks for permission ("requested") and when the
+// request is answered, times out or is dropped ("resolved")
+func (s *Service) NotifyAgentApproval(approvalID, sessionID, title, operation string) {
+	s.Notify(Event{
+		Type:      EventAgentApproval,
+		Timestamp: time.Now().UnixMilli(),
+		Data: map[string]interface{}{
+			"approvalId": approvalID,
+			"sessionId":  sessionID,
+			"title":      title,
+			"operation":  operation,
+		},
+	})
+}
+
+// NotifyJobsProgress sends a jobs-progress event
+// Used to report the background job queue's backlog while it changes
+func (s *Service) NotifyJobsProgress(stats any) {
+	s.Notify(Event{
+		Type:      EventJobsProgress,
+		Timestamp: time.Now().UnixMilli(),
+		Data:      stats,
+	})
+}
+
 // Shutdown closes the notification service
 func (s *Service) Shutdown() {
 	s.mu.Lock()
@@ -0,0 +1,236 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxChunkHeaderLen bounds one aws-chunked header line
+// ("<hex-size>;chunk-signature=<64 hex>").
+const maxChunkHeaderLen = 4096
+
+// requestBody wraps r.Body so that reading it yields the object bytes and
+// fails at EOF if they don't match what the client signed or declared. The
+// failure surfaces as an *APIError from Read, which aborts fs.Service's
+// atomic write before the temp file is renamed into place.
+func (a *authContext) requestBody(r *http.Request) (*digestReader, *APIError) {
+	d := &digestReader{md5: md5.New(), wantSize: -1}
+
+	switch a.payloadHash {
+	case payloadUnsigned:
+		d.r = r.Body
+	case payloadStreamingSigned, payloadStreamingTrailer:
+		signer := a
+		if a.payloadHash == payloadStreamingTrailer {
+			signer = nil
+		}
+		d.r = newChunkedReader(r.Body, signer)
+		if v := r.Header.Get("X-Amz-Decoded-Content-Length"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errInvalidArgument
+			}
+			d.wantSize = n
+		}
+	case payloadStreamingSignedTr:
+		return nil, errNotImplemented
+	default:
+		if _, err := hex.DecodeString(a.payloadHash); err != nil || len(a.payloadHash) != sha256.Size*2 {
+			return nil, errContentSHA256Mismatch
+		}
+		d.r = r.Body
+		d.sha = sha256.New()
+		d.wantSHA = strings.ToLower(a.payloadHash)
+	}
+
+	if v := r.Header.Get("Content-MD5"); v != "" {
+		sum, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(sum) != md5.Size {
+			return nil, errInvalidDigest
+		}
+		d.wantMD5 = sum
+	}
+	return d, nil
+}
+
+// digestReader hashes everything read through it and checks the declared
+// digests once the underlying reader hits EOF. The MD5 doubles as the ETag.
+type digestReader struct {
+	r        io.Reader
+	md5      hash.Hash
+	sha      hash.Hash // nil unless the payload hash is checked here
+	wantSHA  string
+	wantMD5  []byte
+	wantSize int64 // -1 = not declared
+	n        int64
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if n > 0 {
+		d.md5.Write(p[:n])
+		if d.sha != nil {
+			d.sha.Write(p[:n])
+		}
+		d.n += int64(n)
+	}
+	if err == io.EOF {
+		if d.wantSize >= 0 && d.n != d.wantSize {
+			return n, errIncompleteBody
+		}
+		if d.sha != nil && hex.EncodeToString(d.sha.Sum(nil)) != d.wantSHA {
+			return n, errContentSHA256Mismatch
+		}
+		if d.wantMD5 != nil && !bytes.Equal(d.md5.Sum(nil), d.wantMD5) {
+			return n, errBadDigest
+		}
+	}
+	return n, err
+}
+
+// ETag is the quoted hex MD5 of the bytes read so far.
+func (d *digestReader) ETag() string {
+	return `"` + hex.EncodeToString(d.md5.Sum(nil)) + `"`
+}
+
+// chunkedReader decodes an aws-chunked body:
+//
+//	<hex-size>[;chunk-signature=<sig>]\r\n<data>\r\n ... 0[;chunk-signature=<sig>]\r\n[trailers]\r\n
+//
+// With a non-nil signer every chunk signature is verified against the
+// chained SigV4 chunk signature; otherwise (STREAMING-UNSIGNED-PAYLOAD-TRAILER)
+// signatures are absent and trailing checksum headers are skipped.
+type chunkedReader struct {
+	br        *bufio.Reader
+	signer    *authContext
+	prevSig   string
+	chunkSig  string
+	chunkHash hash.Hash
+	remaining int64
+	started   bool
+	err       error
+}
+
+func newChunkedReader(r io.Reader, signer *authContext) *chunkedReader {
+	c := &chunkedReader{br: bufio.NewReader(r), signer: signer, chunkHash: sha256.New()}
+	if signer != nil {
+		c.prevSig = signer.seedSignature
+	}
+	return c
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.remaining == 0 {
+		if err := c.nextChunk(); err != nil {
+			c.err = err
+			return 0, err
+		}
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.br.Read(p)
+	c.chunkHash.Write(p[:n])
+	c.remaining -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// nextChunk finishes the current chunk (trailing CRLF + signature check)
+// and reads the next header. It returns io.EOF after the final chunk.
+func (c *chunkedReader) nextChunk() error {
+	if c.started {
+		if err := c.expectCRLF(); err != nil {
+			return err
+		}
+		if err := c.verifyChunk(); err != nil {
+			return err
+		}
+	}
+	c.started = true
+
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	sizeStr, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeStr), 16, 64)
+	if err != nil || size < 0 {
+		return errIncompleteBody
+	}
+	c.chunkSig = strings.TrimPrefix(ext, "chunk-signature=")
+	c.chunkHash.Reset()
+
+	if size == 0 {
+		if err := c.verifyChunk(); err != nil {
+			return err
+		}
+		// Trailer headers (x-amz-checksum-*) end with an empty line.
+		for {
+			line, err := c.readLine()
+			if err != nil {
+				return err
+			}
+			if line == "" {
+				return io.EOF
+			}
+		}
+	}
+	c.remaining = size
+	return nil
+}
+
+func (c *chunkedReader) verifyChunk() error {
+	if c.signer == nil {
+		return nil
+	}
+	want := c.signer.chunkSignature(c.prevSig, hex.EncodeToString(c.chunkHash.Sum(nil)))
+	if want != c.chunkSig {
+		return errSignatureDoesNotMatch
+	}
+	c.prevSig = want
+	return nil
+}
+
+func (c *chunkedReader) readLine() (string, error) {
+	line, err := c.br.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) || len(line) > maxChunkHeaderLen {
+		return "", errIncompleteBody
+	}
+	if err != nil {
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func (c *chunkedReader) expectCRLF() error {
+	var crlf [2]byte
+	if _, err := io.ReadFull(c.br, crlf[:]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if crlf != [2]byte{'\r', '\n'} {
+		return errIncompleteBody
+	}
+	return nil
+}
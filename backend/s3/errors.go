@@ -0,0 +1,71 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+// APIError is an S3 error response. Code is the wire-level S3 error code
+// clients switch on (e.g. "NoSuchKey"), so keep them verbatim.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string { return e.Code + ": " + e.Message }
+
+var (
+	errAccessDenied            = &APIError{http.StatusForbidden, "AccessDenied", "Access Denied"}
+	errInvalidAccessKeyID      = &APIError{http.StatusForbidden, "InvalidAccessKeyId", "The access key ID you provided does not exist in our records."}
+	errSignatureDoesNotMatch   = &APIError{http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."}
+	errRequestTimeTooSkewed    = &APIError{http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large."}
+	errExpiredPresign          = &APIError{http.StatusForbidden, "AccessDenied", "Request has expired"}
+	errAuthHeaderMalformed     = &APIError{http.StatusBadRequest, "AuthorizationHeaderMalformed", "The authorization header is malformed."}
+	errUnsupportedSignature    = &APIError{http.StatusBadRequest, "InvalidRequest", "Only AWS Signature Version 4 is supported."}
+	errContentSHA256Mismatch   = &APIError{http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed."}
+	errBadDigest               = &APIError{http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received."}
+	errInvalidDigest           = &APIError{http.StatusBadRequest, "InvalidDigest", "The Content-MD5 you specified is not valid."}
+	errIncompleteBody          = &APIError{http.StatusBadRequest, "IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header."}
+	errInvalidArgument         = &APIError{http.StatusBadRequest, "InvalidArgument", "Invalid Argument"}
+	errInvalidBucketName       = &APIError{http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid."}
+	errKeyTooLong              = &APIError{http.StatusBadRequest, "KeyTooLongError", "Your key is too long."}
+	errEntityTooLarge          = &APIError{http.StatusBadRequest, "EntityTooLarge", "Your proposed upload exceeds the maximum allowed object size."}
+	errMalformedXML            = &APIError{http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema."}
+	errInvalidPart             = &APIError{http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found."}
+	errInvalidPartOrder        = &APIError{http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order."}
+	errNoSuchBucket            = &APIError{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist."}
+	errNoSuchKey               = &APIError{http.StatusNotFound, "NoSuchKey", "The specified key does not exist."}
+	errNoSuchUpload            = &APIError{http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist."}
+	errMethodNotAllowed        = &APIError{http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource."}
+	errBucketAlreadyOwnedByYou = &APIError{http.StatusConflict, "BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it."}
+	errBucketNotEmpty          = &APIError{http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty."}
+	errNotImplemented          = &APIError{http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented."}
+	errInternal                = &APIError{http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again."}
+)
+
+// errorResponse is the XML body of every S3 error.
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource,omitempty"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// writeError renders err as an S3 XML error. HEAD responses carry no body,
+// so clients only see the status code there.
+func writeError(w http.ResponseWriter, r *http.Request, err *APIError) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(err.Status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(errorResponse{
+		Code:      err.Code,
+		Message:   err.Message,
+		Resource:  r.URL.Path,
+		RequestID: w.Header().Get("x-amz-request-id"),
+	})
+}
@@ -0,0 +1,732 @@
+// Package s3 serves an S3-compatible API over USER_DATA_DIR.
+//
+// Mapping: each access key is confined to a root folder (Credential.Root);
+// buckets are the folders directly under that root and object keys are
+// slash-separated paths below the bucket folder. Requests are path-style
+// only (`<endpoint>/<bucket>/<key>`); virtual-host addressing is not
+// supported. Reads go straight to disk; every write (PutObject, CopyObject,
+// CompleteMultipartUpload, DeleteObject, CreateBucket, DeleteBucket) goes
+// through the Store — fs.Service in production — so the files table,
+// previews and the search index see S3 uploads exactly like library writes.
+//
+// Supported: ListBuckets, Create/Head/DeleteBucket, GetBucketLocation,
+// ListObjects (v1 and v2), Get/Head/Put/Copy/DeleteObject, DeleteObjects,
+// and multipart upload (create, upload part, complete, abort). Everything
+// else answers NotImplemented.
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+	"github.com/xiaoyuanzhu-com/my-life-db/utils"
+)
+
+// xmlns is the S3 response namespace.
+const xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// maxKeyLength matches S3's 1024-byte object key limit.
+const maxKeyLength = 1024
+
+// Store is the write side of the object store. *fs.Service satisfies it.
+type Store interface {
+	WriteFile(ctx context.Context, req fs.WriteRequest) (*fs.WriteResult, error)
+	DeleteFile(ctx context.Context, path string) error
+	CreateFolder(ctx context.Context, path string) error
+	DeleteFolder(ctx context.Context, path string) error
+	// ResolvePath returns where a library path lives on disk, which is in
+	// a mounted folder's source for paths inside one.
+	ResolvePath(rel string) string
+	// ReadDir lists a library folder, mounted folders included.
+	ReadDir(rel string) ([]os.DirEntry, error)
+}
+
+// Handler is an http.Handler speaking the S3 REST protocol.
+type Handler struct {
+	store      Store
+	lookup     CredentialLookup
+	prefix     string // URL prefix the handler is mounted under, e.g. "/s3"
+	stagingDir string // multipart upload parts live here until completion
+	now        func() time.Time
+}
+
+// NewHandler creates an S3 handler mounted at prefix. stagingDir holds
+// in-progress multipart uploads and should live outside USER_DATA_DIR.
+func NewHandler(store Store, lookup CredentialLookup, prefix, stagingDir string) *Handler {
+	return &Handler{
+		store:      store,
+		lookup:     lookup,
+		prefix:     strings.TrimSuffix(prefix, "/"),
+		stagingDir: stagingDir,
+		now:        time.Now,
+	}
+}
+
+// ServeHTTP authenticates the request and dispatches it to an operation.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("x-amz-request-id", strings.ReplaceAll(uuid.New().String(), "-", "")[:16])
+
+	a, apiErr := authenticate(r, h.lookup, h.now())
+	if apiErr != nil {
+		log.Debug().Str("code", apiErr.Code).Str("method", r.Method).Str("path", r.URL.Path).Msg("s3 request rejected")
+		writeError(w, r, apiErr)
+		return
+	}
+
+	bucket, key := h.splitPath(r.URL.Path)
+	if a.cred.ReadOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, r, errAccessDenied)
+		return
+	}
+
+	if err := h.route(w, r, a, bucket, key); err != nil {
+		writeError(w, r, h.toAPIError(r, err))
+	}
+}
+
+func (h *Handler) route(w http.ResponseWriter, r *http.Request, a *authContext, bucket, key string) error {
+	q := r.URL.Query()
+
+	if bucket == "" {
+		if r.Method == http.MethodGet {
+			return h.listBuckets(w, a)
+		}
+		return errMethodNotAllowed
+	}
+
+	if key == "" {
+		switch r.Method {
+		case http.MethodHead:
+			return h.headBucket(w, a, bucket)
+		case http.MethodGet:
+			switch {
+			case q.Has("location"):
+				return h.getBucketLocation(w, a, bucket)
+			case q.Has("versioning"):
+				return h.getBucketVersioning(w, a, bucket)
+			case hasUnsupportedSubresource(q):
+				return errNotImplemented
+			case q.Get("list-type") == "2":
+				return h.listObjectsV2(w, r, a, bucket)
+			default:
+				return h.listObjectsV1(w, r, a, bucket)
+			}
+		case http.MethodPut:
+			if hasUnsupportedSubresource(q) {
+				return errNotImplemented
+			}
+			return h.createBucket(w, r, a, bucket)
+		case http.MethodDelete:
+			if hasUnsupportedSubresource(q) {
+				return errNotImplemented
+			}
+			return h.deleteBucket(w, r, a, bucket)
+		case http.MethodPost:
+			if q.Has("delete") {
+				return h.deleteObjects(w, r, a, bucket)
+			}
+			return errNotImplemented
+		}
+		return errMethodNotAllowed
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if q.Has("uploadId") || hasUnsupportedSubresource(q) {
+			return errNotImplemented
+		}
+		return h.getObject(w, r, a, bucket, key)
+	case http.MethodPut:
+		if q.Has("uploadId") {
+			if r.Header.Get("X-Amz-Copy-Source") != "" {
+				return errNotImplemented // UploadPartCopy
+			}
+			return h.uploadPart(w, r, a, bucket, key)
+		}
+		if hasUnsupportedSubresource(q) {
+			return errNotImplemented
+		}
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			return h.copyObject(w, r, a, bucket, key)
+		}
+		return h.putObject(w, r, a, bucket, key)
+	case http.MethodDelete:
+		if q.Has("uploadId") {
+			return h.abortMultipartUpload(w, a, bucket, key, q.Get("uploadId"))
+		}
+		return h.deleteObject(w, r, a, bucket, key)
+	case http.MethodPost:
+		if q.Has("uploads") {
+			return h.createMultipartUpload(w, r, a, bucket, key)
+		}
+		if q.Has("uploadId") {
+			return h.completeMultipartUpload(w, r, a, bucket, key, q.Get("uploadId"))
+		}
+		return errNotImplemented
+	}
+	return errMethodNotAllowed
+}
+
+// unsupportedSubresources are bucket/object sub-resources clients probe
+// for. Answering NotImplemented (rather than treating them as a plain
+// GET/PUT) keeps e.g. `PUT ?acl` from overwriting the object.
+var unsupportedSubresources = []string{
+	"acl", "policy", "cors", "lifecycle", "tagging", "website", "logging",
+	"notification", "replication", "encryption", "object-lock", "retention",
+	"legal-hold", "uploads", "versions", "torrent", "restore", "select",
+	"attributes", "accelerate", "requestPayment", "ownershipControls",
+}
+
+func hasUnsupportedSubresource(q url.Values) bool {
+	for _, k := range unsupportedSubresources {
+		if q.Has(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// toAPIError maps operation errors onto S3 error codes. Errors wrapped by
+// fs.Service (e.g. a digest mismatch raised while it copied the body) are
+// unwrapped first.
+func (h *Handler) toAPIError(r *http.Request, err error) *APIError {
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, fs.ErrInvalidPath):
+		return errInvalidArgument
+	case errors.Is(err, os.ErrNotExist):
+		return errNoSuchKey
+	case errors.Is(err, syscall.ENOTDIR), errors.Is(err, syscall.EISDIR):
+		return errPathConflict
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errIncompleteBody
+	case errors.Is(err, fs.ErrFileTooLarge):
+		return errEntityTooLarge
+	case errors.Is(err, fs.ErrQuotaExceeded):
+		return errQuotaExceeded
+	}
+	log.Error().Err(err).Str("method", r.Method).Str("path", r.URL.Path).Msg("s3 request failed")
+	return errInternal
+}
+
+// errPathConflict is returned when a key would need a path component to be
+// both a file and a folder, which S3 allows and a filesystem does not.
+var errPathConflict = &APIError{http.StatusConflict, "OperationAborted", "The key conflicts with an existing file or folder."}
+
+// errQuotaExceeded is returned when a write would push a top-level folder
+// past its storage quota. S3 has no standard code for this.
+var errQuotaExceeded = &APIError{http.StatusForbidden, "QuotaExceeded", "The folder's storage quota would be exceeded."}
+
+// =============================================================================
+// Path mapping
+// =============================================================================
+
+// splitPath turns "<prefix>/bucket/some/key" into ("bucket", "some/key").
+func (h *Handler) splitPath(p string) (bucket, key string) {
+	p = strings.TrimPrefix(strings.TrimPrefix(p, h.prefix), "/")
+	bucket, key, _ = strings.Cut(p, "/")
+	return bucket, key
+}
+
+// validBucketName accepts any single folder name that isn't hidden. S3's
+// own DNS-style naming rules are not enforced: buckets are existing
+// library folders, which may contain spaces or uppercase letters.
+func validBucketName(bucket string) bool {
+	return bucket != "" && len(bucket) <= 255 && !strings.HasPrefix(bucket, ".") &&
+		!strings.ContainsAny(bucket, "/\\") && !strings.Contains(bucket, "..")
+}
+
+// bucketPath returns the data-root-relative folder backing bucket.
+func bucketPath(a *authContext, bucket string) (string, *APIError) {
+	if !validBucketName(bucket) {
+		return "", errInvalidBucketName
+	}
+	return path.Join(a.cred.Root, bucket), nil
+}
+
+// objectPath returns the data-root-relative path backing bucket/key. Keys
+// that don't survive path cleaning unchanged ("a//b", "a/./b", "../x") have
+// no filesystem representation and are rejected.
+func objectPath(a *authContext, bucket, key string) (string, *APIError) {
+	bp, apiErr := bucketPath(a, bucket)
+	if apiErr != nil {
+		return "", apiErr
+	}
+	if len(key) > maxKeyLength {
+		return "", errKeyTooLong
+	}
+	trimmed := strings.TrimSuffix(key, "/")
+	if trimmed == "" || path.Clean("/"+trimmed) != "/"+trimmed || strings.Contains(trimmed, "\\") {
+		return "", errInvalidArgument
+	}
+	return path.Join(bp, trimmed), nil
+}
+
+func (h *Handler) abs(rel string) string {
+	return h.store.ResolvePath(rel)
+}
+
+// requireBucket returns the bucket folder's library path, or NoSuchBucket.
+func (h *Handler) requireBucket(a *authContext, bucket string) (string, error) {
+	bp, apiErr := bucketPath(a, bucket)
+	if apiErr != nil {
+		return "", apiErr
+	}
+	info, err := os.Stat(h.abs(bp))
+	if err != nil || !info.IsDir() {
+		return "", errNoSuchBucket
+	}
+	return bp, nil
+}
+
+// =============================================================================
+// Responses
+// =============================================================================
+
+// s3Time formats a timestamp the way S3 XML bodies do.
+func s3Time(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// objectETag derives a stable ETag from size and mtime. It is deliberately
+// NOT the content MD5 (that would mean hashing every file on every listing);
+// the "-1" suffix marks it as opaque, the same way multipart ETags are, so
+// sync tools don't compare it against a local MD5. PutObject and
+// CompleteMultipartUpload responses still return the real digest.
+func objectETag(info os.FileInfo) string {
+	sum := md5.Sum([]byte(fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())))
+	return `"` + hex.EncodeToString(sum[:]) + `-1"`
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		log.Debug().Err(err).Msg("s3: failed to write response body")
+	}
+}
+
+// =============================================================================
+// Buckets
+// =============================================================================
+
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type bucketEntry struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name      `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	Owner   owner         `xml:"Owner"`
+	Buckets []bucketEntry `xml:"Buckets>Bucket"`
+}
+
+func (h *Handler) listBuckets(w http.ResponseWriter, a *authContext) error {
+	entries, err := h.store.ReadDir(a.cred.Root)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	res := listAllMyBucketsResult{Owner: owner{ID: a.cred.AccessKeyID, DisplayName: a.cred.AccessKeyID}}
+	for _, e := range entries {
+		if !e.IsDir() || !validBucketName(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		res.Buckets = append(res.Buckets, bucketEntry{Name: e.Name(), CreationDate: s3Time(info.ModTime())})
+	}
+	writeXML(w, http.StatusOK, res)
+	return nil
+}
+
+func (h *Handler) headBucket(w http.ResponseWriter, a *authContext, bucket string) error {
+	if _, err := h.requireBucket(a, bucket); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LocationConstraint"`
+	Value   string   `xml:",chardata"`
+}
+
+// getBucketLocation answers with the empty constraint (us-east-1). Clients
+// sign with whatever region they're configured for; any region is accepted.
+func (h *Handler) getBucketLocation(w http.ResponseWriter, a *authContext, bucket string) error {
+	if _, err := h.requireBucket(a, bucket); err != nil {
+		return err
+	}
+	writeXML(w, http.StatusOK, locationConstraint{})
+	return nil
+}
+
+type versioningConfiguration struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ VersioningConfiguration"`
+}
+
+// getBucketVersioning reports versioning as never enabled.
+func (h *Handler) getBucketVersioning(w http.ResponseWriter, a *authContext, bucket string) error {
+	if _, err := h.requireBucket(a, bucket); err != nil {
+		return err
+	}
+	writeXML(w, http.StatusOK, versioningConfiguration{})
+	return nil
+}
+
+func (h *Handler) createBucket(w http.ResponseWriter, r *http.Request, a *authContext, bucket string) error {
+	bp, apiErr := bucketPath(a, bucket)
+	if apiErr != nil {
+		return apiErr
+	}
+	if info, err := os.Stat(h.abs(bp)); err == nil && info.IsDir() {
+		return errBucketAlreadyOwnedByYou
+	}
+	// The request body is an optional CreateBucketConfiguration naming a
+	// region; there is only one "region" here, so it's ignored.
+	_, _ = io.Copy(io.Discard, io.LimitReader(r.Body, 64<<10))
+	if err := h.store.CreateFolder(r.Context(), bp); err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/"+bucket)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (h *Handler) deleteBucket(w http.ResponseWriter, r *http.Request, a *authContext, bucket string) error {
+	bp, err := h.requireBucket(a, bucket)
+	if err != nil {
+		return err
+	}
+	entries, err := h.store.ReadDir(bp)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return errBucketNotEmpty
+	}
+	if err := h.store.DeleteFolder(r.Context(), bp); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// =============================================================================
+// Objects
+// =============================================================================
+
+// getObject serves GET and HEAD. http.ServeContent handles Range,
+// conditional requests and HEAD bodies.
+func (h *Handler) getObject(w http.ResponseWriter, r *http.Request, a *authContext, bucket, key string) error {
+	if _, err := h.requireBucket(a, bucket); err != nil {
+		return err
+	}
+	rel, apiErr := objectPath(a, bucket, key)
+	if apiErr != nil {
+		return apiErr
+	}
+	f, err := os.Open(h.abs(rel))
+	if err != nil {
+		if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+			return errNoSuchKey
+		}
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() || strings.HasSuffix(key, "/") {
+		return errNoSuchKey
+	}
+
+	hdr := w.Header()
+	hdr.Set("ETag", objectETag(info))
+	hdr.Set("Accept-Ranges", "bytes")
+	hdr.Set("Content-Type", utils.DetectMimeType(info.Name()))
+	// Presigned download URLs may override response headers.
+	q := r.URL.Query()
+	for param, header := range map[string]string{
+		"response-content-type":        "Content-Type",
+		"response-content-disposition": "Content-Disposition",
+		"response-content-language":    "Content-Language",
+		"response-content-encoding":    "Content-Encoding",
+		"response-cache-control":       "Cache-Control",
+		"response-expires":             "Expires",
+	} {
+		if v := q.Get(param); v != "" {
+			hdr.Set(header, v)
+		}
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	return nil
+}
+
+// contentTypeFor prefers the client's Content-Type unless it's a generic
+// default, in which case the extension decides.
+func contentTypeFor(r *http.Request, key string) string {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" || ct == "binary/octet-stream" || ct == "application/octet-stream" {
+		return utils.DetectMimeType(key)
+	}
+	return ct
+}
+
+func (h *Handler) putObject(w http.ResponseWriter, r *http.Request, a *authContext, bucket, key string) error {
+	if _, err := h.requireBucket(a, bucket); err != nil {
+		return err
+	}
+	rel, apiErr := objectPath(a, bucket, key)
+	if apiErr != nil {
+		return apiErr
+	}
+	body, apiErr := a.requestBody(r)
+	if apiErr != nil {
+		return apiErr
+	}
+
+	// "folder/" with an empty body is the conventional folder marker.
+	if strings.HasSuffix(key, "/") {
+		n, err := io.Copy(io.Discard, body)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return errInvalidArgument
+		}
+		if err := h.store.CreateFolder(r.Context(), rel); err != nil {
+			return err
+		}
+		w.Header().Set("ETag", body.ETag())
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	if info, err := os.Stat(h.abs(rel)); err == nil && info.IsDir() {
+		return errPathConflict
+	}
+	// Metadata (hash, preview) is computed asynchronously: backup tools
+	// push many objects back to back and shouldn't wait on previews.
+	if _, err := h.store.WriteFile(r.Context(), fs.WriteRequest{
+		Path:            rel,
+		Content:         body,
+		MimeType:        contentTypeFor(r, key),
+		Source:          "s3",
+		ComputeMetadata: true,
+		Sync:            false,
+	}); err != nil {
+		return err
+	}
+	w.Header().Set("ETag", body.ETag())
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyObjectResult"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+}
+
+// copyObject handles PUT with x-amz-copy-source. The source must be visible
+// to the same credential.
+func (h *Handler) copyObject(w http.ResponseWriter, r *http.Request, a *authContext, bucket, key string) error {
+	if _, err := h.requireBucket(a, bucket); err != nil {
+		return err
+	}
+	dst, apiErr := objectPath(a, bucket, key)
+	if apiErr != nil {
+		return apiErr
+	}
+
+	src := r.Header.Get("X-Amz-Copy-Source")
+	src, _, _ = strings.Cut(src, "?") // versionId is meaningless here
+	if unescaped, err := url.PathUnescape(src); err == nil {
+		src = unescaped
+	}
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+	if _, err := h.requireBucket(a, srcBucket); err != nil {
+		return err
+	}
+	srcRel, apiErr := objectPath(a, srcBucket, srcKey)
+	if apiErr != nil {
+		return apiErr
+	}
+	f, err := os.Open(h.abs(srcRel))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errNoSuchKey
+		}
+		return err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || info.IsDir() {
+		return errNoSuchKey
+	}
+
+	body := &digestReader{r: f, md5: md5.New(), wantSize: -1}
+	if _, err := h.store.WriteFile(r.Context(), fs.WriteRequest{
+		Path:            dst,
+		Content:         body,
+		MimeType:        utils.DetectMimeType(key),
+		Source:          "s3",
+		ComputeMetadata: true,
+		Sync:            false,
+	}); err != nil {
+		return err
+	}
+	modTime := h.now()
+	if info, err := os.Stat(h.abs(dst)); err == nil {
+		modTime = info.ModTime()
+	}
+	writeXML(w, http.StatusOK, copyObjectResult{LastModified: s3Time(modTime), ETag: body.ETag()})
+	return nil
+}
+
+// deleteObject removes a file. Like S3 it succeeds for missing keys. A
+// "folder/" key removes the folder only if it is empty; the folders that
+// merely contained a deleted file are left in place since they are library
+// folders, not S3 artifacts.
+func (h *Handler) deleteObject(w http.ResponseWriter, r *http.Request, a *authContext, bucket, key string) error {
+	if _, err := h.requireBucket(a, bucket); err != nil {
+		return err
+	}
+	if err := h.removeKey(r.Context(), a, bucket, key); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *Handler) removeKey(ctx context.Context, a *authContext, bucket, key string) error {
+	rel, apiErr := objectPath(a, bucket, key)
+	if apiErr != nil {
+		return apiErr
+	}
+	info, err := os.Stat(h.abs(rel))
+	if err != nil {
+		if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+			return nil
+		}
+		return err
+	}
+	if info.IsDir() {
+		if !strings.HasSuffix(key, "/") {
+			return nil
+		}
+		entries, err := h.store.ReadDir(rel)
+		if err != nil || len(entries) > 0 {
+			return err
+		}
+		return h.store.DeleteFolder(ctx, rel)
+	}
+	if strings.HasSuffix(key, "/") {
+		return nil
+	}
+	return h.store.DeleteFile(ctx, rel)
+}
+
+// maxDeleteObjects matches S3's per-request limit for DeleteObjects.
+const maxDeleteObjects = 1000
+
+type deleteRequest struct {
+	XMLName xml.Name `xml:"Delete"`
+	Quiet   bool     `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deletedEntry struct {
+	Key string `xml:"Key"`
+}
+
+type deleteErrorEntry struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name           `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+	Deleted []deletedEntry     `xml:"Deleted"`
+	Errors  []deleteErrorEntry `xml:"Error"`
+}
+
+func (h *Handler) deleteObjects(w http.ResponseWriter, r *http.Request, a *authContext, bucket string) error {
+	if _, err := h.requireBucket(a, bucket); err != nil {
+		return err
+	}
+	var req deleteRequest
+	if err := decodeXMLBody(r, a, &req); err != nil {
+		return err
+	}
+	if len(req.Objects) > maxDeleteObjects {
+		return errMalformedXML
+	}
+
+	var res deleteResult
+	for _, obj := range req.Objects {
+		if err := h.removeKey(r.Context(), a, bucket, obj.Key); err != nil {
+			apiErr := h.toAPIError(r, err)
+			res.Errors = append(res.Errors, deleteErrorEntry{Key: obj.Key, Code: apiErr.Code, Message: apiErr.Message})
+			continue
+		}
+		if !req.Quiet {
+			res.Deleted = append(res.Deleted, deletedEntry{Key: obj.Key})
+		}
+	}
+	writeXML(w, http.StatusOK, res)
+	return nil
+}
+
+// maxXMLBody caps request bodies that are parsed as XML (DeleteObjects,
+// CompleteMultipartUpload with up to 10,000 parts).
+const maxXMLBody = 4 << 20
+
+// decodeXMLBody reads a signed XML request body into v.
+func decodeXMLBody(r *http.Request, a *authContext, v any) error {
+	body, apiErr := a.requestBody(r)
+	if apiErr != nil {
+		return apiErr
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxXMLBody+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxXMLBody {
+		return errMalformedXML
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return errMalformedXML
+	}
+	return nil
+}
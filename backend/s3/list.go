@@ -0,0 +1,285 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// defaultMaxKeys is S3's page size and also its upper bound.
+const defaultMaxKeys = 1000
+
+// listEntry is one row of a listing: an object or, with a delimiter, a
+// common prefix.
+type listEntry struct {
+	key     string
+	prefix  bool
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// isTempFile reports whether name is an in-flight atomic write from
+// fs.Service (".tmp-*"), which must never be listed as an object.
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".tmp-")
+}
+
+// collectKeys returns the objects (and, with a delimiter, common prefixes)
+// in the bucket at library path bucket whose keys start with prefix,
+// sorted by key. Folders are read through the store, so mounted folders
+// inside the bucket list like any other.
+//
+// The "/" delimiter — what every folder-browsing client sends — reads a
+// single directory. Any other listing walks the subtree below the deepest
+// folder the prefix names. Either way the result is sorted afterwards:
+// directory order ("a" before "a-b") is not S3 key order ("a-b" < "a/").
+func (h *Handler) collectKeys(bucket, prefix, delimiter string) ([]listEntry, error) {
+	dir := prefix[:strings.LastIndex(prefix, "/")+1]
+
+	var entries []listEntry
+	addObject := func(key string, info os.FileInfo) {
+		entries = append(entries, listEntry{key: key, size: info.Size(), modTime: info.ModTime(), etag: objectETag(info)})
+	}
+	// stat stats a key (not Lstat, so symlinks list as what they point at).
+	stat := func(key string) (os.FileInfo, error) {
+		return os.Stat(h.abs(path.Join(bucket, key)))
+	}
+	readDir := func(dir string) ([]os.DirEntry, error) {
+		des, err := h.store.ReadDir(path.Join(bucket, dir))
+		if err != nil && (os.IsNotExist(err) || os.IsPermission(err) || errors.Is(err, syscall.ENOTDIR)) {
+			return nil, nil
+		}
+		return des, err
+	}
+
+	if delimiter == "/" {
+		des, err := readDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, de := range des {
+			key := dir + de.Name()
+			if !strings.HasPrefix(key, prefix) || isTempFile(de.Name()) {
+				continue
+			}
+			info, err := stat(key)
+			if err != nil {
+				continue
+			}
+			if info.IsDir() {
+				entries = append(entries, listEntry{key: key + "/", prefix: true})
+			} else if info.Mode().IsRegular() {
+				addObject(key, info)
+			}
+		}
+		sortEntries(entries)
+		return entries, nil
+	}
+
+	seenPrefixes := map[string]bool{}
+	var walk func(dir string)
+	walk = func(dir string) {
+		des, err := readDir(dir)
+		if err != nil {
+			return // unreadable folder: skip, keep listing
+		}
+		for _, de := range des {
+			key := dir + de.Name()
+			if de.IsDir() {
+				if strings.HasPrefix(key+"/", prefix) || strings.HasPrefix(prefix, key+"/") {
+					walk(key + "/")
+				}
+				continue
+			}
+			if !strings.HasPrefix(key, prefix) || isTempFile(de.Name()) {
+				continue
+			}
+			if delimiter != "" {
+				if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+					cp := key[:len(prefix)+i+len(delimiter)]
+					if !seenPrefixes[cp] {
+						seenPrefixes[cp] = true
+						entries = append(entries, listEntry{key: cp, prefix: true})
+					}
+					continue
+				}
+			}
+			info, err := stat(key)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			addObject(key, info)
+		}
+	}
+	walk(dir)
+	sortEntries(entries)
+	return entries, nil
+}
+
+func sortEntries(entries []listEntry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+}
+
+// paginate returns up to maxKeys entries strictly after `after`, and
+// whether more remain.
+func paginate(entries []listEntry, after string, maxKeys int) ([]listEntry, bool) {
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].key > after })
+	entries = entries[i:]
+	if len(entries) > maxKeys {
+		return entries[:maxKeys], true
+	}
+	return entries, false
+}
+
+func parseMaxKeys(v string) (int, *APIError) {
+	if v == "" {
+		return defaultMaxKeys, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, errInvalidArgument
+	}
+	if n > defaultMaxKeys {
+		n = defaultMaxKeys
+	}
+	return n, nil
+}
+
+// keyEncoder applies encoding-type=url, which clients (aws-cli among them)
+// request so keys with control characters survive XML.
+func keyEncoder(q url.Values) func(string) string {
+	if q.Get("encoding-type") != "url" {
+		return func(s string) string { return s }
+	}
+	return func(s string) string { return strings.ReplaceAll(url.QueryEscape(s), "%2F", "/") }
+}
+
+type objectEntry struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Marker                *string        `xml:"Marker,omitempty"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	KeyCount              *int           `xml:"KeyCount,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []objectEntry  `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+// listPage runs a listing and fills the fields shared by v1 and v2.
+func (h *Handler) listPage(r *http.Request, a *authContext, bucket, after string) (*listBucketResult, []listEntry, error) {
+	bp, err := h.requireBucket(a, bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+	q := r.URL.Query()
+	maxKeys, apiErr := parseMaxKeys(q.Get("max-keys"))
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+
+	entries, err := h.collectKeys(bp, prefix, delimiter)
+	if err != nil {
+		return nil, nil, err
+	}
+	page, truncated := paginate(entries, after, maxKeys)
+
+	enc := keyEncoder(q)
+	res := &listBucketResult{
+		Name:         bucket,
+		Prefix:       enc(prefix),
+		MaxKeys:      maxKeys,
+		Delimiter:    enc(delimiter),
+		EncodingType: q.Get("encoding-type"),
+		IsTruncated:  truncated,
+	}
+	for _, e := range page {
+		if e.prefix {
+			res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: enc(e.key)})
+			continue
+		}
+		res.Contents = append(res.Contents, objectEntry{
+			Key:          enc(e.key),
+			LastModified: s3Time(e.modTime),
+			ETag:         e.etag,
+			Size:         e.size,
+			StorageClass: "STANDARD",
+		})
+	}
+	return res, page, nil
+}
+
+func (h *Handler) listObjectsV2(w http.ResponseWriter, r *http.Request, a *authContext, bucket string) error {
+	q := r.URL.Query()
+	after := q.Get("start-after")
+	token := q.Get("continuation-token")
+	if token != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return errInvalidArgument
+		}
+		after = string(decoded)
+	}
+
+	res, page, err := h.listPage(r, a, bucket, after)
+	if err != nil {
+		return err
+	}
+	enc := keyEncoder(q)
+	keyCount := len(page)
+	res.KeyCount = &keyCount
+	res.StartAfter = enc(q.Get("start-after"))
+	res.ContinuationToken = token
+	if res.IsTruncated {
+		res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(page[len(page)-1].key))
+	}
+	writeXML(w, http.StatusOK, res)
+	return nil
+}
+
+func (h *Handler) listObjectsV1(w http.ResponseWriter, r *http.Request, a *authContext, bucket string) error {
+	q := r.URL.Query()
+	marker := q.Get("marker")
+
+	res, page, err := h.listPage(r, a, bucket, marker)
+	if err != nil {
+		return err
+	}
+	enc := keyEncoder(q)
+	m := enc(marker)
+	res.Marker = &m
+	if res.IsTruncated {
+		res.NextMarker = enc(page[len(page)-1].key)
+	}
+	writeXML(w, http.StatusOK, res)
+	return nil
+}
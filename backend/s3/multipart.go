@@ -0,0 +1,301 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// Multipart uploads are staged on disk under stagingDir/<uploadId>/:
+//
+//	upload.json     — multipartUpload (destination + owning access key)
+//	part-00001      — part bytes
+//	part-00001.etag — quoted hex MD5 of the part
+//
+// Parts survive restarts. CompleteMultipartUpload streams the parts, in
+// order, through a single Store.WriteFile, so the library only ever sees
+// the finished object. S3's 5 MiB minimum part size is not enforced.
+const (
+	maxPartNumber      = 10000
+	uploadManifestName = "upload.json"
+	staleUploadMaxAge  = 7 * 24 * time.Hour
+	uploadIDLength     = 32
+)
+
+type multipartUpload struct {
+	Bucket      string    `json:"bucket"`
+	Key         string    `json:"key"`
+	Path        string    `json:"path"` // data-root-relative destination
+	AccessKeyID string    `json:"accessKeyId"`
+	ContentType string    `json:"contentType"`
+	Initiated   time.Time `json:"initiated"`
+}
+
+func partFileName(n int) string { return fmt.Sprintf("part-%05d", n) }
+
+// uploadDir validates an upload id (hex only, so it can't escape the
+// staging dir) and returns its folder.
+func (h *Handler) uploadDir(uploadID string) (string, bool) {
+	if len(uploadID) != uploadIDLength {
+		return "", false
+	}
+	if _, err := hex.DecodeString(uploadID); err != nil {
+		return "", false
+	}
+	return filepath.Join(h.stagingDir, uploadID), true
+}
+
+// loadUpload returns the upload if it exists and belongs to this
+// credential and bucket/key; anything else is NoSuchUpload.
+func (h *Handler) loadUpload(a *authContext, bucket, key, uploadID string) (*multipartUpload, string, error) {
+	dir, ok := h.uploadDir(uploadID)
+	if !ok {
+		return nil, "", errNoSuchUpload
+	}
+	data, err := os.ReadFile(filepath.Join(dir, uploadManifestName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", errNoSuchUpload
+		}
+		return nil, "", err
+	}
+	var up multipartUpload
+	if err := json.Unmarshal(data, &up); err != nil {
+		return nil, "", err
+	}
+	if up.AccessKeyID != a.cred.AccessKeyID || up.Bucket != bucket || up.Key != key {
+		return nil, "", errNoSuchUpload
+	}
+	return &up, dir, nil
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+func (h *Handler) createMultipartUpload(w http.ResponseWriter, r *http.Request, a *authContext, bucket, key string) error {
+	if _, err := h.requireBucket(a, bucket); err != nil {
+		return err
+	}
+	rel, apiErr := objectPath(a, bucket, key)
+	if apiErr != nil {
+		return apiErr
+	}
+	if strings.HasSuffix(key, "/") {
+		return errInvalidArgument
+	}
+	h.sweepStaleUploads()
+
+	uploadID := strings.ReplaceAll(uuid.New().String(), "-", "")
+	dir := filepath.Join(h.stagingDir, uploadID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(multipartUpload{
+		Bucket:      bucket,
+		Key:         key,
+		Path:        rel,
+		AccessKeyID: a.cred.AccessKeyID,
+		ContentType: contentTypeFor(r, key),
+		Initiated:   h.now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, uploadManifestName), data, 0644); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	writeXML(w, http.StatusOK, initiateMultipartUploadResult{Bucket: bucket, Key: key, UploadID: uploadID})
+	return nil
+}
+
+func (h *Handler) uploadPart(w http.ResponseWriter, r *http.Request, a *authContext, bucket, key string) error {
+	q := r.URL.Query()
+	_, dir, err := h.loadUpload(a, bucket, key, q.Get("uploadId"))
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(q.Get("partNumber"))
+	if err != nil || n < 1 || n > maxPartNumber {
+		return errInvalidArgument
+	}
+	body, apiErr := a.requestBody(r)
+	if apiErr != nil {
+		return apiErr
+	}
+
+	// Write to a temp file first so a failed or re-sent part never leaves a
+	// truncated part-NNNNN behind.
+	tmp, err := os.CreateTemp(dir, ".tmp-part-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	_, copyErr := io.Copy(tmp, body)
+	closeErr := tmp.Close()
+	if copyErr != nil || closeErr != nil {
+		os.Remove(tmpPath)
+		if copyErr != nil {
+			return copyErr
+		}
+		return closeErr
+	}
+	name := partFileName(n)
+	if err := os.Rename(tmpPath, filepath.Join(dir, name)); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	etag := body.ETag()
+	if err := os.WriteFile(filepath.Join(dir, name+".etag"), []byte(etag), 0644); err != nil {
+		return err
+	}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+func normalizeETag(etag string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(etag), `"`))
+}
+
+func (h *Handler) completeMultipartUpload(w http.ResponseWriter, r *http.Request, a *authContext, bucket, key, uploadID string) error {
+	up, dir, err := h.loadUpload(a, bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	var req completeMultipartUpload
+	if err := decodeXMLBody(r, a, &req); err != nil {
+		return err
+	}
+	if len(req.Parts) == 0 {
+		return errMalformedXML
+	}
+
+	// Validate the whole list before touching the destination, and build
+	// the multipart ETag: md5(concat(binary part md5s)) + "-<count>".
+	var readers []io.Reader
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	etagSum := md5.New()
+	prev := 0
+	for _, p := range req.Parts {
+		if p.PartNumber <= prev {
+			return errInvalidPartOrder
+		}
+		prev = p.PartNumber
+		name := partFileName(p.PartNumber)
+		stored, err := os.ReadFile(filepath.Join(dir, name+".etag"))
+		if err != nil || normalizeETag(string(stored)) != normalizeETag(p.ETag) {
+			return errInvalidPart
+		}
+		raw, err := hex.DecodeString(normalizeETag(p.ETag))
+		if err != nil {
+			return errInvalidPart
+		}
+		etagSum.Write(raw)
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return errInvalidPart
+		}
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+
+	if info, err := os.Stat(h.abs(up.Path)); err == nil && info.IsDir() {
+		return errPathConflict
+	}
+	if _, err := h.store.WriteFile(r.Context(), fs.WriteRequest{
+		Path:            up.Path,
+		Content:         io.MultiReader(readers...),
+		MimeType:        up.ContentType,
+		Source:          "s3",
+		ComputeMetadata: true,
+		Sync:            false,
+	}); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		log.Warn().Err(err).Str("uploadId", uploadID).Msg("s3: failed to remove completed multipart staging dir")
+	}
+	etag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(etagSum.Sum(nil)), len(req.Parts))
+	writeXML(w, http.StatusOK, completeMultipartUploadResult{
+		Location: h.prefix + "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     etag,
+	})
+	return nil
+}
+
+func (h *Handler) abortMultipartUpload(w http.ResponseWriter, a *authContext, bucket, key, uploadID string) error {
+	_, dir, err := h.loadUpload(a, bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// sweepStaleUploads drops multipart uploads that were started more than
+// staleUploadMaxAge ago and never completed or aborted. It runs whenever a
+// new upload starts, which is often enough for a single-user server.
+func (h *Handler) sweepStaleUploads() {
+	entries, err := os.ReadDir(h.stagingDir)
+	if err != nil {
+		return
+	}
+	cutoff := h.now().Add(-staleUploadMaxAge)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(h.stagingDir, e.Name(), uploadManifestName))
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(h.stagingDir, e.Name())); err != nil {
+			log.Warn().Err(err).Str("uploadId", e.Name()).Msg("s3: failed to remove stale multipart upload")
+		}
+	}
+}
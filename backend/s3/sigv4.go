@@ -0,0 +1,328 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4, the only scheme modern S3 clients speak. See
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+const (
+	sigV4Algorithm      = "AWS4-HMAC-SHA256"
+	sigV4ChunkAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+	amzDateFormat       = "20060102T150405Z"
+
+	payloadUnsigned          = "UNSIGNED-PAYLOAD"
+	payloadStreamingSigned   = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	payloadStreamingTrailer  = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	payloadStreamingSignedTr = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+
+	// emptySHA256 is hex(sha256("")), used in chunk string-to-sign.
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	maxClockSkew     = 15 * time.Minute
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// Credential is an S3 access key as resolved by a CredentialLookup.
+type Credential struct {
+	AccessKeyID string
+	SecretKey   string
+	// Root is the USER_DATA_DIR-relative folder the key is confined to
+	// ("" = the whole data dir). Buckets are the folders directly under it.
+	Root     string
+	ReadOnly bool
+}
+
+// CredentialLookup resolves an access key id. It returns (nil, nil) for
+// unknown or revoked keys.
+type CredentialLookup func(accessKeyID string) (*Credential, error)
+
+// authContext is what a verified request carries forward to body decoding.
+type authContext struct {
+	cred          *Credential
+	payloadHash   string // x-amz-content-sha256 (or UNSIGNED-PAYLOAD for presigned URLs)
+	amzDate       string
+	scope         string // date/region/service/aws4_request
+	signingKey    []byte
+	seedSignature string // request signature; first link of the chunk signature chain
+}
+
+// sigV4Request is the parsed signature material of one request, whether it
+// arrived in the Authorization header or as presigned-URL query params.
+type sigV4Request struct {
+	accessKeyID   string
+	date          string // yyyymmdd from the credential scope
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	amzDate       string
+	payloadHash   string
+	presigned     bool
+	expires       time.Duration
+}
+
+// authenticate verifies the SigV4 signature on r and resolves its
+// credential. now is injectable for tests.
+func authenticate(r *http.Request, lookup CredentialLookup, now time.Time) (*authContext, *APIError) {
+	req, apiErr := parseSigV4(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	t, err := time.Parse(amzDateFormat, req.amzDate)
+	if err != nil || req.amzDate[:8] != req.date {
+		return nil, errAuthHeaderMalformed
+	}
+	if req.presigned {
+		if now.Before(t.Add(-maxClockSkew)) {
+			return nil, errRequestTimeTooSkewed
+		}
+		if now.After(t.Add(req.expires)) {
+			return nil, errExpiredPresign
+		}
+	} else if d := now.Sub(t); d > maxClockSkew || d < -maxClockSkew {
+		return nil, errRequestTimeTooSkewed
+	}
+	if req.service != "s3" {
+		return nil, errAuthHeaderMalformed
+	}
+
+	cred, err := lookup(req.accessKeyID)
+	if err != nil {
+		return nil, errInternal
+	}
+	if cred == nil {
+		return nil, errInvalidAccessKeyID
+	}
+
+	scope := req.date + "/" + req.region + "/" + req.service + "/aws4_request"
+	key := signingKey(cred.SecretKey, req.date, req.region, req.service)
+	creq := canonicalRequest(r, req.signedHeaders, req.payloadHash)
+	sts := stringToSign(req.amzDate, scope, creq)
+	expected := hex.EncodeToString(hmacSHA256(key, sts))
+	if !hmac.Equal([]byte(expected), []byte(req.signature)) {
+		return nil, errSignatureDoesNotMatch
+	}
+
+	return &authContext{
+		cred:          cred,
+		payloadHash:   req.payloadHash,
+		amzDate:       req.amzDate,
+		scope:         scope,
+		signingKey:    key,
+		seedSignature: req.signature,
+	}, nil
+}
+
+// parseSigV4 extracts the signature material from either the Authorization
+// header or the X-Amz-* query params of a presigned URL.
+func parseSigV4(r *http.Request) (*sigV4Request, *APIError) {
+	q := r.URL.Query()
+	if q.Get("X-Amz-Algorithm") != "" {
+		if q.Get("X-Amz-Algorithm") != sigV4Algorithm {
+			return nil, errUnsupportedSignature
+		}
+		req := &sigV4Request{
+			signedHeaders: strings.Split(q.Get("X-Amz-SignedHeaders"), ";"),
+			signature:     q.Get("X-Amz-Signature"),
+			amzDate:       q.Get("X-Amz-Date"),
+			payloadHash:   payloadUnsigned,
+			presigned:     true,
+		}
+		if v := q.Get("X-Amz-Content-Sha256"); v != "" {
+			req.payloadHash = v
+		}
+		secs, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+		if err != nil || secs < 0 || time.Duration(secs)*time.Second > maxPresignExpiry {
+			return nil, errAuthHeaderMalformed
+		}
+		req.expires = time.Duration(secs) * time.Second
+		if !req.parseCredential(q.Get("X-Amz-Credential")) || req.signature == "" {
+			return nil, errAuthHeaderMalformed
+		}
+		return req, nil
+	}
+
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return nil, errAccessDenied
+	}
+	if !strings.HasPrefix(auth, sigV4Algorithm+" ") {
+		return nil, errUnsupportedSignature
+	}
+	req := &sigV4Request{payloadHash: r.Header.Get("X-Amz-Content-Sha256")}
+	var credential string
+	for _, part := range strings.Split(strings.TrimPrefix(auth, sigV4Algorithm+" "), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, errAuthHeaderMalformed
+		}
+		switch k {
+		case "Credential":
+			credential = v
+		case "SignedHeaders":
+			req.signedHeaders = strings.Split(v, ";")
+		case "Signature":
+			req.signature = v
+		}
+	}
+	if !req.parseCredential(credential) || req.signature == "" || len(req.signedHeaders) == 0 {
+		return nil, errAuthHeaderMalformed
+	}
+	// S3 requires the payload hash header on header-signed requests.
+	if req.payloadHash == "" {
+		return nil, errAuthHeaderMalformed
+	}
+
+	req.amzDate = r.Header.Get("X-Amz-Date")
+	if req.amzDate == "" {
+		t, err := http.ParseTime(r.Header.Get("Date"))
+		if err != nil {
+			return nil, errAuthHeaderMalformed
+		}
+		req.amzDate = t.UTC().Format(amzDateFormat)
+	}
+	return req, nil
+}
+
+// parseCredential splits "AKID/yyyymmdd/region/service/aws4_request".
+func (req *sigV4Request) parseCredential(v string) bool {
+	parts := strings.Split(v, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" || len(parts[1]) != 8 {
+		return false
+	}
+	req.accessKeyID, req.date, req.region, req.service = parts[0], parts[1], parts[2], parts[3]
+	return req.accessKeyID != ""
+}
+
+// canonicalRequest builds the SigV4 canonical request for r.
+func canonicalRequest(r *http.Request, signedHeaders []string, payloadHash string) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte('\n')
+	b.WriteString(canonicalURI(r.URL.Path))
+	b.WriteByte('\n')
+	b.WriteString(canonicalQuery(r.URL.Query()))
+	b.WriteByte('\n')
+	for _, h := range signedHeaders {
+		b.WriteString(h)
+		b.WriteByte(':')
+		b.WriteString(canonicalHeaderValue(r, h))
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	b.WriteString(strings.Join(signedHeaders, ";"))
+	b.WriteByte('\n')
+	b.WriteString(payloadHash)
+	return b.String()
+}
+
+// canonicalURI encodes each path segment once (S3 does not double-encode).
+func canonicalURI(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return uriEncode(p, false)
+}
+
+// canonicalQuery sorts params by key then value; the signature itself is
+// excluded for presigned URLs.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		if k == "X-Amz-Signature" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func canonicalHeaderValue(r *http.Request, name string) string {
+	var vals []string
+	switch name {
+	case "host":
+		vals = []string{r.Host}
+	case "content-length":
+		// Server requests keep the header; requests built in-process may
+		// only carry the length on the struct.
+		if v := r.Header.Get("Content-Length"); v != "" {
+			vals = []string{v}
+		} else if r.ContentLength >= 0 {
+			vals = []string{strconv.FormatInt(r.ContentLength, 10)}
+		}
+	default:
+		vals = r.Header.Values(name)
+	}
+	for i, v := range vals {
+		vals[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(vals, ",")
+}
+
+// uriEncode implements the SigV4 URI encoding: every byte except the
+// unreserved set (and '/' when encodeSlash is false) becomes %XX.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexUpper = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexUpper[c>>4])
+		b.WriteByte(hexUpper[c&15])
+	}
+	return b.String()
+}
+
+func stringToSign(amzDate, scope, canonicalRequest string) string {
+	return sigV4Algorithm + "\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+}
+
+func signingKey(secret, date, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), date)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+// chunkSignature computes the signature of one aws-chunked payload chunk,
+// chained from the previous chunk's (or the request's) signature.
+func (a *authContext) chunkSignature(prevSignature string, chunkSHA256 string) string {
+	sts := sigV4ChunkAlgorithm + "\n" + a.amzDate + "\n" + a.scope + "\n" +
+		prevSignature + "\n" + emptySHA256 + "\n" + chunkSHA256
+	return hex.EncodeToString(hmacSHA256(a.signingKey, sts))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -41,6 +41,27 @@ type Config struct {
 	// Agent LLM
 	AgentLLM AgentLLMConfig
 
+	// AgentFramesCompress zstd-compresses the persisted frames of archived
+	// agent sessions.
+	AgentFramesCompress bool
+
+	// AgentRegistryFile declares extra ACP agents (see
+	// agentsdk.LoadAgentRegistry). Ignored when it is inside UserDataDir.
+	AgentRegistryFile string
+
+	// Limits for the warm agent process pools; 0 = no cap.
+	AgentPoolMaxWarm  int
+	AgentPoolMemoryMB int
+
+	// Resource limits for agent processes and their terminal commands;
+	// 0 = no limit.
+	AgentLimitCPUs          float64
+	AgentLimitMemoryMB      int
+	AgentLimitPids          int
+	AgentTurnTimeoutSecs    int
+	AgentCommandTimeoutSecs int
+	AgentIsolateNetwork     bool
+
 	// Auth mode: "none" (default) or "password". Third-party OAuth lives in
 	// the cloud gateway, not the backend.
 	AuthMode string
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// Zero-downtime restarts (SIGUSR2). The running server starts its
+// successor — the binary now at os.Args[0] — handing it the listening
+// socket, and once the successor is serving it stops accepting connections
+// itself. Prompts already in flight finish on the old process (or are
+// stopped when HandoffDrainTimeout passes), but it starts no new turns:
+// agent clients still attached are sent to the successor as soon as their
+// session is idle (SetDrainStart). Frames are on disk, so clients that
+// reconnect pick them up from the successor. The old process then shuts
+// down as usual but stays around as a thin parent of its successor, so a
+// supervisor watching the original PID (systemd, an init in a container)
+// does not see it exit.
+const (
+	// listenFDEnv and readyFDEnv pass the inherited socket and the
+	// readiness pipe to the successor.
+	listenFDEnv = "MLD_LISTEN_FD"
+	readyFDEnv  = "MLD_READY_FD"
+
+	// handoffStartTimeout bounds how long the successor may take to open
+	// its databases, migrate and start serving.
+	handoffStartTimeout = 2 * time.Minute
+	// HandoffDrainTimeout bounds how long the old process keeps serving
+	// sessions with a prompt in flight.
+	HandoffDrainTimeout = 30 * time.Minute
+)
+
+// inheritHandoff picks up the listening socket and readiness pipe passed
+// by a predecessor, clearing the variables so agent processes never see
+// them. Returns nils when this process was started normally.
+func inheritHandoff() (net.Listener, *os.File, error) {
+	fdStr := os.Getenv(listenFDEnv)
+	readyStr := os.Getenv(readyFDEnv)
+	os.Unsetenv(listenFDEnv)
+	os.Unsetenv(readyFDEnv)
+	if fdStr == "" {
+		return nil, nil, nil
+	}
+	fd, err := strconv.Atoi(fdStr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s=%q: %w", listenFDEnv, fdStr, err)
+	}
+	f := os.NewFile(uintptr(fd), "inherited-listener")
+	ln, err := net.FileListener(f)
+	f.Close() // FileListener dups the descriptor
+	if err != nil {
+		return nil, nil, fmt.Errorf("inherited listener: %w", err)
+	}
+	var ready *os.File
+	if fd, err := strconv.Atoi(readyStr); err == nil {
+		ready = os.NewFile(uintptr(fd), "handoff-ready")
+	}
+	return ln, ready, nil
+}
+
+// HandedOver reports whether this process took over from a predecessor.
+func (s *Server) HandedOver() bool { return s.inheritedListener != nil }
+
+// SetHandoffEnv records the environment the successor starts with. The
+// app variables are cleared from this process after startup (secrets), so
+// main captures them first.
+func (s *Server) SetHandoffEnv(env []string) { s.handoffEnv = env }
+
+// SetDrainCheck installs the check Handoff uses to tell when the sessions
+// left on this process are idle: it returns how many prompts are in flight.
+func (s *Server) SetDrainCheck(busy func() int) { s.drainBusy = busy }
+
+// SetDrainStart installs what Handoff runs once the successor is serving,
+// before waiting for the drain: it stops this process starting agent turns.
+func (s *Server) SetDrainStart(start func()) { s.drainStart = start }
+
+// listen returns the socket to serve on: inherited from a predecessor, or
+// freshly bound.
+func (s *Server) listen(addr string) (net.Listener, error) {
+	if s.inheritedListener != nil {
+		log.Info().Str("addr", s.inheritedListener.Addr().String()).Msg("serving on socket handed over by predecessor")
+		return s.inheritedListener, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// signalReady tells a waiting predecessor that this process is serving.
+func (s *Server) signalReady() {
+	if s.readyPipe == nil {
+		return
+	}
+	if _, err := s.readyPipe.Write([]byte{1}); err != nil {
+		log.Warn().Err(err).Msg("handoff: failed to signal readiness")
+	}
+	s.readyPipe.Close()
+	s.readyPipe = nil
+}
+
+// Handoff starts a successor on this server's socket and, once it is
+// serving, stops accepting connections and drains this process. On error
+// the successor (if any) is gone and this process carries on serving.
+// After a nil return the caller shuts down and then calls WaitSuccessor.
+func (s *Server) Handoff(ctx context.Context) error {
+	tcpLn, ok := s.listener.(*net.TCPListener)
+	if !ok {
+		return errors.New("handoff: server is not listening on a TCP socket")
+	}
+	lnFile, err := tcpLn.File()
+	if err != nil {
+		return fmt.Errorf("handoff: %w", err)
+	}
+	defer lnFile.Close()
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("handoff: %w", err)
+	}
+	defer readyR.Close()
+
+	bin, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		readyW.Close()
+		return fmt.Errorf("handoff: %w", err)
+	}
+	env := s.handoffEnv
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd := exec.Command(bin, os.Args[1:]...)
+	// ExtraFiles[i] becomes descriptor 3+i in the child.
+	cmd.Env = append(env, listenFDEnv+"=3", readyFDEnv+"=4")
+	cmd.ExtraFiles = []*os.File{lnFile, readyW}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		readyW.Close()
+		return fmt.Errorf("handoff: start successor: %w", err)
+	}
+	readyW.Close()
+	log.Info().Int("pid", cmd.Process.Pid).Str("binary", bin).Msg("handoff: successor started, waiting for it to serve")
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	ready := make(chan bool, 1)
+	go func() {
+		buf := make([]byte, 1)
+		n, _ := readyR.Read(buf)
+		ready <- n == 1
+	}()
+
+	timer := time.NewTimer(handoffStartTimeout)
+	defer timer.Stop()
+	select {
+	case ok := <-ready:
+		if !ok {
+			_ = cmd.Process.Kill()
+			<-exited
+			return errors.New("handoff: successor exited before serving")
+		}
+	case err := <-exited:
+		return fmt.Errorf("handoff: successor exited before serving: %v", err)
+	case <-timer.C:
+		_ = cmd.Process.Kill()
+		<-exited
+		return errors.New("handoff: successor did not start serving in time")
+	case <-ctx.Done():
+		_ = cmd.Process.Kill()
+		<-exited
+		return ctx.Err()
+	}
+	s.successor, s.successorExited = cmd, exited
+	log.Info().Int("pid", cmd.Process.Pid).Msg("handoff: successor is serving; draining this process")
+
+	s.drain(ctx)
+	return nil
+}
+
+// drain stops accepting connections and background work, then waits for
+// the sessions still attached here to finish their prompts.
+func (s *Server) drain(ctx context.Context) {
+	// SSE clients reconnect — to the successor, which now owns the socket.
+	s.stopBackground()
+	if s.drainStart != nil {
+		s.drainStart()
+	}
+	if s.http != nil {
+		httpCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := s.http.Shutdown(httpCtx); err != nil {
+			log.Warn().Err(err).Msg("handoff: http shutdown")
+		}
+		cancel()
+	}
+	if s.drainBusy == nil {
+		return
+	}
+	deadline := time.Now().Add(HandoffDrainTimeout)
+	tick := time.NewTicker(2 * time.Second)
+	defer tick.Stop()
+	for {
+		n := s.drainBusy()
+		if n == 0 {
+			log.Info().Msg("handoff: no prompts in flight, finishing")
+			return
+		}
+		if time.Now().After(deadline) {
+			log.Warn().Int("inFlight", n).Msg("handoff: drain timeout, stopping remaining prompts")
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// WaitSuccessor blocks until the successor started by Handoff exits,
+// forwarding SIGINT and SIGTERM to it, and returns its exit code.
+func (s *Server) WaitSuccessor() int {
+	if s.successor == nil {
+		return 0
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	for {
+		select {
+		case sig := <-sigs:
+			_ = s.successor.Process.Signal(sig)
+		case err := <-s.successorExited:
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return exitErr.ExitCode()
+			}
+			return 0
+		}
+	}
+}
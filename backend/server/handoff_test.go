@@ -0,0 +1,76 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestInheritHandoff_ServesOnPassedSocket(t *testing.T) {
+	orig, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orig.Close()
+	lnFile, err := orig.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lnFile.Close()
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readyR.Close()
+
+	// In a real handoff these are descriptors 3 and 4 of the successor.
+	t.Setenv(listenFDEnv, strconv.Itoa(int(lnFile.Fd())))
+	t.Setenv(readyFDEnv, strconv.Itoa(int(readyW.Fd())))
+	ln, ready, err := inheritHandoff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.Getenv(listenFDEnv) != "" || os.Getenv(readyFDEnv) != "" {
+		t.Error("handoff variables left in the environment")
+	}
+
+	s := &Server{inheritedListener: ln, readyPipe: ready}
+	if !s.HandedOver() {
+		t.Fatal("HandedOver() = false")
+	}
+	got, err := s.listen("ignored:0")
+	if err != nil || got.Addr().String() != orig.Addr().String() {
+		t.Fatalf("listen() = %v, %v; want the inherited socket on %s", got, err, orig.Addr())
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "successor")
+	})}
+	go srv.Serve(got)
+	defer srv.Close()
+	s.signalReady()
+
+	buf := make([]byte, 1)
+	if n, err := readyR.Read(buf); n != 1 || err != nil {
+		t.Fatalf("ready pipe read = %d, %v", n, err)
+	}
+	resp, err := http.Get("http://" + orig.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "successor" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestInheritHandoff_NormalStart(t *testing.T) {
+	t.Setenv(listenFDEnv, "")
+	ln, ready, err := inheritHandoff()
+	if ln != nil || ready != nil || err != nil {
+		t.Errorf("inheritHandoff() = %v, %v, %v; want nils", ln, ready, err)
+	}
+}
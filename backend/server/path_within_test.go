@@ -0,0 +1,37 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathWithin(t *testing.T) {
+	root := t.TempDir()
+	data := filepath.Join(root, "data")
+	app := filepath.Join(root, "app")
+	for _, d := range []string{data, app} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A symlink inside the app dir that points back into the library.
+	if err := os.Symlink(data, filepath.Join(app, "lib")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join(data, ".agents.json"), true},
+		{filepath.Join(data, "sub", "agents.json"), true},
+		{filepath.Join(app, "lib", "agents.json"), true},
+		{filepath.Join(app, "agents.json"), false},
+		{filepath.Join(root, "data-other", "agents.json"), false},
+	} {
+		if got := pathWithin(data, tc.path); got != tc.want {
+			t.Errorf("pathWithin(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
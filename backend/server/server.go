@@ -7,10 +7,13 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-contrib/gzip"
@@ -27,8 +30,10 @@ import (
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 	mcppkg "github.com/xiaoyuanzhu-com/my-life-db/mcp"
 	"github.com/xiaoyuanzhu-com/my-life-db/mcptools"
+	"github.com/xiaoyuanzhu-com/my-life-db/jobs"
 	"github.com/xiaoyuanzhu-com/my-life-db/notifications"
 	"github.com/xiaoyuanzhu-com/my-life-db/skills"
+	"github.com/xiaoyuanzhu-com/my-life-db/workers/mediameta"
 	"github.com/xiaoyuanzhu-com/my-life-db/workers/sessionindex"
 	"github.com/xiaoyuanzhu-com/my-life-db/workers/textindex"
 )
@@ -42,7 +47,9 @@ type Server struct {
 	appDB        *db.DB // persistent user data: pins, settings, sessions, agent_*, explore_*
 	fsService    *fs.Service
 	textIndexer  *textindex.Indexer
+	mediaWorker  *mediameta.Worker
 	sessionIndexer *sessionindex.Indexer
+	jobQueue     *jobs.Queue // persistent background work: previews, indexing
 	notifService *notifications.Service
 	agentClient  *agentsdk.Client
 	agentProxy   *agentproxy.Server   // loopback HTTP proxy that injects upstream LLM creds
@@ -75,8 +82,19 @@ type Server struct {
 	shutdownCancel context.CancelFunc
 
 	// HTTP
-	router *gin.Engine
-	http   *http.Server
+	router   *gin.Engine
+	http     *http.Server
+	listener net.Listener
+
+	// Zero-downtime handoff (see handoff.go)
+	inheritedListener net.Listener // socket passed by a predecessor
+	readyPipe         *os.File     // tells the predecessor we are serving
+	handoffEnv        []string
+	drainBusy         func() int
+	drainStart        func()
+	successor         *exec.Cmd
+	successorExited   chan error
+	stopBackgroundOnce sync.Once
 }
 
 // codexModelCatalog is a snapshot of the upstream codex CLI's default model
@@ -125,6 +143,14 @@ func New(cfg *Config) (*Server, error) {
 		shutdownCancel: cancel,
 	}
 
+	// A predecessor handing over (SIGUSR2) passes its listening socket.
+	var err error
+	s.inheritedListener, s.readyPipe, err = inheritHandoff()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
 	// 1. Open both databases. Index DB holds the rebuildable file/search
 	// index (files, files_fts, sqlar); app DB holds persistent user
 	// data (pins, settings, sessions, agent_*, explore_*).
@@ -203,16 +229,27 @@ func New(cfg *Config) (*Server, error) {
 
 	// 1.4. Startup recovery: mark any sessions that were still is_processing=1
 	// (i.e. the server was killed mid-prompt) as interrupted so the frontend
-	// can show the "Resume" banner on reconnect.
-	{
+	// can show the "Resume" banner on reconnect. Not after a handoff: the
+	// predecessor is still running those prompts and records their outcome.
+	if !s.HandedOver() {
 		now := db.NowMs()
 		if n, err := appDB.MarkAllInProgressInterrupted(ctx, now); err != nil {
 			log.Warn().Err(err).Msg("failed to mark in-progress sessions as interrupted")
 		} else if n > 0 {
 			log.Info().Int64("count", n).Msg("marked interrupted sessions at startup")
 		}
+		// No agent process survives a restart, so nobody is waiting on the
+		// approvals those turns left pending.
+		if n, err := appDB.CancelPendingAgentApprovals(ctx, "", now); err != nil {
+			log.Warn().Err(err).Msg("failed to cancel pending approvals")
+		} else if n > 0 {
+			log.Info().Int64("count", n).Msg("cancelled pending approvals at startup")
+		}
 	}
 
+	// WebDAV locks are persisted in the app DB; reload the unexpired ones.
+	s.webdavLocks = newWebDAVLockSystem(s.appDB)
+
 	// Ensure the well-known top-level USER_DATA_DIR subfolders (agents,
 	// explore, sessions) exist and have a README.md. Idempotent — safe to
 	// run on every startup; READMEs are seeded only when missing so user
@@ -235,6 +272,16 @@ func New(cfg *Config) (*Server, error) {
 		qwenEnv := map[string]string{}
 		geminiEnv := map[string]string{}
 		opencodeEnv := map[string]string{}
+		// Variables the agent registry file may reference. The upstream key
+		// is deliberately not one of them: declared agents reach the gateway
+		// through the proxy (AGENT_PROXY_URL / AGENT_PROXY_TOKEN, set below).
+		home, _ := os.UserHomeDir()
+		registryVars := map[string]string{
+			"APP_DATA_DIR":  cfg.AppDataDir,
+			"USER_DATA_DIR": cfg.UserDataDir,
+			"HOME":          home,
+		}
+		var completer agentsdk.Completer
 		if cfg.AgentLLM.HasAgentLLM() {
 			// Start a loopback reverse-proxy that holds the real upstream key
 			// in-process and injects it on outgoing requests. The Claude Code
@@ -257,6 +304,8 @@ func New(cfg *Config) (*Server, error) {
 			}
 			s.agentProxy = proxySrv
 			ccToken := proxy.IssueToken()
+			registryVars["AGENT_PROXY_URL"] = proxySrv.BaseURL()
+			registryVars["AGENT_PROXY_TOKEN"] = proxy.IssueToken()
 
 			ccEnv["ANTHROPIC_BASE_URL"] = proxySrv.BaseURL()
 			ccEnv["ANTHROPIC_API_KEY"] = ccToken
@@ -280,6 +329,14 @@ func New(cfg *Config) (*Server, error) {
 				codexEnv["OPENAI_MODEL"] = codexModels[0].Value
 			}
 
+			// Agent-free completions (titles, tags, summaries) go through the
+			// proxy on their own token, defaulting to the small/fast models.
+			completionModels := map[agentsdk.Provider]string{
+				agentsdk.ProviderAnthropic: ccEnv["ANTHROPIC_SMALL_FAST_MODEL"],
+				agentsdk.ProviderOpenAI:    codexEnv["OPENAI_MODEL"],
+			}
+			completer = agentsdk.NewHTTPCompleter(proxySrv.BaseURL(), proxy.IssueToken(), completionModels)
+
 			qwenEnv["OPENAI_BASE_URL"] = cfg.AgentLLM.BaseURL
 			qwenEnv["OPENAI_API_KEY"] = cfg.AgentLLM.APIKey
 			if qwenModels := FilterModelsForAgent(cfg.AgentLLM.Models, "qwen"); len(qwenModels) > 0 {
@@ -410,61 +467,133 @@ base_url = %q
 		}
 
 		ccAgent := agentsdk.AgentConfig{
-			Type:    agentsdk.AgentClaudeCode,
-			Name:    "Claude Code",
-			Command: "claude-agent-acp",
-			Env:     ccEnv,
+			Type:          agentsdk.AgentClaudeCode,
+			Name:          "Claude Code",
+			Command:       "claude-agent-acp",
+			Env:           ccEnv,
+			ModelEnv:      []string{"ANTHROPIC_MODEL"},
+			SmallModelEnv: "ANTHROPIC_SMALL_FAST_MODEL",
+			Capabilities:  agentsdk.AgentCapabilities{SetModel: true, Effort: true},
 		}
 		codexAgent := agentsdk.AgentConfig{
-			Type:    agentsdk.AgentCodex,
-			Name:    "Codex",
-			Command: "codex-acp",
-			Env:     codexEnv,
+			Type:         agentsdk.AgentCodex,
+			Name:         "Codex",
+			Command:      "codex-acp",
+			Env:          codexEnv,
+			ModelEnv:     []string{"OPENAI_MODEL"},
+			Capabilities: agentsdk.AgentCapabilities{SetModel: true},
 		}
 
+		// qwen's set_model rejects gateway names (see SetupACP); OPENAI_MODEL
+		// at spawn is what selects its model.
 		qwenAgent := agentsdk.AgentConfig{
-			Type:    agentsdk.AgentQwen,
-			Name:    "Qwen",
-			Command: "qwen",
-			Args:    []string{"--acp"},
-			Env:     qwenEnv,
+			Type:     agentsdk.AgentQwen,
+			Name:     "Qwen",
+			Command:  "qwen",
+			Args:     []string{"--acp"},
+			Env:      qwenEnv,
+			ModelEnv: []string{"OPENAI_MODEL"},
 		}
 
 		geminiAgent := agentsdk.AgentConfig{
-			Type:    agentsdk.AgentGemini,
-			Name:    "Gemini",
-			Command: "gemini",
-			Args:    []string{"--acp"},
-			Env:     geminiEnv,
+			Type:         agentsdk.AgentGemini,
+			Name:         "Gemini",
+			Command:      "gemini",
+			Args:         []string{"--acp"},
+			Env:          geminiEnv,
+			ModelEnv:     []string{"GEMINI_MODEL"},
+			Capabilities: agentsdk.AgentCapabilities{SetModel: true},
 		}
 
 		// opencode reads its provider config from the path in OPENCODE_CONFIG
 		// (provisioned above). The Env map carries OPENCODE_CONFIG explicitly
 		// so it survives config.ClearEnvVars and reaches the spawned subprocess.
+		// Its model comes from opencode.json, not env; SetModel needs the
+		// provider prefix from that file's "litellm" block.
 		opencodeAgent := agentsdk.AgentConfig{
-			Type:    agentsdk.AgentOpencode,
-			Name:    "opencode",
-			Command: "opencode",
-			Args:    []string{"acp"},
-			Env:     opencodeEnv,
+			Type:         agentsdk.AgentOpencode,
+			Name:         "opencode",
+			Command:      "opencode",
+			Args:         []string{"acp"},
+			Env:          opencodeEnv,
+			ModelPrefix:  "litellm/",
+			Capabilities: agentsdk.AgentCapabilities{SetModel: true},
+		}
+
+		// Extra agents (or overrides of the built-ins) declared in
+		// AGENT_REGISTRY_FILE (default <APP_DATA_DIR>/agents.json). A broken
+		// file is logged and ignored rather than taking the built-ins down
+		// with it. The file chooses the commands the server runs, so one
+		// inside the library — writable by members, WebDAV, S3 and the
+		// agents themselves — is refused.
+		builtinAgents := []agentsdk.AgentConfig{ccAgent, codexAgent, qwenAgent, geminiAgent, opencodeAgent}
+		registryPath := cfg.AgentRegistryFile
+		agents := builtinAgents
+		if registryPath != "" && pathWithin(cfg.UserDataDir, registryPath) {
+			log.Error().Str("path", registryPath).Msg("agent registry is inside USER_DATA_DIR; ignoring it, using built-in agents only")
+		} else if registryPath != "" {
+			if agents, err = agentsdk.LoadAgentRegistry(registryPath, builtinAgents, registryVars); err != nil {
+				log.Error().Err(err).Str("path", registryPath).Msg("failed to load agent registry; using built-in agents only")
+				agents = builtinAgents
+			}
+		}
+		builtinTypes := make(map[agentsdk.AgentType]bool, len(builtinAgents))
+		for _, a := range builtinAgents {
+			builtinTypes[a.Type] = true
+		}
+		for i, a := range agents {
+			// Declared agents boot on their first tagged gateway model, the
+			// same way the built-ins do above, unless the file pins one.
+			if len(a.ModelEnv) == 0 || builtinTypes[a.Type] {
+				continue
+			}
+			models := FilterModelsForAgent(cfg.AgentLLM.Models, string(a.Type))
+			if len(models) == 0 {
+				continue
+			}
+			env := make(map[string]string, len(a.Env)+len(a.ModelEnv)+1)
+			for k, v := range a.ModelEnvFor(models[0].Value, models[0].ClaudeSmall) {
+				env[k] = v
+			}
+			for k, v := range a.Env {
+				env[k] = v
+			}
+			agents[i].Env = env
 		}
 
 		// SystemPrompt and McpServers are intentionally empty here — both are
 		// built per-session in agent_manager.CreateSession so the X-MLD-Storage-Id
 		// header and HTML-render path can carry the storage id.
-		s.agentClient = agentsdk.NewClient(agentsdk.SessionConfig{}, ccAgent, codexAgent, qwenAgent, geminiAgent, opencodeAgent)
+		s.agentClient = agentsdk.NewClient(agentsdk.SessionConfig{}, agents...)
+		if completer != nil {
+			s.agentClient.SetCompleter(completer)
+		}
 
 		// Frame store: persists raw ACP frames to APP_DATA_DIR/agent_frames/*.jsonl
 		// for cross-restart session resume. Created here so it can be passed to
 		// the AgentManager (wired later in main.go via handlers).
 		s.frameStore = agentsdk.NewFrameStore(cfg.AppDataDir)
+		s.frameStore.SetCompression(cfg.AgentFramesCompress)
 
 		// Configure each agent CLI to keep session transcripts forever.
 		// Must run after the settings.json overwrites above, since some agents
 		// share files (~/.gemini/settings.json, ~/.qwen/settings.json) and
 		// retention is layered on via read-merge-write.
-		agentsdk.EnsureRetentionConfigs()
-
+		agentsdk.EnsureRetentionConfigs(agents...)
+
+		// Confine agent processes before the pool spawns any.
+		s.agentClient.SetResourceLimits(agentsdk.ResourceLimits{
+			CPUs:           cfg.AgentLimitCPUs,
+			MemoryBytes:    int64(cfg.AgentLimitMemoryMB) << 20,
+			Pids:           cfg.AgentLimitPids,
+			TurnTimeout:    time.Duration(cfg.AgentTurnTimeoutSecs) * time.Second,
+			CommandTimeout: time.Duration(cfg.AgentCommandTimeoutSecs) * time.Second,
+			IsolateNetwork: cfg.AgentIsolateNetwork,
+		})
+		s.agentClient.SetPoolLimits(agentsdk.PoolLimits{
+			MaxWarm:     cfg.AgentPoolMaxWarm,
+			MemoryLimit: int64(cfg.AgentPoolMemoryMB) << 20,
+		})
 		s.agentClient.StartPool(ctx, agentsdk.AgentClaudeCode, 3)
 
 		log.Info().
@@ -472,6 +601,7 @@ base_url = %q
 			Str("agent_base_url", cfg.AgentLLM.BaseURL).
 			Int("agent_models", len(cfg.AgentLLM.Models)).
 			Str("cc_model", ccEnv["ANTHROPIC_MODEL"]).
+			Int("agents", len(agents)).
 			Msg("agent client initialized")
 	}
 
@@ -532,6 +662,10 @@ base_url = %q
 	s.notifService = notifications.NewService()
 
 	// 4. Create FS service (uses index DB — files/sqlar)
+	// Background job queue (jobs table in the index DB). Kinds are
+	// registered below, once their workers exist.
+	s.jobQueue = jobs.New(s.indexDB)
+
 	log.Info().Msg("initializing filesystem service")
 	fsCfg := cfg.ToFSConfig()
 	fsCfg.DB = fs.NewDBAdapter(s.indexDB)
@@ -541,18 +675,41 @@ base_url = %q
 	fsCfg.LibraryNotifier = func(filePath, operation string) {
 		s.notifService.NotifyLibraryChanged(filePath, operation)
 	}
+	fsCfg.WriteLimits = s.storageWriteLimits
+	fsCfg.Jobs = s.jobQueue
+	if settings != nil {
+		fsCfg.IgnorePatterns = settings.Indexing.IgnorePatterns
+		fsCfg.Mounts = MountsFromSettings(settings.Indexing.MountedFolders)
+		fsCfg.FollowSymlinks = settings.Indexing.FollowSymlinks != nil && *settings.Indexing.FollowSymlinks
+	}
 	s.fsService = fs.NewService(fsCfg)
 
 	// 5. Create text indexer (writes synchronously to SQLite FTS5 files_fts
 	// in the index DB)
 	log.Info().Msg("initializing text indexer")
-	s.textIndexer = textindex.NewIndexer(s.fsService.DataRoot(), s.indexDB)
+	s.textIndexer = textindex.NewIndexer(s.fsService.ResolvePath, s.indexDB, s.fsService.IsExcluded)
+
+	// 5.2. Create media metadata worker (EXIF/GPS, video and audio tags →
+	// file_media in the index DB)
+	s.mediaWorker = mediameta.New(s.fsService.ResolvePath, s.indexDB, s.fsService.IsExcluded)
 
 	// 5.5. Create session indexer (periodic sweep: extracts text from
 	// persisted ACP frames and upserts into agent_sessions_fts on the index
 	// DB). Eventually consistent — sweep interval is 5m.
 	log.Info().Msg("initializing session indexer")
 	s.sessionIndexer = sessionindex.New(s.appDB, s.indexDB, s.frameStore, 0)
+	s.sessionIndexer.SetQueue(s.jobQueue)
+
+	// 5.6. Register the background job kinds. Per-kind pools keep slow work
+	// (video frames, office documents) from holding up text indexing.
+	s.jobQueue.Register(fs.PreviewJobKind, s.fsService.RunPreviewJob, jobs.Options{Concurrency: 2, Timeout: 2 * time.Minute})
+	s.jobQueue.Register(fs.PhashJobKind, s.fsService.RunPhashJob, jobs.Options{Concurrency: 1})
+	s.jobQueue.Register(textindex.JobKind, s.textIndexer.IndexJob, jobs.Options{Concurrency: 2})
+	s.jobQueue.Register(mediameta.JobKind, s.mediaWorker.ExtractJob, jobs.Options{Concurrency: 2})
+	s.jobQueue.Register(sessionindex.JobKind, s.sessionIndexer.IndexJob, jobs.Options{Concurrency: 1})
+	s.jobQueue.SetProgressNotifier(func(stats jobs.Stats) {
+		s.notifService.NotifyJobsProgress(stats)
+	})
 
 	// 8. Wire service connections
 	s.connectServices()
@@ -566,10 +723,12 @@ base_url = %q
 
 // connectServices wires up event handlers between services
 func (s *Server) connectServices() {
-	// FS → Text Indexer: When files change, index for search
+	// FS → Text Indexer, media worker: When files change, queue them for
+	// search indexing and metadata extraction
 	s.fsService.SetFileChangeHandler(func(event fs.FileChangeEvent) {
 		if event.ContentChanged {
-			s.textIndexer.OnFileChange(event.FilePath, event.IsNew, true)
+			s.jobQueue.Enqueue(textindex.JobKind, event.FilePath, jobs.PriorityNormal)
+			s.jobQueue.Enqueue(mediameta.JobKind, event.FilePath, jobs.PriorityNormal)
 		}
 
 		// Emit file events to hooks registry for auto-run agents
@@ -628,6 +787,7 @@ func (s *Server) setupRouter() {
 		gzip.WithExcludedPaths([]string{
 			"/api/data/events",        // SSE - needs streaming
 			"/api/data/uploads/tus/",  // TUS - needs ResponseController for timeout extension
+			"/s3/",                    // S3 - object bodies, Range and Content-Length must pass through
 		}),
 		gzip.WithExcludedPathsRegexs([]string{
 			"/api/agent/sessions/.*/subscribe", // WebSocket - agent session updates
@@ -710,9 +870,16 @@ func (s *Server) Start() error {
 		return fmt.Errorf("failed to start FS service: %w", err)
 	}
 
+	// Start the background job workers (previews, indexing). Jobs left
+	// running by the last shutdown are queued again first.
+	s.jobQueue.Start(s.shutdownCtx)
+
 	// Backfill the FTS5 index for any files that aren't yet indexed.
 	go s.textIndexer.Backfill()
 
+	// Extract media metadata for photos, videos and audio not seen yet.
+	go s.mediaWorker.Backfill()
+
 	// Start the periodic session-transcript indexer (writes into
 	// agent_sessions_fts). Runs an immediate catch-up sweep on startup, then
 	// sweeps every 5 minutes until shutdownCtx is cancelled.
@@ -738,6 +905,12 @@ func (s *Server) Start() error {
 	// Start background sweep of stale agent-attachment staging dirs.
 	go s.runAttachmentsJanitor()
 
+	// Compress the frames of sessions archived before compression was on.
+	go s.archiveSessionFrames()
+
+	// Record daily library size snapshots for the storage usage endpoint.
+	go s.runStorageSnapshots()
+
 	// Create HTTP server
 	s.http = &http.Server{
 		Addr:     fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port),
@@ -750,8 +923,15 @@ func (s *Server) Start() error {
 		Str("env", s.cfg.Env).
 		Msg("HTTP server starting")
 
+	ln, err := s.listen(s.http.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+	s.signalReady()
+
 	// Start HTTP server (blocks)
-	return s.http.ListenAndServe()
+	return s.http.Serve(ln)
 }
 
 // Shutdown gracefully shuts down the server using drain-then-shutdown.
@@ -765,8 +945,9 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	log.Info().Msg("signaling handlers to stop")
 	s.shutdownCancel()
 
-	// 3. Close notification service to cleanly disconnect SSE clients
-	s.notifService.Shutdown()
+	// 3. Close notification service to cleanly disconnect SSE clients, and
+	// stop background work (done already if this process handed over).
+	s.stopBackground()
 
 	// Give handlers a moment to process the cancellation and close connections.
 	time.Sleep(100 * time.Millisecond)
@@ -781,20 +962,9 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		log.Info().Msg("HTTP listener closed")
 	}
 
-	// 4.5. Stop agent runner + hooks (before agent client shutdown)
-	if s.agentRunner != nil {
-		s.agentRunner.Stop()
-	}
-	if s.mcpTools != nil {
-		s.mcpTools.Stop()
-	}
-	if s.hookRegistry != nil {
-		s.hookRegistry.Stop()
-	}
-
-	// 5. Shutdown agent client (close all ACP sessions + warm pool)
+	// 5. Shutdown agent client (close all ACP sessions; the warm pool went
+	// with the background work)
 	if s.agentClient != nil {
-		s.agentClient.ShutdownPool()
 		if err := s.agentClient.Shutdown(ctx); err != nil {
 			log.Error().Err(err).Msg("agent client shutdown error")
 		}
@@ -816,9 +986,6 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		s.frameStore.Close()
 	}
 
-	// 6. Stop background services (in reverse order of startup)
-	s.fsService.Stop()
-
 	// 7. Close databases last. Close app DB before index DB so any in-flight
 	// app connections release their ATTACH handles before the underlying
 	// index file goes away.
@@ -874,28 +1041,76 @@ func (s *Server) runAttachmentsJanitor() {
 	}
 }
 
+// archiveSessionFrames archives the persisted frames of every archived
+// agent session. Only needed with compression on: sessions archived since
+// are handled by the archive endpoint, and Archive skips sessions with no
+// live frame file, so later runs are cheap.
+func (s *Server) archiveSessionFrames() {
+	if s.frameStore == nil || !s.cfg.AgentFramesCompress {
+		return
+	}
+	ids, err := s.appDB.GetArchivedAgentSessionIDs()
+	if err != nil {
+		log.Error().Err(err).Msg("frame_store: list archived sessions failed")
+		return
+	}
+	for id := range ids {
+		if s.shutdownCtx.Err() != nil {
+			return
+		}
+		if err := s.frameStore.Archive(id); err != nil {
+			log.Error().Err(err).Str("sessionId", id).Msg("frame_store: archive failed")
+		}
+	}
+}
+
+// stopBackground disconnects SSE clients and stops everything that is not
+// serving an agent session already in progress: auto-run agents, hooks,
+// the warm agent pool, background jobs and the filesystem service. Runs
+// once — at handoff, so the successor alone does that work, or at shutdown.
+func (s *Server) stopBackground() {
+	s.stopBackgroundOnce.Do(func() {
+		s.notifService.Shutdown()
+
+		// Agent runner + hooks go before the agent client shuts down.
+		if s.agentRunner != nil {
+			s.agentRunner.Stop()
+		}
+		if s.mcpTools != nil {
+			s.mcpTools.Stop()
+		}
+		if s.hookRegistry != nil {
+			s.hookRegistry.Stop()
+		}
+		if s.agentClient != nil {
+			s.agentClient.ShutdownPool()
+		}
+
+		// Background services, in reverse order of startup.
+		s.jobQueue.Stop()
+		s.fsService.Stop()
+	})
+}
+
 // Component accessors for API handlers
 func (s *Server) IndexDB() *db.DB                             { return s.indexDB }
 func (s *Server) AppDB() *db.DB                               { return s.appDB }
 func (s *Server) FS() *fs.Service                             { return s.fsService }
 func (s *Server) TextIndexer() *textindex.Indexer            { return s.textIndexer }
+func (s *Server) Jobs() *jobs.Queue                           { return s.jobQueue }
 func (s *Server) Notifications() *notifications.Service       { return s.notifService }
 func (s *Server) AgentClient() *agentsdk.Client                { return s.agentClient }
 func (s *Server) FrameStore() *agentsdk.FrameStore             { return s.frameStore }
 func (s *Server) Explore() *explore.Service                      { return s.explore }
 func (s *Server) HookRegistry() *hooks.Registry                  { return s.hookRegistry }
 func (s *Server) FSHook() *hooks.FSHook                          { return s.fsHook }
+func (s *Server) CronHook() *hooks.CronHook                      { return s.cronHook }
 func (s *Server) AgentRunner() *agentrunner.Runner               { return s.agentRunner }
 func (s *Server) MCP() *mcppkg.Server                            { return s.mcpServer }
 func (s *Server) MCPTools() *mcptools.Cache                      { return s.mcpTools }
 func (s *Server) MCPToken() string                            { return s.mcpToken }
 
-func (s *Server) WebDAVLocks() webdav.LockSystem {
-	if s.webdavLocks == nil {
-		s.webdavLocks = webdav.NewMemLS()
-	}
-	return s.webdavLocks
-}
+func (s *Server) WebDAVLocks() webdav.LockSystem              { return s.webdavLocks }
 func (s *Server) Cfg() *Config                               { return s.cfg }
 func (s *Server) Router() *gin.Engine                         { return s.router }
 func (s *Server) ShutdownContext() context.Context            { return s.shutdownCtx }
@@ -978,3 +1193,19 @@ The agent runner watches this folder and picks up changes automatically.
 
 When relevant, suggest the user include instructions to use the publish-post tool to share results on the explore page.`
 }
+
+// pathWithin reports whether p is dir or below it, after resolving symlinks
+// in both (a path that doesn't exist yet is compared as given).
+func pathWithin(dir, p string) bool {
+	canon := func(p string) string {
+		if c, err := filepath.EvalSymlinks(p); err == nil {
+			return c
+		}
+		if c, err := filepath.EvalSymlinks(filepath.Dir(p)); err == nil {
+			return filepath.Join(c, filepath.Base(p))
+		}
+		return filepath.Clean(p)
+	}
+	rel, err := filepath.Rel(canon(dir), canon(p))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+	"github.com/xiaoyuanzhu-com/my-life-db/models"
+)
+
+const (
+	// storageSnapshotInterval is how often a library size snapshot is
+	// recorded; storageSnapshotRetention is how long they are kept.
+	storageSnapshotInterval  = 24 * time.Hour
+	storageSnapshotRetention = 2 * 365 * 24 * time.Hour
+)
+
+// storageWriteLimits is the fs.Service WriteLimits callback: Storage.MaxFileSize
+// applies to every write, and a write under a top-level folder with an entry
+// in Storage.FolderQuotas may only use what that folder has left. Settings
+// are re-read on every call so changes apply without a restart.
+func (s *Server) storageWriteLimits(path string) fs.WriteLimits {
+	settings, err := s.appDB.LoadUserSettings()
+	if err != nil {
+		log.Warn().Err(err).Msg("storage: failed to load settings, write limits not applied")
+		return fs.WriteLimits{}
+	}
+
+	var limits fs.WriteLimits
+	if mb := settings.Storage.MaxFileSize; mb != nil && *mb > 0 {
+		limits.MaxFileSize = int64(*mb) << 20
+	}
+
+	// Files directly in the data root belong to no folder.
+	top, _, nested := strings.Cut(strings.Trim(path, "/"), "/")
+	if !nested {
+		return limits
+	}
+	quotaMB, ok := settings.Storage.FolderQuotas[top]
+	if !ok || quotaMB <= 0 {
+		return limits
+	}
+	used, err := s.indexDB.SumFileSizes(top)
+	if err != nil {
+		log.Warn().Err(err).Str("folder", top).Msg("storage: failed to measure folder usage, quota not applied")
+		return limits
+	}
+	limits.QuotaFolder = top
+	limits.QuotaLeft = int64(quotaMB)<<20 - used
+	return limits
+}
+
+// runStorageSnapshots records a library size snapshot once a day while the
+// server is up, and prunes snapshots past retention.
+func (s *Server) runStorageSnapshots() {
+	const checkInterval = time.Hour
+
+	s.maybeTakeStorageSnapshot()
+	t := time.NewTicker(checkInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.shutdownCtx.Done():
+			return
+		case <-t.C:
+			s.maybeTakeStorageSnapshot()
+		}
+	}
+}
+
+func (s *Server) maybeTakeStorageSnapshot() {
+	latest, err := s.appDB.LatestStorageSnapshotAt()
+	if err != nil {
+		log.Error().Err(err).Msg("storage: failed to read latest snapshot")
+		return
+	}
+	now := time.Now()
+	if now.Sub(time.UnixMilli(latest)) < storageSnapshotInterval {
+		return
+	}
+
+	byFolder, err := s.indexDB.UsageByFolder("")
+	if err != nil {
+		log.Error().Err(err).Msg("storage: failed to measure library usage")
+		return
+	}
+	snap := &db.StorageSnapshot{TakenAt: now.UnixMilli(), ByFolder: make(map[string]int64, len(byFolder))}
+	for _, u := range byFolder {
+		snap.FileCount += u.FileCount
+		snap.TotalSize += u.Size
+		snap.ByFolder[u.Folder] = u.Size
+	}
+
+	ctx := context.Background()
+	if err := s.appDB.InsertStorageSnapshot(ctx, snap); err != nil {
+		log.Error().Err(err).Msg("storage: failed to record snapshot")
+		return
+	}
+	if err := s.appDB.DeleteStorageSnapshotsBefore(ctx, now.Add(-storageSnapshotRetention).UnixMilli()); err != nil {
+		log.Warn().Err(err).Msg("storage: failed to prune old snapshots")
+	}
+	log.Info().Int64("files", snap.FileCount).Int64("bytes", snap.TotalSize).Msg("storage: snapshot recorded")
+}
+
+// MountsFromSettings converts the Indexing.MountedFolders setting to the
+// fs.Service form.
+func MountsFromSettings(folders []models.MountedFolder) []fs.Mount {
+	mounts := make([]fs.Mount, 0, len(folders))
+	for _, f := range folders {
+		mounts = append(mounts, fs.Mount{Path: f.Path, Source: f.Source})
+	}
+	return mounts
+}
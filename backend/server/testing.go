@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/fs"
+	"github.com/xiaoyuanzhu-com/my-life-db/notifications"
+)
+
+// NewForTesting returns a Server wired with only appDB, a notifications
+// service, the WebDAV lock store and a shutdown context that ends with ctx
+// — enough for handler and agent-manager tests in other packages, which
+// cannot run New (the index DB needs the FTS tokenizer extension).
+// Everything else is nil.
+func NewForTesting(ctx context.Context, cfg *Config, appDB *db.DB) *Server {
+	shutdownCtx, cancel := context.WithCancel(ctx)
+	return &Server{
+		cfg:            cfg,
+		appDB:          appDB,
+		notifService:   notifications.NewService(),
+		webdavLocks:    newWebDAVLockSystem(appDB),
+		shutdownCtx:    shutdownCtx,
+		shutdownCancel: cancel,
+	}
+}
+
+// SetFSForTesting gives a NewForTesting server a library service, for
+// handler tests that touch files.
+func (s *Server) SetFSForTesting(fsService *fs.Service) {
+	s.fsService = fsService
+}
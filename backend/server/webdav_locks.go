@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// webdavLockSystem is a webdav.LockSystem with the same semantics as
+// webdav.NewMemLS, except that finite-timeout locks are written through to
+// the app DB and reloaded at startup, so a client's LOCK survives a
+// restart. Infinite-timeout locks — which is what webdav.Handler takes
+// internally around every unlocked write — stay in memory only.
+//
+// Lock roots are slash-separated and absolute ("/notes/a.md"). Callers
+// that serve several data roots namespace them before they get here (see
+// api.scopedLockSystem).
+//
+// The lock set of a personal server is tiny, so locks are kept in a flat
+// map keyed by token and conflict checks are linear scans.
+type webdavLockSystem struct {
+	mu    sync.Mutex
+	db    *db.DB // nil = memory only
+	locks map[string]*webdavLock
+}
+
+type webdavLock struct {
+	token   string
+	details webdav.LockDetails
+	expiry  time.Time // zero for infinite locks
+	held    bool
+}
+
+// newWebDAVLockSystem builds the lock system, loading unexpired locks from
+// appDB. A load failure is logged and the server starts with no locks.
+func newWebDAVLockSystem(appDB *db.DB) *webdavLockSystem {
+	ls := &webdavLockSystem{db: appDB, locks: make(map[string]*webdavLock)}
+	if appDB == nil {
+		return ls
+	}
+
+	now := db.NowMs()
+	if n, err := appDB.DeleteExpiredWebDAVLocks(context.Background(), now); err != nil {
+		log.Warn().Err(err).Msg("webdav: failed to sweep expired locks")
+	} else if n > 0 {
+		log.Info().Int64("count", n).Msg("webdav: swept expired locks")
+	}
+
+	recs, err := appDB.ListWebDAVLocks(now)
+	if err != nil {
+		log.Warn().Err(err).Msg("webdav: failed to load persisted locks")
+		return ls
+	}
+	for _, r := range recs {
+		ls.locks[r.Token] = &webdavLock{
+			token: r.Token,
+			details: webdav.LockDetails{
+				Root:      r.Root,
+				Duration:  time.Duration(r.DurationMs) * time.Millisecond,
+				OwnerXML:  r.OwnerXML,
+				ZeroDepth: r.ZeroDepth,
+			},
+			expiry: time.UnixMilli(r.ExpiresAt),
+		}
+	}
+	if len(recs) > 0 {
+		log.Info().Int("count", len(recs)).Msg("webdav: restored persisted locks")
+	}
+	return ls
+}
+
+func lockSlashClean(name string) string {
+	return path.Clean("/" + name)
+}
+
+// lockCovers reports whether a lock rooted at root (with the given depth)
+// applies to name.
+func lockCovers(root string, zeroDepth bool, name string) bool {
+	if name == root {
+		return true
+	}
+	if zeroDepth {
+		return false
+	}
+	return lockIsDescendant(name, root)
+}
+
+func lockIsDescendant(name, ancestor string) bool {
+	if ancestor == "/" {
+		return name != "/"
+	}
+	return strings.HasPrefix(name, ancestor+"/")
+}
+
+func (ls *webdavLockSystem) collectExpired(now time.Time) {
+	for token, l := range ls.locks {
+		if l.held || l.expiry.IsZero() || now.Before(l.expiry) {
+			continue
+		}
+		delete(ls.locks, token)
+		ls.forget(token)
+	}
+}
+
+// persist writes a finite lock through to the DB. Write errors are logged,
+// not returned: the lock is still valid for this process's lifetime.
+func (ls *webdavLockSystem) persist(l *webdavLock) {
+	if ls.db == nil || l.expiry.IsZero() {
+		return
+	}
+	err := ls.db.SaveWebDAVLock(context.Background(), &db.WebDAVLockRecord{
+		Token:      l.token,
+		Root:       l.details.Root,
+		OwnerXML:   l.details.OwnerXML,
+		ZeroDepth:  l.details.ZeroDepth,
+		DurationMs: l.details.Duration.Milliseconds(),
+		ExpiresAt:  l.expiry.UnixMilli(),
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("root", l.details.Root).Msg("webdav: failed to persist lock")
+	}
+}
+
+func (ls *webdavLockSystem) forget(token string) {
+	if ls.db == nil {
+		return
+	}
+	if err := ls.db.DeleteWebDAVLock(context.Background(), token); err != nil {
+		log.Warn().Err(err).Str("token", token).Msg("webdav: failed to delete persisted lock")
+	}
+}
+
+// lookup returns the lock that covers name and matches one of the
+// conditions' tokens, skipping locks already held. ETag and Not conditions
+// are ignored, as in webdav.NewMemLS.
+func (ls *webdavLockSystem) lookup(name string, conditions ...webdav.Condition) *webdavLock {
+	for _, c := range conditions {
+		l := ls.locks[c.Token]
+		if l == nil || l.held {
+			continue
+		}
+		if lockCovers(l.details.Root, l.details.ZeroDepth, name) {
+			return l
+		}
+	}
+	return nil
+}
+
+func (ls *webdavLockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (func(), error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.collectExpired(now)
+
+	var l0, l1 *webdavLock
+	if name0 != "" {
+		if l0 = ls.lookup(lockSlashClean(name0), conditions...); l0 == nil {
+			return nil, webdav.ErrConfirmationFailed
+		}
+	}
+	if name1 != "" {
+		if l1 = ls.lookup(lockSlashClean(name1), conditions...); l1 == nil {
+			return nil, webdav.ErrConfirmationFailed
+		}
+	}
+	if l1 == l0 {
+		l1 = nil
+	}
+	for _, l := range []*webdavLock{l0, l1} {
+		if l != nil {
+			l.held = true
+		}
+	}
+	return func() {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		for _, l := range []*webdavLock{l0, l1} {
+			if l != nil {
+				l.held = false
+			}
+		}
+	}, nil
+}
+
+func (ls *webdavLockSystem) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.collectExpired(now)
+	details.Root = lockSlashClean(details.Root)
+
+	for _, l := range ls.locks {
+		// The target, or an infinite-depth ancestor of it, is locked.
+		if lockCovers(l.details.Root, l.details.ZeroDepth, details.Root) {
+			return "", webdav.ErrLocked
+		}
+		// An infinite-depth lock would cover an existing descendant lock.
+		if !details.ZeroDepth && lockIsDescendant(l.details.Root, details.Root) {
+			return "", webdav.ErrLocked
+		}
+	}
+
+	l := &webdavLock{token: "urn:uuid:" + uuid.New().String(), details: details}
+	if details.Duration >= 0 {
+		l.expiry = now.Add(details.Duration)
+	}
+	ls.locks[l.token] = l
+	ls.persist(l)
+	return l.token, nil
+}
+
+func (ls *webdavLockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.collectExpired(now)
+
+	l := ls.locks[token]
+	if l == nil {
+		return webdav.LockDetails{}, webdav.ErrNoSuchLock
+	}
+	if l.held {
+		return webdav.LockDetails{}, webdav.ErrLocked
+	}
+	wasPersisted := !l.expiry.IsZero()
+	l.details.Duration = duration
+	l.expiry = time.Time{}
+	if duration >= 0 {
+		l.expiry = now.Add(duration)
+		ls.persist(l)
+	} else if wasPersisted {
+		ls.forget(token)
+	}
+	return l.details, nil
+}
+
+func (ls *webdavLockSystem) Unlock(now time.Time, token string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.collectExpired(now)
+
+	l := ls.locks[token]
+	if l == nil {
+		return webdav.ErrNoSuchLock
+	}
+	if l.held {
+		return webdav.ErrLocked
+	}
+	delete(ls.locks, token)
+	if !l.expiry.IsZero() {
+		ls.forget(token)
+	}
+	return nil
+}
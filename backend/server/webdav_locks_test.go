@@ -0,0 +1,109 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+)
+
+func openTestAppDB(t *testing.T) *db.DB {
+	t.Helper()
+	d, err := db.Open(db.Config{
+		Path:         filepath.Join(t.TempDir(), "app.sqlite"),
+		Role:         db.DBRoleApp,
+		MaxOpenConns: 4,
+		MaxIdleConns: 2,
+	})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+	d.StartWriter(db.WriterConfig{})
+	return d
+}
+
+func TestWebDAVLockSystem_Conflicts(t *testing.T) {
+	ls := newWebDAVLockSystem(nil)
+	now := time.Now()
+
+	dirTok, err := ls.Create(now, webdav.LockDetails{Root: "/notes", Duration: time.Minute})
+	if err != nil {
+		t.Fatalf("Create /notes: %v", err)
+	}
+	// Infinite-depth lock on /notes covers its children...
+	if _, err := ls.Create(now, webdav.LockDetails{Root: "/notes/a.md", Duration: time.Minute, ZeroDepth: true}); err != webdav.ErrLocked {
+		t.Fatalf("Create child under infinite lock: got %v, want ErrLocked", err)
+	}
+	// ...and an infinite lock on an ancestor would cover it.
+	if _, err := ls.Create(now, webdav.LockDetails{Root: "/", Duration: time.Minute}); err != webdav.ErrLocked {
+		t.Fatalf("Create ancestor infinite lock: got %v, want ErrLocked", err)
+	}
+	// Siblings with a shared name prefix are independent.
+	if _, err := ls.Create(now, webdav.LockDetails{Root: "/notes2", Duration: time.Minute}); err != nil {
+		t.Fatalf("Create /notes2: %v", err)
+	}
+
+	release, err := ls.Confirm(now, "/notes/a.md", "", webdav.Condition{Token: dirTok})
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	if err := ls.Unlock(now, dirTok); err != webdav.ErrLocked {
+		t.Fatalf("Unlock while held: got %v, want ErrLocked", err)
+	}
+	release()
+	if err := ls.Unlock(now, dirTok); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if err := ls.Unlock(now, dirTok); err != webdav.ErrNoSuchLock {
+		t.Fatalf("second Unlock: got %v, want ErrNoSuchLock", err)
+	}
+
+	// Expired locks stop conflicting.
+	if _, err := ls.Create(now, webdav.LockDetails{Root: "/x.md", Duration: time.Second, ZeroDepth: true}); err != nil {
+		t.Fatalf("Create /x.md: %v", err)
+	}
+	if _, err := ls.Create(now.Add(2*time.Second), webdav.LockDetails{Root: "/x.md", Duration: time.Second, ZeroDepth: true}); err != nil {
+		t.Fatalf("Create over expired lock: %v", err)
+	}
+}
+
+func TestWebDAVLockSystem_PersistsAcrossReload(t *testing.T) {
+	d := openTestAppDB(t)
+	now := time.Now()
+
+	ls := newWebDAVLockSystem(d)
+	tok, err := ls.Create(now, webdav.LockDetails{Root: "/doc.md", Duration: time.Hour, OwnerXML: "<owner>me</owner>", ZeroDepth: true})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// Infinite locks (the handler's per-request write locks) aren't persisted.
+	if _, err := ls.Create(now, webdav.LockDetails{Root: "/tmp.md", Duration: -1, ZeroDepth: true}); err != nil {
+		t.Fatalf("Create infinite: %v", err)
+	}
+
+	reloaded := newWebDAVLockSystem(d)
+	if len(reloaded.locks) != 1 {
+		t.Fatalf("reloaded %d locks, want 1", len(reloaded.locks))
+	}
+	details, err := reloaded.Refresh(now, tok, 2*time.Hour)
+	if err != nil {
+		t.Fatalf("Refresh after reload: %v", err)
+	}
+	if details.Root != "/doc.md" || details.OwnerXML != "<owner>me</owner>" || !details.ZeroDepth {
+		t.Fatalf("reloaded details = %+v", details)
+	}
+	if _, err := reloaded.Create(now, webdav.LockDetails{Root: "/doc.md", Duration: time.Hour}); err != webdav.ErrLocked {
+		t.Fatalf("Create over reloaded lock: got %v, want ErrLocked", err)
+	}
+
+	if err := reloaded.Unlock(now, tok); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if n := len(newWebDAVLockSystem(d).locks); n != 0 {
+		t.Fatalf("after unlock, reloaded %d locks, want 0", n)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package utils
+
+import "errors"
+
+// DiskAvailableBytes is not implemented on this platform.
+func DiskAvailableBytes(path string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
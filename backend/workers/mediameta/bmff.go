@@ -0,0 +1,630 @@
+package mediameta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ISO base media files (MP4, QuickTime, 3GP, M4A, HEIF/AVIF) are trees of
+// boxes ("atoms"): a 32-bit size, a four-character type, then the payload,
+// which for container boxes is more boxes.
+//
+// Video metadata lives under moov: mvhd has the creation time and
+// duration, each trak's tkhd the frame size and rotation, and udta/meta
+// the user-visible tags (Apple's location and local creation date among
+// them). HEIF images instead keep a meta box listing items, one of which
+// is the EXIF block.
+
+// maxBoxPayload bounds how much of a leaf box is read into memory.
+const maxBoxPayload = 1 << 20
+
+// mp4Epoch is the zero of MP4 timestamps.
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// quickTimeTopLevel are atoms an ftyp-less QuickTime file may start with.
+var quickTimeTopLevel = map[string]bool{"moov": true, "mdat": true, "wide": true, "free": true, "skip": true, "pnot": true}
+
+// heifBrands mark an ftyp as a still image rather than a movie.
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true, "mif1": true, "avif": true,
+}
+
+type box struct {
+	typ       string
+	dataStart int64
+	end       int64
+}
+
+func (b box) size() int64 { return b.end - b.dataStart }
+
+// walkBoxes calls fn for each box between start and end.
+func walkBoxes(r io.ReaderAt, start, end int64, fn func(box) error) error {
+	for i := 0; start+8 <= end && i < maxSegments; i++ {
+		hdr, err := readAt(r, start, 8)
+		if err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(hdr))
+		headerLen := int64(8)
+		switch size {
+		case 0: // extends to the end of the enclosing box
+			size = end - start
+		case 1: // 64-bit size follows the type
+			ext, err := readAt(r, start+8, 8)
+			if err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(ext))
+			headerLen = 16
+		}
+		if size < headerLen || start+size > end {
+			return errTruncated
+		}
+		if err := fn(box{typ: string(hdr[4:8]), dataStart: start + headerLen, end: start + size}); err != nil {
+			return err
+		}
+		start += size
+	}
+	return nil
+}
+
+// payload reads a leaf box's contents.
+func payload(r io.ReaderAt, b box) ([]byte, error) {
+	if b.size() > maxBoxPayload {
+		return nil, errors.New("box too large")
+	}
+	return readAt(r, b.dataStart, int(b.size()))
+}
+
+// mp4Tags collects tag values while walking, so sources can be ranked
+// once everything has been seen.
+type mp4Tags struct {
+	created      time.Time // mvhd, UTC
+	appleCreated string    // com.apple.quicktime.creationdate, local with offset
+	day          string    // ©day
+	location     string    // ISO 6709
+	trackW       int
+	trackH       int
+	rotation     int
+}
+
+// parseBMFF reads an MP4/QuickTime movie or a HEIF image.
+func parseBMFF(r io.ReaderAt, size int64, m *Metadata) error {
+	tags := &mp4Tags{}
+	heif := false
+	var errs []error
+	err := walkBoxes(r, 0, size, func(b box) error {
+		var err error
+		switch b.typ {
+		case "ftyp":
+			heif = isHEIFBrand(r, b)
+		case "moov":
+			err = parseMoov(r, b, m, tags)
+		case "meta":
+			if heif {
+				err = parseHEIFMeta(r, b, m)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	tags.apply(m)
+	return errors.Join(errs...)
+}
+
+// isHEIFBrand reports whether the ftyp's major brand is a still-image one.
+func isHEIFBrand(r io.ReaderAt, b box) bool {
+	data, err := payload(r, b)
+	return err == nil && len(data) >= 4 && heifBrands[string(data[:4])]
+}
+
+func parseMoov(r io.ReaderAt, moov box, m *Metadata, tags *mp4Tags) error {
+	return walkBoxes(r, moov.dataStart, moov.end, func(b box) error {
+		switch b.typ {
+		case "mvhd":
+			if data, err := payload(r, b); err == nil {
+				parseMvhd(data, m, tags)
+			}
+		case "trak":
+			parseTrak(r, b, tags)
+		case "udta":
+			parseUdta(r, b, m, tags)
+		case "meta":
+			parseMP4Meta(r, b, m, tags)
+		}
+		return nil
+	})
+}
+
+func parseMvhd(data []byte, m *Metadata, tags *mp4Tags) {
+	var created, timescale, duration uint64
+	switch {
+	case len(data) >= 32 && data[0] == 1:
+		created = binary.BigEndian.Uint64(data[4:])
+		timescale = uint64(binary.BigEndian.Uint32(data[20:]))
+		duration = binary.BigEndian.Uint64(data[24:])
+	case len(data) >= 20:
+		created = uint64(binary.BigEndian.Uint32(data[4:]))
+		timescale = uint64(binary.BigEndian.Uint32(data[12:]))
+		duration = uint64(binary.BigEndian.Uint32(data[16:]))
+	default:
+		return
+	}
+	if created > 0 && created < 1<<40 {
+		tags.created = mp4Epoch.Add(time.Duration(created) * time.Second)
+	}
+	if timescale > 0 && duration > 0 && duration != 0xFFFFFFFF {
+		m.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+	}
+}
+
+// parseTrak finds tkhd (frame size and rotation) in a track.
+func parseTrak(r io.ReaderAt, trak box, tags *mp4Tags) {
+	walkBoxes(r, trak.dataStart, trak.end, func(b box) error {
+		if b.typ != "tkhd" {
+			return nil
+		}
+		data, err := payload(r, b)
+		if err != nil {
+			return nil
+		}
+		matrixAt := 40
+		if len(data) > 0 && data[0] == 1 {
+			matrixAt = 52
+		}
+		if len(data) < matrixAt+44 {
+			return nil
+		}
+		// Width and height are 16.16 fixed point after the 3x3 matrix.
+		w := int(binary.BigEndian.Uint32(data[matrixAt+36:]) >> 16)
+		h := int(binary.BigEndian.Uint32(data[matrixAt+40:]) >> 16)
+		if w*h > tags.trackW*tags.trackH {
+			tags.trackW, tags.trackH = w, h
+			a := int32(binary.BigEndian.Uint32(data[matrixAt:]))
+			bb := int32(binary.BigEndian.Uint32(data[matrixAt+4:]))
+			tags.rotation = matrixRotation(a, bb)
+		}
+		return nil
+	})
+}
+
+// matrixRotation maps the a and b entries of a track matrix to the EXIF
+// orientation describing the same rotation.
+func matrixRotation(a, b int32) int {
+	const one = 1 << 16
+	switch {
+	case a == 0 && b == one:
+		return 6 // 90° clockwise
+	case a == -one && b == 0:
+		return 3 // 180°
+	case a == 0 && b == -one:
+		return 8 // 270° clockwise
+	}
+	return 0
+}
+
+// parseUdta reads QuickTime user data: ©xyz and ©day hold a 16-bit
+// length and language code before the string; meta holds iTunes-style
+// tags.
+func parseUdta(r io.ReaderAt, udta box, m *Metadata, tags *mp4Tags) {
+	walkBoxes(r, udta.dataStart, udta.end, func(b box) error {
+		switch b.typ {
+		case "\xa9xyz", "\xa9day", "\xa9nam", "\xa9ART", "\xa9alb", "\xa9mak", "\xa9mod":
+			data, err := payload(r, b)
+			if err != nil || len(data) < 4 {
+				return nil
+			}
+			if len(data) >= 8 && string(data[4:8]) == "data" {
+				// iTunes-style item rather than a QuickTime string.
+				if v, ok := ilstValue(r, b); ok {
+					setMP4Tag(b.typ, v, m, tags)
+				}
+				return nil
+			}
+			if n := int(binary.BigEndian.Uint16(data)); 4+n <= len(data) {
+				setMP4Tag(b.typ, string(data[4:4+n]), m, tags)
+			}
+		case "meta":
+			parseMP4Meta(r, b, m, tags)
+		}
+		return nil
+	})
+}
+
+// parseMP4Meta reads a meta box's keys and ilst. In MP4 meta is a full
+// box (4 bytes of version and flags before its children); in QuickTime
+// it isn't, which shows as hdlr starting right away.
+func parseMP4Meta(r io.ReaderAt, meta box, m *Metadata, tags *mp4Tags) {
+	start := meta.dataStart
+	if peek, err := readAt(r, start, 8); err == nil && string(peek[4:8]) != "hdlr" {
+		start += 4
+	}
+	var keys []string
+	walkBoxes(r, start, meta.end, func(b box) error {
+		switch b.typ {
+		case "keys":
+			keys = parseKeys(r, b)
+		case "ilst":
+			walkBoxes(r, b.dataStart, b.end, func(item box) error {
+				name := item.typ
+				// Items of a keys-based ilst are named by 1-based index.
+				if idx := int(binary.BigEndian.Uint32([]byte(item.typ))); idx >= 1 && idx <= len(keys) {
+					name = keys[idx-1]
+				}
+				if v, ok := ilstValue(r, item); ok {
+					setMP4Tag(name, v, m, tags)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// parseKeys reads the mdta key names of a keys box.
+func parseKeys(r io.ReaderAt, b box) []string {
+	data, err := payload(r, b)
+	if err != nil || len(data) < 8 {
+		return nil
+	}
+	count := int(binary.BigEndian.Uint32(data[4:]))
+	var keys []string
+	for pos := 8; len(keys) < count && pos+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		if size < 8 || pos+size > len(data) {
+			break
+		}
+		keys = append(keys, string(data[pos+8:pos+size]))
+		pos += size
+	}
+	return keys
+}
+
+// ilstValue returns the string in an ilst item's data box (type
+// indicator 1, UTF-8).
+func ilstValue(r io.ReaderAt, item box) (string, bool) {
+	var value string
+	found := false
+	walkBoxes(r, item.dataStart, item.end, func(b box) error {
+		if b.typ != "data" || found {
+			return nil
+		}
+		data, err := payload(r, b)
+		if err != nil || len(data) < 8 || binary.BigEndian.Uint32(data)&0xFFFFFF != 1 {
+			return nil
+		}
+		value, found = string(data[8:]), true
+		return nil
+	})
+	return value, found
+}
+
+func setMP4Tag(name, value string, m *Metadata, tags *mp4Tags) {
+	switch name {
+	case "\xa9nam", "com.apple.quicktime.title":
+		setString(&m.Title, value)
+	case "\xa9ART", "com.apple.quicktime.artist":
+		setString(&m.Artist, value)
+	case "\xa9alb", "com.apple.quicktime.album":
+		setString(&m.Album, value)
+	case "\xa9mak", "com.apple.quicktime.make":
+		setString(&m.CameraMake, value)
+	case "\xa9mod", "com.apple.quicktime.model":
+		setString(&m.CameraModel, value)
+	case "\xa9xyz", "com.apple.quicktime.location.ISO6709":
+		if tags.location == "" {
+			tags.location = value
+		}
+	case "\xa9day":
+		if tags.day == "" {
+			tags.day = value
+		}
+	case "com.apple.quicktime.creationdate":
+		tags.appleCreated = value
+	}
+}
+
+// apply ranks the collected sources: Apple's creation date has the local
+// wall clock and offset; ©day is usually the same in other devices' files;
+// mvhd only has UTC.
+func (tags *mp4Tags) apply(m *Metadata) {
+	for _, s := range []string{tags.appleCreated, tags.day} {
+		if t, zoned, ok := parseMP4Date(s); ok {
+			m.setTaken(t, zoned)
+			break
+		}
+	}
+	if !tags.created.IsZero() && tags.created.Year() > 1970 {
+		m.setTaken(tags.created, true)
+	}
+	if lat, lon, alt, ok := parseISO6709(tags.location); ok {
+		m.setLocation(lat, lon)
+		if alt != nil {
+			m.setAltitude(*alt)
+		}
+	}
+	m.setSize(tags.trackW, tags.trackH)
+	if m.Orientation == 0 && tags.rotation != 0 {
+		m.Orientation = tags.rotation
+	}
+}
+
+// parseMP4Date parses the ISO 8601 timestamps of MP4 tags. A bare year
+// (music release dates) doesn't count as a capture time.
+func parseMP4Date(s string) (time.Time, bool, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02T15:04:05-0700", "2006-01-02T15:04:05Z0700", "2006-01-02T15:04:05Z07:00"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true, true
+		}
+	}
+	return parseXMPDate(s)
+}
+
+// iso6709Re matches "+37.7858-122.4064+012.345/" (and its DDMM and
+// DDMMSS forms).
+var iso6709Re = regexp.MustCompile(`^([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)?`)
+
+func parseISO6709(s string) (lat, lon float64, alt *float64, ok bool) {
+	g := iso6709Re.FindStringSubmatch(strings.TrimSpace(s))
+	if g == nil {
+		return 0, 0, nil, false
+	}
+	lat, ok1 := iso6709Angle(g[1], 2)
+	lon, ok2 := iso6709Angle(g[2], 3)
+	if !ok1 || !ok2 {
+		return 0, 0, nil, false
+	}
+	if g[3] != "" {
+		if a, err := strconv.ParseFloat(g[3], 64); err == nil {
+			alt = &a
+		}
+	}
+	return lat, lon, alt, true
+}
+
+// iso6709Angle converts a signed ±DD[MM[SS]][.fff] angle whose degree
+// part has degDigits digits.
+func iso6709Angle(s string, degDigits int) (float64, bool) {
+	sign := 1.0
+	if s[0] == '-' {
+		sign = -1
+	}
+	s = s[1:]
+	intPart, _, _ := strings.Cut(s, ".")
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	switch len(intPart) - degDigits {
+	case 2: // DDMM.mmm
+		deg := float64(int(v / 100))
+		v = deg + (v-deg*100)/60
+	case 4: // DDMMSS.sss
+		deg := float64(int(v / 10000))
+		min := float64(int(v/100)) - deg*100
+		v = deg + min/60 + (v-deg*10000-min*100)/3600
+	}
+	return sign * v, true
+}
+
+// parseHEIFMeta reads a HEIF meta box: iinf names the items, iloc says
+// where their bytes are, and ipco holds image properties (ispe sizes,
+// irot rotation).
+func parseHEIFMeta(r io.ReaderAt, meta box, m *Metadata) error {
+	var (
+		exifID, xmpID uint32
+		locations     map[uint32][2]int64
+	)
+	walkBoxes(r, meta.dataStart+4, meta.end, func(b box) error {
+		switch b.typ {
+		case "iinf":
+			exifID, xmpID = parseIinf(r, b)
+		case "iloc":
+			if data, err := payload(r, b); err == nil {
+				locations = parseIloc(data)
+			}
+		case "iprp":
+			walkBoxes(r, b.dataStart, b.end, func(ipco box) error {
+				if ipco.typ == "ipco" {
+					parseIpco(r, ipco, m)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+
+	var errs []error
+	if loc, ok := locations[exifID]; ok && exifID != 0 {
+		// The Exif item starts with the offset of the TIFF header past a
+		// 4-byte field (normally the 6-byte "Exif\0\0" prefix).
+		if b, err := readAt(r, loc[0], 4); err == nil {
+			skip := int64(binary.BigEndian.Uint32(b))
+			if 4+skip < loc[1] {
+				if err := parseTIFF(r, loc[0]+4+skip, loc[1]-4-skip, m); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	if loc, ok := locations[xmpID]; ok && xmpID != 0 && loc[1] <= maxXMPBytes {
+		if b, err := readAt(r, loc[0], int(loc[1])); err == nil {
+			parseXMP(b, m)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseIinf returns the IDs of the Exif item and the XMP ("mime" with an
+// RDF content type) item.
+func parseIinf(r io.ReaderAt, iinf box) (exifID, xmpID uint32) {
+	start := iinf.dataStart + 6 // version, flags, 16-bit count
+	if v, err := readAt(r, iinf.dataStart, 1); err == nil && v[0] != 0 {
+		start += 2 // 32-bit count
+	}
+	walkBoxes(r, start, iinf.end, func(b box) error {
+		if b.typ != "infe" {
+			return nil
+		}
+		data, err := payload(r, b)
+		if err != nil || len(data) < 4 || data[0] < 2 {
+			return nil
+		}
+		pos := 4
+		var id uint32
+		if data[0] == 2 {
+			if len(data) < pos+8 {
+				return nil
+			}
+			id = uint32(binary.BigEndian.Uint16(data[pos:]))
+			pos += 2
+		} else {
+			if len(data) < pos+10 {
+				return nil
+			}
+			id = binary.BigEndian.Uint32(data[pos:])
+			pos += 4
+		}
+		pos += 2 // protection index
+		switch string(data[pos : pos+4]) {
+		case "Exif":
+			exifID = id
+		case "mime":
+			// item_name NUL content_type NUL
+			rest := data[pos+4:]
+			if _, after, ok := bytes.Cut(rest, []byte{0}); ok {
+				if ct, _, _ := bytes.Cut(after, []byte{0}); string(ct) == "application/rdf+xml" {
+					xmpID = id
+				}
+			}
+		}
+		return nil
+	})
+	return exifID, xmpID
+}
+
+// parseIloc returns the file offset and length of each item stored as a
+// single extent in the file (construction method 0).
+func parseIloc(data []byte) map[uint32][2]int64 {
+	locs := make(map[uint32][2]int64)
+	if len(data) < 8 {
+		return locs
+	}
+	version := data[0]
+	offsetSize, lengthSize := int(data[4]>>4), int(data[4]&0x0F)
+	baseSize, indexSize := int(data[5]>>4), int(data[5]&0x0F)
+	if version == 0 {
+		indexSize = 0
+	}
+	pos := 6
+	var count int
+	if version < 2 {
+		count, pos = int(binary.BigEndian.Uint16(data[pos:])), pos+2
+	} else {
+		if len(data) < pos+4 {
+			return locs
+		}
+		count, pos = int(binary.BigEndian.Uint32(data[pos:])), pos+4
+	}
+
+	readN := func(n int) (int64, bool) {
+		if n == 0 {
+			return 0, true
+		}
+		if pos+n > len(data) || (n != 4 && n != 8) {
+			return 0, false
+		}
+		var v int64
+		if n == 4 {
+			v = int64(binary.BigEndian.Uint32(data[pos:]))
+		} else {
+			v = int64(binary.BigEndian.Uint64(data[pos:]))
+		}
+		pos += n
+		return v, true
+	}
+
+	for i := 0; i < count; i++ {
+		var id uint32
+		if version < 2 {
+			if pos+2 > len(data) {
+				break
+			}
+			id, pos = uint32(binary.BigEndian.Uint16(data[pos:])), pos+2
+		} else {
+			if pos+4 > len(data) {
+				break
+			}
+			id, pos = binary.BigEndian.Uint32(data[pos:]), pos+4
+		}
+		method := 0
+		if version >= 1 {
+			if pos+2 > len(data) {
+				break
+			}
+			method, pos = int(binary.BigEndian.Uint16(data[pos:])&0x0F), pos+2
+		}
+		pos += 2 // data reference index
+		base, ok := readN(baseSize)
+		if !ok || pos+2 > len(data) {
+			break
+		}
+		extents := int(binary.BigEndian.Uint16(data[pos:]))
+		pos += 2
+		for e := 0; e < extents; e++ {
+			if _, ok := readN(indexSize); !ok {
+				return locs
+			}
+			off, ok1 := readN(offsetSize)
+			length, ok2 := readN(lengthSize)
+			if !ok1 || !ok2 {
+				return locs
+			}
+			if e == 0 && extents == 1 && method == 0 {
+				locs[id] = [2]int64{base + off, length}
+			}
+		}
+	}
+	return locs
+}
+
+// parseIpco takes the largest ispe as the image size (the primary image
+// of a grid is larger than its tiles and thumbnail) and an irot as the
+// orientation.
+func parseIpco(r io.ReaderAt, ipco box, m *Metadata) {
+	w, h := 0, 0
+	walkBoxes(r, ipco.dataStart, ipco.end, func(b box) error {
+		data, err := payload(r, b)
+		if err != nil {
+			return nil
+		}
+		switch b.typ {
+		case "ispe":
+			if len(data) >= 12 {
+				iw, ih := int(binary.BigEndian.Uint32(data[4:])), int(binary.BigEndian.Uint32(data[8:]))
+				if iw*ih > w*h {
+					w, h = iw, ih
+				}
+			}
+		case "irot":
+			// Anticlockwise quarter turns.
+			if len(data) >= 1 && m.Orientation == 0 {
+				m.Orientation = [4]int{1, 8, 3, 6}[data[0]&3]
+			}
+		}
+		return nil
+	})
+	m.setSize(w, h)
+}
@@ -0,0 +1,286 @@
+package mediameta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Embedded cover art: the picture music files (and some videos) carry for
+// display. MP3 keeps it in an ID3 APIC (PIC in 2.2) frame, M4A/MP4 in the
+// covr item of the iTunes ilst, FLAC in a PICTURE metadata block. All three
+// hold an ordinary encoded JPEG or PNG.
+
+// ErrNoCoverArt is returned when a file has no embedded picture.
+var ErrNoCoverArt = errors.New("no embedded cover art")
+
+// maxCoverBytes bounds the size of a picture read into memory.
+const maxCoverBytes = 16 << 20
+
+// id3FrontCover is the APIC picture type of the front cover, preferred
+// over the other pictures a tag may carry.
+const id3FrontCover = 3
+
+// CoverArtFile returns the embedded cover art of the file at fullPath.
+func CoverArtFile(fullPath string) ([]byte, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return CoverArt(f, info.Size(), fullPath)
+}
+
+// CoverArt sniffs the format of r and returns its embedded cover picture
+// as encoded image bytes, or ErrNoCoverArt.
+func CoverArt(r io.ReaderAt, size int64, name string) (pic []byte, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			pic, err = nil, fmt.Errorf("cover art parser panic: %v", p)
+		}
+	}()
+
+	head := make([]byte, 12)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+	ext := strings.ToLower(filepath.Ext(name))
+
+	switch {
+	case bytes.HasPrefix(head, []byte("ID3")):
+		pic = id3Cover(r, size)
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		pic = flacCover(r, size)
+	case len(head) >= 8 && string(head[4:8]) == "ftyp",
+		len(head) >= 8 && (ext == ".mov" || ext == ".mp4" || ext == ".m4a" || ext == ".m4v") && quickTimeTopLevel[string(head[4:8])]:
+		pic = mp4Cover(r, size)
+	}
+	if pic == nil {
+		return nil, ErrNoCoverArt
+	}
+	return pic, nil
+}
+
+// id3Cover returns the front cover of an ID3v2 tag, else its first picture.
+func id3Cover(r io.ReaderAt, size int64) []byte {
+	head, err := readAt(r, 0, 10)
+	if err != nil {
+		return nil
+	}
+	tagSize := int64(synchsafe(head[6:10]))
+	tag, err := readAt(r, 10, int(min(tagSize, maxCoverBytes, size-10)))
+	if err != nil {
+		return nil
+	}
+
+	var first []byte
+	var front []byte
+	eachID3Frame(head[3], head[5], tag, func(id string, data []byte) bool {
+		var picType byte
+		var pic []byte
+		switch id {
+		case "APIC":
+			picType, pic = apicPicture(data)
+		case "PIC":
+			picType, pic = picPicture(data)
+		default:
+			return true
+		}
+		if len(pic) == 0 {
+			return true
+		}
+		if first == nil {
+			first = pic
+		}
+		if picType == id3FrontCover {
+			front = pic
+			return false
+		}
+		return true
+	})
+	if front != nil {
+		return front
+	}
+	return first
+}
+
+// apicPicture splits an APIC frame: encoding, NUL-terminated MIME type,
+// picture type, description in the frame's encoding, then the picture.
+func apicPicture(data []byte) (byte, []byte) {
+	if len(data) < 4 {
+		return 0, nil
+	}
+	enc := data[0]
+	i := bytes.IndexByte(data[1:], 0)
+	if i < 0 || 1+i+2 > len(data) {
+		return 0, nil
+	}
+	rest := data[1+i+1:]
+	picType := rest[0]
+	pic := skipID3String(enc, rest[1:])
+	return picType, pic
+}
+
+// picPicture splits an ID3v2.2 PIC frame, which has a three-letter image
+// format where APIC has a MIME type.
+func picPicture(data []byte) (byte, []byte) {
+	if len(data) < 6 {
+		return 0, nil
+	}
+	return data[4], skipID3String(data[0], data[5:])
+}
+
+// skipID3String drops a terminated string in encoding enc from the start
+// of b: UTF-16 strings end in an aligned 0x00 0x00, the others in 0x00.
+func skipID3String(enc byte, b []byte) []byte {
+	if enc == 1 || enc == 2 {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[i+2:]
+			}
+		}
+		return nil
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return b[i+1:]
+	}
+	return nil
+}
+
+// flacCover returns the front cover among a FLAC file's PICTURE blocks,
+// else the first one.
+func flacCover(r io.ReaderAt, size int64) []byte {
+	var first []byte
+	pos := int64(4)
+	for i := 0; i < maxSegments && pos+4 <= size; i++ {
+		hdr, err := readAt(r, pos, 4)
+		if err != nil {
+			return first
+		}
+		last := hdr[0]&0x80 != 0
+		blockType := hdr[0] & 0x7F
+		length := int64(hdr[1])<<16 | int64(hdr[2])<<8 | int64(hdr[3])
+		if blockType == 6 && length <= maxCoverBytes {
+			if block, err := readAt(r, pos+4, int(length)); err == nil {
+				picType, pic := flacPicture(block)
+				if picType == id3FrontCover && len(pic) > 0 {
+					return pic
+				}
+				if first == nil && len(pic) > 0 {
+					first = pic
+				}
+			}
+		}
+		if last {
+			break
+		}
+		pos += 4 + length
+	}
+	return first
+}
+
+// flacPicture splits a PICTURE block: type, MIME type and description
+// (both length-prefixed), four dimension fields, then the picture, all
+// big-endian 32-bit. FLAC uses the ID3 picture types.
+func flacPicture(b []byte) (byte, []byte) {
+	pos := 0
+	u32 := func() (int, bool) {
+		if pos+4 > len(b) {
+			return 0, false
+		}
+		v := int(binary.BigEndian.Uint32(b[pos:]))
+		pos += 4
+		return v, true
+	}
+	picType, ok := u32()
+	if !ok {
+		return 0, nil
+	}
+	for range 2 { // MIME type, description
+		n, ok := u32()
+		if !ok || n < 0 || pos+n > len(b) {
+			return 0, nil
+		}
+		pos += n
+	}
+	pos += 16 // width, height, depth, colors
+	n, ok := u32()
+	if !ok || n < 0 || pos+n > len(b) {
+		return 0, nil
+	}
+	return byte(picType), b[pos : pos+n]
+}
+
+// mp4Cover returns the first covr picture of an MP4's iTunes metadata,
+// found under moov/udta/meta/ilst (or moov/meta/ilst).
+func mp4Cover(r io.ReaderAt, size int64) []byte {
+	var pic []byte
+	fromMeta := func(meta box) {
+		start := meta.dataStart
+		if peek, err := readAt(r, start, 8); err == nil && string(peek[4:8]) != "hdlr" {
+			start += 4 // full box
+		}
+		walkBoxes(r, start, meta.end, func(b box) error {
+			if b.typ != "ilst" || pic != nil {
+				return nil
+			}
+			walkBoxes(r, b.dataStart, b.end, func(item box) error {
+				if item.typ == "covr" && pic == nil {
+					pic = covrPicture(r, item)
+				}
+				return nil
+			})
+			return nil
+		})
+	}
+	walkBoxes(r, 0, size, func(top box) error {
+		if top.typ != "moov" {
+			return nil
+		}
+		walkBoxes(r, top.dataStart, top.end, func(b box) error {
+			switch b.typ {
+			case "meta":
+				fromMeta(b)
+			case "udta":
+				walkBoxes(r, b.dataStart, b.end, func(u box) error {
+					if u.typ == "meta" {
+						fromMeta(u)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		return nil
+	})
+	return pic
+}
+
+// covrPicture returns the image in a covr item's first data box (type
+// indicator 13 for JPEG, 14 for PNG, 27 for BMP).
+func covrPicture(r io.ReaderAt, item box) []byte {
+	var pic []byte
+	walkBoxes(r, item.dataStart, item.end, func(b box) error {
+		if b.typ != "data" || pic != nil || b.size() < 8 || b.size() > maxCoverBytes {
+			return nil
+		}
+		data, err := readAt(r, b.dataStart, int(b.size()))
+		if err != nil {
+			return nil
+		}
+		switch binary.BigEndian.Uint32(data) & 0xFFFFFF {
+		case 13, 14, 27:
+			pic = data[8:]
+		}
+		return nil
+	})
+	return pic
+}
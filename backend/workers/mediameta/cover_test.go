@@ -0,0 +1,96 @@
+package mediameta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+var (
+	frontJPEG = []byte{0xFF, 0xD8, 0xFF, 0xE0, 'f', 'r', 'o', 'n', 't', 0xFF, 0xD9}
+	backPNG   = []byte("\x89PNG\r\n\x1a\nback")
+)
+
+func coverArt(t *testing.T, name string, data []byte) []byte {
+	t.Helper()
+	pic, err := CoverArt(bytes.NewReader(data), int64(len(data)), name)
+	if err != nil {
+		t.Fatalf("CoverArt(%s): %v", name, err)
+	}
+	return pic
+}
+
+func apicFrame(enc byte, mime string, picType byte, desc []byte, pic []byte) []byte {
+	body := append([]byte{enc}, mime...)
+	body = append(body, 0, picType)
+	body = append(append(body, desc...), pic...)
+	out := append([]byte("APIC"), binary.BigEndian.AppendUint32(nil, uint32(len(body)))...)
+	return append(append(out, 0, 0), body...)
+}
+
+func TestCoverArt_ID3PrefersFrontCover(t *testing.T) {
+	frames := id3Frame("TIT2", "Song")
+	// A back cover with a UTF-16 description (terminated by 00 00), then
+	// the front cover with a Latin-1 one.
+	frames = append(frames, apicFrame(1, "image/png", 4, []byte{0xFF, 0xFE, 'b', 0, 0, 0}, backPNG)...)
+	frames = append(frames, apicFrame(0, "image/jpeg", id3FrontCover, []byte("front\x00"), frontJPEG)...)
+	n := len(frames)
+	tag := []byte{'I', 'D', '3', 3, 0, 0, byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+
+	if pic := coverArt(t, "song.mp3", append(tag, frames...)); !bytes.Equal(pic, frontJPEG) {
+		t.Errorf("picture = %q", pic)
+	}
+}
+
+func TestCoverArt_M4A(t *testing.T) {
+	covr := mp4Box("covr", mp4Box("data", append([]byte{0, 0, 0, 14, 0, 0, 0, 0}, backPNG...)))
+	meta := mp4Box("meta", append([]byte{0, 0, 0, 0},
+		mp4Box("ilst", mp4Box("\xa9nam", mp4Data("Song")), covr)...))
+	file := append(mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00")),
+		mp4Box("moov", mp4Box("udta", meta))...)
+
+	if pic := coverArt(t, "track.m4a", file); !bytes.Equal(pic, backPNG) {
+		t.Errorf("picture = %q", pic)
+	}
+}
+
+func TestCoverArt_FLAC(t *testing.T) {
+	picture := func(picType uint32, pic []byte) []byte {
+		b := binary.BigEndian.AppendUint32(nil, picType)
+		b = binary.BigEndian.AppendUint32(b, 10)
+		b = append(b, "image/jpeg"...)
+		b = binary.BigEndian.AppendUint32(b, 0)
+		b = append(b, make([]byte, 16)...)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(pic)))
+		return append(b, pic...)
+	}
+	block := func(last bool, typ byte, body []byte) []byte {
+		if last {
+			typ |= 0x80
+		}
+		n := len(body)
+		return append([]byte{typ, byte(n >> 16), byte(n >> 8), byte(n)}, body...)
+	}
+	file := []byte("fLaC")
+	file = append(file, block(false, 0, make([]byte, 34))...) // STREAMINFO
+	file = append(file, block(false, 6, picture(4, backPNG))...)
+	file = append(file, block(true, 6, picture(id3FrontCover, frontJPEG))...)
+
+	if pic := coverArt(t, "track.flac", file); !bytes.Equal(pic, frontJPEG) {
+		t.Errorf("picture = %q", pic)
+	}
+}
+
+func TestCoverArt_None(t *testing.T) {
+	tag := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 15}, id3Frame("TIT2", "Song")...)
+	for name, data := range map[string][]byte{
+		"song.mp3":  tag,
+		"notes.txt": []byte("hello"),
+		"cut.flac":  []byte("fLaC\x06\xff\xff"),
+	} {
+		if _, err := CoverArt(bytes.NewReader(data), int64(len(data)), name); !errors.Is(err, ErrNoCoverArt) {
+			t.Errorf("%s: err = %v, want ErrNoCoverArt", name, err)
+		}
+	}
+}
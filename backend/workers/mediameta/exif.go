@@ -0,0 +1,351 @@
+package mediameta
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// EXIF is a TIFF structure: a header naming the byte order, then chains of
+// IFDs (image file directories) of 12-byte tag entries. Offsets are
+// relative to the TIFF header, wherever the container put it.
+
+const (
+	maxIFDEntries   = 1024
+	maxTagValueSize = 64 << 10
+
+	tagImageWidth          = 0x0100
+	tagImageHeight         = 0x0101
+	tagMake                = 0x010F
+	tagModel               = 0x0110
+	tagOrientation         = 0x0112
+	tagDateTime            = 0x0132
+	tagExifIFD             = 0x8769
+	tagGPSIFD              = 0x8825
+	tagDateTimeOriginal    = 0x9003
+	tagDateTimeDigitized   = 0x9004
+	tagOffsetTime          = 0x9010
+	tagOffsetTimeOriginal  = 0x9011
+	tagOffsetTimeDigitized = 0x9012
+	tagPixelXDimension     = 0xA002
+	tagPixelYDimension     = 0xA003
+	tagLensModel           = 0xA434
+
+	gpsLatitudeRef  = 0x01
+	gpsLatitude     = 0x02
+	gpsLongitudeRef = 0x03
+	gpsLongitude    = 0x04
+	gpsAltitudeRef  = 0x05
+	gpsAltitude     = 0x06
+	gpsTimeStamp    = 0x07
+	gpsDateStamp    = 0x1D
+)
+
+// TIFF field types and their sizes in bytes.
+const (
+	tiffByte      = 1
+	tiffASCII     = 2
+	tiffShort     = 3
+	tiffLong      = 4
+	tiffRational  = 5
+	tiffUndefined = 7
+	tiffSLong     = 9
+	tiffSRational = 10
+)
+
+var tiffTypeSize = map[uint16]int{
+	tiffByte: 1, tiffASCII: 1, tiffShort: 2, tiffLong: 4, tiffRational: 8,
+	6: 1, tiffUndefined: 1, 8: 2, tiffSLong: 4, tiffSRational: 8, 11: 4, 12: 8,
+}
+
+var errNotTIFF = errors.New("not a TIFF header")
+
+// isTIFFHeader recognizes "II*\0" and "MM\0*", plus the variants Olympus
+// ("IIRO", "IIRS") and Panasonic ("IIU\0") RAW files use.
+func isTIFFHeader(b []byte) bool {
+	switch string(b[:4]) {
+	case "II*\x00", "MM\x00*", "IIRO", "IIRS", "IIU\x00":
+		return true
+	}
+	return false
+}
+
+type tiffReader struct {
+	r     io.ReaderAt
+	base  int64 // file offset of the TIFF header
+	size  int64 // bytes from base to the end of the structure
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte // raw inline value or offset (4 bytes)
+}
+
+// parseTIFF reads the EXIF structure whose header is at base, size bytes
+// long, into m.
+func parseTIFF(r io.ReaderAt, base, size int64, m *Metadata) error {
+	head, err := readAt(r, base, 8)
+	if err != nil {
+		return err
+	}
+	if !isTIFFHeader(head) {
+		return errNotTIFF
+	}
+	t := &tiffReader{r: r, base: base, size: size, order: binary.LittleEndian}
+	if head[0] == 'M' {
+		t.order = binary.BigEndian
+	}
+
+	ifd0, err := t.readIFD(int64(t.order.Uint32(head[4:])))
+	if err != nil {
+		return err
+	}
+
+	var (
+		dateTime, dateOriginal, dateDigitized        string
+		offset, offsetOriginal, offsetDigitized      string
+		exifWidth, exifHeight, tiffWidth, tiffHeight int
+		errs                                         []error
+	)
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagMake:
+			setString(&m.CameraMake, t.ascii(e))
+		case tagModel:
+			setString(&m.CameraModel, t.ascii(e))
+		case tagOrientation:
+			if o := t.uint(e, 0); o >= 1 && o <= 8 && m.Orientation == 0 {
+				m.Orientation = o
+			}
+		case tagDateTime:
+			dateTime = t.ascii(e)
+		case tagImageWidth:
+			tiffWidth = t.uint(e, 0)
+		case tagImageHeight:
+			tiffHeight = t.uint(e, 0)
+		case tagExifIFD:
+			exif, err := t.readIFD(int64(t.uint(e, 0)))
+			if err != nil {
+				errs = append(errs, err)
+			}
+			for _, e := range exif {
+				switch e.tag {
+				case tagDateTimeOriginal:
+					dateOriginal = t.ascii(e)
+				case tagDateTimeDigitized:
+					dateDigitized = t.ascii(e)
+				case tagOffsetTime:
+					offset = t.ascii(e)
+				case tagOffsetTimeOriginal:
+					offsetOriginal = t.ascii(e)
+				case tagOffsetTimeDigitized:
+					offsetDigitized = t.ascii(e)
+				case tagPixelXDimension:
+					exifWidth = t.uint(e, 0)
+				case tagPixelYDimension:
+					exifHeight = t.uint(e, 0)
+				case tagLensModel:
+					setString(&m.LensModel, t.ascii(e))
+				}
+			}
+		case tagGPSIFD:
+			gps, err := t.readIFD(int64(t.uint(e, 0)))
+			if err != nil {
+				errs = append(errs, err)
+			}
+			t.gps(gps, m)
+		}
+	}
+
+	for _, d := range []struct{ date, offset string }{
+		{dateOriginal, offsetOriginal},
+		{dateDigitized, offsetDigitized},
+		{dateTime, offset},
+	} {
+		if when, zoned, ok := parseEXIFDate(d.date, d.offset); ok {
+			m.setTaken(when, zoned)
+			break
+		}
+	}
+	m.useGPSTime()
+	m.setSize(exifWidth, exifHeight)
+	m.setSize(tiffWidth, tiffHeight)
+	return errors.Join(errs...)
+}
+
+// gps reads the GPS IFD. When the photo's own clock had no UTC offset,
+// the GPS timestamp (always UTC) pins down the instant.
+func (t *tiffReader) gps(entries []ifdEntry, m *Metadata) {
+	var latRef, lonRef, date string
+	var lat, lon, alt, clock []float64
+	altBelow := false
+	for _, e := range entries {
+		switch e.tag {
+		case gpsLatitudeRef:
+			latRef = t.ascii(e)
+		case gpsLatitude:
+			lat = t.rationals(e)
+		case gpsLongitudeRef:
+			lonRef = t.ascii(e)
+		case gpsLongitude:
+			lon = t.rationals(e)
+		case gpsAltitudeRef:
+			altBelow = t.uint(e, 0) == 1
+		case gpsAltitude:
+			alt = t.rationals(e)
+		case gpsTimeStamp:
+			clock = t.rationals(e)
+		case gpsDateStamp:
+			date = t.ascii(e)
+		}
+	}
+	if len(lat) == 3 && len(lon) == 3 {
+		la := lat[0] + lat[1]/60 + lat[2]/3600
+		lo := lon[0] + lon[1]/60 + lon[2]/3600
+		if strings.HasPrefix(strings.ToUpper(latRef), "S") {
+			la = -la
+		}
+		if strings.HasPrefix(strings.ToUpper(lonRef), "W") {
+			lo = -lo
+		}
+		m.setLocation(la, lo)
+	}
+	if len(alt) == 1 && !math.IsNaN(alt[0]) {
+		if altBelow {
+			alt[0] = -alt[0]
+		}
+		m.setAltitude(alt[0])
+	}
+	if len(clock) == 3 && date != "" {
+		if d, err := time.Parse("2006:01:02", date); err == nil {
+			m.gpsTime = d.Add(time.Duration((clock[0]*3600 + clock[1]*60 + clock[2]) * float64(time.Second)))
+		}
+	}
+}
+
+// readIFD reads the entries of the directory at off (relative to the TIFF
+// header).
+func (t *tiffReader) readIFD(off int64) ([]ifdEntry, error) {
+	if off < 8 || off+2 > t.size {
+		return nil, errTruncated
+	}
+	b, err := readAt(t.r, t.base+off, 2)
+	if err != nil {
+		return nil, err
+	}
+	n := int(t.order.Uint16(b))
+	if n > maxIFDEntries {
+		return nil, errors.New("implausible IFD entry count")
+	}
+	b, err = readAt(t.r, t.base+off+2, n*12)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ifdEntry, n)
+	for i := range entries {
+		e := b[i*12:]
+		entries[i] = ifdEntry{
+			tag:   t.order.Uint16(e[0:]),
+			typ:   t.order.Uint16(e[2:]),
+			count: t.order.Uint32(e[4:]),
+			value: e[8:12],
+		}
+	}
+	return entries, nil
+}
+
+// data returns the bytes of an entry's value, inline or out of line.
+func (t *tiffReader) data(e ifdEntry) []byte {
+	size := tiffTypeSize[e.typ] * int(e.count)
+	if size == 0 || size > maxTagValueSize {
+		return nil
+	}
+	if size <= 4 {
+		return e.value[:size]
+	}
+	off := int64(t.order.Uint32(e.value))
+	if off+int64(size) > t.size {
+		return nil
+	}
+	b, err := readAt(t.r, t.base+off, size)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (t *tiffReader) ascii(e ifdEntry) string {
+	b := t.data(e)
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// uint returns the i-th value of a BYTE, SHORT or LONG entry.
+func (t *tiffReader) uint(e ifdEntry, i int) int {
+	b := t.data(e)
+	switch e.typ {
+	case tiffByte, tiffUndefined:
+		if i < len(b) {
+			return int(b[i])
+		}
+	case tiffShort:
+		if 2*i+2 <= len(b) {
+			return int(t.order.Uint16(b[2*i:]))
+		}
+	case tiffLong, tiffSLong:
+		if 4*i+4 <= len(b) {
+			return int(t.order.Uint32(b[4*i:]))
+		}
+	}
+	return 0
+}
+
+// rationals returns the values of a RATIONAL or SRATIONAL entry.
+func (t *tiffReader) rationals(e ifdEntry) []float64 {
+	if e.typ != tiffRational && e.typ != tiffSRational {
+		return nil
+	}
+	b := t.data(e)
+	out := make([]float64, 0, len(b)/8)
+	for i := 0; i+8 <= len(b); i += 8 {
+		num, den := t.order.Uint32(b[i:]), t.order.Uint32(b[i+4:])
+		if den == 0 {
+			return nil
+		}
+		if e.typ == tiffSRational {
+			out = append(out, float64(int32(num))/float64(int32(den)))
+		} else {
+			out = append(out, float64(num)/float64(den))
+		}
+	}
+	return out
+}
+
+// parseEXIFDate parses an EXIF "2006:01:02 15:04:05" timestamp and its
+// optional "+09:00" offset tag. zoned reports whether the offset was
+// known.
+func parseEXIFDate(date, offset string) (t time.Time, zoned bool, ok bool) {
+	if len(date) < 19 || strings.HasPrefix(date, "0000") {
+		return time.Time{}, false, false
+	}
+	// Some cameras use dashes in the date part.
+	date = strings.Replace(date[:10], "-", ":", 2) + date[10:19]
+	if offset != "" {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", date+offset); err == nil {
+			return t, true, true
+		}
+	}
+	t, err := time.Parse("2006:01:02 15:04:05", date)
+	if err != nil {
+		return time.Time{}, false, false
+	}
+	return t, false, true
+}
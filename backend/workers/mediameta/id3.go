@@ -0,0 +1,285 @@
+package mediameta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf16"
+)
+
+// MP3 files start with an optional ID3v2 tag (title, artist, album and
+// sometimes the length), followed by MPEG audio frames, optionally ending
+// with a 128-byte ID3v1 tag. Without a TLEN frame the duration comes from
+// the Xing/VBRI header of the first frame, or for constant-bitrate files
+// from the bitrate and the audio size.
+
+// maxID3Bytes bounds how much of an ID3v2 tag is read; embedded cover art
+// is what makes tags big, and it comes after the text frames in practice.
+const maxID3Bytes = 4 << 20
+
+// maxSyncSearch bounds the search for the first audio frame.
+const maxSyncSearch = 64 << 10
+
+// parseMP3 reads the ID3 tags and duration of an MP3 file.
+func parseMP3(r io.ReaderAt, size int64, m *Metadata) error {
+	audioStart := int64(0)
+	if head, err := readAt(r, 0, 10); err == nil && string(head[:3]) == "ID3" {
+		tagSize := int64(synchsafe(head[6:10]))
+		audioStart = 10 + tagSize
+		if head[5]&0x10 != 0 {
+			audioStart += 10 // footer
+		}
+		if tag, err := readAt(r, 10, int(min(tagSize, maxID3Bytes, size-10))); err == nil {
+			parseID3v2(head[3], head[5], tag, m)
+		}
+	}
+
+	audioEnd := size
+	if tail, err := readAt(r, size-128, 128); err == nil && string(tail[:3]) == "TAG" {
+		audioEnd -= 128
+		setString(&m.Title, latin1(bytes.TrimRight(tail[3:33], "\x00 ")))
+		setString(&m.Artist, latin1(bytes.TrimRight(tail[33:63], "\x00 ")))
+		setString(&m.Album, latin1(bytes.TrimRight(tail[63:93], "\x00 ")))
+	}
+
+	if m.Duration == 0 {
+		m.Duration = mpegDuration(r, audioStart, audioEnd)
+	}
+	return nil
+}
+
+func synchsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
+
+// unsynchronise undoes ID3 unsynchronisation: every 0xFF 0x00 was
+// written for a literal 0xFF.
+func unsynchronise(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xFF, 0x00}, []byte{0xFF})
+}
+
+// parseID3v2 reads the text frames of an ID3v2.2, 2.3 or 2.4 tag body.
+func parseID3v2(version, flags byte, tag []byte, m *Metadata) {
+	eachID3Frame(version, flags, tag, func(id string, data []byte) bool {
+		switch id {
+		case "TIT2", "TT2":
+			setString(&m.Title, id3Text(data))
+		case "TPE1", "TP1":
+			setString(&m.Artist, id3Text(data))
+		case "TALB", "TAL":
+			setString(&m.Album, id3Text(data))
+		case "TLEN", "TLE":
+			if ms, err := strconv.ParseInt(id3Text(data), 10, 64); err == nil && ms > 0 {
+				m.Duration = time.Duration(ms) * time.Millisecond
+			}
+		}
+		return true
+	})
+}
+
+// eachID3Frame calls fn with the ID and decoded body of each frame of an
+// ID3v2.2, 2.3 or 2.4 tag body until fn returns false. Compressed and
+// encrypted frames are skipped.
+func eachID3Frame(version, flags byte, tag []byte, fn func(id string, data []byte) bool) {
+	if version < 2 || version > 4 {
+		return
+	}
+	if flags&0x80 != 0 && version < 4 {
+		tag = unsynchronise(tag)
+	}
+	pos := 0
+	if flags&0x40 != 0 && version >= 3 && len(tag) >= 4 {
+		// Extended header: its size excludes itself in 2.3, includes it
+		// (and is synchsafe) in 2.4.
+		if version == 3 {
+			pos = 4 + int(binary.BigEndian.Uint32(tag))
+		} else {
+			pos = int(synchsafe(tag))
+		}
+	}
+
+	idLen, hdrLen := 4, 10
+	if version == 2 {
+		idLen, hdrLen = 3, 6
+	}
+	for pos+hdrLen <= len(tag) {
+		id := string(tag[pos : pos+idLen])
+		if id[0] == 0 {
+			break // padding
+		}
+		var size int
+		var frameFlags byte
+		switch version {
+		case 2:
+			size = int(tag[pos+3])<<16 | int(tag[pos+4])<<8 | int(tag[pos+5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(tag[pos+4:]))
+			frameFlags = tag[pos+9]
+		case 4:
+			size = int(synchsafe(tag[pos+4:]))
+			frameFlags = tag[pos+9]
+		}
+		body := pos + hdrLen
+		if size < 0 || body+size > len(tag) {
+			break
+		}
+		data := tag[body : body+size]
+		pos = body + size
+
+		switch {
+		case version == 3 && frameFlags&0xC0 != 0, version == 4 && frameFlags&0x0C != 0:
+			continue // compressed or encrypted
+		case version == 4:
+			if frameFlags&0x02 != 0 {
+				data = unsynchronise(data)
+			}
+			if frameFlags&0x01 != 0 && len(data) >= 4 {
+				data = data[4:] // data length indicator
+			}
+		}
+
+		if !fn(id, data) {
+			return
+		}
+	}
+}
+
+// id3Text decodes a text frame: an encoding byte, then the text. Of a
+// multi-valued 2.4 frame only the first value is kept.
+func id3Text(data []byte) string {
+	if len(data) < 2 {
+		return ""
+	}
+	enc, text := data[0], data[1:]
+	switch enc {
+	case 0:
+		text, _, _ = bytes.Cut(text, []byte{0})
+		return latin1(text)
+	case 1, 2:
+		var order binary.ByteOrder = binary.BigEndian
+		if enc == 1 && len(text) >= 2 {
+			if text[0] == 0xFF && text[1] == 0xFE {
+				order = binary.LittleEndian
+			}
+			if (text[0] == 0xFF && text[1] == 0xFE) || (text[0] == 0xFE && text[1] == 0xFF) {
+				text = text[2:]
+			}
+		}
+		units := make([]uint16, 0, len(text)/2)
+		for i := 0; i+1 < len(text); i += 2 {
+			u := order.Uint16(text[i:])
+			if u == 0 {
+				break
+			}
+			units = append(units, u)
+		}
+		return string(utf16.Decode(units))
+	case 3:
+		text, _, _ = bytes.Cut(text, []byte{0})
+		return string(text)
+	}
+	return ""
+}
+
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// MPEG audio header tables, indexed by [version][layer] where version is
+// 0 for MPEG-1 and 1 for MPEG-2/2.5, and layer is 0 for Layer I.
+var (
+	mpegBitrates = [2][3][16]int{
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+	mpegSampleRates = [3][3]int{
+		{44100, 48000, 32000}, // MPEG-1
+		{22050, 24000, 16000}, // MPEG-2
+		{11025, 12000, 8000},  // MPEG-2.5
+	}
+)
+
+// mpegDuration finds the first audio frame after audioStart and derives
+// the running time from its Xing/Info or VBRI header, or failing that
+// from its bitrate.
+func mpegDuration(r io.ReaderAt, audioStart, audioEnd int64) time.Duration {
+	buf, err := readAt(r, audioStart, int(min(maxSyncSearch, audioEnd-audioStart)))
+	if err != nil {
+		return 0
+	}
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		h := buf[i:]
+		versionBits := h[1] >> 3 & 3 // 3 = MPEG-1, 2 = MPEG-2, 0 = MPEG-2.5
+		layerBits := h[1] >> 1 & 3   // 3 = Layer I, 2 = II, 1 = III
+		bitrateIdx := h[2] >> 4
+		rateIdx := h[2] >> 2 & 3
+		if versionBits == 1 || layerBits == 0 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+			continue
+		}
+		v, rateRow := 0, 0
+		switch versionBits {
+		case 2:
+			v, rateRow = 1, 1
+		case 0:
+			v, rateRow = 1, 2
+		}
+		layer := 3 - int(layerBits)
+		sampleRate := mpegSampleRates[rateRow][rateIdx]
+		samplesPerFrame := [3]int{384, 1152, 1152}[layer]
+		if layer == 2 && v == 1 {
+			samplesPerFrame = 576
+		}
+		mono := h[3]>>6 == 3
+
+		// Xing/Info sits after the side information of a Layer III frame.
+		sideInfo := 32
+		switch {
+		case v == 0 && mono:
+			sideInfo = 17
+		case v == 1 && !mono:
+			sideInfo = 17
+		case v == 1 && mono:
+			sideInfo = 9
+		}
+		if x := i + 4 + sideInfo; x+12 <= len(buf) {
+			tag := string(buf[x : x+4])
+			if (tag == "Xing" || tag == "Info") && binary.BigEndian.Uint32(buf[x+4:])&1 != 0 {
+				frames := binary.BigEndian.Uint32(buf[x+8:])
+				return framesDuration(int64(frames), samplesPerFrame, sampleRate)
+			}
+		}
+		if x := i + 36; x+18 <= len(buf) && string(buf[x:x+4]) == "VBRI" {
+			frames := binary.BigEndian.Uint32(buf[x+14:])
+			return framesDuration(int64(frames), samplesPerFrame, sampleRate)
+		}
+
+		bitrate := mpegBitrates[v][layer][bitrateIdx] * 1000
+		audioBytes := audioEnd - audioStart - int64(i)
+		if bitrate == 0 || audioBytes <= 0 {
+			return 0
+		}
+		return time.Duration(float64(audioBytes*8) / float64(bitrate) * float64(time.Second))
+	}
+	return 0
+}
+
+func framesDuration(frames int64, samplesPerFrame, sampleRate int) time.Duration {
+	return time.Duration(float64(frames*int64(samplesPerFrame)) / float64(sampleRate) * float64(time.Second))
+}
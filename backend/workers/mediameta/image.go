@@ -0,0 +1,231 @@
+package mediameta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader   = []byte("Exif\x00\x00")
+	xmpHeader    = []byte("http://ns.adobe.com/xap/1.0/\x00")
+)
+
+// maxSegments bounds how many JPEG segments or PNG/WebP chunks are walked.
+const maxSegments = 4096
+
+// parseJPEG walks the marker segments of the JPEG at off up to the start
+// of the image data: APP1 carries EXIF and XMP, SOFn the dimensions.
+func parseJPEG(r io.ReaderAt, off, size int64, m *Metadata) error {
+	pos := off + 2
+	var errs []error
+	for i := 0; i < maxSegments; i++ {
+		hdr, err := readAt(r, pos, 2)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		if hdr[0] != 0xFF {
+			return errors.Join(append(errs, errors.New("JPEG marker expected"))...)
+		}
+		marker := hdr[1]
+		if marker == 0xFF {
+			pos++ // fill byte
+			continue
+		}
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+			pos += 2 // markers without a length
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break // start of scan / end of image: no metadata follows
+		}
+		lenBytes, err := readAt(r, pos+2, 2)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		length := int64(binary.BigEndian.Uint16(lenBytes))
+		if length < 2 || pos+2+length > off+size {
+			return errors.Join(append(errs, errTruncated)...)
+		}
+		payloadAt, payloadLen := pos+4, length-2
+
+		switch {
+		case marker == 0xE1:
+			prefix, err := readAt(r, payloadAt, int(min(payloadLen, int64(len(xmpHeader)))))
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			switch {
+			case bytes.HasPrefix(prefix, exifHeader):
+				if err := parseTIFF(r, payloadAt+6, payloadLen-6, m); err != nil {
+					errs = append(errs, err)
+				}
+			case bytes.Equal(prefix, xmpHeader):
+				data, err := readAt(r, payloadAt+int64(len(xmpHeader)), int(payloadLen)-len(xmpHeader))
+				if err != nil {
+					errs = append(errs, err)
+					break
+				}
+				parseXMP(data, m)
+			}
+		case isSOF(marker) && payloadLen >= 5:
+			b, err := readAt(r, payloadAt, 5)
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			// The frame header is authoritative; EXIF dimensions go stale
+			// when an editor crops without updating them.
+			if w, h := int(binary.BigEndian.Uint16(b[3:])), int(binary.BigEndian.Uint16(b[1:])); w > 0 && h > 0 {
+				m.Width, m.Height = w, h
+			}
+		}
+		pos += 2 + length
+	}
+	return errors.Join(errs...)
+}
+
+// isSOF reports whether marker starts a frame (SOF0-SOF15 minus DHT, JPG
+// and DAC, which share the range).
+func isSOF(marker byte) bool {
+	return marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC
+}
+
+// parsePNG reads IHDR for the dimensions, eXIf for EXIF and the
+// "XML:com.adobe.xmp" iTXt chunk for XMP.
+func parsePNG(r io.ReaderAt, size int64, m *Metadata) error {
+	pos := int64(len(pngSignature))
+	var errs []error
+	for i := 0; i < maxSegments && pos+8 <= size; i++ {
+		hdr, err := readAt(r, pos, 8)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		length := int64(binary.BigEndian.Uint32(hdr))
+		typ := string(hdr[4:8])
+		dataAt := pos + 8
+		if dataAt+length > size {
+			return errors.Join(append(errs, errTruncated)...)
+		}
+
+		switch typ {
+		case "IHDR":
+			if length >= 8 {
+				b, err := readAt(r, dataAt, 8)
+				if err != nil {
+					return err
+				}
+				m.setSize(int(binary.BigEndian.Uint32(b)), int(binary.BigEndian.Uint32(b[4:])))
+			}
+		case "eXIf":
+			if err := parseEXIFBlock(r, dataAt, length, m); err != nil {
+				errs = append(errs, err)
+			}
+		case "iTXt":
+			if length <= maxXMPBytes {
+				if b, err := readAt(r, dataAt, int(length)); err == nil {
+					if xmp, ok := pngXMP(b); ok {
+						parseXMP(xmp, m)
+					}
+				}
+			}
+		case "IEND":
+			return errors.Join(errs...)
+		}
+		pos = dataAt + length + 4 // skip the CRC
+	}
+	return errors.Join(errs...)
+}
+
+// pngXMP returns the text of an uncompressed XMP iTXt chunk: keyword NUL,
+// compression flag, method, language NUL, translated keyword NUL, text.
+func pngXMP(b []byte) ([]byte, bool) {
+	keyword, rest, ok := bytes.Cut(b, []byte{0})
+	if !ok || string(keyword) != "XML:com.adobe.xmp" || len(rest) < 2 || rest[0] != 0 {
+		return nil, false
+	}
+	rest = rest[2:]
+	for range 2 {
+		if _, rest, ok = bytes.Cut(rest, []byte{0}); !ok {
+			return nil, false
+		}
+	}
+	return rest, true
+}
+
+// parseEXIFBlock parses a raw EXIF block, with or without the "Exif\0\0"
+// prefix JPEG uses (writers disagree about it in PNG and WebP).
+func parseEXIFBlock(r io.ReaderAt, off, length int64, m *Metadata) error {
+	if prefix, err := readAt(r, off, min(int(length), len(exifHeader))); err == nil && bytes.Equal(prefix, exifHeader) {
+		off, length = off+6, length-6
+	}
+	return parseTIFF(r, off, length, m)
+}
+
+// parseWebP walks the RIFF chunks of a WebP file.
+func parseWebP(r io.ReaderAt, size int64, m *Metadata) error {
+	pos := int64(12)
+	var errs []error
+	for i := 0; i < maxSegments && pos+8 <= size; i++ {
+		hdr, err := readAt(r, pos, 8)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		length := int64(binary.LittleEndian.Uint32(hdr[4:]))
+		dataAt := pos + 8
+		if dataAt+length > size {
+			return errors.Join(append(errs, errTruncated)...)
+		}
+
+		switch string(hdr[:4]) {
+		case "VP8X":
+			if b, err := readAt(r, dataAt, 10); err == nil {
+				m.setSize(int(uint24LE(b[4:]))+1, int(uint24LE(b[7:]))+1)
+			}
+		case "VP8 ":
+			// Frame tag (3), start code (3), then 14-bit width and height.
+			if b, err := readAt(r, dataAt, 10); err == nil {
+				m.setSize(int(binary.LittleEndian.Uint16(b[6:])&0x3FFF), int(binary.LittleEndian.Uint16(b[8:])&0x3FFF))
+			}
+		case "VP8L":
+			// Signature byte, then width-1 and height-1 in 14 bits each.
+			if b, err := readAt(r, dataAt, 5); err == nil && b[0] == 0x2F {
+				bits := binary.LittleEndian.Uint32(b[1:])
+				m.setSize(int(bits&0x3FFF)+1, int(bits>>14&0x3FFF)+1)
+			}
+		case "EXIF":
+			if err := parseEXIFBlock(r, dataAt, length, m); err != nil {
+				errs = append(errs, err)
+			}
+		case "XMP ":
+			if length <= maxXMPBytes {
+				if b, err := readAt(r, dataAt, int(length)); err == nil {
+					parseXMP(b, m)
+				}
+			}
+		}
+		pos = dataAt + length + length%2 // chunks are padded to even sizes
+	}
+	return errors.Join(errs...)
+}
+
+func uint24LE(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+// parseRAF reads a Fujifilm RAF file, whose header points at an embedded
+// JPEG preview carrying the EXIF.
+func parseRAF(r io.ReaderAt, size int64, m *Metadata) error {
+	b, err := readAt(r, 84, 8)
+	if err != nil {
+		return err
+	}
+	off, length := int64(binary.BigEndian.Uint32(b)), int64(binary.BigEndian.Uint32(b[4:]))
+	if off+length > size {
+		return errTruncated
+	}
+	return parseJPEG(r, off, length, m)
+}
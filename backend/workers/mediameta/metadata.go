@@ -0,0 +1,275 @@
+package mediameta
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+)
+
+// Media metadata extraction.
+//
+// Photos carry EXIF (and sometimes XMP) inside their container: JPEG APP1
+// segments, PNG eXIf chunks, WebP EXIF chunks, HEIF Exif items, or the
+// TIFF structure of camera RAW files. Video and audio keep theirs in
+// MP4/QuickTime atoms or ID3 tags. The parsers here read only the few
+// structures they need through an io.ReaderAt, so a 4 GB video costs a
+// handful of small reads.
+//
+// Parsers are tolerant: whatever was recovered before a malformed
+// structure is kept.
+
+// localLayout formats Metadata.TakenLocal.
+const localLayout = "2006-01-02 15:04:05"
+
+// maxStringLen caps free-text fields (titles, camera names).
+const maxStringLen = 256
+
+// Metadata is what a file's media metadata says about it. Zero values mean
+// "not present".
+type Metadata struct {
+	// TakenAt is the capture instant. When the file only records a wall
+	// clock without a UTC offset, the wall clock is read as UTC.
+	TakenAt time.Time
+	// TakenLocal is the wall-clock capture time where the picture was
+	// taken, formatted with localLayout.
+	TakenLocal string
+
+	CameraMake  string
+	CameraModel string
+	LensModel   string
+
+	HasLocation bool
+	Latitude    float64
+	Longitude   float64
+	HasAltitude bool
+	Altitude    float64
+
+	Width       int
+	Height      int
+	Orientation int // EXIF orientation, 1-8
+	Duration    time.Duration
+
+	Title  string
+	Artist string
+	Album  string
+
+	takenZoned bool      // TakenAt came with a real UTC offset
+	gpsTime    time.Time // UTC time of the GPS fix, if recorded
+}
+
+// Empty reports whether nothing was found.
+func (m *Metadata) Empty() bool {
+	return *m == Metadata{}
+}
+
+// setTaken records a capture time unless one is already known; sources
+// are consulted most-reliable first. zoned says whether t carries a real
+// UTC offset; otherwise its wall clock is what the device displayed.
+func (m *Metadata) setTaken(t time.Time, zoned bool) {
+	if !m.TakenAt.IsZero() || t.IsZero() || t.Year() < 1900 {
+		return
+	}
+	m.TakenLocal = t.Format(localLayout)
+	if !zoned {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	}
+	m.TakenAt = t
+	m.takenZoned = zoned
+}
+
+// useGPSTime replaces a TakenAt guessed from an offset-less wall clock
+// with the GPS fix time, when the two are within a plausible UTC offset
+// of each other (a stale fix from an earlier session is not).
+func (m *Metadata) useGPSTime() {
+	if m.takenZoned || m.gpsTime.IsZero() || m.TakenAt.IsZero() {
+		return
+	}
+	if d := m.gpsTime.Sub(m.TakenAt); d < -15*time.Hour || d > 15*time.Hour {
+		return
+	}
+	m.TakenAt = m.gpsTime
+	m.takenZoned = true
+}
+
+func (m *Metadata) setLocation(lat, lon float64) {
+	if m.HasLocation || lat < -90 || lat > 90 || lon < -180 || lon > 180 || (lat == 0 && lon == 0) {
+		return
+	}
+	m.HasLocation, m.Latitude, m.Longitude = true, lat, lon
+}
+
+func (m *Metadata) setAltitude(alt float64) {
+	if !m.HasAltitude {
+		m.HasAltitude, m.Altitude = true, alt
+	}
+}
+
+func (m *Metadata) setSize(w, h int) {
+	if m.Width == 0 && m.Height == 0 && w > 0 && h > 0 {
+		m.Width, m.Height = w, h
+	}
+}
+
+// setString stores s in *field unless the field is already set.
+func setString(field *string, s string) {
+	if *field != "" {
+		return
+	}
+	s = strings.TrimSpace(strings.Trim(s, "\x00"))
+	if len(s) > maxStringLen {
+		s = s[:maxStringLen]
+	}
+	*field = s
+}
+
+// Record converts m into the file_media row for path.
+func (m *Metadata) Record(path string) *db.FileMedia {
+	rec := &db.FileMedia{Path: path}
+	str := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+	num := func(n int) *int {
+		if n == 0 {
+			return nil
+		}
+		return &n
+	}
+	if !m.TakenAt.IsZero() {
+		ms := m.TakenAt.UnixMilli()
+		rec.TakenAt = &ms
+		rec.TakenLocal = str(m.TakenLocal)
+	}
+	rec.CameraMake = str(m.CameraMake)
+	rec.CameraModel = str(m.CameraModel)
+	rec.LensModel = str(m.LensModel)
+	if m.HasLocation {
+		lat, lon := m.Latitude, m.Longitude
+		rec.Latitude, rec.Longitude = &lat, &lon
+	}
+	if m.HasAltitude {
+		alt := m.Altitude
+		rec.Altitude = &alt
+	}
+	rec.Width = num(m.Width)
+	rec.Height = num(m.Height)
+	rec.Orientation = num(m.Orientation)
+	if m.Duration > 0 {
+		ms := m.Duration.Milliseconds()
+		rec.DurationMs = &ms
+	}
+	rec.Title = str(m.Title)
+	rec.Artist = str(m.Artist)
+	rec.Album = str(m.Album)
+	return rec
+}
+
+// rawExtensions are camera RAW formats built on TIFF, plus Fujifilm RAF.
+var rawExtensions = map[string]bool{
+	".dng": true, ".cr2": true, ".nef": true, ".nrw": true, ".arw": true, ".srf": true,
+	".sr2": true, ".orf": true, ".rw2": true, ".pef": true, ".srw": true, ".raf": true,
+}
+
+// mediaExtensions are other extensions worth opening regardless of the
+// MIME type recorded for them.
+var mediaExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".jpe": true, ".png": true, ".webp": true,
+	".heic": true, ".heif": true, ".avif": true, ".tif": true, ".tiff": true,
+	".mp4": true, ".m4v": true, ".mov": true, ".3gp": true, ".m4a": true, ".mp3": true,
+}
+
+// Supported reports whether a file might carry metadata these parsers
+// read. It is a cheap pre-filter; Read sniffs the actual content.
+func Supported(path, mimeType string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if rawExtensions[ext] || mediaExtensions[ext] {
+		return true
+	}
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/webp", "image/heic", "image/heif", "image/avif", "image/tiff",
+		"video/mp4", "video/quicktime", "video/3gpp", "video/x-m4v", "audio/mp4", "audio/mpeg":
+		return true
+	}
+	return false
+}
+
+// ExtractFile reads the metadata of the file at fullPath. It returns an
+// empty Metadata for formats it doesn't recognize.
+func ExtractFile(fullPath string) (*Metadata, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Read(f, info.Size(), fullPath)
+}
+
+// Read sniffs the format of r and extracts its metadata. name is only
+// used to recognize formats without a magic number (MP3 without an ID3
+// tag, old QuickTime files).
+func Read(r io.ReaderAt, size int64, name string) (m *Metadata, err error) {
+	m = &Metadata{}
+	defer func() {
+		// Hostile input must not take the server down.
+		if p := recover(); p != nil {
+			err = fmt.Errorf("media parser panic: %v", p)
+		}
+	}()
+
+	head := make([]byte, 16)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+	ext := strings.ToLower(filepath.Ext(name))
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8}):
+		err = parseJPEG(r, 0, size, m)
+	case bytes.HasPrefix(head, pngSignature):
+		err = parsePNG(r, size, m)
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		err = parseWebP(r, size, m)
+	case bytes.HasPrefix(head, []byte("FUJIFILMCCD-RAW")):
+		err = parseRAF(r, size, m)
+	case len(head) >= 4 && isTIFFHeader(head[:4]):
+		err = parseTIFF(r, 0, size, m)
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		err = parseBMFF(r, size, m)
+	case len(head) >= 8 && (ext == ".mov" || ext == ".mp4" || ext == ".m4v") && quickTimeTopLevel[string(head[4:8])]:
+		// Pre-ftyp QuickTime files start straight with an atom.
+		err = parseBMFF(r, size, m)
+	case bytes.HasPrefix(head, []byte("ID3")) || ext == ".mp3":
+		err = parseMP3(r, size, m)
+	}
+	return m, err
+}
+
+// readAt reads exactly n bytes at off.
+func readAt(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	if n < 0 || off < 0 {
+		return nil, errTruncated
+	}
+	buf := make([]byte, n)
+	got, err := r.ReadAt(buf, off)
+	if got == n {
+		return buf, nil
+	}
+	if err == nil || err == io.EOF {
+		err = errTruncated
+	}
+	return nil, err
+}
+
+var errTruncated = errors.New("truncated media file")
@@ -0,0 +1,459 @@
+package mediameta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// tag is one IFD entry for buildTIFF. A non-zero ifd makes it a LONG
+// pointer to that IFD (1-based index into buildTIFF's arguments).
+type tag struct {
+	id   uint16
+	typ  uint16
+	vals []byte
+	ifd  int
+}
+
+func asciiTag(id uint16, s string) tag {
+	return tag{id: id, typ: tiffASCII, vals: append([]byte(s), 0)}
+}
+
+func shortTag(id uint16, v uint16) tag {
+	return tag{id: id, typ: tiffShort, vals: binary.LittleEndian.AppendUint16(nil, v)}
+}
+
+func longTag(id uint16, v uint32) tag {
+	return tag{id: id, typ: tiffLong, vals: binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+func rationalTag(id uint16, vals ...float64) tag {
+	var b []byte
+	for _, v := range vals {
+		b = binary.LittleEndian.AppendUint32(b, uint32(v*1000))
+		b = binary.LittleEndian.AppendUint32(b, 1000)
+	}
+	return tag{id: id, typ: tiffRational, vals: b}
+}
+
+// buildTIFF lays out little-endian IFDs one after another, each followed
+// by its out-of-line values. ifds[0] is IFD0.
+func buildTIFF(ifds ...[]tag) []byte {
+	size := func(tags []tag) int {
+		n := 2 + 12*len(tags) + 4
+		for _, t := range tags {
+			if len(t.vals) > 4 {
+				n += len(t.vals) + len(t.vals)%2
+			}
+		}
+		return n
+	}
+	offsets := make([]int, len(ifds))
+	pos := 8
+	for i, tags := range ifds {
+		offsets[i] = pos
+		pos += size(tags)
+	}
+
+	le := binary.LittleEndian
+	out := []byte("II*\x00")
+	out = le.AppendUint32(out, 8)
+	for i, tags := range ifds {
+		dataAt := offsets[i] + 2 + 12*len(tags) + 4
+		var data []byte
+		out = le.AppendUint16(out, uint16(len(tags)))
+		for _, t := range tags {
+			vals := t.vals
+			if t.ifd != 0 {
+				t.typ, vals = tiffLong, le.AppendUint32(nil, uint32(offsets[t.ifd-1]))
+			}
+			out = le.AppendUint16(out, t.id)
+			out = le.AppendUint16(out, t.typ)
+			out = le.AppendUint32(out, uint32(len(vals)/tiffTypeSize[t.typ]))
+			if len(vals) <= 4 {
+				out = append(out, append(vals, make([]byte, 4-len(vals))...)...)
+				continue
+			}
+			out = le.AppendUint32(out, uint32(dataAt+len(data)))
+			data = append(data, vals...)
+			if len(vals)%2 == 1 {
+				data = append(data, 0)
+			}
+		}
+		out = le.AppendUint32(out, 0)
+		out = append(out, data...)
+	}
+	return out
+}
+
+// cameraEXIF is a typical phone photo: local time with offset, GPS in the
+// southern/western hemispheres.
+func cameraEXIF() []byte {
+	return buildTIFF(
+		[]tag{
+			asciiTag(tagMake, "Apple"),
+			asciiTag(tagModel, "iPhone 15 Pro"),
+			shortTag(tagOrientation, 6),
+			asciiTag(tagDateTime, "2024:06:01 10:00:00"),
+			{id: tagExifIFD, ifd: 2},
+			{id: tagGPSIFD, ifd: 3},
+		},
+		[]tag{
+			asciiTag(tagDateTimeOriginal, "2023:12:31 23:30:15"),
+			asciiTag(tagOffsetTimeOriginal, "-03:00"),
+			longTag(tagPixelXDimension, 4032),
+			longTag(tagPixelYDimension, 3024),
+			asciiTag(tagLensModel, "iPhone 15 Pro back camera"),
+		},
+		[]tag{
+			asciiTag(gpsLatitudeRef, "S"),
+			rationalTag(gpsLatitude, 22, 54, 30),
+			asciiTag(gpsLongitudeRef, "W"),
+			rationalTag(gpsLongitude, 43, 12, 0),
+			{id: gpsAltitudeRef, typ: tiffByte, vals: []byte{0}},
+			rationalTag(gpsAltitude, 12.5),
+		},
+	)
+}
+
+func read(t *testing.T, name string, data []byte) *Metadata {
+	t.Helper()
+	m, err := Read(bytes.NewReader(data), int64(len(data)), name)
+	if err != nil {
+		t.Fatalf("Read(%s): %v", name, err)
+	}
+	return m
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-4 }
+
+func checkCameraEXIF(t *testing.T, m *Metadata) {
+	t.Helper()
+	if m.CameraMake != "Apple" || m.CameraModel != "iPhone 15 Pro" || m.LensModel != "iPhone 15 Pro back camera" {
+		t.Errorf("camera = %q %q %q", m.CameraMake, m.CameraModel, m.LensModel)
+	}
+	// DateTimeOriginal wins over DateTime; the offset makes it an instant,
+	// while the local wall clock keeps New Year's Eve in 2023.
+	if want := time.Date(2024, 1, 1, 2, 30, 15, 0, time.UTC); !m.TakenAt.Equal(want) {
+		t.Errorf("TakenAt = %v, want %v", m.TakenAt.UTC(), want)
+	}
+	if m.TakenLocal != "2023-12-31 23:30:15" {
+		t.Errorf("TakenLocal = %q", m.TakenLocal)
+	}
+	if !m.HasLocation || !near(m.Latitude, -(22+54.0/60+30.0/3600)) || !near(m.Longitude, -43.2) {
+		t.Errorf("location = %v %v,%v", m.HasLocation, m.Latitude, m.Longitude)
+	}
+	if !m.HasAltitude || !near(m.Altitude, 12.5) {
+		t.Errorf("altitude = %v %v", m.HasAltitude, m.Altitude)
+	}
+	if m.Orientation != 6 {
+		t.Errorf("Orientation = %d", m.Orientation)
+	}
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	out := []byte{0xFF, marker}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(payload)+2))
+	return append(out, payload...)
+}
+
+func TestReadJPEG(t *testing.T) {
+	var data []byte
+	data = append(data, 0xFF, 0xD8)
+	data = append(data, jpegSegment(0xE0, []byte("JFIF\x00\x01\x02"))...)
+	data = append(data, jpegSegment(0xE1, append([]byte("Exif\x00\x00"), cameraEXIF()...))...)
+	data = append(data, jpegSegment(0xC0, []byte{8, 0x0B, 0xD0, 0x0F, 0xC0, 3})...) // 4032x3024
+	data = append(data, 0xFF, 0xDA, 0, 2, 0xFF, 0xD9)
+
+	m := read(t, "IMG_0001.JPG", data)
+	checkCameraEXIF(t, m)
+	if m.Width != 4032 || m.Height != 3024 {
+		t.Errorf("size = %dx%d", m.Width, m.Height)
+	}
+}
+
+func TestReadJPEG_XMPFillsGaps(t *testing.T) {
+	xmp := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF><rdf:Description
+		exif:DateTimeOriginal="2019-08-10T14:03:22+02:00"
+		exif:GPSLatitude="48,51.3N" exif:GPSLongitude="2,21.05E">
+		<tiff:Model>X-T4</tiff:Model></rdf:Description></rdf:RDF></x:xmpmeta>`
+	var data []byte
+	data = append(data, 0xFF, 0xD8)
+	data = append(data, jpegSegment(0xE1, append(append([]byte(nil), xmpHeader...), xmp...))...)
+	data = append(data, 0xFF, 0xD9)
+
+	m := read(t, "scan.jpg", data)
+	if m.TakenLocal != "2019-08-10 14:03:22" || m.TakenAt.UTC().Hour() != 12 {
+		t.Errorf("taken = %q / %v", m.TakenLocal, m.TakenAt.UTC())
+	}
+	if m.CameraModel != "X-T4" {
+		t.Errorf("model = %q", m.CameraModel)
+	}
+	if !near(m.Latitude, 48.855) || !near(m.Longitude, 2+21.05/60) {
+		t.Errorf("location = %v,%v", m.Latitude, m.Longitude)
+	}
+}
+
+func TestReadEXIF_NoOffsetUsesGPSClock(t *testing.T) {
+	exif := buildTIFF(
+		[]tag{{id: tagExifIFD, ifd: 2}, {id: tagGPSIFD, ifd: 3}},
+		[]tag{asciiTag(tagDateTimeOriginal, "2022:07:04 18:00:05")},
+		[]tag{
+			asciiTag(gpsDateStamp, "2022:07:04"),
+			rationalTag(gpsTimeStamp, 16, 0, 5),
+		},
+	)
+	m := read(t, "dsc.tif", exif)
+	if m.TakenLocal != "2022-07-04 18:00:05" {
+		t.Errorf("TakenLocal = %q", m.TakenLocal)
+	}
+	if want := time.Date(2022, 7, 4, 16, 0, 5, 0, time.UTC); !m.TakenAt.Equal(want) {
+		t.Errorf("TakenAt = %v, want the GPS clock %v", m.TakenAt, want)
+	}
+}
+
+func pngChunk(typ string, data []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	out = append(out, typ...)
+	out = append(out, data...)
+	return append(out, 0, 0, 0, 0) // CRC isn't checked
+}
+
+func TestReadPNG(t *testing.T) {
+	ihdr := binary.BigEndian.AppendUint32(nil, 640)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 480)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	data := append([]byte(nil), pngSignature...)
+	data = append(data, pngChunk("IHDR", ihdr)...)
+	data = append(data, pngChunk("eXIf", cameraEXIF())...)
+	data = append(data, pngChunk("IEND", nil)...)
+
+	m := read(t, "screenshot.png", data)
+	checkCameraEXIF(t, m)
+	if m.Width != 640 || m.Height != 480 {
+		t.Errorf("size = %dx%d", m.Width, m.Height)
+	}
+}
+
+func TestReadWebP(t *testing.T) {
+	vp8x := []byte{0x08, 0, 0, 0}
+	vp8x = append(vp8x, 0x7F, 0x07, 0x00) // width-1 = 1919
+	vp8x = append(vp8x, 0x37, 0x04, 0x00) // height-1 = 1079
+	chunk := func(typ string, data []byte) []byte {
+		out := append([]byte(typ), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+		out = append(out, data...)
+		if len(data)%2 == 1 {
+			out = append(out, 0)
+		}
+		return out
+	}
+	body := append([]byte("WEBP"), chunk("VP8X", vp8x)...)
+	body = append(body, chunk("EXIF", cameraEXIF())...)
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	data = append(data, body...)
+
+	m := read(t, "photo.webp", data)
+	checkCameraEXIF(t, m)
+	if m.Width != 1920 || m.Height != 1080 {
+		t.Errorf("size = %dx%d", m.Width, m.Height)
+	}
+}
+
+func mp4Box(typ string, children ...[]byte) []byte {
+	var payload []byte
+	for _, c := range children {
+		payload = append(payload, c...)
+	}
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(out, typ...), payload...)
+}
+
+func mp4Data(s string) []byte {
+	return mp4Box("data", append([]byte{0, 0, 0, 1, 0, 0, 0, 0}, s...))
+}
+
+func TestReadMP4_QuickTime(t *testing.T) {
+	created := time.Date(2024, 3, 9, 8, 15, 0, 0, time.UTC)
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[4:], uint32(created.Sub(mp4Epoch)/time.Second))
+	binary.BigEndian.PutUint32(mvhd[12:], 600)        // timescale
+	binary.BigEndian.PutUint32(mvhd[16:], 600*95+300) // 95.5 s
+
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[40:], 0)        // a
+	binary.BigEndian.PutUint32(tkhd[44:], 1<<16)    // b: rotated 90°
+	binary.BigEndian.PutUint32(tkhd[76:], 1920<<16) // width
+	binary.BigEndian.PutUint32(tkhd[80:], 1080<<16) // height
+
+	var keys []byte
+	keys = append(keys, 0, 0, 0, 0, 0, 0, 0, 3)
+	for _, k := range []string{"com.apple.quicktime.make", "com.apple.quicktime.location.ISO6709", "com.apple.quicktime.creationdate"} {
+		keys = binary.BigEndian.AppendUint32(keys, uint32(8+len(k)))
+		keys = append(keys, "mdta"...)
+		keys = append(keys, k...)
+	}
+	item := func(idx uint32, value string) []byte {
+		return mp4Box(string(binary.BigEndian.AppendUint32(nil, idx)), mp4Data(value))
+	}
+	meta := mp4Box("meta",
+		mp4Box("hdlr", make([]byte, 24)),
+		mp4Box("keys", keys),
+		mp4Box("ilst",
+			item(1, "Apple"),
+			item(2, "+35.6586+139.7454+040.000/"),
+			item(3, "2024-03-09T17:15:00+0900"),
+		),
+	)
+	file := append(mp4Box("ftyp", []byte("qt  \x00\x00\x00\x00qt  ")),
+		mp4Box("moov", mp4Box("mvhd", mvhd), mp4Box("trak", mp4Box("tkhd", tkhd)), meta)...)
+	file = append(file, mp4Box("mdat", []byte("frames"))...)
+
+	m := read(t, "IMG_4242.MOV", file)
+	if m.TakenLocal != "2024-03-09 17:15:00" || !m.TakenAt.Equal(created) {
+		t.Errorf("taken = %q / %v", m.TakenLocal, m.TakenAt)
+	}
+	if m.Duration != 95500*time.Millisecond {
+		t.Errorf("Duration = %v", m.Duration)
+	}
+	if m.Width != 1920 || m.Height != 1080 || m.Orientation != 6 {
+		t.Errorf("size = %dx%d orientation %d", m.Width, m.Height, m.Orientation)
+	}
+	if !near(m.Latitude, 35.6586) || !near(m.Longitude, 139.7454) || !near(m.Altitude, 40) {
+		t.Errorf("location = %v,%v alt %v", m.Latitude, m.Longitude, m.Altitude)
+	}
+	if m.CameraMake != "Apple" {
+		t.Errorf("make = %q", m.CameraMake)
+	}
+}
+
+func TestReadM4A_iTunesTags(t *testing.T) {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 44100)
+	binary.BigEndian.PutUint32(mvhd[16:], 44100*200)
+	meta := mp4Box("meta", append([]byte{0, 0, 0, 0},
+		mp4Box("ilst",
+			mp4Box("\xa9nam", mp4Data("Song")),
+			mp4Box("\xa9ART", mp4Data("Band")),
+			mp4Box("\xa9alb", mp4Data("Record")),
+			mp4Box("\xa9day", mp4Data("1999")),
+		)...))
+	file := append(mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00")),
+		mp4Box("moov", mp4Box("mvhd", mvhd), mp4Box("udta", meta))...)
+
+	m := read(t, "track.m4a", file)
+	if m.Title != "Song" || m.Artist != "Band" || m.Album != "Record" {
+		t.Errorf("tags = %q %q %q", m.Title, m.Artist, m.Album)
+	}
+	if m.Duration != 200*time.Second {
+		t.Errorf("Duration = %v", m.Duration)
+	}
+	if !m.TakenAt.IsZero() {
+		t.Errorf("a release year is not a capture time: %v", m.TakenAt)
+	}
+}
+
+func TestReadHEIF(t *testing.T) {
+	exif := append([]byte{0, 0, 0, 6}, "Exif\x00\x00"...)
+	exif = append(exif, cameraEXIF()...)
+
+	infe := mp4Box("infe", []byte{2, 0, 0, 0, 0, 7, 0, 0, 'E', 'x', 'i', 'f', 0})
+	iinf := mp4Box("iinf", append([]byte{0, 0, 0, 0, 0, 1}, infe...))
+	ispe := func(w, h uint32) []byte {
+		b := binary.BigEndian.AppendUint32([]byte{0, 0, 0, 0}, w)
+		return mp4Box("ispe", binary.BigEndian.AppendUint32(b, h))
+	}
+	iprp := mp4Box("iprp", mp4Box("ipco", ispe(512, 512), ispe(4032, 3024)))
+
+	build := func(exifAt uint32) []byte {
+		iloc := []byte{0, 0, 0, 0, 0x44, 0x00, 0, 1} // v0, offset/length 4 bytes, one item
+		iloc = append(iloc, 0, 7, 0, 0, 0, 1)        // item 7, data ref 0, one extent
+		iloc = binary.BigEndian.AppendUint32(iloc, exifAt)
+		iloc = binary.BigEndian.AppendUint32(iloc, uint32(len(exif)))
+		meta := mp4Box("meta", append([]byte{0, 0, 0, 0},
+			append(append(mp4Box("hdlr", make([]byte, 24)), iinf...), append(mp4Box("iloc", iloc), iprp...)...)...))
+		return append(append(mp4Box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic")), meta...), mp4Box("mdat", exif)...)
+	}
+	file := build(0)
+	file = build(uint32(len(file) - len(exif)))
+
+	m := read(t, "IMG_0002.HEIC", file)
+	checkCameraEXIF(t, m)
+	if m.Width != 4032 || m.Height != 3024 {
+		t.Errorf("size = %dx%d, want the largest ispe", m.Width, m.Height)
+	}
+}
+
+func id3Frame(id string, text string) []byte {
+	body := append([]byte{3}, text...) // UTF-8
+	out := append([]byte(id), binary.BigEndian.AppendUint32(nil, uint32(len(body)))...)
+	return append(append(out, 0, 0), body...)
+}
+
+func TestReadMP3(t *testing.T) {
+	frames := append(id3Frame("TIT2", "Café"), id3Frame("TPE1", "Artist")...)
+	frames = append(frames, id3Frame("TALB", "Album")...)
+	tag := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frames))}
+	file := append(tag, frames...)
+
+	// MPEG-1 Layer III, 128 kbps, 44.1 kHz, stereo; Xing header with 1000
+	// frames → 1000 * 1152 / 44100 s.
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	copy(frame[36:], "Xing\x00\x00\x00\x01")
+	binary.BigEndian.PutUint32(frame[44:], 1000)
+	file = append(file, frame...)
+
+	m := read(t, "song.mp3", file)
+	if m.Title != "Café" || m.Artist != "Artist" || m.Album != "Album" {
+		t.Errorf("tags = %q %q %q", m.Title, m.Artist, m.Album)
+	}
+	if want := framesDuration(1000, 1152, 44100); m.Duration != want {
+		t.Errorf("Duration = %v, want %v", m.Duration, want)
+	}
+}
+
+func TestReadMP3_CBRWithoutTags(t *testing.T) {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00}) // 128 kbps
+	file := bytes.Repeat(frame, 100)
+
+	m := read(t, "voice.mp3", file)
+	want := time.Duration(float64(len(file)*8) / 128000 * float64(time.Second))
+	if m.Duration != want {
+		t.Errorf("Duration = %v, want %v", m.Duration, want)
+	}
+}
+
+func TestRead_HostileInput(t *testing.T) {
+	inputs := map[string][]byte{
+		"a.jpg":  {0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF, 'E', 'x'},
+		"b.tif":  []byte("II*\x00\xff\xff\xff\xff"),
+		"c.mp4":  append(mp4Box("ftyp", []byte("isom")), 0, 0, 0, 1, 'm', 'o', 'o', 'v', 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff),
+		"d.mp3":  {'I', 'D', '3', 4, 0, 0x40, 0x7F, 0x7F, 0x7F, 0x7F},
+		"e.png":  append(append([]byte(nil), pngSignature...), 0xFF, 0xFF, 0xFF, 0xFF, 'e', 'X', 'I', 'f'),
+		"f.heic": append(mp4Box("ftyp", []byte("heic")), mp4Box("meta", []byte{0, 0, 0, 0, 0, 0, 0, 9, 'i', 'l', 'o', 'c', 1})...),
+	}
+	for name, data := range inputs {
+		m, _ := Read(bytes.NewReader(data), int64(len(data)), name)
+		if m == nil {
+			t.Errorf("%s: nil metadata", name)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	m := &Metadata{CameraModel: "X100V", Width: 10, Height: 20}
+	m.setTaken(time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC), false)
+	rec := m.Record("photos/a.jpg")
+	if rec.Path != "photos/a.jpg" || *rec.CameraModel != "X100V" || *rec.Width != 10 {
+		t.Errorf("record = %+v", rec)
+	}
+	if *rec.TakenLocal != "2021-05-06 07:08:09" || *rec.TakenAt != time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC).UnixMilli() {
+		t.Errorf("taken = %v %v", *rec.TakenLocal, *rec.TakenAt)
+	}
+	if rec.Latitude != nil || rec.CameraMake != nil || rec.DurationMs != nil {
+		t.Errorf("unset fields must stay nil: %+v", rec)
+	}
+}
@@ -0,0 +1,107 @@
+package mediameta
+
+import (
+	"context"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// Worker extracts media metadata from photos, videos and audio files and
+// stores it in the file_media table of the index DB. Like the text
+// indexer it runs synchronously on file change events; the parsers read a
+// few kilobytes per file.
+type Worker struct {
+	resolve   func(path string) string
+	db        *db.DB
+	isIgnored func(path string) bool
+}
+
+// New creates a media metadata worker over the user's library. resolve
+// maps relative file paths to where they live on disk (the data directory,
+// or a mounted folder). isIgnored (optional) reports paths excluded by the
+// user's ignore rules.
+func New(resolve func(path string) string, database *db.DB, isIgnored func(path string) bool) *Worker {
+	return &Worker{resolve: resolve, db: database, isIgnored: isIgnored}
+}
+
+// OnFileChange re-extracts a file's metadata after its content changed.
+// Renames, moves and deletes need nothing here: the file cascades carry
+// the file_media row along.
+func (w *Worker) OnFileChange(filePath string) {
+	if err := w.ExtractJob(context.Background(), filePath); err != nil {
+		log.Error().Err(err).Str("path", filePath).Msg("media worker: failed to store metadata")
+	}
+}
+
+// JobKind is the job queue kind for extracting one file's metadata (key:
+// the path).
+const JobKind = "media"
+
+// ExtractJob is the job queue handler for JobKind: OnFileChange with the
+// error returned for retrying.
+func (w *Worker) ExtractJob(ctx context.Context, filePath string) error {
+	file, err := w.db.GetFileByPath(filePath)
+	if err != nil {
+		return err
+	}
+	if file == nil || file.IsFolder {
+		return nil
+	}
+	mimeType := ""
+	if file.MimeType != nil {
+		mimeType = *file.MimeType
+	}
+	return w.extract(filePath, mimeType)
+}
+
+// extract reads one file and writes its row. Files that turn out to carry
+// nothing still get a row, so the backfill doesn't reopen them.
+func (w *Worker) extract(filePath, mimeType string) error {
+	if !Supported(filePath, mimeType) {
+		return nil
+	}
+	if w.isIgnored != nil && w.isIgnored(filePath) {
+		return nil
+	}
+	meta, err := ExtractFile(w.resolve(filePath))
+	if err != nil {
+		if meta == nil {
+			// Unreadable (vanished mid-event, permissions): try again on
+			// the next change or startup.
+			log.Debug().Err(err).Str("path", filePath).Msg("media worker: cannot open file")
+			return nil
+		}
+		log.Debug().Err(err).Str("path", filePath).Msg("media worker: metadata incomplete")
+	}
+	return w.db.UpsertFileMedia(context.Background(), meta.Record(filePath))
+}
+
+// Backfill extracts metadata for every supported file that has no
+// file_media row yet. Idempotent — re-running adds nothing.
+func (w *Worker) Backfill() {
+	log.Info().Msg("media worker: starting backfill")
+
+	files, err := w.db.ListFilesWithoutMedia()
+	if err != nil {
+		log.Error().Err(err).Msg("media worker: failed to query files for backfill")
+		return
+	}
+
+	extracted := 0
+	for _, f := range files {
+		if !Supported(f.Path, f.MimeType) {
+			continue
+		}
+		if err := w.extract(f.Path, f.MimeType); err != nil {
+			log.Warn().Err(err).Str("path", f.Path).Msg("media worker: backfill failed for file")
+			continue
+		}
+		extracted++
+	}
+
+	log.Info().
+		Int("candidates", len(files)).
+		Int("extracted", extracted).
+		Msg("media worker: backfill complete")
+}
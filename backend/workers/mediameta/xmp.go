@@ -0,0 +1,148 @@
+package mediameta
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XMP is RDF/XML. Properties appear either as attributes of an
+// rdf:Description (exif:DateTimeOriginal="...") or as child elements
+// (<exif:DateTimeOriginal>...</exif:DateTimeOriginal>); both are matched
+// textually rather than by resolving namespaces, which every writer in
+// practice binds to the conventional prefixes.
+
+// maxXMPBytes bounds how much of an XMP packet is examined.
+const maxXMPBytes = 1 << 20
+
+// xmpProps are the properties parseXMP reads, each with a pattern
+// matching both the attribute and the element form.
+var xmpProps = func() map[string]*regexp.Regexp {
+	res := make(map[string]*regexp.Regexp)
+	for _, p := range []string{
+		"exif:DateTimeOriginal", "photoshop:DateCreated", "xmp:CreateDate",
+		"tiff:Make", "tiff:Model", "aux:Lens", "exifEX:LensModel",
+		"exif:GPSLatitude", "exif:GPSLongitude", "exif:GPSAltitude", "exif:GPSAltitudeRef",
+		"tiff:Orientation", "exif:PixelXDimension", "exif:PixelYDimension",
+	} {
+		q := regexp.QuoteMeta(p)
+		res[p] = regexp.MustCompile(`\s` + q + `\s*=\s*"([^"]*)"|<` + q + `>([^<]*)</` + q + `>`)
+	}
+	return res
+}()
+
+// xmpProp returns the value of the first of props present in packet.
+func xmpProp(packet string, props ...string) string {
+	for _, p := range props {
+		m := xmpProps[p].FindStringSubmatch(packet)
+		for _, v := range m[min(len(m), 1):] {
+			if v != "" {
+				return xmlUnescape(strings.TrimSpace(v))
+			}
+		}
+	}
+	return ""
+}
+
+var xmlUnescaper = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'")
+
+func xmlUnescape(s string) string {
+	return xmlUnescaper.Replace(s)
+}
+
+// parseXMP fills in whatever EXIF left unset from an XMP packet.
+func parseXMP(data []byte, m *Metadata) {
+	if len(data) > maxXMPBytes {
+		data = data[:maxXMPBytes]
+	}
+	packet := string(data)
+
+	if t, zoned, ok := parseXMPDate(xmpProp(packet, "exif:DateTimeOriginal", "photoshop:DateCreated", "xmp:CreateDate")); ok {
+		m.setTaken(t, zoned)
+	}
+	setString(&m.CameraMake, xmpProp(packet, "tiff:Make"))
+	setString(&m.CameraModel, xmpProp(packet, "tiff:Model"))
+	setString(&m.LensModel, xmpProp(packet, "exifEX:LensModel", "aux:Lens"))
+
+	lat, latOK := parseXMPCoordinate(xmpProp(packet, "exif:GPSLatitude"))
+	lon, lonOK := parseXMPCoordinate(xmpProp(packet, "exif:GPSLongitude"))
+	if latOK && lonOK {
+		m.setLocation(lat, lon)
+	}
+	if alt, ok := parseXMPRational(xmpProp(packet, "exif:GPSAltitude")); ok {
+		if xmpProp(packet, "exif:GPSAltitudeRef") == "1" {
+			alt = -alt
+		}
+		m.setAltitude(alt)
+	}
+	if o, err := strconv.Atoi(xmpProp(packet, "tiff:Orientation")); err == nil && o >= 1 && o <= 8 && m.Orientation == 0 {
+		m.Orientation = o
+	}
+	w, _ := strconv.Atoi(xmpProp(packet, "exif:PixelXDimension"))
+	h, _ := strconv.Atoi(xmpProp(packet, "exif:PixelYDimension"))
+	m.setSize(w, h)
+}
+
+// xmpDateLayouts are the ISO 8601 forms XMP dates take, with and without
+// a zone.
+var xmpDateLayouts = []struct {
+	layout string
+	zoned  bool
+}{
+	{"2006-01-02T15:04:05.999999999Z07:00", true},
+	{"2006-01-02T15:04Z07:00", true},
+	{"2006-01-02T15:04:05.999999999", false},
+	{"2006-01-02T15:04", false},
+}
+
+func parseXMPDate(s string) (time.Time, bool, bool) {
+	for _, l := range xmpDateLayouts {
+		if t, err := time.Parse(l.layout, s); err == nil {
+			return t, l.zoned, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// parseXMPCoordinate parses "DDD,MM,SSk" or "DDD,MM.mmk" where k is one
+// of N, S, E, W.
+func parseXMPCoordinate(s string) (float64, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	ref := s[len(s)-1]
+	parts := strings.Split(s[:len(s)-1], ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+	var v float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return 0, false
+		}
+		v += f / []float64{1, 60, 3600}[i]
+	}
+	switch ref {
+	case 'S', 'W', 's', 'w':
+		return -v, true
+	case 'N', 'E', 'n', 'e':
+		return v, true
+	}
+	return 0, false
+}
+
+// parseXMPRational parses "1234/10".
+func parseXMPRational(s string) (float64, bool) {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, false
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0, false
+	}
+	return n / d, true
+}
@@ -23,18 +23,24 @@ import (
 
 	"github.com/xiaoyuanzhu-com/my-life-db/agentsdk"
 	"github.com/xiaoyuanzhu-com/my-life-db/db"
+	"github.com/xiaoyuanzhu-com/my-life-db/jobs"
 	"github.com/xiaoyuanzhu-com/my-life-db/log"
 )
 
 // DefaultSweepInterval is the default period between sweep ticks.
 const DefaultSweepInterval = 5 * time.Minute
 
+// JobKind is the job queue kind for re-indexing one session (key: the
+// session ID). See SetQueue.
+const JobKind = "sessionindex"
+
 // Indexer re-indexes agent session transcripts into agent_sessions_fts.
 type Indexer struct {
 	appDB      *db.DB
 	indexDB    *db.DB
 	frameStore *agentsdk.FrameStore
 	interval   time.Duration
+	queue      *jobs.Queue
 }
 
 // New creates an Indexer. interval can be zero to use DefaultSweepInterval.
@@ -50,6 +56,13 @@ func New(appDB, indexDB *db.DB, frameStore *agentsdk.FrameStore, interval time.D
 	}
 }
 
+// SetQueue makes sweeps hand the sessions to re-index to the job queue
+// (as JobKind, run by IndexJob) instead of indexing them inline, so the
+// backlog shows up with the other background work. Call before Start.
+func (idx *Indexer) SetQueue(q *jobs.Queue) {
+	idx.queue = q
+}
+
 // Start runs the periodic sweep. Returns when ctx is cancelled.
 //
 // Runs an initial sweep immediately on startup so a fresh database (or one
@@ -88,6 +101,7 @@ func (idx *Indexer) SweepOnce(ctx context.Context) {
 	}
 
 	indexed, skipped, failed := 0, 0, 0
+	var stale []string
 	live := make(map[string]struct{}, len(sessions))
 	for _, s := range sessions {
 		live[s.SessionID] = struct{}{}
@@ -102,18 +116,20 @@ func (idx *Indexer) SweepOnce(ctx context.Context) {
 			continue
 		}
 
-		// Indexed-at is the moment we read the transcript; if more frames are
-		// appended after this point, the next bump of last_message_at will be
-		// strictly greater and the next sweep picks them up.
-		indexedAt := db.NowMs()
-		content := idx.extractTranscript(s.SessionID)
-		if err := idx.indexDB.IndexAgentSession(ctx, s.SessionID, content, indexedAt); err != nil {
+		if idx.queue != nil {
+			stale = append(stale, s.SessionID)
+			continue
+		}
+		if err := idx.indexSession(ctx, s.SessionID); err != nil {
 			log.Error().Err(err).Str("sessionId", s.SessionID).Msg("session indexer: failed to index session")
 			failed++
 			continue
 		}
 		indexed++
 	}
+	if len(stale) > 0 {
+		idx.queue.EnqueueMany(JobKind, stale, jobs.PriorityBackground)
+	}
 
 	// Deletions: any session in the index that's no longer in the app DB.
 	dropped := 0
@@ -130,6 +146,7 @@ func (idx *Indexer) SweepOnce(ctx context.Context) {
 
 	log.Info().
 		Int("indexed", indexed).
+		Int("queued", len(stale)).
 		Int("skipped", skipped).
 		Int("failed", failed).
 		Int("dropped", dropped).
@@ -137,6 +154,21 @@ func (idx *Indexer) SweepOnce(ctx context.Context) {
 		Msg("session indexer: sweep complete")
 }
 
+// IndexJob is the job queue handler for JobKind.
+func (idx *Indexer) IndexJob(ctx context.Context, sessionID string) error {
+	return idx.indexSession(ctx, sessionID)
+}
+
+// indexSession re-reads one session's transcript into agent_sessions_fts.
+func (idx *Indexer) indexSession(ctx context.Context, sessionID string) error {
+	// Indexed-at is the moment we read the transcript; if more frames are
+	// appended after this point, the next bump of last_message_at will be
+	// strictly greater and the next sweep picks them up.
+	indexedAt := db.NowMs()
+	content := idx.extractTranscript(sessionID)
+	return idx.indexDB.IndexAgentSession(ctx, sessionID, content, indexedAt)
+}
+
 // extractTranscript reads the session's persisted ACP frames and concatenates
 // the human-readable text into a single blob suitable for FTS5.
 //
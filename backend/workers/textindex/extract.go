@@ -0,0 +1,280 @@
+package textindex
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xiaoyuanzhu-com/my-life-db/log"
+)
+
+// Document extraction.
+//
+// Text files are read as-is (ReadTextContent). Everything else goes
+// through a Registry of Formats: each one recognizes a set of extensions
+// and MIME types and pulls plain text out of the document. A file with no
+// matching Format still gets an FTS row, just with empty content, so its
+// name stays searchable.
+//
+// Extractors are pure Go and tolerant: a malformed or unsupported document
+// yields whatever text was recovered before the problem, never an index
+// failure.
+
+// maxMemberBytes bounds how much of one archive member or MIME part is
+// decoded, so a zip bomb costs at most this much per member.
+const maxMemberBytes = 64 << 20
+
+// ExtractFunc extracts the text of one document into out. Extractors
+// should stop early once out.Full() reports true.
+type ExtractFunc func(r io.ReaderAt, size int64, out *TextBuffer) error
+
+// Format describes one extractable document format.
+type Format struct {
+	Name       string
+	Extensions []string // lowercase, with the leading dot
+	MimeTypes  []string
+
+	// MaxFileSize skips documents larger than this (bytes; 0 = no limit).
+	// Skipped documents are indexed by name only.
+	MaxFileSize int64
+	// MaxTextBytes caps the extracted text (0 = MaxContentBytes).
+	MaxTextBytes int
+
+	Extract ExtractFunc
+}
+
+// Registry maps extensions and MIME types to Formats. It is safe for
+// concurrent use; a later Register overrides earlier ones for the same
+// extension or MIME type.
+type Registry struct {
+	mu     sync.RWMutex
+	byExt  map[string]*Format
+	byMime map[string]*Format
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{byExt: make(map[string]*Format), byMime: make(map[string]*Format)}
+}
+
+// DefaultRegistry returns a registry with the built-in formats: PDF,
+// DOCX/XLSX/PPTX, EPUB, HTML and EML.
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, f := range builtinFormats {
+		r.Register(f)
+	}
+	return r
+}
+
+// Register adds a format.
+func (r *Registry) Register(f Format) {
+	format := &f
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ext := range f.Extensions {
+		r.byExt[strings.ToLower(ext)] = format
+	}
+	for _, m := range f.MimeTypes {
+		r.byMime[strings.ToLower(m)] = format
+	}
+}
+
+// Lookup returns the format for a file, matching its extension first and
+// its MIME type (parameters ignored) second. Returns nil if none matches.
+func (r *Registry) Lookup(path, mimeType string) *Format {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if f := r.byExt[strings.ToLower(filepath.Ext(path))]; f != nil {
+		return f
+	}
+	if mimeType != "" {
+		if mt, _, err := mime.ParseMediaType(mimeType); err == nil {
+			return r.byMime[mt]
+		}
+	}
+	return nil
+}
+
+// ExtractFile runs format on the file at fullPath and returns the text it
+// recovered. Oversized files, extractor errors and extractor panics are
+// logged and yield the text recovered so far (possibly "").
+func ExtractFile(format *Format, fullPath string) string {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+	if format.MaxFileSize > 0 && info.Size() > format.MaxFileSize {
+		log.Debug().Str("path", fullPath).Str("format", format.Name).Int64("size", info.Size()).
+			Msg("text indexer: document over extraction size limit, indexing name only")
+		return ""
+	}
+
+	limit := format.MaxTextBytes
+	if limit <= 0 {
+		limit = MaxContentBytes
+	}
+	out := NewTextBuffer(limit)
+	if err := safeExtract(format.Extract, f, info.Size(), out); err != nil {
+		log.Warn().Err(err).Str("path", fullPath).Str("format", format.Name).
+			Msg("text indexer: extraction incomplete")
+	}
+	return out.String()
+}
+
+// safeExtract shields the indexer from parser panics on hostile input, and
+// from faults on a memory-mapped file that shrank underneath the parser.
+func safeExtract(extract ExtractFunc, r io.ReaderAt, size int64, out *TextBuffer) (err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("extractor panic: %v", p)
+		}
+	}()
+	return extract(r, size, out)
+}
+
+// readAllAt reads the first size bytes of r into memory.
+func readAllAt(r io.ReaderAt, size int64) ([]byte, func(), error) {
+	data := make([]byte, size)
+	n, err := r.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	return data[:n], func() {}, nil
+}
+
+// TextBuffer accumulates extracted text up to a byte limit. Runs of
+// whitespace collapse to a single space, or a single newline if any of
+// them was a line break; control characters and invalid UTF-8 are dropped.
+type TextBuffer struct {
+	b       strings.Builder
+	limit   int
+	pending rune // separator owed before the next visible rune
+	full    bool
+}
+
+// NewTextBuffer returns a buffer that holds at most limit bytes.
+func NewTextBuffer(limit int) *TextBuffer {
+	return &TextBuffer{limit: limit}
+}
+
+// WriteString appends s.
+func (t *TextBuffer) WriteString(s string) {
+	for _, r := range s {
+		if t.full {
+			return
+		}
+		switch {
+		case r == '\n' || r == '\r' || r == '\f' || r == '\v':
+			t.pending = '\n'
+		case unicode.IsSpace(r):
+			t.Space()
+		case r == utf8.RuneError || unicode.IsControl(r):
+		default:
+			if t.pending != 0 && t.b.Len() > 0 {
+				t.put(t.pending)
+			}
+			t.pending = 0
+			t.put(r)
+		}
+	}
+}
+
+// Space separates what comes next from what was written, unless a line
+// break is already owed.
+func (t *TextBuffer) Space() {
+	if t.pending == 0 {
+		t.pending = ' '
+	}
+}
+
+// Break ends the current line or paragraph.
+func (t *TextBuffer) Break() {
+	t.pending = '\n'
+}
+
+// Full reports whether the limit has been reached.
+func (t *TextBuffer) Full() bool {
+	return t.full
+}
+
+// String returns the text written so far.
+func (t *TextBuffer) String() string {
+	return t.b.String()
+}
+
+func (t *TextBuffer) put(r rune) {
+	if t.b.Len()+utf8.RuneLen(r) > t.limit {
+		t.full = true
+		return
+	}
+	t.b.WriteRune(r)
+}
+
+// builtinFormats are the formats DefaultRegistry registers.
+var builtinFormats = []Format{
+	{
+		Name:         "pdf",
+		Extensions:   []string{".pdf"},
+		MimeTypes:    []string{"application/pdf"},
+		MaxFileSize:  200 << 20,
+		MaxTextBytes: 4 << 20,
+		Extract:      extractPDF,
+	},
+	{
+		Name:        "docx",
+		Extensions:  []string{".docx", ".docm"},
+		MimeTypes:   []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		MaxFileSize: 100 << 20,
+		Extract:     extractDOCX,
+	},
+	{
+		Name:        "xlsx",
+		Extensions:  []string{".xlsx", ".xlsm"},
+		MimeTypes:   []string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		MaxFileSize: 100 << 20,
+		Extract:     extractXLSX,
+	},
+	{
+		Name:        "pptx",
+		Extensions:  []string{".pptx", ".pptm"},
+		MimeTypes:   []string{"application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+		MaxFileSize: 200 << 20,
+		Extract:     extractPPTX,
+	},
+	{
+		Name:         "epub",
+		Extensions:   []string{".epub"},
+		MimeTypes:    []string{"application/epub+zip"},
+		MaxFileSize:  200 << 20,
+		MaxTextBytes: 4 << 20,
+		Extract:      extractEPUB,
+	},
+	{
+		Name:        "html",
+		Extensions:  []string{".html", ".htm", ".xhtml"},
+		MimeTypes:   []string{"text/html", "application/xhtml+xml"},
+		MaxFileSize: 20 << 20,
+		Extract:     extractHTML,
+	},
+	{
+		Name:        "eml",
+		Extensions:  []string{".eml"},
+		MimeTypes:   []string{"message/rfc822"},
+		MaxFileSize: 50 << 20,
+		Extract:     extractEML,
+	},
+}
@@ -0,0 +1,188 @@
+package textindex
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// maxMIMEDepth bounds multipart nesting (forwarded-within-forwarded mail).
+const maxMIMEDepth = 8
+
+// emlHeaders are indexed ahead of the body, in this order.
+var emlHeaders = []string{"Subject", "From", "To", "Cc", "Date"}
+
+// extractEML indexes a message's main headers and its readable body: the
+// text/plain alternative where there is one, text/html otherwise. Attached
+// files are skipped; attached messages are indexed like the outer one.
+func extractEML(r io.ReaderAt, size int64, out *TextBuffer) error {
+	msg, err := mail.ReadMessage(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+	dec := mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+	for _, h := range emlHeaders {
+		v := msg.Header.Get(h)
+		if v == "" {
+			continue
+		}
+		if decoded, err := dec.DecodeHeader(v); err == nil {
+			v = decoded
+		}
+		out.WriteString(v)
+		out.Break()
+	}
+	out.Break()
+	return mimeText(mimeHeader(msg.Header), msg.Body, out, 0)
+}
+
+// mimeHeader is the subset of header access mimeText needs; both
+// mail.Header and textproto.MIMEHeader (multipart parts) provide it.
+type mimeHeader interface {
+	Get(key string) string
+}
+
+// mimeText writes the readable text of one MIME entity.
+func mimeText(h mimeHeader, body io.Reader, out *TextBuffer, depth int) error {
+	if depth > maxMIMEDepth || out.Full() {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	if disp, _, _ := mime.ParseMediaType(h.Get("Content-Disposition")); disp == "attachment" && mediaType != "message/rfc822" {
+		return nil
+	}
+	body = transferDecoder(h.Get("Content-Transfer-Encoding"), body)
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return multipartText(mediaType, params["boundary"], body, out, depth)
+	case mediaType == "message/rfc822":
+		msg, err := mail.ReadMessage(body)
+		if err != nil {
+			return err
+		}
+		for _, key := range emlHeaders[:2] {
+			out.WriteString(msg.Header.Get(key))
+			out.Break()
+		}
+		return mimeText(mimeHeader(msg.Header), msg.Body, out, depth+1)
+	case mediaType == "text/html":
+		return htmlToText(body, "text/html; charset="+params["charset"], out)
+	case strings.HasPrefix(mediaType, "text/"):
+		label := params["charset"]
+		if label == "" {
+			// Undeclared is usually ASCII; UTF-8 covers it and the rest.
+			label = "utf-8"
+		}
+		decoded, err := charset.NewReaderLabel(label, body)
+		if err != nil {
+			decoded = body
+		}
+		return copyText(decoded, out)
+	}
+	return nil
+}
+
+// multipartText walks a multipart body. Of multipart/alternative parts it
+// keeps only the plain-text one (or the first if there is none).
+func multipartText(mediaType, boundary string, body io.Reader, out *TextBuffer, depth int) error {
+	if boundary == "" {
+		return nil
+	}
+	mr := multipart.NewReader(body, boundary)
+	alternative := mediaType == "multipart/alternative"
+
+	type part struct {
+		header mimeHeader
+		body   string
+	}
+	var alternatives []part
+	for !out.Full() {
+		p, err := mr.NextRawPart()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if !alternative {
+			err = mimeText(p.Header, p, out, depth+1)
+			p.Close()
+			if err != nil {
+				return err
+			}
+			out.Break()
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(p, maxMemberBytes))
+		p.Close()
+		if err != nil {
+			return err
+		}
+		alternatives = append(alternatives, part{p.Header, string(data)})
+	}
+	if len(alternatives) == 0 {
+		return nil
+	}
+	chosen := alternatives[0]
+	for _, a := range alternatives {
+		if mt, _, _ := mime.ParseMediaType(a.header.Get("Content-Type")); mt == "text/plain" {
+			chosen = a
+			break
+		}
+	}
+	return mimeText(chosen.header, strings.NewReader(chosen.body), out, depth+1)
+}
+
+func transferDecoder(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// The decoder skips the CR/LF line breaks of the encoded body.
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// copyText feeds r into out until either is exhausted.
+func copyText(r io.Reader, out *TextBuffer) error {
+	buf := make([]byte, 32<<10)
+	var carry []byte
+	for !out.Full() {
+		n, err := r.Read(buf)
+		if n > 0 {
+			chunk := append(carry, buf[:n]...)
+			// Hold back a rune split across reads.
+			cut := len(chunk)
+			for i := len(chunk) - 1; i >= 0 && i >= len(chunk)-utf8.UTFMax; i-- {
+				if utf8.RuneStart(chunk[i]) {
+					if !utf8.FullRune(chunk[i:]) {
+						cut = i
+					}
+					break
+				}
+			}
+			out.WriteString(string(chunk[:cut]))
+			carry = append(carry[:0:0], chunk[cut:]...)
+		}
+		if err != nil {
+			if err == io.EOF {
+				out.WriteString(string(carry))
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
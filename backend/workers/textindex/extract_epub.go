@@ -0,0 +1,120 @@
+package textindex
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// extractEPUB reads the book's spine (the reading order declared in the
+// OPF package document) and converts each XHTML chapter to text. Books
+// without a readable container fall back to every HTML member in name
+// order.
+func extractEPUB(r io.ReaderAt, size int64, out *TextBuffer) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	members := zipMembers(zr)
+
+	chapters := epubSpine(members)
+	if len(chapters) == 0 {
+		for name := range members {
+			switch strings.ToLower(path.Ext(name)) {
+			case ".xhtml", ".html", ".htm":
+				chapters = append(chapters, name)
+			}
+		}
+		sort.Strings(chapters)
+	}
+
+	var errs []error
+	for _, name := range chapters {
+		f := members[name]
+		if f == nil || out.Full() {
+			continue
+		}
+		rc, err := openZipMember(f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := htmlToText(rc, "text/html; charset=utf-8", out); err != nil {
+			errs = append(errs, err)
+		}
+		rc.Close()
+		out.Break()
+	}
+	return errors.Join(errs...)
+}
+
+// epubSpine returns the archive paths of the book's spine items, or nil.
+func epubSpine(members map[string]*zip.File) []string {
+	container := members["META-INF/container.xml"]
+	if container == nil {
+		return nil
+	}
+	var c struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := decodeZipXML(container, &c); err != nil || len(c.Rootfiles) == 0 {
+		return nil
+	}
+	opfPath := c.Rootfiles[0].FullPath
+	opf := members[opfPath]
+	if opf == nil {
+		return nil
+	}
+	var pkg struct {
+		Items []struct {
+			ID        string `xml:"id,attr"`
+			Href      string `xml:"href,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"manifest>item"`
+		Spine []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"spine>itemref"`
+	}
+	if err := decodeZipXML(opf, &pkg); err != nil {
+		return nil
+	}
+
+	hrefs := make(map[string]string, len(pkg.Items))
+	for _, it := range pkg.Items {
+		if strings.Contains(it.MediaType, "html") {
+			hrefs[it.ID] = it.Href
+		}
+	}
+	base := path.Dir(opfPath)
+	var chapters []string
+	for _, ref := range pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		href, _, _ = strings.Cut(href, "#")
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+		chapters = append(chapters, path.Join(base, href))
+	}
+	return chapters
+}
+
+func decodeZipXML(f *zip.File, v any) error {
+	rc, err := openZipMember(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	d := xml.NewDecoder(rc)
+	d.Strict = false
+	return d.Decode(v)
+}
@@ -0,0 +1,83 @@
+package textindex
+
+import (
+	"io"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// htmlSkipped are elements whose content is never visible text.
+var htmlSkipped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Svg: true, atom.Math: true,
+	atom.Iframe: true, atom.Object: true,
+}
+
+// htmlBlocks are elements that start and end a line of text.
+var htmlBlocks = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true,
+	atom.Blockquote: true, atom.Br: true, atom.Caption: true,
+	atom.Dd: true, atom.Div: true, atom.Dl: true, atom.Dt: true,
+	atom.Figcaption: true, atom.Figure: true, atom.Footer: true,
+	atom.Form: true, atom.H1: true, atom.H2: true, atom.H3: true,
+	atom.H4: true, atom.H5: true, atom.H6: true, atom.Header: true,
+	atom.Hr: true, atom.Li: true, atom.Main: true, atom.Nav: true,
+	atom.Ol: true, atom.P: true, atom.Pre: true, atom.Section: true,
+	atom.Table: true, atom.Title: true, atom.Tr: true, atom.Ul: true,
+}
+
+func extractHTML(r io.ReaderAt, size int64, out *TextBuffer) error {
+	return htmlToText(io.NewSectionReader(r, 0, size), "", out)
+}
+
+// htmlToText writes the visible text of an HTML document to out.
+// contentType, if known, names the charset; otherwise it is sniffed from
+// the document (<meta charset>, BOM), defaulting to UTF-8-or-Windows-1252.
+func htmlToText(r io.Reader, contentType string, out *TextBuffer) error {
+	decoded, err := charset.NewReader(r, contentType)
+	if err != nil {
+		return err
+	}
+
+	z := html.NewTokenizer(decoded)
+	skipDepth := 0
+	for !out.Full() {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return nil
+			}
+			return z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			if htmlSkipped[a] && tt == html.StartTagToken {
+				skipDepth++
+			}
+			if htmlBlocks[a] {
+				out.Break()
+			} else if a == atom.Td || a == atom.Th {
+				out.Space()
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			if htmlSkipped[a] && skipDepth > 0 {
+				skipDepth--
+			}
+			if htmlBlocks[a] {
+				out.Break()
+			} else if a == atom.Td || a == atom.Th {
+				out.Space()
+			}
+		case html.TextToken:
+			if skipDepth == 0 {
+				out.WriteString(string(z.Text()))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package textindex
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// xmlTextSpec says which elements of an XML part carry text. Elements are
+// matched by local name, ignoring namespaces.
+type xmlTextSpec struct {
+	text   map[string]bool // character data inside these is text
+	breaks map[string]bool // end of these ends a line
+	spaces map[string]bool // these separate words (tabs, cells)
+}
+
+var (
+	docxSpec = xmlTextSpec{
+		text:   map[string]bool{"t": true},
+		breaks: map[string]bool{"p": true, "br": true, "cr": true, "tr": true},
+		spaces: map[string]bool{"tab": true, "tc": true},
+	}
+	pptxSpec = xmlTextSpec{
+		text:   map[string]bool{"t": true},
+		breaks: map[string]bool{"p": true, "br": true},
+		spaces: map[string]bool{"tc": true},
+	}
+	// Shared strings (<si><t>) and inline cell strings (<is><t>).
+	xlsxSpec = xmlTextSpec{
+		text:   map[string]bool{"t": true},
+		breaks: map[string]bool{"si": true, "row": true},
+		spaces: map[string]bool{"is": true},
+	}
+)
+
+// xmlText writes the text of one XML document to out according to spec.
+func xmlText(r io.Reader, spec xmlTextSpec, out *TextBuffer) error {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	inText := 0
+	for !out.Full() {
+		tok, err := d.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if spec.text[t.Name.Local] {
+				inText++
+			}
+		case xml.EndElement:
+			name := t.Name.Local
+			switch {
+			case spec.text[name] && inText > 0:
+				inText--
+			case spec.breaks[name]:
+				out.Break()
+			case spec.spaces[name]:
+				out.Space()
+			}
+		case xml.CharData:
+			if inText > 0 {
+				out.WriteString(string(t))
+			}
+		}
+	}
+	return nil
+}
+
+// zipMembers indexes an archive's members by name.
+func zipMembers(zr *zip.Reader) map[string]*zip.File {
+	m := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		m[f.Name] = f
+	}
+	return m
+}
+
+// openZipMember opens f with its inflated size capped at maxMemberBytes.
+func openZipMember(f *zip.File) (io.ReadCloser, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, maxMemberBytes), rc}, nil
+}
+
+// zipXMLText runs xmlText over each named member that exists, in order,
+// with a line break between members.
+func zipXMLText(members map[string]*zip.File, names []string, spec xmlTextSpec, out *TextBuffer) error {
+	var errs []error
+	for _, name := range names {
+		f := members[name]
+		if f == nil || out.Full() {
+			continue
+		}
+		rc, err := openZipMember(f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := xmlText(rc, spec, out); err != nil {
+			errs = append(errs, err)
+		}
+		rc.Close()
+		out.Break()
+	}
+	return errors.Join(errs...)
+}
+
+// numberedMembers returns the members named prefix<N>.xml in numeric
+// order (slide1, slide2, …, slide10).
+func numberedMembers(members map[string]*zip.File, prefix string) []string {
+	type numbered struct {
+		n    int
+		name string
+	}
+	var found []numbered
+	for name := range members {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		num, ok := strings.CutSuffix(rest, ".xml")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(num); err == nil {
+			found = append(found, numbered{n, name})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].n < found[j].n })
+	names := make([]string, len(found))
+	for i, f := range found {
+		names[i] = f.name
+	}
+	return names
+}
+
+func extractDOCX(r io.ReaderAt, size int64, out *TextBuffer) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	members := zipMembers(zr)
+	names := []string{"word/document.xml"}
+	names = append(names, numberedMembers(members, "word/header")...)
+	names = append(names, numberedMembers(members, "word/footer")...)
+	names = append(names, "word/footnotes.xml", "word/endnotes.xml", "word/comments.xml")
+	return zipXMLText(members, names, docxSpec, out)
+}
+
+func extractPPTX(r io.ReaderAt, size int64, out *TextBuffer) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	members := zipMembers(zr)
+	var names []string
+	for _, slide := range numberedMembers(members, "ppt/slides/slide") {
+		names = append(names, slide)
+		// Speaker notes follow their slide.
+		n := strings.TrimSuffix(strings.TrimPrefix(slide, "ppt/slides/slide"), ".xml")
+		names = append(names, "ppt/notesSlides/notesSlide"+n+".xml")
+	}
+	return zipXMLText(members, names, pptxSpec, out)
+}
+
+func extractXLSX(r io.ReaderAt, size int64, out *TextBuffer) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	members := zipMembers(zr)
+
+	// Sheet names, then every distinct cell string, then inline strings.
+	var errs []error
+	if f := members["xl/workbook.xml"]; f != nil {
+		if err := xlsxSheetNames(f, out); err != nil {
+			errs = append(errs, err)
+		}
+		out.Break()
+	}
+	names := append([]string{"xl/sharedStrings.xml"}, numberedMembers(members, "xl/worksheets/sheet")...)
+	if err := zipXMLText(members, names, xlsxSpec, out); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func xlsxSheetNames(f *zip.File, out *TextBuffer) error {
+	rc, err := openZipMember(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	d := xml.NewDecoder(rc)
+	d.Strict = false
+	for {
+		tok, err := d.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "sheet" {
+			for _, a := range se.Attr {
+				if a.Name.Local == "name" {
+					out.WriteString(a.Value)
+					out.Break()
+				}
+			}
+		}
+	}
+}
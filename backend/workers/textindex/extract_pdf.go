@@ -0,0 +1,1007 @@
+package textindex
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// A minimal, tolerant PDF reader for text layers.
+//
+// It does not trust the cross-reference table: objects are found by
+// scanning for "N G obj" headers (plus the members of object streams),
+// which also copes with damaged files and incremental updates. Text comes
+// from the page content streams — Tj/TJ/'/" operators, decoded through the
+// font's ToUnicode CMap where there is one and WinAnsi otherwise. Scanned
+// pages without a text layer yield nothing; encrypted documents are not
+// supported.
+
+// maxPDFNesting bounds array/dict nesting and form XObject recursion.
+const maxPDFNesting = 64
+
+var (
+	pdfObjHeaderRE = regexp.MustCompile(`(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+obj\b`)
+	pdfRootRE      = regexp.MustCompile(`/Root[ \t\r\n\f\x00]*(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+R`)
+	pdfInfoRE      = regexp.MustCompile(`/Info[ \t\r\n\f\x00]*(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+R`)
+	pdfEncryptRE   = regexp.MustCompile(`/Encrypt[ \t\r\n\f\x00]*(<<|\d+[ \t\r\n\f\x00]+\d+[ \t\r\n\f\x00]+R)`)
+)
+
+var errPDFEncrypted = errors.New("encrypted PDF")
+
+type (
+	pdfName    string
+	pdfKeyword string // operators and other bare words
+	pdfString  []byte // literal or hex string, undecoded
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		raw  []byte
+	}
+)
+
+func extractPDF(r io.ReaderAt, size int64, out *TextBuffer) error {
+	// The parser needs random access to the whole file; map it rather
+	// than copy up to MaxFileSize onto the heap.
+	data, release, err := mapReaderAt(r, size)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if pdfEncryptRE.Match(data) {
+		return errPDFEncrypted
+	}
+
+	d := newPDFDoc(data)
+
+	if info := d.dict(d.trailerRef(pdfInfoRE)); info != nil {
+		for _, key := range []pdfName{"Title", "Author", "Subject", "Keywords"} {
+			if s, ok := d.resolve(info[key]).(pdfString); ok {
+				out.WriteString(pdfTextString(s))
+				out.Break()
+			}
+		}
+	}
+
+	var errs []error
+	for _, page := range d.pages() {
+		if out.Full() {
+			break
+		}
+		content, err := d.pageContent(page.dict)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		d.runContent(content, page.resources, out, 0)
+		out.Break()
+	}
+	return errors.Join(errs...)
+}
+
+// ---- lexer / object parser ----
+
+type pdfLexer struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPDFSpace(c) {
+			l.pos++
+		} else if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+// token returns the next token: float64, pdfName, pdfString or
+// pdfKeyword (including the delimiters "[", "]", "<<", ">>", "{", "}").
+func (l *pdfLexer) token() (any, bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false
+	}
+	c := l.data[l.pos]
+	switch c {
+	case '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfName(decodePDFName(l.data[start:l.pos])), true
+	case '(':
+		return l.literalString(), true
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), true
+		}
+		return l.hexString(), true
+	case '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>"), true
+		}
+		l.pos++
+		return pdfKeyword(">"), true
+	case '[', ']', '{', '}', ')':
+		l.pos++
+		return pdfKeyword(string(c)), true
+	}
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9') {
+		if f, err := strconv.ParseFloat(word, 64); err == nil {
+			return f, true
+		}
+	}
+	return pdfKeyword(word), true
+}
+
+func decodePDFName(b []byte) string {
+	if bytes.IndexByte(b, '#') < 0 {
+		return string(b)
+	}
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == '#' && i+2 < len(b) {
+			if v, err := strconv.ParseUint(string(b[i+1:i+3]), 16, 8); err == nil {
+				out = append(out, byte(v))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, b[i])
+	}
+	return string(out)
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // (
+	var out []byte
+	nest := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			nest++
+		case ')':
+			if nest--; nest == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (l *pdfLexer) hexString() pdfString {
+	l.pos++ // <
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++ // >
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	n, _ := hex.Decode(out, digits)
+	return out[:n]
+}
+
+// object parses one complete object: arrays, dicts, and "N G R"
+// references are assembled; true/false/null become Go values; any other
+// keyword is returned as is.
+func (l *pdfLexer) object() (any, bool) {
+	tok, ok := l.token()
+	if !ok {
+		return nil, false
+	}
+	switch t := tok.(type) {
+	case float64:
+		if t >= 0 && t == math.Trunc(t) {
+			save := l.pos
+			if gen, ok := l.token(); ok {
+				if g, isNum := gen.(float64); isNum && g >= 0 && g == math.Trunc(g) {
+					if r, ok := l.token(); ok && r == pdfKeyword("R") {
+						return pdfRef{int(t), int(g)}, true
+					}
+				}
+			}
+			l.pos = save
+		}
+		return t, true
+	case pdfKeyword:
+		switch t {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		case "null":
+			return nil, true
+		case "[":
+			if l.depth++; l.depth > maxPDFNesting {
+				l.depth--
+				return nil, false
+			}
+			defer func() { l.depth-- }()
+			var arr pdfArray
+			for {
+				o, ok := l.object()
+				if !ok || o == pdfKeyword("]") {
+					return arr, true
+				}
+				arr = append(arr, o)
+			}
+		case "<<":
+			if l.depth++; l.depth > maxPDFNesting {
+				l.depth--
+				return nil, false
+			}
+			defer func() { l.depth-- }()
+			dict := pdfDict{}
+			for {
+				k, ok := l.object()
+				if !ok || k == pdfKeyword(">>") {
+					return dict, true
+				}
+				name, isName := k.(pdfName)
+				if !isName {
+					continue
+				}
+				v, ok := l.object()
+				if !ok || v == pdfKeyword(">>") {
+					return dict, true
+				}
+				dict[name] = v
+			}
+		}
+	}
+	return tok, true
+}
+
+// ---- document ----
+
+type pdfDoc struct {
+	data  []byte
+	objs  map[int]any
+	fonts map[int]*pdfFont // by font object number
+}
+
+func newPDFDoc(data []byte) *pdfDoc {
+	d := &pdfDoc{data: data, objs: make(map[int]any), fonts: make(map[int]*pdfFont)}
+
+	// Later definitions win, as with incremental updates.
+	for _, m := range pdfObjHeaderRE.FindAllSubmatchIndex(data, -1) {
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		l := &pdfLexer{data: data, pos: m[1]}
+		obj, ok := l.object()
+		if !ok {
+			continue
+		}
+		if dict, isDict := obj.(pdfDict); isDict {
+			if raw, ok := d.streamData(l, dict); ok {
+				obj = &pdfStream{dict: dict, raw: raw}
+			}
+		}
+		d.objs[num] = obj
+	}
+
+	// Members of object streams fill in numbers not defined directly.
+	for _, obj := range d.objs {
+		s, ok := obj.(*pdfStream)
+		if !ok || s.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		d.expandObjStm(s)
+	}
+	return d
+}
+
+// streamData returns the raw bytes of the stream following dict, if the
+// lexer is positioned at a "stream" keyword.
+func (d *pdfDoc) streamData(l *pdfLexer, dict pdfDict) ([]byte, bool) {
+	l.skipSpace()
+	if !bytes.HasPrefix(d.data[l.pos:], []byte("stream")) {
+		return nil, false
+	}
+	start := l.pos + len("stream")
+	if start < len(d.data) && d.data[start] == '\r' {
+		start++
+	}
+	if start < len(d.data) && d.data[start] == '\n' {
+		start++
+	}
+	// Trust /Length when it is direct and lands on "endstream".
+	if n, ok := dict["Length"].(float64); ok && n >= 0 && start+int(n) <= len(d.data) {
+		end := start + int(n)
+		rest := bytes.TrimLeft(d.data[end:min(end+16, len(d.data))], " \r\n\t\f\x00")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			return d.data[start:end], true
+		}
+	}
+	end := bytes.Index(d.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil, false
+	}
+	raw := d.data[start : start+end]
+	raw = bytes.TrimSuffix(raw, []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	return raw, true
+}
+
+func (d *pdfDoc) expandObjStm(s *pdfStream) {
+	data, err := d.decodeStream(s)
+	if err != nil {
+		return
+	}
+	n, _ := s.dict["N"].(float64)
+	first, _ := s.dict["First"].(float64)
+	if n <= 0 || first < 0 || int(first) > len(data) {
+		return
+	}
+	header := &pdfLexer{data: data[:int(first)]}
+	for i := 0; i < int(n); i++ {
+		numTok, ok1 := header.token()
+		offTok, ok2 := header.token()
+		num, isNum := numTok.(float64)
+		off, isOff := offTok.(float64)
+		if !ok1 || !ok2 || !isNum || !isOff {
+			return
+		}
+		if _, exists := d.objs[int(num)]; exists {
+			continue
+		}
+		pos := int(first) + int(off)
+		if pos < 0 || pos >= len(data) {
+			continue
+		}
+		l := &pdfLexer{data: data, pos: pos}
+		if obj, ok := l.object(); ok {
+			d.objs[int(num)] = obj
+		}
+	}
+}
+
+// trailerRef finds the last "/Key N G R" matching re (trailer dictionaries
+// and cross-reference streams are never compressed).
+func (d *pdfDoc) trailerRef(re *regexp.Regexp) any {
+	all := re.FindAllSubmatch(d.data, -1)
+	if len(all) == 0 {
+		return nil
+	}
+	m := all[len(all)-1]
+	num, _ := strconv.Atoi(string(m[1]))
+	gen, _ := strconv.Atoi(string(m[2]))
+	return pdfRef{num, gen}
+}
+
+func (d *pdfDoc) resolve(o any) any {
+	for i := 0; i < 32; i++ {
+		ref, ok := o.(pdfRef)
+		if !ok {
+			return o
+		}
+		o = d.objs[ref.num]
+	}
+	return nil
+}
+
+// dict resolves o to a dictionary (a stream's dictionary counts).
+func (d *pdfDoc) dict(o any) pdfDict {
+	switch v := d.resolve(o).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+func (d *pdfDoc) decodeStream(s *pdfStream) ([]byte, error) {
+	var filters []any
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{f}
+	case pdfArray:
+		filters = f
+	}
+	data := s.raw
+	for _, f := range filters {
+		name, _ := d.resolve(f).(pdfName)
+		var r io.Reader
+		switch name {
+		case "FlateDecode", "Fl":
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				r = flate.NewReader(bytes.NewReader(data))
+			} else {
+				r = zr
+			}
+		case "ASCIIHexDecode", "AHx":
+			l := &pdfLexer{data: append(append([]byte{'<'}, data...), '>')}
+			data = l.hexString()
+			continue
+		case "ASCII85Decode", "A85":
+			trimmed := bytes.TrimSpace(data)
+			trimmed = bytes.TrimPrefix(trimmed, []byte("<~"))
+			trimmed = bytes.TrimSuffix(trimmed, []byte("~>"))
+			r = ascii85.NewDecoder(bytes.NewReader(trimmed))
+		default:
+			return nil, fmt.Errorf("unsupported PDF filter %q", name)
+		}
+		// Corrupt deflate data often still yields a usable prefix.
+		decoded, err := io.ReadAll(io.LimitReader(r, maxMemberBytes))
+		if err != nil && len(decoded) == 0 {
+			return nil, err
+		}
+		data = decoded
+	}
+	return data, nil
+}
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages returns the pages in reading order, walking the page tree from the
+// document catalog. Documents with no usable tree fall back to every page
+// object in object-number order.
+func (d *pdfDoc) pages() []pdfPage {
+	var pages []pdfPage
+	visited := make(map[any]bool)
+	var walk func(node any, inherited pdfDict, depth int)
+	walk = func(node any, inherited pdfDict, depth int) {
+		if depth > maxPDFNesting {
+			return
+		}
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref] {
+				return
+			}
+			visited[ref] = true
+		}
+		dict := d.dict(node)
+		if dict == nil {
+			return
+		}
+		res := inherited
+		if r := d.dict(dict["Resources"]); r != nil {
+			res = r
+		}
+		if kids, ok := d.resolve(dict["Kids"]).(pdfArray); ok {
+			for _, kid := range kids {
+				walk(kid, res, depth+1)
+			}
+			return
+		}
+		pages = append(pages, pdfPage{dict: dict, resources: res})
+	}
+
+	root := d.dict(d.trailerRef(pdfRootRE))
+	if root == nil {
+		for _, obj := range d.objs {
+			if dict, ok := obj.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+				root = dict
+				break
+			}
+		}
+	}
+	if root != nil {
+		walk(root["Pages"], nil, 0)
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	nums := make([]int, 0, len(d.objs))
+	for num, obj := range d.objs {
+		if dict, ok := obj.(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		dict := d.objs[num].(pdfDict)
+		pages = append(pages, pdfPage{dict: dict, resources: d.dict(dict["Resources"])})
+	}
+	return pages
+}
+
+// pageContent concatenates a page's content streams.
+func (d *pdfDoc) pageContent(page pdfDict) ([]byte, error) {
+	var streams []any
+	switch c := d.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		streams = []any{c}
+	case pdfArray:
+		streams = c
+	}
+	var content []byte
+	var errs []error
+	for _, s := range streams {
+		stream, ok := d.resolve(s).(*pdfStream)
+		if !ok {
+			continue
+		}
+		data, err := d.decodeStream(stream)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		content = append(content, data...)
+		content = append(content, '\n')
+	}
+	return content, errors.Join(errs...)
+}
+
+// runContent interprets a content stream's text operators.
+func (d *pdfDoc) runContent(content []byte, res pdfDict, out *TextBuffer, depth int) {
+	if depth > maxPDFNesting/8 {
+		return
+	}
+	var fonts pdfDict
+	if res != nil {
+		fonts = d.dict(res["Font"])
+	}
+	var font *pdfFont
+	show := func(o any) {
+		if s, ok := o.(pdfString); ok {
+			out.WriteString(font.decode(s))
+		}
+	}
+
+	l := &pdfLexer{data: content}
+	var operands []any
+	for !out.Full() {
+		o, ok := l.object()
+		if !ok {
+			return
+		}
+		op, isOp := o.(pdfKeyword)
+		if !isOp {
+			if len(operands) >= 64 {
+				operands = operands[1:]
+			}
+			operands = append(operands, o)
+			continue
+		}
+		last := func() any {
+			if len(operands) == 0 {
+				return nil
+			}
+			return operands[len(operands)-1]
+		}
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					font = d.font(fonts[name])
+				}
+			}
+		case "Tj":
+			show(last())
+		case "'", "\"":
+			out.Break()
+			show(last())
+		case "TJ":
+			arr, _ := last().(pdfArray)
+			for _, item := range arr {
+				if n, ok := item.(float64); ok {
+					// A large negative adjustment is a word gap.
+					if n < -200 {
+						out.Space()
+					}
+					continue
+				}
+				show(item)
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty, ok := operands[len(operands)-1].(float64); ok && ty != 0 {
+					out.Break()
+				} else {
+					out.Space()
+				}
+			}
+		case "T*", "ET":
+			out.Break()
+		case "Tm":
+			out.Space()
+		case "ID":
+			l.skipInlineImage()
+		case "Do":
+			name, _ := last().(pdfName)
+			if res == nil || name == "" {
+				break
+			}
+			xobj, ok := d.resolve(d.dict(res["XObject"])[name]).(*pdfStream)
+			if !ok || xobj.dict["Subtype"] != pdfName("Form") {
+				break
+			}
+			data, err := d.decodeStream(xobj)
+			if err != nil {
+				break
+			}
+			formRes := res
+			if r := d.dict(xobj.dict["Resources"]); r != nil {
+				formRes = r
+			}
+			d.runContent(data, formRes, out, depth+1)
+		}
+		operands = operands[:0]
+	}
+}
+
+// skipInlineImage moves past inline image data (after "ID") to its "EI".
+func (l *pdfLexer) skipInlineImage() {
+	for i := l.pos + 1; i+2 < len(l.data); i++ {
+		if l.data[i] == 'E' && l.data[i+1] == 'I' && isPDFSpace(l.data[i-1]) &&
+			(i+2 == len(l.data) || isPDFSpace(l.data[i+2])) {
+			l.pos = i + 2
+			return
+		}
+	}
+	l.pos = len(l.data)
+}
+
+// ---- fonts ----
+
+type pdfFont struct {
+	cmap      *pdfCMap
+	composite bool          // Type0: multi-byte codes
+	encoding  map[byte]rune // simple fonts: overrides of WinAnsi
+}
+
+func (d *pdfDoc) font(o any) *pdfFont {
+	ref, isRef := o.(pdfRef)
+	if isRef {
+		if f, ok := d.fonts[ref.num]; ok {
+			return f
+		}
+	}
+	fd := d.dict(o)
+	if fd == nil {
+		return nil
+	}
+	f := &pdfFont{composite: fd["Subtype"] == pdfName("Type0")}
+	if s, ok := d.resolve(fd["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decodeStream(s); err == nil {
+			f.cmap = parseCMap(data)
+		}
+	}
+	if enc := d.dict(fd["Encoding"]); enc != nil {
+		if diffs, ok := d.resolve(enc["Differences"]).(pdfArray); ok {
+			f.encoding = make(map[byte]rune)
+			code := 0
+			for _, item := range diffs {
+				switch v := item.(type) {
+				case float64:
+					code = int(v)
+				case pdfName:
+					if r, ok := glyphRune(string(v)); ok && code >= 0 && code < 256 {
+						f.encoding[byte(code)] = r
+					}
+					code++
+				}
+			}
+		}
+	}
+	if isRef {
+		d.fonts[ref.num] = f
+	}
+	return f
+}
+
+// decode converts a shown string to text. A nil font decodes as WinAnsi.
+func (f *pdfFont) decode(s pdfString) string {
+	var b []rune
+	if f == nil || f.cmap == nil {
+		if f != nil && f.composite {
+			return "" // glyph ids with no Unicode mapping
+		}
+		for _, c := range s {
+			b = append(b, f.simpleRune(c))
+		}
+		return string(b)
+	}
+
+	var out []byte
+	for i := 0; i < len(s); {
+		n := f.cmap.codeLen(s[i:], f.composite)
+		code := string(s[i:min(i+n, len(s))])
+		i += n
+		if u, ok := f.cmap.chars[code]; ok {
+			out = append(out, u...)
+		} else if !f.composite && len(code) == 1 {
+			out = append(out, string(f.simpleRune(code[0]))...)
+		}
+	}
+	return string(out)
+}
+
+func (f *pdfFont) simpleRune(c byte) rune {
+	if f != nil {
+		if r, ok := f.encoding[c]; ok {
+			return r
+		}
+	}
+	if c >= 0x80 && c < 0xA0 {
+		return winAnsiHigh[c-0x80]
+	}
+	return rune(c)
+}
+
+// winAnsiHigh maps WinAnsiEncoding (Windows-1252) 0x80–0x9F; the rest of
+// the range coincides with Latin-1.
+var winAnsiHigh = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// glyphNames covers the Adobe glyph names common in /Differences arrays
+// that aren't a single character or uniXXXX.
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$',
+	"percent": '%', "ampersand": '&', "quotesingle": '\'', "parenleft": '(',
+	"parenright": ')', "asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-',
+	"period": '.', "slash": '/', "colon": ':', "semicolon": ';', "less": '<',
+	"equal": '=', "greater": '>', "question": '?', "at": '@', "bracketleft": '[',
+	"backslash": '\\', "bracketright": ']', "underscore": '_', "braceleft": '{',
+	"bar": '|', "braceright": '}', "zero": '0', "one": '1', "two": '2',
+	"three": '3', "four": '4', "five": '5', "six": '6', "seven": '7',
+	"eight": '8', "nine": '9', "quoteleft": '‘', "quoteright": '’',
+	"quotedblleft": '“', "quotedblright": '”', "endash": '–', "emdash": '—',
+	"bullet": '•', "ellipsis": '…', "fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ',
+	"nbspace": ' ', "minus": '−', "degree": '°', "copyright": '©',
+	"registered": '®', "trademark": '™', "Euro": '€',
+}
+
+func glyphRune(name string) (rune, bool) {
+	if r, ok := glyphNames[name]; ok {
+		return r, true
+	}
+	if len(name) == 1 {
+		return rune(name[0]), true
+	}
+	if len(name) == 7 && name[:3] == "uni" {
+		if v, err := strconv.ParseUint(name[3:], 16, 16); err == nil {
+			return rune(v), true
+		}
+	}
+	return 0, false
+}
+
+// ---- ToUnicode CMaps ----
+
+// maxCMapRange bounds how many codes one bfrange may expand to.
+const maxCMapRange = 1 << 16
+
+type pdfCMap struct {
+	ranges []cmapRange       // codespace ranges
+	chars  map[string]string // code bytes → UTF-8
+}
+
+type cmapRange struct{ lo, hi []byte }
+
+// codeLen returns the byte length of the code at the start of s.
+func (c *pdfCMap) codeLen(s []byte, composite bool) int {
+	for _, r := range c.ranges {
+		n := len(r.lo)
+		if n == 0 || n > len(s) || len(r.hi) != n {
+			continue
+		}
+		in := true
+		for i := 0; i < n; i++ {
+			if s[i] < r.lo[i] || s[i] > r.hi[i] {
+				in = false
+				break
+			}
+		}
+		if in {
+			return n
+		}
+	}
+	if composite {
+		return 2
+	}
+	return 1
+}
+
+func parseCMap(data []byte) *pdfCMap {
+	c := &pdfCMap{chars: make(map[string]string)}
+	l := &pdfLexer{data: data}
+	next := func() (any, bool) { return l.object() }
+	for {
+		tok, ok := next()
+		if !ok {
+			return c
+		}
+		switch tok {
+		case pdfKeyword("begincodespacerange"):
+			for {
+				lo, ok1 := next()
+				if !ok1 || lo == pdfKeyword("endcodespacerange") {
+					break
+				}
+				hi, _ := next()
+				los, ok2 := lo.(pdfString)
+				his, ok3 := hi.(pdfString)
+				if ok2 && ok3 {
+					c.ranges = append(c.ranges, cmapRange{los, his})
+				}
+			}
+		case pdfKeyword("beginbfchar"):
+			for {
+				src, ok1 := next()
+				if !ok1 || src == pdfKeyword("endbfchar") {
+					break
+				}
+				dst, _ := next()
+				s, ok2 := src.(pdfString)
+				u, ok3 := dst.(pdfString)
+				if ok2 && ok3 {
+					c.chars[string(s)] = utf16BE(u)
+				}
+			}
+		case pdfKeyword("beginbfrange"):
+			for {
+				lo, ok1 := next()
+				if !ok1 || lo == pdfKeyword("endbfrange") {
+					break
+				}
+				hi, _ := next()
+				dst, _ := next()
+				los, ok2 := lo.(pdfString)
+				his, ok3 := hi.(pdfString)
+				if !ok2 || !ok3 || len(los) != len(his) || len(los) == 0 || len(los) > 4 {
+					continue
+				}
+				c.addRange(los, his, dst)
+			}
+		}
+	}
+}
+
+func (c *pdfCMap) addRange(lo, hi pdfString, dst any) {
+	n := len(lo)
+	from, to := beUint(lo), beUint(hi)
+	if to < from || to-from >= maxCMapRange {
+		return
+	}
+	// Count in uint64: with to == 0xFFFFFFFF a uint32 code would wrap
+	// instead of passing to, and the loop would never end.
+	for c64 := uint64(from); c64 <= uint64(to); c64++ {
+		code := uint32(c64)
+		key := make([]byte, n)
+		for i := n - 1; i >= 0; i-- {
+			key[i] = byte(code >> (8 * (n - 1 - i)))
+		}
+		offset := code - from
+		switch v := dst.(type) {
+		case pdfString:
+			// Successive codes map to successive values of the last
+			// UTF-16 unit.
+			u := append([]byte(nil), v...)
+			if len(u) >= 2 {
+				last := uint32(u[len(u)-2])<<8 | uint32(u[len(u)-1])
+				last += offset
+				u[len(u)-2], u[len(u)-1] = byte(last>>8), byte(last)
+			}
+			c.chars[string(key)] = utf16BE(u)
+		case pdfArray:
+			if int(offset) < len(v) {
+				if u, ok := v[offset].(pdfString); ok {
+					c.chars[string(key)] = utf16BE(u)
+				}
+			}
+		}
+	}
+}
+
+func beUint(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func utf16BE(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// pdfTextString decodes a document-level text string: UTF-16BE with a BOM,
+// or PDFDocEncoding (treated as WinAnsi).
+func pdfTextString(s pdfString) string {
+	if len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF {
+		return utf16BE(s[2:])
+	}
+	if bytes.HasPrefix(s, []byte("\xEF\xBB\xBF")) {
+		return string(s[3:])
+	}
+	return (*pdfFont)(nil).decode(s)
+}
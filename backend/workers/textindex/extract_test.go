@@ -0,0 +1,271 @@
+package textindex
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func zipBytes(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func extractBytes(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	format := DefaultRegistry().Lookup(name, "")
+	if format == nil {
+		t.Fatalf("no format for %s", name)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return ExtractFile(format, path)
+}
+
+func assertContains(t *testing.T, got string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("extracted text %q does not contain %q", got, w)
+		}
+	}
+}
+
+// buildPDF assembles a PDF from numbered object bodies (object i+1 is
+// objs[i]), with a catalog as object 1.
+func buildPDF(objs []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	for i, body := range objs {
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	buf.WriteString("trailer\n<< /Root 1 0 R /Info 6 0 R >>\n%%EOF\n")
+	return buf.Bytes()
+}
+
+func pdfStreamObj(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func TestExtractPDF_SimpleFont(t *testing.T) {
+	content := []byte("BT /F1 12 Tf 72 720 Td (Invoice from ACME) Tj 0 -14 Td [(Total) -300 (due)] TJ ET")
+	data := buildPDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << /F1 5 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		pdfStreamObj("", content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Title (Q3 \\(draft\\)) >>",
+	})
+	got := extractBytes(t, "invoice.pdf", data)
+	assertContains(t, got, "Q3 (draft)", "Invoice from ACME", "Total due")
+}
+
+func TestExtractPDF_CompressedCIDFontWithToUnicode(t *testing.T) {
+	cmap := []byte(`/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar <0001> <0048> <0002> <0069> endbfchar
+2 beginbfrange <0010> <0011> [<6587> <6863>] <0020> <0021> <0041> endbfrange
+endcmap`)
+	content := []byte("BT /C1 10 Tf <00010002> Tj T* <00100011> Tj T* <00200021> Tj ET")
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(content)
+	zw.Close()
+
+	data := buildPDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /C1 5 0 R >> >> >>",
+		pdfStreamObj("/Filter /FlateDecode", z.Bytes()),
+		"<< /Type /Font /Subtype /Type0 /Encoding /Identity-H /ToUnicode 7 0 R >>",
+		"<< >>",
+		pdfStreamObj("", cmap),
+	})
+	got := extractBytes(t, "scan.pdf", data)
+	assertContains(t, got, "Hi", "文档", "AB")
+}
+
+func TestParseCMap_RangeAtTopOfCodeSpace(t *testing.T) {
+	// A bfrange ending at 0xFFFFFFFF used to wrap its uint32 counter and
+	// never finish.
+	done := make(chan *pdfCMap, 1)
+	go func() {
+		done <- parseCMap([]byte("1 beginbfrange <FFFFFFFE> <FFFFFFFF> <0041> endbfrange"))
+	}()
+	select {
+	case c := <-done:
+		if got := c.chars["\xff\xff\xff\xff"]; got != "B" {
+			t.Errorf("last code maps to %q, want %q", got, "B")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("parseCMap did not finish")
+	}
+}
+
+func TestExtractPDF_EncryptedIsSkipped(t *testing.T) {
+	data := []byte("%PDF-1.4\ntrailer\n<< /Root 1 0 R /Encrypt 9 0 R >>\n")
+	if got := extractBytes(t, "locked.pdf", data); got != "" {
+		t.Errorf("got %q, want nothing from an encrypted PDF", got)
+	}
+}
+
+func TestExtractDOCX(t *testing.T) {
+	data := zipBytes(t, map[string]string{
+		"word/document.xml": `<?xml version="1.0"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>Lease</w:t></w:r><w:r><w:t xml:space="preserve"> agreement</w:t></w:r></w:p>
+<w:p><w:r><w:t>Tenant</w:t><w:tab/><w:t>Jane</w:t></w:r></w:p>
+</w:body></w:document>`,
+		"word/footer1.xml": `<w:ftr xmlns:w="x"><w:p><w:r><w:t>Page footer</w:t></w:r></w:p></w:ftr>`,
+	})
+	got := extractBytes(t, "lease.docx", data)
+	assertContains(t, got, "Lease agreement\nTenant Jane", "Page footer")
+}
+
+func TestExtractXLSX(t *testing.T) {
+	data := zipBytes(t, map[string]string{
+		"xl/workbook.xml":      `<workbook><sheets><sheet name="Budget 2024" sheetId="1"/></sheets></workbook>`,
+		"xl/sharedStrings.xml": `<sst><si><t>Groceries</t></si><si><r><t>Rent</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData><row><c t="inlineStr"><is><t>Utilities</t></is></c>` +
+			`<c><v>42</v></c></row></sheetData></worksheet>`,
+	})
+	got := extractBytes(t, "budget.xlsx", data)
+	assertContains(t, got, "Budget 2024", "Groceries", "Rent", "Utilities")
+}
+
+func TestExtractPPTX_SlidesInOrder(t *testing.T) {
+	slide := func(text string) string {
+		return `<p:sld xmlns:p="p" xmlns:a="a"><p:txBody><a:p><a:r><a:t>` + text + `</a:t></a:r></a:p></p:txBody></p:sld>`
+	}
+	data := zipBytes(t, map[string]string{
+		"ppt/slides/slide10.xml":          slide("Ten"),
+		"ppt/slides/slide2.xml":           slide("Two"),
+		"ppt/slides/slide1.xml":           slide("One"),
+		"ppt/notesSlides/notesSlide2.xml": slide("Speaker note"),
+	})
+	got := extractBytes(t, "deck.pptx", data)
+	if i, j, k := strings.Index(got, "One"), strings.Index(got, "Two"), strings.Index(got, "Ten"); !(i >= 0 && i < j && j < k) {
+		t.Errorf("slides out of order: %q", got)
+	}
+	assertContains(t, got, "Speaker note")
+}
+
+func TestExtractEPUB_FollowsSpine(t *testing.T) {
+	data := zipBytes(t, map[string]string{
+		"mimetype":               "application/epub+zip",
+		"META-INF/container.xml": `<container><rootfiles><rootfile full-path="OEBPS/content.opf"/></rootfiles></container>`,
+		"OEBPS/content.opf": `<package><manifest>
+<item id="c1" href="ch%201.xhtml" media-type="application/xhtml+xml"/>
+<item id="c2" href="text/ch2.xhtml" media-type="application/xhtml+xml"/>
+<item id="css" href="style.css" media-type="text/css"/>
+</manifest><spine><itemref idref="c2"/><itemref idref="c1"/></spine></package>`,
+		"OEBPS/ch 1.xhtml":     `<html><body><p>Second chapter</p></body></html>`,
+		"OEBPS/text/ch2.xhtml": `<html><head><style>p{}</style></head><body><h1>Opening</h1></body></html>`,
+		"OEBPS/style.css":      `p { color: red }`,
+	})
+	got := extractBytes(t, "book.epub", data)
+	if i, j := strings.Index(got, "Opening"), strings.Index(got, "Second chapter"); i < 0 || j < 0 || i > j {
+		t.Errorf("spine order not followed: %q", got)
+	}
+	if strings.Contains(got, "color") || strings.Contains(got, "p{}") {
+		t.Errorf("stylesheet text leaked: %q", got)
+	}
+}
+
+func TestExtractHTML(t *testing.T) {
+	data := []byte(`<!doctype html><html><head><title>Recipe</title><script>var x = "hidden";</script></head>
+<body><h1>Pancakes</h1><p>Mix&nbsp;flour &amp; milk.</p><table><tr><td>Eggs</td><td>2</td></tr></table></body></html>`)
+	got := extractBytes(t, "recipe.html", data)
+	assertContains(t, got, "Recipe", "Pancakes", "Mix flour & milk.", "Eggs 2")
+	if strings.Contains(got, "hidden") {
+		t.Errorf("script text leaked: %q", got)
+	}
+}
+
+func TestExtractEML(t *testing.T) {
+	data := []byte("From: Alice <alice@example.com>\r\n" +
+		"To: bob@example.com\r\n" +
+		"Subject: =?UTF-8?B?5pyI5oql?= report\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=alt\r\n" +
+		"\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		"\r\n" +
+		"<p>HTML version</p>\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Caf=C3=A9 receipts attached.\r\n" +
+		"--alt--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf\r\n" +
+		"Content-Disposition: attachment; filename=r.pdf\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"JVBERi0xLjQK\r\n" +
+		"--outer--\r\n")
+	got := extractBytes(t, "mail.eml", data)
+	assertContains(t, got, "月报 report", "Alice", "Café receipts attached.")
+	if strings.Contains(got, "HTML version") {
+		t.Errorf("html alternative indexed alongside plain text: %q", got)
+	}
+}
+
+func TestExtractFile_RespectsLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.html")
+	if err := os.WriteFile(path, []byte("<p>"+strings.Repeat("word ", 100)+"</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ExtractFile(&Format{Name: "html", MaxFileSize: 10, Extract: extractHTML}, path); got != "" {
+		t.Errorf("oversized file: got %q, want nothing", got)
+	}
+	if got := ExtractFile(&Format{Name: "html", MaxTextBytes: 12, Extract: extractHTML}, path); got != "word word wo" {
+		t.Errorf("text cap: got %q", got)
+	}
+}
+
+func TestRegistry_Lookup(t *testing.T) {
+	r := DefaultRegistry()
+	if f := r.Lookup("Scans/TAX.PDF", ""); f == nil || f.Name != "pdf" {
+		t.Errorf("extension lookup is case-insensitive, got %+v", f)
+	}
+	if f := r.Lookup("download", "application/pdf; charset=binary"); f == nil || f.Name != "pdf" {
+		t.Errorf("MIME fallback failed, got %+v", f)
+	}
+	if f := r.Lookup("notes.md", "text/markdown"); f != nil {
+		t.Errorf("plain text should not have a format, got %s", f.Name)
+	}
+
+	r.Register(Format{Name: "custom", Extensions: []string{".pdf"}})
+	if f := r.Lookup("a.pdf", ""); f.Name != "custom" {
+		t.Errorf("later Register should override, got %s", f.Name)
+	}
+}
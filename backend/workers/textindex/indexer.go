@@ -2,7 +2,6 @@ package textindex
 
 import (
 	"context"
-	"path/filepath"
 
 	"github.com/google/uuid"
 	"github.com/xiaoyuanzhu-com/my-life-db/db"
@@ -14,15 +13,25 @@ import (
 // the index. There is no staging table, no async sync worker, no external
 // service.
 type Indexer struct {
-	dataRoot string
-	db       *db.DB
+	resolve    func(path string) string
+	db         *db.DB
+	isIgnored  func(path string) bool
+	extractors *Registry
 }
 
-// NewIndexer creates a text indexer rooted at the user's data directory.
-// dataRoot is the absolute filesystem path; relative file paths in
-// db.files are joined against it to read content.
-func NewIndexer(dataRoot string, database *db.DB) *Indexer {
-	return &Indexer{dataRoot: dataRoot, db: database}
+// NewIndexer creates a text indexer over the user's library. resolve maps
+// the relative file paths in db.files to where they live on disk (the data
+// directory, or a mounted folder) to read content. isIgnored (optional)
+// reports paths excluded by the user's ignore rules; they are kept out of
+// files_fts even if a files row still exists for them.
+func NewIndexer(resolve func(path string) string, database *db.DB, isIgnored func(path string) bool) *Indexer {
+	return &Indexer{resolve: resolve, db: database, isIgnored: isIgnored, extractors: DefaultRegistry()}
+}
+
+// Extractors returns the document format registry, for registering
+// additional formats.
+func (idx *Indexer) Extractors() *Registry {
+	return idx.extractors
 }
 
 // OnFileChange is called by the FS service when a file is created,
@@ -40,6 +49,15 @@ func (idx *Indexer) OnFileChange(filePath string, isNew bool, contentChanged boo
 	}
 }
 
+// JobKind is the job queue kind for indexing one file (key: the path).
+const JobKind = "textindex"
+
+// IndexJob is the job queue handler for JobKind: the queued counterpart
+// of OnFileChange, for callers that want the work off the event path.
+func (idx *Indexer) IndexJob(ctx context.Context, filePath string) error {
+	return idx.indexFile(filePath)
+}
+
 // OnFileDelete removes the file's row from files_fts.
 func (idx *Indexer) OnFileDelete(filePath string) {
 	if err := idx.db.DeleteFileFromIndex(context.Background(), filePath); err != nil {
@@ -48,8 +66,8 @@ func (idx *Indexer) OnFileDelete(filePath string) {
 }
 
 // indexFile reads the file from disk and writes it to files_fts.
-// Folders and binary files are skipped; for text files the content is
-// read up to MaxContentBytes.
+// Folders are skipped. Documents with a registered Format get their
+// extracted text; other text files are read up to MaxContentBytes.
 func (idx *Indexer) indexFile(filePath string) error {
 	file, err := idx.db.GetFileByPath(filePath)
 	if err != nil || file == nil {
@@ -59,17 +77,24 @@ func (idx *Indexer) indexFile(filePath string) error {
 	if file.IsFolder {
 		return nil
 	}
+	if idx.isIgnored != nil && idx.isIgnored(filePath) {
+		// Ignored since it was indexed: the rules changed and the scanner
+		// hasn't reconciled yet.
+		return idx.db.DeleteFileFromIndex(context.Background(), filePath)
+	}
 
-	// Read content if the file looks textual. Binary files still get an
-	// index row keyed on file_path (so filename search works) but with
-	// empty content.
+	// Extract documents, read text files as-is. Other binary files still
+	// get an index row keyed on file_path (so filename search works) but
+	// with empty content.
 	content := ""
-	isText := IsTextFile(filePath)
-	if !isText && file.MimeType != nil {
-		isText = IsTextFileByMimeType(*file.MimeType)
+	mimeType := ""
+	if file.MimeType != nil {
+		mimeType = *file.MimeType
 	}
-	if isText {
-		fullPath := filepath.Join(idx.dataRoot, filePath)
+	fullPath := idx.resolve(filePath)
+	if format := idx.extractors.Lookup(filePath, mimeType); format != nil {
+		content = ExtractFile(format, fullPath)
+	} else if IsTextFile(filePath) || IsTextFileByMimeType(mimeType) {
 		content, _ = ReadTextContent(fullPath)
 	}
 
@@ -101,6 +126,11 @@ func (idx *Indexer) Backfill() {
 		}
 		total++
 
+		if idx.isIgnored != nil && idx.isIgnored(path) {
+			skipped++
+			continue
+		}
+
 		already, err := idx.db.IsFileIndexed(path)
 		if err != nil {
 			continue
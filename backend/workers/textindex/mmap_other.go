@@ -0,0 +1,10 @@
+//go:build !unix
+
+package textindex
+
+import "io"
+
+// mapReaderAt returns the first size bytes of r read into memory.
+func mapReaderAt(r io.ReaderAt, size int64) ([]byte, func(), error) {
+	return readAllAt(r, size)
+}
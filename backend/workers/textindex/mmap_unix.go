@@ -0,0 +1,25 @@
+//go:build unix
+
+package textindex
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// mapReaderAt returns the first size bytes of r and a func that releases
+// them. A regular file is memory-mapped read-only, so a large document is
+// paged in by the kernel as the parser touches it instead of being copied
+// onto the heap; anything else is read into memory.
+//
+// A file truncated while mapped faults on access; safeExtract turns that
+// fault into a recovered panic.
+func mapReaderAt(r io.ReaderAt, size int64) ([]byte, func(), error) {
+	if f, ok := r.(*os.File); ok && size > 0 && int64(int(size)) == size {
+		if data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED); err == nil {
+			return data, func() { syscall.Munmap(data) }, nil
+		}
+	}
+	return readAllAt(r, size)
+}
@@ -61,7 +61,7 @@ export interface AgentContextValue {
   lastTurnOutcome?: LastTurnOutcome
   /** Unix ms timestamp when the last outcome was recorded. */
   lastTurnOutcomeAt?: number | null
-  /** Populated only when lastTurnOutcome === 'errored'. */
+  /** Populated only when lastTurnOutcome is 'errored' or 'limited'. */
   lastErrorMessage?: string
   /** The last prompt text that was in-flight (used for Resume). */
   lastPromptText?: string | null
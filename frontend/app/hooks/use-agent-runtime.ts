@@ -287,7 +287,7 @@ export function useAgentRuntime(options: {
           setHistoryLoadError(null)
           setSessionError(null)
           // Outcome state from DB (any of: '', 'completed', 'cancelled',
-          // 'interrupted', 'errored'). Empty or 'completed' means no banner.
+          // 'interrupted', 'errored', 'limited'). Empty or 'completed' means no banner.
           setLastTurnOutcome(f.lastTurnOutcome ?? '')
           setLastTurnOutcomeAt(f.lastTurnOutcomeAt ?? null)
           setLastErrorMessage(f.lastErrorMessage ?? '')
@@ -145,10 +145,10 @@ export interface SessionInfoFrame extends AcpFrame {
   /** Source of the session: "user" or "auto" */
   source?: string
   /** Outcome of the last completed turn — empty when no turn has occurred. */
-  lastTurnOutcome?: '' | 'completed' | 'cancelled' | 'interrupted' | 'errored'
+  lastTurnOutcome?: '' | 'completed' | 'cancelled' | 'interrupted' | 'errored' | 'limited'
   /** Unix ms timestamp when the last outcome was recorded. */
   lastTurnOutcomeAt?: number
-  /** Populated only when lastTurnOutcome === 'errored'. */
+  /** Populated only when lastTurnOutcome is 'errored' or 'limited'. */
   lastErrorMessage?: string
   /** The last prompt text that was in-flight (used for Resume). */
   lastPromptText?: string
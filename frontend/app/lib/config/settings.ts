@@ -61,7 +61,7 @@ export interface UserSettings {
     dataPath: string;
     backupPath?: string;
     autoBackup: boolean;
-    maxFileSize: number; // MB
+    maxFileSize: number; // MB, 0 = no limit
   };
 }
 
@@ -118,7 +118,7 @@ export const DEFAULT_SETTINGS: UserSettings = {
   storage: {
     dataPath: './data',
     autoBackup: false,
-    maxFileSize: 50, // 50 MB
+    maxFileSize: 0, // no limit
   },
 };
 
@@ -19,12 +19,13 @@ export type LastTurnOutcome =
   | 'cancelled'
   | 'interrupted'
   | 'errored'
+  | 'limited' // agent killed for exceeding its resource limits; surfaces as 'error'
 
 // Outcomes that are user-actionable (Resume / Dismiss banner shown).
 // 'errored' uses the verb form to match the DB column; the banner variant
 // renders as 'error'.
-export type ActionableOutcome = 'cancelled' | 'interrupted' | 'errored'
+export type ActionableOutcome = 'cancelled' | 'interrupted' | 'errored' | 'limited'
 
 export function isActionableOutcome(o: LastTurnOutcome | undefined | null): o is ActionableOutcome {
-  return o === 'cancelled' || o === 'interrupted' || o === 'errored'
+  return o === 'cancelled' || o === 'interrupted' || o === 'errored' || o === 'limited'
 }